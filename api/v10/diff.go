@@ -0,0 +1,31 @@
+package v10
+
+import (
+	"github.com/weaveworks/flux"
+)
+
+// The ways a sync would change a resource, as given in ResourceDiff.
+const (
+	DiffCreate    = "create"    // the resource isn't in the cluster
+	DiffUpdate    = "update"    // the resource in the cluster differs from its manifest
+	DiffUnchanged = "unchanged" // the resource in the cluster matches its manifest
+	DiffError     = "error"     // the resource couldn't be compared
+)
+
+// Diff says how syncing the manifests at a revision would change the
+// resources in the cluster. Like Graph, it's not part of the Server
+// interface.
+type Diff struct {
+	Revision  string         `json:"revision,omitempty"` // the revision the manifests are from
+	Resources []ResourceDiff `json:"resources"`
+}
+
+// ResourceDiff gives the changes a sync would make to a resource, as
+// a unified diff from the resource in the cluster to its manifest.
+type ResourceDiff struct {
+	ID     flux.ResourceID `json:"id"`
+	Path   string          `json:"path,omitempty"` // the file defining it, relative to the top of the repo
+	Status string          `json:"status"`
+	Diff   string          `json:"diff,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
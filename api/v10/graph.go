@@ -0,0 +1,34 @@
+package v10
+
+import (
+	"github.com/weaveworks/flux"
+)
+
+// Graph relates the workloads running in the cluster to the files in
+// git they are defined in, the resources they were created because
+// of (e.g., a FluxHelmRelease), and the images their containers run.
+// Like Status, it's not part of the Server interface.
+type Graph struct {
+	Revision  string          `json:"revision,omitempty"` // the revision the paths are from
+	Workloads []WorkloadGraph `json:"workloads"`
+}
+
+// WorkloadGraph gives the things a workload came from, and the images
+// it runs.
+type WorkloadGraph struct {
+	ID   flux.ResourceID `json:"id"`
+	Path string          `json:"path,omitempty"` // the file defining it, relative to the top of the repo, if it's in git
+	Line int             `json:"line,omitempty"` // where the definition starts in the file, if known
+	// The resource this workload was created because of, if any, and
+	// where that is defined
+	Antecedent     flux.ResourceID  `json:"antecedent"`
+	AntecedentPath string           `json:"antecedentPath,omitempty"`
+	AntecedentLine int              `json:"antecedentLine,omitempty"`
+	Containers     []ContainerGraph `json:"containers,omitempty"`
+}
+
+// ContainerGraph gives the image a container is running.
+type ContainerGraph struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
@@ -0,0 +1,24 @@
+package v10
+
+import (
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// PendingRelease is an automated release waiting to be approved
+// before it's committed: the updates to a workload's containers. Like
+// Graph, it's not part of the Server interface.
+type PendingRelease struct {
+	ID       string          `json:"id"`
+	Workload flux.ResourceID `json:"workload"`
+	Changes  []PendingChange `json:"changes"`
+	StagedAt time.Time       `json:"stagedAt"` // when the release was first found
+}
+
+// PendingChange is the update to one container in a pending release.
+type PendingChange struct {
+	Container string `json:"container"`
+	Current   string `json:"current"`
+	Target    string `json:"target"`
+}
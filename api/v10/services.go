@@ -0,0 +1,45 @@
+package v10
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/weaveworks/flux/api/v6"
+)
+
+// ListServicesOptions narrows the workloads listed to those with the
+// labels and policies given, or with newer images to release. Like
+// Graph, it's not part of the Server interface; the daemon lists
+// workloads with options itself.
+type ListServicesOptions struct {
+	Namespace string
+	// A label selector, in the form kubectl takes, e.g.,
+	// `app=web,tier!=db`
+	Selector  string
+	Automated bool // only automated workloads
+	Locked    bool // only locked workloads
+	// Only workloads running images older than the latest their
+	// filters allow
+	OutOfDate bool
+}
+
+// Filter gives the workloads with the labels and policies asked for.
+// Whether a workload is out of date can't be told from its status,
+// so isn't considered here.
+func (opts ListServicesOptions) Filter(services []v6.ControllerStatus) ([]v6.ControllerStatus, error) {
+	selector, err := labels.Parse(opts.Selector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing selector %q", opts.Selector)
+	}
+	res := []v6.ControllerStatus{}
+	for _, s := range services {
+		switch {
+		case !selector.Matches(labels.Set(s.Labels)):
+		case opts.Automated && !s.Automated:
+		case opts.Locked && !s.Locked:
+		default:
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
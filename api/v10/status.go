@@ -0,0 +1,47 @@
+package v10
+
+import (
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// Status summarises the state of a daemon, for monitoring. It's not
+// part of the Server interface, since only a daemon (rather than,
+// e.g., an upstream service) can report it.
+type Status struct {
+	Git      GitStatus  `json:"git"`
+	LastSync SyncResult `json:"lastSync"`
+	Queues   Queues     `json:"queues"`
+}
+
+// GitStatus is the state of the daemon's mirror of the git repo.
+type GitStatus struct {
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SyncResult is the outcome of the most recent sync.
+type SyncResult struct {
+	Revision       string          `json:"revision,omitempty"`  // the revision last applied, if any has been
+	Time           time.Time       `json:"time,omitempty"`      // when it was applied
+	ResourceErrors int             `json:"resourceErrors"`      // how many resources failed to apply
+	Error          string          `json:"error,omitempty"`     // why the last attempt to sync failed, if it did
+	Attempted      time.Time       `json:"attempted,omitempty"` // when the last attempt to sync, successful or not, finished
+	Errors         []ResourceError `json:"errors,omitempty"`    // the resources that failed to apply or, if the last attempt failed validation, to validate
+}
+
+// ResourceError says which resource failed to sync, where it is
+// defined in the repo, and why it failed.
+type ResourceError struct {
+	ID    flux.ResourceID `json:"id"`
+	Path  string          `json:"path"`           // relative to the top of the repo
+	Line  int             `json:"line,omitempty"` // where the definition starts in the file, if known
+	Error string          `json:"error"`
+}
+
+// Queues gives the number of things waiting to be done.
+type Queues struct {
+	Jobs int `json:"jobs"`
+}
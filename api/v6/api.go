@@ -34,12 +34,41 @@ type ControllerStatus struct {
 	Containers []Container
 	ReadOnly   ReadOnlyReason
 	Status     string
+	Rollout    RolloutStatus
 	Antecedent flux.ResourceID
 	Labels     map[string]string
 	Automated  bool
 	Locked     bool
 	Ignore     bool
 	Policies   map[string]string
+	// Set if the replicas are managed by a horizontal pod
+	// autoscaler, rather than given in the manifest
+	Autoscaler        *Autoscaler        `json:",omitempty"`
+	DisruptionBudgets []DisruptionBudget `json:",omitempty"`
+}
+
+// RolloutStatus gives the progress of replacing a controller's pods
+// with those from its current definition.
+type RolloutStatus struct {
+	Desired   int32
+	Updated   int32
+	Ready     int32
+	Available int32
+	Outdated  int32
+	Messages  []string `json:",omitempty"`
+}
+
+type Autoscaler struct {
+	Name            string
+	MinReplicas     int32
+	MaxReplicas     int32
+	CurrentReplicas int32
+}
+
+type DisruptionBudget struct {
+	Name           string
+	MinAvailable   string `json:",omitempty"`
+	MaxUnavailable string `json:",omitempty"`
 }
 
 // --- config types
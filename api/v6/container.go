@@ -15,9 +15,11 @@ type Container struct {
 	Current        image.Info `json:",omitempty"`
 	LatestFiltered image.Info `json:",omitempty"`
 
-	// All available images (ignoring tag filters)
+	// All available images (ignoring tag filters). If they are
+	// stale (could not be refreshed recently), AvailableError says why.
 	Available               update.SortedImageInfos `json:",omitempty"`
 	AvailableError          string                  `json:",omitempty"`
+	AvailableStale          bool                    `json:",omitempty"`
 	AvailableImagesCount    int                     `json:",omitempty"`
 	NewAvailableImagesCount int                     `json:",omitempty"`
 
@@ -26,15 +28,21 @@ type Container struct {
 	NewFilteredImagesCount int `json:",omitempty"`
 }
 
-// NewContainer creates a Container given a list of images and the current image
-func NewContainer(name string, images update.ImageInfos, currentImage image.Info, tagPattern policy.Pattern, fields []string) (Container, error) {
+// NewContainer creates a Container given a list of images, the error
+// (if any) from getting them, and the current image
+func NewContainer(name string, images update.ImageInfos, imagesErr error, currentImage image.Info, tagPattern policy.Pattern, fields []string) (Container, error) {
 	sorted := images.Sort(tagPattern)
 
 	// All images
 	imagesCount := len(sorted)
-	imagesErr := ""
-	if sorted == nil {
-		imagesErr = registry.ErrNoImageData.Error()
+	var availableErr string
+	var stale bool
+	switch {
+	case imagesErr != nil:
+		availableErr = imagesErr.Error()
+		stale = registry.IsStale(imagesErr)
+	case sorted == nil:
+		availableErr = registry.ErrNoImageData.Error()
 	}
 	var newImages update.SortedImageInfos
 	for _, img := range sorted {
@@ -62,7 +70,8 @@ func NewContainer(name string, images update.ImageInfos, currentImage image.Info
 		LatestFiltered: latestFiltered,
 
 		Available:               sorted,
-		AvailableError:          imagesErr,
+		AvailableError:          availableErr,
+		AvailableStale:          stale,
 		AvailableImagesCount:    imagesCount,
 		NewAvailableImagesCount: newImagesCount,
 		FilteredImagesCount:     filteredImagesCount,
@@ -82,6 +91,7 @@ func filterContainerFields(container Container, fields []string) (Container, err
 			"LatestFiltered",
 			"Available",
 			"AvailableError",
+			"AvailableStale",
 			"AvailableImagesCount",
 			"NewAvailableImagesCount",
 			"FilteredImagesCount",
@@ -102,6 +112,8 @@ func filterContainerFields(container Container, fields []string) (Container, err
 			c.Available = container.Available
 		case "AvailableError":
 			c.AvailableError = container.AvailableError
+		case "AvailableStale":
+			c.AvailableStale = container.AvailableStale
 		case "AvailableImagesCount":
 			c.AvailableImagesCount = container.AvailableImagesCount
 		case "NewAvailableImagesCount":
@@ -1,19 +1,23 @@
 package v6
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/update"
 )
 
 func TestNewContainer(t *testing.T) {
 
 	testImage := image.Info{ImageID: "test"}
+	staleErr := &registry.StaleError{LastUpdate: time.Now(), Err: errors.New("registry unavailable")}
 
 	currentSemver := image.Info{ID: image.Ref{Tag: "1.0.0"}}
 	oldSemver := image.Info{ID: image.Ref{Tag: "0.9.0"}}
@@ -22,6 +26,7 @@ func TestNewContainer(t *testing.T) {
 	type args struct {
 		name         string
 		images       update.ImageInfos
+		imagesErr    error
 		currentImage image.Info
 		tagPattern   policy.Pattern
 		fields       []string
@@ -72,10 +77,33 @@ func TestNewContainer(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Stale images",
+			args: args{
+				name:         "container1",
+				images:       update.ImageInfos{testImage},
+				imagesErr:    staleErr,
+				currentImage: testImage,
+				tagPattern:   policy.PatternAll,
+			},
+			want: Container{
+				Name:                    "container1",
+				Current:                 testImage,
+				LatestFiltered:          testImage,
+				Available:               []image.Info{testImage},
+				AvailableError:          staleErr.Error(),
+				AvailableStale:          true,
+				AvailableImagesCount:    1,
+				NewAvailableImagesCount: 0,
+				FilteredImagesCount:     1,
+				NewFilteredImagesCount:  0,
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := NewContainer(tt.args.name, tt.args.images, tt.args.currentImage, tt.args.tagPattern, tt.args.fields)
+			got, err := NewContainer(tt.args.name, tt.args.images, tt.args.imagesErr, tt.args.currentImage, tt.args.tagPattern, tt.args.fields)
 			assert.Equal(t, tt.wantErr, err != nil)
 			assert.Equal(t, tt.want, got)
 		})
@@ -89,6 +117,7 @@ func TestFilterContainerFields(t *testing.T) {
 		LatestFiltered:          image.Info{ImageID: "123"},
 		Available:               []image.Info{{ImageID: "123"}},
 		AvailableError:          "test",
+		AvailableStale:          true,
 		AvailableImagesCount:    1,
 		NewAvailableImagesCount: 2,
 		FilteredImagesCount:     3,
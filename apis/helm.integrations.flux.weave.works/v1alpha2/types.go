@@ -2,6 +2,7 @@ package v1alpha2
 
 import (
 	"github.com/ghodss/yaml"
+	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/helm/pkg/chartutil"
 )
@@ -22,13 +23,47 @@ type FluxHelmRelease struct {
 // FluxHelmReleaseSpec is the spec for a FluxHelmRelease resource
 // FluxHelmReleaseSpec
 type FluxHelmReleaseSpec struct {
-	ChartGitPath   string `json:"chartGitPath"`
-	ReleaseName    string `json:"releaseName,omitempty"`
+	ChartGitPath   string   `json:"chartGitPath"`
+	ReleaseName    string   `json:"releaseName,omitempty"`
+	Rollback       Rollback `json:"rollback,omitempty"`
 	FluxHelmValues `json:",inline"`
 }
 
+// Rollback says whether, and how, to roll a release back when
+// upgrading it fails.
+type Rollback struct {
+	Enable       bool `json:"enable,omitempty"`
+	Force        bool `json:"force,omitempty"`
+	Recreate     bool `json:"recreate,omitempty"`
+	DisableHooks bool `json:"disableHooks,omitempty"`
+	// Timeout is how long to wait for each Kubernetes operation of
+	// the rollback, in seconds; when zero, Tiller's default is used
+	Timeout int64 `json:"timeout,omitempty"`
+	// MaxRetries is how many more times to try upgrading to the
+	// same chart and values after rolling back; when zero, the
+	// release is left rolled back until either changes
+	MaxRetries int `json:"maxRetries,omitempty"`
+}
+
 type FluxHelmReleaseStatus struct {
-	ReleaseStatus string `json:"releaseStatus"`
+	ReleaseStatus string                     `json:"releaseStatus"`
+	Conditions    []FluxHelmReleaseCondition `json:"conditions,omitempty"`
+}
+
+type FluxHelmReleaseConditionType string
+
+const (
+	// ChartFound is whether the chart given by a FluxHelmRelease is
+	// in the git repo. When it's False, the reason says why not.
+	ChartFound FluxHelmReleaseConditionType = "ChartFound"
+)
+
+type FluxHelmReleaseCondition struct {
+	Type               FluxHelmReleaseConditionType `json:"type"`
+	Status             v1.ConditionStatus           `json:"status"`
+	LastTransitionTime metav1.Time                  `json:"lastTransitionTime,omitempty"`
+	Reason             string                       `json:"reason,omitempty"`
+	Message            string                       `json:"message,omitempty"`
 }
 
 // FluxHelmValues embeds chartutil.Values so we can implement deepcopy on map[string]interface{}
@@ -3,6 +3,7 @@ package v1alpha2
 import (
 	"testing"
 
+	"github.com/ghodss/yaml"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,3 +51,28 @@ func TestFluxHelmValues(t *testing.T) {
 		assert.Exactly(t, tc.expectedOriginal, tc.original, "original was mutated. test case: %d", i)
 	}
 }
+
+func TestRollbackSpec(t *testing.T) {
+	const spec = `
+chartGitPath: mongodb
+rollback:
+  enable: true
+  recreate: true
+  timeout: 300
+  maxRetries: 2
+values:
+  image: bitnami/mongodb:3.7.1-r1
+`
+	var s FluxHelmReleaseSpec
+	if err := yaml.Unmarshal([]byte(spec), &s); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Rollback{Enable: true, Recreate: true, Timeout: 300, MaxRetries: 2}, s.Rollback)
+	assert.Equal(t, "bitnami/mongodb:3.7.1-r1", s.Values["image"])
+
+	s = FluxHelmReleaseSpec{}
+	if err := yaml.Unmarshal([]byte("chartGitPath: mongodb\n"), &s); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, s.Rollback.Enable, "rollback should be disabled unless enabled")
+}
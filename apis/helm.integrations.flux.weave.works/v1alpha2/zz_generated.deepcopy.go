@@ -30,7 +30,7 @@ func (in *FluxHelmRelease) DeepCopyInto(out *FluxHelmRelease) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -53,6 +53,23 @@ func (in *FluxHelmRelease) DeepCopyObject() runtime.Object {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FluxHelmReleaseCondition) DeepCopyInto(out *FluxHelmReleaseCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FluxHelmReleaseCondition.
+func (in *FluxHelmReleaseCondition) DeepCopy() *FluxHelmReleaseCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(FluxHelmReleaseCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FluxHelmReleaseList) DeepCopyInto(out *FluxHelmReleaseList) {
 	*out = *in
@@ -90,6 +107,7 @@ func (in *FluxHelmReleaseList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FluxHelmReleaseSpec) DeepCopyInto(out *FluxHelmReleaseSpec) {
 	*out = *in
+	out.Rollback = in.Rollback
 	in.FluxHelmValues.DeepCopyInto(&out.FluxHelmValues)
 	return
 }
@@ -107,6 +125,13 @@ func (in *FluxHelmReleaseSpec) DeepCopy() *FluxHelmReleaseSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FluxHelmReleaseStatus) DeepCopyInto(out *FluxHelmReleaseStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]FluxHelmReleaseCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -119,3 +144,19 @@ func (in *FluxHelmReleaseStatus) DeepCopy() *FluxHelmReleaseStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Rollback) DeepCopyInto(out *Rollback) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Rollback.
+func (in *Rollback) DeepCopy() *Rollback {
+	if in == nil {
+		return nil
+	}
+	out := new(Rollback)
+	in.DeepCopyInto(out)
+	return out
+}
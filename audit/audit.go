@@ -0,0 +1,226 @@
+// Package audit records the changes flux makes -- releases, policy
+// changes, automated updates and syncs -- with who asked for them,
+// when, and the git revision that resulted, so they can be looked
+// over later.
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// Action is the kind of change recorded.
+type Action string
+
+const (
+	Release          Action = "release"
+	AutomatedRelease Action = "automated_release"
+	Policy           Action = "policy"
+	Sync             Action = "sync"
+	Rollback         Action = "rollback"
+	HelmValues       Action = "helm_values"
+)
+
+// Actions are all the kinds of change recorded.
+var Actions = []Action{Release, AutomatedRelease, Policy, Sync, Rollback, HelmValues}
+
+// ParseAction checks that the string given names a kind of change.
+func ParseAction(s string) (Action, error) {
+	for _, a := range Actions {
+		if string(a) == s {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unknown action %q (expected one of %s)", s, joinActions(Actions))
+}
+
+func joinActions(actions []Action) string {
+	var strs []string
+	for _, a := range actions {
+		strs = append(strs, string(a))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// Severity says how much attention a record deserves.
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+var severityRank = map[Severity]int{
+	SeverityInfo:    0,
+	SeverityWarning: 1,
+	SeverityError:   2,
+}
+
+// ParseSeverity checks that the string given is a severity.
+func ParseSeverity(s string) (Severity, error) {
+	if _, ok := severityRank[Severity(s)]; !ok {
+		return "", fmt.Errorf("unknown severity %q (expected one of info, warning, error)", s)
+	}
+	return Severity(s), nil
+}
+
+// AtLeast reports whether the severity is as severe as the one given,
+// or more so.
+func (s Severity) AtLeast(min Severity) bool {
+	return severityRank[s] >= severityRank[min]
+}
+
+// Record is an entry in the audit log.
+type Record struct {
+	// Assigned when the record is made. IDs increase from one record
+	// to the next, including across restarts (they start from the
+	// time at which the log was created), so the ID of the last
+	// record seen can be used to resume reading from there.
+	ID     uint64    `json:"id,omitempty"`
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+	// Who the caller said they were (e.g., from `fluxctl --user`);
+	// this is not checked, so is only a claim
+	User string `json:"user,omitempty"`
+	// Who the caller was authenticated as, if the API requires
+	// callers to be identified
+	Identities []string          `json:"identities,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	Workloads  []flux.ResourceID `json:"workloads,omitempty"`
+	// The revision committed, or synced
+	Revision string `json:"revision,omitempty"`
+	JobID    string `json:"jobID,omitempty"`
+	// A summary of what was done, for reading
+	Summary string `json:"summary,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// If not given, a record is an error if it has an error, and
+	// info otherwise
+	Severity Severity `json:"severity,omitempty"`
+}
+
+// Query selects records from the log.
+type Query struct {
+	// Only records made after this time
+	Since time.Time
+	// Only records with IDs greater than this
+	AfterID uint64
+	// At most this many records (the most recent), if greater than
+	// zero
+	Limit int
+	// Only records at least this severe, if given
+	MinSeverity Severity
+	// Only records of these actions, if any are given
+	Actions []Action
+}
+
+// Matches reports whether the record is selected by the query,
+// leaving aside the limit.
+func (q Query) Matches(r Record) bool {
+	if !r.Time.After(q.Since) || r.ID <= q.AfterID {
+		return false
+	}
+	if q.MinSeverity != "" && !r.Severity.AtLeast(q.MinSeverity) {
+		return false
+	}
+	if len(q.Actions) == 0 {
+		return true
+	}
+	for _, a := range q.Actions {
+		if r.Action == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Sink is somewhere audit records are written.
+type Sink interface {
+	Write(Record) error
+}
+
+// DefaultRetain is how many records a Log keeps, by default, to
+// answer queries.
+const DefaultRetain = 1000
+
+// Log writes records to its sinks, and keeps the most recent ones to
+// answer queries.
+type Log struct {
+	sinks  []Sink
+	retain int
+
+	mu     sync.Mutex
+	recent []Record
+	lastID uint64
+}
+
+// New returns a Log that keeps the last `retain` records, and writes
+// each record to the sinks given.
+func New(retain int, sinks ...Sink) *Log {
+	if retain <= 0 {
+		retain = DefaultRetain
+	}
+	// Starting the IDs from the time in microseconds keeps them
+	// ahead of those given before a restart, unless there were more
+	// than a million records a second
+	start := uint64(time.Now().UnixNano() / int64(time.Microsecond))
+	return &Log{sinks: sinks, retain: retain, lastID: start}
+}
+
+// Record adds a record to the log, and writes it to each sink. All
+// the sinks are written to, even if some fail; the errors are
+// returned together.
+func (l *Log) Record(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	if r.Severity == "" {
+		r.Severity = SeverityInfo
+		if r.Error != "" {
+			r.Severity = SeverityError
+		}
+	}
+	l.mu.Lock()
+	l.lastID++
+	r.ID = l.lastID
+	l.recent = append(l.recent, r)
+	if len(l.recent) > l.retain {
+		l.recent = append([]Record(nil), l.recent[len(l.recent)-l.retain:]...)
+	}
+	l.mu.Unlock()
+
+	var errs []error
+	for _, sink := range l.sinks {
+		if err := sink.Write(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return fmt.Errorf("writing audit record to %d sinks failed; first error: %s", len(errs), errs[0])
+}
+
+// Records returns the records kept that match the query, oldest
+// first.
+func (l *Log) Records(q Query) []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var result []Record
+	for _, r := range l.recent {
+		if q.Matches(r) {
+			result = append(result, r)
+		}
+	}
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog_Records(t *testing.T) {
+	base := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := New(3)
+	for i, rev := range []string{"a", "b", "c", "d", "e"} {
+		assert.NoError(t, l.Record(Record{Time: base.Add(time.Duration(i) * time.Minute), Action: Sync, Revision: rev}))
+	}
+
+	revisions := func(rs []Record) (revs []string) {
+		for _, r := range rs {
+			revs = append(revs, r.Revision)
+		}
+		return revs
+	}
+	// Only the most recent are kept
+	assert.Equal(t, []string{"c", "d", "e"}, revisions(l.Records(Query{})))
+	assert.Equal(t, []string{"d", "e"}, revisions(l.Records(Query{Since: base.Add(2 * time.Minute)})))
+	assert.Equal(t, []string{"e"}, revisions(l.Records(Query{Limit: 1})))
+}
+
+func TestLog_RecordsQuery(t *testing.T) {
+	l := New(10)
+	for _, r := range []Record{
+		{Action: Release, Revision: "release"},
+		{Action: Sync, Revision: "sync"},
+		{Action: Sync, Revision: "failed-sync", Error: "2 resource(s) failed to apply"},
+		{Action: Rollback, Revision: "rollback", Error: "2 resource(s) failed to apply", Severity: SeverityWarning},
+		{Action: AutomatedRelease, Revision: "autorelease"},
+	} {
+		assert.NoError(t, l.Record(r))
+	}
+	revisions := func(rs []Record) (revs []string) {
+		for _, r := range rs {
+			revs = append(revs, r.Revision)
+		}
+		return revs
+	}
+
+	// Records are given a severity if they don't have one
+	all := l.Records(Query{})
+	assert.Equal(t, SeverityInfo, all[0].Severity)
+	assert.Equal(t, SeverityError, all[2].Severity)
+
+	assert.Equal(t, []string{"failed-sync", "rollback"}, revisions(l.Records(Query{MinSeverity: SeverityWarning})))
+	assert.Equal(t, []string{"failed-sync"}, revisions(l.Records(Query{MinSeverity: SeverityError})))
+	assert.Equal(t, []string{"sync", "failed-sync"}, revisions(l.Records(Query{Actions: []Action{Sync}})))
+	assert.Equal(t, []string{"failed-sync"}, revisions(l.Records(Query{Actions: []Action{Sync}, MinSeverity: SeverityError})))
+	assert.Equal(t, []string{"rollback", "autorelease"}, revisions(l.Records(Query{Actions: []Action{Rollback, AutomatedRelease}, Limit: 2})))
+}
+
+func TestParseSeverityAndAction(t *testing.T) {
+	s, err := ParseSeverity("warning")
+	assert.NoError(t, err)
+	assert.Equal(t, SeverityWarning, s)
+	_, err = ParseSeverity("critical")
+	assert.Error(t, err)
+
+	a, err := ParseAction("automated_release")
+	assert.NoError(t, err)
+	assert.Equal(t, AutomatedRelease, a)
+	_, err = ParseAction("deploy")
+	assert.Error(t, err)
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(Record) error {
+	return assert.AnError
+}
+
+func TestLog_Sinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	var posted []Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record Record
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		posted = append(posted, record)
+	}))
+	defer server.Close()
+
+	file, err := ParseSink("file:"+path, nil)
+	assert.NoError(t, err)
+	hook, err := ParseSink(server.URL, nil)
+	assert.NoError(t, err)
+
+	l := New(0, file, failingSink{}, hook)
+	// The other sinks are still written to when one fails
+	assert.Error(t, l.Record(Record{Action: Release, User: "alice", Summary: "images: helloworld:2"}))
+	assert.Error(t, l.Record(Record{Action: Policy, User: "bob"}))
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var written []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		written = append(written, record)
+	}
+	if assert.Len(t, written, 2) {
+		assert.Equal(t, "alice", written[0].User)
+		assert.False(t, written[0].Time.IsZero())
+		assert.Equal(t, Policy, written[1].Action)
+	}
+	assert.Equal(t, written, posted)
+}
+
+func TestParseSink(t *testing.T) {
+	for _, s := range []string{"stdout", "http://example.com/audit", "https://example.com/audit"} {
+		_, err := ParseSink(s, nil)
+		assert.NoError(t, err, s)
+	}
+	for _, s := range []string{"", "file:", "syslog", "/var/log/audit.log"} {
+		_, err := ParseSink(s, nil)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLog_IDs(t *testing.T) {
+	l := New(10)
+	for _, rev := range []string{"a", "b", "c"} {
+		assert.NoError(t, l.Record(Record{Action: Sync, Revision: rev}))
+	}
+	all := l.Records(Query{})
+	assert.True(t, all[0].ID > 0)
+	assert.Equal(t, all[0].ID+1, all[1].ID)
+	assert.Equal(t, all[1].ID+1, all[2].ID)
+
+	after := l.Records(Query{AfterID: all[0].ID})
+	assert.Len(t, after, 2)
+	assert.Equal(t, "b", after[0].Revision)
+
+	// A log made later, as when the daemon restarts, gives later IDs
+	time.Sleep(time.Millisecond)
+	restarted := New(10)
+	assert.NoError(t, restarted.Record(Record{Action: Sync}))
+	assert.True(t, restarted.Records(Query{})[0].ID > all[2].ID)
+}
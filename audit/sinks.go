@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// writerSink writes records as lines of JSON.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a sink that writes each record to the writer
+// given as a line of JSON.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Write(r Record) error {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(bs, '\n'))
+	return err
+}
+
+// NewFileSink returns a sink that appends each record to the file at
+// the path given, as a line of JSON. The file is created if it
+// doesn't exist.
+func NewFileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSink(f), nil
+}
+
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink returns a sink that POSTs each record, as JSON, to the
+// URL given.
+func NewHTTPSink(url string, client *http.Client) Sink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpSink{url: url, client: client}
+}
+
+func (s *httpSink) Write(r Record) error {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("audit sink %s responded with %s: %s", s.url, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// ParseSink makes a sink from its description: `stdout`,
+// `file:<path>`, or an http:// or https:// URL.
+func ParseSink(s string, client *http.Client) (Sink, error) {
+	switch {
+	case s == "stdout":
+		return NewWriterSink(os.Stdout), nil
+	case strings.HasPrefix(s, "file:"):
+		path := strings.TrimPrefix(s, "file:")
+		if path == "" {
+			return nil, fmt.Errorf("no path given for audit sink %q", s)
+		}
+		return NewFileSink(path)
+	case strings.HasPrefix(s, "http://"), strings.HasPrefix(s, "https://"):
+		return NewHTTPSink(s, client), nil
+	}
+	return nil, fmt.Errorf("unknown audit sink %q; expected \"stdout\", \"file:<path>\", or an http(s) URL", s)
+}
@@ -0,0 +1,183 @@
+// Package authz decides what callers of the daemon's API may do. A
+// policy gives identities -- the names given to API tokens, or the
+// common names of client certificates -- verbs they may use, in the
+// namespaces given; e.g., a team can be allowed to release and
+// change the policies of workloads in its own namespace, and nothing
+// else.
+package authz
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Verb is a kind of operation on the API.
+type Verb string
+
+const (
+	// Looking at workloads, images, jobs, sync status and events
+	VerbRead Verb = "read"
+	// Releasing images to workloads
+	VerbRelease Verb = "release"
+	// Changing the policies (automation, locks, tag filters) of
+	// workloads
+	VerbPolicy Verb = "policy"
+	// Asking the daemon to sync now. This applies to the whole repo,
+	// so it is allowed by a rule for any namespace.
+	VerbSync Verb = "sync"
+)
+
+// Verbs are all the verbs, in the order they are usually given.
+var Verbs = []Verb{VerbRead, VerbRelease, VerbPolicy, VerbSync}
+
+// Any stands for every identity, verb or namespace, in rules.
+const Any = "*"
+
+// Rule allows identities to use verbs in namespaces. Leaving out the
+// namespaces means all of them.
+type Rule struct {
+	Identities []string `yaml:"identities"`
+	Verbs      []Verb   `yaml:"verbs"`
+	Namespaces []string `yaml:"namespaces,omitempty"`
+}
+
+func (r Rule) validate() error {
+	if len(r.Identities) == 0 {
+		return fmt.Errorf("rule has no identities")
+	}
+	if len(r.Verbs) == 0 {
+		return fmt.Errorf("rule for %s has no verbs", strings.Join(r.Identities, ", "))
+	}
+verbs:
+	for _, v := range r.Verbs {
+		if v == Any {
+			continue
+		}
+		for _, known := range Verbs {
+			if v == known {
+				continue verbs
+			}
+		}
+		return fmt.Errorf("unknown verb %q in rule for %s (expected one of read, release, policy, sync, or *)", v, strings.Join(r.Identities, ", "))
+	}
+	return nil
+}
+
+func (r Rule) appliesTo(identities []string, verb Verb) bool {
+	return matchesAny(r.Identities, identities) && matchesAny(verbStrings(r.Verbs), []string{string(verb)})
+}
+
+func (r Rule) allNamespaces() bool {
+	return len(r.Namespaces) == 0 || contains(r.Namespaces, Any)
+}
+
+// Policy is a set of rules; anything not allowed by one of them is
+// forbidden.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// LoadPolicy reads a policy from a YAML file, like
+//
+//	rules:
+//	- identities: [ci]
+//	  verbs: ["*"]
+//	- identities: [team-a]
+//	  verbs: [read, release, policy]
+//	  namespaces: [team-a]
+func LoadPolicy(path string) (*Policy, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := yaml.UnmarshalStrict(bs, &p); err != nil {
+		return nil, fmt.Errorf("parsing authorization policy %s: %s", path, err)
+	}
+	for _, r := range p.Rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("in authorization policy %s: %s", path, err)
+		}
+	}
+	return &p, nil
+}
+
+// Allows reports whether any of the identities given may use the
+// verb in the namespace given.
+func (p *Policy) Allows(identities []string, verb Verb, namespace string) bool {
+	for _, r := range p.Rules {
+		if r.appliesTo(identities, verb) && (verb == VerbSync || r.allNamespaces() || contains(r.Namespaces, namespace)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAll reports whether any of the identities given may use the
+// verb in every namespace.
+func (p *Policy) AllowsAll(identities []string, verb Verb) bool {
+	for _, r := range p.Rules {
+		if r.appliesTo(identities, verb) && r.allNamespaces() {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAny reports whether any of the identities given may use the
+// verb in at least one namespace.
+func (p *Policy) AllowsAny(identities []string, verb Verb) bool {
+	for _, r := range p.Rules {
+		if r.appliesTo(identities, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+type identitiesKey struct{}
+
+// WithIdentities returns a context carrying the identities of the
+// caller, once they have been authenticated.
+func WithIdentities(ctx context.Context, identities ...string) context.Context {
+	return context.WithValue(ctx, identitiesKey{}, identities)
+}
+
+// Identities returns the identities of the caller, as put in the
+// context with WithIdentities. A caller that has been authenticated
+// without being given a name has no identities, but still matches
+// rules for `*`.
+func Identities(ctx context.Context) ([]string, bool) {
+	ids, ok := ctx.Value(identitiesKey{}).([]string)
+	return ids, ok
+}
+
+func matchesAny(patterns, values []string) bool {
+	for _, p := range patterns {
+		if p == Any || contains(values, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func verbStrings(verbs []Verb) []string {
+	ss := make([]string, len(verbs))
+	for i, v := range verbs {
+		ss[i] = string(v)
+	}
+	return ss
+}
@@ -0,0 +1,359 @@
+package authz
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v6"
+	fluxerr "github.com/weaveworks/flux/errors"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/remote"
+	"github.com/weaveworks/flux/update"
+)
+
+const testPolicy = `
+rules:
+- identities: [ci]
+  verbs: ["*"]
+- identities: [team-a]
+  verbs: [read, release, policy]
+  namespaces: [team-a]
+- identities: ["*"]
+  verbs: [sync]
+  namespaces: [nowhere]
+`
+
+func loadPolicy(t *testing.T, content string) (*Policy, error) {
+	f, err := ioutil.TempFile("", "flux-authz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(content)
+	f.Close()
+	return LoadPolicy(f.Name())
+}
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, p.Rules, 3)
+
+	for _, bad := range []string{
+		"rules:\n- verbs: [read]\n",
+		"rules:\n- identities: [a]\n",
+		"rules:\n- identities: [a]\n  verbs: [write]\n",
+		"rules:\n- identity: [a]\n  verbs: [read]\n",
+	} {
+		_, err := loadPolicy(t, bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci, teamA, nobody := []string{"ci"}, []string{"team-a"}, []string{}
+
+	assert.True(t, p.Allows(ci, VerbRelease, "team-b"))
+	assert.True(t, p.AllowsAll(ci, VerbPolicy))
+
+	assert.True(t, p.Allows(teamA, VerbRelease, "team-a"))
+	assert.False(t, p.Allows(teamA, VerbRelease, "team-b"))
+	assert.True(t, p.AllowsAny(teamA, VerbRead))
+	assert.False(t, p.AllowsAll(teamA, VerbRead))
+
+	// sync isn't particular to a namespace
+	assert.True(t, p.Allows(nobody, VerbSync, "team-a"))
+	assert.False(t, p.AllowsAny(nobody, VerbRead))
+}
+
+func TestServer(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamAID := flux.MustParseResourceID("team-a:deployment/app")
+	teamBID := flux.MustParseResourceID("team-b:deployment/app")
+	mock := &remote.MockServer{
+		ListServicesAnswer: []v6.ControllerStatus{{ID: teamAID}, {ID: teamBID}},
+		ListImagesAnswer:   []v6.ImageStatus{{ID: teamAID}, {ID: teamBID}},
+		ExportAnswer:       []byte("everything"),
+	}
+	s := NewServer(mock, p)
+
+	var (
+		ci        = WithIdentities(context.Background(), "ci")
+		teamA     = WithIdentities(context.Background(), "team-a")
+		unnamed   = WithIdentities(context.Background())
+		anonymous = context.Background()
+	)
+	isForbidden := func(err error) bool {
+		ferr, ok := err.(*fluxerr.Error)
+		return ok && ferr.Type == fluxerr.Forbidden
+	}
+
+	// Reads are filtered to what can be read
+	services, err := s.ListServices(teamA, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []v6.ControllerStatus{{ID: teamAID}}, services)
+	services, err = s.ListServices(ci, "")
+	assert.NoError(t, err)
+	assert.Len(t, services, 2)
+	_, err = s.ListServices(teamA, "team-b")
+	assert.True(t, isForbidden(err))
+	_, err = s.ListServices(anonymous, "")
+	assert.True(t, isForbidden(err))
+
+	images, err := s.ListImages(teamA, update.ResourceSpecAll)
+	assert.NoError(t, err)
+	assert.Equal(t, []v6.ImageStatus{{ID: teamAID}}, images)
+
+	_, err = s.Export(teamA)
+	assert.True(t, isForbidden(err))
+	_, err = s.Export(ci)
+	assert.NoError(t, err)
+
+	release := func(specs ...update.ResourceSpec) update.Spec {
+		return update.Spec{Type: update.Images, Spec: update.ReleaseSpec{
+			ServiceSpecs: specs,
+			ImageSpec:    update.ImageSpecLatest,
+			Kind:         update.ReleaseKindExecute,
+		}}
+	}
+	_, err = s.UpdateManifests(teamA, release(update.MakeResourceSpec(teamAID)))
+	assert.NoError(t, err)
+	_, err = s.UpdateManifests(teamA, release(update.MakeResourceSpec(teamAID), update.MakeResourceSpec(teamBID)))
+	assert.True(t, isForbidden(err))
+	_, err = s.UpdateManifests(teamA, release(update.ResourceSpecAll))
+	assert.True(t, isForbidden(err))
+	_, err = s.UpdateManifests(ci, release(update.ResourceSpecAll))
+	assert.NoError(t, err)
+
+	lock := update.Spec{Type: update.Policy, Spec: policy.Updates{
+		teamBID: policy.Update{Add: policy.Set{policy.Locked: "true"}},
+	}}
+	_, err = s.UpdateManifests(teamA, lock)
+	assert.True(t, isForbidden(err))
+
+	selected := func(patterns ...string) update.Spec {
+		return update.Spec{Type: update.Policies, Spec: update.PolicySelector{
+			Workloads: patterns,
+			Update:    policy.Update{Add: policy.Set{policy.Automated: "true"}},
+		}}
+	}
+	_, err = s.UpdateManifests(teamA, selected("team-a:deployment/*"))
+	assert.NoError(t, err)
+	_, err = s.UpdateManifests(teamA, selected("team-*:deployment/*"))
+	assert.True(t, isForbidden(err))
+
+	sync := update.Spec{Type: update.Sync, Spec: update.ManualSync{}}
+	_, err = s.UpdateManifests(unnamed, sync)
+	assert.NoError(t, err)
+	_, err = s.UpdateManifests(anonymous, sync)
+	assert.True(t, isForbidden(err))
+
+	_, err = s.GitRepoConfig(teamA, false)
+	assert.NoError(t, err)
+	_, err = s.GitRepoConfig(teamA, true)
+	assert.True(t, isForbidden(err))
+	_, err = s.GitRepoConfig(ci, true)
+	assert.NoError(t, err)
+}
+
+func TestServer_JobStatus(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamAID := flux.MustParseResourceID("team-a:deployment/app")
+	teamBID := flux.MustParseResourceID("team-b:deployment/app")
+	mock := &remote.MockServer{}
+	s := NewServer(mock, p)
+	teamA := WithIdentities(context.Background(), "team-a")
+
+	lock := func(id flux.ResourceID) *update.Spec {
+		return &update.Spec{Type: update.Policy, Spec: policy.Updates{
+			id: policy.Update{Add: policy.Set{policy.Locked: "true"}},
+		}}
+	}
+	for _, c := range []struct {
+		name    string
+		status  job.Status
+		allowed bool
+	}{
+		{"queued, own namespace", job.Status{StatusString: job.StatusQueued, Result: job.Result{Spec: lock(teamAID)}}, true},
+		{"queued, other namespace", job.Status{StatusString: job.StatusQueued, Result: job.Result{Spec: lock(teamBID)}}, false},
+		{"sync", job.Status{StatusString: job.StatusRunning, Result: job.Result{Spec: &update.Spec{Type: update.Sync, Spec: update.ManualSync{}}}}, true},
+		{"release of all", job.Status{StatusString: job.StatusFailed, Result: job.Result{Spec: &update.Spec{Type: update.Images, Spec: update.ReleaseSpec{
+			ServiceSpecs: []update.ResourceSpec{update.ResourceSpecAll},
+		}}}}, false},
+		{"result in other namespace", job.Status{StatusString: job.StatusSucceeded, Result: job.Result{
+			Spec:   lock(teamAID),
+			Result: update.Result{teamBID: update.ControllerResult{Status: update.ReleaseStatusSkipped}},
+		}}, false},
+	} {
+		mock.JobStatusAnswer = c.status
+		_, err := s.JobStatus(teamA, "job")
+		if c.allowed {
+			assert.NoError(t, err, c.name)
+		} else {
+			assert.Error(t, err, c.name)
+		}
+	}
+}
+
+type graphServer struct {
+	*remote.MockServer
+	graph v10.Graph
+}
+
+func (s graphServer) Graph(context.Context, string) (v10.Graph, error) {
+	return s.graph, nil
+}
+
+func TestServer_Graph(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamAID := flux.MustParseResourceID("team-a:deployment/app")
+	teamBRelease := flux.MustParseResourceID("team-b:fluxhelmrelease/app")
+	s := NewServer(graphServer{&remote.MockServer{}, v10.Graph{
+		Workloads: []v10.WorkloadGraph{
+			{ID: teamAID, Path: "team-a/app.yaml"},
+			{ID: flux.MustParseResourceID("team-a:deployment/chart"), Antecedent: teamBRelease, AntecedentPath: "team-b/release.yaml"},
+			{ID: flux.MustParseResourceID("team-b:deployment/app"), Path: "team-b/app.yaml"},
+		},
+	}}, p)
+
+	graph, err := s.Graph(WithIdentities(context.Background(), "team-a"), "")
+	assert.NoError(t, err)
+	if assert.Len(t, graph.Workloads, 2) {
+		assert.Equal(t, "team-a/app.yaml", graph.Workloads[0].Path)
+		assert.Equal(t, flux.ResourceID{}, graph.Workloads[1].Antecedent)
+		assert.Empty(t, graph.Workloads[1].AntecedentPath)
+	}
+	graph, err = s.Graph(WithIdentities(context.Background(), "ci"), "")
+	assert.NoError(t, err)
+	if assert.Len(t, graph.Workloads, 3) {
+		assert.Equal(t, teamBRelease, graph.Workloads[1].Antecedent)
+	}
+	_, err = s.Graph(WithIdentities(context.Background(), "team-a"), "team-b")
+	assert.Error(t, err)
+}
+
+type filteringServer struct {
+	*remote.MockServer
+	services []v6.ControllerStatus
+}
+
+func (s filteringServer) ListServicesWithOptions(context.Context, v10.ListServicesOptions) ([]v6.ControllerStatus, error) {
+	return s.services, nil
+}
+
+func TestServer_ListServicesWithOptions(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamAID := flux.MustParseResourceID("team-a:deployment/app")
+	s := NewServer(filteringServer{&remote.MockServer{}, []v6.ControllerStatus{
+		{ID: teamAID},
+		{ID: flux.MustParseResourceID("team-b:deployment/app")},
+	}}, p)
+
+	opts := v10.ListServicesOptions{OutOfDate: true}
+	services, err := s.ListServicesWithOptions(WithIdentities(context.Background(), "team-a"), opts)
+	assert.NoError(t, err)
+	if assert.Len(t, services, 1) {
+		assert.Equal(t, teamAID, services[0].ID)
+	}
+	services, err = s.ListServicesWithOptions(WithIdentities(context.Background(), "ci"), opts)
+	assert.NoError(t, err)
+	assert.Len(t, services, 2)
+	opts.Namespace = "team-b"
+	_, err = s.ListServicesWithOptions(WithIdentities(context.Background(), "team-a"), opts)
+	assert.Error(t, err)
+}
+
+type diffServer struct {
+	*remote.MockServer
+	diff v10.Diff
+}
+
+func (s diffServer) Diff(context.Context, string) (v10.Diff, error) {
+	return s.diff, nil
+}
+
+func TestServer_Diff(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(diffServer{&remote.MockServer{}, v10.Diff{
+		Resources: []v10.ResourceDiff{
+			{ID: flux.MustParseResourceID("team-a:deployment/app"), Status: v10.DiffUpdate},
+			{ID: flux.MustParseResourceID("team-b:deployment/app"), Status: v10.DiffCreate},
+		},
+	}}, p)
+
+	diff, err := s.Diff(WithIdentities(context.Background(), "team-a"), "")
+	assert.NoError(t, err)
+	if assert.Len(t, diff.Resources, 1) {
+		assert.Equal(t, flux.MustParseResourceID("team-a:deployment/app"), diff.Resources[0].ID)
+	}
+	diff, err = s.Diff(WithIdentities(context.Background(), "ci"), "")
+	assert.NoError(t, err)
+	assert.Len(t, diff.Resources, 2)
+	_, err = s.Diff(WithIdentities(context.Background(), "team-a"), "team-b")
+	assert.Error(t, err)
+}
+
+type pendingServer struct {
+	*remote.MockServer
+	pending []v10.PendingRelease
+}
+
+func (s pendingServer) PendingReleases(context.Context) []v10.PendingRelease {
+	return s.pending
+}
+
+func (s pendingServer) ApproveRelease(_ context.Context, id string, _ update.Cause) (job.ID, error) {
+	return job.ID("job-" + id), nil
+}
+
+func TestServer_PendingReleases(t *testing.T) {
+	p, err := loadPolicy(t, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(pendingServer{&remote.MockServer{}, []v10.PendingRelease{
+		{ID: "aaa", Workload: flux.MustParseResourceID("team-a:deployment/app")},
+		{ID: "bbb", Workload: flux.MustParseResourceID("team-b:deployment/app")},
+	}}, p)
+
+	teamA := WithIdentities(context.Background(), "team-a")
+	pending := s.PendingReleases(teamA)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "aaa", pending[0].ID)
+	}
+	assert.Len(t, s.PendingReleases(WithIdentities(context.Background(), "ci")), 2)
+
+	id, err := s.ApproveRelease(teamA, "aaa", update.Cause{})
+	assert.NoError(t, err)
+	assert.Equal(t, job.ID("job-aaa"), id)
+	_, err = s.ApproveRelease(teamA, "bbb", update.Cause{})
+	assert.Error(t, err)
+}
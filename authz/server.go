@@ -0,0 +1,542 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/audit"
+	fluxerr "github.com/weaveworks/flux/errors"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+var _ api.Server = &Server{}
+
+// These are the optional parts of the daemon's API, which the HTTP
+// handlers look for.
+type auditReader interface {
+	AuditRecords(context.Context, audit.Query) []audit.Record
+}
+
+type statusReporter interface {
+	Status(context.Context) v10.Status
+	Ready(context.Context) error
+}
+
+type serviceFilterer interface {
+	ListServicesWithOptions(ctx context.Context, opts v10.ListServicesOptions) ([]v6.ControllerStatus, error)
+}
+
+type graphReader interface {
+	Graph(ctx context.Context, namespace string) (v10.Graph, error)
+}
+
+type diffReader interface {
+	Diff(ctx context.Context, namespace string) (v10.Diff, error)
+}
+
+type pendingReleaser interface {
+	PendingReleases(ctx context.Context) []v10.PendingRelease
+	ApproveRelease(ctx context.Context, id string, cause update.Cause) (job.ID, error)
+}
+
+// Server checks that callers are allowed to do what they ask before
+// passing requests on to the server it wraps, and filters what it
+// gives back to what they are allowed to read. Callers are
+// identified by the identities put in the request context, with
+// WithIdentities; a request without any is refused.
+type Server struct {
+	server api.Server
+	policy *Policy
+}
+
+func NewServer(s api.Server, p *Policy) *Server {
+	return &Server{server: s, policy: p}
+}
+
+func (s *Server) Export(ctx context.Context) ([]byte, error) {
+	if err := s.allowAll(ctx, VerbRead); err != nil {
+		return nil, err
+	}
+	return s.server.Export(ctx)
+}
+
+func (s *Server) ListServices(ctx context.Context, namespace string) ([]v6.ControllerStatus, error) {
+	if namespace != "" {
+		if err := s.allowIn(ctx, VerbRead, []string{namespace}); err != nil {
+			return nil, err
+		}
+	} else if err := s.allowAny(ctx, VerbRead); err != nil {
+		return nil, err
+	}
+	res, err := s.server.ListServices(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []v6.ControllerStatus
+	for _, c := range res {
+		if s.allows(ctx, VerbRead, namespaceOf(c.ID)) {
+			allowed = append(allowed, c)
+		}
+	}
+	return allowed, nil
+}
+
+// ListServicesWithOptions gives, like ListServices, only the
+// workloads in namespaces the caller can read.
+func (s *Server) ListServicesWithOptions(ctx context.Context, opts v10.ListServicesOptions) ([]v6.ControllerStatus, error) {
+	filterer, ok := s.server.(serviceFilterer)
+	if !ok {
+		return nil, errors.New("listing workloads with options is not available from this server")
+	}
+	if opts.Namespace != "" {
+		if err := s.allowIn(ctx, VerbRead, []string{opts.Namespace}); err != nil {
+			return nil, err
+		}
+	} else if err := s.allowAny(ctx, VerbRead); err != nil {
+		return nil, err
+	}
+	res, err := filterer.ListServicesWithOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	allowed := []v6.ControllerStatus{}
+	for _, c := range res {
+		if s.allows(ctx, VerbRead, namespaceOf(c.ID)) {
+			allowed = append(allowed, c)
+		}
+	}
+	return allowed, nil
+}
+
+func (s *Server) ListImages(ctx context.Context, spec update.ResourceSpec) ([]v6.ImageStatus, error) {
+	return s.ListImagesWithOptions(ctx, v10.ListImagesOptions{Spec: spec})
+}
+
+func (s *Server) ListImagesWithOptions(ctx context.Context, opts v10.ListImagesOptions) ([]v6.ImageStatus, error) {
+	if id, err := opts.Spec.AsID(); err == nil {
+		if err := s.allowIn(ctx, VerbRead, []string{namespaceOf(id)}); err != nil {
+			return nil, err
+		}
+	} else if err := s.allowAny(ctx, VerbRead); err != nil {
+		return nil, err
+	}
+	res, err := s.server.ListImagesWithOptions(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []v6.ImageStatus
+	for _, i := range res {
+		if s.allows(ctx, VerbRead, namespaceOf(i.ID)) {
+			allowed = append(allowed, i)
+		}
+	}
+	return allowed, nil
+}
+
+func (s *Server) UpdateManifests(ctx context.Context, spec update.Spec) (job.ID, error) {
+	var err error
+	switch u := spec.Spec.(type) {
+	case update.ReleaseSpec:
+		var ids []flux.ResourceID
+		all := len(u.ServiceSpecs) == 0
+		for _, ss := range u.ServiceSpecs {
+			id, parseErr := ss.AsID()
+			if parseErr != nil { // `<all>`
+				all = true
+				break
+			}
+			ids = append(ids, id)
+		}
+		if all {
+			err = s.allowAll(ctx, VerbRelease)
+		} else {
+			err = s.allowIn(ctx, VerbRelease, namespacesOf(ids))
+		}
+	case update.ContainerSpecs:
+		var ids []flux.ResourceID
+		for id := range u.ContainerSpecs {
+			ids = append(ids, id)
+		}
+		err = s.allowIn(ctx, VerbRelease, namespacesOf(ids))
+	case update.HelmValueUpdates:
+		err = s.allowIn(ctx, VerbRelease, namespacesOf([]flux.ResourceID{u.Release}))
+	case policy.Updates:
+		var ids []flux.ResourceID
+		for id := range u {
+			ids = append(ids, id)
+		}
+		err = s.allowIn(ctx, VerbPolicy, namespacesOf(ids))
+	case update.PolicySelector:
+		if namespaces, ok := selectorNamespaces(u); ok {
+			err = s.allowIn(ctx, VerbPolicy, namespaces)
+		} else {
+			err = s.allowAll(ctx, VerbPolicy)
+		}
+	case update.ManualSync:
+		err = s.allowAny(ctx, VerbSync)
+	default:
+		// Not something fluxctl asks for; only let it through for
+		// those who could do anything with it.
+		if err = s.allowAll(ctx, VerbRelease); err == nil {
+			err = s.allowAll(ctx, VerbPolicy)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.server.UpdateManifests(ctx, spec)
+}
+
+func (s *Server) SyncStatus(ctx context.Context, ref string) ([]string, error) {
+	if err := s.allowAny(ctx, VerbRead); err != nil {
+		return nil, err
+	}
+	return s.server.SyncStatus(ctx, ref)
+}
+
+// JobStatus gives the status of a job only to those who can read in
+// every namespace the job is about: those of the workloads it was
+// asked to change, and those of the workloads in its result.
+func (s *Server) JobStatus(ctx context.Context, id job.ID) (job.Status, error) {
+	if err := s.allowAny(ctx, VerbRead); err != nil {
+		return job.Status{}, err
+	}
+	status, err := s.server.JobStatus(ctx, id)
+	if err != nil {
+		return job.Status{}, err
+	}
+	namespaces, all := jobNamespaces(status.Result)
+	if all {
+		err = s.allowAll(ctx, VerbRead)
+	} else {
+		err = s.allowIn(ctx, VerbRead, namespaces)
+	}
+	if err != nil {
+		return job.Status{}, err
+	}
+	return status, nil
+}
+
+// GitRepoConfig gives the git repo config to anyone who can read;
+// but regenerating the deploy key affects everything, so needs every
+// verb in every namespace.
+func (s *Server) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConfig, error) {
+	if regenerate {
+		for _, verb := range Verbs {
+			if err := s.allowAll(ctx, verb); err != nil {
+				return v6.GitConfig{}, err
+			}
+		}
+	} else if err := s.allowAny(ctx, VerbRead); err != nil {
+		return v6.GitConfig{}, err
+	}
+	return s.server.GitRepoConfig(ctx, regenerate)
+}
+
+// AuditRecords gives the records, from those matching the query,
+// about workloads the caller can read. Records not about particular
+// workloads (e.g., syncs) are given to anyone who can read.
+func (s *Server) AuditRecords(ctx context.Context, q audit.Query) []audit.Record {
+	reader, ok := s.server.(auditReader)
+	if !ok || !s.allowsAny(ctx, VerbRead) {
+		return nil
+	}
+	var allowed []audit.Record
+records:
+	for _, r := range reader.AuditRecords(ctx, q) {
+		for _, id := range r.Workloads {
+			if !s.allows(ctx, VerbRead, namespaceOf(id)) {
+				continue records
+			}
+		}
+		allowed = append(allowed, r)
+	}
+	return allowed
+}
+
+// Status gives the daemon's status to anyone who can read, with only
+// the sync errors for resources they can read.
+func (s *Server) Status(ctx context.Context) v10.Status {
+	reporter, ok := s.server.(statusReporter)
+	if !ok || !s.allowsAny(ctx, VerbRead) {
+		return v10.Status{}
+	}
+	status := reporter.Status(ctx)
+	var errs []v10.ResourceError
+	for _, e := range status.LastSync.Errors {
+		if s.allows(ctx, VerbRead, namespaceOf(e.ID)) {
+			errs = append(errs, e)
+		}
+	}
+	status.LastSync.Errors = errs
+	return status
+}
+
+// Graph gives, like ListServices, only the workloads in namespaces
+// the caller can read; and leaves out antecedents in namespaces they
+// can't.
+func (s *Server) Graph(ctx context.Context, namespace string) (v10.Graph, error) {
+	reader, ok := s.server.(graphReader)
+	if !ok {
+		return v10.Graph{}, errors.New("the graph of workloads is not available from this server")
+	}
+	if namespace != "" {
+		if err := s.allowIn(ctx, VerbRead, []string{namespace}); err != nil {
+			return v10.Graph{}, err
+		}
+	} else if err := s.allowAny(ctx, VerbRead); err != nil {
+		return v10.Graph{}, err
+	}
+	graph, err := reader.Graph(ctx, namespace)
+	if err != nil {
+		return v10.Graph{}, err
+	}
+	allowed := []v10.WorkloadGraph{}
+	for _, w := range graph.Workloads {
+		if !s.allows(ctx, VerbRead, namespaceOf(w.ID)) {
+			continue
+		}
+		// An antecedent can be in another namespace
+		if w.Antecedent != (flux.ResourceID{}) && !s.allows(ctx, VerbRead, namespaceOf(w.Antecedent)) {
+			w.Antecedent, w.AntecedentPath, w.AntecedentLine = flux.ResourceID{}, "", 0
+		}
+		allowed = append(allowed, w)
+	}
+	graph.Workloads = allowed
+	return graph, nil
+}
+
+// Diff gives, like Graph, only the resources in namespaces the caller
+// can read.
+func (s *Server) Diff(ctx context.Context, namespace string) (v10.Diff, error) {
+	reader, ok := s.server.(diffReader)
+	if !ok {
+		return v10.Diff{}, errors.New("diffs are not available from this server")
+	}
+	if namespace != "" {
+		if err := s.allowIn(ctx, VerbRead, []string{namespace}); err != nil {
+			return v10.Diff{}, err
+		}
+	} else if err := s.allowAny(ctx, VerbRead); err != nil {
+		return v10.Diff{}, err
+	}
+	diff, err := reader.Diff(ctx, namespace)
+	if err != nil {
+		return v10.Diff{}, err
+	}
+	allowed := []v10.ResourceDiff{}
+	for _, r := range diff.Resources {
+		if s.allows(ctx, VerbRead, namespaceOf(r.ID)) {
+			allowed = append(allowed, r)
+		}
+	}
+	diff.Resources = allowed
+	return diff, nil
+}
+
+// PendingReleases gives only the releases for workloads in namespaces
+// the caller can read.
+func (s *Server) PendingReleases(ctx context.Context) []v10.PendingRelease {
+	releaser, ok := s.server.(pendingReleaser)
+	if !ok || !s.allowsAny(ctx, VerbRead) {
+		return []v10.PendingRelease{}
+	}
+	allowed := []v10.PendingRelease{}
+	for _, p := range releaser.PendingReleases(ctx) {
+		if s.allows(ctx, VerbRead, namespaceOf(p.Workload)) {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed
+}
+
+// ApproveRelease checks the caller may release to the workload the
+// pending release is for.
+func (s *Server) ApproveRelease(ctx context.Context, id string, cause update.Cause) (job.ID, error) {
+	releaser, ok := s.server.(pendingReleaser)
+	if !ok {
+		return "", errors.New("pending releases are not available from this server")
+	}
+	for _, p := range releaser.PendingReleases(ctx) {
+		if p.ID != id {
+			continue
+		}
+		if err := s.allowIn(ctx, VerbRelease, []string{namespaceOf(p.Workload)}); err != nil {
+			return "", err
+		}
+		return releaser.ApproveRelease(ctx, id, cause)
+	}
+	// Let the server say it's not there
+	if err := s.allowAny(ctx, VerbRelease); err != nil {
+		return "", err
+	}
+	return releaser.ApproveRelease(ctx, id, cause)
+}
+
+func (s *Server) Ready(ctx context.Context) error {
+	if reporter, ok := s.server.(statusReporter); ok {
+		return reporter.Ready(ctx)
+	}
+	return nil
+}
+
+// ---
+
+func (s *Server) allows(ctx context.Context, verb Verb, namespace string) bool {
+	ids, ok := Identities(ctx)
+	return ok && s.policy.Allows(ids, verb, namespace)
+}
+
+func (s *Server) allowsAny(ctx context.Context, verb Verb) bool {
+	ids, ok := Identities(ctx)
+	return ok && s.policy.AllowsAny(ids, verb)
+}
+
+func (s *Server) allowIn(ctx context.Context, verb Verb, namespaces []string) error {
+	for _, ns := range namespaces {
+		if !s.allows(ctx, verb, ns) {
+			return forbidden(ctx, verb, fmt.Sprintf("in namespace %q", ns))
+		}
+	}
+	return nil
+}
+
+func (s *Server) allowAll(ctx context.Context, verb Verb) error {
+	if ids, ok := Identities(ctx); !ok || !s.policy.AllowsAll(ids, verb) {
+		return forbidden(ctx, verb, "in every namespace")
+	}
+	return nil
+}
+
+func (s *Server) allowAny(ctx context.Context, verb Verb) error {
+	if !s.allowsAny(ctx, verb) {
+		return forbidden(ctx, verb, "")
+	}
+	return nil
+}
+
+func forbidden(ctx context.Context, verb Verb, where string) error {
+	who := "an unnamed caller"
+	if ids, _ := Identities(ctx); len(ids) > 0 {
+		who = strings.Join(ids, ", ")
+	}
+	msg := fmt.Sprintf("%s may not %s", who, verb)
+	if where != "" {
+		msg += " " + where
+	}
+	return &fluxerr.Error{
+		Type: fluxerr.Forbidden,
+		Err:  errors.New(msg),
+		Help: `Not allowed
+
+The daemon's authorization policy does not allow this:
+
+    ` + msg + `
+
+The policy is given to fluxd with --api-authorization-file. If you
+think you should be allowed to do this, ask whoever runs Flux to add
+a rule for you.
+`,
+	}
+}
+
+func namespaceOf(id flux.ResourceID) string {
+	ns, _, _ := id.Components()
+	return ns
+}
+
+func namespacesOf(ids []flux.ResourceID) []string {
+	seen := map[string]bool{}
+	var namespaces []string
+	for _, id := range ids {
+		if ns := namespaceOf(id); !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// jobNamespaces gives the namespaces a job is about, from the spec of
+// the update it was asked to make and the workloads in its result; or
+// all, if the update could be to workloads in any namespace.
+func jobNamespaces(result job.Result) (namespaces []string, all bool) {
+	var ids []flux.ResourceID
+	for id := range result.Result {
+		ids = append(ids, id)
+	}
+	if result.Spec != nil {
+		switch u := result.Spec.Spec.(type) {
+		case update.ReleaseSpec:
+			if len(u.ServiceSpecs) == 0 {
+				return nil, true
+			}
+			for _, ss := range u.ServiceSpecs {
+				id, err := ss.AsID()
+				if err != nil { // `<all>`
+					return nil, true
+				}
+				ids = append(ids, id)
+			}
+		case update.ContainerSpecs:
+			for id := range u.ContainerSpecs {
+				ids = append(ids, id)
+			}
+		case update.HelmValueUpdates:
+			ids = append(ids, u.Release)
+		case policy.Updates:
+			for id := range u {
+				ids = append(ids, id)
+			}
+		case update.PolicySelector:
+			selected, ok := selectorNamespaces(u)
+			if !ok {
+				return nil, true
+			}
+			namespaces = append(namespaces, selected...)
+		case update.ManualSync:
+		default:
+			return nil, true
+		}
+	}
+	for _, ns := range namespacesOf(ids) {
+		if !contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, false
+}
+
+// selectorNamespaces gives the namespaces the workloads selected must
+// be in, if they can be known from the patterns given; that is, if
+// each pattern has a namespace without wildcards.
+func selectorNamespaces(s update.PolicySelector) ([]string, bool) {
+	if len(s.Workloads) == 0 {
+		return nil, false
+	}
+	seen := map[string]bool{}
+	var namespaces []string
+	for _, pattern := range s.Workloads {
+		i := strings.Index(pattern, ":")
+		if i < 0 || strings.ContainsAny(pattern[:i], `*?[\`) {
+			return nil, false
+		}
+		if ns := pattern[:i]; !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, true
+}
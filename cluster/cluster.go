@@ -21,10 +21,24 @@ type Cluster interface {
 	PublicSSHKey(regenerate bool) (ssh.PublicKey, error)
 }
 
+// The status summaries given for controllers. Some kinds of
+// controller report other summaries, e.g., how many of their pods
+// have been updated.
+const (
+	StatusUnknown  = "unknown"
+	StatusReady    = "ready"
+	StatusUpdating = "updating"
+	// The rollout of the controller's current definition has failed
+	StatusError = "error"
+)
+
 // Controller describes a cluster resource that declares versioned images.
 type Controller struct {
 	ID     flux.ResourceID
 	Status string // A status summary for display
+	// The progress of rolling out the controller's current
+	// definition, for those kinds of controller that report it
+	Rollout RolloutStatus
 	// Is the controller considered read-only because it's under the
 	// control of the platform. In the case of Kubernetes, we simply
 	// omit these controllers; but this may not always be the case.
@@ -35,10 +49,52 @@ type Controller struct {
 	// in this field.
 	Antecedent flux.ResourceID
 	Labels     map[string]string
+	// The horizontal pod autoscaler which scales this workload, if
+	// there is one; its replicas are then not up to the manifest.
+	Autoscaler *Autoscaler
+	// The pod disruption budgets covering this workload's pods.
+	DisruptionBudgets []DisruptionBudget
 
 	Containers ContainersOrExcuse
 }
 
+// Autoscaler describes a horizontal pod autoscaler targeting a
+// workload.
+type Autoscaler struct {
+	Name            string
+	MinReplicas     int32
+	MaxReplicas     int32
+	CurrentReplicas int32
+}
+
+// DisruptionBudget describes a pod disruption budget; one of
+// MinAvailable and MaxUnavailable is given, as a number or a
+// percentage.
+type DisruptionBudget struct {
+	Name           string
+	MinAvailable   string
+	MaxUnavailable string
+}
+
+// RolloutStatus describes how far a controller has got in replacing
+// its pods with those from its current definition.
+type RolloutStatus struct {
+	// The number of pods wanted
+	Desired int32
+	// The number of pods running the current definition
+	Updated int32
+	// The number of pods that are ready
+	Ready int32
+	// The number of pods that have been ready long enough to be
+	// considered available
+	Available int32
+	// The number of pods still running a previous definition
+	Outdated int32
+	// Explanations of anything going wrong, e.g., a deadline for
+	// making progress having passed
+	Messages []string
+}
+
 // Sometimes we care if we can't find the containers for a service,
 // sometimes we just want the information we can get.
 type ContainersOrExcuse struct {
@@ -0,0 +1,189 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// ConfigFilename is the name of the file that, when present in a
+	// directory given as a manifests path (or any directory above
+	// it, within the repo), declares how to generate manifests
+	// rather than reading them from files.
+	ConfigFilename = ".flux.yaml"
+
+	// generatorTimeout is how long a generator or updater command
+	// is allowed to run.
+	generatorTimeout = time.Minute
+)
+
+// ConfigFile is the parsed content of a `.flux.yaml` file. Exactly
+// one of CommandUpdated and PatchUpdated is expected to be given.
+type ConfigFile struct {
+	Version        int                   `yaml:"version"`
+	CommandUpdated *CommandUpdatedConfig `yaml:"commandUpdated"`
+	PatchUpdated   *PatchUpdatedConfig   `yaml:"patchUpdated"`
+
+	path string // absolute path to the file itself
+}
+
+// CommandUpdatedConfig declares generators to produce manifests, and
+// commands to run to apply updates to the sources from which the
+// manifests are generated.
+type CommandUpdatedConfig struct {
+	Generators []Generator `yaml:"generators"`
+	Updaters   []Updater   `yaml:"updaters"`
+}
+
+// PatchUpdatedConfig declares generators to produce manifests, and a
+// file of patches to apply to the generated manifests. Updates are
+// recorded in the patch file.
+type PatchUpdatedConfig struct {
+	Generators []Generator `yaml:"generators"`
+	PatchFile  string      `yaml:"patchFile"`
+}
+
+// Generator is a command which outputs YAML manifests, e.g.,
+// `kustomize build .`
+type Generator struct {
+	Command string `yaml:"command"`
+}
+
+// Updater gives the commands to run to update images and policies
+// respectively. The workload, container and so on are supplied in
+// environment variables (`FLUX_WORKLOAD`, `FLUX_CONTAINER`, ...).
+type Updater struct {
+	ContainerImage Command `yaml:"containerImage"`
+	Policy         Command `yaml:"policy"`
+}
+
+type Command struct {
+	Command string `yaml:"command"`
+}
+
+// ParseConfigFile reads and validates the config file at the path
+// given.
+func ParseConfigFile(path string) (*ConfigFile, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cf ConfigFile
+	if err := yaml.Unmarshal(bs, &cf); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", path)
+	}
+	if cf.Version != 1 {
+		return nil, fmt.Errorf("%s: unsupported version %d (expected 1)", path, cf.Version)
+	}
+	switch {
+	case cf.CommandUpdated != nil && cf.PatchUpdated != nil:
+		return nil, fmt.Errorf("%s: only one of commandUpdated and patchUpdated may be given", path)
+	case cf.CommandUpdated != nil:
+		if len(cf.CommandUpdated.Generators) == 0 {
+			return nil, fmt.Errorf("%s: no generators given", path)
+		}
+	case cf.PatchUpdated != nil:
+		if len(cf.PatchUpdated.Generators) == 0 {
+			return nil, fmt.Errorf("%s: no generators given", path)
+		}
+		if cf.PatchUpdated.PatchFile == "" {
+			return nil, fmt.Errorf("%s: no patchFile given", path)
+		}
+	default:
+		return nil, fmt.Errorf("%s: one of commandUpdated or patchUpdated must be given", path)
+	}
+	cf.path = path
+	return &cf, nil
+}
+
+// Dir is the directory containing the config file, in which commands
+// are run.
+func (cf *ConfigFile) Dir() string {
+	return filepath.Dir(cf.path)
+}
+
+func (cf *ConfigFile) generators() []Generator {
+	if cf.CommandUpdated != nil {
+		return cf.CommandUpdated.Generators
+	}
+	return cf.PatchUpdated.Generators
+}
+
+func (cf *ConfigFile) patchFilePath() string {
+	return filepath.Join(cf.Dir(), cf.PatchUpdated.PatchFile)
+}
+
+// findConfigFile looks for a config file in the directory given (or
+// the directory containing the file given), then each directory above
+// that up to and including `base`. It returns the path of the config
+// file, or the empty string if there isn't one.
+func findConfigFile(base, path string) (string, error) {
+	base = filepath.Clean(base)
+	dir := filepath.Clean(path)
+	if info, err := os.Stat(dir); err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		candidate := filepath.Join(dir, ConfigFilename)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		if dir == base || !strings.HasPrefix(dir, base) {
+			return "", nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// generate runs all the generators, and returns the concatenation of
+// their output.
+func (cf *ConfigFile) generate() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for _, g := range cf.generators() {
+		out, err := cf.run(g.Command, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "running generator %q", g.Command)
+		}
+		buf.WriteString("\n---\n")
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
+
+// run executes a command in the config file's directory, with the
+// extra environment entries given, and returns its stdout.
+func (cf *ConfigFile) run(command string, env []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), generatorTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Dir = cf.Dir()
+	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME")}, env...)
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = errOut
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errors.Wrap(ctx.Err(), "command timed out")
+		}
+		if msg := strings.TrimSpace(errOut.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
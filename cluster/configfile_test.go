@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "flux-configfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestParseConfigFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	for name, c := range map[string]struct {
+		content string
+		valid   bool
+	}{
+		"commandUpdated": {`version: 1
+commandUpdated:
+  generators:
+  - command: kustomize build .
+  updaters:
+  - containerImage:
+      command: kustomize edit set image $FLUX_IMG:$FLUX_TAG
+`, true},
+		"patchUpdated": {`version: 1
+patchUpdated:
+  generators:
+  - command: kustomize build .
+  patchFile: flux-patch.yaml
+`, true},
+		"no version":      {"commandUpdated:\n  generators:\n  - command: cat x.yaml\n", false},
+		"unknown version": {"version: 2\ncommandUpdated:\n  generators:\n  - command: cat x.yaml\n", false},
+		"neither":         {"version: 1\n", false},
+		"no generators":   {"version: 1\ncommandUpdated:\n  updaters: []\n", false},
+		"no patch file":   {"version: 1\npatchUpdated:\n  generators:\n  - command: cat x.yaml\n", false},
+		"not yaml":        {"version: [1\n", false},
+		"both": {`version: 1
+commandUpdated:
+  generators:
+  - command: cat x.yaml
+patchUpdated:
+  generators:
+  - command: cat x.yaml
+  patchFile: patch.yaml
+`, false},
+	} {
+		path := filepath.Join(dir, name, ConfigFilename)
+		writeFile(t, path, c.content)
+		cf, err := ParseConfigFile(path)
+		if c.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if err == nil && cf.Dir() != filepath.Dir(path) {
+			t.Errorf("%s: expected commands to run in %s, got %s", name, filepath.Dir(path), cf.Dir())
+		}
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	base := filepath.Join(dir, "repo")
+	writeFile(t, filepath.Join(base, "apps", ConfigFilename), "version: 1\n")
+	writeFile(t, filepath.Join(base, "apps", "web", "deploy.yaml"), "")
+	writeFile(t, filepath.Join(base, "plain", "deploy.yaml"), "")
+	// Above the base, so never to be found
+	writeFile(t, filepath.Join(dir, ConfigFilename), "version: 1\n")
+
+	for path, expected := range map[string]string{
+		"apps/web/deploy.yaml": "apps/" + ConfigFilename,
+		"apps/web":             "apps/" + ConfigFilename,
+		"apps":                 "apps/" + ConfigFilename,
+		"plain/deploy.yaml":    "",
+		"plain":                "",
+	} {
+		got, err := findConfigFile(base, filepath.Join(base, path))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if expected != "" {
+			expected = filepath.Join(base, expected)
+		}
+		if got != expected {
+			t.Errorf("%s: expected %q, got %q", path, expected, got)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// Generated is implemented by Manifests which may produce resources
+// by running generators declared in a config file, rather than (only)
+// by reading manifest files. Generated resources cannot be updated
+// by rewriting the file they came from, so must be updated via these
+// methods instead.
+type Generated interface {
+	IsGenerated(resource.Resource) bool
+	UpdateGeneratedImage(root string, res resource.Resource, container string, newImageID image.Ref) error
+	UpdateGeneratedPolicies(root string, res resource.Resource, update policy.Update) (changed bool, err error)
+}
+
+// Rendered is implemented by Manifests which render some resources
+// from files they can't change (e.g., jsonnet), so can't update those
+// resources at all. Releases pass over such resources, rather than
+// failing to write their updates.
+type Rendered interface {
+	IsRendered(resource.Resource) bool
+}
+
+// ConfigAware wraps Manifests so that directories with a config file
+// (see ConfigFilename) have their manifests generated according to
+// the config file, and are updated using the updaters or patch file
+// it declares. Directories without a config file are treated as
+// usual.
+type ConfigAware struct {
+	Manifests
+}
+
+var (
+	_ Manifests = &ConfigAware{}
+	_ Generated = &ConfigAware{}
+	_ Rendered  = &ConfigAware{}
+)
+
+func NewConfigAware(m Manifests) *ConfigAware {
+	return &ConfigAware{m}
+}
+
+// generatedResource and generatedWorkload record that a resource was
+// generated, by giving the config file as its source.
+type generatedResource struct {
+	resource.Resource
+	source string
+}
+
+func (r generatedResource) Source() string {
+	return r.source
+}
+
+type generatedWorkload struct {
+	resource.Workload
+	source string
+}
+
+func (r generatedWorkload) Source() string {
+	return r.source
+}
+
+func (a *ConfigAware) IsGenerated(res resource.Resource) bool {
+	return a.fromConfigFile(res) || a.innerGenerated(res) != nil
+}
+
+// IsRendered reports whether the wrapped Manifests rendered the
+// resource, and can't update it; resources generated according to a
+// config file can always be updated.
+func (a *ConfigAware) IsRendered(res resource.Resource) bool {
+	r, ok := a.Manifests.(Rendered)
+	return ok && !a.fromConfigFile(res) && r.IsRendered(res)
+}
+
+func (a *ConfigAware) fromConfigFile(res resource.Resource) bool {
+	return filepath.Base(res.Source()) == ConfigFilename
+}
+
+// innerGenerated returns the wrapped Manifests if they generated the
+// resource given themselves (e.g., by rendering it from another
+// format), so they can update it; otherwise, nil.
+func (a *ConfigAware) innerGenerated(res resource.Resource) Generated {
+	if gen, ok := a.Manifests.(Generated); ok && !a.fromConfigFile(res) && gen.IsGenerated(res) {
+		return gen
+	}
+	return nil
+}
+
+func (a *ConfigAware) LoadManifests(base string, paths []string) (map[string]resource.Resource, error) {
+	result := map[string]resource.Resource{}
+	add := func(resources map[string]resource.Resource) error {
+		for id, res := range resources {
+			if already, ok := result[id]; ok {
+				return fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, already.Source(), res.Source())
+			}
+			result[id] = res
+		}
+		return nil
+	}
+
+	var plainPaths []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		configPath, err := findConfigFile(base, path)
+		if err != nil {
+			return nil, err
+		}
+		if configPath == "" {
+			plainPaths = append(plainPaths, path)
+			continue
+		}
+		if seen[configPath] {
+			continue
+		}
+		seen[configPath] = true
+		cf, err := ParseConfigFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		generated, err := a.generate(base, cf)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(generated); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(plainPaths) > 0 {
+		loaded, err := a.Manifests.LoadManifests(base, plainPaths)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(loaded); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// generate runs the generators for a config file, applies any
+// patches, and returns the resulting resources.
+func (a *ConfigAware) generate(base string, cf *ConfigFile) (map[string]resource.Resource, error) {
+	source, err := filepath.Rel(base, cf.path)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := a.generateUnpatched(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	if cf.PatchUpdated != nil {
+		patches, err := a.readPatches(cf)
+		if err != nil {
+			return nil, err
+		}
+		for id, patch := range patches {
+			res, ok := resources[id]
+			if !ok {
+				return nil, fmt.Errorf("patch for %s in %s does not match any generated resource", id, cf.PatchUpdated.PatchFile)
+			}
+			patched, err := a.patchResource(res, patch)
+			if err != nil {
+				return nil, err
+			}
+			resources[id] = patched
+		}
+	}
+
+	result := map[string]resource.Resource{}
+	for id, res := range resources {
+		if wl, ok := res.(resource.Workload); ok {
+			result[id] = generatedWorkload{wl, source}
+		} else {
+			result[id] = generatedResource{res, source}
+		}
+	}
+	return result, nil
+}
+
+func (a *ConfigAware) generateUnpatched(cf *ConfigFile) (map[string]resource.Resource, error) {
+	out, err := cf.generate()
+	if err != nil {
+		return nil, err
+	}
+	return a.Manifests.ParseManifests(out)
+}
+
+// readPatches returns the patches in the patch file, as maps, by
+// resource ID. A missing patch file is treated as empty.
+func (a *ConfigAware) readPatches(cf *ConfigFile) (map[string]map[string]interface{}, error) {
+	bs, err := ioutil.ReadFile(cf.patchFilePath())
+	if os.IsNotExist(err) {
+		return map[string]map[string]interface{}{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	docs, err := a.Manifests.ParseManifests(bs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing patch file %s", cf.PatchUpdated.PatchFile)
+	}
+	patches := map[string]map[string]interface{}{}
+	for id, doc := range docs {
+		patch, err := yamlToMap(doc.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		patches[id] = patch
+	}
+	return patches, nil
+}
+
+func (a *ConfigAware) writePatches(cf *ConfigFile, patches map[string]map[string]interface{}) error {
+	var ids []string
+	for id := range patches {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	buf := &bytes.Buffer{}
+	for _, id := range ids {
+		bs, err := mapToYAML(patches[id])
+		if err != nil {
+			return err
+		}
+		buf.WriteString("---\n")
+		buf.Write(bs)
+	}
+	// Keep the mode of an existing patch file; otherwise, make it
+	// readable like any other manifest.
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(cf.patchFilePath()); err == nil {
+		mode = fi.Mode()
+	}
+	return ioutil.WriteFile(cf.patchFilePath(), buf.Bytes(), mode)
+}
+
+func (a *ConfigAware) patchResource(res resource.Resource, patch map[string]interface{}) (resource.Resource, error) {
+	original, err := yamlToMap(res.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	bs, err := mapToYAML(applyPatch(original, patch))
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := a.Manifests.ParseManifests(bs)
+	if err != nil {
+		return nil, err
+	}
+	patched, ok := parsed[res.ResourceID().String()]
+	if !ok {
+		return nil, fmt.Errorf("patch changed the identity of %s", res.ResourceID())
+	}
+	return patched, nil
+}
+
+// updatePatch records the change made by `f` to the resource
+// identified, as a patch in the patch file.
+func (a *ConfigAware) updatePatch(cf *ConfigFile, id flux.ResourceID, f func([]byte) ([]byte, error)) error {
+	resources, err := a.generateUnpatched(cf)
+	if err != nil {
+		return err
+	}
+	res, ok := resources[id.String()]
+	if !ok {
+		return ErrResourceNotFound(id.String())
+	}
+	original, err := yamlToMap(res.Bytes())
+	if err != nil {
+		return err
+	}
+
+	patches, err := a.readPatches(cf)
+	if err != nil {
+		return err
+	}
+	current := original
+	if patch, ok := patches[id.String()]; ok {
+		current = applyPatch(original, patch)
+	}
+	currentBytes, err := mapToYAML(current)
+	if err != nil {
+		return err
+	}
+	newBytes, err := f(currentBytes)
+	if err != nil {
+		return err
+	}
+	modified, err := yamlToMap(newBytes)
+	if err != nil {
+		return err
+	}
+
+	patch := diffPatch(original, modified)
+	if len(patch) == 0 {
+		delete(patches, id.String())
+	} else {
+		// Make sure the patch can be matched up with its resource.
+		for _, k := range []string{"apiVersion", "kind"} {
+			patch[k] = original[k]
+		}
+		metadata, _ := patch["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+		if origMeta, ok := original["metadata"].(map[string]interface{}); ok {
+			for _, k := range []string{"name", "namespace"} {
+				if v, ok := origMeta[k]; ok {
+					metadata[k] = v
+				}
+			}
+		}
+		patch["metadata"] = metadata
+		patches[id.String()] = patch
+	}
+	return a.writePatches(cf, patches)
+}
+
+func (a *ConfigAware) configFor(root string, res resource.Resource) (*ConfigFile, error) {
+	if !a.fromConfigFile(res) {
+		return nil, fmt.Errorf("resource %s was not generated", res.ResourceID())
+	}
+	return ParseConfigFile(filepath.Join(root, res.Source()))
+}
+
+func updaterEnv(id flux.ResourceID) []string {
+	ns, kind, name := id.Components()
+	return []string{
+		"FLUX_WORKLOAD=" + id.String(),
+		"FLUX_WL_NS=" + ns,
+		"FLUX_WL_KIND=" + kind,
+		"FLUX_WL_NAME=" + name,
+	}
+}
+
+func (a *ConfigAware) UpdateGeneratedImage(root string, res resource.Resource, container string, newImageID image.Ref) error {
+	if gen := a.innerGenerated(res); gen != nil {
+		return gen.UpdateGeneratedImage(root, res, container, newImageID)
+	}
+	cf, err := a.configFor(root, res)
+	if err != nil {
+		return err
+	}
+	id := res.ResourceID()
+	if cf.PatchUpdated != nil {
+		return a.updatePatch(cf, id, func(def []byte) ([]byte, error) {
+			return a.Manifests.UpdateImage(def, id, container, newImageID)
+		})
+	}
+
+	env := append(updaterEnv(id),
+		"FLUX_CONTAINER="+container,
+		"FLUX_IMG="+newImageID.Name.String(),
+		"FLUX_TAG="+newImageID.Tag,
+	)
+	for _, u := range cf.CommandUpdated.Updaters {
+		if u.ContainerImage.Command == "" {
+			continue
+		}
+		if _, err := cf.run(u.ContainerImage.Command, env); err != nil {
+			return errors.Wrapf(err, "running image updater %q", u.ContainerImage.Command)
+		}
+	}
+	return nil
+}
+
+func (a *ConfigAware) UpdateGeneratedPolicies(root string, res resource.Resource, update policy.Update) (bool, error) {
+	if gen := a.innerGenerated(res); gen != nil {
+		return gen.UpdateGeneratedPolicies(root, res, update)
+	}
+	cf, err := a.configFor(root, res)
+	if err != nil {
+		return false, err
+	}
+	id := res.ResourceID()
+	if cf.PatchUpdated != nil {
+		var changed bool
+		err := a.updatePatch(cf, id, func(def []byte) ([]byte, error) {
+			newDef, err := a.Manifests.UpdatePolicies(def, id, update)
+			changed = err == nil && string(newDef) != string(def)
+			return newDef, err
+		})
+		return changed, err
+	}
+
+	before := res.Policy()
+	env := updaterEnv(id)
+	run := func(p policy.Policy, value *string) error {
+		policyEnv := append(env, "FLUX_POLICY="+string(p))
+		if value != nil {
+			policyEnv = append(policyEnv, "FLUX_POLICY_VALUE="+*value)
+		}
+		for _, u := range cf.CommandUpdated.Updaters {
+			if u.Policy.Command == "" {
+				continue
+			}
+			if _, err := cf.run(u.Policy.Command, policyEnv); err != nil {
+				return errors.Wrapf(err, "running policy updater %q", u.Policy.Command)
+			}
+		}
+		return nil
+	}
+	for p, v := range update.Add {
+		v := v
+		if err := run(p, &v); err != nil {
+			return false, err
+		}
+	}
+	for p := range update.Remove {
+		if err := run(p, nil); err != nil {
+			return false, err
+		}
+	}
+
+	// See whether that made any difference, by generating the
+	// resource again.
+	after, err := a.generateUnpatched(cf)
+	if err != nil {
+		return false, err
+	}
+	newRes, ok := after[id.String()]
+	if !ok {
+		return false, ErrResourceNotFound(id.String())
+	}
+	return !reflect.DeepEqual(before, newRes.Policy()), nil
+}
@@ -0,0 +1,161 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+const generatedDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000001
+`
+
+var imageLine = regexp.MustCompile(`image: .*`)
+
+// mockManifests parses and loads manifests as the Kubernetes
+// implementation does, and updates images by rewriting the image
+// line.
+func mockManifests() *Mock {
+	return &Mock{
+		LoadManifestsFunc: kresource.Load,
+		ParseManifestsFunc: func(bs []byte) (map[string]resource.Resource, error) {
+			return kresource.ParseMultidoc(bs, "generated")
+		},
+		UpdateImageFunc: func(def []byte, id flux.ResourceID, container string, ref image.Ref) ([]byte, error) {
+			return imageLine.ReplaceAll(def, []byte("image: "+ref.String())), nil
+		},
+	}
+}
+
+func containerImage(t *testing.T, resources map[string]resource.Resource, id string) string {
+	res, ok := resources[id]
+	if !ok {
+		t.Fatalf("expected %s to be loaded", id)
+	}
+	wl, ok := res.(resource.Workload)
+	if !ok || len(wl.Containers()) != 1 {
+		t.Fatalf("expected %s to be a workload with one container", id)
+	}
+	return wl.Containers()[0].Image.String()
+}
+
+func TestConfigAware_CommandUpdated(t *testing.T) {
+	base, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(base, "gen", ConfigFilename), `version: 1
+commandUpdated:
+  generators:
+  - command: cat base.yaml
+  updaters:
+  - containerImage:
+      command: 'sed -i "s|image: .*|image: $FLUX_IMG:$FLUX_TAG|" base.yaml'
+`)
+	writeFile(t, filepath.Join(base, "gen", "base.yaml"), generatedDeployment)
+	writeFile(t, filepath.Join(base, "plain", "svc.yaml"), `apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+  namespace: default
+`)
+
+	a := NewConfigAware(mockManifests())
+	paths := []string{filepath.Join(base, "gen"), filepath.Join(base, "plain")}
+	resources, err := a.LoadManifests(base, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected generated and plain resources, got %v", resources)
+	}
+
+	id := "default:deployment/helloworld"
+	res := resources[id]
+	if !a.IsGenerated(res) || res.Source() != filepath.Join("gen", ConfigFilename) {
+		t.Errorf("expected %s to be generated from the config file, got source %q", id, res.Source())
+	}
+	if svc := resources["default:service/helloworld"]; a.IsGenerated(svc) {
+		t.Errorf("expected service from plain directory not to be generated")
+	}
+
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-a000002")
+	if err := a.UpdateGeneratedImage(base, res, "greeter", ref); err != nil {
+		t.Fatal(err)
+	}
+	resources, err = a.LoadManifests(base, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := containerImage(t, resources, id); got != ref.String() {
+		t.Errorf("expected updater to set image %s, got %s", ref, got)
+	}
+}
+
+func TestConfigAware_PatchUpdated(t *testing.T) {
+	base, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(base, ConfigFilename), `version: 1
+patchUpdated:
+  generators:
+  - command: cat base.yaml
+  patchFile: flux-patch.yaml
+`)
+	writeFile(t, filepath.Join(base, "base.yaml"), generatedDeployment)
+
+	a := NewConfigAware(mockManifests())
+	resources, err := a.LoadManifests(base, []string{base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := "default:deployment/helloworld"
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-a000002")
+	if err := a.UpdateGeneratedImage(base, resources[id], "greeter", ref); err != nil {
+		t.Fatal(err)
+	}
+
+	patchFile := filepath.Join(base, "flux-patch.yaml")
+	fi, err := os.Stat(patchFile)
+	if err != nil {
+		t.Fatalf("expected patch file to be written: %v", err)
+	}
+	if fi.Mode().Perm() != 0644 {
+		t.Errorf("expected patch file to be written with mode 0644, got %v", fi.Mode().Perm())
+	}
+
+	resources, err = a.LoadManifests(base, []string{base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := containerImage(t, resources, id); got != ref.String() {
+		t.Errorf("expected patch to set image %s, got %s", ref, got)
+	}
+
+	// Setting the image back removes the patch
+	orig, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-a000001")
+	if err := a.UpdateGeneratedImage(base, resources[id], "greeter", orig); err != nil {
+		t.Fatal(err)
+	}
+	resources, err = a.LoadManifests(base, []string{base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := containerImage(t, resources, id); got != orig.String() {
+		t.Errorf("expected image %s once the patch is removed, got %s", orig, got)
+	}
+}
@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HelmValue is a value to set in the `values` of a FluxHelmRelease.
+type HelmValue struct {
+	Path  []string `json:"path"` // the keys leading to the value, under `values`
+	Value string   `json:"value"`
+	// AsString says the value is always a string. Otherwise,
+	// `true` and `false` are set as booleans and integers as
+	// numbers, as with `helm --set`.
+	AsString bool `json:"asString,omitempty"`
+}
+
+// ParseHelmValues parses values given as `key=value`, where the key
+// is a dotted path, e.g., `image.tag=1.2.3`. A dot that's part of a
+// key is escaped with a backslash, e.g., `podAnnotations.prometheus\.io/scrape=true`.
+func ParseHelmValues(args []string, asString bool) ([]HelmValue, error) {
+	var values []HelmValue
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("value %q is not of the form key=value", arg)
+		}
+		path, err := parseValuePath(kv[0])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, HelmValue{Path: path, Value: kv[1], AsString: asString})
+	}
+	return values, nil
+}
+
+func parseValuePath(key string) ([]string, error) {
+	var path []string
+	var elem []byte
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case c == '\\' && i+1 < len(key) && key[i+1] == '.':
+			elem = append(elem, '.')
+			i++
+		case c == '.':
+			path = append(path, string(elem))
+			elem = nil
+		default:
+			elem = append(elem, c)
+		}
+	}
+	path = append(path, string(elem))
+	for _, p := range path {
+		if p == "" {
+			return nil, fmt.Errorf("key %q has an empty element", key)
+		}
+	}
+	return path, nil
+}
+
+// Key gives the path of the value as it would be given on the
+// command line.
+func (v HelmValue) Key() string {
+	var elems []string
+	for _, p := range v.Path {
+		elems = append(elems, strings.Replace(p, ".", `\.`, -1))
+	}
+	return strings.Join(elems, ".")
+}
+
+// Typed gives the value as it's to be set: a bool, an int, or a
+// string.
+func (v HelmValue) Typed() interface{} {
+	if v.AsString {
+		return v.Value
+	}
+	switch v.Value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.Atoi(v.Value); err == nil {
+		return i
+	}
+	return v.Value
+}
+
+func (v HelmValue) String() string {
+	return v.Key() + "=" + v.Value
+}
@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHelmValues(t *testing.T) {
+	values, err := ParseHelmValues([]string{
+		"replicas=3",
+		"image.tag=1.2.3",
+		`podAnnotations.prometheus\.io/scrape=true`,
+		"empty=",
+		"url=http://example.com/?a=b",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []HelmValue{
+		{Path: []string{"replicas"}, Value: "3"},
+		{Path: []string{"image", "tag"}, Value: "1.2.3"},
+		{Path: []string{"podAnnotations", "prometheus.io/scrape"}, Value: "true"},
+		{Path: []string{"empty"}, Value: ""},
+		{Path: []string{"url"}, Value: "http://example.com/?a=b"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %#v, got %#v", expected, values)
+	}
+	if key := values[2].Key(); key != `podAnnotations.prometheus\.io/scrape` {
+		t.Errorf("expected key to round-trip, got %q", key)
+	}
+
+	for _, arg := range []string{"noequals", "a..b=1", ".a=1", "=1"} {
+		if _, err := ParseHelmValues([]string{arg}, false); err == nil {
+			t.Errorf("expected error parsing %q", arg)
+		}
+	}
+}
+
+func TestHelmValueTyped(t *testing.T) {
+	for _, c := range []struct {
+		value    HelmValue
+		expected interface{}
+	}{
+		{HelmValue{Value: "true"}, true},
+		{HelmValue{Value: "false"}, false},
+		{HelmValue{Value: "42"}, 42},
+		{HelmValue{Value: "1.2.3"}, "1.2.3"},
+		{HelmValue{Value: "42", AsString: true}, "42"},
+		{HelmValue{Value: "true", AsString: true}, "true"},
+	} {
+		if got := c.value.Typed(); got != c.expected {
+			t.Errorf("%q (AsString: %v): expected %#v, got %#v", c.value.Value, c.value.AsString, c.expected, got)
+		}
+	}
+}
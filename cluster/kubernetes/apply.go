@@ -0,0 +1,356 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/mergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	rest "k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+
+	"github.com/weaveworks/flux/cluster"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+const (
+	// The field manager recorded for server-side applies
+	fieldManager = "flux"
+	// The content type for server-side apply patches; this isn't
+	// defined in the client libraries we use, since it's newer than
+	// them.
+	applyPatchType = types.PatchType("application/apply-patch+yaml")
+)
+
+// ClientApplier applies changesets by talking to the Kubernetes API
+// directly, rather than running kubectl. By default it does what
+// `kubectl apply` does -- a three-way merge of the manifest, the
+// configuration last applied (which it records in the same
+// annotation as kubectl, so the two can be used interchangeably), and
+// the resource as it is in the cluster. With ServerSideApply set, it
+// leaves the merge to the API server instead, which needs Kubernetes
+// 1.14 or later.
+type ClientApplier struct {
+	client dynamic.Interface
+	// Used for requests the dynamic client can't make: server-side
+	// applies, and dry runs
+	rest   rest.Interface
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+
+	// ServerDryRun makes the applier validate changesets with a
+	// server-side dry run, before applying them.
+	ServerDryRun bool
+	// ServerSideApply makes the applier use server-side apply,
+	// rather than calculating patches itself.
+	ServerSideApply bool
+}
+
+func NewClientApplier(disco discovery.DiscoveryInterface, client dynamic.Interface) *ClientApplier {
+	return &ClientApplier{
+		client: client,
+		rest:   disco.RESTClient(),
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(cached.NewMemCacheClient(disco)),
+	}
+}
+
+func (c *ClientApplier) apply(logger log.Logger, cs changeSet) (errs cluster.SyncError) {
+	// The kinds known to the API server may have changed since the
+	// last sync
+	c.mapper.Reset()
+
+	f := func(objs []*apiObject, action string, op func(*apiObject) error) {
+		if len(objs) == 0 {
+			return
+		}
+		logger.Log("action", action, "count", len(objs))
+		for _, obj := range objs {
+			begin := time.Now()
+			err := op(obj)
+			applyDuration.With(
+				fluxmetrics.LabelAction, action,
+				fluxmetrics.LabelKind, obj.Kind,
+				fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+			).Observe(time.Since(begin).Seconds())
+			if err != nil {
+				logger.Log("action", action, "resource", obj.ResourceID(), "err", err)
+				errs = append(errs, cluster.ResourceError{Resource: obj.Resource, Error: err})
+			}
+		}
+	}
+
+	// As with kubectl, delete in the reverse of the order things
+	// would be applied, to avoid deleting things that Kubernetes'
+	// GC will already be deleting.
+	objs := cs.objs["delete"]
+	sort.Sort(sort.Reverse(applyOrder(objs)))
+	f(objs, "delete", c.deleteObject)
+
+	objs = cs.objs["apply"]
+	sort.Sort(applyOrder(objs))
+	f(objs, "apply", func(obj *apiObject) error {
+		return c.applyObject(obj, false)
+	})
+	return errs
+}
+
+// validate does a server-side dry run of applying the resources in
+// the changeset. As with the kubectl applier, resources which can't
+// be checked because they depend on a namespace or custom resource
+// definition in the same changeset aren't counted as failing.
+func (c *ClientApplier) validate(logger log.Logger, cs changeSet) (errs cluster.SyncError) {
+	if !c.ServerDryRun {
+		return nil
+	}
+	objs := cs.objs["apply"]
+	if len(objs) == 0 {
+		return nil
+	}
+	c.mapper.Reset()
+
+	namespaces := map[string]bool{}
+	var definesKinds bool
+	for _, obj := range objs {
+		switch obj.Kind {
+		case "Namespace":
+			namespaces[obj.Metadata.Name] = true
+		case "CustomResourceDefinition":
+			definesKinds = true
+		}
+	}
+
+	logger.Log("action", "apply", "dry-run", true, "count", len(objs))
+	for _, obj := range objs {
+		err := c.applyObject(obj, true)
+		switch {
+		case err == nil:
+		case definesKinds && isUndefinedKind(err):
+		case namespaces[obj.Metadata.Namespace] && k8serrors.IsNotFound(errors.Cause(err)):
+		default:
+			errs = append(errs, cluster.ResourceError{Resource: obj.Resource, Error: err})
+		}
+	}
+	return errs
+}
+
+// target is a resource from a changeset, resolved against the API.
+type target struct {
+	obj       *unstructured.Unstructured
+	mapping   *meta.RESTMapping
+	namespace string
+}
+
+func (c *ClientApplier) resolve(o *apiObject) (target, error) {
+	js, err := k8syaml.YAMLToJSON(o.Bytes())
+	if err != nil {
+		return target{}, errors.Wrap(err, "converting manifest to JSON")
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(js); err != nil {
+		return target{}, errors.Wrap(err, "decoding manifest")
+	}
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return target{}, err
+	}
+	t := target{obj: obj, mapping: mapping}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		t.namespace = obj.GetNamespace()
+		if t.namespace == "" {
+			t.namespace = apiv1.NamespaceDefault
+		}
+	}
+	return t, nil
+}
+
+func (c *ClientApplier) resourceClient(t target) dynamic.ResourceInterface {
+	client := c.client.Resource(t.mapping.Resource)
+	if t.namespace == "" {
+		return client
+	}
+	return client.Namespace(t.namespace)
+}
+
+// applyObject creates or updates the resource given so it matches
+// its manifest. With dryRun set, the server checks the request but
+// doesn't persist the result.
+func (c *ClientApplier) applyObject(o *apiObject, dryRun bool) error {
+	t, err := c.resolve(o)
+	if err != nil {
+		return err
+	}
+	name := t.obj.GetName()
+
+	if c.ServerSideApply {
+		body, err := t.obj.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		req := c.rest.Patch(applyPatchType).
+			AbsPath(resourcePath(t, name)).
+			Param("fieldManager", fieldManager).
+			Param("force", "true").
+			Body(body)
+		if dryRun {
+			req = req.Param("dryRun", "All")
+		}
+		return errors.Wrap(req.Do().Error(), "server-side apply")
+	}
+
+	modified, err := recordLastApplied(t.obj)
+	if err != nil {
+		return err
+	}
+	client := c.resourceClient(t)
+	live, err := client.Get(name, meta_v1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		if dryRun {
+			return errors.Wrap(c.rest.Post().
+				AbsPath(resourcePath(t, "")).
+				SetHeader("Content-Type", runtime.ContentTypeJSON).
+				Param("dryRun", "All").
+				Body(modified).
+				Do().Error(), "creating")
+		}
+		_, err = client.Create(t.obj)
+		return errors.Wrap(err, "creating")
+	}
+	if err != nil {
+		return errors.Wrap(err, "getting current state")
+	}
+
+	current, err := live.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	var original []byte
+	if lastApplied, ok := live.GetAnnotations()[apiv1.LastAppliedConfigAnnotation]; ok {
+		original = []byte(lastApplied)
+		// Fields that are ignored are left as they are, even if
+		// they were applied before; otherwise, they'd be removed
+		// for not being in the manifest.
+		if r, ok := o.Resource.(ignoredFielder); ok {
+			if original, err = withoutFieldsJSON(original, r.IgnoredFields()); err != nil {
+				return errors.Wrap(err, "reading last applied configuration")
+			}
+		}
+	}
+	patch, patchType, err := threeWayPatch(t.mapping.GroupVersionKind, original, modified, current)
+	if err != nil {
+		return errors.Wrap(err, "calculating patch")
+	}
+	if string(patch) == "{}" {
+		return nil
+	}
+	if dryRun {
+		return errors.Wrap(c.rest.Patch(patchType).
+			AbsPath(resourcePath(t, name)).
+			Param("dryRun", "All").
+			Body(patch).
+			Do().Error(), "patching")
+	}
+	_, err = client.Patch(name, patchType, patch)
+	return errors.Wrap(err, "patching")
+}
+
+// deleteObject deletes the resource given, if it's still there.
+func (c *ClientApplier) deleteObject(o *apiObject) error {
+	t, err := c.resolve(o)
+	if err != nil {
+		return err
+	}
+	propagation := meta_v1.DeletePropagationBackground
+	err = c.resourceClient(t).Delete(t.obj.GetName(), &meta_v1.DeleteOptions{PropagationPolicy: &propagation})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	return errors.Wrap(err, "deleting")
+}
+
+// recordLastApplied sets the annotation kubectl uses to record the
+// configuration last applied, and returns the object so annotated,
+// as JSON.
+func recordLastApplied(obj *unstructured.Unstructured) ([]byte, error) {
+	annotations := obj.GetAnnotations()
+	delete(annotations, apiv1.LastAppliedConfigAnnotation)
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+	} else {
+		obj.SetAnnotations(annotations)
+	}
+	config, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[apiv1.LastAppliedConfigAnnotation] = string(config)
+	obj.SetAnnotations(annotations)
+	return obj.MarshalJSON()
+}
+
+// threeWayPatch calculates the patch that will take the current state
+// of a resource to the modified state, also removing anything that
+// was in the original (i.e., last applied) configuration but isn't in
+// the modified configuration. Kinds built into Kubernetes get a
+// strategic merge patch; others, e.g., custom resources, get a JSON
+// merge patch, since there's no schema to say how to merge lists.
+func threeWayPatch(gvk schema.GroupVersionKind, original, modified, current []byte) ([]byte, types.PatchType, error) {
+	preconditions := []mergepatch.PreconditionFunc{
+		mergepatch.RequireKeyUnchanged("apiVersion"),
+		mergepatch.RequireKeyUnchanged("kind"),
+		mergepatch.RequireMetadataKeyUnchanged("name"),
+	}
+	versioned, err := scheme.Scheme.New(gvk)
+	switch {
+	case runtime.IsNotRegisteredError(err):
+		patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current, preconditions...)
+		return patch, types.MergePatchType, err
+	case err != nil:
+		return nil, "", err
+	}
+	patchMeta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+	if err != nil {
+		return nil, "", err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, patchMeta, true, preconditions...)
+	return patch, types.StrategicMergePatchType, err
+}
+
+// resourcePath gives the API path for the resource, or if name is
+// empty, the collection of resources.
+func resourcePath(t target, name string) string {
+	gvr := t.mapping.Resource
+	elems := []string{"/api"}
+	if gvr.Group != "" {
+		elems = []string{"/apis", gvr.Group}
+	}
+	elems = append(elems, gvr.Version)
+	if t.namespace != "" {
+		elems = append(elems, "namespaces", t.namespace)
+	}
+	elems = append(elems, gvr.Resource)
+	if name != "" {
+		elems = append(elems, name)
+	}
+	return path.Join(elems...)
+}
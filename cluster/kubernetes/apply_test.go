@@ -0,0 +1,140 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	apiv1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func setupClientApplier(t *testing.T, objs ...runtime.Object) (*ClientApplier, *fakedynamic.FakeDynamicClient) {
+	disco := &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}}
+	disco.Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+				{Name: "namespaces", Kind: "Namespace"},
+			},
+		},
+	}
+	client := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), objs...)
+	// The fake client can only apply strategic merge patches to
+	// typed objects; just record them instead.
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &unstructured.Unstructured{}, nil
+	})
+	return NewClientApplier(disco, client), client
+}
+
+func makeApplyObj(t *testing.T, id, def string) *apiObject {
+	obj, err := parseObj([]byte(def))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Resource = rsc{id: id, bytes: []byte(def)}
+	return obj
+}
+
+const configMapDef = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: test
+data:
+  kept: value
+`
+
+func TestClientApplierCreates(t *testing.T) {
+	applier, client := setupClientApplier(t)
+	cs := makeChangeSet()
+	cs.stage("apply", makeApplyObj(t, "test:configmap/config", configMapDef))
+	if errs := applier.apply(log.NewNopLogger(), cs); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	live, err := client.Resource(apiv1.SchemeGroupVersion.WithResource("configmaps")).Namespace("test").Get("config", meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastApplied := live.GetAnnotations()[apiv1.LastAppliedConfigAnnotation]
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(lastApplied), &config); err != nil {
+		t.Fatalf("expected last-applied annotation to be JSON, got %q: %s", lastApplied, err)
+	}
+	if config["data"].(map[string]interface{})["kept"] != "value" {
+		t.Errorf("expected last-applied annotation to record the manifest, got %q", lastApplied)
+	}
+}
+
+func TestClientApplierPatches(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("v1")
+	existing.SetKind("ConfigMap")
+	existing.SetNamespace("test")
+	existing.SetName("config")
+	existing.SetAnnotations(map[string]string{
+		apiv1.LastAppliedConfigAnnotation: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config","namespace":"test"},"data":{"kept":"value","removed":"value"}}`,
+	})
+	unstructured.SetNestedStringMap(existing.Object, map[string]string{
+		"kept":    "value",
+		"removed": "value",
+		"added":   "elsewhere",
+	}, "data")
+
+	applier, client := setupClientApplier(t, existing)
+	cs := makeChangeSet()
+	cs.stage("apply", makeApplyObj(t, "test:configmap/config", configMapDef))
+	if errs := applier.apply(log.NewNopLogger(), cs); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	var patch []byte
+	for _, action := range client.Actions() {
+		if p, ok := action.(k8stesting.PatchAction); ok {
+			patch = p.GetPatch()
+		}
+	}
+	var patchMap map[string]interface{}
+	if err := json.Unmarshal(patch, &patchMap); err != nil {
+		t.Fatalf("expected a JSON patch, got %q", string(patch))
+	}
+	data := patchMap["data"].(map[string]interface{})
+	if v, ok := data["removed"]; !ok || v != nil {
+		t.Errorf("expected patch to remove the entry no longer in the manifest, got %s", string(patch))
+	}
+	if _, ok := data["added"]; ok {
+		t.Errorf("expected patch to leave alone the entry not applied by flux, got %s", string(patch))
+	}
+}
+
+func TestClientApplierErrors(t *testing.T) {
+	applier, _ := setupClientApplier(t)
+	cs := makeChangeSet()
+	// Deleting something already gone is not a problem
+	cs.stage("delete", makeApplyObj(t, "test:configmap/config", configMapDef))
+	cs.stage("apply", makeApplyObj(t, "test:widget/widget", `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+  namespace: test
+`))
+	errs := applier.apply(log.NewNopLogger(), cs)
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+	if !isUndefinedKind(errs[0].Error) {
+		t.Errorf("expected an undefined kind error, got %s", errs[0].Error)
+	}
+	if !strings.Contains(errs[0].Error.Error(), "Widget") {
+		t.Errorf("expected error to mention the kind, got %s", errs[0].Error)
+	}
+}
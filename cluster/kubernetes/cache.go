@@ -0,0 +1,115 @@
+package kubernetes
+
+import (
+	"sort"
+
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// workloadInformer keeps the workloads of one kind, in one namespace
+// or in all of them, in memory.
+type workloadInformer struct {
+	indexer cache.Indexer
+	synced  cache.InformerSynced
+}
+
+// StartWorkloadCache starts keeping the workloads in the namespaces
+// fluxd looks at in memory, up to date by watching the API server,
+// until stop is closed. Once the workloads of a kind have been
+// listed, listing them, exporting them, and looking them up reads
+// from memory, rather than asking the API server every time. Kinds
+// the API server doesn't have -- e.g., FluxHelmRelease, if its
+// custom resource definition isn't installed -- are not cached.
+func (c *Cluster) StartWorkloadCache(stop <-chan struct{}) {
+	informers := map[string]map[string]workloadInformer{}
+	for kind, resourceKind := range resourceKinds {
+		for _, ns := range c.watchedNamespaces() {
+			lw, obj := resourceKind.listWatch(c, ns)
+			if lw == nil {
+				continue
+			}
+			// Check the kind can be listed, so there's not an
+			// informer failing to list it forever
+			if _, err := lw.List(meta_v1.ListOptions{Limit: 1}); err != nil {
+				c.logger.Log("info", "not caching workloads", "kind", kind, "namespace", ns, "err", err)
+				continue
+			}
+			indexer, controller := cache.NewIndexerInformer(lw, obj, 0, cache.ResourceEventHandlerFuncs{}, cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			})
+			go controller.Run(stop)
+			if informers[kind] == nil {
+				informers[kind] = map[string]workloadInformer{}
+			}
+			informers[kind][ns] = workloadInformer{indexer: indexer, synced: controller.HasSynced}
+		}
+	}
+	c.workloadsMu.Lock()
+	c.workloads = informers
+	c.workloadsMu.Unlock()
+}
+
+// watchedNamespaces gives the namespaces to watch for changes: all of
+// them (as meta_v1.NamespaceAll), or the allowed namespaces, if
+// there's a whitelist.
+func (c *Cluster) watchedNamespaces() []string {
+	if len(c.nsWhitelist) == 0 {
+		return []string{meta_v1.NamespaceAll}
+	}
+	var namespaces []string
+	for _, ns := range c.nsWhitelist {
+		if c.namespaceAllowed(ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// cachedWorkloads gives the informer caching workloads of the kind
+// in the namespace, if there is one and it has listed them.
+func (c *Cluster) cachedWorkloads(kind, namespace string) (workloadInformer, bool) {
+	c.workloadsMu.RLock()
+	defer c.workloadsMu.RUnlock()
+	informer, ok := c.workloads[kind][meta_v1.NamespaceAll]
+	if !ok {
+		informer, ok = c.workloads[kind][namespace]
+	}
+	return informer, ok && informer.synced()
+}
+
+// podController gets the workload of the kind given, from the cache
+// if it's there, otherwise from the API server; it may be new enough
+// that it's not been seen yet.
+func (c *Cluster) podController(kind string, resourceKind resourceKind, namespace, name string) (podController, error) {
+	if informer, ok := c.cachedWorkloads(kind, namespace); ok {
+		obj, exists, err := informer.indexer.GetByKey(namespace + "/" + name)
+		if err == nil && exists {
+			return resourceKind.toPodController(obj), nil
+		}
+	}
+	return resourceKind.getPodController(c, namespace, name)
+}
+
+// podControllers lists the workloads of the kind given in a
+// namespace, from the cache if it's being kept, otherwise from the
+// API server.
+func (c *Cluster) podControllers(kind string, resourceKind resourceKind, namespace string) ([]podController, error) {
+	informer, ok := c.cachedWorkloads(kind, namespace)
+	if !ok {
+		return resourceKind.getPodControllers(c, namespace)
+	}
+	objs, err := informer.indexer.ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var podControllers []podController
+	for _, obj := range objs {
+		podControllers = append(podControllers, resourceKind.toPodController(obj))
+	}
+	// The API server lists them by name
+	sort.Slice(podControllers, func(i, j int) bool {
+		return podControllers[i].name < podControllers[j].name
+	})
+	return podControllers, nil
+}
@@ -0,0 +1,67 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/weaveworks/flux"
+	fhrfake "github.com/weaveworks/flux/integrations/client/clientset/versioned/fake"
+)
+
+func TestWorkloadCache(t *testing.T) {
+	ns := "foo-ns"
+	clientset := fake.NewSimpleClientset(
+		&apiv1.Namespace{ObjectMeta: meta_v1.ObjectMeta{Name: ns}},
+		makeDeployment(ns, "b", nil, "foo/bar:tag"),
+		makeDeployment(ns, "a", nil, "foo/baz:tag"),
+	)
+	// The fake clientset only sends events to watches on the
+	// namespace of the object, so restrict the namespaces watched
+	c := NewCluster(clientset, fhrfake.NewSimpleClientset(), nil, nil, nil, log.NewNopLogger(), ClusterOptions{AllowedNamespaces: []string{ns}})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	c.StartWorkloadCache(stop)
+	informer, ok := c.workloads["deployment"][ns]
+	if !ok {
+		t.Fatal("expected deployments to be cached")
+	}
+	if !cache.WaitForCacheSync(stop, informer.synced) {
+		t.Fatal("cache did not sync")
+	}
+
+	// Once synced, workloads are read from the cache ..
+	clientset.ClearActions()
+	controllers, err := c.AllControllers(ns)
+	assert.NoError(t, err)
+	var ids []string
+	for _, controller := range controllers {
+		ids = append(ids, controller.ID.String())
+	}
+	assert.Equal(t, []string{"foo-ns:deployment/a", "foo-ns:deployment/b"}, ids)
+	controllers, err = c.SomeControllers([]flux.ResourceID{flux.MustParseResourceID("foo-ns:deployment/a")})
+	assert.NoError(t, err)
+	assert.Len(t, controllers, 1)
+	for _, action := range clientset.Actions() {
+		if action.GetResource().Resource == "deployments" {
+			t.Errorf("expected deployments to be read from the cache, got %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+
+	// .. which follows changes in the cluster
+	clientset.AppsV1().Deployments(ns).Create(makeDeployment(ns, "c", nil, "foo/bar:tag"))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(controllers) != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		controllers, err = c.AllControllers(ns)
+		assert.NoError(t, err)
+	}
+	assert.Len(t, controllers, 3)
+}
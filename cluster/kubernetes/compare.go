@@ -0,0 +1,278 @@
+package kubernetes
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
+)
+
+var _ cluster.Comparer = &Cluster{}
+
+// Compare gives each resource as it would be applied -- that is,
+// with variables substituted and without any fields that are ignored
+// -- and as it is in the cluster, as far as the resource's manifest
+// goes. Resources that wouldn't be synced, because of the namespaces
+// or the sync selector, are marked as skipped.
+//
+// Since what's compared is shown to people who may not be able to
+// read secrets: the data of Secrets is given as a keyed hash of each
+// value, which tells whether it differs but not what it is; and the
+// values of variables taken from Secrets are redacted wherever
+// they're substituted.
+func (c *Cluster) Compare(resources map[string]resource.Resource) map[string]cluster.Comparison {
+	logger := log.With(c.logger, "method", "Compare")
+	var mapper meta.RESTMapper
+	if c.client.dynamicClient != nil {
+		deferred := restmapper.NewDeferredDiscoveryRESTMapper(cached.NewMemCacheClient(c.client.coreClient.Discovery()))
+		deferred.Reset() // to fill the cache
+		mapper = deferred
+	}
+	scalings := map[string]scaling{}
+	subst := &substitution{cluster: c}
+	comparisons := map[string]cluster.Comparison{}
+	for id, res := range resources {
+		comparisons[id] = c.compare(logger, mapper, res, scalings, subst)
+	}
+	return comparisons
+}
+
+func (c *Cluster) compare(logger log.Logger, mapper meta.RESTMapper, res resource.Resource, scalings map[string]scaling, subst *substitution) (cmp cluster.Comparison) {
+	if !c.actionAllowed(cluster.SyncAction{Apply: res}) {
+		cmp.Skipped = true
+		return cmp
+	}
+	res, err := subst.apply(res)
+	if err != nil {
+		cmp.Error = err
+		return cmp
+	}
+	obj, err := parseObj(res.Bytes())
+	if err != nil {
+		cmp.Error = err
+		return cmp
+	}
+	if c.syncSelector != nil && !c.syncSelector.Matches(labels.Set(obj.Metadata.Labels)) {
+		cmp.Skipped = true
+		return cmp
+	}
+	obj.Resource = res
+	applied := c.withoutIgnoredFields(logger, obj, scalings)
+
+	js, err := k8syaml.YAMLToJSON(applied.Bytes())
+	if err != nil {
+		cmp.Error = err
+		return cmp
+	}
+	desired := &unstructured.Unstructured{}
+	if err := desired.UnmarshalJSON(js); err != nil {
+		cmp.Error = err
+		return cmp
+	}
+	gvk := desired.GroupVersionKind()
+	isSecret := gvk.Group == "" && gvk.Kind == "Secret"
+	if isSecret {
+		if err := foldStringData(desired.Object); err != nil {
+			cmp.Error = err
+			return cmp
+		}
+	}
+	redact := func(obj interface{}) ([]byte, error) {
+		if isSecret {
+			hashSecretData(obj)
+		}
+		return k8syaml.Marshal(redactValues(obj, subst.secretValues))
+	}
+	if cmp.Applied, err = redact(copyValue(desired.Object)); err != nil {
+		cmp.Error = err
+		return cmp
+	}
+
+	if mapper == nil {
+		cmp.Error = errors.New("resources can't be looked up in this cluster")
+		return cmp
+	}
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		cmp.Error = err
+		return cmp
+	}
+	resources := c.client.dynamicClient.Resource(mapping.Resource)
+	var client dynamic.ResourceInterface = resources
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := desired.GetNamespace()
+		if namespace == "" {
+			namespace = apiv1.NamespaceDefault
+		}
+		client = resources.Namespace(namespace)
+	}
+	live, err := client.Get(desired.GetName(), meta_v1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return cmp
+	case err != nil:
+		cmp.Error = err
+		return cmp
+	}
+	cmp.Live, cmp.Error = redact(project(live.Object, desired.Object))
+	return cmp
+}
+
+// secretHashKey is the key with which the values in Secrets are
+// hashed for comparison. It's made afresh each time fluxd starts, so
+// the hashes can't be used to guess the values elsewhere.
+var secretHashKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// foldStringData moves the entries in the `stringData` of a Secret
+// into its `data`, encoded, as the API server does; so that they can
+// be compared with what's in the cluster.
+func foldStringData(secret map[string]interface{}) error {
+	stringData, ok := secret["stringData"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	data, ok := secret["data"].(map[string]interface{})
+	if !ok {
+		data = map[string]interface{}{}
+		secret["data"] = data
+	}
+	for k, v := range stringData {
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("value of stringData.%s in Secret is not a string", k)
+		}
+		data[k] = base64.StdEncoding.EncodeToString([]byte(str))
+	}
+	delete(secret, "stringData")
+	return nil
+}
+
+// hashSecretData replaces each value in the `data` of a Secret with a
+// keyed hash of it.
+func hashSecretData(secret interface{}) {
+	obj, ok := secret.(map[string]interface{})
+	if !ok {
+		return
+	}
+	data, ok := obj["data"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for k, v := range data {
+		str, _ := v.(string)
+		decoded, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			decoded = []byte(str)
+		}
+		mac := hmac.New(sha256.New, secretHashKey)
+		mac.Write(decoded)
+		data[k] = "<redacted hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))[:16] + ">"
+	}
+}
+
+// redactValues replaces, in each string in the value, each of the
+// secret values given.
+func redactValues(value interface{}, secrets []string) interface{} {
+	if len(secrets) == 0 {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = redactValues(item, secrets)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValues(item, secrets)
+		}
+	case string:
+		for _, secret := range secrets {
+			v = strings.Replace(v, secret, "<redacted>", -1)
+		}
+		return v
+	}
+	return value
+}
+
+// copyValue makes a deep copy of a value decoded from JSON, so it
+// can be changed without changing the original.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			c[k] = copyValue(item)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = copyValue(item)
+		}
+		return c
+	}
+	return value
+}
+
+// project gives the parts of a value from the cluster that are also
+// in the corresponding value from a manifest, so that what the API
+// server fills in (defaults, the status, annotations recording the
+// last configuration applied) is left out. Items in lists are matched
+// by position; items the cluster has beyond those in the manifest are
+// kept whole, since they'd be removed by a sync.
+func project(live, desired interface{}) interface{} {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		projected := map[string]interface{}{}
+		for k, v := range d {
+			if lv, ok := l[k]; ok {
+				projected[k] = project(lv, v)
+			}
+		}
+		return projected
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return live
+		}
+		projected := make([]interface{}, len(l))
+		for i, lv := range l {
+			if i < len(d) {
+				projected[i] = project(lv, d[i])
+			} else {
+				projected[i] = lv
+			}
+		}
+		return projected
+	}
+	return live
+}
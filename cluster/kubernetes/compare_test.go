@@ -0,0 +1,210 @@
+package kubernetes
+
+import (
+	"encoding/base64"
+	"testing"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+func TestCompare(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("v1")
+	existing.SetKind("ConfigMap")
+	existing.SetNamespace("test")
+	existing.SetName("config")
+	existing.SetUID("0123-4567")
+	existing.SetAnnotations(map[string]string{
+		apiv1.LastAppliedConfigAnnotation: `{"data":{"kept":"value"}}`,
+	})
+	unstructured.SetNestedStringMap(existing.Object, map[string]string{
+		"kept":  "changed",
+		"extra": "value",
+	}, "data")
+
+	clientset := scaledClientset()
+	clientset.Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+			},
+		},
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), existing)
+	c := NewCluster(clientset, nil, dynamicClient, &bytesApplier{}, nil, log.NewNopLogger(), ClusterOptions{ExcludedNamespaces: []string{"excluded"}})
+
+	const newConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: new
+  namespace: test
+`
+	const excludedConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: excluded
+`
+	comparisons := c.Compare(map[string]resource.Resource{
+		"test:configmap/config":     rsc{"test:configmap/config", []byte(configMapDef)},
+		"test:configmap/new":        rsc{"test:configmap/new", []byte(newConfigMap)},
+		"excluded:configmap/config": rsc{"excluded:configmap/config", []byte(excludedConfigMap)},
+	})
+
+	config := comparisons["test:configmap/config"]
+	if assert.NoError(t, config.Error) {
+		// Only what's in the manifest is compared
+		assert.Equal(t, `apiVersion: v1
+data:
+  kept: value
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: test
+`, string(config.Applied))
+		assert.Equal(t, `apiVersion: v1
+data:
+  kept: changed
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: test
+`, string(config.Live))
+	}
+
+	created := comparisons["test:configmap/new"]
+	assert.NoError(t, created.Error)
+	assert.NotEmpty(t, created.Applied)
+	assert.Nil(t, created.Live)
+
+	assert.True(t, comparisons["excluded:configmap/config"].Skipped)
+}
+
+func TestProject(t *testing.T) {
+	live := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"strategy": "RollingUpdate",
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80), "protocol": "TCP"},
+				map[string]interface{}{"port": int64(443), "protocol": "TCP"},
+			},
+		},
+		"status": map[string]interface{}{"ready": true},
+	}
+	desired := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80)},
+			},
+		},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80)},
+				map[string]interface{}{"port": int64(443), "protocol": "TCP"},
+			},
+		},
+	}, project(live, desired))
+}
+
+func TestCompareRedactsSecrets(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("v1")
+	existing.SetKind("Secret")
+	existing.SetNamespace("test")
+	existing.SetName("creds")
+	unstructured.SetNestedStringMap(existing.Object, map[string]string{
+		"same":    base64.StdEncoding.EncodeToString([]byte("unchanged-value")),
+		"changed": base64.StdEncoding.EncodeToString([]byte("old-value")),
+	}, "data")
+
+	clientset := scaledClientset()
+	clientset.Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+				{Name: "secrets", Kind: "Secret", Namespaced: true},
+			},
+		},
+	}
+	if _, err := clientset.CoreV1().Secrets("flux").Create(&apiv1.Secret{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "vars", Namespace: "flux"},
+		Data:       map[string][]byte{"PASSWORD": []byte("hunter2")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), existing)
+	c := NewCluster(clientset, nil, dynamicClient, &bytesApplier{}, nil, log.NewNopLogger(), ClusterOptions{})
+	c.SubstituteFrom = []VarSource{{Kind: VarSourceSecret, Namespace: "flux", Name: "vars"}}
+
+	const secret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+  namespace: test
+data:
+  same: dW5jaGFuZ2VkLXZhbHVl
+stringData:
+  changed: new-value
+`
+	const substituted = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  namespace: test
+data:
+  url: postgres://app:${PASSWORD}@db
+`
+	comparisons := c.Compare(map[string]resource.Resource{
+		"test:secret/creds": rsc{"test:secret/creds", []byte(secret)},
+		"test:configmap/app": policyRsc{
+			rsc:      rsc{"test:configmap/app", []byte(substituted)},
+			policies: policy.Set{policy.Substitute: "true"},
+		},
+	})
+
+	creds := comparisons["test:secret/creds"]
+	if assert.NoError(t, creds.Error) {
+		applied, live := string(creds.Applied), string(creds.Live)
+		for _, value := range []string{"unchanged-value", "old-value", "new-value"} {
+			for _, s := range []string{applied, live} {
+				assert.NotContains(t, s, value)
+				assert.NotContains(t, s, base64.StdEncoding.EncodeToString([]byte(value)))
+			}
+		}
+		assert.NotContains(t, applied, "stringData")
+		// The same value hashes the same, so only the changed value
+		// shows up as a difference
+		var appliedSecret, liveSecret struct {
+			Data map[string]string
+		}
+		assert.NoError(t, k8syaml.Unmarshal(creds.Applied, &appliedSecret))
+		assert.NoError(t, k8syaml.Unmarshal(creds.Live, &liveSecret))
+		assert.Contains(t, appliedSecret.Data["same"], "<redacted hmac-sha256:")
+		assert.Equal(t, appliedSecret.Data["same"], liveSecret.Data["same"])
+		assert.NotEqual(t, appliedSecret.Data["changed"], liveSecret.Data["changed"])
+	}
+
+	app := comparisons["test:configmap/app"]
+	if assert.NoError(t, app.Error) {
+		assert.Contains(t, string(app.Applied), "url: postgres://app:<redacted>@db")
+		assert.NotContains(t, string(app.Applied), "hunter2")
+		assert.Nil(t, app.Live)
+	}
+}
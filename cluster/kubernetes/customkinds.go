@@ -0,0 +1,203 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+)
+
+// RegisterCustomImage makes custom resources of the kind given
+// workloads, with the image for a container at the path given, both
+// in manifests and in the cluster. It's expected to be called before
+// the cluster is used, and can't be used for the kinds already
+// treated as workloads.
+func RegisterCustomImage(ci kresource.CustomImage) error {
+	kind := strings.ToLower(ci.Kind)
+	existing, ok := resourceKinds[kind]
+	if !ok {
+		resourceKinds[kind] = &customKind{group: ci.Group, kind: ci.Kind}
+	} else if ck, isCustom := existing.(*customKind); !isCustom || ck.group != ci.Group {
+		return fmt.Errorf("images can't be registered for %s, since %s is already a kind of workload", ci.Kind, kind)
+	}
+	kresource.RegisterCustomImage(ci)
+	return nil
+}
+
+// How often, at most, to discover the kinds the API server has again,
+// when looking for a custom kind it didn't have.
+const mapperRefreshInterval = time.Minute
+
+// customKind is a kind of custom resource with images registered for
+// it. Its resources are got with the dynamic client, and aren't
+// cached.
+type customKind struct {
+	group string
+	kind  string
+}
+
+// resources gives the client for the kind's resources in the
+// namespace given. If the API server doesn't have the kind, e.g.,
+// because its custom resource definition isn't installed, it returns
+// a NotFound error, as the typed clients do.
+func (ck *customKind) resources(c *Cluster, namespace string) (dynamic.ResourceInterface, error) {
+	return c.dynamicResources(schema.GroupKind{Group: ck.group, Kind: ck.kind}, namespace)
+}
+
+// image gives the image registered for the container named.
+func (ck *customKind) image(container string) (kresource.CustomImage, bool) {
+	for _, ci := range kresource.CustomImages(ck.group, ck.kind) {
+		if ci.Container == container {
+			return ci, true
+		}
+	}
+	return kresource.CustomImage{}, false
+}
+
+func (ck *customKind) getPodController(c *Cluster, namespace, name string) (podController, error) {
+	resources, err := ck.resources(c, namespace)
+	if err != nil {
+		return podController{}, err
+	}
+	obj, err := resources.Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		return podController{}, err
+	}
+	return ck.makePodController(obj), nil
+}
+
+func (ck *customKind) getPodControllers(c *Cluster, namespace string) ([]podController, error) {
+	resources, err := ck.resources(c, namespace)
+	if err != nil {
+		return nil, err
+	}
+	list, err := resources.List(meta_v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var podControllers []podController
+	for i := range list.Items {
+		podControllers = append(podControllers, ck.makePodController(&list.Items[i]))
+	}
+	return podControllers, nil
+}
+
+func (ck *customKind) listWatch(c *Cluster, namespace string) (*cache.ListWatch, runtime.Object) {
+	return nil, nil
+}
+
+func (ck *customKind) toPodController(obj interface{}) podController {
+	return ck.makePodController(obj.(*unstructured.Unstructured))
+}
+
+// makePodController interprets a custom resource as having a
+// container for each of the images registered for its kind, as
+// resources of the kind are in manifests.
+func (ck *customKind) makePodController(obj *unstructured.Unstructured) podController {
+	var containers []apiv1.Container
+	for _, ci := range kresource.CustomImages(ck.group, ck.kind) {
+		if image, ok := ci.Find(obj.Object); ok {
+			containers = append(containers, apiv1.Container{Name: ci.Container, Image: image})
+		}
+	}
+	return podController{
+		apiVersion: obj.GetAPIVersion(),
+		kind:       obj.GetKind(),
+		name:       obj.GetName(),
+		podTemplate: apiv1.PodTemplateSpec{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Namespace:   obj.GetNamespace(),
+				Labels:      obj.GetLabels(),
+				Annotations: obj.GetAnnotations(),
+			},
+			Spec: apiv1.PodSpec{Containers: containers},
+		},
+		k8sObject: customObject{obj},
+	}
+}
+
+// customObject is a custom resource as it's exported: without its
+// apiVersion and kind, which are written separately.
+type customObject struct {
+	*unstructured.Unstructured
+}
+
+func (o customObject) MarshalJSON() ([]byte, error) {
+	fields := map[string]interface{}{}
+	for k, v := range o.Object {
+		if k != "apiVersion" && k != "kind" {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// dynamicResources gives the dynamic client for the resources of the
+// kind given, in the namespace given if the kind is namespaced. The
+// kinds the API server has are discovered when first needed, and
+// again at most once every mapperRefreshInterval, so looking up a
+// kind it doesn't have returns a NotFound error without a request
+// being made every time.
+func (c *Cluster) dynamicResources(gk schema.GroupKind, namespace string) (dynamic.ResourceInterface, error) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: gk.Group, Resource: gk.Kind}, "")
+	if c.client.dynamicClient == nil {
+		return nil, notFound
+	}
+	mapper := c.restMapper()
+	mapping, err := mapper.RESTMapping(gk)
+	if meta.IsNoMatchError(err) && c.refreshRESTMapper() {
+		// The definition may have been installed since the kinds
+		// were last discovered
+		mapping, err = mapper.RESTMapping(gk)
+	}
+	if meta.IsNoMatchError(err) {
+		return nil, notFound
+	} else if err != nil {
+		return nil, err
+	}
+	resources := c.client.dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return resources.Namespace(namespace), nil
+	}
+	return resources, nil
+}
+
+// restMapper gives the mapper used to find the resources of custom
+// kinds, making it when first needed.
+func (c *Cluster) restMapper() *restmapper.DeferredDiscoveryRESTMapper {
+	c.mapperOnce.Do(func() {
+		c.mapper = restmapper.NewDeferredDiscoveryRESTMapper(cached.NewMemCacheClient(c.client.coreClient.Discovery()))
+		c.mapper.Reset() // to fill the cache
+		c.mapperRefreshed = time.Now()
+	})
+	return c.mapper
+}
+
+// refreshRESTMapper discovers the kinds the API server has again,
+// unless that was done recently, and reports whether it did. This
+// keeps a kind that isn't installed from causing discovery every
+// time it's looked up.
+func (c *Cluster) refreshRESTMapper() bool {
+	c.mapperMu.Lock()
+	defer c.mapperMu.Unlock()
+	if time.Since(c.mapperRefreshed) < mapperRefreshInterval {
+		return false
+	}
+	c.mapper.Reset()
+	c.mapperRefreshed = time.Now()
+	return true
+}
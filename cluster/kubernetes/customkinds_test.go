@@ -0,0 +1,115 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
+)
+
+func registerWidgetImages(t *testing.T) func() {
+	for _, s := range []string{"Widget.example.com:app=.spec.image", "Widget.example.com:worker=.spec.workers[0].image"} {
+		ci, err := kresource.ParseCustomImage(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := RegisterCustomImage(ci); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() { delete(resourceKinds, "widget") }
+}
+
+func TestRegisterCustomImage(t *testing.T) {
+	defer registerWidgetImages(t)()
+	// Kinds which are already workloads can't have images
+	// registered, nor can the same kind in another group
+	for _, s := range []string{"Deployment.apps:app=.spec.image", "Widget.other.example.com:app=.spec.image"} {
+		ci, err := kresource.ParseCustomImage(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Error(t, RegisterCustomImage(ci), s)
+	}
+}
+
+func TestCustomKindControllers(t *testing.T) {
+	defer registerWidgetImages(t)()
+
+	widget := &unstructured.Unstructured{}
+	widget.SetAPIVersion("example.com/v1")
+	widget.SetKind("Widget")
+	widget.SetNamespace("default")
+	widget.SetName("w")
+	unstructured.SetNestedField(widget.Object, "example.com/app:1.0", "spec", "image")
+
+	clientset := scaledClientset()
+	clientset.Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "example.com/v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "widgets", Kind: "Widget", Namespaced: true},
+			},
+		},
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), widget)
+	c := NewCluster(clientset, nil, dynamicClient, &bytesApplier{}, nil, log.NewNopLogger(), ClusterOptions{})
+
+	id := flux.MustParseResourceID("default:widget/w")
+	controllers, err := c.SomeControllers([]flux.ResourceID{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, controllers, 1) {
+		containers := controllers[0].ContainersOrNil()
+		if assert.Len(t, containers, 1) {
+			assert.Equal(t, "app", containers[0].Name)
+			assert.Equal(t, "example.com/app:1.0", containers[0].Image.String())
+		}
+	}
+}
+
+func TestUpdateCustomImage(t *testing.T) {
+	defer registerWidgetImages(t)()
+
+	const manifest = `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+spec:
+  image: example.com/app:1.0 # the app
+  workers:
+  - name: first
+    image: "example.com/worker:0.1"
+`
+	id := flux.MustParseResourceID("default:widget/w")
+	out, err := updatePodController([]byte(manifest), id, "app", image.Ref{Name: image.Name{Domain: "example.com", Image: "app"}, Tag: "1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = updatePodController(out, id, "worker", image.Ref{Name: image.Name{Domain: "example.com", Image: "worker"}, Tag: "0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+spec:
+  image: example.com/app:1.1 # the app
+  workers:
+  - name: first
+    image: "example.com/worker:0.2"
+`, string(out))
+
+	_, err = updatePodController([]byte(manifest), id, "nonesuch", image.Ref{Name: image.Name{Domain: "example.com", Image: "app"}, Tag: "1.1"})
+	assert.Error(t, err)
+}
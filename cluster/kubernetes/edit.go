@@ -0,0 +1,1111 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
+)
+
+// The functions here edit manifests in place: the YAML is scanned
+// line by line to find the value to be changed, and only the bytes
+// of that value are replaced (or lines added or removed, for
+// annotations). Everything else -- comments, anchors, key order,
+// indentation, quoting -- is left exactly as it was.
+//
+// The scanner understands block-style YAML, which is what almost all
+// manifests are written in. When it comes across something it doesn't
+// understand on the way to the value (flow-style collections,
+// anchors, multi-line scalars, and so on), it gives up with
+// errUnsupported, and the caller falls back to kubeyaml. As a check,
+// the result of an edit is parsed and compared with what's expected;
+// if there's any difference, that's also treated as unsupported.
+
+var errUnsupported = errors.New("manifest cannot be edited in place")
+
+// setHelmValuesInPlace sets values in the spec of the
+// FluxHelmRelease given, in a YAML stream. The values are applied in
+// order.
+func setHelmValuesInPlace(in []byte, namespace, name string, values []cluster.HelmValue) ([]byte, error) {
+	for _, v := range values {
+		s := scanYAML(in)
+		res, err := s.find(namespace, "fluxhelmrelease", name)
+		if err != nil {
+			return nil, err
+		}
+		e, err := s.helmValue(res, v)
+		if err != nil {
+			return nil, err
+		}
+		if in, err = e.apply(res.doc); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// updateImageInPlace sets the image of a container in the resource
+// given, in a YAML stream.
+func updateImageInPlace(in []byte, namespace, kind, name, container string, ref image.Ref) ([]byte, error) {
+	s := scanYAML(in)
+	res, err := s.find(namespace, kind, name)
+	if err != nil {
+		return nil, err
+	}
+	var e *editor
+	if ck, ok := resourceKinds[strings.ToLower(kind)].(*customKind); ok {
+		ci, found := ck.image(container)
+		if !found {
+			return nil, errUnsupported
+		}
+		e, err = s.customImage(res, ci, ref)
+	} else if strings.ToLower(kind) == "fluxhelmrelease" {
+		e, err = s.helmReleaseImage(res, container, ref)
+	} else {
+		e, err = s.containerImage(res, strings.ToLower(kind), container, ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e.apply(res.doc)
+}
+
+// annotateInPlace sets or, if given an empty value, removes
+// annotations on the resource given, in a YAML stream. Annotations
+// are given as `key=value`, and are applied in order.
+func annotateInPlace(in []byte, namespace, kind, name string, annotations ...string) ([]byte, error) {
+	s := scanYAML(in)
+	res, err := s.find(namespace, kind, name)
+	if err != nil {
+		return nil, err
+	}
+	e, err := s.annotate(res, annotations)
+	if err != nil {
+		return nil, err
+	}
+	return e.apply(res.doc)
+}
+
+// -- scanning
+
+type yamlLine struct {
+	start, end int  // offsets of the line's content, not including the line ending
+	next       int  // offset of the following line
+	indent     int  // column of the first non-space character
+	col        int  // column of the content after any sequence item marker, or -1 if there is none
+	item       bool // whether the line starts a sequence item
+	blank      bool // whether the line is empty or only a comment
+}
+
+type yamlStream struct {
+	buf   []byte
+	lines []yamlLine
+}
+
+func scanYAML(buf []byte) *yamlStream {
+	s := &yamlStream{buf: buf}
+	for start := 0; start < len(buf); {
+		end, next := len(buf), len(buf)
+		if i := bytes.IndexByte(buf[start:], '\n'); i >= 0 {
+			end, next = start+i, start+i+1
+		}
+		text := buf[start:end]
+		rest := bytes.TrimLeft(text, " ")
+		l := yamlLine{start: start, end: end, next: next, indent: len(text) - len(rest)}
+		l.col = l.indent
+		l.blank = len(rest) == 0 || rest[0] == '#'
+		if !l.blank && rest[0] == '-' && (len(rest) == 1 || rest[1] == ' ') {
+			l.item = true
+			content := bytes.TrimLeft(rest[1:], " ")
+			l.col = end - start - len(content)
+			if len(content) == 0 || content[0] == '#' {
+				l.col = -1
+			}
+		}
+		s.lines = append(s.lines, l)
+		start = next
+	}
+	return s
+}
+
+func (s *yamlStream) text(i int) []byte {
+	return s.buf[s.lines[i].start:s.lines[i].end]
+}
+
+// yamlDoc is a document in a stream, as a range of lines.
+type yamlDoc struct {
+	from, to int
+}
+
+func (d yamlDoc) bytes(s *yamlStream) []byte {
+	if d.from == d.to {
+		return nil
+	}
+	return s.buf[s.lines[d.from].start:s.lines[d.to-1].next]
+}
+
+func (s *yamlStream) documents() ([]yamlDoc, error) {
+	if bytes.IndexByte(s.buf, '\r') >= 0 {
+		return nil, errUnsupported
+	}
+	var docs []yamlDoc
+	from := 0
+	for i := range s.lines {
+		text := s.text(i)
+		switch {
+		case bytes.HasPrefix(text, []byte("%")):
+			return nil, errUnsupported
+		case bytes.HasPrefix(text, []byte("---")) || bytes.HasPrefix(text, []byte("...")):
+			rest := bytes.TrimSpace(text[3:])
+			if len(text) > 3 && text[3] != ' ' {
+				continue // e.g., `----`, which is just a scalar
+			}
+			if len(rest) > 0 && rest[0] != '#' {
+				return nil, errUnsupported
+			}
+			docs = append(docs, yamlDoc{from, i})
+			from = i + 1
+		}
+	}
+	docs = append(docs, yamlDoc{from, len(s.lines)})
+	return docs, nil
+}
+
+// yamlMap is a block mapping, as a range of lines and the column its
+// keys are in.
+type yamlMap struct {
+	from, to int
+	col      int
+}
+
+type valueKind int
+
+const (
+	valueNested valueKind = iota // nothing on the line; a collection follows, or it's null
+	valueScalar                  // a plain or quoted scalar on the same line
+	valueOther                   // anything else, e.g., a block scalar or flow collection
+)
+
+// yamlEntry is an entry in a block mapping.
+type yamlEntry struct {
+	key        string
+	col        int // the column the key is in
+	line       int // the line the key is on
+	to         int // the line after the last non-blank line of the value
+	kind       valueKind
+	valueStart int  // offset of the value, if a scalar
+	valueEnd   int  // offset after the value, if a scalar
+	quote      byte // the quote character used for the value, if any
+	comment    int  // offset of a comment after the value, or -1
+}
+
+func (s *yamlStream) root(d yamlDoc) (yamlMap, error) {
+	for i := d.from; i < d.to; i++ {
+		if s.lines[i].blank {
+			continue
+		}
+		if s.lines[i].item {
+			return yamlMap{}, errUnsupported
+		}
+		return yamlMap{from: i, to: d.to, col: s.lines[i].indent}, nil
+	}
+	return yamlMap{}, errUnsupported
+}
+
+// entries lists the entries of a block mapping.
+func (s *yamlStream) entries(m yamlMap) ([]yamlEntry, error) {
+	var entries []yamlEntry
+	lastContent := -1
+	for i := m.from; i < m.to; i++ {
+		l := s.lines[i]
+		if l.blank {
+			continue
+		}
+		switch {
+		case len(entries) == 0:
+			if l.col != m.col {
+				return nil, errUnsupported
+			}
+		case l.indent > m.col || (l.indent == m.col && l.item):
+			lastContent = i
+			continue // part of the value of the previous entry
+		case l.indent < m.col:
+			return nil, errUnsupported
+		}
+		if len(entries) > 0 {
+			entries[len(entries)-1].to = lastContent + 1
+		}
+		e, err := s.entry(i, m.col)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+		lastContent = i
+	}
+	if len(entries) > 0 {
+		entries[len(entries)-1].to = lastContent + 1
+	}
+	return entries, nil
+}
+
+// entry parses the mapping entry starting at the column given, on
+// the line given.
+func (s *yamlStream) entry(i, col int) (yamlEntry, error) {
+	l := s.lines[i]
+	e := yamlEntry{col: col, line: i, to: i + 1, comment: -1}
+	text := s.buf[l.start+col : l.end]
+
+	var rest []byte
+	switch text[0] {
+	case '"', '\'':
+		n := quotedLength(text)
+		if n < 0 {
+			return e, errUnsupported
+		}
+		var key string
+		if err := yaml.Unmarshal(text[:n], &key); err != nil {
+			return e, errUnsupported
+		}
+		e.key = key
+		rest = bytes.TrimLeft(text[n:], " ")
+		if len(rest) == 0 || rest[0] != ':' {
+			return e, errUnsupported
+		}
+		rest = rest[1:]
+	case '?', '{', '[', '&', '*', '!', '|', '>', '%', '@', '`', '#':
+		return e, errUnsupported
+	default:
+		colon := -1
+		for j := 0; j < len(text); j++ {
+			if text[j] == '#' && j > 0 && (text[j-1] == ' ' || text[j-1] == '\t') {
+				break
+			}
+			if text[j] == ':' && (j+1 == len(text) || text[j+1] == ' ' || text[j+1] == '\t') {
+				colon = j
+				break
+			}
+		}
+		if colon < 0 {
+			return e, errUnsupported
+		}
+		e.key = strings.TrimRight(string(text[:colon]), " \t")
+		rest = text[colon+1:]
+	}
+
+	if len(rest) > 0 && rest[0] != ' ' && rest[0] != '\t' {
+		return e, errUnsupported
+	}
+	value := bytes.TrimLeft(rest, " \t")
+	start := l.end - len(value)
+	switch {
+	case len(value) == 0:
+		e.kind = valueNested
+	case value[0] == '#':
+		e.kind = valueNested
+		e.comment = start
+	case value[0] == '"' || value[0] == '\'':
+		n := quotedLength(value)
+		if n < 0 {
+			return e, errUnsupported // e.g., a quoted scalar over several lines
+		}
+		e.kind, e.quote = valueScalar, value[0]
+		e.valueStart, e.valueEnd = start, start+n
+		after := bytes.TrimLeft(value[n:], " \t")
+		if len(after) > 0 {
+			if after[0] != '#' {
+				return e, errUnsupported
+			}
+			e.comment = l.end - len(after)
+		}
+	case bytes.IndexByte([]byte("|>{[&*!%@`"), value[0]) >= 0:
+		e.kind = valueOther
+	default:
+		e.kind = valueScalar
+		end := len(value)
+		for j := 1; j < len(value); j++ {
+			if value[j] == '#' && (value[j-1] == ' ' || value[j-1] == '\t') {
+				e.comment = start + j
+				end = j
+				break
+			}
+		}
+		e.valueStart = start
+		e.valueEnd = start + len(bytes.TrimRight(value[:end], " \t"))
+	}
+	return e, nil
+}
+
+// quotedLength gives the length of the quoted scalar at the start of
+// text, or -1 if it isn't closed.
+func quotedLength(text []byte) int {
+	q := text[0]
+	for j := 1; j < len(text); j++ {
+		switch {
+		case q == '"' && text[j] == '\\':
+			j++
+		case text[j] == q && q == '\'' && j+1 < len(text) && text[j+1] == '\'':
+			j++
+		case text[j] == q:
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// lookup finds the entry with the key given in a block mapping.
+func (s *yamlStream) lookup(m yamlMap, key string) (yamlEntry, bool, error) {
+	entries, err := s.entries(m)
+	if err != nil {
+		return yamlEntry{}, false, err
+	}
+	for _, e := range entries {
+		if e.key == key {
+			return e, true, nil
+		}
+	}
+	return yamlEntry{}, false, nil
+}
+
+// mapping gives the block mapping that is the value of an entry. ok
+// is false if the value is null (i.e., there's nothing there).
+func (s *yamlStream) mapping(e yamlEntry) (m yamlMap, ok bool, err error) {
+	if e.kind != valueNested {
+		return m, false, errUnsupported
+	}
+	for i := e.line + 1; i < e.to; i++ {
+		l := s.lines[i]
+		if l.blank {
+			continue
+		}
+		if l.item || l.indent <= e.col {
+			return m, false, errUnsupported
+		}
+		return yamlMap{from: i, to: e.to, col: l.indent}, true, nil
+	}
+	return m, false, nil
+}
+
+// items gives the items of a block sequence that is the value of an
+// entry, each as a block mapping.
+func (s *yamlStream) items(e yamlEntry) ([]yamlMap, error) {
+	if e.kind != valueNested {
+		return nil, errUnsupported
+	}
+	var starts []int
+	indent := -1
+	for i := e.line + 1; i < e.to; i++ {
+		l := s.lines[i]
+		if l.blank {
+			continue
+		}
+		if indent < 0 {
+			if !l.item {
+				return nil, errUnsupported
+			}
+			indent = l.indent
+		}
+		if l.indent < indent {
+			return nil, errUnsupported
+		}
+		if l.item && l.indent == indent {
+			starts = append(starts, i)
+		}
+	}
+	var items []yamlMap
+	for n, start := range starts {
+		to := e.to
+		if n+1 < len(starts) {
+			to = starts[n+1]
+		}
+		item := yamlMap{from: start, to: to, col: s.lines[start].col}
+		if item.col < 0 {
+			// `-` on its own line, with the mapping on the lines after
+			item.from = -1
+			for i := start + 1; i < to; i++ {
+				if !s.lines[i].blank {
+					item.from, item.col = i, s.lines[i].indent
+					break
+				}
+			}
+			if item.from < 0 || s.lines[item.from].item || item.col <= indent {
+				return nil, errUnsupported
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// descend follows the keys given down through nested block mappings.
+func (s *yamlStream) descend(m yamlMap, keys ...string) (yamlMap, error) {
+	for _, key := range keys {
+		e, ok, err := s.lookup(m, key)
+		if err != nil {
+			return m, err
+		}
+		if !ok {
+			return m, errUnsupported
+		}
+		if m, ok, err = s.mapping(e); err != nil || !ok {
+			return m, errUnsupported
+		}
+	}
+	return m, nil
+}
+
+// value gives the string value of a scalar entry; ok is false if
+// it's not a string (e.g., it's a number).
+func (s *yamlStream) value(e yamlEntry) (value string, ok bool) {
+	v, ok := s.scalar(e)
+	if !ok {
+		return "", false
+	}
+	value, ok = v.(string)
+	return value, ok
+}
+
+// scalar gives the parsed value of a scalar entry.
+func (s *yamlStream) scalar(e yamlEntry) (interface{}, bool) {
+	if e.kind != valueScalar {
+		return nil, false
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(s.buf[e.valueStart:e.valueEnd], &v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// located is the location of a resource in a stream.
+type located struct {
+	doc  yamlDoc
+	m    yamlMap
+	path []interface{} // the path to the resource within the document
+}
+
+type resourceHeader struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Items []resourceHeader `yaml:"items"`
+}
+
+func (h resourceHeader) is(namespace, kind, name string) bool {
+	ns := h.Metadata.Namespace
+	if ns == "" {
+		ns = "default"
+	}
+	return ns == namespace && strings.EqualFold(h.Kind, kind) && h.Metadata.Name == name
+}
+
+// find locates the (single) resource with the namespace, kind and
+// name given, either as a document by itself or in a `List`.
+func (s *yamlStream) find(namespace, kind, name string) (located, error) {
+	docs, err := s.documents()
+	if err != nil {
+		return located{}, err
+	}
+	var found []located
+	for _, d := range docs {
+		var header resourceHeader
+		if err := yaml.Unmarshal(d.bytes(s), &header); err != nil {
+			return located{}, errUnsupported
+		}
+		if header.Kind == "" {
+			continue
+		}
+		if header.is(namespace, kind, name) {
+			m, err := s.root(d)
+			if err != nil {
+				return located{}, err
+			}
+			found = append(found, located{doc: d, m: m})
+			continue
+		}
+		if header.Kind != "List" {
+			continue
+		}
+		for i, item := range header.Items {
+			if !item.is(namespace, kind, name) {
+				continue
+			}
+			m, err := s.root(d)
+			if err != nil {
+				return located{}, err
+			}
+			e, ok, err := s.lookup(m, "items")
+			if err != nil || !ok {
+				return located{}, errUnsupported
+			}
+			items, err := s.items(e)
+			if err != nil || len(items) != len(header.Items) {
+				return located{}, errUnsupported
+			}
+			found = append(found, located{doc: d, m: items[i], path: []interface{}{"items", i}})
+		}
+	}
+	if len(found) != 1 {
+		return located{}, errUnsupported
+	}
+	return found[0], nil
+}
+
+// -- editing
+
+type byteEdit struct {
+	start, end int
+	text       string
+}
+
+// pathEdit is the effect an edit is expected to have on the parsed
+// document; it's used to check the edit.
+type pathEdit struct {
+	path   []interface{}
+	value  interface{}
+	delete bool
+}
+
+type editor struct {
+	s       *yamlStream
+	edits   []byteEdit
+	effects []pathEdit
+}
+
+func (s *yamlStream) editor() *editor {
+	return &editor{s: s}
+}
+
+func (e *editor) expect(path []interface{}, value interface{}, del bool) {
+	e.effects = append(e.effects, pathEdit{path: path, value: value, delete: del})
+}
+
+// setScalar replaces the value of a scalar entry, keeping the quoting
+// style and, where there's room, the column of any comment after it.
+// The value is a string, or a bool or int to be written as such.
+func (e *editor) setScalar(entry yamlEntry, value interface{}) error {
+	if entry.kind != valueScalar || entry.to > entry.line+1 {
+		return errUnsupported
+	}
+	if current, ok := e.s.scalar(entry); ok && reflect.DeepEqual(current, value) {
+		return nil
+	}
+	text := scalarText(value, entry.quote)
+	end := entry.valueEnd
+	if entry.comment >= 0 {
+		end = entry.comment
+		pad := entry.comment - entry.valueStart - len(text)
+		if pad < 1 {
+			pad = 1
+		}
+		text += strings.Repeat(" ", pad)
+	}
+	e.edits = append(e.edits, byteEdit{entry.valueStart, end, text})
+	return nil
+}
+
+// remove removes an entry, including its value, from a mapping.
+func (e *editor) remove(entry yamlEntry) error {
+	if e.s.lines[entry.line].item {
+		return errUnsupported
+	}
+	e.edits = append(e.edits, byteEdit{e.s.lines[entry.line].start, e.s.lines[entry.to-1].next, ""})
+	return nil
+}
+
+// insertAfter adds lines after the line given.
+func (e *editor) insertAfter(line int, lines []string) {
+	l := e.s.lines[line]
+	text := strings.Join(lines, "\n") + "\n"
+	if l.next == l.end { // no line ending, at the end of the stream
+		text = "\n" + strings.TrimSuffix(text, "\n")
+	}
+	e.edits = append(e.edits, byteEdit{l.next, l.next, text})
+}
+
+// apply makes the edits to the stream, and checks that the result
+// parses to what's expected.
+func (e *editor) apply(doc yamlDoc) ([]byte, error) {
+	sort.SliceStable(e.edits, func(i, j int) bool {
+		return e.edits[i].start < e.edits[j].start
+	})
+	out := &bytes.Buffer{}
+	pos := 0
+	for _, edit := range e.edits {
+		if edit.start < pos {
+			return nil, errUnsupported // overlapping edits
+		}
+		out.Write(e.s.buf[pos:edit.start])
+		out.WriteString(edit.text)
+		pos = edit.end
+	}
+	out.Write(e.s.buf[pos:])
+	result := out.Bytes()
+
+	// The edits are all within the document, so it's at the same
+	// place in the result, and differs in length by the difference
+	// the edits made.
+	before := doc.bytes(e.s)
+	start := 0
+	if doc.from < doc.to {
+		start = e.s.lines[doc.from].start
+	}
+	after := result[start : start+len(before)+len(result)-len(e.s.buf)]
+	if err := checkEdit(before, after, e.effects); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func checkEdit(before, after []byte, effects []pathEdit) error {
+	var expected, got interface{}
+	if err := yaml.Unmarshal(before, &expected); err != nil {
+		return errUnsupported
+	}
+	if err := yaml.Unmarshal(after, &got); err != nil {
+		return errUnsupported
+	}
+	for _, effect := range effects {
+		var err error
+		if expected, err = setPath(expected, effect.path, effect); err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(expected, got) {
+		return errUnsupported
+	}
+	return nil
+}
+
+func setPath(node interface{}, path []interface{}, effect pathEdit) (interface{}, error) {
+	if len(path) == 0 {
+		return effect.value, nil
+	}
+	switch p := path[0].(type) {
+	case string:
+		m, ok := node.(map[interface{}]interface{})
+		if !ok {
+			if node != nil {
+				return nil, errUnsupported
+			}
+			m = map[interface{}]interface{}{}
+		}
+		if len(path) == 1 && effect.delete {
+			delete(m, p)
+			return m, nil
+		}
+		child, err := setPath(m[p], path[1:], effect)
+		if err != nil {
+			return nil, err
+		}
+		m[p] = child
+		return m, nil
+	case int:
+		seq, ok := node.([]interface{})
+		if !ok || p >= len(seq) {
+			return nil, errUnsupported
+		}
+		child, err := setPath(seq[p], path[1:], effect)
+		if err != nil {
+			return nil, err
+		}
+		seq[p] = child
+		return seq, nil
+	}
+	return nil, errUnsupported
+}
+
+func appendPath(path []interface{}, elems ...interface{}) []interface{} {
+	return append(append([]interface{}{}, path...), elems...)
+}
+
+// quoteScalar gives the YAML for a string value, using the quote
+// character given if there is one, or no quotes if that's safe.
+func quoteScalar(value string, quote byte) string {
+	switch {
+	case quote == '"' || strings.ContainsAny(value, "\n\r\t"):
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		enc.Encode(value)
+		return strings.TrimSuffix(buf.String(), "\n")
+	case quote == '\'' || !isPlain(value):
+		return "'" + strings.Replace(value, "'", "''", -1) + "'"
+	}
+	return value
+}
+
+// scalarText gives the YAML for a scalar value; strings are quoted as
+// with quoteScalar, and anything else is written as it is.
+func scalarText(value interface{}, quote byte) string {
+	if str, ok := value.(string); ok {
+		return quoteScalar(str, quote)
+	}
+	return fmt.Sprint(value)
+}
+
+// isPlain reports whether a string can be written without quotes and
+// still be read as the same string.
+func isPlain(value string) bool {
+	if value == "" || strings.TrimSpace(value) != value {
+		return false
+	}
+	var v map[string]interface{}
+	if err := yaml.Unmarshal([]byte("k: "+value), &v); err != nil {
+		return false
+	}
+	s, ok := v["k"].(string)
+	return ok && s == value && len(v) == 1
+}
+
+// -- specific edits
+
+// containerImage finds the container named in a workload, and sets
+// its image.
+func (s *yamlStream) containerImage(res located, kind, container string, ref image.Ref) (*editor, error) {
+	podSpecPath := []string{"spec", "template", "spec"}
+	if kind == "cronjob" {
+		podSpecPath = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	podSpec, err := s.descend(res.m, podSpecPath...)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range []string{"containers", "initContainers"} {
+		list, ok, err := s.lookup(podSpec, field)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		items, err := s.items(list)
+		if err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			nameEntry, ok, err := s.lookup(item, "name")
+			if err != nil {
+				return nil, err
+			}
+			if name, isString := s.value(nameEntry); !ok || !isString || name != container {
+				continue
+			}
+			imageEntry, ok, err := s.lookup(item, "image")
+			if err != nil || !ok {
+				return nil, errUnsupported
+			}
+			e := s.editor()
+			if err := e.setScalar(imageEntry, ref.String()); err != nil {
+				return nil, err
+			}
+			path := res.path
+			for _, p := range podSpecPath {
+				path = appendPath(path, p)
+			}
+			e.expect(appendPath(path, field, i, "image"), ref.String(), false)
+			return e, nil
+		}
+	}
+	return nil, errUnsupported
+}
+
+// helmReleaseImage sets the image for a container in a
+// FluxHelmRelease, interpreting `values` the same way as
+// `FindFluxHelmReleaseContainers`.
+func (s *yamlStream) helmReleaseImage(res located, container string, ref image.Ref) (*editor, error) {
+	path := appendPath(res.path, "spec", "values")
+	m, err := s.descend(res.m, "spec", "values")
+	if err != nil {
+		return nil, err
+	}
+	if container != kresource.ReleaseContainerName {
+		if m, err = s.descend(m, container); err != nil {
+			return nil, err
+		}
+		path = appendPath(path, container)
+	}
+
+	imageEntry, ok, err := s.lookup(m, "image")
+	if err != nil || !ok {
+		return nil, errUnsupported
+	}
+	e := s.editor()
+	set := func(entry yamlEntry, value string, p ...interface{}) error {
+		e.expect(appendPath(path, p...), value, false)
+		return e.setScalar(entry, value)
+	}
+
+	if imageEntry.kind == valueScalar {
+		tagEntry, ok, err := s.lookup(m, "tag")
+		if err != nil {
+			return nil, err
+		}
+		if _, isString := s.value(tagEntry); ok && isString {
+			if err := set(imageEntry, ref.Name.String(), "image"); err != nil {
+				return nil, err
+			}
+			return e, set(tagEntry, ref.TagWithDigest(), "tag")
+		}
+		return e, set(imageEntry, ref.String(), "image")
+	}
+
+	imageMap, ok, err := s.mapping(imageEntry)
+	if err != nil || !ok {
+		return nil, errUnsupported
+	}
+	repoEntry, ok, err := s.lookup(imageMap, "repository")
+	if err != nil || !ok {
+		return nil, errUnsupported
+	}
+	tagEntry, ok, err := s.lookup(imageMap, "tag")
+	if err != nil || !ok {
+		return nil, errUnsupported
+	}
+	if err := set(repoEntry, ref.Name.String(), "image", "repository"); err != nil {
+		return nil, err
+	}
+	return e, set(tagEntry, ref.TagWithDigest(), "image", "tag")
+}
+
+// helmValue sets a value under `spec.values` in a FluxHelmRelease.
+// If some of the keys leading to the value aren't there, they are
+// added along with the value, after the last entry of the deepest
+// mapping that is there.
+func (s *yamlStream) helmValue(res located, v cluster.HelmValue) (*editor, error) {
+	keys := append([]string{"spec", "values"}, v.Path...)
+	value := v.Typed()
+	e := s.editor()
+	e.expect(appendPath(res.path, stringsPath(keys)...), value, false)
+
+	m, step := res.m, 2
+	for i, key := range keys {
+		entry, ok, err := s.lookup(m, key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			entries, err := s.entries(m)
+			if err != nil || len(entries) == 0 {
+				return nil, errUnsupported
+			}
+			e.insertAfter(entries[len(entries)-1].to-1, nestedLines(keys[i:], m.col, step, value))
+			return e, nil
+		}
+		if i == len(keys)-1 {
+			if entry.kind != valueScalar {
+				return nil, fmt.Errorf("%s is not a scalar value, so it can't be set", v.Key())
+			}
+			return e, e.setScalar(entry, value)
+		}
+		if entry.kind == valueScalar && i > 1 {
+			return nil, fmt.Errorf("%s is not a mapping, so %s can't be set", strings.Join(keys[2:i+1], "."), v.Key())
+		}
+		sub, ok, err := s.mapping(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// The value is null; put what's needed under the key
+			if entry.comment >= 0 {
+				return nil, errUnsupported
+			}
+			e.insertAfter(entry.line, nestedLines(keys[i+1:], entry.col+step, step, value))
+			return e, nil
+		}
+		m, step = sub, sub.col-entry.col
+	}
+	return nil, errUnsupported
+}
+
+// nestedLines gives the lines for a value under the keys given, each
+// key indented by step more than the last.
+func nestedLines(keys []string, col, step int, value interface{}) []string {
+	var lines []string
+	for _, key := range keys[:len(keys)-1] {
+		lines = append(lines, strings.Repeat(" ", col)+quoteScalar(key, 0)+":")
+		col += step
+	}
+	return append(lines, strings.Repeat(" ", col)+quoteScalar(keys[len(keys)-1], 0)+": "+scalarText(value, 0))
+}
+
+func stringsPath(keys []string) []interface{} {
+	path := make([]interface{}, len(keys))
+	for i, k := range keys {
+		path[i] = k
+	}
+	return path
+}
+
+// customImage sets the image at the path registered for a container
+// in a custom resource.
+func (s *yamlStream) customImage(res located, ci kresource.CustomImage, ref image.Ref) (*editor, error) {
+	m := res.m
+	for i := 0; i < len(ci.Path); i++ {
+		key, ok := ci.Path[i].(string)
+		if !ok {
+			return nil, errUnsupported
+		}
+		entry, ok, err := s.lookup(m, key)
+		if err != nil || !ok {
+			return nil, errUnsupported
+		}
+		if i == len(ci.Path)-1 {
+			e := s.editor()
+			if err := e.setScalar(entry, ref.String()); err != nil {
+				return nil, err
+			}
+			e.expect(appendPath(res.path, ci.Path...), ref.String(), false)
+			return e, nil
+		}
+		if index, isIndex := ci.Path[i+1].(int); isIndex {
+			items, err := s.items(entry)
+			if err != nil || index >= len(items) {
+				return nil, errUnsupported
+			}
+			m = items[index]
+			i++
+			continue
+		}
+		if m, ok, err = s.mapping(entry); err != nil || !ok {
+			return nil, errUnsupported
+		}
+	}
+	return nil, errUnsupported
+}
+
+// annotate applies annotations, given as `key=value` (or `key=` to
+// remove the annotation), to a resource. Like kubeyaml, it adds new
+// annotations after those already there, and removes the
+// `annotations` field if there are none left.
+func (s *yamlStream) annotate(res located, annotations []string) (*editor, error) {
+	// Work out what the annotations should end up as
+	final := map[string]*string{}
+	var order []string
+	for _, a := range annotations {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("annotation %q is not of the form key=value", a)
+		}
+		if _, ok := final[kv[0]]; !ok {
+			order = append(order, kv[0])
+		}
+		final[kv[0]] = nil
+		if kv[1] != "" {
+			final[kv[0]] = &kv[1]
+		}
+	}
+
+	metaEntry, ok, err := s.lookup(res.m, "metadata")
+	if err != nil || !ok {
+		return nil, errUnsupported
+	}
+	meta, ok, err := s.mapping(metaEntry)
+	if err != nil || !ok {
+		return nil, errUnsupported
+	}
+	step := meta.col - metaEntry.col
+	path := appendPath(res.path, "metadata", "annotations")
+
+	annotationsEntry, hasAnnotations, err := s.lookup(meta, "annotations")
+	if err != nil {
+		return nil, err
+	}
+	var existing []yamlEntry
+	if hasAnnotations {
+		m, ok, err := s.mapping(annotationsEntry)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if existing, err = s.entries(m); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	e := s.editor()
+	remaining := 0
+	seen := map[string]bool{}
+	for _, entry := range existing {
+		seen[entry.key] = true
+		if value, ok := final[entry.key]; !ok || value != nil {
+			remaining++
+		}
+	}
+	var added []string
+	for _, key := range order {
+		if !seen[key] && final[key] != nil {
+			added = append(added, key)
+			remaining++
+		}
+	}
+
+	if remaining == 0 {
+		if hasAnnotations {
+			e.expect(path, "", true)
+			if err := e.remove(annotationsEntry); err != nil {
+				return nil, err
+			}
+		}
+		return e, nil
+	}
+
+	for _, entry := range existing {
+		value, ok := final[entry.key]
+		if !ok {
+			continue
+		}
+		if value == nil {
+			e.expect(appendPath(path, entry.key), "", true)
+			if err := e.remove(entry); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		e.expect(appendPath(path, entry.key), *value, false)
+		if err := e.setScalar(entry, *value); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(added) == 0 {
+		return e, nil
+	}
+	var lines []string
+	var after, col int
+	switch {
+	case len(existing) > 0:
+		last := existing[len(existing)-1]
+		after, col = last.to-1, last.col
+	case hasAnnotations:
+		if annotationsEntry.kind != valueNested || annotationsEntry.comment >= 0 {
+			return nil, errUnsupported
+		}
+		after, col = annotationsEntry.line, annotationsEntry.col+step
+	default:
+		entries, err := s.entries(meta)
+		if err != nil || len(entries) == 0 {
+			return nil, errUnsupported
+		}
+		after, col = entries[len(entries)-1].to-1, meta.col
+		lines = append(lines, strings.Repeat(" ", col)+"annotations:")
+		col += step
+	}
+	for _, key := range added {
+		e.expect(appendPath(path, key), *final[key], false)
+		lines = append(lines, strings.Repeat(" ", col)+quoteScalar(key, 0)+": "+quoteScalar(*final[key], 0))
+	}
+	e.insertAfter(after, lines)
+	return e, nil
+}
@@ -0,0 +1,304 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/image"
+)
+
+func TestAnnotateInPlace(t *testing.T) {
+	in := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    # why we scrape
+    prometheus.io/scrape: "true"   # aligned
+    flux.weave.works/tag.app: glob:* # old pattern
+  labels: {name: app}
+spec: {}
+`
+	expected := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    # why we scrape
+    prometheus.io/scrape: "true"   # aligned
+    flux.weave.works/tag.app: semver:~1 # old pattern
+    flux.weave.works/automated: 'true'
+  labels: {name: app}
+spec: {}
+`
+	out, err := annotateInPlace([]byte(in), "default", "deployment", "app",
+		"flux.weave.works/tag.app=semver:~1", "flux.weave.works/automated=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+}
+
+func TestAnnotateInPlace_Remove(t *testing.T) {
+	in := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    prometheus.io/scrape: "true" # keep
+    flux.weave.works/automated: 'true'
+spec: {}
+`
+	expected := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    prometheus.io/scrape: "true" # keep
+spec: {}
+`
+	out, err := annotateInPlace([]byte(in), "default", "deployment", "app", "flux.weave.works/automated=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+
+	// Removing the last annotation removes the field altogether
+	expected = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec: {}
+`
+	out, err = annotateInPlace(out, "default", "deployment", "app", "prometheus.io/scrape=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+}
+
+func TestEditInPlace_List(t *testing.T) {
+	in := `apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: app
+    namespace: prod
+  spec:
+    template:
+      spec:
+        containers:
+        - name: app
+          image: nginx:1.14 # pinned
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: other
+    namespace: prod
+    annotations:
+      flux.weave.works/locked: 'true'
+  spec:
+    template:
+      spec:
+        containers:
+        - name: app
+          image: nginx:1.14
+`
+	expected := `apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: app
+    namespace: prod
+    annotations:
+      flux.weave.works/automated: 'true'
+  spec:
+    template:
+      spec:
+        containers:
+        - name: app
+          image: nginx:1.15 # pinned
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: other
+    namespace: prod
+  spec:
+    template:
+      spec:
+        containers:
+        - name: app
+          image: nginx:1.14
+`
+	ref, _ := image.ParseRef("nginx:1.15")
+	out, err := updateImageInPlace([]byte(in), "prod", "deployment", "app", "app", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err = annotateInPlace(out, "prod", "deployment", "app", "flux.weave.works/automated=true"); err != nil {
+		t.Fatal(err)
+	}
+	if out, err = annotateInPlace(out, "prod", "deployment", "other", "flux.weave.works/locked="); err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+}
+
+func TestSetHelmValuesInPlace(t *testing.T) {
+	in := `---
+apiVersion: helm.integrations.flux.weave.works/v1alpha2
+kind: FluxHelmRelease
+metadata:
+  name: ghost
+  namespace: blog
+spec:
+  chartGitPath: ghost
+  values:
+    image: bitnami/ghost:1.21.5 # pinned
+    replicas: 1
+    ingress:
+      enabled: false
+
+    serviceType: LoadBalancer
+---
+kind: Service
+metadata:
+  name: ghost
+`
+	expected := `---
+apiVersion: helm.integrations.flux.weave.works/v1alpha2
+kind: FluxHelmRelease
+metadata:
+  name: ghost
+  namespace: blog
+spec:
+  chartGitPath: ghost
+  values:
+    image: bitnami/ghost:1.22.0 # pinned
+    replicas: 3
+    ingress:
+      enabled: true
+      host: ghost.example.com:80
+
+    serviceType: LoadBalancer
+    podAnnotations:
+      prometheus.io/scrape: 'true'
+---
+kind: Service
+metadata:
+  name: ghost
+`
+	values, err := cluster.ParseHelmValues([]string{
+		"image=bitnami/ghost:1.22.0",
+		"replicas=3",
+		"ingress.enabled=true",
+		"ingress.host=ghost.example.com:80",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotations, _ := cluster.ParseHelmValues([]string{`podAnnotations.prometheus\.io/scrape=true`}, true)
+	out, err := setHelmValuesInPlace([]byte(in), "blog", "ghost", append(values, annotations...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+
+	// Keys that are there but not mappings can't be descended into
+	values, _ = cluster.ParseHelmValues([]string{"image.tag=1.22.0"}, false)
+	if _, err := setHelmValuesInPlace([]byte(in), "blog", "ghost", values); err == nil {
+		t.Error("expected error setting a value under a scalar")
+	}
+}
+
+func TestEditInPlaceUnsupported(t *testing.T) {
+	ref, _ := image.ParseRef("nginx:1.15")
+	for name, in := range map[string]string{
+		"flow containers": `kind: Deployment
+metadata: {name: app}
+spec:
+  template:
+    spec:
+      containers: [{name: app, image: "nginx:1.14"}]
+`,
+		"anchored image": `kind: Deployment
+metadata: {name: app}
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: &img nginx:1.14
+`,
+		"multi-line image": `kind: Deployment
+metadata: {name: app}
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: "nginx:
+          1.14"
+`,
+		"no such container": `kind: Deployment
+metadata: {name: app}
+spec:
+  template:
+    spec:
+      containers:
+      - name: other
+        image: nginx:1.14
+`,
+	} {
+		if _, err := updateImageInPlace([]byte(in), "default", "deployment", "app", "app", ref); err != errUnsupported {
+			t.Errorf("%s: expected errUnsupported, got %v", name, err)
+		}
+	}
+
+	if _, err := annotateInPlace([]byte(`kind: Deployment
+metadata: {name: app}
+`), "default", "deployment", "app", "flux.weave.works/automated=true"); err != errUnsupported {
+		t.Errorf("flow metadata: expected errUnsupported, got %v", err)
+	}
+}
+
+func TestQuoteScalar(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		quote    byte
+		expected string
+	}{
+		{"nginx:1.15", 0, "nginx:1.15"},
+		{"nginx:1.15", '\'', "'nginx:1.15'"},
+		{"nginx:1.15", '"', `"nginx:1.15"`},
+		{"true", 0, "'true'"},
+		{"1.0", 0, "'1.0'"},
+		{"glob:*", 0, "glob:*"},
+		{"*", 0, "'*'"},
+		{"it's # not a comment", 0, "'it''s # not a comment'"},
+		{"first\nsecond", 0, `"first\nsecond"`},
+	} {
+		if got := quoteScalar(c.value, c.quote); got != c.expected {
+			t.Errorf("quoting %q: expected %s, got %s", c.value, c.expected, got)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package kubernetes
 import (
 	"fmt"
 
+	"github.com/weaveworks/flux"
 	fluxerr "github.com/weaveworks/flux/errors"
 )
 
@@ -33,3 +34,32 @@ using kubectl).
 `,
 	}
 }
+
+func RenderedUpdateError(id flux.ResourceID, source string) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  fmt.Errorf("resource %s is rendered from %s, so cannot be updated", id, source),
+		Help: `Flux cannot update resources rendered from jsonnet.
+
+The manifest for ` + id.String() + ` is rendered from the file ` + source + `,
+which Flux does not know how to change. Make the change to that file
+(or the files it imports) yourself, and commit it.
+`,
+	}
+}
+
+func HelmValuesUpdateError(id flux.ResourceID) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  fmt.Errorf("values cannot be set in the manifest for %s", id),
+		Help: `Flux could not set the values in the manifest for ` + id.String() + `.
+
+Flux sets values by editing the manifest in place, so it only changes
+what it needs to. It can't do that if the values, or the keys leading
+to them, are written in a style it doesn't understand, for example as
+flow-style collections ({...}), anchors and aliases, or multi-line
+strings. Rewrite the manifest in block style, or set the values
+yourself and commit the change.
+`,
+	}
+}
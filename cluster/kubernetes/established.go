@@ -0,0 +1,110 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
+)
+
+var _ cluster.EstablishedWaiter = &Cluster{}
+
+var (
+	// How often to check whether definitions have been established.
+	establishedPollInterval = time.Second
+	// How long to wait for definitions to be established, when
+	// retrying resources that depend on them.
+	establishedTimeout = 30 * time.Second
+)
+
+// crdSpec is just enough of a CustomResourceDefinition to tell what
+// it defines.
+type crdSpec struct {
+	Spec struct {
+		Group    string `yaml:"group"`
+		Version  string `yaml:"version"`
+		Versions []struct {
+			Name string `yaml:"name"`
+		} `yaml:"versions"`
+		Names struct {
+			Kind string `yaml:"kind"`
+		} `yaml:"names"`
+	} `yaml:"spec"`
+}
+
+type definedKind struct {
+	groupVersion string
+	kind         string
+}
+
+// WaitEstablished waits until the API server reports the kinds
+// defined by any CustomResourceDefinitions among the resources given
+// as available, since until then, resources of those kinds cannot be
+// applied.
+func (c *Cluster) WaitEstablished(resources []resource.Resource, timeout time.Duration) error {
+	var pending []definedKind
+	for _, res := range resources {
+		if _, kind, _ := res.ResourceID().Components(); kind != "customresourcedefinition" {
+			continue
+		}
+		var crd crdSpec
+		if err := yaml.Unmarshal(res.Bytes(), &crd); err != nil {
+			return err
+		}
+		version := crd.Spec.Version
+		if version == "" && len(crd.Spec.Versions) > 0 {
+			version = crd.Spec.Versions[0].Name
+		}
+		pending = append(pending, definedKind{crd.Spec.Group + "/" + version, crd.Spec.Names.Kind})
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var stillPending []definedKind
+		for _, dk := range pending {
+			ok, err := c.kindAvailable(dk)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				stillPending = append(stillPending, dk)
+			}
+		}
+		pending = stillPending
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			var kinds []string
+			for _, dk := range pending {
+				kinds = append(kinds, dk.groupVersion+", Kind="+dk.kind)
+			}
+			return fmt.Errorf("definitions not established after %s: %s", timeout, strings.Join(kinds, "; "))
+		}
+		time.Sleep(establishedPollInterval)
+	}
+}
+
+func (c *Cluster) kindAvailable(dk definedKind) (bool, error) {
+	resources, err := c.client.coreClient.Discovery().ServerResourcesForGroupVersion(dk.groupVersion)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if resources == nil {
+		return false, nil
+	}
+	for _, r := range resources.APIResources {
+		if r.Kind == dk.kind {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,94 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakekubernetes "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
+)
+
+const crdDef = `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  version: v1
+  names:
+    kind: Widget
+    plural: widgets
+`
+
+func TestWaitEstablished(t *testing.T) {
+	clientset := fakekubernetes.NewSimpleClientset()
+	c := NewCluster(clientset, nil, nil, nil, nil, log.NewNopLogger(), ClusterOptions{})
+	crd := rsc{"default:customresourcedefinition/widgets.example.com", []byte(crdDef)}
+
+	establishedPollInterval = time.Millisecond
+	if err := c.WaitEstablished([]resource.Resource{crd}, 10*time.Millisecond); err == nil {
+		t.Error("expected an error while the kind is not established")
+	}
+
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "example.com/v1",
+			APIResources: []meta_v1.APIResource{{Name: "widgets", Kind: "Widget"}},
+		},
+	}
+	if err := c.WaitEstablished([]resource.Resource{crd}, 10*time.Millisecond); err != nil {
+		t.Errorf("expected kind to be established, got %s", err)
+	}
+}
+
+// undefinedKindApplier fails to apply Widgets the first time, as
+// though the CRD defining them were not yet established.
+type undefinedKindApplier struct {
+	applied []string
+}
+
+func (a *undefinedKindApplier) apply(_ log.Logger, cs changeSet) cluster.SyncError {
+	var errs cluster.SyncError
+	for _, obj := range cs.objs["apply"] {
+		if obj.Kind == "Widget" && len(a.applied) == 0 {
+			errs = append(errs, cluster.ResourceError{Resource: obj.Resource, Error: errors.New(`no matches for kind "Widget" in version "example.com/v1"`)})
+			continue
+		}
+		a.applied = append(a.applied, obj.Metadata.Name)
+	}
+	return errs
+}
+
+func TestSyncRetriesUndefinedKinds(t *testing.T) {
+	clientset := fakekubernetes.NewSimpleClientset()
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "example.com/v1",
+			APIResources: []meta_v1.APIResource{{Name: "widgets", Kind: "Widget"}},
+		},
+	}
+	applier := &undefinedKindApplier{}
+	c := NewCluster(clientset, nil, nil, applier, nil, log.NewNopLogger(), ClusterOptions{})
+
+	crd := rsc{"default:customresourcedefinition/widgets.example.com", []byte(crdDef)}
+	widget := rsc{"default:widget/foo", []byte(`apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: foo
+`)}
+	err := c.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{{Apply: widget}, {Apply: crd}},
+	})
+	if err != nil {
+		t.Fatalf("expected widget to be applied on retry, got %s", err)
+	}
+	if len(applier.applied) != 2 || applier.applied[1] != "foo" {
+		t.Errorf("expected the CRD then the widget to be applied, got %v", applier.applied)
+	}
+}
@@ -0,0 +1,159 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// AnyKind can be given as the kind in an export kind, to mean every
+// kind in the API group.
+const AnyKind = "*"
+
+// ParseExportKinds parses kinds to export, each given as `Kind.group`
+// (e.g., `Certificate.certmanager.k8s.io`), `Kind` for the core API
+// group (e.g., `ConfigMap`), or `*.group` for all kinds in the group.
+func ParseExportKinds(kinds []string) ([]schema.GroupKind, error) {
+	var gks []schema.GroupKind
+	for _, k := range kinds {
+		var gk schema.GroupKind
+		if i := strings.Index(k, "."); i >= 0 {
+			gk = schema.GroupKind{Kind: k[:i], Group: k[i+1:]}
+		} else {
+			gk = schema.GroupKind{Kind: k}
+		}
+		if gk.Kind == "" || (gk.Kind == AnyKind && gk.Group == "") {
+			return nil, fmt.Errorf("invalid kind to export %q; expected e.g., Kind.group, or *.group", k)
+		}
+		gks = append(gks, gk)
+	}
+	return gks, nil
+}
+
+func (c *Cluster) exportsKind(gk schema.GroupKind) bool {
+	for _, e := range c.exportKinds {
+		if e.Group == gk.Group && (e.Kind == AnyKind || e.Kind == gk.Kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// exportOtherKinds appends the resources of the kinds given to the
+// cluster (other than the pod controllers, which are always
+// exported) to the buffer. The API resources are discovered, so these
+// can include custom resources.
+func (c *Cluster) exportOtherKinds(buffer *bytes.Buffer, namespaces []apiv1.Namespace) error {
+	if len(c.exportKinds) == 0 || c.client.dynamicClient == nil {
+		return nil
+	}
+
+	resourceLists, err := c.client.coreClient.Discovery().ServerPreferredResources()
+	if err != nil {
+		// Some API groups may not be served (e.g., if an aggregated
+		// API server is down); carry on with those that are.
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return errors.Wrap(err, "discovering API resources")
+		}
+		c.logger.Log("warning", "not all API groups could be discovered", "err", err)
+	}
+
+	for _, list := range resourceLists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return err
+		}
+		for _, apiResource := range list.APIResources {
+			if strings.Contains(apiResource.Name, "/") || !hasVerb(apiResource, "list") {
+				continue // a subresource, or not something we can list
+			}
+			if isExportedWorkload(schema.GroupKind{Group: gv.Group, Kind: apiResource.Kind}) {
+				continue // already exported
+			}
+			if !c.exportsKind(schema.GroupKind{Group: gv.Group, Kind: apiResource.Kind}) {
+				continue
+			}
+
+			resourceClient := c.client.dynamicClient.Resource(gv.WithResource(apiResource.Name))
+			var items []unstructured.Unstructured
+			if apiResource.Namespaced {
+				for _, ns := range namespaces {
+					objs, err := resourceClient.Namespace(ns.Name).List(meta_v1.ListOptions{})
+					if err != nil {
+						return errors.Wrapf(err, "listing %s in namespace %s", apiResource.Name, ns.Name)
+					}
+					items = append(items, objs.Items...)
+				}
+			} else {
+				objs, err := resourceClient.List(meta_v1.ListOptions{})
+				if err != nil {
+					return errors.Wrapf(err, "listing %s", apiResource.Name)
+				}
+				items = objs.Items
+			}
+
+			for i := range items {
+				if isAddon(&items[i]) {
+					continue
+				}
+				// The status is not part of the definition
+				unstructured.RemoveNestedField(items[i].Object, "status")
+				yamlBytes, err := k8syaml.Marshal(items[i].Object)
+				if err != nil {
+					return err
+				}
+				buffer.WriteString("---\n")
+				buffer.Write(yamlBytes)
+			}
+		}
+	}
+	return nil
+}
+
+// workloadGroups gives the API groups in which each of the built-in
+// workload kinds, by lower-cased kind, is exported by Export.
+var workloadGroups = map[string][]string{
+	"cronjob":          {"batch"},
+	"daemonset":        {"apps", "extensions"},
+	"deployment":       {"apps", "extensions"},
+	"deploymentconfig": {"apps.openshift.io"},
+	"statefulset":      {"apps"},
+	"fluxhelmrelease":  {"helm.integrations.flux.weave.works"},
+}
+
+// isExportedWorkload reports whether resources of the kind given are
+// already exported as workloads; a kind of the same name in another
+// API group isn't.
+func isExportedWorkload(gk schema.GroupKind) bool {
+	kind := strings.ToLower(gk.Kind)
+	rk, ok := resourceKinds[kind]
+	if !ok {
+		return false
+	}
+	if ck, ok := rk.(*customKind); ok {
+		return ck.group == gk.Group
+	}
+	for _, group := range workloadGroups[kind] {
+		if group == gk.Group {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVerb(r meta_v1.APIResource, verb string) bool {
+	for _, v := range r.Verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseExportKinds(t *testing.T) {
+	gks, err := ParseExportKinds([]string{"ConfigMap", "Certificate.certmanager.k8s.io", "*.helm.integrations.flux.weave.works"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []schema.GroupKind{
+		{Kind: "ConfigMap"},
+		{Kind: "Certificate", Group: "certmanager.k8s.io"},
+		{Kind: "*", Group: "helm.integrations.flux.weave.works"},
+	}
+	if !reflect.DeepEqual(gks, expected) {
+		t.Errorf("expected %v, got %v", expected, gks)
+	}
+
+	for _, bad := range []string{"*", ".apps"} {
+		if _, err := ParseExportKinds([]string{bad}); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestExportsKind(t *testing.T) {
+	kinds, err := ParseExportKinds([]string{"ConfigMap", "*.certmanager.k8s.io"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Cluster{exportKinds: kinds}
+	for gk, expected := range map[schema.GroupKind]bool{
+		{Kind: "ConfigMap"}:                                true,
+		{Kind: "Secret"}:                                   false,
+		{Kind: "ConfigMap", Group: "example.com"}:          false,
+		{Kind: "Certificate", Group: "certmanager.k8s.io"}: true,
+		{Kind: "Issuer", Group: "certmanager.k8s.io"}:      true,
+		{Kind: "Certificate", Group: "cert.example.com"}:   false,
+	} {
+		if c.exportsKind(gk) != expected {
+			t.Errorf("expected exportsKind(%v) to be %v", gk, expected)
+		}
+	}
+}
+
+func TestIsExportedWorkload(t *testing.T) {
+	for gk, expected := range map[schema.GroupKind]bool{
+		{Kind: "Deployment", Group: "apps"}:              true,
+		{Kind: "Deployment", Group: "extensions"}:        true,
+		{Kind: "CronJob", Group: "batch"}:                true,
+		{Kind: "Deployment", Group: "example.com"}:       false,
+		{Kind: "DeploymentConfig", Group: "example.com"}: false,
+		{Kind: "ConfigMap"}:                              false,
+	} {
+		if isExportedWorkload(gk) != expected {
+			t.Errorf("expected isExportedWorkload(%v) to be %v", gk, expected)
+		}
+	}
+}
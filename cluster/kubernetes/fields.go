@@ -0,0 +1,210 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// FieldPath is the path to a field in a manifest, e.g.,
+// `spec.replicas` is FieldPath{"spec", "replicas"}.
+type FieldPath []string
+
+// ParseFieldPath parses a path given with its elements separated by
+// dots. A dot in an element, e.g., in the key of an annotation, is
+// escaped with a backslash: `metadata.annotations.sidecar\.istio\.io/status`.
+func ParseFieldPath(s string) (FieldPath, error) {
+	var path FieldPath
+	var elem []rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			elem = append(elem, r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '.':
+			path = append(path, string(elem))
+			elem = nil
+		default:
+			elem = append(elem, r)
+		}
+	}
+	path = append(path, string(elem))
+	for _, e := range path {
+		if e == "" {
+			return nil, fmt.Errorf("field path %q has an empty element", s)
+		}
+	}
+	return path, nil
+}
+
+func (p FieldPath) String() string {
+	elems := make([]string, len(p))
+	for i, e := range p {
+		elems[i] = strings.Replace(e, ".", `\.`, -1)
+	}
+	return strings.Join(elems, ".")
+}
+
+// IgnoredField is a field that's left out of manifests when they are
+// applied, because something else in the cluster looks after it;
+// e.g., an annotation added by an admission controller, or a field
+// the API server fills in with a default.
+type IgnoredField struct {
+	Kind string // the kind of resource it's ignored in, or empty for all kinds
+	Path FieldPath
+}
+
+// ParseIgnoredField parses a field given as `[Kind:]path`, e.g.,
+// `Deployment:spec.template.metadata.annotations`; the path is as for
+// ParseFieldPath.
+func ParseIgnoredField(s string) (IgnoredField, error) {
+	var f IgnoredField
+	path := s
+	// A kind can't contain a dot, but a path element might contain a
+	// colon
+	if i := strings.Index(s, ":"); i > 0 && !strings.ContainsAny(s[:i], `.\`) {
+		f.Kind, path = s[:i], s[i+1:]
+	}
+	p, err := ParseFieldPath(path)
+	if err != nil {
+		return f, err
+	}
+	f.Path = p
+	return f, nil
+}
+
+// prunedResource is a resource with fields removed from its
+// definition, so that applying it won't undo changes other
+// controllers have made to those fields.
+type prunedResource struct {
+	resource.Resource
+	bytes  []byte
+	fields []FieldPath
+}
+
+func (r prunedResource) Bytes() []byte {
+	return r.bytes
+}
+
+func (r prunedResource) SourceLine() int {
+	return resource.SourceLine(r.Resource)
+}
+
+// IgnoredFields gives the fields that were removed, or would have
+// been had they been there. These are to be left alone in the
+// cluster, rather than removed because they were last applied and
+// are now missing.
+func (r prunedResource) IgnoredFields() []FieldPath {
+	return r.fields
+}
+
+// ignoredFielder is implemented by resources that have had fields
+// removed before being applied.
+type ignoredFielder interface {
+	IgnoredFields() []FieldPath
+}
+
+// withoutIgnoredFields returns the resource to apply for the object
+// given. Usually that's just the object's resource; but if any
+// fields are to be ignored -- `spec.replicas` if the workload is the
+// target of an autoscaler, the fields ignored for every resource of
+// its kind, and any named in its `ignore_fields` annotation -- it's
+// the resource without those fields. The scaling for each namespace
+// is looked up at most once, and kept in `scalings`.
+func (c *Cluster) withoutIgnoredFields(logger log.Logger, obj *apiObject, scalings map[string]scaling) resource.Resource {
+	var fields []FieldPath
+	if c.autoscaled(logger, obj, scalings) {
+		fields = append(fields, FieldPath{"spec", "replicas"})
+	}
+	for _, f := range c.IgnoreFields {
+		if f.Kind == "" || strings.EqualFold(f.Kind, obj.Kind) {
+			fields = append(fields, f.Path)
+		}
+	}
+	if value, ok := obj.Policy().Get(policy.IgnoreFields); ok {
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			path, err := ParseFieldPath(s)
+			if err != nil {
+				logger.Log("warning", "ignoring invalid field in annotation", "resource", obj.ResourceID(), "err", err)
+				continue
+			}
+			fields = append(fields, path)
+		}
+	}
+	if len(fields) == 0 {
+		return obj.Resource
+	}
+	def, err := withoutFields(obj.Resource.Bytes(), fields)
+	if err != nil {
+		return obj.Resource
+	}
+	return prunedResource{Resource: obj.Resource, bytes: def, fields: fields}
+}
+
+// withoutFields returns the definition given, less the fields at the
+// paths given, if they are there. The order of the remaining fields
+// is kept.
+func withoutFields(def []byte, fields []FieldPath) ([]byte, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(def, &doc); err != nil {
+		return nil, err
+	}
+	removed := false
+	for _, path := range fields {
+		var ok bool
+		if doc, ok = removeField(doc, path); ok {
+			removed = true
+		}
+	}
+	if !removed {
+		return def, nil
+	}
+	return yaml.Marshal(doc)
+}
+
+// removeField removes the field at the path from the map given,
+// reporting whether it was there.
+func removeField(m yaml.MapSlice, path FieldPath) (yaml.MapSlice, bool) {
+	for i, item := range m {
+		if key, ok := item.Key.(string); !ok || key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(m[:i:i], m[i+1:]...), true
+		}
+		inner, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return m, false
+		}
+		inner, removed := removeField(inner, path[1:])
+		m[i].Value = inner
+		return m, removed
+	}
+	return m, false
+}
+
+// withoutFieldsJSON is withoutFields for JSON, e.g., the configuration
+// last applied, as recorded in the annotation.
+func withoutFieldsJSON(def []byte, fields []FieldPath) ([]byte, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(def, &obj); err != nil {
+		return nil, err
+	}
+	for _, path := range fields {
+		unstructured.RemoveNestedField(obj, path...)
+	}
+	return json.Marshal(obj)
+}
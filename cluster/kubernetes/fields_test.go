@@ -0,0 +1,152 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/policy"
+)
+
+func TestParseIgnoredField(t *testing.T) {
+	for in, want := range map[string]IgnoredField{
+		"spec.replicas":            {Path: FieldPath{"spec", "replicas"}},
+		"Deployment:spec.replicas": {Kind: "Deployment", Path: FieldPath{"spec", "replicas"}},
+		`metadata.annotations.sidecar\.istio\.io/status`: {
+			Path: FieldPath{"metadata", "annotations", "sidecar.istio.io/status"},
+		},
+		`metadata.annotations.example\.com:thing`: {
+			Path: FieldPath{"metadata", "annotations", "example.com:thing"},
+		},
+	} {
+		got, err := ParseIgnoredField(in)
+		if assert.NoError(t, err, in) {
+			assert.Equal(t, want, got, in)
+		}
+	}
+	for _, in := range []string{"", "spec..replicas", "Deployment:", "spec.replicas."} {
+		_, err := ParseIgnoredField(in)
+		assert.Error(t, err, in)
+	}
+
+	path := FieldPath{"metadata", "annotations", "sidecar.istio.io/status"}
+	assert.Equal(t, `metadata.annotations.sidecar\.istio\.io/status`, path.String())
+}
+
+// policyRsc is a resource with policies, as though from annotations.
+type policyRsc struct {
+	rsc
+	policies policy.Set
+}
+
+func (r policyRsc) Policy() policy.Set {
+	return r.policies
+}
+
+func TestSyncIgnoredFields(t *testing.T) {
+	applier := &bytesApplier{}
+	c := NewCluster(scaledClientset(), nil, nil, applier, nil, log.NewNopLogger(), ClusterOptions{})
+	c.IgnoreFields = []IgnoredField{
+		{Kind: "Deployment", Path: FieldPath{"spec", "template", "metadata", "annotations", "sidecar.istio.io/status"}},
+	}
+	const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: other
+spec:
+  paused: false
+  replicas: 2
+  template:
+    metadata:
+      annotations:
+        sidecar.istio.io/status: injected
+        kept: "true"
+`
+	const configMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  annotations:
+    sidecar.istio.io/status: kept
+`
+	err := c.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{Apply: policyRsc{
+				rsc:      rsc{"default:deployment/other", []byte(deployment)},
+				policies: policy.Set{policy.IgnoreFields: "spec.paused, spec.minReadySeconds"},
+			}},
+			{Apply: rsc{"default:configmap/config", []byte(configMap)}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := applier.applied["other"]
+	for _, removed := range []string{"paused", "sidecar.istio.io/status"} {
+		if strings.Contains(def, removed) {
+			t.Errorf("expected %s to be removed, got:\n%s", removed, def)
+		}
+	}
+	for _, kept := range []string{"replicas: 2", "kept:"} {
+		if !strings.Contains(def, kept) {
+			t.Errorf("expected %q to be kept, got:\n%s", kept, def)
+		}
+	}
+	if def := applier.applied["config"]; def != configMap {
+		t.Errorf("expected a ConfigMap to be applied as it is, got:\n%s", def)
+	}
+}
+
+func TestClientApplierLeavesIgnoredFields(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("v1")
+	existing.SetKind("ConfigMap")
+	existing.SetNamespace("test")
+	existing.SetName("config")
+	existing.SetAnnotations(map[string]string{
+		apiv1.LastAppliedConfigAnnotation: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config","namespace":"test"},"data":{"kept":"value","managed":"value","removed":"value"}}`,
+	})
+	unstructured.SetNestedStringMap(existing.Object, map[string]string{
+		"kept":    "value",
+		"managed": "changed elsewhere",
+		"removed": "value",
+	}, "data")
+
+	applier, client := setupClientApplier(t, existing)
+	obj := makeApplyObj(t, "test:configmap/config", configMapDef)
+	obj.Resource = prunedResource{
+		Resource: obj.Resource,
+		bytes:    obj.Bytes(),
+		fields:   []FieldPath{{"data", "managed"}},
+	}
+	cs := makeChangeSet()
+	cs.stage("apply", obj)
+	if errs := applier.apply(log.NewNopLogger(), cs); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	var patch []byte
+	for _, action := range client.Actions() {
+		if p, ok := action.(k8stesting.PatchAction); ok {
+			patch = p.GetPatch()
+		}
+	}
+	var patchMap map[string]interface{}
+	if err := json.Unmarshal(patch, &patchMap); err != nil {
+		t.Fatalf("expected a JSON patch, got %q", string(patch))
+	}
+	data := patchMap["data"].(map[string]interface{})
+	if _, ok := data["managed"]; ok {
+		t.Errorf("expected patch to leave alone the ignored field, got %s", string(patch))
+	}
+	if v, ok := data["removed"]; !ok || v != nil {
+		t.Errorf("expected patch to remove the entry no longer in the manifest, got %s", string(patch))
+	}
+}
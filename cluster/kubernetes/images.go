@@ -2,19 +2,28 @@ package kubernetes
 
 import (
 	"fmt"
+	"reflect"
+	"sync/atomic"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 	apiv1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/registry"
 )
 
-func mergeCredentials(log func(...interface{}) error, client extendedClient, namespace string, podTemplate apiv1.PodTemplateSpec, imageCreds registry.ImageCreds, seenCreds map[string]registry.Credentials) {
+func mergeCredentials(log func(...interface{}) error, client extendedClient, namespace string, podTemplate apiv1.PodTemplateSpec, imageCreds registry.ImageCreds, seenCreds map[string]registry.Credentials, seenServiceAccounts map[string][]string) {
 	creds := registry.NoCredentials()
 	var imagePullSecrets []string
 	saName := podTemplate.Spec.ServiceAccountName
@@ -22,12 +31,20 @@ func mergeCredentials(log func(...interface{}) error, client extendedClient, nam
 		saName = "default"
 	}
 
-	sa, err := client.CoreV1().ServiceAccounts(namespace).Get(saName, meta_v1.GetOptions{})
-	if err == nil {
-		for _, ips := range sa.ImagePullSecrets {
-			imagePullSecrets = append(imagePullSecrets, ips.Name)
+	// Service accounts are usually shared by many workloads, so
+	// remember their image pull secrets, as with the secrets'
+	// credentials.
+	if _, ok := seenServiceAccounts[saName]; !ok {
+		var names []string
+		sa, err := client.CoreV1().ServiceAccounts(namespace).Get(saName, meta_v1.GetOptions{})
+		if err == nil {
+			for _, ips := range sa.ImagePullSecrets {
+				names = append(names, ips.Name)
+			}
 		}
+		seenServiceAccounts[saName] = names
 	}
+	imagePullSecrets = append(imagePullSecrets, seenServiceAccounts[saName]...)
 
 	for _, imagePullSecret := range podTemplate.Spec.ImagePullSecrets {
 		imagePullSecrets = append(imagePullSecrets, imagePullSecret.Name)
@@ -80,20 +97,33 @@ func mergeCredentials(log func(...interface{}) error, client extendedClient, nam
 		creds.Merge(crd)
 	}
 
-	// Now create the service and attach the credentials
-	for _, container := range podTemplate.Spec.Containers {
+	// Now create the service and attach the credentials; init
+	// containers are included, since their images can be updated too.
+	containers := append([]apiv1.Container{}, podTemplate.Spec.Containers...)
+	containers = append(containers, podTemplate.Spec.InitContainers...)
+	for _, container := range containers {
 		r, err := image.ParseRef(container.Image)
 		if err != nil {
 			log("err", err.Error())
 			continue
 		}
-		imageCreds[r.Name] = creds
+		// Another workload may use the same image, with other
+		// credentials; use those too.
+		if existing, ok := imageCreds[r.Name]; ok {
+			merged := registry.NoCredentials()
+			merged.Merge(existing)
+			merged.Merge(creds)
+			imageCreds[r.Name] = merged
+		} else {
+			imageCreds[r.Name] = creds
+		}
 	}
 }
 
 // ImagesToFetch is a k8s specific method to get a list of images to update along with their credentials
 func (c *Cluster) ImagesToFetch() registry.ImageCreds {
 	allImageCreds := make(registry.ImageCreds)
+	automatedImages := map[image.Name]bool{}
 
 	namespaces, err := c.getAllowedNamespaces()
 	if err != nil {
@@ -103,8 +133,9 @@ func (c *Cluster) ImagesToFetch() registry.ImageCreds {
 
 	for _, ns := range namespaces {
 		seenCreds := make(map[string]registry.Credentials)
+		seenServiceAccounts := make(map[string][]string)
 		for kind, resourceKind := range resourceKinds {
-			podControllers, err := resourceKind.getPodControllers(c, ns.Name)
+			podControllers, err := c.podControllers(kind, resourceKind, ns.Name)
 			if err != nil {
 				if se, ok := err.(*apierrors.StatusError); ok && se.ErrStatus.Reason == meta_v1.StatusReasonNotFound {
 					// Kind not supported by API server, skip
@@ -116,21 +147,151 @@ func (c *Cluster) ImagesToFetch() registry.ImageCreds {
 
 			imageCreds := make(registry.ImageCreds)
 			for _, podController := range podControllers {
+				if podController.GetAnnotations()[kresource.PolicyPrefix+string(policy.ScanImages)] == "false" {
+					continue
+				}
+				if podController.GetAnnotations()[kresource.PolicyPrefix+string(policy.Automated)] == "true" {
+					containers := append([]apiv1.Container{}, podController.podTemplate.Spec.Containers...)
+					for _, container := range append(containers, podController.podTemplate.Spec.InitContainers...) {
+						if r, err := image.ParseRef(container.Image); err == nil {
+							automatedImages[r.Name] = true
+						}
+					}
+				}
 				logger := log.With(c.logger, "resource", flux.MakeResourceID(ns.Name, kind, podController.name))
-				mergeCredentials(logger.Log, c.client, ns.Name, podController.podTemplate, imageCreds, seenCreds)
+				mergeCredentials(logger.Log, c.client, ns.Name, podController.podTemplate, imageCreds, seenCreds, seenServiceAccounts)
 			}
 
-			// Merge creds
+			// Merge creds. The credentials for an image may be shared
+			// with other images from the same pod spec, so merge
+			// into a copy rather than changing them in place; that
+			// way, each image gets one set of credentials per
+			// registry host, from the workloads that use it.
 			for imageID, creds := range imageCreds {
-				existingCreds, ok := allImageCreds[imageID]
-				if ok {
-					existingCreds.Merge(creds)
-				} else {
-					allImageCreds[imageID] = creds
+				merged := registry.NoCredentials()
+				if existingCreds, ok := allImageCreds[imageID]; ok {
+					merged.Merge(existingCreds)
 				}
+				merged.Merge(creds)
+				allImageCreds[imageID] = merged
 			}
 		}
 	}
 
+	c.automatedImagesMu.Lock()
+	c.automatedImages = automatedImages
+	c.automatedImagesMu.Unlock()
 	return allImageCreds
 }
+
+// UsedByAutomated reports whether an image is used by an automated
+// workload, as of the last time ImagesToFetch was called. These
+// images are worth refreshing before others, since new images for
+// them are released straight away.
+func (c *Cluster) UsedByAutomated(name image.Name) bool {
+	c.automatedImagesMu.Lock()
+	defer c.automatedImagesMu.Unlock()
+	return c.automatedImages[name]
+}
+
+// WatchImageCredentials calls changed whenever something that
+// ImagesToFetch gets registry credentials from -- an image pull
+// secret, or the image pull secrets listed by a service account --
+// is created, changed or deleted, until stop is closed. This means
+// credentials can be picked up without waiting for the next time
+// all the images are scanned.
+func (c *Cluster) WatchImageCredentials(stop <-chan struct{}, changed func()) {
+	core := c.client.CoreV1()
+	for _, ns := range c.watchedNamespaces() {
+		ns := ns
+		for _, watched := range []struct {
+			obj runtime.Object
+			lw  *cache.ListWatch
+		}{
+			{&apiv1.Secret{}, secretsOfType(core, ns, apiv1.SecretTypeDockerConfigJson)},
+			{&apiv1.Secret{}, secretsOfType(core, ns, apiv1.SecretTypeDockercfg)},
+			{&apiv1.ServiceAccount{}, &cache.ListWatch{
+				ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+					return core.ServiceAccounts(ns).List(options)
+				},
+				WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+					return core.ServiceAccounts(ns).Watch(options)
+				},
+			}},
+		} {
+			// The objects already there are added when the informer
+			// starts; these aren't changes.
+			var synced int32
+			notify := func(obj interface{}) {
+				if atomic.LoadInt32(&synced) == 1 && c.affectsImageCredentials(obj) {
+					changed()
+				}
+			}
+			_, controller := cache.NewInformer(watched.lw, watched.obj, 0, cache.ResourceEventHandlerFuncs{
+				AddFunc: notify,
+				UpdateFunc: func(old, new interface{}) {
+					if imageCredentialsChanged(old, new) {
+						notify(new)
+					}
+				},
+				DeleteFunc: func(obj interface{}) {
+					if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+						obj = tombstone.Obj
+					}
+					notify(obj)
+				},
+			})
+			go controller.Run(stop)
+			go func() {
+				if cache.WaitForCacheSync(stop, controller.HasSynced) {
+					atomic.StoreInt32(&synced, 1)
+				}
+			}()
+		}
+	}
+}
+
+// secretsOfType lists and watches only the secrets of the given type
+// in the namespace, so that the informer doesn't keep a copy of every
+// secret (field selectors can't say "either type", hence one for
+// each).
+func secretsOfType(core typedcorev1.CoreV1Interface, ns string, secretType apiv1.SecretType) *cache.ListWatch {
+	selector := fields.OneTermEqualSelector("type", string(secretType)).String()
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return core.Secrets(ns).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return core.Secrets(ns).Watch(options)
+		},
+	}
+}
+
+// affectsImageCredentials reports whether the object is an image
+// pull secret or a service account, in an allowed namespace.
+func (c *Cluster) affectsImageCredentials(obj interface{}) bool {
+	switch o := obj.(type) {
+	case *apiv1.Secret:
+		return (o.Type == apiv1.SecretTypeDockercfg || o.Type == apiv1.SecretTypeDockerConfigJson) &&
+			c.namespaceAllowed(o.Namespace)
+	case *apiv1.ServiceAccount:
+		return c.namespaceAllowed(o.Namespace)
+	}
+	return false
+}
+
+// imageCredentialsChanged reports whether an update to a secret or
+// service account could change the credentials it gives.
+func imageCredentialsChanged(old, new interface{}) bool {
+	switch n := new.(type) {
+	case *apiv1.Secret:
+		o, ok := old.(*apiv1.Secret)
+		return !ok || o.Type != n.Type || !reflect.DeepEqual(o.Data, n.Data)
+	case *apiv1.ServiceAccount:
+		o, ok := old.(*apiv1.ServiceAccount)
+		return !ok || !reflect.DeepEqual(o.ImagePullSecrets, n.ImagePullSecrets)
+	}
+	return false
+}
@@ -3,12 +3,18 @@ package kubernetes
 import (
 	"encoding/base64"
 	"testing"
+	"time"
 
+	"github.com/go-kit/kit/log"
 	"github.com/stretchr/testify/assert"
+	apiapps "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 
 	"github.com/weaveworks/flux/image"
+	fhrfake "github.com/weaveworks/flux/integrations/client/clientset/versioned/fake"
 	"github.com/weaveworks/flux/registry"
 )
 
@@ -63,10 +69,10 @@ func TestMergeCredentials(t *testing.T) {
 		makeServiceAccount(ns, saName, []string{secretName2}),
 		makeImagePullSecret(ns, secretName1, "docker.io"),
 		makeImagePullSecret(ns, secretName2, "quay.io"))
-	client := extendedClient{clientset, nil}
+	client := extendedClient{clientset, nil, nil}
 
 	creds := registry.ImageCreds{}
-	mergeCredentials(noopLog, client, ns, spec, creds, make(map[string]registry.Credentials))
+	mergeCredentials(noopLog, client, ns, spec, creds, make(map[string]registry.Credentials), make(map[string][]string))
 
 	// check that we accumulated some credentials
 	assert.Contains(t, creds, ref.Name)
@@ -74,3 +80,168 @@ func TestMergeCredentials(t *testing.T) {
 	hosts := c.Hosts()
 	assert.ElementsMatch(t, []string{"docker.io", "quay.io"}, hosts)
 }
+
+func TestMergeCredentials_InitContainers(t *testing.T) {
+	ns, secretName := "foo-ns", "secret-creds"
+	ref, _ := image.ParseRef("foo/bar:tag")
+	initRef, _ := image.ParseRef("foo/init:tag")
+	spec := apiv1.PodTemplateSpec{
+		Spec: apiv1.PodSpec{
+			ImagePullSecrets: []apiv1.LocalObjectReference{
+				{Name: secretName},
+			},
+			Containers: []apiv1.Container{
+				{Name: "container1", Image: ref.String()},
+			},
+			InitContainers: []apiv1.Container{
+				{Name: "init1", Image: initRef.String()},
+			},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(
+		makeServiceAccount(ns, "default", nil),
+		makeImagePullSecret(ns, secretName, "docker.io"))
+	client := extendedClient{clientset, nil, nil}
+
+	creds := registry.ImageCreds{}
+	mergeCredentials(noopLog, client, ns, spec, creds, make(map[string]registry.Credentials), make(map[string][]string))
+
+	// the init container's image should be fetched, with the same
+	// credentials as the other containers
+	assert.Contains(t, creds, initRef.Name)
+	assert.ElementsMatch(t, []string{"docker.io"}, creds[initRef.Name].Hosts())
+}
+
+func makeDeployment(ns, name string, imagePullSecretNames []string, images ...string) *apiapps.Deployment {
+	replicas := int32(1)
+	d := apiapps.Deployment{ObjectMeta: meta_v1.ObjectMeta{Namespace: ns, Name: name}}
+	d.Spec.Replicas = &replicas
+	for _, ips := range imagePullSecretNames {
+		d.Spec.Template.Spec.ImagePullSecrets = append(d.Spec.Template.Spec.ImagePullSecrets, apiv1.LocalObjectReference{Name: ips})
+	}
+	for _, image := range images {
+		d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, apiv1.Container{Image: image})
+	}
+	return &d
+}
+
+func TestImagesToFetch_SharedCredentials(t *testing.T) {
+	ns := "foo-ns"
+	clientset := fake.NewSimpleClientset(
+		&apiv1.Namespace{ObjectMeta: meta_v1.ObjectMeta{Name: ns}},
+		makeServiceAccount(ns, "default", []string{"sa-creds"}),
+		makeImagePullSecret(ns, "sa-creds", "quay.io"),
+		makeImagePullSecret(ns, "other-creds", "docker.io"),
+		makeDeployment(ns, "both", []string{"other-creds"}, "foo/bar:tag", "quay.io/foo/baz:tag"),
+		makeDeployment(ns, "one", nil, "foo/bar:tag"),
+	)
+	c := NewCluster(clientset, fhrfake.NewSimpleClientset(), nil, nil, nil, log.NewNopLogger(), ClusterOptions{})
+
+	creds := c.ImagesToFetch()
+	bar, _ := image.ParseRef("foo/bar:tag")
+	baz, _ := image.ParseRef("quay.io/foo/baz:tag")
+	assert.ElementsMatch(t, []string{"docker.io", "quay.io"}, creds[bar.Name].Hosts())
+	// Merging the credentials for foo/bar must not give another
+	// image's credentials more hosts
+	assert.ElementsMatch(t, []string{"docker.io", "quay.io"}, creds[baz.Name].Hosts())
+}
+
+func TestWatchImageCredentials(t *testing.T) {
+	ns := "foo-ns"
+	clientset := fake.NewSimpleClientset(makeImagePullSecret(ns, "existing", "docker.io"))
+	// The fake clientset only sends events to watches on the
+	// namespace of the object, so restrict the namespaces watched
+	c := NewCluster(clientset, nil, nil, nil, nil, log.NewNopLogger(), ClusterOptions{AllowedNamespaces: []string{ns}})
+
+	changed := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+	c.WatchImageCredentials(stop, func() { changed <- struct{}{} })
+
+	expect := func(expected bool, msg string) {
+		select {
+		case <-changed:
+			if !expected {
+				t.Errorf("did not expect a change: %s", msg)
+			}
+			// The fake clientset doesn't apply field selectors,
+			// so each of the secret informers may see the change
+			for drained := false; !drained; {
+				select {
+				case <-changed:
+				case <-time.After(50 * time.Millisecond):
+					drained = true
+				}
+			}
+		case <-time.After(200 * time.Millisecond):
+			if expected {
+				t.Errorf("expected a change: %s", msg)
+			}
+		}
+	}
+	// The secrets already there don't count as changes
+	expect(false, "existing secret")
+
+	opaque := &apiv1.Secret{Type: apiv1.SecretTypeOpaque}
+	opaque.Name, opaque.Namespace = "opaque", ns
+	clientset.CoreV1().Secrets(ns).Create(opaque)
+	expect(false, "opaque secret")
+
+	clientset.CoreV1().Secrets("other-ns").Create(makeImagePullSecret("other-ns", "new", "quay.io"))
+	expect(false, "secret in another namespace")
+
+	clientset.CoreV1().Secrets(ns).Create(makeImagePullSecret(ns, "new", "quay.io"))
+	expect(true, "new image pull secret")
+
+	clientset.CoreV1().ServiceAccounts(ns).Create(makeServiceAccount(ns, "default", []string{"new"}))
+	expect(true, "new service account")
+
+	// Only image pull secrets are asked for
+	var selectors []string
+	for _, action := range clientset.Actions() {
+		if list, ok := action.(k8stesting.ListAction); ok && action.GetResource().Resource == "secrets" {
+			selectors = append(selectors, list.GetListRestrictions().Fields.String())
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"type=" + string(apiv1.SecretTypeDockerConfigJson),
+		"type=" + string(apiv1.SecretTypeDockercfg),
+	}, selectors)
+}
+
+func TestImagesToFetch_ScanImagesPolicy(t *testing.T) {
+	ns := "foo-ns"
+	skipped := makeDeployment(ns, "skipped", nil, "k8s.gcr.io/pause:3.1", "foo/bar:tag")
+	skipped.Annotations = map[string]string{"flux.weave.works/scan_images": "false"}
+	clientset := fake.NewSimpleClientset(
+		&apiv1.Namespace{ObjectMeta: meta_v1.ObjectMeta{Name: ns}},
+		skipped,
+		makeDeployment(ns, "scanned", nil, "foo/bar:tag"),
+	)
+	c := NewCluster(clientset, fhrfake.NewSimpleClientset(), nil, nil, nil, log.NewNopLogger(), ClusterOptions{})
+
+	creds := c.ImagesToFetch()
+	pause, _ := image.ParseRef("k8s.gcr.io/pause:3.1")
+	bar, _ := image.ParseRef("foo/bar:tag")
+	assert.NotContains(t, creds, pause.Name)
+	assert.Contains(t, creds, bar.Name)
+}
+
+func TestImagesToFetch_UsedByAutomated(t *testing.T) {
+	ns := "foo-ns"
+	automated := makeDeployment(ns, "automated", nil, "foo/bar:tag")
+	automated.Annotations = map[string]string{"flux.weave.works/automated": "true"}
+	clientset := fake.NewSimpleClientset(
+		&apiv1.Namespace{ObjectMeta: meta_v1.ObjectMeta{Name: ns}},
+		automated,
+		makeDeployment(ns, "manual", nil, "foo/baz:tag"),
+	)
+	c := NewCluster(clientset, fhrfake.NewSimpleClientset(), nil, nil, nil, log.NewNopLogger(), ClusterOptions{})
+
+	c.ImagesToFetch()
+	bar, _ := image.ParseRef("foo/bar:tag")
+	baz, _ := image.ParseRef("foo/baz:tag")
+	assert.True(t, c.UsedByAutomated(bar.Name))
+	assert.False(t, c.UsedByAutomated(baz.Name))
+}
@@ -3,7 +3,9 @@ package kubernetes
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	k8syaml "github.com/ghodss/yaml"
 	"github.com/go-kit/kit/log"
@@ -12,34 +14,44 @@ import (
 	"gopkg.in/yaml.v2"
 	apiv1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	k8sclient "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/ssh"
 )
 
 const (
-	StatusUnknown  = "unknown"
-	StatusReady    = "ready"
-	StatusUpdating = "updating"
+	StatusUnknown  = cluster.StatusUnknown
+	StatusReady    = cluster.StatusReady
+	StatusUpdating = cluster.StatusUpdating
+	StatusError    = cluster.StatusError
 )
 
 type coreClient k8sclient.Interface
 type fluxHelmClient fhrclient.Interface
+type dynamicClient dynamic.Interface
 
 type extendedClient struct {
 	coreClient
 	fluxHelmClient
+	dynamicClient
 }
 
 // --- internal types for keeping track of syncing
 
 type metadata struct {
-	Name      string `yaml:"name"`
-	Namespace string `yaml:"namespace"`
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace"`
+	Labels    map[string]string `yaml:"labels"`
 }
 
 type apiObject struct {
@@ -104,28 +116,79 @@ type Cluster struct {
 
 	nsWhitelist       []string
 	nsWhitelistLogged map[string]bool // to keep track of whether we've logged a problem with seeing a whitelisted ns
+	nsExcluded        []string
+	syncSelector      labels.Selector    // if non-nil, only resources matching this are synced
+	exportKinds       []schema.GroupKind // kinds to export, besides pod controllers
+
+	// IgnoreFields are left out of resources when they're applied,
+	// and left alone in the cluster, since something else looks after
+	// them.
+	IgnoreFields []IgnoredField
+	// SubstituteFrom are the ConfigMaps and Secrets from which to
+	// take the values of variables in the manifests of resources
+	// with the `substitute` policy.
+	SubstituteFrom []VarSource
+
+	// The workloads kept in memory, by kind then namespace, if
+	// StartWorkloadCache has been called
+	workloadsMu sync.RWMutex
+	workloads   map[string]map[string]workloadInformer
+
+	// For finding the resources of custom kinds of workload; made
+	// when first needed
+	mapperOnce      sync.Once
+	mapper          *restmapper.DeferredDiscoveryRESTMapper
+	mapperMu        sync.Mutex
+	mapperRefreshed time.Time
+
+	automatedImagesMu sync.Mutex
+	automatedImages   map[image.Name]bool // images used by automated workloads, as of the last ImagesToFetch
 
 	mu sync.Mutex
 }
 
+// ClusterOptions gives the optional configuration of a Cluster. The
+// zero value is a cluster that lists, exports and applies resources
+// in all namespaces.
+type ClusterOptions struct {
+	// AllowedNamespaces, if not empty, restricts the namespaces
+	// resources are listed, exported and applied in to those given
+	AllowedNamespaces []string
+	// ExcludedNamespaces are namespaces resources are never listed,
+	// exported or applied in; these take precedence over
+	// AllowedNamespaces
+	ExcludedNamespaces []string
+	// SyncSelector, if not nil, restricts the resources applied to
+	// those with matching labels
+	SyncSelector labels.Selector
+	// ExportKinds are kinds exported in addition to the workloads,
+	// e.g., custom resources
+	ExportKinds []schema.GroupKind
+}
+
 // NewCluster returns a usable cluster.
 func NewCluster(clientset k8sclient.Interface,
 	fluxHelmClientset fhrclient.Interface,
+	dynamicClientset dynamic.Interface,
 	applier Applier,
 	sshKeyRing ssh.KeyRing,
 	logger log.Logger,
-	nsWhitelist []string) *Cluster {
+	opts ClusterOptions) *Cluster {
 
 	c := &Cluster{
 		client: extendedClient{
 			clientset,
 			fluxHelmClientset,
+			dynamicClientset,
 		},
 		applier:           applier,
 		logger:            logger,
 		sshKeyRing:        sshKeyRing,
-		nsWhitelist:       nsWhitelist,
+		nsWhitelist:       opts.AllowedNamespaces,
 		nsWhitelistLogged: map[string]bool{},
+		nsExcluded:        opts.ExcludedNamespaces,
+		syncSelector:      opts.SyncSelector,
+		exportKinds:       opts.ExportKinds,
 	}
 
 	return c
@@ -138,21 +201,32 @@ func NewCluster(clientset k8sclient.Interface,
 // in the order requested.
 func (c *Cluster) SomeControllers(ids []flux.ResourceID) (res []cluster.Controller, err error) {
 	var controllers []cluster.Controller
+	scalings := map[string]scaling{}
 	for _, id := range ids {
 		ns, kind, name := id.Components()
+		if !c.namespaceAllowed(ns) {
+			continue
+		}
 
 		resourceKind, ok := resourceKinds[kind]
 		if !ok {
 			return nil, fmt.Errorf("Unsupported kind %v", kind)
 		}
 
-		podController, err := resourceKind.getPodController(c, ns, name)
+		podController, err := c.podController(kind, resourceKind, ns, name)
 		if err != nil {
 			return nil, err
 		}
 
 		if !isAddon(podController) {
-			controllers = append(controllers, podController.toClusterController(id))
+			s, ok := scalings[ns]
+			if !ok {
+				s = c.getScalingOrWarn(ns)
+				scalings[ns] = s
+			}
+			controller := podController.toClusterController(id)
+			s.annotate(&controller, podController)
+			controllers = append(controllers, controller)
 		}
 	}
 	return controllers, nil
@@ -172,8 +246,10 @@ func (c *Cluster) AllControllers(namespace string) (res []cluster.Controller, er
 			continue
 		}
 
+		s := c.getScalingOrWarn(ns.Name)
+
 		for kind, resourceKind := range resourceKinds {
-			podControllers, err := resourceKind.getPodControllers(c, ns.Name)
+			podControllers, err := c.podControllers(kind, resourceKind, ns.Name)
 			if err != nil {
 				if se, ok := err.(*apierrors.StatusError); ok && se.ErrStatus.Reason == meta_v1.StatusReasonNotFound {
 					// Kind not supported by API server, skip
@@ -186,7 +262,9 @@ func (c *Cluster) AllControllers(namespace string) (res []cluster.Controller, er
 			for _, podController := range podControllers {
 				if !isAddon(podController) {
 					id := flux.MakeResourceID(ns.Name, kind, podController.name)
-					allControllers = append(allControllers, podController.toClusterController(id))
+					controller := podController.toClusterController(id)
+					s.annotate(&controller, podController)
+					allControllers = append(allControllers, controller)
 				}
 			}
 		}
@@ -202,7 +280,12 @@ func (c *Cluster) Sync(spec cluster.SyncDef) error {
 
 	cs := makeChangeSet()
 	var errs cluster.SyncError
+	scalings := map[string]scaling{}
+	subst := &substitution{cluster: c}
 	for _, action := range spec.Actions {
+		if !c.actionAllowed(action) {
+			continue
+		}
 		stages := []struct {
 			res resource.Resource
 			cmd string
@@ -214,9 +297,23 @@ func (c *Cluster) Sync(spec cluster.SyncDef) error {
 			if stage.res == nil {
 				continue
 			}
+			if stage.cmd == "apply" {
+				res, err := subst.apply(stage.res)
+				if err != nil {
+					errs = append(errs, cluster.ResourceError{Resource: stage.res, Error: err})
+					break
+				}
+				stage.res = res
+			}
 			obj, err := parseObj(stage.res.Bytes())
 			if err == nil {
+				if c.syncSelector != nil && !c.syncSelector.Matches(labels.Set(obj.Metadata.Labels)) {
+					continue
+				}
 				obj.Resource = stage.res
+				if stage.cmd == "apply" {
+					obj.Resource = c.withoutIgnoredFields(logger, obj, scalings)
+				}
 				cs.stage(stage.cmd, obj)
 			} else {
 				errs = append(errs, cluster.ResourceError{Resource: stage.res, Error: err})
@@ -227,8 +324,13 @@ func (c *Cluster) Sync(spec cluster.SyncDef) error {
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if v, ok := c.applier.(validator); ok {
+		if validateErrs := v.validate(logger, cs); len(validateErrs) > 0 {
+			return cluster.ValidationError{SyncError: append(errs, validateErrs...)}
+		}
+	}
 	if applyErrs := c.applier.apply(logger, cs); len(applyErrs) > 0 {
-		errs = append(errs, applyErrs...)
+		errs = append(errs, c.retryUndefinedKinds(logger, cs, applyErrs)...)
 	}
 
 	// If `nil`, errs is a cluster.SyncError(nil) rather than error(nil)
@@ -238,6 +340,50 @@ func (c *Cluster) Sync(spec cluster.SyncDef) error {
 	return nil
 }
 
+// retryUndefinedKinds applies again any resources which failed
+// because their kind wasn't known to the API server, having waited
+// for the definitions applied in the same sync to be established. It
+// returns the errors that remain.
+func (c *Cluster) retryUndefinedKinds(logger log.Logger, cs changeSet, errs cluster.SyncError) cluster.SyncError {
+	var definitions []resource.Resource
+	for _, obj := range cs.objs["apply"] {
+		if obj.Kind == "CustomResourceDefinition" {
+			definitions = append(definitions, obj.Resource)
+		}
+	}
+	if len(definitions) == 0 {
+		return errs
+	}
+
+	var remaining cluster.SyncError
+	retry := makeChangeSet()
+	for _, e := range errs {
+		if !isUndefinedKind(e.Error) {
+			remaining = append(remaining, e)
+			continue
+		}
+		obj, err := parseObj(e.Resource.Bytes())
+		if err != nil {
+			remaining = append(remaining, e)
+			continue
+		}
+		obj.Resource = e.Resource
+		retry.stage("apply", obj)
+	}
+	if len(retry.objs) == 0 {
+		return errs
+	}
+
+	if err := c.WaitEstablished(definitions, establishedTimeout); err != nil {
+		logger.Log("warning", "retrying resources anyway", "err", err)
+	}
+	return append(remaining, c.applier.apply(logger, retry)...)
+}
+
+func isUndefinedKind(err error) bool {
+	return strings.Contains(err.Error(), "no matches for kind")
+}
+
 func (c *Cluster) Ping() error {
 	_, err := c.client.coreClient.Discovery().ServerVersion()
 	return err
@@ -258,8 +404,8 @@ func (c *Cluster) Export() ([]byte, error) {
 			return nil, errors.Wrap(err, "marshalling namespace to YAML")
 		}
 
-		for _, resourceKind := range resourceKinds {
-			podControllers, err := resourceKind.getPodControllers(c, ns.Name)
+		for kind, resourceKind := range resourceKinds {
+			podControllers, err := c.podControllers(kind, resourceKind, ns.Name)
 			if err != nil {
 				if se, ok := err.(*apierrors.StatusError); ok && se.ErrStatus.Reason == meta_v1.StatusReasonNotFound {
 					// Kind not supported by API server, skip
@@ -278,6 +424,10 @@ func (c *Cluster) Export() ([]byte, error) {
 			}
 		}
 	}
+
+	if err := c.exportOtherKinds(&config, namespaces); err != nil {
+		return nil, err
+	}
 	return config.Bytes(), nil
 }
 
@@ -316,6 +466,9 @@ func (c *Cluster) getAllowedNamespaces() ([]apiv1.Namespace, error) {
 	if len(c.nsWhitelist) > 0 {
 		nsList := []apiv1.Namespace{}
 		for _, name := range c.nsWhitelist {
+			if !c.namespaceAllowed(name) {
+				continue
+			}
 			ns, err := c.client.CoreV1().Namespaces().Get(name, meta_v1.GetOptions{})
 			switch {
 			case err == nil:
@@ -337,5 +490,99 @@ func (c *Cluster) getAllowedNamespaces() ([]apiv1.Namespace, error) {
 	if err != nil {
 		return nil, err
 	}
-	return namespaces.Items, nil
+	nsList := []apiv1.Namespace{}
+	for _, ns := range namespaces.Items {
+		if c.namespaceAllowed(ns.Name) {
+			nsList = append(nsList, ns)
+		}
+	}
+	return nsList, nil
+}
+
+// namespaceAllowed reports whether the namespace given is one that
+// the Flux instance should look at and apply resources to; that is,
+// it's not excluded, and it is whitelisted if there is a whitelist.
+func (c *Cluster) namespaceAllowed(namespace string) bool {
+	for _, name := range c.nsExcluded {
+		if name == namespace {
+			return false
+		}
+	}
+	if len(c.nsWhitelist) == 0 {
+		return true
+	}
+	for _, name := range c.nsWhitelist {
+		if name == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// actionAllowed reports whether the resource in a sync action is in
+// an allowed namespace. Namespaces themselves are treated as being in
+// their own namespace; other resources that aren't namespaced (e.g.,
+// ClusterRoles and CustomResourceDefinitions) are always allowed.
+func (c *Cluster) actionAllowed(action cluster.SyncAction) bool {
+	if len(c.nsWhitelist) == 0 && len(c.nsExcluded) == 0 {
+		return true
+	}
+	res := action.Apply
+	if res == nil {
+		res = action.Delete
+	}
+	if res == nil {
+		return true
+	}
+	ns, kind, name := res.ResourceID().Components()
+	if kind == "namespace" {
+		ns = name
+	} else if c.clusterScoped(res) {
+		return true
+	}
+	return c.namespaceAllowed(ns)
+}
+
+// clusterScoped reports whether the API server says the kind of the
+// resource given isn't namespaced. Kinds it doesn't know are taken to
+// be namespaced.
+func (c *Cluster) clusterScoped(res resource.Resource) bool {
+	var header struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+	}
+	if err := yaml.Unmarshal(res.Bytes(), &header); err != nil || header.Kind == "" {
+		return false
+	}
+	gv, err := schema.ParseGroupVersion(header.APIVersion)
+	if err != nil {
+		return false
+	}
+	gk := schema.GroupKind{Group: gv.Group, Kind: header.Kind}
+	mapper := c.restMapper()
+	mapping, err := mapper.RESTMapping(gk, gv.Version)
+	if meta.IsNoMatchError(err) && c.refreshRESTMapper() {
+		mapping, err = mapper.RESTMapping(gk, gv.Version)
+	}
+	if err != nil {
+		return false
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameRoot
+}
+
+var _ cluster.SyncFilter = &Cluster{}
+
+// Syncs reports whether the resource given would be applied in a
+// sync, i.e., whether it's in an allowed namespace and has the labels
+// selected for syncing. A resource that can't be parsed is counted,
+// since it'll be reported as failing.
+func (c *Cluster) Syncs(res resource.Resource) bool {
+	if !c.actionAllowed(cluster.SyncAction{Apply: res}) {
+		return false
+	}
+	if c.syncSelector == nil {
+		return true
+	}
+	obj, err := parseObj(res.Bytes())
+	return err != nil || c.syncSelector.Matches(labels.Set(obj.Metadata.Labels))
 }
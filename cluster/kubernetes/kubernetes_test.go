@@ -23,10 +23,14 @@ func newNamespace(name string) *apiv1.Namespace {
 }
 
 func testGetAllowedNamespaces(t *testing.T, namespace []string, expected []string) {
+	testGetAllowedNamespacesExcluding(t, namespace, nil, expected)
+}
+
+func testGetAllowedNamespacesExcluding(t *testing.T, namespace, excluded []string, expected []string) {
 	clientset := fakekubernetes.NewSimpleClientset(newNamespace("default"),
 		newNamespace("kube-system"))
 
-	c := NewCluster(clientset, nil, nil, nil, log.NewNopLogger(), namespace)
+	c := NewCluster(clientset, nil, nil, nil, nil, log.NewNopLogger(), ClusterOptions{AllowedNamespaces: namespace, ExcludedNamespaces: excluded})
 
 	namespaces, err := c.getAllowedNamespaces()
 	if err != nil {
@@ -62,3 +66,11 @@ func TestGetAllowedNamespacesNamespacesSetDoesNotExist(t *testing.T) {
 func TestGetAllowedNamespacesNamespacesMultiple(t *testing.T) {
 	testGetAllowedNamespaces(t, []string{"default", "hello", "kube-system"}, []string{"default", "kube-system"})
 }
+
+func TestGetAllowedNamespacesExcluded(t *testing.T) {
+	testGetAllowedNamespacesExcluding(t, nil, []string{"kube-system"}, []string{"default"})
+}
+
+func TestGetAllowedNamespacesWhitelistedAndExcluded(t *testing.T) {
+	testGetAllowedNamespacesExcluding(t, []string{"default", "kube-system"}, []string{"default"}, []string{"kube-system"})
+}
@@ -2,15 +2,29 @@ package kubernetes
 
 import (
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/resource"
 )
 
 type Manifests struct {
+	// Jsonnet, if set, renders the `.jsonnet` files under the paths
+	// given, so their resources are loaded along with those in YAML
+	// files. Rendered resources can't be updated by fluxd.
+	Jsonnet *kresource.Jsonnet
 }
 
+var (
+	_ cluster.Generated = &Manifests{}
+	_ cluster.Rendered  = &Manifests{}
+)
+
 func (c *Manifests) LoadManifests(base string, paths []string) (map[string]resource.Resource, error) {
+	if c.Jsonnet != nil {
+		return kresource.LoadWithRenderers(base, paths, c.Jsonnet)
+	}
 	return kresource.Load(base, paths)
 }
 
@@ -22,4 +36,22 @@ func (c *Manifests) UpdateImage(def []byte, id flux.ResourceID, container string
 	return updatePodController(def, id, container, image)
 }
 
+func (c *Manifests) IsGenerated(res resource.Resource) bool {
+	return c.Jsonnet != nil && c.Jsonnet.Renders(res.Source())
+}
+
+// IsRendered is the same as IsGenerated: none of the resources these
+// Manifests generate can be updated.
+func (c *Manifests) IsRendered(res resource.Resource) bool {
+	return c.IsGenerated(res)
+}
+
+func (c *Manifests) UpdateGeneratedImage(root string, res resource.Resource, container string, newImageID image.Ref) error {
+	return RenderedUpdateError(res.ResourceID(), res.Source())
+}
+
+func (c *Manifests) UpdateGeneratedPolicies(root string, res resource.Resource, update policy.Update) (bool, error) {
+	return false, RenderedUpdateError(res.ResourceID(), res.Source())
+}
+
 // UpdatePolicies and ServicesWithPolicies in policies.go
@@ -0,0 +1,20 @@
+package kubernetes
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+var (
+	// Only observed by the client applier, which applies each
+	// resource separately.
+	applyDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "cluster",
+		Name:      "resource_apply_duration_seconds",
+		Help:      "Duration of applying (or deleting) a single resource when syncing, in seconds.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10},
+	}, []string{fluxmetrics.LabelAction, fluxmetrics.LabelKind, fluxmetrics.LabelSuccess})
+)
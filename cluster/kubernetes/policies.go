@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -35,17 +36,29 @@ func (m *Manifests) UpdatePolicies(def []byte, id flux.ResourceID, update policy
 		}
 	}
 
-	var args []string
+	// The annotations are applied in order, so that any removals
+	// override additions; sort each lot, so new annotations are
+	// always added in the same order.
+	var adds, dels []string
 	for pol, val := range add {
 		if policy.Tag(pol) && !policy.NewPattern(val).Valid() {
 			return nil, fmt.Errorf("invalid tag pattern: %q", val)
 		}
-		args = append(args, fmt.Sprintf("%s%s=%s", kresource.PolicyPrefix, pol, val))
+		if pol == policy.TagSort && !policy.ValidTagSort(val) {
+			return nil, fmt.Errorf("invalid tag ordering: %q", val)
+		}
+		adds = append(adds, fmt.Sprintf("%s%s=%s", kresource.PolicyPrefix, pol, val))
 	}
 	for pol, _ := range del {
-		args = append(args, fmt.Sprintf("%s%s=", kresource.PolicyPrefix, pol))
+		dels = append(dels, fmt.Sprintf("%s%s=", kresource.PolicyPrefix, pol))
 	}
+	sort.Strings(adds)
+	sort.Strings(dels)
+	args := append(adds, dels...)
 
+	if out, err := annotateInPlace(def, ns, kind, name, args...); err == nil {
+		return out, nil
+	}
 	return (KubeYAML{}).Annotate(def, ns, kind, name, args...)
 }
 
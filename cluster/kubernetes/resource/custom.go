@@ -0,0 +1,190 @@
+package resource
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+// CustomImage says where the image for a container is given in
+// custom resources of some kind (e.g., those of an operator which
+// runs an image named in its resource), so that they can be treated
+// as workloads: their images listed, and updated by releases and
+// automation.
+type CustomImage struct {
+	Group     string // the API group of the kind; empty for the core group
+	Kind      string
+	Container string        // the name to give the container
+	Path      []interface{} // the keys (strings) and indices (ints) leading to the image
+}
+
+// The paths understood are a simple subset of JSONPath: fields and
+// array indices, e.g., `.spec.image` or `{.spec.runners[0].image}`.
+var (
+	customImageRegexp = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9]*)(?:\.([^:=]+))?:([^:=]+)=(.+)$`)
+	pathElemRegexp    = regexp.MustCompile(`^\.([A-Za-z0-9_-]+)|^\[([0-9]+)\]|^\['([^']+)'\]`)
+)
+
+// ParseCustomImage parses a mapping given as
+// `Kind.group:container=path`, e.g.,
+// `Application.example.com:app=.spec.image`, or
+// `Kind:container=path` for a kind in the core group.
+func ParseCustomImage(s string) (CustomImage, error) {
+	m := customImageRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return CustomImage{}, fmt.Errorf("expected Kind.group:container=path, got %q", s)
+	}
+	path, err := parseImagePath(m[4])
+	if err != nil {
+		return CustomImage{}, err
+	}
+	return CustomImage{Group: m[2], Kind: m[1], Container: m[3], Path: path}, nil
+}
+
+func parseImagePath(s string) ([]interface{}, error) {
+	p := strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	p = strings.TrimPrefix(p, "$")
+	var path []interface{}
+	for p != "" {
+		m := pathElemRegexp.FindStringSubmatch(p)
+		if m == nil {
+			return nil, fmt.Errorf("unsupported path %q; only fields and array indices can be given, e.g., .spec.containers[0].image", s)
+		}
+		switch {
+		case m[1] != "":
+			path = append(path, m[1])
+		case m[3] != "":
+			path = append(path, m[3])
+		default:
+			i, _ := strconv.Atoi(m[2])
+			path = append(path, i)
+		}
+		p = p[len(m[0]):]
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path %q", s)
+	}
+	return path, nil
+}
+
+// Find gives the image at the path in a resource, decoded from YAML
+// or JSON, and whether there is one.
+func (ci CustomImage) Find(obj interface{}) (string, bool) {
+	node := obj
+	for _, elem := range ci.Path {
+		switch elem := elem.(type) {
+		case string:
+			switch m := node.(type) {
+			case map[string]interface{}:
+				node = m[elem]
+			case map[interface{}]interface{}:
+				node = m[elem]
+			default:
+				return "", false
+			}
+		case int:
+			seq, ok := node.([]interface{})
+			if !ok || elem >= len(seq) {
+				return "", false
+			}
+			node = seq[elem]
+		}
+	}
+	s, ok := node.(string)
+	return s, ok && s != ""
+}
+
+// customImages are the images registered for custom kinds, by kind
+// (in lower case, as in resource IDs).
+var customImages = map[string][]CustomImage{}
+
+// RegisterCustomImage makes resources of the kind given workloads,
+// with an image for the container given at the path given. It's
+// expected to be called before any manifests are loaded. Registering
+// the same image again has no effect.
+func RegisterCustomImage(ci CustomImage) {
+	kind := strings.ToLower(ci.Kind)
+	for _, already := range customImages[kind] {
+		if reflect.DeepEqual(already, ci) {
+			return
+		}
+	}
+	customImages[kind] = append(customImages[kind], ci)
+}
+
+// CustomImages gives the images registered for resources of the
+// group and kind given.
+func CustomImages(group, kind string) []CustomImage {
+	var images []CustomImage
+	for _, ci := range customImages[strings.ToLower(kind)] {
+		if ci.Group == group {
+			images = append(images, ci)
+		}
+	}
+	return images
+}
+
+// CustomWorkload is a custom resource with images registered for its
+// kind.
+type CustomWorkload struct {
+	baseObject
+	containers []resource.Container
+}
+
+func (w *CustomWorkload) Containers() []resource.Container {
+	return w.containers
+}
+
+func (w *CustomWorkload) SetContainerImage(container string, ref image.Ref) error {
+	for i, c := range w.containers {
+		if c.Name == container {
+			w.containers[i].Image = ref
+			return nil
+		}
+	}
+	return fmt.Errorf("container %q not found in workload", container)
+}
+
+// unmarshalCustom makes a workload of a resource of a kind with
+// images registered, or returns nil if there are none. Containers
+// without an image (or with one that can't be parsed) are left out.
+func unmarshalCustom(base baseObject, bytes []byte) (*CustomWorkload, error) {
+	if len(customImages[strings.ToLower(base.Kind)]) == 0 {
+		return nil, nil
+	}
+	var obj struct {
+		APIVersion string `yaml:"apiVersion"`
+	}
+	if err := yaml.Unmarshal(bytes, &obj); err != nil {
+		return nil, err
+	}
+	group := ""
+	if i := strings.LastIndex(obj.APIVersion, "/"); i >= 0 {
+		group = obj.APIVersion[:i]
+	}
+	images := CustomImages(group, base.Kind)
+	if len(images) == 0 {
+		return nil, nil
+	}
+
+	var values interface{}
+	if err := yaml.Unmarshal(bytes, &values); err != nil {
+		return nil, err
+	}
+	w := &CustomWorkload{baseObject: base}
+	for _, ci := range images {
+		if s, ok := ci.Find(values); ok {
+			if ref, err := image.ParseRef(s); err == nil {
+				w.containers = append(w.containers, resource.Container{Name: ci.Container, Image: ref})
+			}
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,75 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+func TestParseCustomImage(t *testing.T) {
+	for in, want := range map[string]CustomImage{
+		"Application.example.com:app=.spec.image":               {Group: "example.com", Kind: "Application", Container: "app", Path: []interface{}{"spec", "image"}},
+		"PodTemplate:main={.template.spec.containers[0].image}": {Kind: "PodTemplate", Container: "main", Path: []interface{}{"template", "spec", "containers", 0, "image"}},
+		"Runner.ci.example.com:job=$.spec['job-image']":         {Group: "ci.example.com", Kind: "Runner", Container: "job", Path: []interface{}{"spec", "job-image"}},
+	} {
+		got, err := ParseCustomImage(in)
+		if assert.NoError(t, err, in) {
+			assert.Equal(t, want, got, in)
+		}
+	}
+	for _, in := range []string{"", "Application", "Application:app", "Application:app=", "Application:app=.spec.containers[*].image", "Application:app=spec..image"} {
+		_, err := ParseCustomImage(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestCustomWorkload(t *testing.T) {
+	for _, s := range []string{"Widget.example.com:app=.spec.image", "Widget.example.com:worker=.spec.workers[1].image", "Widget.example.com:missing=.spec.sidecar.image"} {
+		ci, err := ParseCustomImage(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		RegisterCustomImage(ci)
+	}
+	defer delete(customImages, "widget")
+
+	objs, err := ParseMultidoc([]byte(`---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+  namespace: test
+spec:
+  image: example.com/app:1.0
+  workers:
+  - image: example.com/worker:0.1
+  - image: example.com/worker:0.2
+---
+apiVersion: other.example.com/v1
+kind: Widget
+metadata:
+  name: other
+  namespace: test
+spec:
+  image: example.com/app:1.0
+`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, ok := objs["test:widget/w"].(resource.Workload)
+	if !assert.True(t, ok, "expected a workload") {
+		return
+	}
+	assert.Equal(t, []resource.Container{
+		{Name: "app", Image: image.Ref{Name: image.Name{Domain: "example.com", Image: "app"}, Tag: "1.0"}},
+		{Name: "worker", Image: image.Ref{Name: image.Name{Domain: "example.com", Image: "worker"}, Tag: "0.2"}},
+	}, w.Containers())
+
+	// The same kind in another group isn't
+	_, ok = objs["test:widget/other"].(resource.Workload)
+	assert.False(t, ok, "expected a kind in another group not to be a workload")
+}
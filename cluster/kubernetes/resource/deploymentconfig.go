@@ -0,0 +1,75 @@
+package resource
+
+import (
+	"fmt"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+// DeploymentConfig is an OpenShift deployment config
+// (apps.openshift.io/v1).
+type DeploymentConfig struct {
+	baseObject
+	Spec DeploymentConfigSpec
+}
+
+type DeploymentConfigSpec struct {
+	Replicas int
+	Template PodTemplate
+	Triggers []DeploymentTrigger
+}
+
+// DeploymentTrigger is something which causes a deployment config to
+// roll out. An ImageChange trigger rolls out a new image whenever the
+// image stream tag it's from changes.
+//
+// It's also decoded from deployment configs in the cluster, hence the
+// JSON field names.
+type DeploymentTrigger struct {
+	Type              string             `json:"type"`
+	ImageChangeParams *ImageChangeParams `yaml:"imageChangeParams" json:"imageChangeParams"`
+}
+
+type ImageChangeParams struct {
+	Automatic      bool     `json:"automatic"`
+	ContainerNames []string `yaml:"containerNames" json:"containerNames"`
+}
+
+// Containers gives the containers of the deployment config, other
+// than those which get their image from an image stream (i.e., that
+// are named by an automatic ImageChange trigger), since OpenShift
+// sets the image of those.
+func (dc DeploymentConfig) Containers() []resource.Container {
+	var result []resource.Container
+	triggered := ImageTriggeredContainers(dc.Spec.Triggers)
+	for _, c := range dc.Spec.Template.Containers() {
+		if !triggered[c.Name] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func (dc DeploymentConfig) SetContainerImage(container string, ref image.Ref) error {
+	if ImageTriggeredContainers(dc.Spec.Triggers)[container] {
+		return fmt.Errorf("the image of container %q is set from an image stream", container)
+	}
+	return dc.Spec.Template.SetContainerImage(container, ref)
+}
+
+// ImageTriggeredContainers gives the names of the containers whose
+// images are set from image streams by the triggers given.
+func ImageTriggeredContainers(triggers []DeploymentTrigger) map[string]bool {
+	names := map[string]bool{}
+	for _, t := range triggers {
+		if t.Type == "ImageChange" && t.ImageChangeParams != nil && t.ImageChangeParams.Automatic {
+			for _, name := range t.ImageChangeParams.ContainerNames {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+var _ resource.Workload = DeploymentConfig{}
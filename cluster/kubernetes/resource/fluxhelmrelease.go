@@ -3,6 +3,7 @@ package resource
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
@@ -127,12 +128,17 @@ func interpretAsContainer(m mapper) (image.Ref, ImageSetter, bool) {
 				if tagStr, ok := tag.(string); ok {
 					taggy = true
 					imageRef.Tag = tagStr
+					// the tag may be pinned to a digest,
+					// e.g., `v1@sha256:...`
+					if at := strings.Index(tagStr, "@"); at >= 0 {
+						imageRef.Tag, imageRef.Digest = tagStr[:at], tagStr[at+1:]
+					}
 				}
 			}
 			return imageRef, func(ref image.Ref) {
 				if taggy {
 					m.set("image", ref.Name.String())
-					m.set("tag", ref.Tag)
+					m.set("tag", ref.TagWithDigest())
 					return
 				}
 				m.set("image", ref.String())
@@ -169,7 +175,7 @@ func interpretAsImage(m mapper) (image.Ref, ImageSetter, bool) {
 			if err == nil {
 				return imgRef, func(ref image.Ref) {
 					m.set("repository", ref.Name.String())
-					m.set("tag", ref.Tag)
+					m.set("tag", ref.TagWithDigest())
 				}, true
 			}
 		}
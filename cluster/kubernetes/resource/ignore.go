@@ -0,0 +1,191 @@
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IgnoreFilename is the name of the files listing paths that are not
+// to be loaded as manifests. It uses the same syntax as
+// `.gitignore`, and as with `.gitignore`, patterns apply to the
+// directory the file is in, and those below it.
+const IgnoreFilename = ".fluxignore"
+
+type ignorePattern struct {
+	dir     string // the directory of the ignore file, relative to the base, with slashes
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignorer keeps the patterns from the ignore files found so far. The
+// last pattern that matches a path decides whether it's ignored.
+type ignorer struct {
+	base     string
+	patterns []ignorePattern
+}
+
+// newIgnorer loads the ignore files in the base directory and each
+// directory between it and the path given; the ignore files in the
+// path itself, and below, are loaded as it is walked.
+func newIgnorer(base, root string) (*ignorer, error) {
+	ig := &ignorer{base: base}
+	rel, err := filepath.Rel(base, root)
+	if err != nil {
+		return nil, err
+	}
+	if rel == "." || strings.HasPrefix(rel, "..") {
+		return ig, nil
+	}
+	dir := base
+	elems := strings.Split(rel, string(filepath.Separator))
+	for i := 0; i < len(elems); i++ {
+		if err := ig.load(dir); err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(dir, elems[i])
+	}
+	return ig, nil
+}
+
+// load reads the ignore file in the directory given, if there is one.
+func (ig *ignorer) load(dir string) error {
+	file := filepath.Join(dir, IgnoreFilename)
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "reading %q", file)
+	}
+	rel, err := filepath.Rel(ig.base, dir)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		rel = ""
+	}
+	lines := bufio.NewScanner(bytes.NewReader(content))
+	for lines.Scan() {
+		if p, ok := parseIgnorePattern(rel, lines.Text()); ok {
+			ig.patterns = append(ig.patterns, p)
+		}
+	}
+	return lines.Err()
+}
+
+// ignored reports whether the path given (which must be under the
+// base directory) should be skipped.
+func (ig *ignorer) ignored(file string, isDir bool) bool {
+	rel, err := filepath.Rel(ig.base, file)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return false
+	}
+	ignored := false
+	for _, p := range ig.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if p.dir != "" {
+			if !strings.HasPrefix(rel, p.dir+"/") {
+				continue
+			}
+			sub = strings.TrimPrefix(rel, p.dir+"/")
+		}
+		if p.re.MatchString(sub) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// parseIgnorePattern parses a line of an ignore file, as per
+// https://git-scm.com/docs/gitignore#_pattern_format.
+func parseIgnorePattern(dir, line string) (ignorePattern, bool) {
+	p := ignorePattern{dir: dir}
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// A pattern with a slash (other than at the end) is relative to
+	// the directory of the ignore file; otherwise it can match at
+	// any level.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return p, false
+	}
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return p, false
+	}
+	p.re = re
+	return p, true
+}
+
+// globToRegexp translates a gitignore glob into a regular expression.
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "**" && i > 0 && glob[i-1] == '/':
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
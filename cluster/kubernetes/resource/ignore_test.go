@@ -0,0 +1,106 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+func TestIgnorePatterns(t *testing.T) {
+	for _, c := range []struct {
+		dir, pattern string
+		path         string
+		isDir        bool
+		ignored      bool
+	}{
+		{"", "*.tmpl.yaml", "deploy/app.tmpl.yaml", false, true},
+		{"", "*.tmpl.yaml", "deploy/app.yaml", false, false},
+		{"", "docs/", "docs", true, true},
+		{"", "docs/", "docs", false, false},
+		{"", "docs/", "deploy/docs", true, true},
+		{"", "/docs", "deploy/docs", true, false},
+		{"", "deploy/*.yaml", "deploy/app.yaml", false, true},
+		{"", "deploy/*.yaml", "deploy/sub/app.yaml", false, false},
+		{"", "deploy/**/*.yaml", "deploy/sub/app.yaml", false, true},
+		{"", "deploy/**/*.yaml", "deploy/app.yaml", false, true},
+		{"", "**/generated", "a/b/generated", true, true},
+		{"", "**/generated", "generated", true, true},
+		{"", "generated/**", "generated/a/b.yaml", false, true},
+		{"", "app-?.yaml", "app-1.yaml", false, true},
+		{"", "app-[0-9].yaml", "app-x.yaml", false, false},
+		{"", "app-[!0-9].yaml", "app-x.yaml", false, true},
+		{"", `\#notacomment.yaml`, "#notacomment.yaml", false, true},
+		{"deploy", "*.yaml", "deploy/app.yaml", false, true},
+		{"deploy", "*.yaml", "other/app.yaml", false, false},
+		{"deploy", "/app.yaml", "deploy/sub/app.yaml", false, false},
+	} {
+		ig := &ignorer{base: "/base"}
+		p, ok := parseIgnorePattern(c.dir, c.pattern)
+		if !ok {
+			t.Errorf("could not parse pattern %q", c.pattern)
+			continue
+		}
+		ig.patterns = append(ig.patterns, p)
+		if got := ig.ignored(filepath.Join("/base", c.path), c.isDir); got != c.ignored {
+			t.Errorf("pattern %q in %q, path %q (dir: %v): expected ignored %v, got %v", c.pattern, c.dir, c.path, c.isDir, c.ignored, got)
+		}
+	}
+
+	for _, line := range []string{"", "   ", "# a comment", "/"} {
+		if _, ok := parseIgnorePattern("", line); ok {
+			t.Errorf("expected %q not to be a pattern", line)
+		}
+	}
+}
+
+func TestLoadIgnored(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	garbage := "{{ this is a template, not YAML }}"
+	deployment := func(name string) string {
+		return "kind: Deployment\nmetadata:\n  name: " + name + "\n"
+	}
+	for name, content := range map[string]string{
+		IgnoreFilename:                 "docs/\n*.tmpl.yaml\n",
+		"docs/example.yaml":            garbage,
+		"deploy/" + IgnoreFilename:     "generated.yaml\n!keep.tmpl.yaml\n",
+		"deploy/app.yaml":              deployment("app"),
+		"deploy/generated.yaml":        garbage,
+		"deploy/app.tmpl.yaml":         garbage,
+		"deploy/keep.tmpl.yaml":        deployment("keep"),
+		"deploy/sub/generated.yaml":    deployment("regenerated"),
+		"other/" + IgnoreFilename:      "*.yaml\n",
+		"other/ignored.yaml":           garbage,
+		"deploy/sub/" + IgnoreFilename: "!generated.yaml\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, paths := range [][]string{
+		{dir},
+		{filepath.Join(dir, "deploy")},
+	} {
+		objs, err := Load(dir, paths)
+		if err != nil {
+			t.Fatalf("loading %v: %s", paths, err)
+		}
+		for _, id := range []string{"default:deployment/app", "default:deployment/keep", "default:deployment/regenerated"} {
+			if _, ok := objs[id]; !ok {
+				t.Errorf("loading %v: expected %s to be loaded", paths, id)
+			}
+		}
+		if len(objs) != 3 {
+			t.Errorf("loading %v: expected three resources, got %v", paths, objs)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// How long jsonnet is allowed to take to render a file.
+const jsonnetTimeout = time.Minute
+
+// Jsonnet renders `.jsonnet` files by running the jsonnet command.
+// Library files (`.libsonnet`) are there to be imported by other
+// files, so aren't rendered themselves.
+//
+// A file can evaluate to a resource, or to an array or object of
+// resources (or of arrays or objects of resources, and so on); fields
+// of an object without a `kind` are taken to be resources, in order
+// of their names.
+type Jsonnet struct {
+	// The jsonnet executable; if empty, `jsonnet` is looked for in
+	// the PATH.
+	Exe string
+	// Directories to search for imported files, after the
+	// directory of the file importing them; relative paths are taken
+	// to be relative to the top of the repo.
+	ImportPaths []string
+}
+
+var _ Renderer = &Jsonnet{}
+
+func (j *Jsonnet) Renders(path string) bool {
+	return filepath.Ext(path) == ".jsonnet"
+}
+
+func (j *Jsonnet) Render(base, path string) ([]byte, error) {
+	exe := j.Exe
+	if exe == "" {
+		exe = "jsonnet"
+	}
+	var args []string
+	for _, p := range j.ImportPaths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(base, p)
+		}
+		args = append(args, "-J", p)
+	}
+	args = append(args, path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), jsonnetTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Dir = filepath.Dir(path)
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = errOut
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errors.Wrap(ctx.Err(), "jsonnet timed out")
+		}
+		if msg := strings.TrimSpace(errOut.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return jsonnetResources(out.Bytes())
+}
+
+// jsonnetResources collects the resources in the output of jsonnet
+// into a List, so they can be parsed like any other manifest.
+func jsonnetResources(out []byte) ([]byte, error) {
+	// Numbers are kept as they are, rather than going via float64,
+	// so e.g., large integers aren't given exponents
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, errors.Wrap(err, "parsing output of jsonnet")
+	}
+
+	items := []interface{}{}
+	var collect func(v interface{}) error
+	collect = func(v interface{}) error {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, item := range v {
+				if err := collect(item); err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			if _, ok := v["kind"]; ok {
+				items = append(items, v)
+				return nil
+			}
+			var fields []string
+			for field := range v {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			for _, field := range fields {
+				if err := collect(v[field]); err != nil {
+					return err
+				}
+			}
+		case nil:
+			// e.g., a resource left out by a conditional
+		default:
+			return fmt.Errorf("expected resources, or arrays or objects of them, but found %v", v)
+		}
+		return nil
+	}
+	if err := collect(value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	})
+}
@@ -0,0 +1,76 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJsonnetResources(t *testing.T) {
+	out, err := jsonnetResources([]byte(`{
+  "b": {"kind": "Service", "metadata": {"name": "b"}},
+  "a": [{"kind": "Deployment", "metadata": {"name": "a"}, "spec": {"replicas": 1000000}}, null]
+}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.JSONEq(t, `{"apiVersion": "v1", "kind": "List", "items": [
+  {"kind": "Deployment", "metadata": {"name": "a"}, "spec": {"replicas": 1000000}},
+  {"kind": "Service", "metadata": {"name": "b"}}
+]}`, string(out))
+
+	_, err = jsonnetResources([]byte(`{"a": "not a resource"}`))
+	assert.Error(t, err)
+}
+
+func TestLoadJsonnet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-jsonnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A stand-in for jsonnet, which records its arguments and prints
+	// what would be the output of the file it's given
+	exe := filepath.Join(dir, "jsonnet")
+	script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(dir, "args") + `"
+echo '[{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "app", "namespace": "default"}}]'
+`
+	if err := ioutil.WriteFile(exe, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	manifests := filepath.Join(dir, "manifests")
+	if err := os.Mkdir(manifests, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"app.jsonnet", "lib.libsonnet"} {
+		if err := ioutil.WriteFile(filepath.Join(manifests, file), []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jsonnet := &Jsonnet{Exe: exe, ImportPaths: []string{"vendor", "/lib"}}
+	objs, err := LoadWithRenderers(dir, []string{manifests}, jsonnet)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, objs, 1) {
+		res := objs["default:deployment/app"]
+		if assert.NotNil(t, res) {
+			assert.Equal(t, "manifests/app.jsonnet", res.Source())
+		}
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "-J "+filepath.Join(dir, "vendor")+" -J /lib "+filepath.Join(manifests, "app.jsonnet")+"\n", string(args))
+	}
+
+	// Without the renderer, the files are ignored
+	objs, err = Load(dir, []string{manifests})
+	assert.NoError(t, err)
+	assert.Empty(t, objs)
+}
@@ -1,7 +1,6 @@
 package resource
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io/ioutil"
@@ -12,21 +11,66 @@ import (
 	"github.com/weaveworks/flux/resource"
 )
 
+// Renderer turns files in a format other than YAML into manifests,
+// so they can be loaded along with YAML files.
+type Renderer interface {
+	// Renders reports whether the file at the path given is one
+	// this renders.
+	Renders(path string) bool
+	// Render gives the manifests (as YAML or JSON) for the file at
+	// the path given, within the repo at `base`.
+	Render(base, path string) ([]byte, error)
+}
+
 // Load takes paths to directories or files, and creates an object set
 // based on the file(s) therein. Resources are named according to the
 // file content, rather than the file name of directory structure.
+// Files and directories matching the patterns in an ignore file (see
+// `IgnoreFilename`) are skipped.
 func Load(base string, paths []string) (map[string]resource.Resource, error) {
+	return LoadWithRenderers(base, paths)
+}
+
+// LoadWithRenderers is like Load, but files in formats other than
+// YAML are also loaded, having been rendered to manifests by the
+// first of the renderers given that handles them.
+func LoadWithRenderers(base string, paths []string, renderers ...Renderer) (map[string]resource.Resource, error) {
 	objs := map[string]resource.Resource{}
+	add := func(docsInFile map[string]resource.Resource) error {
+		for id, obj := range docsInFile {
+			if alreadyDefined, ok := objs[id]; ok {
+				return fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, location(alreadyDefined), location(obj))
+			}
+			objs[id] = obj
+		}
+		return nil
+	}
 	charts, err := newChartTracker(base)
 	if err != nil {
 		return nil, errors.Wrapf(err, "walking %q for chartdirs", base)
 	}
 	for _, root := range paths {
-		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		ignores, err := newIgnorer(base, root)
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return errors.Wrapf(err, "walking %q for yamels", path)
 			}
 
+			if path != root && ignores.ignored(path, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				if err := ignores.load(path); err != nil {
+					return err
+				}
+			}
+
 			if charts.isDirChart(path) {
 				return filepath.SkipDir
 			}
@@ -48,12 +92,29 @@ func Load(base string, paths []string) (map[string]resource.Resource, error) {
 				if err != nil {
 					return err
 				}
-				for id, obj := range docsInFile {
-					if alreadyDefined, ok := objs[id]; ok {
-						return fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, alreadyDefined.Source(), source)
-					}
-					objs[id] = obj
+				return add(docsInFile)
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+			for _, r := range renderers {
+				if !r.Renders(path) {
+					continue
+				}
+				rendered, err := r.Render(base, path)
+				if err != nil {
+					return errors.Wrapf(err, "rendering %q", path)
+				}
+				source, err := filepath.Rel(base, path)
+				if err != nil {
+					return errors.Wrapf(err, "path to scan %q is not under base %q", path, base)
+				}
+				docsInFile, err := ParseMultidoc(rendered, source)
+				if err != nil {
+					return err
 				}
+				return add(docsInFile)
 			}
 			return nil
 		})
@@ -124,78 +185,116 @@ func looksLikeChart(dir string) bool {
 
 // ParseMultidoc takes a dump of config (a multidoc YAML) and
 // constructs an object set from the resources represented therein.
+// Each resource records the document (and, for the items of a `List`,
+// the item) it came from. Empty documents are skipped, and it's an
+// error for the same resource to be defined more than once.
 func ParseMultidoc(multidoc []byte, source string) (map[string]resource.Resource, error) {
 	objs := map[string]resource.Resource{}
-	chunks := bufio.NewScanner(bytes.NewReader(multidoc))
-	initialBuffer := make([]byte, 4096)     // Matches startBufSize in bufio/scan.go
-	chunks.Buffer(initialBuffer, 1024*1024) // Allow growth to 1MB
-	chunks.Split(splitYAMLDocument)
-
-	var obj resource.Resource
-	var err error
-	for chunks.Scan() {
-		// It's not guaranteed that the return value of Bytes() will not be mutated later:
-		// https://golang.org/pkg/bufio/#Scanner.Bytes
-		// But we will be snaffling it away, so make a copy.
-		bytes := chunks.Bytes()
-		bytes2 := make([]byte, len(bytes), cap(bytes))
-		copy(bytes2, bytes)
-		if obj, err = unmarshalObject(source, bytes2); err != nil {
-			return nil, errors.Wrapf(err, "parsing YAML doc from %q", source)
+	for i, doc := range splitYAMLDocuments(multidoc) {
+		pos := position{doc: i + 1, line: doc.line}
+		obj, err := unmarshalObject(source, pos, doc.bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing YAML doc %d from %q", pos.doc, source)
 		}
 		if obj == nil {
 			continue
 		}
 		// Lists must be treated specially, since it's the
 		// contained resources we are after.
+		items := []resource.Resource{obj}
 		if list, ok := obj.(*List); ok {
-			for _, item := range list.Items {
-				objs[item.ResourceID().String()] = item
+			items = list.Items
+		}
+		for _, item := range items {
+			id := item.ResourceID().String()
+			if already, ok := objs[id]; ok {
+				return nil, fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, location(already), location(item))
 			}
-		} else {
-			objs[obj.ResourceID().String()] = obj
+			objs[id] = item
 		}
 	}
-
-	if err := chunks.Err(); err != nil {
-		return objs, errors.Wrapf(err, "scanning multidoc from %q", source)
-	}
 	return objs, nil
 }
 
-// ---
-// Taken directly from https://github.com/kubernetes/apimachinery/blob/master/pkg/util/yaml/decoder.go.
-
-const yamlSeparator = "\n---"
-
-// splitYAMLDocument is a bufio.SplitFunc for splitting YAML streams into individual documents.
-func splitYAMLDocument(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 {
-		return 0, nil, nil
+// location gives the source of a resource, including its position
+// within the source if known.
+func location(res resource.Resource) string {
+	if r, ok := res.(interface {
+		location() string
+	}); ok {
+		return r.location()
 	}
-	sep := len([]byte(yamlSeparator))
-	if i := bytes.Index(data, []byte(yamlSeparator)); i >= 0 {
-		// We have a potential document terminator
-		i += sep
-		after := data[i:]
-		if len(after) == 0 {
-			// we can't read any more characters
-			if atEOF {
-				return len(data), data[:len(data)-sep], nil
-			}
-			return 0, nil, nil
+	return res.Source()
+}
+
+// splitYAMLDocuments splits a YAML stream into documents. Each
+// document starts after a `---` line (or at the start of the stream)
+// and ends before the next `---` line, or at a `...` line. Text before
+// the first `---` only counts as a document if there's more than
+// comments in it; otherwise, every document counts, even if it's
+// empty, so that documents are numbered as they appear.
+func splitYAMLDocuments(stream []byte) []yamlDocument {
+	var docs []yamlDocument
+	start, explicit := 0, false
+	finish := func(end int) {
+		if end < start {
+			return
 		}
-		if j := bytes.IndexByte(after, '\n'); j >= 0 {
-			return i + j + 1, data[0 : i-sep], nil
+		// the line ending before a marker isn't part of the document
+		if end > start && end < len(stream) && stream[end-1] == '\n' {
+			end--
+		}
+		if explicit || hasYAMLContent(stream[start:end]) {
+			docs = append(docs, yamlDocument{
+				bytes: stream[start:end],
+				line:  bytes.Count(stream[:start], []byte("\n")) + 1,
+			})
 		}
-		return 0, nil, nil
 	}
-	// If we're at EOF, we have a final, non-terminated line. Return it.
-	if atEOF {
-		return len(data), data, nil
+	for pos := 0; pos < len(stream); {
+		next := len(stream)
+		if i := bytes.IndexByte(stream[pos:], '\n'); i >= 0 {
+			next = pos + i + 1
+		}
+		line := bytes.TrimRight(stream[pos:next], "\r\n")
+		switch {
+		case isYAMLMarker(line, "---"):
+			finish(pos)
+			start, explicit = next, true
+			// there may be content on the same line, e.g., `--- |`
+			if hasYAMLContent(line[3:]) {
+				start = pos + 3
+			}
+		case isYAMLMarker(line, "..."):
+			finish(pos)
+			start, explicit = next, false
+		}
+		pos = next
 	}
-	// Request more data.
-	return 0, nil, nil
+	finish(len(stream))
+	return docs
 }
 
-// ---
+// yamlDocument is a document from a YAML stream, and the line of the
+// stream it starts on.
+type yamlDocument struct {
+	bytes []byte
+	line  int
+}
+
+func isYAMLMarker(line []byte, marker string) bool {
+	return bytes.HasPrefix(line, []byte(marker)) &&
+		(len(line) == len(marker) || line[len(marker)] == ' ' || line[len(marker)] == '\t')
+}
+
+// hasYAMLContent reports whether there's anything other than
+// whitespace, comments and directives in the text given.
+func hasYAMLContent(text []byte) bool {
+	for _, line := range bytes.Split(text, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && line[0] != '#' && line[0] != '%' {
+			return true
+		}
+	}
+	return false
+}
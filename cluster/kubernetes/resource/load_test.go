@@ -10,12 +10,13 @@ import (
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
 )
 
 // for convenience
-func base(source, kind, namespace, name string) baseObject {
-	b := baseObject{source: source, Kind: kind}
+func base(source string, pos position, kind, namespace, name string) baseObject {
+	b := baseObject{source: source, pos: pos, Kind: kind}
 	b.Meta.Namespace = namespace
 	b.Meta.Name = name
 	return b
@@ -49,8 +50,8 @@ metadata:
 		t.Error(err)
 	}
 
-	objA := base("test", "Deployment", "", "a-deployment")
-	objB := base("test", "Deployment", "b-namespace", "b-deployment")
+	objA := base("test", position{doc: 2, line: 7}, "Deployment", "", "a-deployment")
+	objB := base("test", position{doc: 1, line: 2}, "Deployment", "b-namespace", "b-deployment")
 	expected := map[string]resource.Resource{
 		objA.ResourceID().String(): &Deployment{baseObject: objA},
 		objB.ResourceID().String(): &Deployment{baseObject: objB},
@@ -81,8 +82,8 @@ metadata:
 		t.Error(err)
 	}
 
-	objA := base("test", "Deployment", "", "a-deployment")
-	objB := base("test", "Deployment", "b-namespace", "b-deployment")
+	objA := base("test", position{doc: 2, line: 8}, "Deployment", "", "a-deployment")
+	objB := base("test", position{doc: 1, line: 3}, "Deployment", "b-namespace", "b-deployment")
 	expected := map[string]resource.Resource{
 		objA.ResourceID().String(): &Deployment{baseObject: objA},
 		objB.ResourceID().String(): &Deployment{baseObject: objB},
@@ -152,6 +153,122 @@ spec:
 	}
 }
 
+func TestWorkloadContainers(t *testing.T) {
+	doc := `---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  namespace: default
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          initContainers:
+          - name: wait
+            image: busybox:1.28
+          containers:
+          - name: dump
+            image: postgres:10.4
+          - name: upload
+            image: quay.io/example/uploader:v1
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  namespace: default
+  name: db
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init-db
+        image: quay.io/example/init-db:v1
+      containers:
+      - name: db
+        image: postgres:10.4
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  namespace: default
+  name: agent
+spec:
+  template:
+    spec:
+      containers:
+      - name: agent
+        image: quay.io/example/agent:v1
+---
+apiVersion: apps.openshift.io/v1
+kind: DeploymentConfig
+metadata:
+  namespace: default
+  name: web
+spec:
+  replicas: 2
+  triggers:
+  - type: ConfigChange
+  - type: ImageChange
+    imageChangeParams:
+      automatic: true
+      containerNames:
+      - web
+      from:
+        kind: ImageStreamTag
+        name: web:latest
+  template:
+    spec:
+      containers:
+      - name: web
+        image: " "
+      - name: proxy
+        image: quay.io/example/proxy:v1
+`
+	objs, err := ParseMultidoc([]byte(doc), "test")
+	assert.NoError(t, err)
+
+	for id, expected := range map[string][]string{
+		"default:cronjob/backup":       {"dump", "upload", "wait"},
+		"default:statefulset/db":       {"db", "init-db"},
+		"default:daemonset/agent":      {"agent"},
+		"default:deploymentconfig/web": {"proxy"},
+	} {
+		obj, ok := objs[id]
+		if !assert.True(t, ok, id) {
+			continue
+		}
+		workload, ok := obj.(resource.Workload)
+		if !assert.True(t, ok, id) {
+			continue
+		}
+		var names []string
+		for _, c := range workload.Containers() {
+			names = append(names, c.Name)
+		}
+		assert.Equal(t, expected, names, id)
+
+		// Every container, including init containers, can be updated
+		for _, name := range expected {
+			ref, err := image.ParseRef("quay.io/example/new:v2")
+			assert.NoError(t, err)
+			assert.NoError(t, workload.SetContainerImage(name, ref), id)
+			for _, c := range workload.Containers() {
+				if c.Name == name {
+					assert.Equal(t, ref.String(), c.Image.String(), id)
+				}
+			}
+		}
+		assert.Error(t, workload.SetContainerImage("nonexistent", image.Ref{}), id)
+	}
+
+	// A container that gets its image from an image stream is left to
+	// OpenShift
+	dc := objs["default:deploymentconfig/web"].(resource.Workload)
+	assert.Error(t, dc.SetContainerImage("web", image.Ref{}))
+}
+
 func TestUnmarshalList(t *testing.T) {
 	doc := `---
 kind: List
@@ -165,7 +282,7 @@ items:
   metadata:
     name: bar
 `
-	res, err := unmarshalObject("", []byte(doc))
+	res, err := unmarshalObject("", position{doc: 1}, []byte(doc))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -185,6 +302,71 @@ items:
 	}
 }
 
+func TestParseListAndEmptyDocuments(t *testing.T) {
+	doc := `# just a comment, so not a document
+---
+kind: List
+metadata:
+  name: list
+items:
+- kind: Deployment
+  metadata:
+    name: foo
+- {}
+- kind: Service
+  metadata:
+    name: bar
+---
+# an empty document
+--- # a comment, and an empty document
+...
+kind: Namespace
+metadata:
+  name: baz
+---
+`
+	objs, err := ParseMultidoc([]byte(doc), "test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, expected := range map[string]string{
+		"default:deployment/foo": "test.yaml (document 1, item 1)",
+		"default:service/bar":    "test.yaml (document 1, item 3)",
+		"default:namespace/baz":  "test.yaml (document 4)",
+	} {
+		obj, ok := objs[id]
+		if !ok {
+			t.Errorf("expected %s to be parsed", id)
+			continue
+		}
+		if loc := location(obj); loc != expected {
+			t.Errorf("expected %s to be at %q, got %q", id, expected, loc)
+		}
+	}
+	if len(objs) != 3 {
+		t.Errorf("expected three resources, got %+v", objs)
+	}
+}
+
+func TestParseDuplicateInFile(t *testing.T) {
+	doc := `---
+kind: Deployment
+metadata:
+  name: foo
+---
+kind: List
+items:
+- kind: Deployment
+  metadata:
+    name: foo
+`
+	_, err := ParseMultidoc([]byte(doc), "test.yaml")
+	if err == nil {
+		t.Fatal("expected error for duplicate definition")
+	}
+	assert.Contains(t, err.Error(), "test.yaml (document 1) and test.yaml (document 2, item 1)")
+}
+
 func debyte(r resource.Resource) resource.Resource {
 	if res, ok := r.(interface {
 		debyte()
@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"fmt"
 	"strings"
 
 	yaml "gopkg.in/yaml.v2"
@@ -20,6 +21,7 @@ const (
 // struct to embed in objects, to provide default implementation
 type baseObject struct {
 	source string
+	pos    position
 	bytes  []byte
 	Kind   string `yaml:"kind"`
 	Meta   struct {
@@ -62,18 +64,46 @@ func (o baseObject) Source() string {
 	return o.source
 }
 
+// position records where in its source a resource was found, so
+// that more than one resource from a file can be told apart.
+type position struct {
+	doc  int // the document in the source, counting from 1
+	item int // the item, counting from 1, if in a List; otherwise 0
+	line int // the line the document starts on, counting from 1; 0 if not known
+}
+
+func (p position) String() string {
+	if p.item > 0 {
+		return fmt.Sprintf("document %d, item %d", p.doc, p.item)
+	}
+	return fmt.Sprintf("document %d", p.doc)
+}
+
+// location gives the source and the position in the source, for
+// messages.
+func (o baseObject) location() string {
+	return fmt.Sprintf("%s (%s)", o.source, o.pos)
+}
+
+// SourceLine gives the line in the source at which the document
+// defining the resource starts (for the items of a List, that's
+// where the List starts).
+func (o baseObject) SourceLine() int {
+	return o.pos.line
+}
+
 func (o baseObject) Bytes() []byte {
 	return o.bytes
 }
 
-func unmarshalObject(source string, bytes []byte) (resource.Resource, error) {
-	var base = baseObject{source: source, bytes: bytes}
+func unmarshalObject(source string, pos position, bytes []byte) (resource.Resource, error) {
+	var base = baseObject{source: source, pos: pos, bytes: bytes}
 	if err := yaml.Unmarshal(bytes, &base); err != nil {
 		return nil, err
 	}
 	r, err := unmarshalKind(base, bytes)
 	if err != nil {
-		return nil, makeUnmarshalObjectErr(source, err)
+		return nil, makeUnmarshalObjectErr(base.location(), err)
 	}
 	return r, nil
 }
@@ -98,6 +128,12 @@ func unmarshalKind(base baseObject, bytes []byte) (resource.Resource, error) {
 			return nil, err
 		}
 		return &dep, nil
+	case "DeploymentConfig":
+		var dc = DeploymentConfig{baseObject: base}
+		if err := yaml.Unmarshal(bytes, &dc); err != nil {
+			return nil, err
+		}
+		return &dc, nil
 	case "Namespace":
 		var ns = Namespace{baseObject: base}
 		if err := yaml.Unmarshal(bytes, &ns); err != nil {
@@ -116,7 +152,9 @@ func unmarshalKind(base baseObject, bytes []byte) (resource.Resource, error) {
 			return nil, err
 		}
 		var list List
-		unmarshalList(base, &raw, &list)
+		if err := unmarshalList(base, &raw, &list); err != nil {
+			return nil, err
+		}
 		return &list, nil
 	case "FluxHelmRelease":
 		var fhr = FluxHelmRelease{baseObject: base}
@@ -132,8 +170,16 @@ func unmarshalKind(base baseObject, bytes []byte) (resource.Resource, error) {
 		// assumption it is unlikely to happen.
 		return nil, nil
 	// The remainder are things we have to care about, but not
-	// treat specially
+	// treat specially -- unless they're custom resources with
+	// images registered
 	default:
+		w, err := unmarshalCustom(base, bytes)
+		if err != nil {
+			return nil, err
+		}
+		if w != nil {
+			return w, nil
+		}
 		return &base, nil
 	}
 }
@@ -142,28 +188,34 @@ type rawList struct {
 	Items []map[string]interface{}
 }
 
+// unmarshalList unmarshals the items of a List. Items that aren't
+// resources (i.e., have no kind) are skipped, as empty documents are.
 func unmarshalList(base baseObject, raw *rawList, list *List) error {
 	list.baseObject = base
-	list.Items = make([]resource.Resource, len(raw.Items), len(raw.Items))
+	list.Items = make([]resource.Resource, 0, len(raw.Items))
 	for i, item := range raw.Items {
 		bytes, err := yaml.Marshal(item)
 		if err != nil {
 			return err
 		}
-		res, err := unmarshalObject(base.source, bytes)
+		pos := base.pos
+		pos.item = i + 1
+		res, err := unmarshalObject(base.source, pos, bytes)
 		if err != nil {
 			return err
 		}
-		list.Items[i] = res
+		if res != nil {
+			list.Items = append(list.Items, res)
+		}
 	}
 	return nil
 }
 
-func makeUnmarshalObjectErr(source string, err error) *fluxerr.Error {
+func makeUnmarshalObjectErr(location string, err error) *fluxerr.Error {
 	return &fluxerr.Error{
 		Type: fluxerr.User,
 		Err:  err,
-		Help: `Could not parse "` + source + `".
+		Help: `Could not parse ` + location + `.
 
 This likely means it is malformed YAML.
 `,
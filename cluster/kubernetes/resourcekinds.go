@@ -7,6 +7,12 @@ import (
 	apibatch "k8s.io/api/batch/v1beta1"
 	apiv1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/weaveworks/flux"
 	fhr_v1alpha2 "github.com/weaveworks/flux/apis/helm.integrations.flux.weave.works/v1alpha2"
@@ -24,12 +30,22 @@ import (
 // `flux.ResourceID`.
 const AntecedentAnnotation = "flux.weave.works/antecedent"
 
+// ClusterIDAnnotation goes with the AntecedentAnnotation, when the
+// helm operator has been given an ID for the cluster it runs in, so
+// it's clear which cluster's FluxHelmRelease a resource came from.
+const ClusterIDAnnotation = "flux.weave.works/cluster-id"
+
 /////////////////////////////////////////////////////////////////////////////
 // Kind registry
 
 type resourceKind interface {
 	getPodController(c *Cluster, namespace, name string) (podController, error)
 	getPodControllers(c *Cluster, namespace string) ([]podController, error)
+	// For caching: how to list and watch the kind, or nil if it
+	// can't be; and how to make a pod controller from an object
+	// so got
+	listWatch(c *Cluster, namespace string) (*cache.ListWatch, runtime.Object)
+	toPodController(obj interface{}) podController
 }
 
 var (
@@ -40,6 +56,7 @@ func init() {
 	resourceKinds["cronjob"] = &cronJobKind{}
 	resourceKinds["daemonset"] = &daemonSetKind{}
 	resourceKinds["deployment"] = &deploymentKind{}
+	resourceKinds["deploymentconfig"] = &deploymentConfigKind{}
 	resourceKinds["statefulset"] = &statefulSetKind{}
 	resourceKinds["fluxhelmrelease"] = &fluxHelmReleaseKind{}
 }
@@ -50,22 +67,18 @@ type podController struct {
 	kind        string
 	name        string
 	status      string
+	rollout     cluster.RolloutStatus
 	podTemplate apiv1.PodTemplateSpec
 }
 
 func (pc podController) toClusterController(resourceID flux.ResourceID) cluster.Controller {
 	var clusterContainers []resource.Container
 	var excuse string
-	for _, container := range pc.podTemplate.Spec.Containers {
-		ref, err := image.ParseRef(container.Image)
-		if err != nil {
-			clusterContainers = nil
-			excuse = err.Error()
-			break
-		}
-		clusterContainers = append(clusterContainers, resource.Container{Name: container.Name, Image: ref})
-	}
-	for _, container := range pc.podTemplate.Spec.InitContainers {
+	// Init containers are included, so their images can be
+	// updated like any others.
+	containers := append([]apiv1.Container{}, pc.podTemplate.Spec.Containers...)
+	containers = append(containers, pc.podTemplate.Spec.InitContainers...)
+	for _, container := range containers {
 		ref, err := image.ParseRef(container.Image)
 		if err != nil {
 			clusterContainers = nil
@@ -86,6 +99,7 @@ func (pc podController) toClusterController(resourceID flux.ResourceID) cluster.
 	return cluster.Controller{
 		ID:         resourceID,
 		Status:     pc.status,
+		Rollout:    pc.rollout,
 		Antecedent: antecedent,
 		Labels:     pc.GetLabels(),
 		Containers: cluster.ContainersOrExcuse{Containers: clusterContainers, Excuse: excuse},
@@ -120,9 +134,31 @@ func (dk *deploymentKind) getPodControllers(c *Cluster, namespace string) ([]pod
 	return podControllers, nil
 }
 
+func (dk *deploymentKind) listWatch(c *Cluster, namespace string) (*cache.ListWatch, runtime.Object) {
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			return c.client.AppsV1().Deployments(namespace).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			return c.client.AppsV1().Deployments(namespace).Watch(options)
+		},
+	}, &apiapps.Deployment{}
+}
+
+func (dk *deploymentKind) toPodController(obj interface{}) podController {
+	return makeDeploymentPodController(obj.(*apiapps.Deployment))
+}
+
 func makeDeploymentPodController(deployment *apiapps.Deployment) podController {
 	var status string
 	objectMeta, deploymentStatus := deployment.ObjectMeta, deployment.Status
+	rollout := cluster.RolloutStatus{
+		Desired:   *deployment.Spec.Replicas,
+		Updated:   deploymentStatus.UpdatedReplicas,
+		Ready:     deploymentStatus.ReadyReplicas,
+		Available: deploymentStatus.AvailableReplicas,
+		Outdated:  deploymentStatus.Replicas - deploymentStatus.UpdatedReplicas,
+	}
 
 	if deploymentStatus.ObservedGeneration >= objectMeta.Generation {
 		// the definition has been updated; now let's see about the replicas
@@ -132,6 +168,17 @@ func makeDeploymentPodController(deployment *apiapps.Deployment) podController {
 		} else {
 			status = fmt.Sprintf("%d out of %d updated", updated, wanted)
 		}
+		// The deployment controller gives up on a rollout that
+		// hasn't made progress by its deadline
+		for _, c := range deploymentStatus.Conditions {
+			switch {
+			case c.Type == apiapps.DeploymentProgressing && c.Status == apiv1.ConditionFalse:
+				status = StatusError
+				rollout.Messages = append(rollout.Messages, c.Message)
+			case c.Type == apiapps.DeploymentReplicaFailure && c.Status == apiv1.ConditionTrue:
+				rollout.Messages = append(rollout.Messages, c.Message)
+			}
+		}
 	} else {
 		status = StatusUpdating
 	}
@@ -141,6 +188,7 @@ func makeDeploymentPodController(deployment *apiapps.Deployment) podController {
 		kind:        "Deployment",
 		name:        deployment.ObjectMeta.Name,
 		status:      status,
+		rollout:     rollout,
 		podTemplate: deployment.Spec.Template,
 		k8sObject:   deployment}
 }
@@ -173,9 +221,31 @@ func (dk *daemonSetKind) getPodControllers(c *Cluster, namespace string) ([]podC
 	return podControllers, nil
 }
 
+func (dk *daemonSetKind) listWatch(c *Cluster, namespace string) (*cache.ListWatch, runtime.Object) {
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			return c.client.AppsV1().DaemonSets(namespace).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			return c.client.AppsV1().DaemonSets(namespace).Watch(options)
+		},
+	}, &apiapps.DaemonSet{}
+}
+
+func (dk *daemonSetKind) toPodController(obj interface{}) podController {
+	return makeDaemonSetPodController(obj.(*apiapps.DaemonSet))
+}
+
 func makeDaemonSetPodController(daemonSet *apiapps.DaemonSet) podController {
 	var status string
 	objectMeta, daemonSetStatus := daemonSet.ObjectMeta, daemonSet.Status
+	rollout := cluster.RolloutStatus{
+		Desired:   daemonSetStatus.DesiredNumberScheduled,
+		Updated:   daemonSetStatus.UpdatedNumberScheduled,
+		Ready:     daemonSetStatus.NumberReady,
+		Available: daemonSetStatus.NumberAvailable,
+		Outdated:  daemonSetStatus.CurrentNumberScheduled - daemonSetStatus.UpdatedNumberScheduled,
+	}
 	if daemonSetStatus.ObservedGeneration >= objectMeta.Generation {
 		// the definition has been updated; now let's see about the replicas
 		updated, wanted := daemonSetStatus.UpdatedNumberScheduled, daemonSetStatus.DesiredNumberScheduled
@@ -193,6 +263,7 @@ func makeDaemonSetPodController(daemonSet *apiapps.DaemonSet) podController {
 		kind:        "DaemonSet",
 		name:        daemonSet.ObjectMeta.Name,
 		status:      status,
+		rollout:     rollout,
 		podTemplate: daemonSet.Spec.Template,
 		k8sObject:   daemonSet}
 }
@@ -225,9 +296,33 @@ func (dk *statefulSetKind) getPodControllers(c *Cluster, namespace string) ([]po
 	return podControllers, nil
 }
 
+func (dk *statefulSetKind) listWatch(c *Cluster, namespace string) (*cache.ListWatch, runtime.Object) {
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			return c.client.AppsV1().StatefulSets(namespace).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			return c.client.AppsV1().StatefulSets(namespace).Watch(options)
+		},
+	}, &apiapps.StatefulSet{}
+}
+
+func (dk *statefulSetKind) toPodController(obj interface{}) podController {
+	return makeStatefulSetPodController(obj.(*apiapps.StatefulSet))
+}
+
 func makeStatefulSetPodController(statefulSet *apiapps.StatefulSet) podController {
 	var status string
 	objectMeta, statefulSetStatus := statefulSet.ObjectMeta, statefulSet.Status
+	// Stateful sets don't distinguish between pods being ready and
+	// being available
+	rollout := cluster.RolloutStatus{
+		Desired:   *statefulSet.Spec.Replicas,
+		Updated:   statefulSetStatus.UpdatedReplicas,
+		Ready:     statefulSetStatus.ReadyReplicas,
+		Available: statefulSetStatus.ReadyReplicas,
+		Outdated:  statefulSetStatus.Replicas - statefulSetStatus.UpdatedReplicas,
+	}
 	// The type of ObservedGeneration is *int64, unlike other controllers.
 	if statefulSetStatus.ObservedGeneration >= objectMeta.Generation {
 		// the definition has been updated; now let's see about the replicas
@@ -246,6 +341,7 @@ func makeStatefulSetPodController(statefulSet *apiapps.StatefulSet) podControlle
 		kind:        "StatefulSet",
 		name:        statefulSet.ObjectMeta.Name,
 		status:      status,
+		rollout:     rollout,
 		podTemplate: statefulSet.Spec.Template,
 		k8sObject:   statefulSet}
 }
@@ -278,6 +374,21 @@ func (dk *cronJobKind) getPodControllers(c *Cluster, namespace string) ([]podCon
 	return podControllers, nil
 }
 
+func (dk *cronJobKind) listWatch(c *Cluster, namespace string) (*cache.ListWatch, runtime.Object) {
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			return c.client.BatchV1beta1().CronJobs(namespace).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			return c.client.BatchV1beta1().CronJobs(namespace).Watch(options)
+		},
+	}, &apibatch.CronJob{}
+}
+
+func (dk *cronJobKind) toPodController(obj interface{}) podController {
+	return makeCronJobPodController(obj.(*apibatch.CronJob))
+}
+
 func makeCronJobPodController(cronJob *apibatch.CronJob) podController {
 	return podController{
 		apiVersion:  "batch/v1beta1",
@@ -288,6 +399,158 @@ func makeCronJobPodController(cronJob *apibatch.CronJob) podController {
 		k8sObject:   cronJob}
 }
 
+/////////////////////////////////////////////////////////////////////////////
+// apps.openshift.io/v1 DeploymentConfig
+
+// There's no typed client for OpenShift's kinds here, so deployment
+// configs are got with the dynamic client. Whether the API server has
+// them is found by discovery, so clusters that aren't OpenShift
+// aren't asked for them every time the workloads are listed.
+type deploymentConfigKind struct{}
+
+var deploymentConfigKindName = schema.GroupKind{Group: "apps.openshift.io", Kind: "DeploymentConfig"}
+
+// deploymentConfig is the parts of a deployment config that are
+// looked at, as it's decoded from an unstructured object.
+type deploymentConfig struct {
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               struct {
+		Replicas int32                         `json:"replicas"`
+		Template *apiv1.PodTemplateSpec        `json:"template"`
+		Triggers []kresource.DeploymentTrigger `json:"triggers"`
+	} `json:"spec"`
+	Status struct {
+		ObservedGeneration int64 `json:"observedGeneration"`
+		Replicas           int32 `json:"replicas"`
+		UpdatedReplicas    int32 `json:"updatedReplicas"`
+		ReadyReplicas      int32 `json:"readyReplicas"`
+		AvailableReplicas  int32 `json:"availableReplicas"`
+		Conditions         []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+func (dk *deploymentConfigKind) resources(c *Cluster, namespace string) (dynamic.ResourceInterface, error) {
+	return c.dynamicResources(deploymentConfigKindName, namespace)
+}
+
+func (dk *deploymentConfigKind) getPodController(c *Cluster, namespace, name string) (podController, error) {
+	resources, err := dk.resources(c, namespace)
+	if err != nil {
+		return podController{}, err
+	}
+	obj, err := resources.Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		return podController{}, err
+	}
+	return makeDeploymentConfigPodController(obj)
+}
+
+func (dk *deploymentConfigKind) getPodControllers(c *Cluster, namespace string) ([]podController, error) {
+	resources, err := dk.resources(c, namespace)
+	if err != nil {
+		return nil, err
+	}
+	list, err := resources.List(meta_v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var podControllers []podController
+	for i := range list.Items {
+		pc, err := makeDeploymentConfigPodController(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		podControllers = append(podControllers, pc)
+	}
+	return podControllers, nil
+}
+
+func (dk *deploymentConfigKind) listWatch(c *Cluster, namespace string) (*cache.ListWatch, runtime.Object) {
+	resources, err := dk.resources(c, namespace)
+	if err != nil {
+		return nil, nil
+	}
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			return resources.List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			return resources.Watch(options)
+		},
+	}, &unstructured.Unstructured{}
+}
+
+func (dk *deploymentConfigKind) toPodController(obj interface{}) podController {
+	pc, _ := makeDeploymentConfigPodController(obj.(*unstructured.Unstructured))
+	return pc
+}
+
+// makeDeploymentConfigPodController interprets a deployment config
+// much as a deployment is. Containers that get their image from an
+// image stream are left out, as they are from its manifest, since
+// OpenShift looks after their images.
+func makeDeploymentConfigPodController(obj *unstructured.Unstructured) (podController, error) {
+	var dc deploymentConfig
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &dc); err != nil {
+		return podController{}, err
+	}
+
+	var podTemplate apiv1.PodTemplateSpec
+	if dc.Spec.Template != nil {
+		podTemplate = *dc.Spec.Template
+	}
+	triggered := kresource.ImageTriggeredContainers(dc.Spec.Triggers)
+	var containers []apiv1.Container
+	for _, container := range podTemplate.Spec.Containers {
+		if !triggered[container.Name] {
+			containers = append(containers, container)
+		}
+	}
+	podTemplate.Spec.Containers = containers
+
+	var status string
+	rollout := cluster.RolloutStatus{
+		Desired:   dc.Spec.Replicas,
+		Updated:   dc.Status.UpdatedReplicas,
+		Ready:     dc.Status.ReadyReplicas,
+		Available: dc.Status.AvailableReplicas,
+		Outdated:  dc.Status.Replicas - dc.Status.UpdatedReplicas,
+	}
+	if dc.Status.ObservedGeneration >= dc.Generation {
+		updated, wanted := dc.Status.UpdatedReplicas, dc.Spec.Replicas
+		if updated == wanted {
+			status = StatusReady
+		} else {
+			status = fmt.Sprintf("%d out of %d updated", updated, wanted)
+		}
+		// As with deployments, a rollout that hasn't made progress
+		// by its deadline has failed
+		for _, c := range dc.Status.Conditions {
+			if c.Type == "Progressing" && c.Status == string(apiv1.ConditionFalse) {
+				status = StatusError
+				rollout.Messages = append(rollout.Messages, c.Message)
+			}
+		}
+	} else {
+		status = StatusUpdating
+	}
+
+	return podController{
+		apiVersion:  "apps.openshift.io/v1",
+		kind:        "DeploymentConfig",
+		name:        obj.GetName(),
+		status:      status,
+		rollout:     rollout,
+		podTemplate: podTemplate,
+		k8sObject:   customObject{obj},
+	}, nil
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // helm.integrations.flux.weave.works/v1alpha2 FluxHelmRelease
 
@@ -316,6 +579,24 @@ func (fhr *fluxHelmReleaseKind) getPodControllers(c *Cluster, namespace string)
 	return podControllers, nil
 }
 
+func (fhr *fluxHelmReleaseKind) listWatch(c *Cluster, namespace string) (*cache.ListWatch, runtime.Object) {
+	if c.client.fluxHelmClient == nil {
+		return nil, nil
+	}
+	return &cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			return c.client.HelmV1alpha2().FluxHelmReleases(namespace).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			return c.client.HelmV1alpha2().FluxHelmReleases(namespace).Watch(options)
+		},
+	}, &fhr_v1alpha2.FluxHelmRelease{}
+}
+
+func (fhr *fluxHelmReleaseKind) toPodController(obj interface{}) podController {
+	return makeFluxHelmReleasePodController(obj.(*fhr_v1alpha2.FluxHelmRelease))
+}
+
 func makeFluxHelmReleasePodController(fluxHelmRelease *fhr_v1alpha2.FluxHelmRelease) podController {
 	containers := createK8sFHRContainers(fluxHelmRelease.Spec)
 
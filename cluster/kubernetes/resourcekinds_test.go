@@ -0,0 +1,252 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	apiapps "k8s.io/api/apps/v1"
+	apibatchv1 "k8s.io/api/batch/v1"
+	apibatch "k8s.io/api/batch/v1beta1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	fakekubernetes "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+)
+
+func TestSomeControllers_AllContainers(t *testing.T) {
+	replicas := int32(1)
+	podSpec := apiv1.PodSpec{
+		InitContainers: []apiv1.Container{{Name: "init", Image: "busybox:1.28"}},
+		Containers: []apiv1.Container{
+			{Name: "main", Image: "quay.io/example/main:v1"},
+			{Name: "sidecar", Image: "quay.io/example/sidecar:v1"},
+		},
+	}
+	clientset := fakekubernetes.NewSimpleClientset(
+		&apibatch.CronJob{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "job", Namespace: "default"},
+			Spec: apibatch.CronJobSpec{
+				JobTemplate: apibatch.JobTemplateSpec{
+					Spec: apibatchv1.JobSpec{
+						Template: apiv1.PodTemplateSpec{Spec: podSpec},
+					},
+				},
+			},
+		},
+		&apiapps.StatefulSet{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "sts", Namespace: "default"},
+			Spec: apiapps.StatefulSetSpec{
+				Replicas: &replicas,
+				Template: apiv1.PodTemplateSpec{Spec: podSpec},
+			},
+		},
+		&apiapps.DaemonSet{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "ds", Namespace: "default"},
+			Spec: apiapps.DaemonSetSpec{
+				Template: apiv1.PodTemplateSpec{Spec: podSpec},
+			},
+		},
+	)
+
+	c := NewCluster(clientset, nil, nil, nil, nil, log.NewNopLogger(), ClusterOptions{})
+	controllers, err := c.SomeControllers([]flux.ResourceID{
+		flux.MustParseResourceID("default:cronjob/job"),
+		flux.MustParseResourceID("default:statefulset/sts"),
+		flux.MustParseResourceID("default:daemonset/ds"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(controllers) != 3 {
+		t.Fatalf("expected three controllers, got %d", len(controllers))
+	}
+
+	expected := map[string]string{
+		"main":    "quay.io/example/main:v1",
+		"sidecar": "quay.io/example/sidecar:v1",
+		"init":    "busybox:1.28",
+	}
+	for _, controller := range controllers {
+		containers, err := controller.ContainersOrError()
+		if err != nil {
+			t.Errorf("%s: %s", controller.ID, err)
+			continue
+		}
+		got := map[string]string{}
+		for _, c := range containers {
+			got[c.Name] = c.Image.String()
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected containers %v, got %v", controller.ID, expected, got)
+		}
+	}
+}
+
+func TestToClusterController_Excuse(t *testing.T) {
+	pc := podController{
+		k8sObject: &apiapps.Deployment{},
+		podTemplate: apiv1.PodTemplateSpec{
+			Spec: apiv1.PodSpec{
+				Containers:     []apiv1.Container{{Name: "main", Image: ":latest"}},
+				InitContainers: []apiv1.Container{{Name: "init", Image: "busybox:1.28"}},
+			},
+		},
+	}
+	controller := pc.toClusterController(flux.MustParseResourceID("default:deployment/bad"))
+	if controller.Containers.Excuse == "" || len(controller.Containers.Containers) != 0 {
+		t.Errorf("expected an excuse and no containers, got %+v", controller.Containers)
+	}
+}
+
+func TestDeploymentRolloutStatus(t *testing.T) {
+	replicas := int32(2)
+	deployment := &apiapps.Deployment{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "app", Namespace: "default", Generation: 2},
+		Spec:       apiapps.DeploymentSpec{Replicas: &replicas},
+		Status: apiapps.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           3,
+			UpdatedReplicas:    1,
+			ReadyReplicas:      2,
+			AvailableReplicas:  2,
+		},
+	}
+
+	pc := makeDeploymentPodController(deployment)
+	if pc.status != "1 out of 2 updated" {
+		t.Errorf("expected status to say how many pods are updated, got %q", pc.status)
+	}
+	expected := cluster.RolloutStatus{Desired: 2, Updated: 1, Ready: 2, Available: 2, Outdated: 2}
+	if !reflect.DeepEqual(pc.rollout, expected) {
+		t.Errorf("expected rollout %+v, got %+v", expected, pc.rollout)
+	}
+
+	deployment.Status.Conditions = []apiapps.DeploymentCondition{{
+		Type:    apiapps.DeploymentProgressing,
+		Status:  apiv1.ConditionFalse,
+		Reason:  "ProgressDeadlineExceeded",
+		Message: `ReplicaSet "app-5d4f" has timed out progressing.`,
+	}}
+	pc = makeDeploymentPodController(deployment)
+	if pc.status != StatusError {
+		t.Errorf("expected status %q once the progress deadline has passed, got %q", StatusError, pc.status)
+	}
+	if len(pc.rollout.Messages) != 1 || pc.rollout.Messages[0] != deployment.Status.Conditions[0].Message {
+		t.Errorf("expected the condition's message in the rollout status, got %v", pc.rollout.Messages)
+	}
+}
+
+func TestDeploymentConfigControllers(t *testing.T) {
+	dc := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps.openshift.io/v1",
+		"kind":       "DeploymentConfig",
+		"metadata": map[string]interface{}{
+			"name":       "web",
+			"namespace":  "default",
+			"generation": int64(3),
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"triggers": []interface{}{
+				map[string]interface{}{"type": "ConfigChange"},
+				map[string]interface{}{
+					"type": "ImageChange",
+					"imageChangeParams": map[string]interface{}{
+						"automatic":      true,
+						"containerNames": []interface{}{"web"},
+						"from":           map[string]interface{}{"kind": "ImageStreamTag", "name": "web:latest"},
+					},
+				},
+			},
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "web", "image": "172.30.1.1:5000/default/web@sha256:0123"},
+						map[string]interface{}{"name": "proxy", "image": "quay.io/example/proxy:v1"},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"observedGeneration": int64(3),
+			"replicas":           int64(2),
+			"updatedReplicas":    int64(2),
+			"readyReplicas":      int64(2),
+			"availableReplicas":  int64(2),
+		},
+	}}
+	clientset := scaledClientset()
+	clientset.Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "apps.openshift.io/v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "deploymentconfigs", Kind: "DeploymentConfig", Namespaced: true},
+			},
+		},
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), dc)
+	c := NewCluster(clientset, nil, dynamicClient, &bytesApplier{}, nil, log.NewNopLogger(), ClusterOptions{})
+
+	// Deployment configs can be cached, like the other workloads
+	if lw, obj := (&deploymentConfigKind{}).listWatch(c, "default"); lw == nil || obj == nil {
+		t.Error("expected deployment configs to be listed and watched for caching")
+	}
+
+	controllers, err := c.SomeControllers([]flux.ResourceID{flux.MustParseResourceID("default:deploymentconfig/web")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(controllers) != 1 {
+		t.Fatalf("expected one controller, got %d", len(controllers))
+	}
+	controller := controllers[0]
+	if controller.Status != StatusReady {
+		t.Errorf("expected status %q, got %q", StatusReady, controller.Status)
+	}
+	// The container whose image comes from the image stream is left
+	// out
+	containers, err := controller.ContainersOrError()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Name != "proxy" || containers[0].Image.String() != "quay.io/example/proxy:v1" {
+		t.Errorf("expected only the proxy container, got %+v", containers)
+	}
+
+	// Without a dynamic client, the kind is treated as not supported
+	// by the API server, as it is in clusters that aren't OpenShift
+	c = NewCluster(scaledClientset(), nil, nil, &bytesApplier{}, nil, log.NewNopLogger(), ClusterOptions{})
+	if _, err := (&deploymentConfigKind{}).getPodControllers(c, "default"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected a NotFound error, got %v", err)
+	}
+
+	// In clusters that aren't OpenShift, discovery says so, and
+	// deployment configs aren't asked for
+	clientset = scaledClientset()
+	clientset.Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true},
+			},
+		},
+	}
+	dynamicClient = fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	c = NewCluster(clientset, nil, dynamicClient, &bytesApplier{}, nil, log.NewNopLogger(), ClusterOptions{})
+	if _, err := (&deploymentConfigKind{}).getPodControllers(c, "default"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected a NotFound error, got %v", err)
+	}
+	if lw, _ := (&deploymentConfigKind{}).listWatch(c, "default"); lw != nil {
+		t.Error("expected deployment configs not to be cached")
+	}
+	if actions := dynamicClient.Actions(); len(actions) > 0 {
+		t.Errorf("expected no requests for deployment configs, got %s", actions[0].GetVerb())
+	}
+}
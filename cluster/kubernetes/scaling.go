@@ -0,0 +1,147 @@
+package kubernetes
+
+import (
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	apiautoscaling "k8s.io/api/autoscaling/v1"
+	apipolicy "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/weaveworks/flux/cluster"
+)
+
+// scaling is the horizontal pod autoscalers and pod disruption
+// budgets in a namespace, so they can be related to workloads.
+type scaling struct {
+	autoscalers []apiautoscaling.HorizontalPodAutoscaler
+	budgets     []apipolicy.PodDisruptionBudget
+}
+
+// getScaling fetches the autoscalers and disruption budgets in the
+// namespace given. If they can't be listed because flux is not
+// allowed to see them, or the API server doesn't have them, they are
+// left out rather than treated as an error. Otherwise, whichever
+// could be listed are returned along with the error.
+func (c *Cluster) getScaling(namespace string) (scaling, error) {
+	var s scaling
+	var firstErr error
+	hpas, err := c.client.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(meta_v1.ListOptions{})
+	switch {
+	case err == nil:
+		s.autoscalers = hpas.Items
+	case !ignorableListError(err):
+		firstErr = err
+	}
+	pdbs, err := c.client.PolicyV1beta1().PodDisruptionBudgets(namespace).List(meta_v1.ListOptions{})
+	switch {
+	case err == nil:
+		s.budgets = pdbs.Items
+	case !ignorableListError(err) && firstErr == nil:
+		firstErr = err
+	}
+	return s, firstErr
+}
+
+// getScalingOrWarn fetches the autoscalers and disruption budgets in
+// the namespace given, for reporting along with workloads. Since
+// they are only informational, failing to list them is logged rather
+// than failing the listing of workloads.
+func (c *Cluster) getScalingOrWarn(namespace string) scaling {
+	s, err := c.getScaling(namespace)
+	if err != nil {
+		c.logger.Log("warning", "unable to list autoscalers and disruption budgets", "namespace", namespace, "err", err)
+	}
+	return s
+}
+
+func ignorableListError(err error) bool {
+	return apierrors.IsForbidden(err) || apierrors.IsNotFound(err)
+}
+
+// autoscaler returns the autoscaler targeting the workload with the
+// kind and name given, if there is one.
+func (s scaling) autoscaler(kind, name string) *apiautoscaling.HorizontalPodAutoscaler {
+	for i, hpa := range s.autoscalers {
+		ref := hpa.Spec.ScaleTargetRef
+		if strings.EqualFold(ref.Kind, kind) && ref.Name == name {
+			return &s.autoscalers[i]
+		}
+	}
+	return nil
+}
+
+// annotate fills in the autoscaler and disruption budgets for a
+// controller.
+func (s scaling) annotate(ctrl *cluster.Controller, pc podController) {
+	if hpa := s.autoscaler(pc.kind, pc.name); hpa != nil {
+		min := int32(1)
+		if hpa.Spec.MinReplicas != nil {
+			min = *hpa.Spec.MinReplicas
+		}
+		ctrl.Autoscaler = &cluster.Autoscaler{
+			Name:            hpa.Name,
+			MinReplicas:     min,
+			MaxReplicas:     hpa.Spec.MaxReplicas,
+			CurrentReplicas: hpa.Status.CurrentReplicas,
+		}
+	}
+
+	podLabels := labels.Set(pc.podTemplate.Labels)
+	if len(podLabels) == 0 {
+		return
+	}
+	for _, pdb := range s.budgets {
+		if pdb.Spec.Selector == nil {
+			continue
+		}
+		selector, err := meta_v1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() || !selector.Matches(podLabels) {
+			continue
+		}
+		budget := cluster.DisruptionBudget{Name: pdb.Name}
+		if pdb.Spec.MinAvailable != nil {
+			budget.MinAvailable = pdb.Spec.MinAvailable.String()
+		}
+		if pdb.Spec.MaxUnavailable != nil {
+			budget.MaxUnavailable = pdb.Spec.MaxUnavailable.String()
+		}
+		ctrl.DisruptionBudgets = append(ctrl.DisruptionBudgets, budget)
+	}
+}
+
+// scalableKinds are the kinds of workload that have `spec.replicas`,
+// and may be scaled by an autoscaler.
+var scalableKinds = map[string]bool{
+	"Deployment":            true,
+	"DeploymentConfig":      true,
+	"StatefulSet":           true,
+	"ReplicaSet":            true,
+	"ReplicationController": true,
+}
+
+// autoscaled reports whether the object given is a workload that's
+// the target of a horizontal pod autoscaler, in which case its
+// `spec.replicas` is left out when it's applied, so that syncing
+// doesn't undo the autoscaler's work. The scaling for each namespace
+// is looked up at most once, and kept in `scalings`.
+func (c *Cluster) autoscaled(logger log.Logger, obj *apiObject, scalings map[string]scaling) bool {
+	if !scalableKinds[obj.Kind] {
+		return false
+	}
+	namespace := obj.Metadata.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	s, ok := scalings[namespace]
+	if !ok {
+		var err error
+		if s, err = c.getScaling(namespace); err != nil {
+			logger.Log("warning", "unable to list autoscalers", "namespace", namespace, "err", err)
+		}
+		scalings[namespace] = s
+	}
+	return s.autoscaler(obj.Kind, obj.Metadata.Name) != nil
+}
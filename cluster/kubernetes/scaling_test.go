@@ -0,0 +1,176 @@
+package kubernetes
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	apiapps "k8s.io/api/apps/v1"
+	apiautoscaling "k8s.io/api/autoscaling/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apipolicy "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	fakekubernetes "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+func scaledClientset() *fakekubernetes.Clientset {
+	replicas := int32(2)
+	minReplicas := int32(2)
+	minAvailable := intstr.FromInt(1)
+	podLabels := map[string]string{"app": "web"}
+	return fakekubernetes.NewSimpleClientset(
+		newNamespace("default"),
+		&apiapps.Deployment{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: apiapps.DeploymentSpec{
+				Replicas: &replicas,
+				Template: apiv1.PodTemplateSpec{
+					ObjectMeta: meta_v1.ObjectMeta{Labels: podLabels},
+				},
+			},
+		},
+		&apiautoscaling.HorizontalPodAutoscaler{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "web-hpa", Namespace: "default"},
+			Spec: apiautoscaling.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: apiautoscaling.CrossVersionObjectReference{Kind: "Deployment", Name: "web", APIVersion: "apps/v1"},
+				MinReplicas:    &minReplicas,
+				MaxReplicas:    10,
+			},
+			Status: apiautoscaling.HorizontalPodAutoscalerStatus{CurrentReplicas: 4},
+		},
+		&apipolicy.PodDisruptionBudget{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "web-pdb", Namespace: "default"},
+			Spec: apipolicy.PodDisruptionBudgetSpec{
+				MinAvailable: &minAvailable,
+				Selector:     &meta_v1.LabelSelector{MatchLabels: podLabels},
+			},
+		},
+	)
+}
+
+func TestSomeControllers_Scaling(t *testing.T) {
+	c := NewCluster(scaledClientset(), nil, nil, nil, nil, log.NewNopLogger(), ClusterOptions{})
+	controllers, err := c.SomeControllers([]flux.ResourceID{flux.MustParseResourceID("default:deployment/web")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(controllers) != 1 {
+		t.Fatalf("expected one controller, got %d", len(controllers))
+	}
+
+	expected := cluster.Autoscaler{Name: "web-hpa", MinReplicas: 2, MaxReplicas: 10, CurrentReplicas: 4}
+	if a := controllers[0].Autoscaler; a == nil || *a != expected {
+		t.Errorf("expected autoscaler %+v, got %+v", expected, a)
+	}
+	budgets := controllers[0].DisruptionBudgets
+	if len(budgets) != 1 || budgets[0] != (cluster.DisruptionBudget{Name: "web-pdb", MinAvailable: "1"}) {
+		t.Errorf("unexpected disruption budgets %+v", budgets)
+	}
+}
+
+func TestSomeControllers_ScalingUnavailable(t *testing.T) {
+	clientset := scaledClientset()
+	clientset.PrependReactor("list", "horizontalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewInternalError(errors.New("boom"))
+	})
+	c := NewCluster(clientset, nil, nil, nil, nil, log.NewNopLogger(), ClusterOptions{})
+	controllers, err := c.SomeControllers([]flux.ResourceID{flux.MustParseResourceID("default:deployment/web")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(controllers) != 1 || controllers[0].Autoscaler != nil || len(controllers[0].DisruptionBudgets) != 1 {
+		t.Errorf("expected the controller with its disruption budget but no autoscaler, got %+v", controllers)
+	}
+}
+
+func TestSyncAutoscaled(t *testing.T) {
+	applier := &bytesApplier{}
+	c := NewCluster(scaledClientset(), nil, nil, applier, nil, log.NewNopLogger(), ClusterOptions{})
+	err := c.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{Apply: rsc{"default:deployment/web", []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2\n  template: {}\n")}},
+			{Apply: rsc{"default:deployment/other", []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: other\nspec:\n  replicas: 2\n")}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def := applier.applied["web"]; strings.Contains(def, "replicas") || !strings.Contains(def, "template") {
+		t.Errorf("expected replicas to be removed from autoscaled deployment, got:\n%s", def)
+	}
+	if def := applier.applied["other"]; !strings.Contains(def, "replicas: 2") {
+		t.Errorf("expected replicas to be kept for deployment without autoscaler, got:\n%s", def)
+	}
+}
+
+// fakeKubectl stands in for kubectl: it records its arguments,
+// reports a last applied configuration with replicas, and records
+// the last applied configuration set.
+const fakeKubectl = `#!/bin/sh
+dir=$(dirname "$0")
+echo "$*" >> "$dir/log"
+case "$*" in
+  *view-last-applied*) echo '{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"},"spec":{"replicas":3}}' ;;
+  *set-last-applied*) cat > "$dir/last-applied" ;;
+  *) cat > /dev/null ;;
+esac
+`
+
+func TestKubectlSyncAutoscaled(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	exe := filepath.Join(dir, "kubectl")
+	if err := ioutil.WriteFile(exe, []byte(fakeKubectl), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCluster(scaledClientset(), nil, nil, NewKubectl(exe, &rest.Config{}), nil, log.NewNopLogger(), ClusterOptions{})
+	err := c.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{Apply: rsc{"default:deployment/web", []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2\n")}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastApplied, err := ioutil.ReadFile(filepath.Join(dir, "last-applied"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(lastApplied), "replicas") {
+		t.Errorf("expected replicas to be removed from the last applied configuration, got %s", lastApplied)
+	}
+	calls, err := ioutil.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := strings.Split(strings.TrimSpace(string(calls)), "\n")
+	if len(commands) != 3 || !strings.Contains(commands[1], "set-last-applied") || commands[2] != "apply -f -" {
+		t.Errorf("expected the last applied configuration to be set before applying, got %q", commands)
+	}
+}
+
+type bytesApplier struct {
+	applied map[string]string
+}
+
+func (a *bytesApplier) apply(_ log.Logger, cs changeSet) cluster.SyncError {
+	a.applied = map[string]string{}
+	for _, obj := range cs.objs["apply"] {
+		a.applied[obj.Metadata.Name] = string(obj.Bytes())
+	}
+	return nil
+}
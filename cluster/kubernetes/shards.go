@@ -0,0 +1,133 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	k8sclient "k8s.io/client-go/kubernetes"
+
+	"github.com/weaveworks/flux"
+)
+
+// How many times to try claiming resources, when another shard
+// updates the claims at the same time.
+const claimAttempts = 5
+
+// ShardClaims records the resources each shard (that is, each of
+// several fluxd instances syncing from the same repo) manages in a
+// ConfigMap, with an entry per shard. The ConfigMap is updated with
+// optimistic concurrency, so whichever shard claims a resource first
+// keeps it, for as long as it keeps claiming it.
+type ShardClaims struct {
+	client    k8sclient.Interface
+	namespace string
+	name      string
+	shard     string
+	ttl       time.Duration
+}
+
+// shardClaim is the entry for a shard in the ConfigMap. A shard that
+// has stopped syncing doesn't keep its resources forever: the claim
+// lapses once it expires.
+type shardClaim struct {
+	Expires   time.Time         `json:"expires"`
+	Resources []flux.ResourceID `json:"resources"`
+}
+
+// NewShardClaims records the claims of the named shard in the named
+// ConfigMap, which will be created if necessary. Each claim lasts for
+// the time-to-live given, unless renewed. The shard's name is the key
+// of its entry, so it must be a valid ConfigMap key.
+func NewShardClaims(client k8sclient.Interface, namespace, name, shard string, ttl time.Duration) (*ShardClaims, error) {
+	if errs := validation.IsConfigMapKey(shard); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid shard name %q: %s", shard, strings.Join(errs, "; "))
+	}
+	return &ShardClaims{client: client, namespace: namespace, name: name, shard: shard, ttl: ttl}, nil
+}
+
+func (s *ShardClaims) Claim(ctx context.Context, ids []flux.ResourceID) (map[flux.ResourceID]string, error) {
+	for attempt := 1; ; attempt++ {
+		conflicts, err := s.tryClaim(ids)
+		if (apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)) && attempt < claimAttempts {
+			continue
+		}
+		return conflicts, err
+	}
+}
+
+func (s *ShardClaims) tryClaim(ids []flux.ResourceID) (map[flux.ResourceID]string, error) {
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(s.name, meta_v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	claimedBy := map[flux.ResourceID]string{}
+	if cm != nil {
+		// Go through the shards in order, so if (somehow) more than
+		// one has claimed a resource, the same one is reported
+		var shards []string
+		for shard := range cm.Data {
+			if shard != s.shard {
+				shards = append(shards, shard)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(shards)))
+		for _, shard := range shards {
+			var claim shardClaim
+			if err := json.Unmarshal([]byte(cm.Data[shard]), &claim); err != nil {
+				return nil, errors.Wrapf(err, "reading claims of shard %q", shard)
+			}
+			if claim.Expires.Before(now) {
+				// The shard has stopped syncing (or been renamed);
+				// drop its entry, so they don't pile up
+				delete(cm.Data, shard)
+				continue
+			}
+			for _, id := range claim.Resources {
+				claimedBy[id] = shard
+			}
+		}
+	}
+
+	conflicts := map[flux.ResourceID]string{}
+	mine := []flux.ResourceID{}
+	for _, id := range ids {
+		if shard, ok := claimedBy[id]; ok {
+			conflicts[id] = shard
+		} else {
+			mine = append(mine, id)
+		}
+	}
+	sort.Slice(mine, func(i, j int) bool { return mine[i].String() < mine[j].String() })
+	claim, err := json.Marshal(shardClaim{Expires: now.Add(s.ttl), Resources: mine})
+	if err != nil {
+		return nil, err
+	}
+
+	if cm == nil {
+		_, err = configMaps.Create(&apiv1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+			Data:       map[string]string{s.shard: string(claim)},
+		})
+		return conflicts, err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[s.shard] = string(claim)
+	_, err = configMaps.Update(cm)
+	return conflicts, err
+}
@@ -0,0 +1,83 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakekubernetes "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/weaveworks/flux"
+	fluxsync "github.com/weaveworks/flux/sync"
+)
+
+// As with SyncState, this is checked here to keep the sync package's
+// tests free of import cycles.
+var _ fluxsync.Claims = &ShardClaims{}
+
+func TestShardClaims(t *testing.T) {
+	ctx := context.Background()
+	clientset := fakekubernetes.NewSimpleClientset(newNamespace("flux"))
+	a, err := NewShardClaims(clientset, "flux", "flux-shards", "a", time.Hour)
+	assert.NoError(t, err)
+	b, err := NewShardClaims(clientset, "flux", "flux-shards", "b", time.Hour)
+	assert.NoError(t, err)
+	x, y, z := flux.MustParseResourceID("default:deployment/x"), flux.MustParseResourceID("default:deployment/y"), flux.MustParseResourceID("default:deployment/z")
+
+	conflicts, err := a.Claim(ctx, []flux.ResourceID{x, y})
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	// The first to claim a resource keeps it ..
+	conflicts, err = b.Claim(ctx, []flux.ResourceID{y, z})
+	assert.NoError(t, err)
+	assert.Equal(t, map[flux.ResourceID]string{y: "a"}, conflicts)
+	conflicts, err = a.Claim(ctx, []flux.ResourceID{x, y})
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	// .. until it stops claiming it
+	conflicts, err = a.Claim(ctx, []flux.ResourceID{x})
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+	conflicts, err = b.Claim(ctx, []flux.ResourceID{y, z})
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+}
+
+func TestShardClaimsExpire(t *testing.T) {
+	ctx := context.Background()
+	clientset := fakekubernetes.NewSimpleClientset(newNamespace("flux"))
+	gone, err := NewShardClaims(clientset, "flux", "flux-shards", "gone", -time.Second)
+	assert.NoError(t, err)
+	b, err := NewShardClaims(clientset, "flux", "flux-shards", "b", time.Hour)
+	assert.NoError(t, err)
+	x := flux.MustParseResourceID("default:deployment/x")
+
+	_, err = gone.Claim(ctx, []flux.ResourceID{x})
+	assert.NoError(t, err)
+	conflicts, err := b.Claim(ctx, []flux.ResourceID{x})
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	// The expired claim is dropped from the ConfigMap
+	cm, err := clientset.CoreV1().ConfigMaps("flux").Get("flux-shards", meta_v1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.NotContains(t, cm.Data, "gone")
+		assert.Contains(t, cm.Data, "b")
+	}
+}
+
+func TestShardClaimsName(t *testing.T) {
+	clientset := fakekubernetes.NewSimpleClientset()
+	for _, name := range []string{"a", "shard-1", "eu.west_2"} {
+		_, err := NewShardClaims(clientset, "flux", "flux-shards", name, time.Hour)
+		assert.NoError(t, err, name)
+	}
+	for _, name := range []string{"", "eu/west", "shard 1", "..", "shärd"} {
+		_, err := NewShardClaims(clientset, "flux", "flux-shards", name, time.Hour)
+		assert.Error(t, err, name)
+	}
+}
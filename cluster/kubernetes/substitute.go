@@ -0,0 +1,257 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// The kinds of resource variables can be taken from
+const (
+	VarSourceConfigMap = "configmap"
+	VarSourceSecret    = "secret"
+)
+
+// VarSource is a ConfigMap or Secret whose entries are substituted for
+// `${NAME}` placeholders in the manifests of resources with the
+// `substitute` policy, when they're applied.
+type VarSource struct {
+	Kind      string // VarSourceConfigMap or VarSourceSecret
+	Namespace string
+	Name      string
+}
+
+func (s VarSource) String() string {
+	return s.Namespace + "/" + s.Kind + "/" + s.Name
+}
+
+// ParseVarSource parses a source given as `[namespace/]kind/name`,
+// e.g., `configmap/cluster-vars`; without a namespace, it's in the
+// namespace given.
+func ParseVarSource(s, namespace string) (VarSource, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) == 2 {
+		parts = append([]string{namespace}, parts...)
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return VarSource{}, fmt.Errorf("expected [namespace/]configmap/name or [namespace/]secret/name, got %q", s)
+	}
+	kind := strings.ToLower(parts[1])
+	if kind != VarSourceConfigMap && kind != VarSourceSecret {
+		return VarSource{}, fmt.Errorf("unknown kind %q; expected configmap or secret", parts[1])
+	}
+	return VarSource{Kind: kind, Namespace: parts[0], Name: parts[2]}, nil
+}
+
+// A placeholder is `${NAME}`; `$${NAME}` stands for the text
+// `${NAME}` itself.
+var varRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substitutionVars reads the variables from the sources given to the
+// cluster; where sources have an entry with the same name, the last
+// given wins. It also gives the values that came from Secrets, so
+// they can be kept out of what's shown of the manifests.
+func (c *Cluster) substitutionVars() (vars map[string]string, secretValues []string, err error) {
+	vars = map[string]string{}
+	for _, src := range c.SubstituteFrom {
+		switch src.Kind {
+		case VarSourceConfigMap:
+			cm, err := c.client.CoreV1().ConfigMaps(src.Namespace).Get(src.Name, meta_v1.GetOptions{})
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "reading variables from %s", src)
+			}
+			for k, v := range cm.Data {
+				vars[k] = v
+			}
+		case VarSourceSecret:
+			secret, err := c.client.CoreV1().Secrets(src.Namespace).Get(src.Name, meta_v1.GetOptions{})
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "reading variables from %s", src)
+			}
+			for k, v := range secret.Data {
+				vars[k] = string(v)
+				if len(v) > 0 {
+					secretValues = append(secretValues, string(v))
+				}
+			}
+		}
+	}
+	return vars, secretValues, nil
+}
+
+// substitution substitutes variables into the manifests of resources
+// with the `substitute` policy. The variables are read when first
+// needed, so they're read once per sync (or comparison), and only if
+// some resource wants them.
+type substitution struct {
+	cluster      *Cluster
+	read         bool
+	vars         map[string]string
+	secretValues []string
+	err          error
+}
+
+// apply gives the resource with the variables substituted, if it has
+// the `substitute` policy, or else the resource as it is.
+func (s *substitution) apply(res resource.Resource) (resource.Resource, error) {
+	if !res.Policy().Has(policy.Substitute) {
+		return res, nil
+	}
+	if !s.read {
+		s.vars, s.secretValues, s.err = s.cluster.substitutionVars()
+		s.read = true
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	def, err := substitute(res.Bytes(), s.vars)
+	if err != nil {
+		return nil, err
+	}
+	return substitutedResource{Resource: res, bytes: def}, nil
+}
+
+// substitutedResource is a resource with the placeholders in its
+// definition replaced with the values of variables.
+type substitutedResource struct {
+	resource.Resource
+	bytes []byte
+}
+
+func (r substitutedResource) Bytes() []byte {
+	return r.bytes
+}
+
+func (r substitutedResource) SourceLine() int {
+	return resource.SourceLine(r.Resource)
+}
+
+// substitute replaces the placeholders in the definition given with
+// the values of the variables; it's an error to use a variable that
+// isn't defined. Values are put into the manifest once it's parsed,
+// rather than into its text, so that a value can't change the
+// structure of the manifest, whatever characters it has: in a string,
+// it's just more of the string. A placeholder that is an unquoted
+// value by itself is read as YAML would read the variable's value
+// there, so it can be, e.g., a number; but if that isn't a simple
+// value, it's a string.
+func substitute(def []byte, vars map[string]string) ([]byte, error) {
+	// Each placeholder is first replaced with a token that's
+	// nowhere else in the manifest, so that once it's parsed, the
+	// placeholders can be found. The tokens are hexadecimal
+	// numbers, so a token that stands alone unquoted is read as a
+	// number, and one that doesn't is left in a string.
+	tokens := newTokens(def)
+	var undefined []string
+	text := varRegexp.ReplaceAllFunc(def, func(m []byte) []byte {
+		if m[1] == '$' {
+			return []byte(tokens.add(string(m[1:])))
+		}
+		name := string(m[2 : len(m)-1])
+		value, ok := vars[name]
+		if !ok {
+			undefined = append(undefined, name)
+			return m
+		}
+		return []byte(tokens.add(value))
+	})
+	if len(undefined) > 0 {
+		sort.Strings(undefined)
+		return nil, fmt.Errorf("undefined variable(s) in manifest: %s", strings.Join(undefined, ", "))
+	}
+	if len(tokens.values) == 0 {
+		return def, nil
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(text, &doc); err != nil {
+		return nil, errors.Wrap(err, "parsing manifest to substitute variables")
+	}
+	return yaml.Marshal(tokens.into(doc))
+}
+
+// tokens stand for the placeholders in a manifest while it's parsed.
+type tokens struct {
+	prefix string
+	regexp *regexp.Regexp
+	values map[string]string // what each token stands for
+}
+
+// newTokens makes tokens to use in the definition given, starting
+// with digits that don't appear in it.
+func newTokens(def []byte) *tokens {
+	n := 0xf10000
+	for bytes.Contains(def, []byte(fmt.Sprintf("%x", n))) {
+		n++
+	}
+	prefix := fmt.Sprintf("0x%x", n)
+	return &tokens{
+		prefix: prefix,
+		regexp: regexp.MustCompile(prefix + "[0-9a-f]{6}"),
+		values: map[string]string{},
+	}
+}
+
+// add gives a new token standing for the value.
+func (t *tokens) add(value string) string {
+	token := fmt.Sprintf("%s%06x", t.prefix, len(t.values))
+	t.values[token] = value
+	return token
+}
+
+// replace gives the text with each token in it replaced with what
+// it stands for.
+func (t *tokens) replace(text string) string {
+	return t.regexp.ReplaceAllStringFunc(text, func(token string) string {
+		return t.values[token]
+	})
+}
+
+// into gives the value parsed from YAML with the tokens in it
+// replaced with what they stand for.
+func (t *tokens) into(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		for i := range v {
+			v[i].Key = t.into(v[i].Key)
+			v[i].Value = t.into(v[i].Value)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = t.into(v[i])
+		}
+	case string:
+		return t.replace(v)
+	case int, int64, uint64:
+		// A token by itself, unquoted (perhaps with a sign), is
+		// read as a number
+		text := fmt.Sprintf("%#x", v)
+		if !t.regexp.MatchString(text) {
+			return value
+		}
+		return readScalar(t.replace(text))
+	}
+	return value
+}
+
+// readScalar reads the text as YAML would read an unquoted value;
+// only simple values are taken as read, and anything else (e.g.,
+// `a: b`, `[x]` or `*ref`) is a string, as if it were quoted.
+func readScalar(text string) interface{} {
+	var read interface{}
+	if err := yaml.Unmarshal([]byte(text), &read); err == nil {
+		switch read.(type) {
+		case bool, int, int64, uint64, float64:
+			return read
+		}
+	}
+	return text
+}
@@ -0,0 +1,163 @@
+package kubernetes
+
+import (
+	"fmt"
+	"testing"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakekubernetes "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/policy"
+)
+
+func TestParseVarSource(t *testing.T) {
+	for in, want := range map[string]VarSource{
+		"configmap/vars":          {Kind: VarSourceConfigMap, Namespace: "flux", Name: "vars"},
+		"kube-system/Secret/vars": {Kind: VarSourceSecret, Namespace: "kube-system", Name: "vars"},
+	} {
+		got, err := ParseVarSource(in, "flux")
+		if assert.NoError(t, err, in) {
+			assert.Equal(t, want, got, in)
+		}
+	}
+	for _, in := range []string{"", "vars", "configmap/", "deployment/vars", "a/b/configmap/vars"} {
+		_, err := ParseVarSource(in, "flux")
+		assert.Error(t, err, in)
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	vars := map[string]string{"DOMAIN": "example.com", "CERT": "line one\nline two", "REPLICAS": "2"}
+	out, err := substitute([]byte(`host: app.${DOMAIN} # comment
+literal: not $DOMAIN, nor $${DOMAIN}
+replicas: ${REPLICAS}
+quoted: "${REPLICAS}"
+cert: ${CERT}
+`), vars)
+	assert.NoError(t, err)
+	assert.Equal(t, `host: app.example.com
+literal: not $DOMAIN, nor ${DOMAIN}
+replicas: 2
+quoted: "2"
+cert: |-
+  line one
+  line two
+`, string(out))
+
+	_, err = substitute([]byte(`host: ${HOST}.${DOMAIN}`), vars)
+	assert.EqualError(t, err, "undefined variable(s) in manifest: HOST")
+}
+
+// Whatever a value has in it, it's substituted as a value, and
+// doesn't change the structure of the manifest.
+func TestSubstituteSpecialCharacters(t *testing.T) {
+	for _, value := range []string{
+		"key: value",
+		"value # comment",
+		"{a: b}",
+		"[a, b]",
+		"&anchor",
+		"*alias",
+		"!tag",
+		`"double"`,
+		"'single'",
+		`it's "quoted"`,
+		"- item",
+		"line one\nkey: value",
+		"2",
+		"",
+	} {
+		const def = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  labels: {plain: "${V}"}
+data:
+  plain: ${V}
+  double: "x${V}x"
+  single: 'x${V}x'
+  list: ["${V}", '${V}']
+  block: |
+    x${V}x
+`
+		out, err := substitute([]byte(def), map[string]string{"V": value})
+		if !assert.NoError(t, err, value) {
+			continue
+		}
+		var plain interface{} = value
+		if value == "2" {
+			plain = float64(2)
+		}
+		var got interface{}
+		if assert.NoError(t, k8syaml.Unmarshal(out, &got), value) {
+			assert.Equal(t, map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]interface{}{
+					"name":   "config",
+					"labels": map[string]interface{}{"plain": value},
+				},
+				"data": map[string]interface{}{
+					"plain":  plain,
+					"double": "x" + value + "x",
+					"single": "x" + value + "x",
+					"list":   []interface{}{value, value},
+					"block":  "x" + value + "x\n",
+				},
+			}, got, value)
+		}
+	}
+}
+
+func TestSyncSubstitutes(t *testing.T) {
+	clientset := fakekubernetes.NewSimpleClientset(
+		newNamespace("flux"),
+		&apiv1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "vars", Namespace: "flux"},
+			Data:       map[string]string{"DOMAIN": "example.com", "REPLICAS": "2"},
+		},
+		&apiv1.Secret{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "vars", Namespace: "flux"},
+			Data:       map[string][]byte{"DOMAIN": []byte("secret.example.com")},
+		},
+	)
+	applier := &bytesApplier{}
+	c := NewCluster(clientset, nil, nil, applier, nil, log.NewNopLogger(), ClusterOptions{})
+	c.SubstituteFrom = []VarSource{
+		{Kind: VarSourceConfigMap, Namespace: "flux", Name: "vars"},
+		{Kind: VarSourceSecret, Namespace: "flux", Name: "vars"},
+	}
+	const templated = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: %s
+data:
+  host: app.${DOMAIN}
+  replicas: "${REPLICAS}"
+`
+	substituted := policy.Set{policy.Substitute: "true"}
+	err := c.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{Apply: policyRsc{rsc: rsc{"default:configmap/substituted", []byte(fmt.Sprintf(templated, "substituted"))}, policies: substituted}},
+			{Apply: rsc{"default:configmap/plain", []byte(fmt.Sprintf(templated, "plain"))}},
+			{Apply: policyRsc{rsc: rsc{"default:configmap/undefined", []byte(fmt.Sprintf(templated+"  port: ${PORT}\n", "undefined"))}, policies: substituted}},
+		},
+	})
+
+	// The resource using an undefined variable isn't applied ..
+	if errs, ok := err.(cluster.SyncError); !ok || len(errs) != 1 || errs[0].Resource.ResourceID().String() != "default:configmap/undefined" {
+		t.Fatalf("expected an error for the resource using an undefined variable, got %v", err)
+	}
+	if _, ok := applier.applied["undefined"]; ok {
+		t.Error("expected the resource using an undefined variable not to be applied")
+	}
+	// .. and only those with the policy are substituted, with the
+	// later source winning
+	assert.Contains(t, applier.applied["substituted"], "host: app.secret.example.com\n  replicas: \"2\"\n")
+	assert.Equal(t, fmt.Sprintf(templated, "plain"), applier.applied["plain"])
+}
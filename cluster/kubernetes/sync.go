@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os/exec"
@@ -9,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	rest "k8s.io/client-go/rest"
 
 	"github.com/go-kit/kit/log"
@@ -33,9 +35,22 @@ type Applier interface {
 	apply(log.Logger, changeSet) cluster.SyncError
 }
 
+// validator is implemented by Appliers that can check a changeset
+// would apply, without applying it.
+type validator interface {
+	validate(log.Logger, changeSet) cluster.SyncError
+}
+
 type Kubectl struct {
 	exe    string
 	config *rest.Config
+
+	// ServerDryRun makes the applier validate changesets with a
+	// server-side dry run, before applying them.
+	ServerDryRun bool
+	// RequestTimeout, if non-zero, is how long kubectl waits for
+	// each request to the API server.
+	RequestTimeout time.Duration
 }
 
 func NewKubectl(exe string, config *rest.Config) *Kubectl {
@@ -68,6 +83,9 @@ func (c *Kubectl) connectArgs() []string {
 	if c.config.BearerToken != "" {
 		args = append(args, fmt.Sprintf("--token=%s", c.config.BearerToken))
 	}
+	if c.RequestTimeout > 0 {
+		args = append(args, fmt.Sprintf("--request-timeout=%s", c.RequestTimeout))
+	}
 	return args
 }
 
@@ -79,19 +97,28 @@ func rankOfKind(kind string) int {
 	// Namespaces answer to NOONE
 	case "Namespace":
 		return 0
-	// These don't go in namespaces; or do, but don't depend on anything else
-	case "ServiceAccount", "ClusterRole", "Role", "PersistentVolume", "Service":
+	// These define the kinds of other resources, so need to be
+	// there before any of those
+	case "CustomResourceDefinition":
 		return 1
+	// These don't go in namespaces; or do, but don't depend on anything else
+	case "ServiceAccount", "ClusterRole", "Role", "PersistentVolume", "Service", "StorageClass", "PodSecurityPolicy", "ImageStream":
+		return 2
 	// These depend on something above, but not each other
 	case "ResourceQuota", "LimitRange", "Secret", "ConfigMap", "RoleBinding", "ClusterRoleBinding", "PersistentVolumeClaim", "Ingress":
-		return 2
-	// Same deal, next layer
-	case "DaemonSet", "Deployment", "ReplicationController", "ReplicaSet", "Job", "CronJob", "StatefulSet":
 		return 3
+	// Same deal, next layer
+	case "DaemonSet", "Deployment", "DeploymentConfig", "ReplicationController", "ReplicaSet", "Job", "CronJob", "StatefulSet":
+		return 4
+	// Webhooks intercept the creation of other resources, and will
+	// likely refer to a service which isn't running yet, so they
+	// go after everything else.
+	case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+		return 6
 	// Assumption: anything not mentioned isn't depended _upon_, so
 	// can come last.
 	default:
-		return 4
+		return 5
 	}
 }
 
@@ -142,10 +169,113 @@ func (c *Kubectl) apply(logger log.Logger, cs changeSet) (errs cluster.SyncError
 
 	objs = cs.objs["apply"]
 	sort.Sort(applyOrder(objs))
+	objs, forgetErrs := c.forgetIgnoredFields(logger, objs)
+	errs = append(errs, forgetErrs...)
 	f(objs, "apply")
 	return errs
 }
 
+// forgetIgnoredFields removes the fields that are to be left alone
+// (e.g., the replicas of an autoscaled workload) from the
+// configuration recorded as last applied for each object that has
+// any. Otherwise, `kubectl apply` would remove them from the object
+// in the cluster, since they were applied before and are now missing.
+// It returns the objects that can be applied; those for which the
+// last applied configuration couldn't be updated are returned as
+// errors instead.
+func (c *Kubectl) forgetIgnoredFields(logger log.Logger, objs []*apiObject) ([]*apiObject, cluster.SyncError) {
+	var ok []*apiObject
+	var errs cluster.SyncError
+	for _, obj := range objs {
+		r, isPruned := obj.Resource.(ignoredFielder)
+		if !isPruned {
+			ok = append(ok, obj)
+			continue
+		}
+		if err := c.forgetFields(logger, obj, r.IgnoredFields()); err != nil {
+			errs = append(errs, cluster.ResourceError{Resource: obj.Resource, Error: errors.Wrap(err, "removing ignored fields from last applied configuration")})
+			continue
+		}
+		ok = append(ok, obj)
+	}
+	return ok, errs
+}
+
+func (c *Kubectl) forgetFields(logger log.Logger, obj *apiObject, fields []FieldPath) error {
+	cmd := c.kubectlCommand("apply", "view-last-applied", "--output=json", "-f", "-")
+	cmd.Stdin = bytes.NewReader(obj.Bytes())
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "not found") || strings.Contains(msg, "no last-applied-configuration annotation") {
+			return nil // nothing applied before, so nothing to forget
+		}
+		return errors.Wrap(errors.New(msg), "running kubectl")
+	}
+	var lastApplied map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &lastApplied); err != nil {
+		return err
+	}
+	var removed bool
+	for _, path := range fields {
+		if _, found, _ := unstructured.NestedFieldNoCopy(lastApplied, path...); found {
+			unstructured.RemoveNestedField(lastApplied, path...)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+	def, err := json.Marshal(lastApplied)
+	if err != nil {
+		return err
+	}
+	return c.doCommand(logger, bytes.NewReader(def), "apply", "set-last-applied")
+}
+
+// validate does a server-side dry run of applying the resources in
+// the changeset. Resources which can't be checked because they depend
+// on a namespace or custom resource definition in the same changeset
+// aren't counted as failing.
+func (c *Kubectl) validate(logger log.Logger, cs changeSet) (errs cluster.SyncError) {
+	if !c.ServerDryRun {
+		return nil
+	}
+	objs := cs.objs["apply"]
+	if len(objs) == 0 {
+		return nil
+	}
+
+	namespaces := map[string]bool{}
+	var definesKinds bool
+	for _, obj := range objs {
+		switch obj.Kind {
+		case "Namespace":
+			namespaces[obj.Metadata.Name] = true
+		case "CustomResourceDefinition":
+			definesKinds = true
+		}
+	}
+
+	args := []string{"apply", "--server-dry-run"}
+	logger.Log("cmd", "apply", "args", "--server-dry-run", "count", len(objs))
+	if err := c.doCommand(logger, makeMultidoc(objs), args...); err == nil {
+		return nil
+	}
+	for _, obj := range objs {
+		err := c.doCommand(logger, bytes.NewReader(obj.Bytes()), args...)
+		switch {
+		case err == nil:
+		case definesKinds && strings.Contains(err.Error(), "no matches for kind"):
+		case namespaces[obj.Metadata.Namespace] && strings.Contains(err.Error(), "not found"):
+		default:
+			errs = append(errs, cluster.ResourceError{Resource: obj.Resource, Error: err})
+		}
+	}
+	return errs
+}
+
 func (c *Kubectl) doCommand(logger log.Logger, r io.Reader, args ...string) error {
 	args = append(args, "-f", "-")
 	cmd := c.kubectlCommand(args...)
@@ -1,10 +1,14 @@
 package kubernetes
 
 import (
+	"errors"
 	"sort"
 	"testing"
 
 	"github.com/go-kit/kit/log"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	fakekubernetes "k8s.io/client-go/kubernetes/fake"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
@@ -48,6 +52,7 @@ func (r rsc) Source() string {
 func setup(t *testing.T) (*Cluster, *mockApplier) {
 	applier := &mockApplier{}
 	kube := &Cluster{
+		client:  extendedClient{coreClient: fakekubernetes.NewSimpleClientset()},
 		applier: applier,
 		logger:  log.NewNopLogger(),
 	}
@@ -96,6 +101,24 @@ func TestApplyOrder(t *testing.T) {
 				Name: "secret",
 			},
 		},
+		{
+			Kind: "ValidatingWebhookConfiguration",
+			Metadata: metadata{
+				Name: "webhook",
+			},
+		},
+		{
+			Kind: "Widget",
+			Metadata: metadata{
+				Name: "widget",
+			},
+		},
+		{
+			Kind: "CustomResourceDefinition",
+			Metadata: metadata{
+				Name: "crd",
+			},
+		},
 		{
 			Kind: "Namespace",
 			Metadata: metadata{
@@ -104,9 +127,126 @@ func TestApplyOrder(t *testing.T) {
 		},
 	}
 	sort.Sort(applyOrder(objs))
-	for i, name := range []string{"namespace", "secret", "deploy"} {
+	for i, name := range []string{"namespace", "crd", "secret", "deploy", "widget", "webhook"} {
 		if objs[i].Metadata.Name != name {
 			t.Errorf("Expected %q at position %d, got %q", name, i, objs[i].Metadata.Name)
 		}
 	}
 }
+
+type validatingApplier struct {
+	mockApplier
+	invalid string
+}
+
+func (m *validatingApplier) validate(_ log.Logger, c changeSet) cluster.SyncError {
+	var errs cluster.SyncError
+	for _, obj := range c.objs["apply"] {
+		if obj.Metadata.Name == m.invalid {
+			errs = append(errs, cluster.ResourceError{Resource: obj.Resource, Error: errors.New("invalid")})
+		}
+	}
+	return errs
+}
+
+func TestSyncValidationFailure(t *testing.T) {
+	applier := &validatingApplier{invalid: "bad"}
+	kube := &Cluster{
+		client:  extendedClient{coreClient: fakekubernetes.NewSimpleClientset()},
+		applier: applier,
+		logger:  log.NewNopLogger(),
+	}
+	err := kube.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{Apply: rsc{"default:deployment/good", []byte("kind: Deployment\nmetadata:\n  name: good\n")}},
+			{Apply: rsc{"default:deployment/bad", []byte("kind: Deployment\nmetadata:\n  name: bad\n")}},
+		},
+	})
+	verr, ok := err.(cluster.ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got %#v", err)
+	}
+	if len(verr.SyncError) != 1 || verr.SyncError[0].ResourceID().String() != "default:deployment/bad" {
+		t.Errorf("expected only the bad resource to fail validation, got %v", verr)
+	}
+	if applier.commandRun {
+		t.Error("expected nothing to be applied")
+	}
+}
+
+type recordingApplier struct {
+	applied []string
+}
+
+func (m *recordingApplier) apply(_ log.Logger, c changeSet) cluster.SyncError {
+	for _, obj := range c.objs["apply"] {
+		m.applied = append(m.applied, obj.Metadata.Name)
+	}
+	return nil
+}
+
+func TestSyncLabelSelector(t *testing.T) {
+	selector, err := labels.Parse("flux-instance=prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	applier := &recordingApplier{}
+	kube := &Cluster{
+		client:       extendedClient{coreClient: fakekubernetes.NewSimpleClientset()},
+		applier:      applier,
+		logger:       log.NewNopLogger(),
+		syncSelector: selector,
+	}
+	err = kube.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{Apply: rsc{"default:deployment/prod", []byte("kind: Deployment\nmetadata:\n  name: prod\n  labels:\n    flux-instance: prod\n")}},
+			{Apply: rsc{"default:deployment/dev", []byte("kind: Deployment\nmetadata:\n  name: dev\n  labels:\n    flux-instance: dev\n")}},
+			{Apply: rsc{"default:deployment/unlabelled", []byte("kind: Deployment\nmetadata:\n  name: unlabelled\n")}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applier.applied) != 1 || applier.applied[0] != "prod" {
+		t.Errorf("expected only the matching resource to be applied, got %v", applier.applied)
+	}
+}
+
+func TestSyncClusterScopedWithAllowedNamespaces(t *testing.T) {
+	clientset := fakekubernetes.NewSimpleClientset()
+	clientset.Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "rbac.authorization.k8s.io/v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "clusterroles", Kind: "ClusterRole"},
+			},
+		},
+	}
+	applier := &recordingApplier{}
+	kube := &Cluster{
+		client:      extendedClient{coreClient: clientset},
+		applier:     applier,
+		logger:      log.NewNopLogger(),
+		nsWhitelist: []string{"team"},
+	}
+	err := kube.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{Apply: rsc{"default:clusterrole/reader", []byte("apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: reader\n")}},
+			{Apply: rsc{"team:deployment/allowed", []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: allowed\n  namespace: team\n")}},
+			{Apply: rsc{"default:deployment/disallowed", []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: disallowed\n")}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(applier.applied)
+	if len(applier.applied) != 2 || applier.applied[0] != "allowed" || applier.applied[1] != "reader" {
+		t.Errorf("expected the cluster-scoped resource and the allowed namespace's resource to be applied, got %v", applier.applied)
+	}
+}
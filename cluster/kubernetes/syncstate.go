@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"context"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sclient "k8s.io/client-go/kubernetes"
+)
+
+// The key under which the revision is recorded.
+const syncStateRevisionKey = "revision"
+
+// SyncState records the revision synced in a ConfigMap or Secret in
+// the cluster, so that fluxd doesn't need to write to the git repo
+// to keep track of it.
+type SyncState struct {
+	client    k8sclient.Interface
+	namespace string
+	name      string
+	secret    bool
+}
+
+// NewConfigMapSyncState records the revision synced in the named
+// ConfigMap, which will be created if necessary.
+func NewConfigMapSyncState(client k8sclient.Interface, namespace, name string) *SyncState {
+	return &SyncState{client: client, namespace: namespace, name: name}
+}
+
+// NewSecretSyncState records the revision synced in the named
+// Secret, which will be created if necessary.
+func NewSecretSyncState(client k8sclient.Interface, namespace, name string) *SyncState {
+	return &SyncState{client: client, namespace: namespace, name: name, secret: true}
+}
+
+func (s *SyncState) GetRevision(ctx context.Context) (string, error) {
+	if s.secret {
+		secret, err := s.client.CoreV1().Secrets(s.namespace).Get(s.name, meta_v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		return string(secret.Data[syncStateRevisionKey]), nil
+	}
+
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(s.name, meta_v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return cm.Data[syncStateRevisionKey], nil
+}
+
+func (s *SyncState) UpdateMarker(ctx context.Context, revision string) error {
+	if s.secret {
+		secrets := s.client.CoreV1().Secrets(s.namespace)
+		secret, err := secrets.Get(s.name, meta_v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = secrets.Create(&apiv1.Secret{
+				ObjectMeta: meta_v1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+				Data:       map[string][]byte{syncStateRevisionKey: []byte(revision)},
+			})
+			return err
+		} else if err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[syncStateRevisionKey] = []byte(revision)
+		_, err = secrets.Update(secret)
+		return err
+	}
+
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(s.name, meta_v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(&apiv1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+			Data:       map[string]string{syncStateRevisionKey: revision},
+		})
+		return err
+	} else if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[syncStateRevisionKey] = revision
+	_, err = configMaps.Update(cm)
+	return err
+}
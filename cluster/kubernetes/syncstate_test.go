@@ -0,0 +1,46 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	fakekubernetes "k8s.io/client-go/kubernetes/fake"
+
+	fluxsync "github.com/weaveworks/flux/sync"
+)
+
+// This is checked here rather than alongside SyncState, since the
+// sync package's tests use this package.
+var _ fluxsync.State = &SyncState{}
+
+func testSyncState(t *testing.T, state *SyncState) {
+	ctx := context.Background()
+	rev, err := state.GetRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != "" {
+		t.Errorf("expected no revision before anything is synced, got %q", rev)
+	}
+
+	for _, expected := range []string{"abc123", "def456"} {
+		if err := state.UpdateMarker(ctx, expected); err != nil {
+			t.Fatal(err)
+		}
+		rev, err := state.GetRevision(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rev != expected {
+			t.Errorf("expected revision %q, got %q", expected, rev)
+		}
+	}
+}
+
+func TestConfigMapSyncState(t *testing.T) {
+	testSyncState(t, NewConfigMapSyncState(fakekubernetes.NewSimpleClientset(), "flux", "flux-sync"))
+}
+
+func TestSecretSyncState(t *testing.T) {
+	testSyncState(t, NewSecretSyncState(fakekubernetes.NewSimpleClientset(), "flux", "flux-sync"))
+}
@@ -0,0 +1,70 @@
+// Package timeout limits how long requests to the Kubernetes API
+// take. It's apart from the rest of the package kubernetes so that
+// programs (e.g., the Helm operator) can use it without depending on
+// flux's cluster code.
+package timeout
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// WithRequestTimeout makes each request made with the config given
+// give up after the timeout, so that a slow or unresponsive API
+// server can't hold up whatever is waiting on it -- e.g., the sync
+// loop. Watches are left alone, since they are meant to last; unlike
+// rest.Config.Timeout, which applies to watches too.
+func WithRequestTimeout(config *rest.Config, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	wrap := config.WrapTransport
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return &timeoutRoundTripper{next: rt, timeout: timeout}
+	}
+}
+
+type timeoutRoundTripper struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isWatch(req) {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The deadline covers reading the response, too
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// isWatch reports whether a request is to watch resources, as either
+// `?watch=true` or, as older clients do, `/watch/` in the path.
+func isWatch(req *http.Request) bool {
+	return req.URL.Query().Get("watch") == "true" || strings.Contains(req.URL.Path, "/watch/")
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
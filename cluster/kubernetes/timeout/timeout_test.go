@@ -0,0 +1,39 @@
+package timeout
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestWithRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	config := &rest.Config{}
+	WithRequestTimeout(config, 50*time.Millisecond)
+	client := &http.Client{Transport: config.WrapTransport(http.DefaultTransport)}
+
+	if _, err := client.Get(server.URL + "/api/v1/namespaces/default/pods"); err == nil {
+		t.Error("expected request to time out")
+	}
+	for _, path := range []string{"/api/v1/namespaces/default/pods?watch=true", "/api/v1/watch/namespaces/default/pods"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Errorf("expected watch %s not to time out, got %s", path, err)
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || string(body) != "done" {
+			t.Errorf("expected response to watch %s, got %q, %v", path, body, err)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package kubernetes
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/image"
 )
 
@@ -11,11 +13,38 @@ import (
 // docs, as bytes), a resource ID referring to a controller, a
 // container name, and the name of the new image that should be used
 // for the container. It returns a new YAML stream where the image for
-// the container has been replaced with the imageRef supplied.
+// the container has been replaced with the imageRef supplied. The
+// image is changed in place if possible, leaving the rest of the YAML
+// as it was; otherwise, it's left to kubeyaml (except for custom
+// resources, which have to be edited in place).
 func updatePodController(in []byte, resource flux.ResourceID, container string, newImageID image.Ref) ([]byte, error) {
 	namespace, kind, name := resource.Components()
-	if _, ok := resourceKinds[strings.ToLower(kind)]; !ok {
+	rk, ok := resourceKinds[strings.ToLower(kind)]
+	if !ok {
 		return nil, UpdateNotSupportedError(kind)
 	}
+	out, err := updateImageInPlace(in, namespace, kind, name, container, newImageID)
+	if err == nil {
+		return out, nil
+	}
+	// kubeyaml doesn't know where the images are in custom resources
+	if _, ok := rk.(*customKind); ok {
+		return nil, err
+	}
 	return (KubeYAML{}).Image(in, namespace, kind, name, container, newImageID.String())
 }
+
+// SetHelmValues sets values in the spec of a FluxHelmRelease. Unlike
+// images and policies, there's no falling back to kubeyaml: the
+// values are only ever set in place.
+func (c *Manifests) SetHelmValues(def []byte, id flux.ResourceID, values []cluster.HelmValue) ([]byte, error) {
+	namespace, kind, name := id.Components()
+	if strings.ToLower(kind) != "fluxhelmrelease" {
+		return nil, fmt.Errorf("%s is not a FluxHelmRelease, so values can't be set in it", id)
+	}
+	out, err := setHelmValuesInPlace(def, namespace, name, values)
+	if err == errUnsupported {
+		return nil, HelmValuesUpdateError(id)
+	}
+	return out, err
+}
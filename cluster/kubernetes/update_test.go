@@ -51,6 +51,13 @@ func TestUpdates(t *testing.T) {
 		{"in kubernetes List resource", case10resource, case10containers, case10image, case10, case10out},
 		{"FluxHelmRelease (simple image encoding)", case11resource, case11containers, case11image, case11, case11out},
 		{"FluxHelmRelease (multi image encoding)", case12resource, case12containers, case12image, case12, case12out},
+		{"CronJob with multiple containers", case13resource, case13containers, case13image, case13, case13out},
+		{"init container in StatefulSet", case14resource, case14containers, case14image, case14, case14out},
+		{"DaemonSet", case15resource, case15containers, case15image, case15, case15out},
+		{"comments, anchors and key order", case16resource, case16containers, case16image, case16, case16out},
+		{"pinned to a digest", case17resource, case17containers, case17image, case17, case17out},
+		{"FluxHelmRelease (tag pinned to a digest)", case18resource, case18containers, case18image, case18, case18out},
+		{"OpenShift DeploymentConfig", case19resource, case19containers, case19image, case19, case19out},
 	} {
 		t.Run(c.name, func(t *testing.T) {
 			testUpdate(t, c)
@@ -262,12 +269,13 @@ const case3image = "quay.io/weaveworks/grafana:master-37aaf67"
 
 var case3container = []string{"grafana"}
 
+// The indentation is left as it was
 const case3out = `---
 apiVersion: extensions/v1beta1
 kind: Deployment
 metadata:
-  namespace: monitoring
-  name: grafana # comment, and only one space indent
+ namespace: monitoring
+ name: grafana # comment, and only one space indent
 spec:
   replicas: 1
   template:
@@ -868,3 +876,297 @@ spec:
     sidecar:
       image: sidecar:v1
 `
+
+const case13 = `---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+  namespace: db
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          restartPolicy: OnFailure
+          containers:
+          - name: dump
+            image: postgres:10.4
+            args:
+            - pg_dumpall
+          - name: upload
+            image: quay.io/example/uploader:v1
+`
+
+const case13resource = "db:cronjob/backup"
+const case13image = "quay.io/example/uploader:v2"
+
+var case13containers = []string{"upload"}
+
+const case13out = `---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+  namespace: db
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          restartPolicy: OnFailure
+          containers:
+          - name: dump
+            image: postgres:10.4
+            args:
+            - pg_dumpall
+          - name: upload
+            image: quay.io/example/uploader:v2
+`
+
+const case14 = `---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+  namespace: db
+spec:
+  serviceName: db
+  replicas: 3
+  template:
+    metadata:
+      labels:
+        app: db
+    spec:
+      initContainers:
+      - name: init-db
+        image: quay.io/example/init-db:v1
+      containers:
+      - name: db
+        image: postgres:10.4
+`
+
+const case14resource = "db:statefulset/db"
+const case14image = "quay.io/example/init-db:v2"
+
+var case14containers = []string{"init-db"}
+
+const case14out = `---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+  namespace: db
+spec:
+  serviceName: db
+  replicas: 3
+  template:
+    metadata:
+      labels:
+        app: db
+    spec:
+      initContainers:
+      - name: init-db
+        image: quay.io/example/init-db:v2
+      containers:
+      - name: db
+        image: postgres:10.4
+`
+
+const case15 = `---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  namespace: monitoring
+spec:
+  template:
+    metadata:
+      labels:
+        app: agent
+    spec:
+      containers:
+      - name: agent
+        image: quay.io/example/agent:v1
+        ports:
+        - containerPort: 9100
+`
+
+const case15resource = "monitoring:daemonset/agent"
+const case15image = "quay.io/example/agent:v2"
+
+var case15containers = []string{"agent"}
+
+const case15out = `---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  namespace: monitoring
+spec:
+  template:
+    metadata:
+      labels:
+        app: agent
+    spec:
+      containers:
+      - name: agent
+        image: quay.io/example/agent:v2
+        ports:
+        - containerPort: 9100
+`
+
+// Everything except the image is left exactly as it was
+const case16 = `# A comment before the document
+---
+kind: Deployment # the kind
+apiVersion: apps/v1
+metadata:
+    name: app
+    labels: &labels
+        name: app
+        tier: "backend"
+spec:
+    selector:
+        matchLabels: *labels
+    template:
+        metadata: {labels: {name: app, tier: backend}}
+        spec:
+            containers:
+              -   name:  app
+                  image: "quay.io/example/app:v1.0"   # keep me here
+                  args: [--verbose, --port=80]
+`
+
+const case16resource = "default:deployment/app"
+const case16image = "quay.io/example/app:v1.1"
+
+var case16containers = []string{"app"}
+
+const case16out = `# A comment before the document
+---
+kind: Deployment # the kind
+apiVersion: apps/v1
+metadata:
+    name: app
+    labels: &labels
+        name: app
+        tier: "backend"
+spec:
+    selector:
+        matchLabels: *labels
+    template:
+        metadata: {labels: {name: app, tier: backend}}
+        spec:
+            containers:
+              -   name:  app
+                  image: "quay.io/example/app:v1.1"   # keep me here
+                  args: [--verbose, --port=80]
+`
+
+const case17 = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/example/app:v1.0@sha256:1111111111111111111111111111111111111111111111111111111111111111
+`
+
+const case17resource = "default:deployment/app"
+const case17image = "quay.io/example/app:v1.1@sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+var case17containers = []string{"app"}
+
+const case17out = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/example/app:v1.1@sha256:2222222222222222222222222222222222222222222222222222222222222222
+`
+
+const case18 = `---
+apiVersion: helm.integrations.flux.weave.works/v1alpha2
+kind: FluxHelmRelease
+metadata:
+  name: app
+  namespace: default
+spec:
+  chartGitPath: app
+  values:
+    app:
+      image:
+        repository: quay.io/example/app
+        tag: v1.0
+`
+
+const case18resource = "default:fluxhelmrelease/app"
+const case18image = "quay.io/example/app:v1.1@sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+var case18containers = []string{"app"}
+
+const case18out = `---
+apiVersion: helm.integrations.flux.weave.works/v1alpha2
+kind: FluxHelmRelease
+metadata:
+  name: app
+  namespace: default
+spec:
+  chartGitPath: app
+  values:
+    app:
+      image:
+        repository: quay.io/example/app
+        tag: v1.1@sha256:2222222222222222222222222222222222222222222222222222222222222222
+`
+
+const case19 = `---
+apiVersion: apps.openshift.io/v1
+kind: DeploymentConfig
+metadata:
+  name: web
+  namespace: default
+spec:
+  replicas: 2
+  triggers:
+  - type: ConfigChange
+  template:
+    spec:
+      containers:
+      - name: web
+        image: quay.io/example/web:v1 # released by flux
+`
+
+const case19resource = "default:deploymentconfig/web"
+const case19image = "quay.io/example/web:v2"
+
+var case19containers = []string{"web"}
+
+const case19out = `---
+apiVersion: apps.openshift.io/v1
+kind: DeploymentConfig
+metadata:
+  name: web
+  namespace: default
+spec:
+  replicas: 2
+  triggers:
+  - type: ConfigChange
+  template:
+    spec:
+      containers:
+      - name: web
+        image: quay.io/example/web:v2 # released by flux
+`
@@ -35,6 +35,9 @@ type Manifests interface {
 	ParseManifests([]byte) (map[string]resource.Resource, error)
 	// UpdatePolicies modifies a manifest to apply the policy update specified
 	UpdatePolicies([]byte, flux.ResourceID, policy.Update) ([]byte, error)
+	// SetHelmValues sets values in the spec of the FluxHelmRelease
+	// given, in a manifest
+	SetHelmValues([]byte, flux.ResourceID, []HelmValue) ([]byte, error)
 }
 
 // UpdateManifest looks for the manifest for the identified resource,
@@ -68,3 +71,63 @@ func UpdateManifest(m Manifests, root string, paths []string, id flux.ResourceID
 	}
 	return ioutil.WriteFile(path, newDef, fi.Mode())
 }
+
+// UpdateManifestPolicies applies the policy update to the manifest
+// for the identified resource, whether that's a file or something
+// generated, and reports whether anything changed.
+func UpdateManifestPolicies(m Manifests, root string, paths []string, id flux.ResourceID, update policy.Update) (bool, error) {
+	if gen, ok := m.(Generated); ok {
+		resources, err := m.LoadManifests(root, paths)
+		if err != nil {
+			return false, err
+		}
+		res, ok := resources[id.String()]
+		if !ok {
+			return false, ErrResourceNotFound(id.String())
+		}
+		if gen.IsGenerated(res) {
+			return gen.UpdateGeneratedPolicies(root, res, update)
+		}
+	}
+
+	var changed bool
+	err := UpdateManifest(m, root, paths, id, func(def []byte) ([]byte, error) {
+		newDef, err := m.UpdatePolicies(def, id, update)
+		if err != nil {
+			return nil, err
+		}
+		changed = string(newDef) != string(def)
+		return newDef, nil
+	})
+	return changed, err
+}
+
+// UpdateManifestHelmValues sets values in the manifest for the
+// identified FluxHelmRelease, and reports whether anything changed.
+// Generated manifests can't have values set.
+func UpdateManifestHelmValues(m Manifests, root string, paths []string, id flux.ResourceID, values []HelmValue) (bool, error) {
+	if gen, ok := m.(Generated); ok {
+		resources, err := m.LoadManifests(root, paths)
+		if err != nil {
+			return false, err
+		}
+		res, ok := resources[id.String()]
+		if !ok {
+			return false, ErrResourceNotFound(id.String())
+		}
+		if gen.IsGenerated(res) {
+			return false, ManifestError{fmt.Errorf("manifest for %s is generated (from %s), so values can't be set in it", id, res.Source())}
+		}
+	}
+
+	var changed bool
+	err := UpdateManifest(m, root, paths, id, func(def []byte) ([]byte, error) {
+		newDef, err := m.SetHelmValues(def, id, values)
+		if err != nil {
+			return nil, err
+		}
+		changed = string(newDef) != string(def)
+		return newDef, nil
+	})
+	return changed, err
+}
@@ -21,6 +21,8 @@ type Mock struct {
 	ParseManifestsFunc func([]byte) (map[string]resource.Resource, error)
 	UpdateManifestFunc func(path, resourceID string, f func(def []byte) ([]byte, error)) error
 	UpdatePoliciesFunc func([]byte, flux.ResourceID, policy.Update) ([]byte, error)
+	SetHelmValuesFunc  func([]byte, flux.ResourceID, []HelmValue) ([]byte, error)
+	CompareFunc        func(map[string]resource.Resource) map[string]Comparison
 }
 
 func (m *Mock) AllControllers(maybeNamespace string) ([]Controller, error) {
@@ -66,3 +68,11 @@ func (m *Mock) UpdateManifest(path string, resourceID string, f func(def []byte)
 func (m *Mock) UpdatePolicies(def []byte, id flux.ResourceID, p policy.Update) ([]byte, error) {
 	return m.UpdatePoliciesFunc(def, id, p)
 }
+
+func (m *Mock) SetHelmValues(def []byte, id flux.ResourceID, values []HelmValue) ([]byte, error) {
+	return m.SetHelmValuesFunc(def, id, values)
+}
+
+func (m *Mock) Compare(resources map[string]resource.Resource) map[string]Comparison {
+	return m.CompareFunc(resources)
+}
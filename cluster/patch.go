@@ -0,0 +1,154 @@
+package cluster
+
+import (
+	"encoding/json"
+	"reflect"
+
+	k8syaml "github.com/ghodss/yaml"
+)
+
+// The patches kept in a patch file are merge patches, much like JSON
+// merge patches (RFC 7386), except that lists of objects which all
+// have a `name` field (e.g., containers, env entries, ports, volumes)
+// are merged item by item, matching on the name, rather than being
+// replaced wholesale. This is a rough approximation of the strategic
+// merge patches Kubernetes uses, but it's enough to be able to record
+// changes to images and annotations.
+
+func yamlToMap(def []byte) (map[string]interface{}, error) {
+	js, err := k8syaml.YAMLToJSON(def)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(js, &m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	return m, nil
+}
+
+func mapToYAML(m map[string]interface{}) ([]byte, error) {
+	return k8syaml.Marshal(m)
+}
+
+// applyPatch returns the result of merging the patch into the
+// original. Neither argument is modified.
+func applyPatch(original, patch map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for k, v := range original {
+		result[k] = v
+	}
+	for k, pv := range patch {
+		if pv == nil {
+			delete(result, k)
+			continue
+		}
+		ov, ok := result[k]
+		if !ok {
+			result[k] = pv
+			continue
+		}
+		result[k] = applyPatchValue(ov, pv)
+	}
+	return result
+}
+
+func applyPatchValue(original, patch interface{}) interface{} {
+	switch p := patch.(type) {
+	case map[string]interface{}:
+		if o, ok := original.(map[string]interface{}); ok {
+			return applyPatch(o, p)
+		}
+	case []interface{}:
+		if o, ok := original.([]interface{}); ok && namedList(o) && namedList(p) {
+			result := make([]interface{}, len(o))
+			copy(result, o)
+		patches:
+			for _, item := range p {
+				name := item.(map[string]interface{})["name"]
+				for i, oitem := range result {
+					if oitem.(map[string]interface{})["name"] == name {
+						result[i] = applyPatch(oitem.(map[string]interface{}), item.(map[string]interface{}))
+						continue patches
+					}
+				}
+				result = append(result, item)
+			}
+			return result
+		}
+	}
+	return patch
+}
+
+// diffPatch returns a patch which, when applied to original, will
+// give modified. It does not represent removals from named lists.
+func diffPatch(original, modified map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k, ov := range original {
+		if _, ok := modified[k]; !ok {
+			patch[k] = nil
+		} else if d, changed := diffValue(ov, modified[k]); changed {
+			patch[k] = d
+		}
+	}
+	for k, mv := range modified {
+		if _, ok := original[k]; !ok {
+			patch[k] = mv
+		}
+	}
+	return patch
+}
+
+func diffValue(original, modified interface{}) (interface{}, bool) {
+	if reflect.DeepEqual(original, modified) {
+		return nil, false
+	}
+	switch m := modified.(type) {
+	case map[string]interface{}:
+		if o, ok := original.(map[string]interface{}); ok {
+			return diffPatch(o, m), true
+		}
+	case []interface{}:
+		if o, ok := original.([]interface{}); ok && namedList(o) && namedList(m) {
+			var items []interface{}
+		items:
+			for _, mitem := range m {
+				mmap := mitem.(map[string]interface{})
+				for _, oitem := range o {
+					omap := oitem.(map[string]interface{})
+					if omap["name"] == mmap["name"] {
+						if d := diffPatch(omap, mmap); len(d) > 0 {
+							d["name"] = mmap["name"]
+							items = append(items, d)
+						}
+						continue items
+					}
+				}
+				items = append(items, mitem)
+			}
+			return items, true
+		}
+	}
+	return modified, true
+}
+
+// namedList reports whether every item in the list is an object with
+// a `name` field.
+func namedList(l []interface{}) bool {
+	if len(l) == 0 {
+		return false
+	}
+	for _, item := range l {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"]; !ok {
+			return false
+		}
+	}
+	return true
+}
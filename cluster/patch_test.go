@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+const patchBase = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000001
+      - name: sidecar
+        image: quay.io/weaveworks/sidecar:master-a000001
+`
+
+const patchModified = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: default
+  annotations:
+    flux.weave.works/automated: "true"
+spec:
+  template:
+    spec:
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000002
+      - name: sidecar
+        image: quay.io/weaveworks/sidecar:master-a000001
+`
+
+func TestDiffAndApplyPatch(t *testing.T) {
+	original, err := yamlToMap([]byte(patchBase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified, err := yamlToMap([]byte(patchModified))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := diffPatch(original, modified)
+	if _, ok := patch["kind"]; ok {
+		t.Errorf("expected unchanged fields to be left out of patch, got %+v", patch)
+	}
+	containers := patch["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	if len(containers) != 1 {
+		t.Errorf("expected only the changed container in the patch, got %+v", containers)
+	}
+
+	if result := applyPatch(original, patch); !reflect.DeepEqual(result, modified) {
+		t.Errorf("expected applying patch to give\n%+v\ngot\n%+v", modified, result)
+	}
+}
+
+func TestApplyPatchRemovesNull(t *testing.T) {
+	original := map[string]interface{}{"a": "b", "c": "d"}
+	result := applyPatch(original, map[string]interface{}{"a": nil})
+	if !reflect.DeepEqual(result, map[string]interface{}{"c": "d"}) {
+		t.Errorf("expected key to be removed, got %+v", result)
+	}
+	if _, ok := original["a"]; !ok {
+		t.Error("original was modified")
+	}
+}
@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"strings"
+	"time"
 
 	"github.com/weaveworks/flux/resource"
 )
@@ -20,6 +21,46 @@ type SyncDef struct {
 	Actions []SyncAction
 }
 
+// EstablishedWaiter is implemented by clusters which can tell when
+// definitions of new kinds of resource (e.g., Kubernetes custom
+// resource definitions) have been established, so that resources of
+// those kinds can then be applied.
+type EstablishedWaiter interface {
+	// WaitEstablished waits until any definitions among the
+	// resources given are established, or the timeout is reached, in
+	// which case it returns an error.
+	WaitEstablished(resources []resource.Resource, timeout time.Duration) error
+}
+
+// SyncFilter is implemented by clusters which apply only some of the
+// resources they're given to sync, e.g., those in certain namespaces.
+type SyncFilter interface {
+	// Syncs reports whether the resource given would be applied.
+	Syncs(res resource.Resource) bool
+}
+
+// Comparer is implemented by clusters which can compare resources
+// with their counterparts in the cluster, so what a sync would
+// change can be seen without syncing.
+type Comparer interface {
+	// Compare gives, for each of the resources given, keyed by
+	// resource ID, its definition as it would be applied and as it is
+	// in the cluster.
+	Compare(resources map[string]resource.Resource) map[string]Comparison
+}
+
+// Comparison is a resource's definition as it would be applied, and
+// as it is in the cluster, in the same form so they can be compared
+// line by line. Only the fields given in the manifest are included in
+// the definition from the cluster, so that defaults filled in by the
+// API server, and the status, don't show up as differences.
+type Comparison struct {
+	Applied []byte
+	Live    []byte // nil if the resource doesn't exist in the cluster
+	Skipped bool   // the resource wouldn't be synced, e.g., since its namespace is excluded
+	Error   error
+}
+
 type ResourceError struct {
 	resource.Resource
 	Error error
@@ -34,3 +75,18 @@ func (err SyncError) Error() string {
 	}
 	return strings.Join(errs, "; ")
 }
+
+// ValidationError is returned from a sync when resources failed
+// validation, in which case none of the resources will have been
+// applied.
+type ValidationError struct {
+	SyncError
+}
+
+func (err ValidationError) Error() string {
+	var errs []string
+	for _, e := range err.SyncError {
+		errs = append(errs, e.ResourceID().String()+" ("+e.Source()+"): "+e.Error.Error())
+	}
+	return "validation failed: " + strings.Join(errs, "; ")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/update"
+)
+
+type approveOpts struct {
+	*rootOpts
+	outputOpts
+	cause update.Cause
+}
+
+func newApprove(parent *rootOpts) *approveOpts {
+	return &approveOpts{rootOpts: parent}
+}
+
+func (opts *approveOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approve <id>",
+		Short: "Approve an automated release waiting to be committed, as listed by list-pending.",
+		Example: makeExample(
+			"fluxctl approve 3f2a9c1d0b7e",
+			"fluxctl approve 3f2a9c1d0b7e -m 'checked the changelog'",
+		),
+		RunE: opts.RunE,
+	}
+	AddOutputFlags(cmd, &opts.outputOpts)
+	AddCauseFlags(cmd, &opts.cause)
+	return cmd
+}
+
+func (opts *approveOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("please give the ID of the release to approve, as listed by list-pending")
+	}
+	releaser, ok := opts.API.(pendingReleaser)
+	if !ok {
+		return errors.New("the API client cannot approve pending releases")
+	}
+	ctx := context.Background()
+	jobID, err := releaser.ApproveRelease(ctx, args[0], opts.cause)
+	if err != nil {
+		return err
+	}
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, opts.verbosity)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// apiCredentials are what fluxctl presents to a daemon that requires
+// authentication (see fluxd's --api-tokens-file and
+// --listen-tls-client-ca).
+type apiCredentials struct {
+	token    string
+	certFile string
+	keyFile  string
+	caFile   string
+}
+
+// usesTLS reports whether the API should be reached over TLS, when
+// fluxctl is choosing the URL itself.
+func (c apiCredentials) usesTLS() bool {
+	return c.certFile != "" || c.caFile != ""
+}
+
+// httpClient makes an HTTP client that presents the credentials with
+// each request.
+func (c apiCredentials) httpClient() (*http.Client, error) {
+	if c.token == "" && c.certFile == "" && c.keyFile == "" && c.caFile == "" {
+		return http.DefaultClient, nil
+	}
+	var transport http.RoundTripper = http.DefaultTransport
+	if c.certFile != "" || c.keyFile != "" || c.caFile != "" {
+		config := &tls.Config{}
+		if c.certFile != "" || c.keyFile != "" {
+			if c.certFile == "" || c.keyFile == "" {
+				return nil, newUsageError("--tls-cert and --tls-key must be given together")
+			}
+			cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("loading client certificate: %s", err)
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+		if c.caFile != "" {
+			pem, err := ioutil.ReadFile(c.caFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading CA certificate: %s", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", c.caFile)
+			}
+			config.RootCAs = pool
+		}
+		transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config,
+		}
+	}
+	if c.token != "" {
+		transport = bearerTokenTransport{token: c.token, next: transport}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// bearerTokenTransport adds a bearer token to each request.
+type bearerTokenTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t bearerTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers mustn't change the request they're given
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(r)
+}
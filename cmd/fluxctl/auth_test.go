@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPICredentials_Token(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	c, err := apiCredentials{token: "secret"}.httpClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != "Bearer secret" {
+		t.Errorf("expected the token to be presented, got %q", got)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Error("expected the request given not to be changed")
+	}
+}
+
+func TestAPICredentials_Invalid(t *testing.T) {
+	if _, err := (apiCredentials{certFile: "client.crt"}).httpClient(); err == nil {
+		t.Error("expected an error for a certificate without a key")
+	}
+	if _, err := (apiCredentials{caFile: "/does/not/exist"}).httpClient(); err == nil {
+		t.Error("expected an error for a missing CA certificate")
+	}
+	if c, err := (apiCredentials{}).httpClient(); err != nil || c != http.DefaultClient {
+		t.Error("expected the default client when no credentials are given")
+	}
+}
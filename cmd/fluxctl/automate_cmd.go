@@ -8,8 +8,10 @@ import (
 
 type controllerAutomateOpts struct {
 	*rootOpts
-	namespace  string
-	controller string
+	namespace   string
+	controllers []string
+	selector    string
+	all         bool
 	outputOpts
 	cause update.Cause
 
@@ -27,13 +29,16 @@ func (opts *controllerAutomateOpts) Command() *cobra.Command {
 		Short: "Turn on automatic deployment for a controller.",
 		Example: makeExample(
 			"fluxctl automate --controller=default:deployment/helloworld",
+			"fluxctl automate --namespace=foo --all",
 		),
 		RunE: opts.RunE,
 	}
 	AddOutputFlags(cmd, &opts.outputOpts)
 	AddCauseFlags(cmd, &opts.cause)
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
-	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Controller to automate")
+	cmd.Flags().StringSliceVarP(&opts.controllers, "controller", "c", nil, "Controller to automate, or a pattern matching controllers; give more than once for several")
+	cmd.Flags().StringVarP(&opts.selector, "selector", "l", "", "Automate the controllers with labels matching this selector")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Automate all the controllers in the namespace")
 
 	// Deprecated
 	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Service to automate")
@@ -47,12 +52,14 @@ func (opts *controllerAutomateOpts) RunE(cmd *cobra.Command, args []string) erro
 		return errorServiceFlagDeprecated
 	}
 	policyOpts := &controllerPolicyOpts{
-		rootOpts:   opts.rootOpts,
-		outputOpts: opts.outputOpts,
-		namespace:  opts.namespace,
-		controller: opts.controller,
-		cause:      opts.cause,
-		automate:   true,
+		rootOpts:    opts.rootOpts,
+		outputOpts:  opts.outputOpts,
+		namespace:   opts.namespace,
+		controllers: opts.controllers,
+		selector:    opts.selector,
+		all:         opts.all,
+		cause:       opts.cause,
+		automate:    true,
 	}
 	return policyOpts.RunE(cmd, args)
 }
@@ -5,18 +5,43 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/update"
 )
 
 var ErrTimeout = errors.New("timeout")
 
+var errSyncTimeout = errors.New("timed out waiting for commit to be applied")
+
 // await polls for a job to complete, then for the resulting commit to
 // be applied
 func await(ctx context.Context, stdout, stderr io.Writer, client api.Server, jobID job.ID, apply bool, verbosity int) error {
+	_, err := awaitResult(ctx, stdout, stderr, client, jobID, apply, verbosity)
+	if err == errSyncTimeout {
+		fmt.Fprintln(stderr, `
+The operation succeeded, but we timed out waiting for the commit to be
+applied. This does not necessarily mean there is a problem. Use
+
+    fluxctl sync
+
+to run a sync interactively.`)
+		return nil
+	}
+	return err
+}
+
+// awaitResult does the work of await, and returns the result of the
+// job. If the commit is not applied in time, it returns
+// errSyncTimeout.
+func awaitResult(ctx context.Context, stdout, stderr io.Writer, client api.Server, jobID job.ID, apply bool, verbosity int) (job.Result, error) {
 	result, err := awaitJob(ctx, client, jobID)
 	if err != nil {
 		if err == ErrTimeout {
@@ -27,37 +52,55 @@ cluster, or commit logs, to see if there was a result. In general, it
 is safe to retry operations.`)
 			// because the outcome is unknown, still return the err to indicate an exceptional exit
 		}
-		return err
+		return result, err
 	}
 	if result.Result != nil {
 		update.PrintResults(stdout, result.Result, verbosity)
 	}
+	printPlan(stdout, result)
 	if result.Revision != "" {
 		fmt.Fprintf(stderr, "Commit pushed:\t%s\n", result.Revision[:7])
 	}
 	if result.Result == nil {
 		fmt.Fprintf(stderr, "Nothing to do\n")
-		return nil
+		return result, nil
 	}
 
 	if apply && result.Revision != "" {
 		if err := awaitSync(ctx, client, result.Revision); err != nil {
 			if err == ErrTimeout {
-				fmt.Fprintln(stderr, `
-The operation succeeded, but we timed out waiting for the commit to be
-applied. This does not necessarily mean there is a problem. Use
-
-    fluxctl sync
-
-to run a sync interactively.`)
-				return nil
+				return result, errSyncTimeout
 			}
-			return err
+			return result, err
 		}
 		fmt.Fprintf(stderr, "Commit applied:\t%s\n", result.Revision[:7])
 	}
 
-	return nil
+	return result, nil
+}
+
+// printPlan writes out the changes a release that was only planned
+// would make to files, and the message it would commit them with. Jobs
+// run by daemons that don't report these print nothing.
+func printPlan(out io.Writer, result job.Result) {
+	if len(result.Diffs) == 0 {
+		return
+	}
+	fmt.Fprintln(out)
+	for _, d := range result.Diffs {
+		fmt.Fprint(out, d.Diff)
+	}
+	if result.CommitMessage != "" {
+		fmt.Fprintf(out, "\nCommit message:\n\n%s\n", indent(result.CommitMessage, "    "))
+	}
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i := range lines {
+		lines[i] = prefix + lines[i]
+	}
+	return strings.Join(lines, "\n")
 }
 
 // await polls for a job to have been completed, with exponential backoff.
@@ -92,6 +135,54 @@ func awaitSync(ctx context.Context, client api.Server, revision string) error {
 	})
 }
 
+// awaitRollout polls for the controllers given to have rolled out
+// their current definitions, with exponential backoff. It returns an
+// error if any of them reports that its rollout has failed.
+func awaitRollout(ctx context.Context, stderr io.Writer, client api.Server, ids []flux.ResourceID, timeout time.Duration) error {
+	pending := map[flux.ResourceID]bool{}
+	for _, id := range ids {
+		pending[id] = true
+	}
+	err := backoff(1*time.Second, 2, 10, timeout, func() (bool, error) {
+		controllers, err := client.ListServices(ctx, "")
+		if err != nil {
+			return false, err
+		}
+		for _, c := range controllers {
+			if !pending[c.ID] {
+				continue
+			}
+			if c.Status == cluster.StatusError {
+				return false, fmt.Errorf("rollout of %s failed: %s", c.ID, strings.Join(c.Rollout.Messages, "; "))
+			}
+			if rolledOut(c) {
+				fmt.Fprintf(stderr, "Rolled out:\t%s\n", c.ID)
+				delete(pending, c.ID)
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if err == ErrTimeout {
+		var waiting []string
+		for id := range pending {
+			waiting = append(waiting, id.String())
+		}
+		sort.Strings(waiting)
+		return fmt.Errorf("timed out waiting for rollout of %s", strings.Join(waiting, ", "))
+	}
+	return err
+}
+
+// rolledOut reports whether all of a controller's pods are running its
+// current definition, and are ready. Controllers which don't report
+// the progress of rollouts are taken to be rolled out once their
+// status says so.
+func rolledOut(c v6.ControllerStatus) bool {
+	r := c.Rollout
+	return c.Status != cluster.StatusUpdating &&
+		r.Updated == r.Desired && r.Ready == r.Desired && r.Outdated == 0
+}
+
 // backoff polls for f() to have been completed, with exponential backoff.
 func backoff(initialDelay, factor, maxFactor, timeout time.Duration, f func() (bool, error)) error {
 	maxDelay := initialDelay * maxFactor
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+const envVariableConfig = "FLUX_CONFIG"
+
+// fluxctlConfig is what's kept in the config file: named contexts,
+// each saying how to connect to a fluxd, and which is used when none
+// is given.
+type fluxctlConfig struct {
+	CurrentContext string         `yaml:"current-context,omitempty"`
+	Contexts       []namedContext `yaml:"contexts,omitempty"`
+}
+
+// namedContext has values for fluxctl's flags, used when they're not
+// given otherwise.
+type namedContext struct {
+	Name          string `yaml:"name"`
+	URL           string `yaml:"url,omitempty"`
+	Token         string `yaml:"token,omitempty"`
+	K8sFwdNS      string `yaml:"k8s-fwd-ns,omitempty"`
+	K8sConnection string `yaml:"k8s-connection,omitempty"`
+	K8sService    string `yaml:"k8s-service,omitempty"`
+	AuthToken     string `yaml:"auth-token,omitempty"`
+	TLSCert       string `yaml:"tls-cert,omitempty"`
+	TLSKey        string `yaml:"tls-key,omitempty"`
+	TLSCACert     string `yaml:"tls-ca-cert,omitempty"`
+
+	// The namespace of workloads, for commands that take --namespace
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// configPath gives the path of the config file: from the environment
+// if set there, otherwise `~/.flux/config`.
+func configPath() (string, error) {
+	if path := os.Getenv(envVariableConfig); path != "" {
+		return path, nil
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		u, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf("finding home directory for config file (you can set %s instead): %s", envVariableConfig, err)
+		}
+		home = u.HomeDir
+	}
+	return filepath.Join(home, ".flux", "config"), nil
+}
+
+// loadConfig reads the config file at the path given; if there's no
+// such file, the config is empty.
+func loadConfig(path string) (*fluxctlConfig, error) {
+	var config fluxctlConfig
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(bytes, &config); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %s", path, err)
+	}
+	return &config, nil
+}
+
+// save writes the config file, readable only by its owner since it
+// may have tokens in it.
+func (c *fluxctlConfig) save(path string) error {
+	bytes, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0600)
+}
+
+func (c *fluxctlConfig) context(name string) (namedContext, bool) {
+	for _, ctx := range c.Contexts {
+		if ctx.Name == name {
+			return ctx, true
+		}
+	}
+	return namedContext{}, false
+}
+
+// setContext adds the context given, or replaces the one with the
+// same name.
+func (c *fluxctlConfig) setContext(ctx namedContext) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == ctx.Name {
+			c.Contexts[i] = ctx
+			return
+		}
+	}
+	c.Contexts = append(c.Contexts, ctx)
+}
+
+func (c *fluxctlConfig) deleteContext(name string) bool {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			c.Contexts = append(c.Contexts[:i], c.Contexts[i+1:]...)
+			if c.CurrentContext == name {
+				c.CurrentContext = ""
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// flagValues gives the flags to which each value in the context
+// corresponds.
+func (ctx *namedContext) flagValues() []struct {
+	flag  string
+	value *string
+} {
+	return []struct {
+		flag  string
+		value *string
+	}{
+		{"url", &ctx.URL},
+		{"token", &ctx.Token},
+		{"k8s-fwd-ns", &ctx.K8sFwdNS},
+		{"k8s-connection", &ctx.K8sConnection},
+		{"k8s-service", &ctx.K8sService},
+		{"auth-token", &ctx.AuthToken},
+		{"tls-cert", &ctx.TLSCert},
+		{"tls-key", &ctx.TLSKey},
+		{"tls-ca-cert", &ctx.TLSCACert},
+		{"namespace", &ctx.Namespace},
+	}
+}
+
+// applyTo sets the flags given to the values in the context, where
+// the flags exist and haven't been set on the command line. This
+// doesn't count as setting them, so that environment variables still
+// take precedence.
+func (ctx namedContext) applyTo(flags *pflag.FlagSet) error {
+	for _, fv := range ctx.flagValues() {
+		f := flags.Lookup(fv.flag)
+		if f == nil || f.Changed || *fv.value == "" {
+			continue
+		}
+		if err := f.Value.Set(*fv.value); err != nil {
+			return fmt.Errorf("setting --%s from context %q: %s", fv.flag, ctx.Name, err)
+		}
+	}
+	return nil
+}
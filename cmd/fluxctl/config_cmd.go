@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+type configOpts struct {
+	*rootOpts
+	namespace string
+}
+
+func newConfig(parent *rootOpts) *configOpts {
+	return &configOpts{rootOpts: parent}
+}
+
+var configLongHelp = strings.TrimSpace(`
+Manage the contexts kept in the config file (~/.flux/config, or the
+file given in $FLUX_CONFIG).
+
+A context names a set of values for the flags that say how to
+connect to fluxd (--url, --k8s-fwd-ns, --k8s-connection,
+--k8s-service, --token, --auth-token, --tls-cert, --tls-key,
+--tls-ca-cert), and a default for --namespace in commands that take
+it. The context given with --context, or else the current context,
+supplies values for those flags not given on the command line or in
+environment variables.
+`)
+
+func (opts *configOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage named contexts for connecting to fluxd",
+		Long:  configLongHelp,
+		// This only deals with the config file, so needn't connect
+		// to fluxd as other commands do.
+		PersistentPreRunE: func(*cobra.Command, []string) error { return nil },
+	}
+
+	setContext := &cobra.Command{
+		Use:   "set-context <name>",
+		Short: "Add a context, or change the values in one, from the flags given",
+		Example: makeExample(
+			"fluxctl config set-context staging --k8s-fwd-ns=flux --namespace=team-a",
+			"fluxctl config set-context prod --url=https://flux.example.com/api/flux --auth-token=$TOKEN",
+		),
+		RunE: opts.setContext,
+	}
+	setContext.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "Namespace of workloads, for commands that take --namespace")
+
+	cmd.AddCommand(
+		setContext,
+		&cobra.Command{
+			Use:     "use-context <name>",
+			Short:   "Make a context the current context",
+			Example: makeExample("fluxctl config use-context prod"),
+			RunE:    opts.useContext,
+		},
+		&cobra.Command{
+			Use:   "current-context",
+			Short: "Print the name of the current context",
+			RunE:  opts.currentContext,
+		},
+		&cobra.Command{
+			Use:   "get-contexts",
+			Short: "List the contexts in the config file",
+			RunE:  opts.getContexts,
+		},
+		&cobra.Command{
+			Use:   "delete-context <name>",
+			Short: "Remove a context from the config file",
+			RunE:  opts.deleteContext,
+		},
+	)
+	return cmd
+}
+
+func (opts *configOpts) load() (*fluxctlConfig, string, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, "", err
+	}
+	config, err := loadConfig(path)
+	return config, path, err
+}
+
+func (opts *configOpts) setContext(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("please supply the name of the context")
+	}
+	config, path, err := opts.load()
+	if err != nil {
+		return err
+	}
+	ctx, _ := config.context(args[0])
+	ctx.Name = args[0]
+	for _, fv := range ctx.flagValues() {
+		if f := cmd.Flags().Lookup(fv.flag); f != nil && f.Changed {
+			*fv.value = f.Value.String()
+		}
+	}
+	config.setContext(ctx)
+	return config.save(path)
+}
+
+func (opts *configOpts) useContext(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("please supply the name of the context")
+	}
+	config, path, err := opts.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.context(args[0]); !ok {
+		return fmt.Errorf("no context named %q in %s", args[0], path)
+	}
+	config.CurrentContext = args[0]
+	return config.save(path)
+}
+
+func (opts *configOpts) currentContext(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	config, _, err := opts.load()
+	if err != nil {
+		return err
+	}
+	if config.CurrentContext == "" {
+		return fmt.Errorf("no current context is set")
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), config.CurrentContext)
+	return nil
+}
+
+func (opts *configOpts) getContexts(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	config, _, err := opts.load()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "CURRENT\tNAME\tCONNECTION\tNAMESPACE")
+	for _, ctx := range config.Contexts {
+		current := ""
+		if ctx.Name == config.CurrentContext {
+			current = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", current, ctx.Name, ctx.connection(), ctx.Namespace)
+	}
+	return w.Flush()
+}
+
+func (opts *configOpts) deleteContext(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("please supply the name of the context")
+	}
+	config, path, err := opts.load()
+	if err != nil {
+		return err
+	}
+	if !config.deleteContext(args[0]) {
+		return fmt.Errorf("no context named %q in %s", args[0], path)
+	}
+	return config.save(path)
+}
+
+// connection describes how the context connects to fluxd, without
+// giving away any tokens.
+func (ctx namedContext) connection() string {
+	switch {
+	case ctx.URL != "":
+		return ctx.URL
+	case ctx.Token != "":
+		return defaultURLGivenToken
+	}
+	how := "port forward"
+	if ctx.K8sConnection == connectionProxy {
+		service := ctx.K8sService
+		if service == "" {
+			service = defaultK8sService
+		}
+		how = "proxy to service " + service
+	}
+	if ctx.K8sFwdNS != "" {
+		how += " in namespace " + ctx.K8sFwdNS
+	}
+	return how
+}
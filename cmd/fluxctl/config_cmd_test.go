@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withConfigFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "fluxctl-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config")
+	old := os.Getenv(envVariableConfig)
+	os.Setenv(envVariableConfig, path)
+	return path, func() {
+		os.Setenv(envVariableConfig, old)
+		os.RemoveAll(dir)
+	}
+}
+
+func runFluxctl(t *testing.T, args ...string) (string, error) {
+	cmd := newRoot().Command()
+	var out bytes.Buffer
+	cmd.SetOutput(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestConfig_Contexts(t *testing.T) {
+	path, cleanup := withConfigFile(t)
+	defer cleanup()
+
+	_, err := runFluxctl(t, "config", "current-context")
+	if err == nil {
+		t.Error("expected an error when there is no current context")
+	}
+
+	if _, err := runFluxctl(t, "config", "set-context", "staging", "--k8s-fwd-ns=flux"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runFluxctl(t, "config", "set-context", "prod", "--url=https://flux.example.com/api/flux", "--auth-token=secret", "-n", "team-a"); err != nil {
+		t.Fatal(err)
+	}
+	// Changing one value leaves the others
+	if _, err := runFluxctl(t, "config", "set-context", "prod", "--namespace=team-b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runFluxctl(t, "config", "use-context", "nonesuch"); err == nil {
+		t.Error("expected an error using a context that doesn't exist")
+	}
+	if _, err := runFluxctl(t, "config", "use-context", "prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := namedContext{Name: "prod", URL: "https://flux.example.com/api/flux", AuthToken: "secret", Namespace: "team-b"}
+	if ctx, _ := config.context("prod"); ctx != expected {
+		t.Errorf("expected context %+v, got %+v", expected, ctx)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the config file to be readable only by its owner, got %v (%v)", info.Mode(), err)
+	}
+
+	out, err := runFluxctl(t, "config", "get-contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "secret") {
+		t.Error("expected tokens not to be shown")
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[2], "*") || !strings.Contains(lines[2], "prod") {
+		t.Errorf("expected both contexts, with prod as current, got:\n%s", out)
+	}
+
+	if _, err := runFluxctl(t, "config", "delete-context", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	config, _ = loadConfig(path)
+	if _, ok := config.context("prod"); ok || config.CurrentContext != "" {
+		t.Errorf("expected prod to be gone, and not current, got %+v", config)
+	}
+}
+
+func TestConfig_UsesContext(t *testing.T) {
+	_, cleanup := withConfigFile(t)
+	defer cleanup()
+	os.Unsetenv(envVariableURL)
+	os.Unsetenv(envVariableAuthToken)
+
+	var namespace, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace = r.URL.Query().Get("namespace")
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	if _, err := runFluxctl(t, "config", "set-context", "test", "--url="+server.URL, "--auth-token=secret", "--namespace=team-a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runFluxctl(t, "--context=nonesuch", "list-controllers"); err == nil {
+		t.Error("expected an error naming a context that doesn't exist")
+	}
+
+	if _, err := runFluxctl(t, "--context=test", "list-controllers"); err != nil {
+		t.Fatal(err)
+	}
+	if namespace != "team-a" || auth != "Bearer secret" {
+		t.Errorf("expected the namespace and token from the context, got %q and %q", namespace, auth)
+	}
+
+	// Flags given override the context
+	if _, err := runFluxctl(t, "--context=test", "list-controllers", "--namespace=team-b"); err != nil {
+		t.Fatal(err)
+	}
+	if namespace != "team-b" {
+		t.Errorf("expected the namespace given as a flag, got %q", namespace)
+	}
+}
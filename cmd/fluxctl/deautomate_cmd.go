@@ -8,8 +8,10 @@ import (
 
 type controllerDeautomateOpts struct {
 	*rootOpts
-	namespace  string
-	controller string
+	namespace   string
+	controllers []string
+	selector    string
+	all         bool
 	outputOpts
 	cause update.Cause
 
@@ -33,7 +35,9 @@ func (opts *controllerDeautomateOpts) Command() *cobra.Command {
 	AddOutputFlags(cmd, &opts.outputOpts)
 	AddCauseFlags(cmd, &opts.cause)
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
-	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Controller to deautomate")
+	cmd.Flags().StringSliceVarP(&opts.controllers, "controller", "c", nil, "Controller to deautomate, or a pattern matching controllers; give more than once for several")
+	cmd.Flags().StringVarP(&opts.selector, "selector", "l", "", "Deautomate the controllers with labels matching this selector")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Deautomate all the controllers in the namespace")
 
 	// Deprecated
 	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Service to deautomate")
@@ -47,12 +51,14 @@ func (opts *controllerDeautomateOpts) RunE(cmd *cobra.Command, args []string) er
 		return errorServiceFlagDeprecated
 	}
 	policyOpts := &controllerPolicyOpts{
-		rootOpts:   opts.rootOpts,
-		outputOpts: opts.outputOpts,
-		namespace:  opts.namespace,
-		controller: opts.controller,
-		cause:      opts.cause,
-		deautomate: true,
+		rootOpts:    opts.rootOpts,
+		outputOpts:  opts.outputOpts,
+		namespace:   opts.namespace,
+		controllers: opts.controllers,
+		selector:    opts.selector,
+		all:         opts.all,
+		cause:       opts.cause,
+		deautomate:  true,
 	}
 	return policyOpts.RunE(cmd, args)
 }
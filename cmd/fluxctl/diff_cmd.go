@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/api/v10"
+)
+
+type diffOpts struct {
+	*rootOpts
+	namespace     string
+	allNamespaces bool
+	asJSON        bool
+}
+
+func newDiff(parent *rootOpts) *diffOpts {
+	return &diffOpts{rootOpts: parent}
+}
+
+// diffReader is implemented by API clients that can fetch what a
+// sync would change, which isn't part of api.Server.
+type diffReader interface {
+	Diff(ctx context.Context, namespace string) (v10.Diff, error)
+}
+
+func (opts *diffOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show what syncing the head of the git branch would change in the cluster, without syncing.",
+		Example: makeExample(
+			"fluxctl diff",
+			"fluxctl diff --all-namespaces",
+			"fluxctl diff --namespace=monitoring --json",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Confine query to namespace")
+	cmd.Flags().BoolVarP(&opts.allNamespaces, "all-namespaces", "a", false, "Query across all namespaces")
+	cmd.Flags().BoolVar(&opts.asJSON, "json", false, "Print the diff of every resource as JSON")
+	return cmd
+}
+
+func (opts *diffOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	namespace := opts.namespace
+	if opts.allNamespaces {
+		namespace = ""
+	}
+
+	reader, ok := opts.API.(diffReader)
+	if !ok {
+		return errors.New("the API client cannot fetch diffs")
+	}
+	diff, err := reader.Diff(context.Background(), namespace)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if opts.asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	printDiff(out, diff)
+	return nil
+}
+
+// printDiff writes out the diff of each resource a sync would change,
+// and any that couldn't be compared, followed by a count of each.
+func printDiff(out io.Writer, diff v10.Diff) {
+	counts := map[string]int{}
+	for _, r := range diff.Resources {
+		counts[r.Status]++
+		switch r.Status {
+		case v10.DiffCreate, v10.DiffUpdate:
+			fmt.Fprint(out, r.Diff)
+		case v10.DiffError:
+			fmt.Fprintf(out, "%s (%s): %s\n", r.ID, r.Path, r.Error)
+		}
+	}
+
+	var summary []string
+	for _, s := range []struct {
+		status, desc string
+	}{
+		{v10.DiffCreate, "to create"},
+		{v10.DiffUpdate, "to update"},
+		{v10.DiffUnchanged, "unchanged"},
+		{v10.DiffError, "could not be compared"},
+	} {
+		if counts[s.status] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[s.status], s.desc))
+		}
+	}
+	if len(summary) == 0 {
+		summary = []string{"no resources to sync"}
+	}
+	if diff.Revision != "" {
+		fmt.Fprintf(out, "\nAt revision %s: %s.\n", diff.Revision, strings.Join(summary, ", "))
+	} else {
+		fmt.Fprintf(out, "\n%s.\n", strings.Join(summary, ", "))
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
+	transport "github.com/weaveworks/flux/http"
+)
+
+func TestDiffCommand(t *testing.T) {
+	const helloDiff = `--- live/default:deployment/helloworld
++++ git/default:deployment/helloworld
+@@ -1 +1 @@
+-replicas: 1
++replicas: 2
+`
+	diff := v10.Diff{
+		Revision: syncedRevision,
+		Resources: []v10.ResourceDiff{
+			{ID: flux.MustParseResourceID("default:deployment/helloworld"), Path: "helloworld-deploy.yaml", Status: v10.DiffUpdate, Diff: helloDiff},
+			{ID: flux.MustParseResourceID("default:service/helloworld"), Path: "helloworld-svc.yaml", Status: v10.DiffUnchanged},
+			{ID: flux.MustParseResourceID("default:widget/broken"), Path: "widget.yaml", Status: v10.DiffError, Error: "no matches for kind"},
+		},
+	}
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("Diff"): diff,
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+	cmd := newDiff(mockServiceOpts(svc)).Command()
+	out := &bytes.Buffer{}
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{"--all-namespaces"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ns := svc.calledURL("Diff").Query().Get("namespace"); ns != "" {
+		t.Errorf("expected no namespace to be given, got %q", ns)
+	}
+	got := out.String()
+	for _, want := range []string{
+		helloDiff,
+		"default:widget/broken (widget.yaml): no matches for kind",
+		"1 to update, 1 unchanged, 1 could not be compared.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+}
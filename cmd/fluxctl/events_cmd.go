@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/audit"
+	fluxerr "github.com/weaveworks/flux/errors"
+)
+
+type eventsOpts struct {
+	*rootOpts
+	since    string
+	limit    int
+	severity string
+	actions  []string
+	asJSON   bool
+	follow   bool
+}
+
+func newEvents(parent *rootOpts) *eventsOpts {
+	return &eventsOpts{rootOpts: parent}
+}
+
+// auditReader is implemented by API clients that can fetch the
+// daemon's audit log, which isn't part of api.Server.
+type auditReader interface {
+	AuditEvents(ctx context.Context, q audit.Query) ([]audit.Record, error)
+}
+
+// auditWatcher is implemented by API clients that can stream the
+// records from the daemon's audit log as they are made.
+type auditWatcher interface {
+	WatchAuditEvents(ctx context.Context, q audit.Query, fn func(audit.Record) error) error
+}
+
+// How long to wait before reconnecting, when following events and
+// the stream is lost.
+var followRetryInterval = 2 * time.Second
+
+func (opts *eventsOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show the releases, policy changes, automated updates and syncs recorded in the audit log.",
+		Example: makeExample(
+			"fluxctl events",
+			"fluxctl events --since=24h",
+			"fluxctl events --severity=error --action=sync",
+			"fluxctl events --since=2019-06-01T00:00:00Z --json",
+			"fluxctl events --follow --action=sync",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only show events after this time, given as a duration before now (e.g., '24h') or an RFC3339 timestamp")
+	cmd.Flags().IntVar(&opts.limit, "limit", 50, "Show at most this many of the most recent events; zero means all")
+	cmd.Flags().StringVar(&opts.severity, "severity", "", "Only show events at least this severe: info, warning or error")
+	cmd.Flags().StringSliceVar(&opts.actions, "action", nil, "Only show events of these actions: "+strings.Join(actionNames(), ", "))
+	cmd.Flags().BoolVar(&opts.asJSON, "json", false, "Print the events as JSON, one per line")
+	cmd.Flags().BoolVarP(&opts.follow, "follow", "f", false, "After the events so far, keep showing events as they are recorded, until interrupted")
+	return cmd
+}
+
+func (opts *eventsOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	q := audit.Query{Limit: opts.limit}
+	if opts.since != "" {
+		var err error
+		if q.Since, err = eventsSince(opts.since, time.Now()); err != nil {
+			return newUsageError(err.Error())
+		}
+	}
+	if opts.severity != "" {
+		var err error
+		if q.MinSeverity, err = audit.ParseSeverity(opts.severity); err != nil {
+			return newUsageError(err.Error())
+		}
+	}
+	for _, a := range opts.actions {
+		action, err := audit.ParseAction(a)
+		if err != nil {
+			return newUsageError(err.Error())
+		}
+		q.Actions = append(q.Actions, action)
+	}
+
+	reader, ok := opts.API.(auditReader)
+	if !ok {
+		return errors.New("the API client cannot fetch the daemon's audit log")
+	}
+	var watcher auditWatcher
+	if opts.follow {
+		if watcher, ok = opts.API.(auditWatcher); !ok {
+			return errors.New("the API client cannot follow the daemon's audit log")
+		}
+	}
+	ctx := context.Background()
+	fetched := time.Now()
+	records, err := reader.AuditEvents(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	printRecord := func(r audit.Record) error {
+		return json.NewEncoder(cmd.OutOrStdout()).Encode(r)
+	}
+	flush := func() error { return nil }
+	if !opts.asJSON {
+		w := newTabwriter()
+		fmt.Fprintf(w, "TIME\tSEVERITY\tACTION\tUSER\tREVISION\tWORKLOADS\tSUMMARY\n")
+		printRecord = func(r audit.Record) error {
+			printEventRow(w, r)
+			return nil
+		}
+		flush = w.Flush
+	}
+	for _, r := range records {
+		if err := printRecord(r); err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if !opts.follow {
+		return nil
+	}
+
+	q.Limit = 0
+	if len(records) > 0 {
+		q.AfterID = records[len(records)-1].ID
+	} else if q.Since.IsZero() {
+		q.Since = fetched
+	}
+	// Each event is shown as it comes; so, in a table, the columns
+	// line up only with those shown at the same time.
+	return followEvents(ctx, watcher, q, func(r audit.Record) error {
+		if err := printRecord(r); err != nil {
+			return err
+		}
+		return flush()
+	})
+}
+
+func printEventRow(w io.Writer, r audit.Record) {
+	var workloads []string
+	for _, id := range r.Workloads {
+		workloads = append(workloads, id.String())
+	}
+	summary := r.Summary
+	if r.Error != "" {
+		summary += " (error: " + r.Error + ")"
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Time.Local().Format(time.RFC3339), r.Severity, r.Action, recordUser(r), shortRevision(r.Revision), strings.Join(workloads, ","), summary)
+}
+
+// recordUser gives who asked for the change: the identities they were
+// authenticated as, if known, and the user they said they were, if
+// that's something else.
+func recordUser(r audit.Record) string {
+	if len(r.Identities) == 0 {
+		return r.User
+	}
+	ids := strings.Join(r.Identities, ",")
+	for _, id := range r.Identities {
+		if id == r.User {
+			return ids
+		}
+	}
+	if r.User != "" {
+		return ids + " (as " + r.User + ")"
+	}
+	return ids
+}
+
+// followEvents prints events from the stream until the context is
+// cancelled, reconnecting, from the last event seen, if the stream
+// is lost. Errors from the API itself (e.g., if the daemon is too old
+// to stream events) aren't worth retrying, so are returned.
+func followEvents(ctx context.Context, watcher auditWatcher, q audit.Query, printRecord func(audit.Record) error) error {
+	for {
+		var printErr error
+		err := watcher.WatchAuditEvents(ctx, q, func(r audit.Record) error {
+			if printErr = printRecord(r); printErr != nil {
+				return printErr
+			}
+			q.AfterID = r.ID
+			return nil
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if printErr != nil {
+			return printErr
+		}
+		if _, ok := pkgerrors.Cause(err).(*fluxerr.Error); ok {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Lost the stream of events (%s); reconnecting.\n", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(followRetryInterval):
+		}
+	}
+}
+
+// eventsSince interprets the time given to --since, either as a
+// duration before now, or an RFC3339 timestamp.
+func eventsSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q; expected a duration (e.g., 24h) or an RFC3339 timestamp", s)
+	}
+	return t, nil
+}
+
+func actionNames() []string {
+	var names []string
+	for _, a := range audit.Actions {
+		names = append(names, string(a))
+	}
+	return names
+}
+
+func shortRevision(rev string) string {
+	if len(rev) <= 7 {
+		return rev
+	}
+	return rev[:7]
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/audit"
+	fluxerr "github.com/weaveworks/flux/errors"
+	transport "github.com/weaveworks/flux/http"
+)
+
+func TestEventsCommand_JSON(t *testing.T) {
+	records := []audit.Record{
+		{
+			Time:      time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+			Action:    audit.Policy,
+			User:      "alice",
+			Workloads: []flux.ResourceID{flux.MustParseResourceID("default:deployment/helloworld")},
+			Revision:  syncedRevision,
+			Summary:   "Locked: default:deployment/helloworld",
+		},
+		{
+			Time:     time.Date(2019, 6, 1, 12, 1, 0, 0, time.UTC),
+			Action:   audit.Sync,
+			Revision: syncedRevision,
+			Summary:  "synced 1 commit(s)",
+		},
+	}
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("AuditEvents"): records,
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+	cmd := newEvents(mockServiceOpts(svc)).Command()
+	out := &bytes.Buffer{}
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{"--json", "--since=2019-06-01T00:00:00Z", "--limit=10", "--severity=warning", "--action=sync,rollback"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := svc.calledRequest("AuditEvents")
+	if req == nil {
+		t.Fatal("expected the audit log to be requested")
+	}
+	if since := req.URL.Query().Get("since"); since != "2019-06-01T00:00:00Z" {
+		t.Errorf("expected since to be passed on, got %q", since)
+	}
+	if limit := req.URL.Query().Get("limit"); limit != "10" {
+		t.Errorf("expected limit to be passed on, got %q", limit)
+	}
+	if severity := req.URL.Query().Get("severity"); severity != "warning" {
+		t.Errorf("expected severity to be passed on, got %q", severity)
+	}
+	if actions := req.URL.Query().Get("actions"); actions != "sync,rollback" {
+		t.Errorf("expected actions to be passed on, got %q", actions)
+	}
+
+	dec := json.NewDecoder(out)
+	var got []audit.Record
+	for dec.More() {
+		var r audit.Record
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if len(got) != 2 || got[0].User != "alice" || got[1].Action != audit.Sync {
+		t.Errorf("unexpected events printed: %+v", got)
+	}
+}
+
+func TestEventsCommand_InvalidFilters(t *testing.T) {
+	for _, args := range [][]string{
+		{"--severity=critical"},
+		{"--action=deploy"},
+	} {
+		svc := &genericMockRoundTripper{
+			mockResponses:  map[*mux.Route]interface{}{},
+			requestHistory: make(map[string]*http.Request),
+		}
+		cmd := newEvents(mockServiceOpts(svc)).Command()
+		cmd.SetOutput(&bytes.Buffer{})
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+		if svc.calledRequest("AuditEvents") != nil {
+			t.Errorf("%v: expected the audit log not to be requested", args)
+		}
+	}
+}
+
+func TestEventsSince(t *testing.T) {
+	now := time.Date(2019, 6, 2, 12, 0, 0, 0, time.UTC)
+	for s, expected := range map[string]time.Time{
+		"24h":                  time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+		"2019-06-01T00:00:00Z": time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		got, err := eventsSince(s, now)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if !got.Equal(expected) {
+			t.Errorf("%s: expected %s, got %s", s, expected, got)
+		}
+	}
+	if _, err := eventsSince("yesterday", now); err == nil {
+		t.Error("expected an error for an invalid time")
+	}
+}
+
+type mockWatcher struct {
+	queries []audit.Query
+	streams [][]audit.Record
+	errs    []error
+}
+
+func (w *mockWatcher) WatchAuditEvents(ctx context.Context, q audit.Query, fn func(audit.Record) error) error {
+	i := len(w.queries)
+	w.queries = append(w.queries, q)
+	for _, r := range w.streams[i] {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return w.errs[i]
+}
+
+func TestFollowEvents_Reconnects(t *testing.T) {
+	defer func(d time.Duration) { followRetryInterval = d }(followRetryInterval)
+	followRetryInterval = time.Millisecond
+
+	notFound := &fluxerr.Error{Type: fluxerr.Missing, Err: errors.New("no such route")}
+	watcher := &mockWatcher{
+		streams: [][]audit.Record{
+			{{ID: 11, Revision: "a"}, {ID: 12, Revision: "b"}},
+			{{ID: 13, Revision: "c"}},
+			nil,
+		},
+		errs: []error{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, notFound},
+	}
+	var printed []string
+	err := followEvents(context.Background(), watcher, audit.Query{AfterID: 10}, func(r audit.Record) error {
+		printed = append(printed, r.Revision)
+		return nil
+	})
+	if err != notFound {
+		t.Errorf("expected the API error to end following, got %v", err)
+	}
+	if strings.Join(printed, "") != "abc" {
+		t.Errorf("expected each event to be printed once, got %v", printed)
+	}
+	var afterIDs []uint64
+	for _, q := range watcher.queries {
+		afterIDs = append(afterIDs, q.AfterID)
+	}
+	if !reflect.DeepEqual(afterIDs, []uint64{10, 12, 13}) {
+		t.Errorf("expected each reconnection to resume from the last event seen, got %v", afterIDs)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The directory, under the output directory, in which resources that
+// aren't in a namespace are exported
+const clusterScopedDir = "_cluster"
+
+type exportOpts struct {
+	*rootOpts
+	path    string
+	managed bool
+}
+
+func newExport(parent *rootOpts) *exportOpts {
+	return &exportOpts{rootOpts: parent}
+}
+
+func (opts *exportOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "export resources from the cluster as YAML, ready to be committed to a git repo",
+		Long: `Export the resources in the cluster -- the workloads, and any other kinds
+fluxd is configured to export with --k8s-export-kind -- as YAML, with
+the fields that are filled in by Kubernetes (status, UIDs, resource
+versions, generated names and so on) removed. If a directory is given,
+each resource is written to its own file, under a directory for its
+namespace (or ` + clusterScopedDir + `, if it has none).`,
+		Example: makeExample(
+			"fluxctl export",
+			"fluxctl export --out ./config",
+			"fluxctl export --managed --out ./config",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.path, "out", "o", "-", "directory to write the resources to; '-' means write them to stdout")
+	cmd.Flags().BoolVar(&opts.managed, "managed", false, "only export resources that were applied from manifests (by flux, or kubectl apply), rather than every resource that can be exported")
+	return cmd
+}
+
+func (opts *exportOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	if opts.path != "-" {
+		if info, err := os.Stat(opts.path); err != nil {
+			return err
+		} else if !info.IsDir() {
+			return fmt.Errorf("path %s is not a directory", opts.path)
+		}
+	}
+
+	config, err := opts.API.Export(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "exporting config")
+	}
+
+	yamls := bufio.NewScanner(bytes.NewReader(config))
+	yamls.Buffer(nil, len(config)+1)
+	yamls.Split(splitYAMLDocument)
+	for yamls.Scan() {
+		var object map[interface{}]interface{}
+		if err := yaml.Unmarshal(yamls.Bytes(), &object); err != nil {
+			return errors.Wrap(err, "unmarshalling exported yaml")
+		}
+		if len(object) == 0 {
+			continue
+		}
+		if opts.managed && !wasApplied(object) {
+			continue
+		}
+		cleanExported(object)
+		if err := writeExported(cmd.OutOrStdout(), object, opts.path); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(yamls.Err(), "splitting exported yaml")
+}
+
+// wasApplied reports whether the object was applied from a manifest,
+// going by whether it has the annotation recording the configuration
+// last applied.
+func wasApplied(object map[interface{}]interface{}) bool {
+	annotations, _ := nested(object, "metadata", "annotations").(map[interface{}]interface{})
+	_, ok := annotations["kubectl.kubernetes.io/last-applied-configuration"]
+	return ok
+}
+
+// cleanExported removes the fields that are filled in by Kubernetes,
+// or otherwise wouldn't make sense in a manifest.
+func cleanExported(object map[interface{}]interface{}) {
+	delete(object, "status")
+
+	if metadata, ok := object["metadata"].(map[interface{}]interface{}); ok {
+		for _, field := range []string{
+			"uid",
+			"resourceVersion",
+			"generation",
+			"creationTimestamp",
+			"deletionTimestamp",
+			"deletionGracePeriodSeconds",
+			"selfLink",
+			"managedFields",
+			"ownerReferences",
+			"initializers",
+		} {
+			delete(metadata, field)
+		}
+		// A name generated by the API server will be different
+		// each time the resource is created from the manifest
+		if _, ok := metadata["name"]; ok {
+			delete(metadata, "generateName")
+		}
+		if annotations, ok := metadata["annotations"].(map[interface{}]interface{}); ok {
+			delete(annotations, "deployment.kubernetes.io/revision")
+			delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+			delete(annotations, "kubernetes.io/change-cause")
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+
+	if spec, ok := object["spec"].(map[interface{}]interface{}); ok {
+		deleteNested(spec, "template", "metadata", "creationTimestamp")
+		deleteNested(spec, "jobTemplate", "spec", "template", "metadata", "creationTimestamp")
+		// Cluster IPs are allocated, unless it's a headless service
+		if object["kind"] == "Service" && spec["clusterIP"] != "None" {
+			delete(spec, "clusterIP")
+		}
+	}
+	// The token secrets for service accounts are generated
+	if object["kind"] == "ServiceAccount" {
+		delete(object, "secrets")
+	}
+}
+
+// nested returns the value at the path of keys given, or nil if
+// there's nothing there.
+func nested(object map[interface{}]interface{}, keys ...string) interface{} {
+	var value interface{} = object
+	for _, key := range keys {
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// exportedPath gives the file, relative to the output directory, for
+// an exported object.
+func exportedPath(object map[interface{}]interface{}) string {
+	kind, _ := object["kind"].(string)
+	name, _ := nested(object, "metadata", "name").(string)
+	namespace, _ := nested(object, "metadata", "namespace").(string)
+	if kind == "Namespace" {
+		return filepath.Join(name, "namespace.yaml")
+	}
+	if namespace == "" {
+		namespace = clusterScopedDir
+	}
+	return filepath.Join(namespace, fmt.Sprintf("%s-%s.yaml", name, strings.ToLower(kind)))
+}
+
+func writeExported(stdout io.Writer, object map[interface{}]interface{}, out string) error {
+	buf, err := yaml.Marshal(object)
+	if err != nil {
+		return errors.Wrap(err, "marshalling yaml")
+	}
+
+	if out == "-" {
+		fmt.Fprintln(stdout, "---")
+		fmt.Fprint(stdout, string(buf))
+		return nil
+	}
+
+	path := filepath.Join(out, exportedPath(object))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return errors.Wrap(err, "making directory for namespace")
+	}
+	fmt.Fprintf(stdout, "Exporting %s '%s' to %s\n", object["kind"], nested(object, "metadata", "name"), path)
+	return errors.Wrap(ioutil.WriteFile(path, append([]byte("---\n"), buf...), 0666), "writing yaml file")
+}
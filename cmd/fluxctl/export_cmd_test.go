@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	transport "github.com/weaveworks/flux/http"
+)
+
+const exportedConfig = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: demo
+  uid: 6a3b7c4e-3f1a-11e9-b210-d663bd873d93
+status:
+  phase: Active
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    deployment.kubernetes.io/revision: "3"
+    kubectl.kubernetes.io/last-applied-configuration: '{}'
+  creationTimestamp: 2019-02-28T10:00:00Z
+  generation: 3
+  name: helloworld
+  namespace: demo
+  resourceVersion: "4567"
+  selfLink: /apis/apps/v1/namespaces/demo/deployments/helloworld
+  uid: 7b4c8d5f-3f1a-11e9-b210-d663bd873d93
+spec:
+  template:
+    metadata:
+      creationTimestamp: null
+      labels:
+        name: helloworld
+    spec:
+      volumes:
+      - name: scratch
+        emptyDir: {}
+status:
+  replicas: 1
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+  namespace: demo
+spec:
+  clusterIP: 10.0.0.12
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+rules: []
+`
+
+const expectedDeployment = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: demo
+spec:
+  template:
+    metadata:
+      labels:
+        name: helloworld
+    spec:
+      volumes:
+      - emptyDir: {}
+        name: scratch
+`
+
+func runExport(t *testing.T, args ...string) (string, error) {
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("Export"): []byte(exportedConfig),
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+	cmd := newExport(mockServiceOpts(svc)).Command()
+	out := &bytes.Buffer{}
+	cmd.SetOutput(out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestExportCommand_Directory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fluxctl-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := runExport(t, "--out", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{
+		"demo/namespace.yaml",
+		"demo/helloworld-deployment.yaml",
+		"demo/helloworld-service.yaml",
+		clusterScopedDir + "/reader-clusterrole.yaml",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+
+	deployment, err := ioutil.ReadFile(filepath.Join(dir, "demo/helloworld-deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(deployment) != expectedDeployment {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedDeployment, string(deployment))
+	}
+	service, err := ioutil.ReadFile(filepath.Join(dir, "demo/helloworld-service.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(service, []byte("clusterIP")) {
+		t.Errorf("expected allocated cluster IP to be removed, got:\n%s", string(service))
+	}
+}
+
+func TestExportCommand_Managed(t *testing.T) {
+	out, err := runExport(t, "--managed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != expectedDeployment {
+		t.Errorf("expected only the applied resource, got:\n%s", out)
+	}
+}
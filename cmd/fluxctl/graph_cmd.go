@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
+)
+
+type graphOpts struct {
+	*rootOpts
+	namespace     string
+	allNamespaces bool
+	controller    string
+	pod           string
+	asJSON        bool
+}
+
+func newGraph(parent *rootOpts) *graphOpts {
+	return &graphOpts{rootOpts: parent}
+}
+
+// graphReader is implemented by API clients that can fetch the graph
+// of workloads, which isn't part of api.Server.
+type graphReader interface {
+	Graph(ctx context.Context, namespace string) (v10.Graph, error)
+}
+
+func (opts *graphOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Show where each controller came from: the file in git, or the resource (e.g., FluxHelmRelease) it was created by; and the images it runs.",
+		Example: makeExample(
+			"fluxctl graph",
+			"fluxctl graph --all-namespaces --json",
+			"fluxctl graph --controller=default:deployment/helloworld",
+			"fluxctl graph --pod=helloworld-6c4bd88b5d-x2lq5",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Confine query to namespace")
+	cmd.Flags().BoolVarP(&opts.allNamespaces, "all-namespaces", "a", false, "Query across all namespaces")
+	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Show only this controller")
+	cmd.Flags().StringVar(&opts.pod, "pod", "", "Show only the controller this pod (in --namespace) belongs to")
+	cmd.Flags().BoolVar(&opts.asJSON, "json", false, "Print the graph as JSON")
+	return cmd
+}
+
+func (opts *graphOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	if opts.controller != "" && opts.pod != "" {
+		return newUsageError("please give only one of --controller and --pod")
+	}
+
+	namespace := opts.namespace
+	var controllerID flux.ResourceID
+	switch {
+	case opts.controller != "":
+		var err error
+		if controllerID, err = flux.ParseResourceIDOptionalNamespace(opts.namespace, opts.controller); err != nil {
+			return err
+		}
+		namespace, _, _ = controllerID.Components()
+	case opts.allNamespaces:
+		if opts.pod != "" {
+			return newUsageError("--pod needs the pod's namespace, rather than --all-namespaces")
+		}
+		namespace = ""
+	}
+
+	reader, ok := opts.API.(graphReader)
+	if !ok {
+		return errors.New("the API client cannot fetch the graph of workloads")
+	}
+	graph, err := reader.Graph(context.Background(), namespace)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.controller != "":
+		graph.Workloads = selectWorkloads(graph.Workloads, func(w v10.WorkloadGraph) bool {
+			return w.ID == controllerID
+		})
+		if len(graph.Workloads) == 0 {
+			return fmt.Errorf("controller %s is not running in the cluster", controllerID)
+		}
+	case opts.pod != "":
+		graph.Workloads = podWorkload(graph.Workloads, opts.pod)
+		if len(graph.Workloads) == 0 {
+			return fmt.Errorf("no controller in namespace %q looks to have created pod %q", namespace, opts.pod)
+		}
+	}
+	sort.Slice(graph.Workloads, func(i, j int) bool {
+		return graph.Workloads[i].ID.String() < graph.Workloads[j].ID.String()
+	})
+
+	if opts.asJSON {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(graph)
+	}
+
+	w := newTabwriter()
+	fmt.Fprintf(w, "CONTROLLER\tSOURCE\tCONTAINER\tIMAGE\n")
+	for _, wl := range graph.Workloads {
+		source := graphSource(wl)
+		if len(wl.Containers) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t\t\n", wl.ID, source)
+			continue
+		}
+		c := wl.Containers[0]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", wl.ID, source, c.Name, c.Image)
+		for _, c := range wl.Containers[1:] {
+			fmt.Fprintf(w, "\t\t%s\t%s\n", c.Name, c.Image)
+		}
+	}
+	w.Flush()
+	if graph.Revision != "" {
+		fmt.Fprintf(cmd.OutOrStdout(), "\nFiles are as of revision %s.\n", graph.Revision)
+	}
+	return nil
+}
+
+// graphSource says where a workload came from: the file it's defined
+// in, and the resource it was created by, as far as they are known.
+func graphSource(w v10.WorkloadGraph) string {
+	var sources []string
+	if w.Path != "" {
+		sources = append(sources, fileAndLine(w.Path, w.Line))
+	}
+	if w.Antecedent != (flux.ResourceID{}) {
+		via := "via " + w.Antecedent.String()
+		if w.AntecedentPath != "" {
+			via += " (" + fileAndLine(w.AntecedentPath, w.AntecedentLine) + ")"
+		}
+		sources = append(sources, via)
+	}
+	if len(sources) == 0 {
+		return "(not in git)"
+	}
+	return strings.Join(sources, " ")
+}
+
+func fileAndLine(path string, line int) string {
+	if line > 0 {
+		return fmt.Sprintf("%s:%d", path, line)
+	}
+	return path
+}
+
+func selectWorkloads(workloads []v10.WorkloadGraph, keep func(v10.WorkloadGraph) bool) []v10.WorkloadGraph {
+	var selected []v10.WorkloadGraph
+	for _, w := range workloads {
+		if keep(w) {
+			selected = append(selected, w)
+		}
+	}
+	return selected
+}
+
+// podWorkload picks out the workload that created the pod named, if
+// there looks to be one. Pods are named after the workload that
+// created them, with a suffix: `<name>-<hash>-<id>` for a deployment,
+// `<name>-<n>` for a statefulset, and so on; so it's the workload
+// with the longest name that's a prefix of the pod's.
+func podWorkload(workloads []v10.WorkloadGraph, pod string) []v10.WorkloadGraph {
+	var best *v10.WorkloadGraph
+	var bestName string
+	for i, w := range workloads {
+		_, _, name := w.ID.Components()
+		if strings.HasPrefix(pod, name+"-") && len(name) > len(bestName) {
+			best, bestName = &workloads[i], name
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return []v10.WorkloadGraph{*best}
+}
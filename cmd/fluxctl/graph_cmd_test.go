@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
+	transport "github.com/weaveworks/flux/http"
+)
+
+func TestGraphCommand_Pod(t *testing.T) {
+	graph := v10.Graph{
+		Revision: syncedRevision,
+		Workloads: []v10.WorkloadGraph{
+			{ID: flux.MustParseResourceID("default:deployment/helloworld"), Path: "helloworld-deploy.yaml"},
+			{
+				ID:             flux.MustParseResourceID("default:deployment/helloworld-chart"),
+				Antecedent:     flux.MustParseResourceID("default:fluxhelmrelease/helloworld"),
+				AntecedentPath: "releases/helloworld.yaml",
+			},
+		},
+	}
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("Graph"): graph,
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+	cmd := newGraph(mockServiceOpts(svc)).Command()
+	out := &bytes.Buffer{}
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{"--json", "--namespace=default", "--pod=helloworld-chart-6c4bd88b5d-x2lq5"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ns := svc.calledURL("Graph").Query().Get("namespace"); ns != "default" {
+		t.Errorf("expected the namespace to be passed on, got %q", ns)
+	}
+	var got v10.Graph
+	if err := json.NewDecoder(out).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Workloads) != 1 || got.Workloads[0].AntecedentPath != "releases/helloworld.yaml" {
+		t.Errorf("expected only the workload created by the release, got %+v", got.Workloads)
+	}
+}
+
+func TestGraphSource(t *testing.T) {
+	for _, c := range []struct {
+		workload v10.WorkloadGraph
+		expected string
+	}{
+		{v10.WorkloadGraph{Path: "deploy.yaml", Line: 3}, "deploy.yaml:3"},
+		{v10.WorkloadGraph{Antecedent: flux.MustParseResourceID("default:fluxhelmrelease/app"), AntecedentPath: "app.yaml"}, "via default:fluxhelmrelease/app (app.yaml)"},
+		{v10.WorkloadGraph{}, "(not in git)"},
+	} {
+		if got := graphSource(c.workload); got != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/update"
+)
+
+type helmOpts struct {
+	*rootOpts
+	outputOpts
+
+	namespace string
+	asString  bool
+	cause     update.Cause
+}
+
+func newHelm(parent *rootOpts) *helmOpts {
+	return &helmOpts{rootOpts: parent}
+}
+
+var helmSetLongHelp = strings.TrimSpace(`
+Set values in a FluxHelmRelease, by committing the change to its
+manifest in the git repo. The Helm operator then upgrades the release
+with the new values.
+
+Values are given as key=value, where the key is a dotted path into
+the release's values, e.g., 'image.tag=1.2.3'; escape a dot that's
+part of a key with a backslash, e.g., 'podAnnotations.prometheus\.io/scrape=true'.
+As with 'helm --set', 'true' and 'false' are set as booleans and
+whole numbers as numbers, unless --string is given. Keys that aren't
+in the values yet are added.
+
+The release is named either as name, in the namespace given with
+--namespace, or as namespace:fluxhelmrelease/name.
+`)
+
+func (opts *helmOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "helm",
+		Short: "Make changes to Helm releases (FluxHelmReleases)",
+	}
+
+	set := &cobra.Command{
+		Use:   "set <release> <key=value>...",
+		Short: "Set values in a Helm release, and commit the change",
+		Long:  helmSetLongHelp,
+		Example: makeExample(
+			"fluxctl helm set --namespace=blog ghost image.tag=1.22.0 replicas=3",
+			"fluxctl helm set blog:fluxhelmrelease/ghost ingress.enabled=true -m 'expose the blog'",
+			"fluxctl helm set --string ghost 'podAnnotations.prometheus\\.io/scrape=true'",
+		),
+		RunE: opts.set,
+	}
+	AddOutputFlags(set, &opts.outputOpts)
+	AddCauseFlags(set, &opts.cause)
+	set.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Namespace of the release, if it's given by name alone")
+	set.Flags().BoolVar(&opts.asString, "string", false, "Set all the values as strings")
+
+	cmd.AddCommand(set)
+	return cmd
+}
+
+func (opts *helmOpts) set(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return newUsageError("expected a release, and at least one key=value")
+	}
+	id, err := helmReleaseID(opts.namespace, args[0])
+	if err != nil {
+		return err
+	}
+	values, err := cluster.ParseHelmValues(args[1:], opts.asString)
+	if err != nil {
+		return newUsageError(err.Error())
+	}
+	u := update.HelmValueUpdates{Release: id, Values: values}
+	if err := u.Validate(); err != nil {
+		return newUsageError(err.Error())
+	}
+
+	ctx := context.Background()
+	jobID, err := opts.API.UpdateManifests(ctx, update.Spec{
+		Type:  update.HelmValues,
+		Cause: opts.cause,
+		Spec:  u,
+	})
+	if err != nil {
+		return err
+	}
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, opts.verbosity)
+}
+
+// helmReleaseID interprets a release given either by name, or as a
+// full resource ID.
+func helmReleaseID(namespace, release string) (flux.ResourceID, error) {
+	if !strings.Contains(release, "/") {
+		return flux.MakeResourceID(namespace, "fluxhelmrelease", release), nil
+	}
+	return flux.ParseResourceIDOptionalNamespace(namespace, release)
+}
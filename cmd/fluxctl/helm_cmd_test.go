@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHelmReleaseID(t *testing.T) {
+	for _, c := range []struct {
+		release, expected string
+	}{
+		{"ghost", "blog:fluxhelmrelease/ghost"},
+		{"fluxhelmrelease/ghost", "blog:fluxhelmrelease/ghost"},
+		{"default:FluxHelmRelease/ghost", "default:fluxhelmrelease/ghost"},
+	} {
+		id, err := helmReleaseID("blog", c.release)
+		if err != nil {
+			t.Errorf("%q: %v", c.release, err)
+			continue
+		}
+		if id.String() != c.expected {
+			t.Errorf("%q: expected %s, got %s", c.release, c.expected, id)
+		}
+	}
+}
+
+func TestHelmSet_Usage(t *testing.T) {
+	for _, args := range [][]string{
+		{"ghost"},
+		{"ghost", "noequals"},
+		{"default:deployment/ghost", "replicas=3"},
+	} {
+		cmd := newHelm(mockServiceOpts(&genericMockRoundTripper{})).Command()
+		cmd.SetArgs(append([]string{"set"}, args...))
+		cmd.SilenceUsage, cmd.SilenceErrors = true, true
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
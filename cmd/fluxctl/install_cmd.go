@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/install"
+)
+
+type installOpts struct {
+	install.TemplateParameters
+	outputDir string
+}
+
+func newInstall() *installOpts {
+	return &installOpts{}
+}
+
+func (opts *installOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Print the manifests needed to run flux in a cluster",
+		Example: makeExample(
+			"fluxctl install --git-url=git@github.com:weaveworks/flux-example --namespace=flux | kubectl apply -f -",
+			"fluxctl install --git-url=git@github.com:weaveworks/flux-example --git-path=namespaces --git-path=workloads --output-dir=./flux",
+		),
+		// This doesn't talk to a running fluxd, so needn't set up a
+		// port forward as other commands do.
+		PersistentPreRunE: func(*cobra.Command, []string) error { return nil },
+		RunE:              opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.GitURL, "git-url", "", "URL of the git repo with Kubernetes manifests; e.g., git@github.com:weaveworks/flux-example")
+	cmd.Flags().StringVar(&opts.GitBranch, "git-branch", "master", "branch of the git repo to use for Kubernetes manifests")
+	cmd.Flags().StringSliceVar(&opts.GitPaths, "git-path", nil, "relative paths within the git repo to locate Kubernetes manifests (relative path)")
+	cmd.Flags().StringVar(&opts.GitLabel, "git-label", "", "label to keep track of sync progress")
+	cmd.Flags().StringVar(&opts.GitUser, "git-user", "", "username to use as git committer")
+	cmd.Flags().StringVar(&opts.GitEmail, "git-email", "", "email to use as git committer")
+	cmd.Flags().StringVar(&opts.Namespace, "namespace", "default", "cluster namespace in which to install flux")
+	cmd.Flags().StringVar(&opts.Image, "image", install.DefaultImage, "the fluxd image to run")
+	cmd.Flags().StringArrayVar(&opts.AdditionalFluxArgs, "flux-arg", nil, "an additional argument to give fluxd, e.g., --flux-arg=--sync-interval=1m; may be repeated")
+	cmd.Flags().StringVarP(&opts.outputDir, "output-dir", "o", "", "a directory in which to write a file for each manifest, rather than printing them")
+	return cmd
+}
+
+func (opts *installOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.GitURL == "" {
+		return newUsageError("please supply a git URL with --git-url")
+	}
+
+	manifests, err := install.FillInTemplates(opts.TemplateParameters)
+	if err != nil {
+		return err
+	}
+
+	if opts.outputDir != "" {
+		if info, err := os.Stat(opts.outputDir); err != nil {
+			return err
+		} else if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", opts.outputDir)
+		}
+	}
+
+	for _, name := range install.FileNames(manifests) {
+		if opts.outputDir != "" {
+			if err := ioutil.WriteFile(filepath.Join(opts.outputDir, name), manifests[name], 0644); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := cmd.OutOrStdout().Write(manifests[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Ways of reaching fluxd through Kubernetes, when no URL is given.
+const (
+	connectionPortForward = "port-forward"
+	connectionProxy       = "proxy"
+
+	defaultK8sService = "flux:3030"
+)
+
+// k8sProxy gives the URL of the API of the fluxd behind a service,
+// reached through the Kubernetes API server's proxy, and an HTTP
+// client that presents the credentials from the kubeconfig. The
+// service is given as the API server expects: `[scheme:]name[:port]`,
+// e.g., `flux:3030`, or `https:flux:3030` if fluxd serves TLS.
+func k8sProxy(namespace, service string) (*http.Client, string, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{},
+	).ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("loading kubeconfig: %s", err)
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, "", fmt.Errorf("making transport from kubeconfig: %s", err)
+	}
+	return &http.Client{Transport: transport}, k8sProxyURL(config.Host, namespace, service), nil
+}
+
+func k8sProxyURL(host, namespace, service string) string {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return fmt.Sprintf("%s/api/v1/namespaces/%s/services/%s/proxy/api/flux",
+		strings.TrimSuffix(host, "/"), url.PathEscape(namespace), url.PathEscape(service))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestK8sProxyURL(t *testing.T) {
+	for _, c := range []struct{ host, service, expected string }{
+		{"https://10.0.0.1:6443", "flux:3030", "https://10.0.0.1:6443/api/v1/namespaces/flux/services/flux:3030/proxy/api/flux"},
+		{"https://k8s.example.com/", "https:flux:3030", "https://k8s.example.com/api/v1/namespaces/flux/services/https:flux:3030/proxy/api/flux"},
+		{"10.0.0.1", "flux", "https://10.0.0.1/api/v1/namespaces/flux/services/flux/proxy/api/flux"},
+	} {
+		if got := k8sProxyURL(c.host, "flux", c.service); got != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, got)
+		}
+	}
+}
+
+func TestK8sProxy_Connects(t *testing.T) {
+	var path, auth string
+	// Credentials from a kubeconfig are only used over TLS
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "fluxctl-k8sproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	ioutil.WriteFile(kubeconfig, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+    insecure-skip-tls-verify: true
+users:
+- name: test
+  user:
+    token: kubetoken
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+`, server.URL)), 0600)
+	_, cleanup := withConfigFile(t)
+	defer cleanup()
+	oldKubeconfig := os.Getenv("KUBECONFIG")
+	os.Setenv("KUBECONFIG", kubeconfig)
+	defer os.Setenv("KUBECONFIG", oldKubeconfig)
+
+	if _, err := runFluxctl(t, "--k8s-connection=proxy", "--k8s-fwd-ns=flux", "list-controllers"); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v1/namespaces/flux/services/flux:3030/proxy/api/flux/v6/services" || auth != "Bearer kubetoken" {
+		t.Errorf("expected a request through the proxy with the kubeconfig's token, got %s with %q", path, auth)
+	}
+
+	if _, err := runFluxctl(t, "--k8s-connection=proxy", "--auth-token=secret", "list-controllers"); err == nil {
+		t.Error("expected an error giving an API token with the proxy")
+	}
+	if _, err := runFluxctl(t, "--k8s-connection=tunnel", "list-controllers"); err == nil {
+		t.Error("expected an error for an unknown connection")
+	}
+}
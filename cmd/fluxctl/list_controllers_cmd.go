@@ -2,20 +2,35 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v6"
+	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/remote"
 )
 
 type controllerListOpts struct {
 	*rootOpts
 	namespace     string
 	allNamespaces bool
+	rollout       bool
+	selector      string
+	onlyAutomated bool
+	onlyLocked    bool
+	outOfDate     bool
+}
+
+// serviceFilterer is implemented by API clients that can ask for only
+// some workloads to be listed, which isn't part of api.Server.
+type serviceFilterer interface {
+	ListServicesWithOptions(ctx context.Context, opts v10.ListServicesOptions) ([]v6.ControllerStatus, error)
 }
 
 func newControllerList(parent *rootOpts) *controllerListOpts {
@@ -24,13 +39,22 @@ func newControllerList(parent *rootOpts) *controllerListOpts {
 
 func (opts *controllerListOpts) Command() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "list-controllers",
-		Short:   "List controllers currently running in the cluster.",
-		Example: makeExample("fluxctl list-controllers"),
-		RunE:    opts.RunE,
+		Use:   "list-controllers",
+		Short: "List controllers currently running in the cluster.",
+		Example: makeExample(
+			"fluxctl list-controllers",
+			"fluxctl list-controllers --rollout",
+			"fluxctl list-controllers --all-namespaces --selector=team=payments --out-of-date",
+		),
+		RunE: opts.RunE,
 	}
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Confine query to namespace")
 	cmd.Flags().BoolVarP(&opts.allNamespaces, "all-namespaces", "a", false, "Query across all namespaces")
+	cmd.Flags().BoolVar(&opts.rollout, "rollout", false, "Show how far each controller has got in rolling out its pods, and why it's stuck, if it is")
+	cmd.Flags().StringVarP(&opts.selector, "selector", "l", "", "Show only controllers with labels matching this selector, e.g., app=web,tier!=db")
+	cmd.Flags().BoolVar(&opts.onlyAutomated, "only-automated", false, "Show only automated controllers")
+	cmd.Flags().BoolVar(&opts.onlyLocked, "only-locked", false, "Show only locked controllers")
+	cmd.Flags().BoolVar(&opts.outOfDate, "out-of-date", false, "Show only controllers with newer images than they are running, that their filters allow")
 	return cmd
 }
 
@@ -45,7 +69,7 @@ func (opts *controllerListOpts) RunE(cmd *cobra.Command, args []string) error {
 
 	ctx := context.Background()
 
-	controllers, err := opts.API.ListServices(ctx, opts.namespace)
+	controllers, err := opts.listControllers(ctx)
 	if err != nil {
 		return err
 	}
@@ -53,22 +77,86 @@ func (opts *controllerListOpts) RunE(cmd *cobra.Command, args []string) error {
 	sort.Sort(controllerStatusByName(controllers))
 
 	w := newTabwriter()
-	fmt.Fprintf(w, "CONTROLLER\tCONTAINER\tIMAGE\tRELEASE\tPOLICY\n")
+	if opts.rollout {
+		fmt.Fprintf(w, "CONTROLLER\tCONTAINER\tIMAGE\tRELEASE\tUPDATED\tREADY\tAVAILABLE\tPOLICY\n")
+	} else {
+		fmt.Fprintf(w, "CONTROLLER\tCONTAINER\tIMAGE\tRELEASE\tPOLICY\n")
+	}
+	// The columns after RELEASE, for the first line of a controller,
+	// and blank for the others
+	extra, blank := func(v6.ControllerStatus) string { return "" }, ""
+	if opts.rollout {
+		extra, blank = rolloutColumns, "\t\t\t"
+	}
 	for _, controller := range controllers {
 		if len(controller.Containers) > 0 {
 			c := controller.Containers[0]
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", controller.ID, c.Name, c.Current.ID, controller.Status, policies(controller))
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s%s\n", controller.ID, c.Name, c.Current.ID, controller.Status, extra(controller), policies(controller))
 			for _, c := range controller.Containers[1:] {
-				fmt.Fprintf(w, "\t%s\t%s\t\t\n", c.Name, c.Current.ID)
+				fmt.Fprintf(w, "\t%s\t%s\t\t%s\n", c.Name, c.Current.ID, blank)
 			}
 		} else {
-			fmt.Fprintf(w, "%s\t\t\t\t\n", controller.ID)
+			fmt.Fprintf(w, "%s\t\t\t\t%s\n", controller.ID, blank)
+		}
+		if lock := lockDetails(controller); lock != "" {
+			fmt.Fprintf(w, "\t\t\t\t%s%s\n", blank, lock)
+		}
+		if opts.rollout {
+			for _, msg := range controller.Rollout.Messages {
+				fmt.Fprintf(w, "\t\t\t%s\n", msg)
+			}
 		}
 	}
 	w.Flush()
 	return nil
 }
 
+// listControllers lists the controllers, filtered as asked. Daemons
+// that can't filter them are asked for all of them, and those that
+// don't match filtered out here, if possible.
+func (opts *controllerListOpts) listControllers(ctx context.Context) ([]v6.ControllerStatus, error) {
+	if opts.selector == "" && !opts.onlyAutomated && !opts.onlyLocked && !opts.outOfDate {
+		return opts.API.ListServices(ctx, opts.namespace)
+	}
+	listOpts := v10.ListServicesOptions{
+		Namespace: opts.namespace,
+		Selector:  opts.selector,
+		Automated: opts.onlyAutomated,
+		Locked:    opts.onlyLocked,
+		OutOfDate: opts.outOfDate,
+	}
+
+	filterer, canFilter := opts.API.(serviceFilterer)
+	served, err := supports(ctx, opts.API, transport.ListServicesWithOptions)
+	if err != nil {
+		return nil, err
+	}
+	if canFilter && served {
+		return filterer.ListServicesWithOptions(ctx, listOpts)
+	}
+	if opts.outOfDate {
+		// Telling which controllers are out of date needs their
+		// images, which only the daemon can compare
+		return nil, remote.UpgradeNeededError(errors.New("--out-of-date needs fluxd to filter the controllers it lists"))
+	}
+	controllers, err := opts.API.ListServices(ctx, opts.namespace)
+	if err != nil {
+		return nil, err
+	}
+	return listOpts.Filter(controllers)
+}
+
+// rolloutColumns gives the number of a controller's pods that are
+// updated, ready and available, out of those wanted, as columns; or
+// dashes for controllers that don't report their rollouts.
+func rolloutColumns(c v6.ControllerStatus) string {
+	r := c.Rollout
+	if r.Desired == 0 && r.Updated == 0 && r.Ready == 0 && r.Available == 0 {
+		return "-\t-\t-\t"
+	}
+	return fmt.Sprintf("%d/%d\t%d/%d\t%d/%d\t", r.Updated, r.Desired, r.Ready, r.Desired, r.Available, r.Desired)
+}
+
 type controllerStatusByName []v6.ControllerStatus
 
 func (s controllerStatusByName) Len() int {
@@ -97,3 +185,25 @@ func policies(s v6.ControllerStatus) string {
 	sort.Strings(ps)
 	return strings.Join(ps, ",")
 }
+
+// lockDetails describes who locked a controller, until when, and why,
+// as far as they were recorded.
+func lockDetails(s v6.ControllerStatus) string {
+	if !s.Locked {
+		return ""
+	}
+	var details []string
+	if user := s.Policies[string(policy.LockedUser)]; user != "" {
+		details = append(details, "by "+user)
+	}
+	if until := s.Policies[string(policy.LockedUntil)]; until != "" {
+		details = append(details, "until "+until)
+	}
+	if msg := s.Policies[string(policy.LockedMsg)]; msg != "" {
+		details = append(details, fmt.Sprintf("%q", msg))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return "(locked " + strings.Join(details, ", ") + ")"
+}
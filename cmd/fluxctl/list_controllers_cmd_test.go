@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v6"
+	transport "github.com/weaveworks/flux/http"
+)
+
+func TestRolloutColumns(t *testing.T) {
+	for _, c := range []struct {
+		rollout  v6.RolloutStatus
+		expected string
+	}{
+		{v6.RolloutStatus{}, "-\t-\t-\t"},
+		{v6.RolloutStatus{Desired: 3, Updated: 2, Ready: 1, Available: 0}, "2/3\t1/3\t0/3\t"},
+	} {
+		if got := rolloutColumns(v6.ControllerStatus{Rollout: c.rollout}); got != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, got)
+		}
+	}
+}
+
+func TestListControllersCommand_Filters(t *testing.T) {
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("Versions"): transport.APIVersions{
+				Endpoints: []string{transport.ListServices, transport.ListServicesWithOptions},
+			},
+			transport.NewAPIRouter().Get("ListServicesWithOptions"): []v6.ControllerStatus{},
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+	cmd := newControllerList(mockServiceOpts(svc)).Command()
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--all-namespaces", "-l", "team=a", "--only-locked", "--out-of-date"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	query := svc.calledURL("ListServicesWithOptions").Query()
+	for param, expected := range map[string]string{
+		"namespace": "",
+		"selector":  "team=a",
+		"automated": "false",
+		"locked":    "true",
+		"outOfDate": "true",
+	} {
+		if got := query.Get(param); got != expected {
+			t.Errorf("expected %s=%q, got %q", param, expected, got)
+		}
+	}
+}
+
+// A daemon that doesn't say what it serves is asked for all the
+// controllers, which are filtered by fluxctl.
+func TestListControllers_OldDaemon(t *testing.T) {
+	a, b := flux.MustParseResourceID("default:deployment/a"), flux.MustParseResourceID("default:deployment/b")
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("ListServices"): []v6.ControllerStatus{
+				{ID: a, Labels: map[string]string{"team": "a"}},
+				{ID: b, Labels: map[string]string{"team": "b"}},
+			},
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+	opts := newControllerList(mockServiceOpts(svc))
+	opts.selector = "team=a"
+	controllers, err := opts.listControllers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(controllers) != 1 || controllers[0].ID != a {
+		t.Errorf("expected only %s, got %+v", a, controllers)
+	}
+
+	opts = newControllerList(mockServiceOpts(svc))
+	opts.outOfDate = true
+	if _, err := opts.listControllers(context.Background()); err == nil {
+		t.Error("expected an error for --out-of-date, which an old daemon can't do")
+	}
+}
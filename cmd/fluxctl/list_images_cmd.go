@@ -10,6 +10,8 @@ import (
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/update"
 )
@@ -19,6 +21,10 @@ type controllerShowOpts struct {
 	namespace  string
 	controller string
 	limit      int
+	digests    bool
+	filter     string
+	newer      bool
+	container  string
 
 	// Deprecated
 	service string
@@ -30,14 +36,22 @@ func newControllerShow(parent *rootOpts) *controllerShowOpts {
 
 func (opts *controllerShowOpts) Command() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "list-images",
-		Short:   "Show the deployed and available images for a controller.",
-		Example: makeExample("fluxctl list-images --namespace default --controller=deployment/foo"),
-		RunE:    opts.RunE,
+		Use:   "list-images",
+		Short: "Show the deployed and available images for a controller.",
+		Example: makeExample(
+			"fluxctl list-images --namespace default --controller=deployment/foo",
+			"fluxctl list-images --controller=deployment/foo --digests",
+			"fluxctl list-images --controller=deployment/foo --container=bar --filter='semver:~1.2' --newer",
+		),
+		RunE: opts.RunE,
 	}
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
 	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Show images for this controller")
 	cmd.Flags().IntVarP(&opts.limit, "limit", "l", 10, "Number of images to show (0 for all)")
+	cmd.Flags().BoolVar(&opts.digests, "digests", false, "Show the digest of each image")
+	cmd.Flags().StringVar(&opts.filter, "filter", "", "Show only the images with tags matching this pattern, e.g., 'master-*', 'semver:~1.2' or 'regexp:^v\\d+$'")
+	cmd.Flags().BoolVar(&opts.newer, "newer", false, "Show only the images newer than the one running (and the one running)")
+	cmd.Flags().StringVar(&opts.container, "container", "", "Show images for this container only")
 
 	// Deprecated
 	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Show images for this service")
@@ -53,6 +67,13 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 	if len(args) != 0 {
 		return errorWantedNoArgs
 	}
+	var filter policy.Pattern
+	if opts.filter != "" {
+		filter = policy.NewPattern(opts.filter)
+		if !filter.Valid() {
+			return newUsageError(fmt.Sprintf("invalid tag pattern: %q", opts.filter))
+		}
+	}
 
 	var resourceSpec update.ResourceSpec
 	if len(opts.controller) == 0 {
@@ -76,18 +97,27 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 
 	out := newTabwriter()
 
-	fmt.Fprintln(out, "CONTROLLER\tCONTAINER\tIMAGE\tCREATED")
+	if opts.digests {
+		fmt.Fprintln(out, "CONTROLLER\tCONTAINER\tIMAGE\tCREATED\tDIGEST")
+	} else {
+		fmt.Fprintln(out, "CONTROLLER\tCONTAINER\tIMAGE\tCREATED")
+	}
 	for _, controller := range controllers {
 		if len(controller.Containers) == 0 {
-			fmt.Fprintf(out, "%s\t\t\t\n", controller.ID)
+			if opts.container == "" {
+				fmt.Fprintf(out, "%s\t\t\t\n", controller.ID)
+			}
 			continue
 		}
 
 		controllerName := controller.ID.String()
 		for _, container := range controller.Containers {
+			if opts.container != "" && container.Name != opts.container {
+				continue
+			}
 			var lineCount int
 			containerName := container.Name
-			reg, repo, currentTag := container.Current.ID.Components()
+			reg, repo, _ := container.Current.ID.Components()
 			if reg != "" {
 				reg += "/"
 			}
@@ -97,14 +127,16 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 					availableErr = registry.ErrNoImageData.Error()
 				}
 				fmt.Fprintf(out, "%s\t%s\t%s%s\t%s\n", controllerName, containerName, reg, repo, availableErr)
+			} else if container.AvailableStale {
+				fmt.Fprintf(out, "%s\t%s\t%s%s\t%s\n", controllerName, containerName, reg, repo, container.AvailableError)
 			} else {
 				fmt.Fprintf(out, "%s\t%s\t%s%s\t\n", controllerName, containerName, reg, repo)
 			}
 			foundRunning := false
-			for _, available := range container.Available {
+			for _, available := range availableImages(container, filter, opts.newer) {
 				running := "|  "
 				_, _, tag := available.ID.Components()
-				if currentTag == tag {
+				if isRunning(container, available) {
 					running = "'->"
 					foundRunning = true
 				} else if foundRunning {
@@ -115,7 +147,7 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 				var printEllipsis, printLine bool
 				if opts.limit <= 0 || lineCount <= opts.limit {
 					printEllipsis, printLine = false, true
-				} else if container.Current.ID == available.ID {
+				} else if container.Current.ID.WithDigest("") == available.ID {
 					printEllipsis, printLine = lineCount > (opts.limit+1), true
 				}
 				if printEllipsis {
@@ -126,7 +158,11 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 					if !available.CreatedAt.IsZero() {
 						createdAt = available.CreatedAt.Format(time.RFC822)
 					}
-					fmt.Fprintf(out, "\t\t%s %s\t%s\n", running, tag, createdAt)
+					if opts.digests {
+						fmt.Fprintf(out, "\t\t%s %s\t%s\t%s\n", running, tag, createdAt, available.Digest)
+					} else {
+						fmt.Fprintf(out, "\t\t%s %s\t%s\n", running, tag, createdAt)
+					}
 				}
 			}
 			controllerName = ""
@@ -136,6 +172,45 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// isRunning reports whether the image is the one the container is
+// running. A container pinned to a digest is running the image with
+// that digest, whatever its tag now refers to.
+func isRunning(container v6.Container, img image.Info) bool {
+	current := container.Current.ID
+	return current.Tag == img.ID.Tag && (current.Digest == "" || current.Digest == img.Digest)
+}
+
+// availableImages returns the images available for the container
+// that match the filter, if there is one, in the order given. If
+// newerOnly is true, only those newer than the image running are
+// returned, followed by the image running.
+func availableImages(container v6.Container, filter policy.Pattern, newerOnly bool) update.SortedImageInfos {
+	images := container.Available
+	if filter != nil {
+		images = update.SortedImageInfos(update.ImageInfos(images).Filter(filter))
+	}
+	if !newerOnly {
+		return images
+	}
+	for i, img := range images {
+		if isRunning(container, img) {
+			return images[:i+1]
+		}
+	}
+	// The image running isn't among them, so go by when the images
+	// were built, if that's known.
+	if container.Current.CreatedAt.IsZero() {
+		return images
+	}
+	var newer update.SortedImageInfos
+	for _, img := range images {
+		if img.CreatedAt.After(container.Current.CreatedAt) {
+			newer = append(newer, img)
+		}
+	}
+	return newer
+}
+
 type imageStatusByName []v6.ImageStatus
 
 func (s imageStatusByName) Len() int {
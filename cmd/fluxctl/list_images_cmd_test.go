@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+)
+
+func TestAvailableImages(t *testing.T) {
+	name, _ := image.ParseRef("quay.io/weaveworks/helloworld")
+	now := time.Now()
+	info := func(tag string, age time.Duration) image.Info {
+		return image.Info{ID: name.Name.ToRef(tag), CreatedAt: now.Add(-age)}
+	}
+	available := []image.Info{
+		info("1.3.0", 0),
+		info("master-abc", time.Minute),
+		info("1.2.1", time.Hour),
+		info("1.2.0", 2*time.Hour),
+		info("latest", 3*time.Hour),
+	}
+	container := v6.Container{
+		Name:      "helloworld",
+		Current:   info("1.2.0", 2*time.Hour),
+		Available: available,
+	}
+	tags := func(images []image.Info) []string {
+		var ts []string
+		for _, img := range images {
+			ts = append(ts, img.ID.Tag)
+		}
+		return ts
+	}
+
+	assert.Equal(t, tags(available), tags(availableImages(container, nil, false)))
+	assert.Equal(t, []string{"1.3.0", "1.2.1", "1.2.0"}, tags(availableImages(container, policy.NewPattern("semver:*"), false)))
+	assert.Equal(t, []string{"1.3.0", "master-abc", "1.2.1", "1.2.0"}, tags(availableImages(container, nil, true)))
+	assert.Equal(t, []string{"1.2.1", "1.2.0"}, tags(availableImages(container, policy.NewPattern("semver:~1.2"), true)))
+
+	// If the running image is filtered out, images built after it
+	// are newer
+	assert.Equal(t, []string{"master-abc"}, tags(availableImages(container, policy.NewPattern("master-*"), true)))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+type listPendingOpts struct {
+	*rootOpts
+}
+
+func newListPending(parent *rootOpts) *listPendingOpts {
+	return &listPendingOpts{rootOpts: parent}
+}
+
+// pendingReleaser is implemented by API clients that can fetch and
+// approve pending releases, which aren't part of api.Server.
+type pendingReleaser interface {
+	PendingReleases(ctx context.Context) ([]v10.PendingRelease, error)
+	ApproveRelease(ctx context.Context, id string, cause update.Cause) (job.ID, error)
+}
+
+func (opts *listPendingOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list-pending",
+		Short: "List the automated releases waiting to be approved.",
+		Example: makeExample(
+			"fluxctl list-pending",
+		),
+		RunE: opts.RunE,
+	}
+	return cmd
+}
+
+func (opts *listPendingOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	releaser, ok := opts.API.(pendingReleaser)
+	if !ok {
+		return errors.New("the API client cannot fetch pending releases")
+	}
+	releases, err := releaser.PendingReleases(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(releases) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "No releases are waiting to be approved.")
+		return nil
+	}
+
+	w := newTabwriter()
+	fmt.Fprintf(w, "ID\tCONTROLLER\tCONTAINER\tCURRENT\tTARGET\tWAITING\n")
+	now := time.Now()
+	for _, r := range releases {
+		for i, c := range r.Changes {
+			if i == 0 {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.Workload, c.Container, c.Current, c.Target, now.Sub(r.StagedAt).Round(time.Second))
+				continue
+			}
+			fmt.Fprintf(w, "\t\t%s\t%s\t%s\t\n", c.Container, c.Current, c.Target)
+		}
+	}
+	return w.Flush()
+}
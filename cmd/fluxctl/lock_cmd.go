@@ -8,8 +8,11 @@ import (
 
 type controllerLockOpts struct {
 	*rootOpts
-	namespace  string
-	controller string
+	namespace   string
+	controllers []string
+	selector    string
+	all         bool
+	until       string
 	outputOpts
 	cause update.Cause
 
@@ -27,13 +30,17 @@ func (opts *controllerLockOpts) Command() *cobra.Command {
 		Short: "Lock a controller, so it cannot be deployed.",
 		Example: makeExample(
 			"fluxctl lock --controller=default:deployment/helloworld",
+			"fluxctl lock --controller=default:deployment/helloworld --until=2h -m 'investigating memory leak'",
 		),
 		RunE: opts.RunE,
 	}
 	AddOutputFlags(cmd, &opts.outputOpts)
 	AddCauseFlags(cmd, &opts.cause)
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
-	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Controller to lock")
+	cmd.Flags().StringSliceVarP(&opts.controllers, "controller", "c", nil, "Controller to lock, or a pattern matching controllers; give more than once for several")
+	cmd.Flags().StringVarP(&opts.selector, "selector", "l", "", "Lock the controllers with labels matching this selector")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Lock all the controllers in the namespace")
+	cmd.Flags().StringVar(&opts.until, "until", "", "When the lock expires, as a duration from now (e.g., '2h') or an RFC3339 timestamp; the controller is unlocked automatically after then")
 
 	// Deprecated
 	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Service to lock")
@@ -48,12 +55,15 @@ func (opts *controllerLockOpts) RunE(cmd *cobra.Command, args []string) error {
 	}
 
 	policyOpts := &controllerPolicyOpts{
-		rootOpts:   opts.rootOpts,
-		outputOpts: opts.outputOpts,
-		namespace:  opts.namespace,
-		controller: opts.controller,
-		cause:      opts.cause,
-		lock:       true,
+		rootOpts:    opts.rootOpts,
+		outputOpts:  opts.outputOpts,
+		namespace:   opts.namespace,
+		controllers: opts.controllers,
+		selector:    opts.selector,
+		all:         opts.all,
+		cause:       opts.cause,
+		lock:        true,
+		lockUntil:   opts.until,
 	}
 	return policyOpts.RunE(cmd, args)
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+
+	"github.com/weaveworks/flux/api"
+)
+
+// apiNegotiator is implemented by API clients that can find out which
+// endpoints the daemon serves, which isn't part of api.Server.
+type apiNegotiator interface {
+	Supports(ctx context.Context, endpoint string) (bool, error)
+}
+
+// supports reports whether the daemon serves the endpoint named (as
+// in the http package), so that commands can fall back to what older
+// daemons serve. An API client that can't tell is taken to be talking
+// to a daemon that serves everything; if it doesn't, the request
+// fails as it otherwise would.
+func supports(ctx context.Context, client api.Server, endpoint string) (bool, error) {
+	negotiator, ok := client.(apiNegotiator)
+	if !ok {
+		return true, nil
+	}
+	return negotiator.Supports(ctx, endpoint)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/weaveworks/flux"
@@ -15,13 +16,21 @@ type controllerPolicyOpts struct {
 	*rootOpts
 	outputOpts
 
-	namespace  string
-	controller string
-	tagAll     string
-	tags       []string
+	namespace   string
+	controllers []string
+	selector    string
+	all         bool
+	tagAll      string
+	tags        []string
+	tagSort     string
 
-	automate, deautomate bool
-	lock, unlock         bool
+	automate, deautomate   bool
+	lock, unlock           bool
+	lockUntil              string
+	pinDigest, unpinDigest bool
+
+	ignoreContainers, unignoreContainers []string
+	pinTags, unpinTags                   []string
 
 	cause update.Cause
 
@@ -43,15 +52,42 @@ Manage policies for a controller.
 Tag filter patterns must be specified as 'container=pattern', such as 'foo=1.*'
 where an asterisk means 'match anything'.
 Surrounding these with single-quotes are recommended to avoid shell expansion.
+Patterns are globs by default; prefix them with 'semver:' to give a
+semantic version range, e.g., 'foo=semver:~1.2', or with 'regexp:' (or
+'regex:') to give a regular expression, e.g., 'foo=regexp:^v\d+$'.
+
+A container can be pinned to a tag with --pin-tag, given as
+'container=tag'. Automated updates, and releases of all images, then
+leave it at that tag until it's unpinned with --unpin-tag. Unlike
+--lock, pinning doesn't stop the container being released to a
+particular image (with 'fluxctl release --update-image'); the pin
+moves to the tag released.
 
 If both --tag-all and --tag are specified, --tag-all will apply to all
 containers which aren't explicitly named.
+
+To change the policies of several controllers in one commit, give
+--controller more than once, use a pattern like 'default:deployment/*',
+select controllers by their labels with --selector, or give --all for
+every controller in the namespace. Patterns use
+'*' to match any characters other than '/', and '?' to match a single
+character. Only controllers running in the cluster and defined in the
+repo are selected.
         `,
 		Example: makeExample(
 			"fluxctl policy --controller=default:deployment/foo --automate",
 			"fluxctl policy --controller=default:deployment/foo --lock",
+			"fluxctl policy --controller=default:deployment/foo --lock --lock-until=2h -m 'investigating memory leak'",
 			"fluxctl policy --controller=default:deployment/foo --tag='bar=1.*' --tag='baz=2.*'",
 			"fluxctl policy --controller=default:deployment/foo --tag-all='master-*' --tag='bar=1.*'",
+			"fluxctl policy --controller=default:deployment/foo --tag-sort=semver",
+			"fluxctl policy --controller=default:deployment/foo --pin-digest",
+			"fluxctl policy --controller=default:deployment/foo --ignore-container=istio-proxy",
+			"fluxctl policy --controller=default:deployment/foo --pin-tag=bar=1.2.3",
+			"fluxctl policy --controller=default:deployment/foo --tag-sort='timestamp:^master-[0-9a-f]+-(\\d+)$'",
+			"fluxctl policy --controller='default:deployment/*' --automate",
+			"fluxctl policy --selector='team=payments' --lock",
+			"fluxctl policy --namespace=payments --all --automate",
 		),
 		RunE: opts.RunE,
 	}
@@ -60,13 +96,23 @@ containers which aren't explicitly named.
 	AddCauseFlags(cmd, &opts.cause)
 	flags := cmd.Flags()
 	flags.StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
-	flags.StringVarP(&opts.controller, "controller", "c", "", "Controller to modify")
+	flags.StringSliceVarP(&opts.controllers, "controller", "c", nil, "Controller to modify, or a pattern matching controllers; give more than once to modify several")
+	flags.StringVarP(&opts.selector, "selector", "l", "", "Modify the controllers with labels matching this selector, e.g., 'team=payments'")
+	flags.BoolVar(&opts.all, "all", false, "Modify all the controllers in the namespace")
 	flags.StringVar(&opts.tagAll, "tag-all", "", "Tag filter pattern to apply to all containers")
 	flags.StringSliceVar(&opts.tags, "tag", nil, "Tag filter container/pattern pairs")
+	flags.StringVar(&opts.tagSort, "tag-sort", "", fmt.Sprintf("How to order images when choosing the newest: %q (when they were built), %q (by the semantic versions in their tags), or %q (by the timestamps in their tags, matched by the regular expression)", policy.SortByCreated, policy.SortBySemver, policy.SortByTimestamp+":<regexp>"))
 	flags.BoolVar(&opts.automate, "automate", false, "Automate controller")
 	flags.BoolVar(&opts.deautomate, "deautomate", false, "Deautomate controller")
 	flags.BoolVar(&opts.lock, "lock", false, "Lock controller")
 	flags.BoolVar(&opts.unlock, "unlock", false, "Unlock controller")
+	flags.StringVar(&opts.lockUntil, "lock-until", "", "When the lock expires, as a duration from now (e.g., '2h') or an RFC3339 timestamp; the controller is unlocked automatically after then")
+	flags.BoolVar(&opts.pinDigest, "pin-digest", false, "Refer to images by their digests, as well as their tags, when updating the controller")
+	flags.BoolVar(&opts.unpinDigest, "unpin-digest", false, "Refer to images by their tags alone when updating the controller")
+	flags.StringSliceVar(&opts.ignoreContainers, "ignore-container", nil, "Leave this container out of image listings, automated updates and releases, e.g., a sidecar injected by a service mesh")
+	flags.StringSliceVar(&opts.unignoreContainers, "unignore-container", nil, "Stop leaving this container out of image listings, automated updates and releases")
+	flags.StringSliceVar(&opts.pinTags, "pin-tag", nil, "Pin a container to a tag, given as container=tag, so automated updates and releases of all images leave it there")
+	flags.StringSliceVar(&opts.unpinTags, "unpin-tag", nil, "Unpin this container from the tag it's pinned to")
 
 	// Deprecated
 	flags.StringVarP(&opts.service, "service", "s", "", "Service to modify")
@@ -82,8 +128,15 @@ func (opts *controllerPolicyOpts) RunE(cmd *cobra.Command, args []string) error
 	if len(args) > 0 {
 		return errorWantedNoArgs
 	}
-	if opts.controller == "" {
-		return newUsageError("-c, --controller is required")
+	if opts.all {
+		if len(opts.controllers) > 0 {
+			return newUsageError("--all and --controller both given")
+		}
+		// A pattern matching every kind and name in the namespace
+		opts.controllers = []string{"*/*"}
+	}
+	if len(opts.controllers) == 0 && opts.selector == "" {
+		return newUsageError("-c, --controller, -l, --selector or --all is required")
 	}
 	if opts.automate && opts.deautomate {
 		return newUsageError("automate and deautomate both specified")
@@ -91,10 +144,11 @@ func (opts *controllerPolicyOpts) RunE(cmd *cobra.Command, args []string) error
 	if opts.lock && opts.unlock {
 		return newUsageError("lock and unlock both specified")
 	}
-
-	resourceID, err := flux.ParseResourceIDOptionalNamespace(opts.namespace, opts.controller)
-	if err != nil {
-		return err
+	if opts.pinDigest && opts.unpinDigest {
+		return newUsageError("pin-digest and unpin-digest both specified")
+	}
+	if opts.lockUntil != "" && !opts.lock {
+		return newUsageError("lock-until given without lock")
 	}
 
 	changes, err := calculatePolicyChanges(opts)
@@ -102,21 +156,80 @@ func (opts *controllerPolicyOpts) RunE(cmd *cobra.Command, args []string) error
 		return err
 	}
 
+	// A single controller is named in a plain policy update, which
+	// daemons from before selectors were introduced understand
+	spec := update.Spec{Type: update.Policy, Cause: opts.cause}
+	if len(opts.controllers) == 1 && opts.selector == "" && !isPattern(opts.controllers[0]) {
+		resourceID, err := flux.ParseResourceIDOptionalNamespace(opts.namespace, opts.controllers[0])
+		if err != nil {
+			return err
+		}
+		spec.Spec = policy.Updates{
+			resourceID: changes,
+		}
+	} else {
+		selector := update.PolicySelector{
+			LabelSelector: opts.selector,
+			Update:        changes,
+		}
+		for _, c := range opts.controllers {
+			selector.Workloads = append(selector.Workloads, controllerPattern(opts.namespace, c))
+		}
+		if err := selector.Validate(); err != nil {
+			return newUsageError(err.Error())
+		}
+		spec.Type = update.Policies
+		spec.Spec = selector
+	}
+
 	ctx := context.Background()
-	updates := policy.Updates{
-		resourceID: changes,
-	}
-	jobID, err := opts.API.UpdateManifests(ctx, update.Spec{
-		Type:  update.Policy,
-		Cause: opts.cause,
-		Spec:  updates,
-	})
+	jobID, err := opts.API.UpdateManifests(ctx, spec)
 	if err != nil {
 		return err
 	}
 	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, opts.verbosity)
 }
 
+// lockExpiry interprets the expiry given for a lock, either as a
+// duration from now, or as an RFC3339 timestamp.
+func lockExpiry(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("lock expiry %q is not in the future", s)
+		}
+		return now.Add(d).UTC().Truncate(time.Second), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid lock expiry %q; expected a duration (e.g., 2h) or an RFC3339 timestamp", s)
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("lock expiry %q is not in the future", s)
+	}
+	return t, nil
+}
+
+// isPattern reports whether the controller given is a pattern, rather
+// than an ID.
+func isPattern(controller string) bool {
+	return strings.ContainsAny(controller, "*?[")
+}
+
+// controllerPattern qualifies a pattern for controller IDs with the
+// namespace, if it doesn't have one, and lower-cases the kind, as it
+// is in IDs.
+func controllerPattern(namespace, pattern string) string {
+	colon, slash := strings.Index(pattern, ":"), strings.Index(pattern, "/")
+	if colon < 0 || (slash >= 0 && slash < colon) {
+		pattern = namespace + ":" + pattern
+		colon, slash = len(namespace), slash+len(namespace)+1
+	}
+	if slash < 0 {
+		return pattern
+	}
+	return pattern[:colon] + strings.ToLower(pattern[colon:slash]) + pattern[slash:]
+}
+
 func calculatePolicyChanges(opts *controllerPolicyOpts) (policy.Update, error) {
 	add := policy.Set{}
 	if opts.automate {
@@ -129,6 +242,17 @@ func calculatePolicyChanges(opts *controllerPolicyOpts) (policy.Update, error) {
 				Set(policy.LockedUser, opts.cause.User).
 				Set(policy.LockedMsg, opts.cause.Message)
 		}
+		if opts.lockUntil != "" {
+			until, err := lockExpiry(opts.lockUntil, time.Now())
+			if err != nil {
+				return policy.Update{}, err
+			}
+			add = add.Set(policy.LockedUntil, until.Format(time.RFC3339))
+		}
+	}
+
+	if opts.pinDigest {
+		add = add.Add(policy.PinDigest)
 	}
 
 	remove := policy.Set{}
@@ -139,21 +263,66 @@ func calculatePolicyChanges(opts *controllerPolicyOpts) (policy.Update, error) {
 		remove = remove.
 			Add(policy.Locked).
 			Add(policy.LockedMsg).
-			Add(policy.LockedUser)
+			Add(policy.LockedUser).
+			Add(policy.LockedUntil)
+	}
+	if opts.unpinDigest {
+		remove = remove.Add(policy.PinDigest)
+	}
+	for _, container := range opts.ignoreContainers {
+		add = add.Add(policy.IgnoreContainerPrefix(container))
+	}
+	for _, container := range opts.unignoreContainers {
+		remove = remove.Add(policy.IgnoreContainerPrefix(container))
+	}
+	for _, pin := range opts.pinTags {
+		parts := strings.SplitN(pin, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return policy.Update{}, fmt.Errorf("invalid container/tag pair to pin: %q. Expected format is 'container=tag'", pin)
+		}
+		container, tag := parts[0], parts[1]
+		if !policy.ValidPinnedTag(tag) {
+			return policy.Update{}, fmt.Errorf("invalid tag to pin container %q to: %q", container, tag)
+		}
+		add = add.Set(policy.TagPinPrefix(container), tag)
+	}
+	for _, container := range opts.unpinTags {
+		remove = remove.Add(policy.TagPinPrefix(container))
 	}
 	if opts.tagAll != "" {
-		add = add.Set(policy.TagAll, policy.NewPattern(opts.tagAll).String())
+		pattern := policy.NewPattern(opts.tagAll)
+		if !pattern.Valid() {
+			return policy.Update{}, fmt.Errorf("invalid tag pattern: %q", opts.tagAll)
+		}
+		add = add.Set(policy.TagAll, pattern.String())
+	}
+
+	switch {
+	case opts.tagSort == "":
+	case opts.tagSort == policy.SortByCreated:
+		// This is the default, so there's no need to record it
+		remove = remove.Add(policy.TagSort)
+	case policy.ValidTagSort(opts.tagSort):
+		add = add.Set(policy.TagSort, opts.tagSort)
+	default:
+		return policy.Update{}, fmt.Errorf("invalid tag ordering: %q; expected %q, %q, or %q", opts.tagSort, policy.SortByCreated, policy.SortBySemver, policy.SortByTimestamp+":<regexp>")
 	}
 
 	for _, tagPair := range opts.tags {
-		parts := strings.Split(tagPair, "=")
+		// Only the first '=' separates the container; regular
+		// expressions may well include others
+		parts := strings.SplitN(tagPair, "=", 2)
 		if len(parts) != 2 {
 			return policy.Update{}, fmt.Errorf("invalid container/tag pair: %q. Expected format is 'container=filter'", tagPair)
 		}
 
 		container, tag := parts[0], parts[1]
 		if tag != "*" {
-			add = add.Set(policy.TagPrefix(container), policy.NewPattern(tag).String())
+			pattern := policy.NewPattern(tag)
+			if !pattern.Valid() {
+				return policy.Update{}, fmt.Errorf("invalid tag pattern for container %q: %q", container, tag)
+			}
+			add = add.Set(policy.TagPrefix(container), pattern.String())
 		} else {
 			remove = remove.Add(policy.TagPrefix(container))
 		}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux/policy"
+	fluxupdate "github.com/weaveworks/flux/update"
+)
+
+func TestControllerPattern(t *testing.T) {
+	for _, c := range []struct {
+		pattern, expected string
+	}{
+		{"deployment/*", "default:deployment/*"},
+		{"Deployment/front*", "default:deployment/front*"},
+		{"prod:StatefulSet/*", "prod:statefulset/*"},
+		{"*:*/frontend", "*:*/frontend"},
+		{"deployment/name:with-colon", "default:deployment/name:with-colon"},
+	} {
+		if got := controllerPattern("default", c.pattern); got != c.expected {
+			t.Errorf("%q: expected %q, got %q", c.pattern, c.expected, got)
+		}
+	}
+}
+
+func TestCalculatePolicyChanges_TagPatterns(t *testing.T) {
+	update, err := calculatePolicyChanges(&controllerPolicyOpts{
+		tagAll: "glob:master-*",
+		tags:   []string{`app=regex:^v\d+(-rc=\d+)?$`, "sidecar=semver:~1.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pol, expected := range map[policy.Policy]string{
+		policy.TagAll:               "glob:master-*",
+		policy.TagPrefix("app"):     `regexp:^v\d+(-rc=\d+)?$`,
+		policy.TagPrefix("sidecar"): "semver:~1.2",
+	} {
+		if got, _ := update.Add.Get(pol); got != expected {
+			t.Errorf("%s: expected %q, got %q", pol, expected, got)
+		}
+	}
+
+	for _, tag := range []string{"app=regexp:^v(", "app=semver:not a range"} {
+		if _, err := calculatePolicyChanges(&controllerPolicyOpts{tags: []string{tag}}); err == nil {
+			t.Errorf("%s: expected an error for an invalid pattern", tag)
+		}
+	}
+}
+
+func TestCalculatePolicyChanges_TagSort(t *testing.T) {
+	update, err := calculatePolicyChanges(&controllerPolicyOpts{tagSort: policy.SortBySemver})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sort, _ := update.Add.Get(policy.TagSort); sort != policy.SortBySemver {
+		t.Errorf("expected %s to be set to %q, got %q", policy.TagSort, policy.SortBySemver, sort)
+	}
+
+	update, err = calculatePolicyChanges(&controllerPolicyOpts{tagSort: policy.SortByCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !update.Remove.Has(policy.TagSort) {
+		t.Errorf("expected %s to be removed, got %+v", policy.TagSort, update)
+	}
+
+	if _, err := calculatePolicyChanges(&controllerPolicyOpts{tagSort: "alphabetical"}); err == nil {
+		t.Error("expected an error for an unknown ordering")
+	}
+}
+
+func TestCalculatePolicyChanges_LockUntil(t *testing.T) {
+	update, err := calculatePolicyChanges(&controllerPolicyOpts{
+		lock:      true,
+		lockUntil: "2099-01-01T00:00:00Z",
+		cause:     fluxupdate.Cause{User: "alice", Message: "investigating"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pol, expected := range map[policy.Policy]string{
+		policy.Locked:      "true",
+		policy.LockedUser:  "alice",
+		policy.LockedMsg:   "investigating",
+		policy.LockedUntil: "2099-01-01T00:00:00Z",
+	} {
+		if got, _ := update.Add.Get(pol); got != expected {
+			t.Errorf("%s: expected %q, got %q", pol, expected, got)
+		}
+	}
+
+	update, err = calculatePolicyChanges(&controllerPolicyOpts{unlock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !update.Remove.Has(policy.LockedUntil) {
+		t.Errorf("expected %s to be removed on unlock, got %+v", policy.LockedUntil, update)
+	}
+}
+
+func TestCalculatePolicyChanges_IgnoreContainer(t *testing.T) {
+	update, err := calculatePolicyChanges(&controllerPolicyOpts{
+		ignoreContainers:   []string{"istio-proxy"},
+		unignoreContainers: []string{"app"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := update.Add.Get(policy.IgnoreContainerPrefix("istio-proxy")); got != "true" {
+		t.Errorf("expected istio-proxy to be ignored, got %+v", update)
+	}
+	if _, ok := update.Remove.Get(policy.IgnoreContainerPrefix("app")); !ok {
+		t.Errorf("expected app to be no longer ignored, got %+v", update)
+	}
+}
+
+func TestCalculatePolicyChanges_PinTag(t *testing.T) {
+	update, err := calculatePolicyChanges(&controllerPolicyOpts{
+		pinTags:   []string{"app=1.2.3"},
+		unpinTags: []string{"worker"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := update.Add.Get(policy.TagPinPrefix("app")); got != "1.2.3" {
+		t.Errorf("expected app to be pinned to 1.2.3, got %+v", update)
+	}
+	if _, ok := update.Remove.Get(policy.TagPinPrefix("worker")); !ok {
+		t.Errorf("expected worker to be unpinned, got %+v", update)
+	}
+
+	for _, pin := range []string{"app", "app=", "app=1.*", "=1.2.3"} {
+		if _, err := calculatePolicyChanges(&controllerPolicyOpts{pinTags: []string{pin}}); err == nil {
+			t.Errorf("%s: expected an error", pin)
+		}
+	}
+}
+
+func TestLockExpiry(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	for s, expected := range map[string]time.Time{
+		"2h":                   time.Date(2019, 6, 1, 14, 0, 0, 0, time.UTC),
+		"90m":                  time.Date(2019, 6, 1, 13, 30, 0, 0, time.UTC),
+		"2019-06-02T09:00:00Z": time.Date(2019, 6, 2, 9, 0, 0, 0, time.UTC),
+	} {
+		got, err := lockExpiry(s, now)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if !got.Equal(expected) {
+			t.Errorf("%s: expected %s, got %s", s, expected, got)
+		}
+	}
+	for _, s := range []string{"-1h", "2019-06-01T11:00:00Z", "tomorrow"} {
+		if _, err := lockExpiry(s, now); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestAutomateCommand_All(t *testing.T) {
+	svc := newMockService()
+	cmd := newServiceAutomate(mockServiceOpts(svc)).Command()
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--namespace=foo", "--all"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	var spec fluxupdate.Spec
+	if err := json.NewDecoder(svc.calledRequest("UpdateManifests").Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+	selector, ok := spec.Spec.(fluxupdate.PolicySelector)
+	if spec.Type != fluxupdate.Policies || !ok {
+		t.Fatalf("expected a policy selector, got %#v", spec)
+	}
+	if !reflect.DeepEqual(selector.Workloads, []string{"foo:*/*"}) || !selector.Update.Add.Has(policy.Automated) {
+		t.Errorf("expected all controllers in foo to be automated, got %#v", selector)
+	}
+
+	cmd = newServiceAutomate(mockServiceOpts(newMockService())).Command()
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--all", "--controller=deployment/bar"})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected an error for --all with --controller")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -23,6 +24,8 @@ type controllerReleaseOpts struct {
 	dryRun         bool
 	interactive    bool
 	force          bool
+	watch          bool
+	timeout        time.Duration
 	outputOpts
 	cause update.Cause
 
@@ -42,6 +45,7 @@ func (opts *controllerReleaseOpts) Command() *cobra.Command {
 			"fluxctl release -n default --controller=deployment/foo --update-image=library/hello:v2",
 			"fluxctl release --all --update-image=library/hello:v2",
 			"fluxctl release --controller=default:deployment/foo --update-all-images",
+			"fluxctl release --controller=default:deployment/foo --update-all-images --watch",
 		),
 		RunE: opts.RunE,
 	}
@@ -57,6 +61,8 @@ func (opts *controllerReleaseOpts) Command() *cobra.Command {
 	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Do not release anything; just report back what would have been done")
 	cmd.Flags().BoolVar(&opts.interactive, "interactive", false, "Select interactively which containers to update")
 	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Disregard locks and container image filters (has no effect when used with --all or --update-all-images)")
+	cmd.Flags().BoolVarP(&opts.watch, "watch", "w", false, "Wait for the new images to be rolled out in the cluster, and exit with an error if the rollout fails")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 5*time.Minute, "With --watch, how long to wait for the rollout to finish")
 
 	// Deprecated
 	cmd.Flags().StringSliceVarP(&opts.services, "service", "s", []string{}, "Service to release")
@@ -82,6 +88,8 @@ func (opts *controllerReleaseOpts) RunE(cmd *cobra.Command, args []string) error
 	switch {
 	case len(opts.controllers) <= 0 && !opts.allControllers:
 		return newUsageError("please supply either --all, or at least one --controller=<controller>")
+	case opts.watch && opts.dryRun:
+		return newUsageError("--watch has no effect when used with --dry-run")
 	case opts.force && opts.allControllers && opts.allImages:
 		return newUsageError("--force has no effect when used with --all and --update-all-images")
 	case opts.force && opts.allControllers:
@@ -175,7 +183,18 @@ func (opts *controllerReleaseOpts) RunE(cmd *cobra.Command, args []string) error
 
 		opts.dryRun = false
 	}
-	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, !opts.dryRun, opts.verbosity)
+	if !opts.watch || opts.dryRun {
+		return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, !opts.dryRun, opts.verbosity)
+	}
+
+	result, err := awaitResult(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, true, opts.verbosity)
+	if err != nil {
+		return err
+	}
+	if result.Result == nil || result.Revision == "" {
+		return nil
+	}
+	return awaitRollout(ctx, cmd.OutOrStderr(), opts.API, result.Result.AffectedResources(), opts.timeout)
 }
 
 func promptSpec(out io.Writer, result job.Result, verbosity int) (update.ContainerSpecs, error) {
@@ -2,10 +2,19 @@ package main //+integration
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/gorilla/mux"
+
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/cluster"
+	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -79,8 +88,68 @@ func TestReleaseCommand_InputFailures(t *testing.T) {
 		{[]string{"--update-all-images"}, "Should error when not specifying controller spec"},
 		{[]string{"--controller=invalid&controller", "--update-all-images"}, "Should error with invalid controller"},
 		{[]string{"subcommand"}, "Should error when given subcommand"},
+		{[]string{"--all", "--update-all-images", "--dry-run", "--watch"}, "Should error when watching a dry run"},
 	} {
 		testArgs(t, v.args, true, v.msg)
 	}
 
 }
+
+func mockWatchService(controller v6.ControllerStatus) *genericMockRoundTripper {
+	return &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("UpdateManifests"): job.ID("here-is-a-job-id"),
+			transport.NewAPIRouter().Get("JobStatus"): job.Status{
+				StatusString: job.StatusSucceeded,
+				Result: job.Result{
+					Revision: "3f4e1c2d0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d",
+					Result: update.Result{
+						controller.ID: update.ControllerResult{Status: update.ReleaseStatusSuccess},
+					},
+				},
+			},
+			transport.NewAPIRouter().Get("SyncStatus"):   []string{},
+			transport.NewAPIRouter().Get("ListServices"): []v6.ControllerStatus{controller},
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+}
+
+func runReleaseWatch(svc *genericMockRoundTripper) error {
+	cmd := newControllerRelease(mockServiceOpts(svc)).Command()
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--controller=default:deployment/foo", "--update-all-images", "--watch"})
+	return cmd.Execute()
+}
+
+func TestReleaseCommand_WatchRolledOut(t *testing.T) {
+	svc := mockWatchService(v6.ControllerStatus{
+		ID:      flux.MustParseResourceID("default:deployment/foo"),
+		Status:  cluster.StatusReady,
+		Rollout: v6.RolloutStatus{Desired: 2, Updated: 2, Ready: 2, Available: 2},
+	})
+	if err := runReleaseWatch(svc); err != nil {
+		t.Fatal(err)
+	}
+	if svc.calledRequest("ListServices") == nil {
+		t.Error("expected fluxctl release --watch to check the rollout")
+	}
+}
+
+func TestReleaseCommand_WatchFailed(t *testing.T) {
+	svc := mockWatchService(v6.ControllerStatus{
+		ID:     flux.MustParseResourceID("default:deployment/foo"),
+		Status: cluster.StatusError,
+		Rollout: v6.RolloutStatus{
+			Desired: 2, Updated: 1, Ready: 1, Available: 1, Outdated: 1,
+			Messages: []string{`ReplicaSet "foo-5d4f" has timed out progressing.`},
+		},
+	})
+	err := runReleaseWatch(svc)
+	if err == nil {
+		t.Fatal("expected an error when the rollout fails")
+	}
+	if !strings.Contains(err.Error(), "timed out progressing") {
+		t.Errorf("expected the error to explain why the rollout failed, got %q", err.Error())
+	}
+}
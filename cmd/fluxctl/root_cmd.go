@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"net/http"
 	"net/url"
 	"os"
 	"strings"
@@ -18,10 +17,14 @@ import (
 )
 
 type rootOpts struct {
-	URL       string
-	Token     string
-	Namespace string
-	API       api.Server
+	Context       string
+	URL           string
+	Token         string
+	Namespace     string
+	K8sConnection string
+	K8sService    string
+	Credentials   apiCredentials
+	API           api.Server
 }
 
 func newRoot() *rootOpts {
@@ -39,9 +42,15 @@ Connecting:
   # To a fluxd running in namespace "weave" in your current kubectl context
   fluxctl --k8s-fwd-ns=weave list-controllers
 
+  # The same, through the Kubernetes API server's proxy rather than a port forward
+  fluxctl --k8s-fwd-ns=weave --k8s-connection=proxy list-controllers
+
   # To a Weave Cloud instance, with your instance token in $TOKEN
   fluxctl --token $TOKEN list-controllers
 
+  # Using the connection saved as the context "prod" (see fluxctl config)
+  fluxctl --context prod list-controllers
+
 Workflow:
   fluxctl list-controllers                                                   # Which controllers are running?
   fluxctl list-images --controller=default:deployment/foo                    # Which images are running/available?
@@ -49,10 +58,15 @@ Workflow:
 `)
 
 const (
+	envVariableContext    = "FLUX_CONTEXT"
 	envVariableURL        = "FLUX_URL"
 	envVariableNamespace  = "FLUX_FORWARD_NAMESPACE"
 	envVariableToken      = "FLUX_SERVICE_TOKEN"
 	envVariableCloudToken = "WEAVE_CLOUD_TOKEN"
+	envVariableAuthToken  = "FLUX_AUTH_TOKEN"
+	envVariableTLSCert    = "FLUX_TLS_CERT"
+	envVariableTLSKey     = "FLUX_TLS_KEY"
+	envVariableTLSCACert  = "FLUX_TLS_CA_CERT"
 	defaultURLGivenToken  = "https://cloud.weave.works/api/flux"
 )
 
@@ -65,12 +79,26 @@ func (opts *rootOpts) Command() *cobra.Command {
 		PersistentPreRunE: opts.PersistentPreRunE,
 	}
 
+	cmd.PersistentFlags().StringVar(&opts.Context, "context", "",
+		fmt.Sprintf("Name of the context, from fluxctl's config file, supplying values for flags not given (defaults to the current context; see fluxctl config); you can also set the environment variable %s", envVariableContext))
 	cmd.PersistentFlags().StringVar(&opts.Namespace, "k8s-fwd-ns", "default",
 		fmt.Sprintf("Namespace in which fluxd is running, for creating a port forward to access the API. No port forward will be created if a URL or token is given. You can also set the environment variable %s", envVariableNamespace))
+	cmd.PersistentFlags().StringVar(&opts.K8sConnection, "k8s-connection", connectionPortForward,
+		fmt.Sprintf("How to reach fluxd when no URL or token is given: %q, to create a port forward to its pod, or %q, to go through the Kubernetes API server's proxy to its service (see --k8s-service)", connectionPortForward, connectionProxy))
+	cmd.PersistentFlags().StringVar(&opts.K8sService, "k8s-service", defaultK8sService,
+		"Service, as [scheme:]name[:port], in the namespace given by --k8s-fwd-ns, through which to reach fluxd with --k8s-connection=proxy")
 	cmd.PersistentFlags().StringVarP(&opts.URL, "url", "u", "",
 		fmt.Sprintf("Base URL of the flux API (defaults to %q if a token is provided); you can also set the environment variable %s", defaultURLGivenToken, envVariableURL))
 	cmd.PersistentFlags().StringVarP(&opts.Token, "token", "t", "",
 		fmt.Sprintf("Weave Cloud authentication token; you can also set the environment variable %s or %s", envVariableCloudToken, envVariableToken))
+	cmd.PersistentFlags().StringVar(&opts.Credentials.token, "auth-token", "",
+		fmt.Sprintf("Token to present to a fluxd that requires one (see fluxd's --api-tokens-file); you can also set the environment variable %s", envVariableAuthToken))
+	cmd.PersistentFlags().StringVar(&opts.Credentials.certFile, "tls-cert", "",
+		fmt.Sprintf("Path to a client certificate to present to a fluxd that requires one (see fluxd's --listen-tls-client-ca); you can also set the environment variable %s", envVariableTLSCert))
+	cmd.PersistentFlags().StringVar(&opts.Credentials.keyFile, "tls-key", "",
+		fmt.Sprintf("Path to the private key of --tls-cert; you can also set the environment variable %s", envVariableTLSKey))
+	cmd.PersistentFlags().StringVar(&opts.Credentials.caFile, "tls-ca-cert", "",
+		fmt.Sprintf("Path to a CA certificate with which to verify fluxd's certificate, if it's served with TLS; you can also set the environment variable %s", envVariableTLSCACert))
 
 	cmd.AddCommand(
 		newVersionCommand(),
@@ -84,23 +112,56 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newControllerUnlock(opts).Command(),
 		newControllerPolicy(opts).Command(),
 		newSave(opts).Command(),
+		newExport(opts).Command(),
 		newIdentity(opts).Command(),
 		newSync(opts).Command(),
+		newSyncStatus(opts).Command(),
+		newEvents(opts).Command(),
+		newGraph(opts).Command(),
+		newDiff(opts).Command(),
+		newListPending(opts).Command(),
+		newApprove(opts).Command(),
+		newInstall().Command(),
+		newConfig(opts).Command(),
+		newHelm(opts).Command(),
 	)
 
 	return cmd
 }
 
 func (opts *rootOpts) PersistentPreRunE(cmd *cobra.Command, _ []string) error {
+	if err := opts.applyContext(cmd.Flags()); err != nil {
+		return err
+	}
 	opts.Namespace = getFromEnvIfNotSet(cmd.Flags(), "k8s-fwd-ns", opts.Namespace, envVariableNamespace)
 	opts.Token = getFromEnvIfNotSet(cmd.Flags(), "token", opts.Token, envVariableToken, envVariableCloudToken)
 	opts.URL = getFromEnvIfNotSet(cmd.Flags(), "url", opts.URL, envVariableURL)
+	opts.Credentials.token = getFromEnvIfNotSet(cmd.Flags(), "auth-token", opts.Credentials.token, envVariableAuthToken)
+	opts.Credentials.certFile = getFromEnvIfNotSet(cmd.Flags(), "tls-cert", opts.Credentials.certFile, envVariableTLSCert)
+	opts.Credentials.keyFile = getFromEnvIfNotSet(cmd.Flags(), "tls-key", opts.Credentials.keyFile, envVariableTLSKey)
+	opts.Credentials.caFile = getFromEnvIfNotSet(cmd.Flags(), "tls-ca-cert", opts.Credentials.caFile, envVariableTLSCACert)
 
 	if opts.Token != "" && opts.URL == "" {
 		opts.URL = defaultURLGivenToken
 	}
 
-	if opts.URL == "" {
+	httpClient, err := opts.Credentials.httpClient()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.URL != "":
+	case opts.K8sConnection == connectionProxy:
+		if opts.Credentials != (apiCredentials{}) {
+			// The API server uses the Authorization header for itself,
+			// and terminates TLS
+			return newUsageError("--auth-token and --tls-* can't be used with --k8s-connection=proxy, since the Kubernetes API server uses its own credentials")
+		}
+		if httpClient, opts.URL, err = k8sProxy(opts.Namespace, opts.K8sService); err != nil {
+			return err
+		}
+	case opts.K8sConnection == connectionPortForward:
 		portforwarder, err := tryPortforwards(opts.Namespace, metav1.LabelSelector{
 			MatchExpressions: []metav1.LabelSelectorRequirement{
 				metav1.LabelSelectorRequirement{
@@ -118,17 +179,50 @@ func (opts *rootOpts) PersistentPreRunE(cmd *cobra.Command, _ []string) error {
 			return err
 		}
 
-		opts.URL = fmt.Sprintf("http://127.0.0.1:%d/api/flux", portforwarder.ListenPort)
+		scheme := "http"
+		if opts.Credentials.usesTLS() {
+			scheme = "https"
+		}
+		opts.URL = fmt.Sprintf("%s://127.0.0.1:%d/api/flux", scheme, portforwarder.ListenPort)
+	default:
+		return newUsageError(fmt.Sprintf("--k8s-connection must be %q or %q", connectionPortForward, connectionProxy))
 	}
 
 	if _, err := url.Parse(opts.URL); err != nil {
 		return errors.Wrapf(err, "parsing URL")
 	}
 
-	opts.API = client.New(http.DefaultClient, transport.NewAPIRouter(), opts.URL, client.Token(opts.Token))
+	opts.API = client.New(httpClient, transport.NewAPIRouter(), opts.URL, client.Token(opts.Token))
 	return nil
 }
 
+// applyContext supplies values for flags, from the context given, or
+// the current context if there is one.
+func (opts *rootOpts) applyContext(flags *pflag.FlagSet) error {
+	name := getFromEnvIfNotSet(flags, "context", opts.Context, envVariableContext)
+	path, err := configPath()
+	if err != nil {
+		if name == "" {
+			return nil // no config to look in, and none needed
+		}
+		return err
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		if name = config.CurrentContext; name == "" {
+			return nil
+		}
+	}
+	ctx, ok := config.context(name)
+	if !ok {
+		return fmt.Errorf("no context named %q in %s", name, path)
+	}
+	return ctx.applyTo(flags)
+}
+
 func getFromEnvIfNotSet(flags *pflag.FlagSet, flagName, value string, envNames ...string) string {
 	if flags.Changed(flagName) {
 		return value
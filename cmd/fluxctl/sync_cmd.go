@@ -3,15 +3,18 @@ package main
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/update"
 )
 
 type syncOpts struct {
 	*rootOpts
+	timeout time.Duration
 }
 
 func newSync(parent *rootOpts) *syncOpts {
@@ -22,8 +25,14 @@ func (opts *syncOpts) Command() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "sync",
 		Short: "synchronize the cluster with the git repository, now",
-		RunE:  opts.RunE,
+		Long: `Fetch the latest revision from the git repository, and wait until
+it has been applied to the cluster. Once it's applied, the full
+revision is printed to stdout; if the sync fails, or any resources
+fail to apply, the command exits with an error.`,
+		Example: makeExample("fluxctl sync", "fluxctl sync --timeout=5m"),
+		RunE:    opts.RunE,
 	}
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", time.Minute, "how long to wait for the revision to be applied")
 	return cmd
 }
 
@@ -48,6 +57,19 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("git repository %s is not ready to sync (status: %s)", gitConfig.Remote.URL, string(gitConfig.Status))
 	}
 
+	// If the daemon can report its status, it's possible to tell
+	// when an attempt to sync has failed, rather than waiting until
+	// the timeout.
+	reporter, _ := opts.API.(statusReporter)
+	var before v10.SyncResult
+	if reporter != nil {
+		status, err := reporter.DaemonStatus(ctx)
+		if err != nil {
+			reporter = nil // e.g., an older daemon
+		}
+		before = status.LastSync
+	}
+
 	fmt.Fprintf(cmd.OutOrStderr(), "Synchronizing with %s\n", gitConfig.Remote.URL)
 
 	updateSpec := update.Spec{
@@ -67,10 +89,45 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 	rev := result.Revision[:7]
 	fmt.Fprintf(cmd.OutOrStderr(), "HEAD of %s is %s\n", gitConfig.Remote.Branch, rev)
 	fmt.Fprintf(cmd.OutOrStderr(), "Waiting for %s to be applied ...\n", rev)
-	err = awaitSync(ctx, opts.API, rev)
+	err = backoff(1*time.Second, 2, 10, opts.timeout, func() (bool, error) {
+		refs, err := opts.API.SyncStatus(ctx, rev)
+		if err != nil || len(refs) == 0 {
+			return err == nil, err
+		}
+		if reporter == nil {
+			return false, nil
+		}
+		status, err := reporter.DaemonStatus(ctx)
+		if err == nil && status.LastSync.Error != "" && status.LastSync.Attempted.After(before.Attempted) {
+			if len(status.LastSync.Errors) > 0 {
+				printResourceErrors(cmd.OutOrStderr(), status.LastSync.Errors)
+			}
+			return false, fmt.Errorf("sync failed: %s", status.LastSync.Error)
+		}
+		return false, nil
+	})
+	if err == ErrTimeout {
+		fmt.Fprintf(cmd.OutOrStderr(), `
+We timed out waiting for %s to be applied. This does not necessarily
+mean there is a problem; use
+
+    fluxctl sync-status
+
+to see the outcome of the last sync.
+`, rev)
+	}
 	if err != nil {
 		return err
 	}
-	fmt.Fprintln(cmd.OutOrStderr(), "Done.")
+
+	if reporter != nil {
+		status, err := reporter.DaemonStatus(ctx)
+		if err == nil && status.LastSync.Revision == result.Revision && status.LastSync.ResourceErrors > 0 {
+			printResourceErrors(cmd.OutOrStderr(), status.LastSync.Errors)
+			return fmt.Errorf("%s was applied, but %d resource(s) failed to apply", rev, status.LastSync.ResourceErrors)
+		}
+	}
+	// The full revision goes to stdout, so that scripts can use it
+	fmt.Fprintln(cmd.OutOrStdout(), result.Revision)
 	return nil
 }
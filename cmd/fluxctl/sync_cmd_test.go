@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/git"
+	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/job"
+)
+
+const syncedRevision = "3f4e1c2d0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d"
+
+func mockSyncService(lastSync v10.SyncResult) *genericMockRoundTripper {
+	return &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("GitRepoConfig"): v6.GitConfig{
+				Remote: v6.GitRemoteConfig{URL: "git@example.com:repo", Branch: "master"},
+				Status: git.RepoReady,
+			},
+			transport.NewAPIRouter().Get("UpdateManifests"): job.ID("here-is-a-job-id"),
+			transport.NewAPIRouter().Get("JobStatus"): job.Status{
+				StatusString: job.StatusSucceeded,
+				Result:       job.Result{Revision: syncedRevision},
+			},
+			transport.NewAPIRouter().Get("SyncStatus"):   []string{},
+			transport.NewAPIRouter().Get("DaemonStatus"): v10.Status{LastSync: lastSync},
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+}
+
+func runSync(t *testing.T, svc *genericMockRoundTripper) (string, error) {
+	cmd := newSync(mockServiceOpts(svc)).Command()
+	out := &bytes.Buffer{}
+	cmd.SetOutput(out)
+	cmd.SetArgs([]string{})
+	err := cmd.Execute()
+	if svc.calledRequest("UpdateManifests") == nil {
+		t.Error("expected fluxctl sync to request a sync")
+	}
+	return out.String(), err
+}
+
+func TestSyncCommand_PrintsRevision(t *testing.T) {
+	svc := mockSyncService(v10.SyncResult{Revision: syncedRevision, Time: time.Now()})
+	out, err := runSync(t, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix([]byte(out), []byte(syncedRevision+"\n")) {
+		t.Errorf("expected output to end with the revision applied, got %q", out)
+	}
+}
+
+func TestSyncCommand_ResourceErrors(t *testing.T) {
+	svc := mockSyncService(v10.SyncResult{
+		Revision:       syncedRevision,
+		Time:           time.Now(),
+		ResourceErrors: 1,
+		Errors: []v10.ResourceError{{
+			ID:    flux.MustParseResourceID("default:deployment/helloworld"),
+			Path:  "helloworld-deploy.yaml",
+			Line:  1,
+			Error: "boom",
+		}},
+	})
+	out, err := runSync(t, svc)
+	if err == nil {
+		t.Error("expected an error when resources failed to apply")
+	}
+	if !strings.Contains(out, "helloworld-deploy.yaml:1") {
+		t.Errorf("expected the failed resource to be listed in the command's output, got %q", out)
+	}
+}
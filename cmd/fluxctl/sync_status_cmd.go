@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/api/v10"
+)
+
+type syncStatusOpts struct {
+	*rootOpts
+}
+
+func newSyncStatus(parent *rootOpts) *syncStatusOpts {
+	return &syncStatusOpts{rootOpts: parent}
+}
+
+// statusReporter is implemented by API clients that can fetch the
+// daemon's status, which isn't part of api.Server.
+type statusReporter interface {
+	DaemonStatus(context.Context) (v10.Status, error)
+}
+
+func (opts *syncStatusOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "sync-status",
+		Short:   "Show the outcome of the last sync, including which resources failed to apply, and where they are defined.",
+		Example: makeExample("fluxctl sync-status"),
+		RunE:    opts.RunE,
+	}
+	return cmd
+}
+
+func (opts *syncStatusOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	reporter, ok := opts.API.(statusReporter)
+	if !ok {
+		return errors.New("the API client cannot fetch the daemon's status")
+	}
+	status, err := reporter.DaemonStatus(context.Background())
+	if err != nil {
+		return err
+	}
+
+	sync := status.LastSync
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 2, 2, ' ', 0)
+	if sync.Revision == "" {
+		fmt.Fprintln(w, "Nothing has been synced yet")
+	} else {
+		fmt.Fprintf(w, "Revision:\t%s\n", sync.Revision)
+		fmt.Fprintf(w, "Synced at:\t%s\n", sync.Time.Local().Format(time.RFC822))
+		fmt.Fprintf(w, "Errors:\t%d\n", sync.ResourceErrors)
+	}
+	if sync.Error != "" {
+		fmt.Fprintf(w, "Last attempt failed:\t%s\n", sync.Error)
+	}
+	w.Flush()
+	if len(sync.Errors) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout())
+	printResourceErrors(cmd.OutOrStdout(), sync.Errors)
+	return nil
+}
+
+// printResourceErrors lists the resources that failed to sync, and
+// where they are defined, to the writer given.
+func printResourceErrors(out io.Writer, errs []v10.ResourceError) {
+	w := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(w, "RESOURCE\tFILE\tERROR\n")
+	for _, e := range errs {
+		file := e.Path
+		if e.Line > 0 {
+			file = fmt.Sprintf("%s:%d", e.Path, e.Line)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.ID, file, e.Error)
+	}
+	w.Flush()
+}
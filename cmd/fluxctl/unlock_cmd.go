@@ -8,8 +8,10 @@ import (
 
 type controllerUnlockOpts struct {
 	*rootOpts
-	namespace  string
-	controller string
+	namespace   string
+	controllers []string
+	selector    string
+	all         bool
 	outputOpts
 	cause update.Cause
 
@@ -33,7 +35,9 @@ func (opts *controllerUnlockOpts) Command() *cobra.Command {
 	AddOutputFlags(cmd, &opts.outputOpts)
 	AddCauseFlags(cmd, &opts.cause)
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
-	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Controller to unlock")
+	cmd.Flags().StringSliceVarP(&opts.controllers, "controller", "c", nil, "Controller to unlock, or a pattern matching controllers; give more than once for several")
+	cmd.Flags().StringVarP(&opts.selector, "selector", "l", "", "Unlock the controllers with labels matching this selector")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Unlock all the controllers in the namespace")
 
 	// Deprecate
 	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Service to unlock")
@@ -47,12 +51,14 @@ func (opts *controllerUnlockOpts) RunE(cmd *cobra.Command, args []string) error
 		return errorServiceFlagDeprecated
 	}
 	policyOpts := &controllerPolicyOpts{
-		rootOpts:   opts.rootOpts,
-		outputOpts: opts.outputOpts,
-		namespace:  opts.namespace,
-		controller: opts.controller,
-		cause:      opts.cause,
-		unlock:     true,
+		rootOpts:    opts.rootOpts,
+		outputOpts:  opts.outputOpts,
+		namespace:   opts.namespace,
+		controllers: opts.controllers,
+		selector:    opts.selector,
+		all:         opts.all,
+		cause:       opts.cause,
+		unlock:      true,
 	}
 	return policyOpts.RunE(cmd, args)
 }
@@ -1,42 +1,72 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	k8sifclient "github.com/weaveworks/flux/integrations/client/clientset/versioned"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	k8sclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/audit"
+	"github.com/weaveworks/flux/authz"
 	"github.com/weaveworks/flux/checkpoint"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/cluster/kubernetes/timeout"
+	"github.com/weaveworks/flux/commitstatus"
 	"github.com/weaveworks/flux/daemon"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/gpg"
+	daemongrpc "github.com/weaveworks/flux/grpc/daemon"
 	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/http/client"
 	daemonhttp "github.com/weaveworks/flux/http/daemon"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/logging"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+	"github.com/weaveworks/flux/notify"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/pullrequest"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/registry/cache"
 	registryMemcache "github.com/weaveworks/flux/registry/cache/memcached"
+	registryMemory "github.com/weaveworks/flux/registry/cache/memory"
+	registryRedis "github.com/weaveworks/flux/registry/cache/redis"
 	registryMiddleware "github.com/weaveworks/flux/registry/middleware"
+	"github.com/weaveworks/flux/releasegate"
 	"github.com/weaveworks/flux/remote"
 	"github.com/weaveworks/flux/ssh"
+	fluxsync "github.com/weaveworks/flux/sync"
+	"github.com/weaveworks/flux/tracing"
+	"github.com/weaveworks/flux/update"
+	"github.com/weaveworks/flux/vulnscan"
 )
 
 var version = "unversioned"
@@ -54,6 +84,25 @@ const (
 	defaultGitSyncTag     = "flux-sync"
 	defaultGitNotesRef    = "flux"
 	defaultGitSkipMessage = "\n\n[ci skip]"
+
+	// Where the revision last synced can be recorded
+	syncStateGit       = "git"
+	syncStateConfigMap = "configmap"
+	syncStateSecret    = "secret"
+
+	// How manifests can be applied to the cluster
+	syncApplierKubectl    = "kubectl"
+	syncApplierClient     = "client"
+	syncApplierServerSide = "server-side"
+
+	// Where image metadata can be cached
+	registryCacheMemcached = "memcached"
+	registryCacheRedis     = "redis"
+	registryCacheMemory    = "memory"
+
+	// The known_hosts files ssh consults by default
+	sshGlobalKnownHosts = "/etc/ssh/ssh_known_hosts"
+	sshUserKnownHosts   = "~/.ssh/known_hosts"
 )
 
 func optionalVar(fs *pflag.FlagSet, value ssh.OptionalValue, name, usage string) ssh.OptionalValue {
@@ -73,52 +122,161 @@ func main() {
 	}
 	// This mirrors how kubectl extracts information from the environment.
 	var (
-		listenAddr        = fs.StringP("listen", "l", ":3030", "Listen address where /metrics and API will be served")
+		listenAddr        = fs.StringP("listen", "l", ":3030", "Listen address where /metrics, /readyz and API will be served")
+		listenTLSCert     = fs.String("listen-tls-cert", "", "path to a TLS certificate to serve --listen with; if set, --listen-tls-key must be too")
+		listenTLSKey      = fs.String("listen-tls-key", "", "path to the private key of --listen-tls-cert")
+		listenTLSClientCA = fs.String("listen-tls-client-ca", "", "path to a CA certificate; if set, requests to the API must present a client certificate signed by it (requires --listen-tls-cert)")
+		apiTokensFile     = fs.String("api-tokens-file", "", "path to a file of tokens, one per line, of which requests to the API must present one as a bearer token; e.g., mounted from a Secret. The file is read again when it changes")
+		apiAuthzFile      = fs.String("api-authorization-file", "", "path to a YAML file of rules giving identities (names of API tokens, or common names of client certificates) the verbs they may use in which namespaces; anything not allowed is refused. Requires --api-tokens-file or --listen-tls-client-ca")
+		grpcListenAddr    = fs.String("grpc-listen", "", "if set, listen address where the API will also be served as gRPC (see grpc/fluxpb/flux.proto), with the same TLS, tokens and authorization as --listen")
 		kubernetesKubectl = fs.String("kubernetes-kubectl", "", "Optional, explicit path to kubectl tool")
+		proxyURL          = fs.String("proxy-url", "", "URL of an HTTP proxy through which to reach image registries, HTTPS git hosts and their APIs, webhooks and so on, e.g., http://proxy.example.com:3128; overrides HTTP_PROXY and HTTPS_PROXY. Hosts in NO_PROXY, and the Kubernetes API server, are reached directly")
 		versionFlag       = fs.Bool("version", false, "Get version number")
+		logFormat         = fs.String("log-format", logging.FormatLogfmt, "format of log lines: 'logfmt' or 'json'")
+		logLevel          = fs.String("log-level", "info", "least important level of log lines to write (debug, info, warn or error), optionally with levels for components, e.g., 'warn,registry=debug,sync-loop=info'")
+		clusterID         = fs.String("cluster-id", "", "if set, a name for the cluster fluxd runs in, which is given in events, notifications, commit messages and metrics (as the label cluster_id), to tell apart those from several clusters")
 		// Git repo & key etc.
 		gitURL       = fs.String("git-url", "", "URL of git repo with Kubernetes manifests; e.g., git@github.com:weaveworks/flux-example")
 		gitBranch    = fs.String("git-branch", "master", "branch of git repo to use for Kubernetes manifests")
+		gitTag       = fs.String("git-tag", "", "if set, sync this tag rather than the head of --git-branch (commits are still made to --git-branch)")
+		gitTagPatt   = fs.String("git-tag-pattern", "", "if set, sync the newest tag matching this pattern rather than the head of --git-branch; either a glob (e.g., 'v*', newest by creation date) or prefixed with 'semver:' (e.g., 'semver:~1.2', highest version)")
 		gitPath      = fs.StringSlice("git-path", []string{}, "relative paths within the git repo to locate Kubernetes manifests")
 		gitUser      = fs.String("git-user", "Weave Flux", "username to use as git committer")
 		gitEmail     = fs.String("git-email", "support@weave.works", "email to use as git committer")
 		gitSetAuthor = fs.Bool("git-set-author", false, "If set, the author of git commits will reflect the user who initiated the commit and will differ from the git committer.")
 		gitLabel     = fs.String("git-label", "", "label to keep track of sync progress; overrides both --git-sync-tag and --git-notes-ref")
 		// Old git config; still used if --git-label is not supplied, but --git-label is preferred.
-		gitSyncTag     = fs.String("git-sync-tag", defaultGitSyncTag, "tag to use to mark sync progress for this cluster")
-		gitNotesRef    = fs.String("git-notes-ref", defaultGitNotesRef, "ref to use for keeping commit annotations in git notes")
-		gitSkip        = fs.Bool("git-ci-skip", false, `append "[ci skip]" to commit messages so that CI will skip builds`)
-		gitSkipMessage = fs.String("git-ci-skip-message", "", "additional text for commit messages, useful for skipping builds in CI. Use this to supply specific text, or set --git-ci-skip")
+		gitSyncTag         = fs.String("git-sync-tag", defaultGitSyncTag, "tag to use to mark sync progress for this cluster")
+		gitNotesRef        = fs.String("git-notes-ref", defaultGitNotesRef, "ref to use for keeping commit annotations in git notes")
+		gitSkip            = fs.Bool("git-ci-skip", false, `append "[ci skip]" to commit messages so that CI will skip builds`)
+		gitSkipMessage     = fs.String("git-ci-skip-message", "", "additional text for commit messages, useful for skipping builds in CI. Use this to supply specific text, or set --git-ci-skip")
+		gitCommitTemplates = fs.StringArray("git-commit-template", []string{}, "Go template for the messages of commits made for a type of update, given as type=template, where type is 'auto' (automated image updates), 'image' (releases), 'containers' or 'policy'; may be repeated")
+		gitCommitAuthors   = fs.StringArray("git-commit-author", []string{}, "author for commits made for a type of update, given as type='Name <email>' (types as for --git-commit-template); may be repeated")
+		gitSigningKey      = fs.String("git-signing-key", "", "if set, commits will be signed with this GPG key")
+		gitImportGPG       = fs.String("git-gpg-key-import", "", "keys at the path given (either a file or a directory) will be imported for use in signing commits")
 
 		gitPollInterval = fs.Duration("git-poll-interval", 5*time.Minute, "period at which to poll git repo for new commits")
+		gitCloneDepth   = fs.Int("git-clone-depth", 0, "if greater than zero, make a shallow clone of the git repo with this many commits of history; falls back to a full clone if the server does not support shallow clones")
+		gitSparse       = fs.Bool("git-sparse-checkout", false, "if set, only check out the paths given with --git-path when working with the git repo")
+		gitSubmodules   = fs.String("git-submodules", string(git.SubmodulesOff), "whether to check out submodules of the git repo: 'recursive' (with full history), 'shallow' (only the commits needed), or 'off'")
+		gitTLSCAFile    = fs.String("git-tls-ca-file", "", "PEM file of CA certificates to verify the certificate of an HTTPS git host (and its API, for commit statuses and pull requests) against, instead of the usual ones; e.g., for a git host with an internal CA")
+		gitTLSInsecure  = fs.Bool("git-tls-insecure-skip-verify", false, "if set, don't verify the certificate of an HTTPS git host (or its API) at all; insecure, and only for trying things out")
+		gitReadOnly     = fs.Bool("git-readonly", false, "if set, fluxd will not write to the git repo: no commits (from automation, releases or policy changes) are pushed, and the sync tag is not used")
+		// manifests
+		manifestGeneration  = fs.Bool("manifest-generation", false, "experimental; search for .flux.yaml files to generate manifests, rather than only reading them from files")
+		manifestJsonnet     = fs.Bool("manifest-jsonnet", false, "if set, render .jsonnet files in the manifest paths with jsonnet, and apply the resources they evaluate to along with those in YAML files")
+		manifestJsonnetExe  = fs.String("manifest-jsonnet-binary", "", "path to the jsonnet executable used with --manifest-jsonnet; if empty, jsonnet is looked for in the PATH")
+		manifestJsonnetPath = fs.StringSlice("manifest-jsonnet-import-path", []string{}, "a directory to search for files imported by .jsonnet files (e.g., 'vendor', for jsonnet-bundler); relative to the top of the repo. May be repeated")
+		// commit statuses
+		commitStatusProvider  = fs.String("commit-status-provider", "", "if set to 'github' or 'gitlab', post the outcome of each sync as a status on the commit synced")
+		commitStatusAPIURL    = fs.String("commit-status-api-url", "", "base URL of the git provider's API, for posting commit statuses; defaults to the public GitHub or GitLab API")
+		commitStatusRepo      = fs.String("commit-status-repo", "", "repository to post commit statuses to, e.g., 'weaveworks/flux-example'; defaults to the path given in --git-url")
+		commitStatusTokenFile = fs.String("commit-status-token-file", "", "path to a file containing an API token used to post commit statuses")
+		// pull requests
+		pullRequestProvider  = fs.String("git-pull-request-provider", "", "if set to 'github' or 'gitlab', push automated image updates and policy changes to a new branch and open a pull request for them, rather than pushing to --git-branch")
+		pullRequestAPIURL    = fs.String("git-pull-request-api-url", "", "base URL of the git provider's API, for opening pull requests; defaults to the public GitHub or GitLab API")
+		pullRequestRepo      = fs.String("git-pull-request-repo", "", "repository to open pull requests in, e.g., 'weaveworks/flux-example'; defaults to the path given in --git-url")
+		pullRequestTokenFile = fs.String("git-pull-request-token-file", "", "path to a file containing an API token used to open pull requests")
 		// syncing
-		syncInterval = fs.Duration("sync-interval", 5*time.Minute, "apply config in git to cluster at least this often, even if there are no new commits")
+		syncInterval       = fs.Duration("sync-interval", 5*time.Minute, "apply config in git to cluster at least this often, even if there are no new commits")
+		syncStateKind      = fs.String("sync-state", syncStateGit, "where to record the revision last synced: 'git' (a tag in the repo, as given by --git-sync-tag), 'configmap' or 'secret' (in the namespace fluxd runs in, named after --git-sync-tag)")
+		syncPathIntervals  = fs.StringSlice("sync-interval-path", []string{}, "reapply unchanged manifests under a path in the repo only this often, given as path=duration (e.g., 'crds=1h'); may be repeated")
+		syncLabelSelector  = fs.String("sync-label-selector", "", "if set, only apply manifests with labels matching this selector (e.g., 'flux-instance=prod'); others in the repo are ignored")
+		syncApplier        = fs.String("sync-applier", syncApplierKubectl, "how to apply manifests to the cluster: 'kubectl' (run kubectl apply), 'client' (the same three-way merge as kubectl apply, made via the API without needing kubectl), or 'server-side' (server-side apply, Kubernetes 1.14 or later)")
+		syncIgnoreFields   = fs.StringSlice("sync-ignore-field", []string{}, "leave this field out of manifests when applying them, and alone in the cluster, since something else looks after it; given as [Kind:]path, e.g., 'Deployment:spec.template.metadata.annotations.sidecar\\.istio\\.io/status'; may be repeated")
+		syncSubstituteFrom = fs.StringSlice("sync-substitute-from", []string{}, "a ConfigMap or Secret, given as [namespace/]configmap/name or [namespace/]secret/name, whose entries are substituted for ${NAME} placeholders in manifests with the annotation flux.weave.works/substitute: \"true\"; the namespace defaults to fluxd's own. May be repeated; later entries win")
+		syncValidate       = fs.Bool("sync-validate", false, "if set, validate all manifests with a server-side dry run before applying any, and abort the sync if any fail validation")
+		syncRollbackErrors = fs.Int("sync-rollback-errors", 0, "if greater than zero, and at least this many resources fail to apply when syncing a new revision, apply the revision synced before it again, and don't try the new revision again")
+		syncPathsInOrder   = fs.Bool("sync-paths-in-order", false, "if set, apply the manifests from each --git-path in the order given, waiting for any custom resource definitions to be established before moving on to the next path")
+		syncShard          = fs.String("sync-shard", "", "if set, this fluxd is one of several syncing the same repo, under this name (which must be a valid ConfigMap key): it claims the resources it applies, and leaves alone any already claimed by another, reporting them as failing to sync")
+		syncShardConfigMap = fs.String("sync-shard-configmap", "flux-shards", "the ConfigMap, given as [namespace/]name, in which each fluxd given --sync-shard records the resources it has claimed; the namespace defaults to fluxd's own")
 		// registry
-		memcachedHostname    = fs.String("memcached-hostname", "memcached", "Hostname for memcached service.")
-		memcachedTimeout     = fs.Duration("memcached-timeout", time.Second, "Maximum time to wait before giving up on memcached requests.")
-		memcachedService     = fs.String("memcached-service", "memcached", "SRV service used to discover memcache servers.")
-		registryCacheExpiry  = fs.Duration("registry-cache-expiry", 1*time.Hour, "Duration to keep cached image info. Must be < 1 month.")
-		registryPollInterval = fs.Duration("registry-poll-interval", 5*time.Minute, "period at which to check for updated images")
-		registryRPS          = fs.Int("registry-rps", 200, "maximum registry requests per second per host")
-		registryBurst        = fs.Int("registry-burst", defaultRemoteConnections, "maximum number of warmer connections to remote and memcache")
-		registryTrace        = fs.Bool("registry-trace", false, "output trace of image registry requests to log")
-		registryInsecure     = fs.StringSlice("registry-insecure-host", []string{}, "use HTTP for this image registry domain (e.g., registry.cluster.local), instead of HTTPS")
+		registryCacheBackend  = fs.String("registry-cache", registryCacheMemcached, "where to cache image metadata: 'memcached', 'redis', or 'memory' (in fluxd itself, optionally saved to --registry-cache-snapshot)")
+		memcachedHostname     = fs.String("memcached-hostname", "memcached", "Hostname for memcached service.")
+		memcachedTimeout      = fs.Duration("memcached-timeout", time.Second, "Maximum time to wait before giving up on memcached requests.")
+		memcachedService      = fs.String("memcached-service", "memcached", "SRV service used to discover memcache servers.")
+		redisAddress          = fs.String("redis-address", "redis:6379", "address (host:port) of the Redis server to use when --registry-cache=redis")
+		redisPasswordFile     = fs.String("redis-password-file", "", "path to a file containing the password for the Redis server, if it needs one")
+		redisDB               = fs.Int("redis-db", 0, "the Redis database number to use")
+		redisTimeout          = fs.Duration("redis-timeout", time.Second, "maximum time to wait before giving up on Redis requests")
+		registryCacheMaxSize  = fs.Int("registry-cache-max-size", 256, "the most image metadata to keep when --registry-cache=memory, in megabytes; the least recently used is dropped to stay within this")
+		registryCacheSnapshot = fs.String("registry-cache-snapshot", "", "when --registry-cache=memory, save the cache to this file every five minutes and on exit, and load it on start")
+		registryCacheExpiry   = fs.Duration("registry-cache-expiry", 1*time.Hour, "Duration to keep cached image info. Must be < 1 month.")
+		registryStaleAfter    = fs.Duration("registry-stale-after", 30*time.Minute, "report the images in a repository as stale if they have not been refreshed for this long; the last known images are still used")
+		registryPollInterval  = fs.Duration("registry-poll-interval", 5*time.Minute, "period at which to check for updated images")
+		automationWindow      = fs.String("automation-window", "", "when automated image updates may be made, as cron-like expressions, e.g., '* 9-16 * * MON-FRI' for weekdays from 9am to 5pm (UTC); updates found outside the window are held until it opens. Workloads can have their own with the annotation flux.weave.works/automation_window")
+		automationBatchWindow = fs.Duration("automation-batch-window", 0, "if greater than zero, wait this long after finding new images for automated workloads before committing, so that updates found in the meantime go in the same commit")
+		automationApproval    = fs.Bool("automation-require-approval", false, "if set, automated image updates wait as pending releases, listed by 'fluxctl list-pending', until approved with 'fluxctl approve', rather than being committed straight away")
+		automationRollback    = fs.Duration("automation-rollback-timeout", 10*time.Minute, "for workloads with the annotation flux.weave.works/rollback_on_failure, how long the rollout of an automated image update has to finish before it's reverted; zero means only revert rollouts that report having failed")
+		automationCompareURL  = fs.String("automation-compare-url-template", update.DefaultCompareURLTemplate, "Go template for links to the changes between the revisions the old and new images of an automated update were built from, as given by the images' labels, which are included in commit messages and events; empty means no links are made")
+		releaseGateURL        = fs.String("release-gate-url", "", "if set, POST each automated image update to this URL before committing it; the response decides whether it proceeds, is delayed, or is aborted")
+		releaseGateTimeout    = fs.Duration("release-gate-timeout", 10*time.Second, "how long to wait for the release gate to respond; updates are delayed if it doesn't")
+		vulnScannerURL        = fs.String("vuln-scanner-url", "", "if set, ask the vulnerability scanner at this URL about each image before automation updates to it, and pass over images with vulnerabilities more severe than --vuln-max-severity")
+		vulnScannerKind       = fs.String("vuln-scanner-kind", vulnscan.KindWebhook, "the API the vulnerability scanner has: 'webhook' (POST the image, and get its vulnerabilities back as JSON) or 'anchore' (the Anchore Engine API)")
+		vulnScannerTimeout    = fs.Duration("vuln-scanner-timeout", 30*time.Second, "how long to wait for the vulnerability scanner to respond; updates are delayed if it doesn't")
+		vulnMaxSeverity       = fs.String("vuln-max-severity", string(vulnscan.Medium), "the most severe vulnerability an image may have, for automation to update to it: one of negligible, low, medium, high, critical")
+		vulnUnknownSeverity   = fs.String("vuln-unknown-severity", string(vulnscan.Critical), "the severity to assume for vulnerabilities the scanner doesn't give a severity for: one of negligible, low, medium, high, critical")
+		auditLogSinks         = fs.StringSlice("audit-log", nil, "where to write a record of each release, policy change, automated update and sync, as JSON: 'stdout', 'file:<path>', or an http(s) URL to POST to; give more than once to write to several. Recent records can be seen with fluxctl events regardless")
+		notifySlackURLs       = fs.StringSlice("notify-slack-url", nil, "Slack incoming webhook URL to send notifications of events to; may be repeated")
+		notifyMSTeamsURLs     = fs.StringSlice("notify-msteams-url", nil, "Microsoft Teams incoming webhook URL to send notifications of events to; may be repeated")
+		notifyWebhookURLs     = fs.StringSlice("notify-webhook-url", nil, "URL to POST notifications of events to, as JSON; may be repeated")
+		notifyEvents          = fs.StringSlice("notify-events", notify.DefaultKinds, "the kinds of event to send notifications of: "+strings.Join(notify.Kinds, ", "))
+		notifyTemplates       = fs.StringArray("notify-template", []string{}, "Go template for the text of notifications of a kind of event, given as kind=template (kinds as for --notify-events); may be repeated")
+		tracingZipkinURL      = fs.String("tracing-zipkin-url", "", "URL of a Zipkin (or Jaeger, with its Zipkin endpoint enabled) collector to send trace spans to; e.g., http://zipkin:9411/api/v2/spans")
+		tracingSampleRate     = fs.Float64("tracing-sample-rate", 1, "proportion of traces to record, from 0 to 1")
+		registryRPS           = fs.Int("registry-rps", 200, "maximum registry requests per second per host")
+		registryBurst         = fs.Int("registry-burst", defaultRemoteConnections, "maximum number of warmer connections to remote and memcache")
+		registryWorkers       = fs.Int("registry-workers", 4, "number of images to scan for metadata at once")
+		registryHostWorkers   = fs.Int("registry-host-workers", 2, "maximum number of images from any one registry host to scan for metadata at once")
+		registryHostLimits    = fs.StringSlice("registry-host-limit", []string{}, "limit the requests to a particular registry host, overriding --registry-rps and --registry-burst, given as host=rps[/burst], e.g., index.docker.io=2/5; may be repeated")
+		registryTrace         = fs.Bool("registry-trace", false, "output trace of image registry requests to log")
+		registryInsecure      = fs.StringSlice("registry-insecure-host", []string{}, "use HTTP for this image registry domain (e.g., registry.cluster.local), instead of HTTPS")
+		registryMirrors       = fs.StringSlice("registry-mirror", []string{}, "fetch the metadata for images starting with a prefix from a mirror instead, given as prefix=replacement, e.g., docker.io=registry.example.com/dockerhub; may be repeated")
+		registryOffline       = fs.Bool("registry-offline", false, "if set, fetch image metadata only from --registry-mirror mirrors, and don't use credential providers; images without a mirror are reported as errors rather than tried, e.g., in an air-gapped cluster")
+		registryPlatforms     = fs.StringSlice("registry-platform", []string{registry.DefaultPlatform.String()}, "the platforms, as os/arch[/variant], to get image metadata for from multi-platform images (manifest lists and OCI indexes), in order of preference")
+		registryRequired      = fs.StringSlice("registry-require-platform", []string{}, "only use images available for all of these platforms, as os/arch[/variant] (e.g., linux/arm64 for a cluster of ARM nodes); images without them are left out, so they're never released or automated")
+		registryIncludeImages = fs.StringSlice("registry-include-image", []string{}, "only scan images matching these globs (e.g., 'quay.io/myorg/*') for metadata; all images are scanned if this is not set")
+		registryExcludeImages = fs.StringSlice("registry-exclude-image", []string{}, "do not scan images matching these globs (e.g., 'k8s.gcr.io/*') for metadata, e.g., because the registry can't be reached; takes precedence over --registry-include-image")
+		registryProviders     = fs.StringSlice("registry-credential-provider", []string{"aws", "gcp", "azure"}, "platforms to get image registry credentials from, for registries with no credentials in image pull secrets or --docker-config: 'aws' (Amazon ECR), 'gcp' (Google Container Registry and Artifact Registry) and 'azure' (Azure Container Registry)")
+		registryAWSRegions    = fs.StringSlice("registry-ecr-region", []string{}, "restrict the Amazon ECR registries fluxd gets authorization tokens for to those in these regions; all regions are included if this is not set")
+		registryAWSAccountIDs = fs.StringSlice("registry-ecr-include-id", []string{}, "restrict the Amazon ECR registries fluxd gets authorization tokens for to those belonging to these account IDs; all accounts are included if this is not set")
 
 		// k8s-secret backed ssh keyring configuration
 		k8sSecretName            = fs.String("k8s-secret-name", "flux-git-deploy", "Name of the k8s secret used to store the private SSH key")
 		k8sSecretVolumeMountPath = fs.String("k8s-secret-volume-mount-path", "/etc/fluxd/ssh", "Mount location of the k8s secret storing the private SSH key")
 		k8sSecretDataKey         = fs.String("k8s-secret-data-key", "identity", "Data key holding the private SSH key within the k8s secret")
 		k8sNamespaceWhitelist    = fs.StringSlice("k8s-namespace-whitelist", []string{}, "Experimental, optional: restrict the view of the cluster to the namespaces listed. All namespaces are included if this is not set.")
+		k8sAllowNamespace        = fs.StringSlice("k8s-allow-namespace", []string{}, "Experimental, optional: restrict the namespaces fluxd looks at and applies resources to, to those listed. All namespaces are included if this is not set.")
+		k8sExcludeNamespace      = fs.StringSlice("k8s-exclude-namespace", []string{}, "Experimental, optional: namespaces fluxd will not look at or apply resources to. Takes precedence over --k8s-allow-namespace.")
+		k8sExportKinds           = fs.StringSlice("k8s-export-kind", []string{}, "kinds of resource to export, besides workloads, given as Kind.group (e.g., Certificate.certmanager.k8s.io), Kind for the core group (e.g., ConfigMap), or *.group for every kind in the group. Custom resources may be included")
+		k8sCustomImages          = fs.StringSlice("k8s-custom-image", []string{}, "treat custom resources of a kind as workloads, with the image for a container at a path in them, given as Kind.group:container=path (e.g., Application.example.com:app=.spec.image), so their images can be released and automated. Paths may have fields and array indices, e.g., .spec.runners[0].image. May be repeated")
+		k8sWorkloadCache         = fs.Bool("k8s-workload-cache", true, "keep the workloads in the cluster in memory, up to date by watching the API server, rather than listing them every time they are needed")
+		k8sQPS                   = fs.Float32("k8s-qps", 50, "the most requests a second to make to the Kubernetes API server, on average")
+		k8sBurst                 = fs.Int("k8s-burst", 100, "the most requests to make to the Kubernetes API server in a burst, above --k8s-qps")
+		k8sRequestTimeout        = fs.Duration("k8s-request-timeout", time.Minute, "how long to wait for each request to the Kubernetes API server (other than watches) before giving up, so a slow API server can't hold up syncing; zero means wait indefinitely")
 		// SSH key generation
 		sshKeyBits   = optionalVar(fs, &ssh.KeyBitsValue{}, "ssh-keygen-bits", "-b argument to ssh-keygen (default unspecified)")
 		sshKeyType   = optionalVar(fs, &ssh.KeyTypeValue{}, "ssh-keygen-type", "-t argument to ssh-keygen (default unspecified)")
 		sshKeygenDir = fs.String("ssh-keygen-dir", "", "directory, ideally on a tmpfs volume, in which to generate new SSH keys when necessary")
+		// SSH host key checking
+		sshKnownHosts     = fs.StringSlice("ssh-known-hosts-file", []string{}, "known_hosts file to check the git host's key against (e.g., mounted from a ConfigMap), in addition to those in the image; may be repeated")
+		sshStrictHostKeys = fs.String("ssh-strict-host-key-checking", ssh.StrictHostKeyCheckingYes, "whether to refuse to connect to git hosts with unknown keys: 'yes', 'accept-new' (trust and record the key the first time a host is seen), or 'no' (insecure; don't check keys)")
+		sshKeyscan        = fs.Bool("ssh-keyscan", false, "if set and the git host from --git-url has no known key, fetch its key with ssh-keyscan at startup and trust it from then on; keys are recorded in known_hosts in --ssh-keygen-dir")
 
 		upstreamURL = fs.String("connect", "", "Connect to an upstream service e.g., Weave Cloud, at this base address")
 		token       = fs.String("token", "", "Authentication token for upstream service")
+		// self-hosted upstream services
+		upstreamWebsocketURL = fs.String("upstream-websocket-url", "", "connect to a self-hosted service at this websocket URL (ws:// or wss://), and serve the daemon's API to it over the connection, as with --connect")
+		upstreamEventsURL    = fs.String("upstream-events-url", "", "with --upstream-websocket-url, POST the daemon's events as JSON to this URL")
+		upstreamHeaders      = fs.StringSlice("upstream-header", nil, "with --upstream-websocket-url, a header to send when connecting and with events, given as 'Name: value' (e.g., for authentication); may be repeated")
+
+		dockerConfig = fs.String("docker-config", "", "path to a docker config to use for image registry credentials, including those from the credential helpers it names")
 
-		dockerConfig = fs.String("docker-config", "", "path to a docker config to use for image registry credentials")
+		// webhooks
+		webhookListenAddr = fs.String("webhook-listen", "", "listen address for receiving git and image registry push webhooks (e.g., :3031); webhooks are not accepted if this is not set")
+		webhookSecretFile = fs.String("webhook-secret-file", "", "path to a file containing the secret used to validate webhooks; if not set, webhooks are not authenticated")
 	)
+	fs.MarkDeprecated("k8s-namespace-whitelist", "changed to --k8s-allow-namespace, use that instead")
 
 	err := fs.Parse(os.Args[1:])
 	switch {
@@ -136,14 +294,28 @@ func main() {
 	// Logger component.
 	var logger log.Logger
 	{
-		logger = log.NewLogfmtLogger(os.Stderr)
-		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
-		logger = log.With(logger, "caller", log.DefaultCaller)
+		levels, err := logging.ParseLevels(*logLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --log-level: %s\n", err)
+			os.Exit(1)
+		}
+		logger, err = logging.NewLogger(os.Stderr, *logFormat, levels)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --log-format: %s\n", err)
+			os.Exit(1)
+		}
 	}
 	logger.Log("version", version)
 
 	// Argument validation
 
+	// This has to come before anything makes an HTTP request, since
+	// the proxy environment is only looked at once.
+	if err := transport.ConfigureProxy(*proxyURL); err != nil {
+		logger.Log("err", fmt.Sprintf("--proxy-url: %s", err))
+		os.Exit(1)
+	}
+
 	// Sort out values for the git tag and notes ref. There are
 	// running deployments that assume the defaults as given, so don't
 	// mess with those unless explicitly told.
@@ -157,10 +329,140 @@ func main() {
 		}
 	}
 
+	switch git.Submodules(*gitSubmodules) {
+	case git.SubmodulesOff, git.SubmodulesRecursive, git.SubmodulesShallow:
+	default:
+		logger.Log("err", fmt.Sprintf("--git-submodules must be one of 'recursive', 'shallow' or 'off', got %q", *gitSubmodules))
+		os.Exit(1)
+	}
+
+	gitTLS, err := git.ConfigureTLS(*gitTLSCAFile, *gitTLSInsecure)
+	if err != nil {
+		logger.Log("err", fmt.Sprintf("--git-tls-ca-file: %s", err))
+		os.Exit(1)
+	}
+	if *gitTLSInsecure {
+		logger.Log("warning", "not verifying the certificates of HTTPS git hosts (--git-tls-insecure-skip-verify)")
+	}
+	// The client for the git host's API, for commit statuses and pull
+	// requests, trusts the same certificates as git.
+	gitAPIClient := &http.Client{Timeout: 10 * time.Second}
+	if gitTLS != nil {
+		gitAPIClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: gitTLS,
+		}
+	}
+
 	if *gitSkipMessage == "" && *gitSkip {
 		*gitSkipMessage = defaultGitSkipMessage
 	}
 
+	pathSyncIntervals := map[string]time.Duration{}
+	for _, pathInterval := range *syncPathIntervals {
+		parts := strings.SplitN(pathInterval, "=", 2)
+		if len(parts) != 2 {
+			logger.Log("err", fmt.Sprintf("--sync-interval-path %q should be of the form path=duration", pathInterval))
+			os.Exit(1)
+		}
+		interval, err := time.ParseDuration(parts[1])
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("invalid duration in --sync-interval-path %q: %s", pathInterval, err))
+			os.Exit(1)
+		}
+		pathSyncIntervals[parts[0]] = interval
+	}
+
+	var defaultAutomationWindow *policy.Window
+	if *automationWindow != "" {
+		var err error
+		if defaultAutomationWindow, err = policy.ParseWindow(*automationWindow); err != nil {
+			logger.Log("err", fmt.Sprintf("--automation-window: %s", err))
+			os.Exit(1)
+		}
+	}
+
+	var compareURLTemplate *template.Template
+	if *automationCompareURL != "" {
+		var err error
+		if compareURLTemplate, err = update.ParseCompareURLTemplate(*automationCompareURL); err != nil {
+			logger.Log("err", fmt.Sprintf("invalid --automation-compare-url-template: %s", err))
+			os.Exit(1)
+		}
+	}
+
+	var vulnScanner vulnscan.Scanner
+	var vulnThreshold, vulnUnknown vulnscan.Severity
+	if *vulnScannerURL != "" {
+		var err error
+		if vulnScanner, err = vulnscan.New(*vulnScannerKind, *vulnScannerURL, &http.Client{Timeout: *vulnScannerTimeout}); err != nil {
+			logger.Log("err", fmt.Sprintf("--vuln-scanner-kind: %s", err))
+			os.Exit(1)
+		}
+		if vulnThreshold, err = vulnscan.ParseSeverity(*vulnMaxSeverity); err != nil {
+			logger.Log("err", fmt.Sprintf("--vuln-max-severity: %s", err))
+			os.Exit(1)
+		}
+		if vulnUnknown, err = vulnscan.ParseSeverity(*vulnUnknownSeverity); err != nil {
+			logger.Log("err", fmt.Sprintf("--vuln-unknown-severity: %s", err))
+			os.Exit(1)
+		}
+	}
+
+	var commitTemplates *daemon.CommitTemplates
+	if len(*gitCommitTemplates) > 0 || len(*gitCommitAuthors) > 0 {
+		commitTemplates = &daemon.CommitTemplates{
+			Messages: map[string]*template.Template{},
+			Authors:  map[string]string{},
+		}
+		for _, typeTemplate := range *gitCommitTemplates {
+			parts := strings.SplitN(typeTemplate, "=", 2)
+			if len(parts) != 2 {
+				logger.Log("err", fmt.Sprintf("--git-commit-template %q should be of the form type=template", typeTemplate))
+				os.Exit(1)
+			}
+			tmpl, err := daemon.ParseCommitTemplate(parts[0], parts[1])
+			if err != nil {
+				logger.Log("err", fmt.Sprintf("invalid --git-commit-template for %q: %s", parts[0], err))
+				os.Exit(1)
+			}
+			commitTemplates.Messages[parts[0]] = tmpl
+		}
+		for _, typeAuthor := range *gitCommitAuthors {
+			parts := strings.SplitN(typeAuthor, "=", 2)
+			if len(parts) != 2 {
+				logger.Log("err", fmt.Sprintf("--git-commit-author %q should be of the form type='Name <email>'", typeAuthor))
+				os.Exit(1)
+			}
+			commitTemplates.Authors[parts[0]] = parts[1]
+		}
+	}
+
+	switch *syncStateKind {
+	case syncStateGit, syncStateConfigMap, syncStateSecret:
+	default:
+		logger.Log("err", fmt.Sprintf("--sync-state must be one of %q, %q or %q", syncStateGit, syncStateConfigMap, syncStateSecret))
+		os.Exit(1)
+	}
+
+	switch *syncApplier {
+	case syncApplierKubectl, syncApplierClient, syncApplierServerSide:
+	default:
+		logger.Log("err", fmt.Sprintf("--sync-applier must be one of %q, %q or %q", syncApplierKubectl, syncApplierClient, syncApplierServerSide))
+		os.Exit(1)
+	}
+
+	if *gitTag != "" && *gitTagPatt != "" {
+		logger.Log("err", "only one of --git-tag and --git-tag-pattern may be given")
+		os.Exit(1)
+	}
+	if *gitTagPatt != "" {
+		if err := git.ValidTagPattern(*gitTagPatt); err != nil {
+			logger.Log("err", fmt.Sprintf("invalid --git-tag-pattern: %s", err))
+			os.Exit(1)
+		}
+	}
+
 	for _, path := range *gitPath {
 		if len(path) > 0 && path[0] == '/' {
 			logger.Log("err", "subdirectory given as --git-path should not have leading forward slash")
@@ -168,17 +470,78 @@ func main() {
 		}
 	}
 
+	if *gitImportGPG != "" {
+		keyfiles, err := gpg.ImportKeys(*gitImportGPG)
+		if err != nil {
+			logger.Log("error", fmt.Sprintf("failed to import GPG keys: %s", err.Error()))
+		}
+		if keyfiles != nil {
+			logger.Log("info", fmt.Sprintf("imported GPG keys: %s", strings.Join(keyfiles, ", ")))
+		}
+	}
+
 	if *sshKeygenDir == "" {
 		logger.Log("info", fmt.Sprintf("SSH keygen dir (--ssh-keygen-dir) not provided, so using the deploy key volume (--k8s-secret-volume-mount-path=%s); this may cause problems if the deploy key volume is mounted read-only", *k8sSecretVolumeMountPath))
 		*sshKeygenDir = *k8sSecretVolumeMountPath
 	}
 
+	switch *sshStrictHostKeys {
+	case ssh.StrictHostKeyCheckingYes, ssh.StrictHostKeyCheckingAcceptNew:
+	case ssh.StrictHostKeyCheckingNo:
+		logger.Log("warning", "SSH host key checking is turned off (--ssh-strict-host-key-checking=no); fluxd will trust any git host it connects to")
+	default:
+		logger.Log("err", fmt.Sprintf("--ssh-strict-host-key-checking must be one of 'yes', 'accept-new' or 'no', got %q", *sshStrictHostKeys))
+		os.Exit(1)
+	}
+
+	// If we've been told how to check host keys, make sure git (via
+	// ssh) does it that way.
+	{
+		var knownHostsFiles []string
+		if *sshKeyscan || *sshStrictHostKeys == ssh.StrictHostKeyCheckingAcceptNew {
+			// ssh records newly accepted keys in the first file
+			// given, so this has to be one that's writable.
+			knownHostsFiles = append(knownHostsFiles, filepath.Join(*sshKeygenDir, "known_hosts"))
+		}
+		knownHostsFiles = append(knownHostsFiles, *sshKnownHosts...)
+		if len(knownHostsFiles) > 0 {
+			// Giving known_hosts files replaces the usual per-user
+			// file, so keep that in the list.
+			knownHostsFiles = append(knownHostsFiles, sshUserKnownHosts)
+		}
+
+		if *sshKeyscan {
+			if host, port, ok := ssh.HostFromURL(*gitURL); ok {
+				known, err := ssh.IsKnownHost(append([]string{sshGlobalKnownHosts}, knownHostsFiles...), host, port)
+				if err != nil {
+					logger.Log("err", err)
+					os.Exit(1)
+				}
+				if !known {
+					logger.Log("info", "no known key for git host, fetching with ssh-keyscan", "host", host, "port", port)
+					if err := ssh.KeyScan(knownHostsFiles[0], host, port); err != nil {
+						logger.Log("warning", "could not fetch git host key", "err", err)
+					}
+				}
+			}
+		}
+
+		if len(knownHostsFiles) > 0 || fs.Changed("ssh-strict-host-key-checking") {
+			os.Setenv("GIT_SSH_COMMAND", ssh.Command(knownHostsFiles, *sshStrictHostKeys))
+		}
+	}
+
 	// Cluster component.
 	var clusterVersion string
 	var sshKeyRing ssh.KeyRing
 	var k8s cluster.Cluster
 	var imageCreds func() registry.ImageCreds
+	var watchImageCredentials func(stop <-chan struct{}, changed func())
+	var startWorkloadCache func(stop <-chan struct{})
+	var usedByAutomated func(image.Name) bool
 	var k8sManifests cluster.Manifests
+	var syncState fluxsync.State
+	var claims fluxsync.Claims
 	{
 		restClientConfig, err := rest.InClusterConfig()
 		if err != nil {
@@ -186,8 +549,9 @@ func main() {
 			os.Exit(1)
 		}
 
-		restClientConfig.QPS = 50.0
-		restClientConfig.Burst = 100
+		restClientConfig.QPS = *k8sQPS
+		restClientConfig.Burst = *k8sBurst
+		timeout.WithRequestTimeout(restClientConfig, *k8sRequestTimeout)
 
 		clientset, err := k8sclient.NewForConfig(restClientConfig)
 		if err != nil {
@@ -201,6 +565,30 @@ func main() {
 			os.Exit(1)
 		}
 
+		dynamicClientset, err := dynamic.NewForConfig(restClientConfig)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+
+		exportKinds, err := kubernetes.ParseExportKinds(*k8sExportKinds)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+
+		for _, s := range *k8sCustomImages {
+			customImage, err := kresource.ParseCustomImage(s)
+			if err == nil {
+				err = kubernetes.RegisterCustomImage(customImage)
+			}
+			if err != nil {
+				logger.Log("err", fmt.Sprintf("invalid --k8s-custom-image: %s", err))
+				os.Exit(1)
+			}
+			logger.Log("custom-image", s)
+		}
+
 		serverVersion, err := clientset.ServerVersion()
 		if err != nil {
 			logger.Log("err", err)
@@ -235,20 +623,85 @@ func main() {
 		logger.Log("identity.pub", strings.TrimSpace(publicKey.Key))
 		logger.Log("host", restClientConfig.Host, "version", clusterVersion)
 
-		kubectl := *kubernetesKubectl
-		if kubectl == "" {
-			kubectl, err = exec.LookPath("kubectl")
-		} else {
-			_, err = os.Stat(kubectl)
+		var applier kubernetes.Applier
+		switch *syncApplier {
+		case syncApplierKubectl:
+			kubectl := *kubernetesKubectl
+			if kubectl == "" {
+				kubectl, err = exec.LookPath("kubectl")
+			} else {
+				_, err = os.Stat(kubectl)
+			}
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			logger.Log("kubectl", kubectl)
+			kubectlApplier := kubernetes.NewKubectl(kubectl, restClientConfig)
+			kubectlApplier.ServerDryRun = *syncValidate
+			kubectlApplier.RequestTimeout = *k8sRequestTimeout
+			applier = kubectlApplier
+		default:
+			clientApplier := kubernetes.NewClientApplier(clientset.Discovery(), dynamicClientset)
+			clientApplier.ServerDryRun = *syncValidate
+			clientApplier.ServerSideApply = *syncApplier == syncApplierServerSide
+			applier = clientApplier
+			logger.Log("applier", *syncApplier)
 		}
-		if err != nil {
-			logger.Log("err", err)
-			os.Exit(1)
+
+		switch *syncStateKind {
+		case syncStateConfigMap:
+			syncState = kubernetes.NewConfigMapSyncState(clientset, string(namespace), *gitSyncTag)
+		case syncStateSecret:
+			syncState = kubernetes.NewSecretSyncState(clientset, string(namespace), *gitSyncTag)
 		}
-		logger.Log("kubectl", kubectl)
 
-		kubectlApplier := kubernetes.NewKubectl(kubectl, restClientConfig)
-		k8sInst := kubernetes.NewCluster(clientset, ifclientset, kubectlApplier, sshKeyRing, logger, *k8sNamespaceWhitelist)
+		if *syncShard != "" {
+			// A claim outlasts a few missed syncs, but not a shard
+			// that's gone for good
+			claimsNamespace, claimsName := string(namespace), *syncShardConfigMap
+			if parts := strings.SplitN(claimsName, "/", 2); len(parts) == 2 {
+				claimsNamespace, claimsName = parts[0], parts[1]
+			}
+			if claims, err = kubernetes.NewShardClaims(clientset, claimsNamespace, claimsName, *syncShard, 3**syncInterval); err != nil {
+				logger.Log("err", fmt.Sprintf("--sync-shard: %s", err))
+				os.Exit(1)
+			}
+			logger.Log("sync-shard", *syncShard, "configmap", claimsNamespace+"/"+claimsName)
+		}
+
+		var syncSelector labels.Selector
+		if *syncLabelSelector != "" {
+			syncSelector, err = labels.Parse(*syncLabelSelector)
+			if err != nil {
+				logger.Log("err", fmt.Sprintf("invalid --sync-label-selector: %s", err))
+				os.Exit(1)
+			}
+			logger.Log("sync-label-selector", syncSelector.String())
+		}
+
+		k8sInst := kubernetes.NewCluster(clientset, ifclientset, dynamicClientset, applier, sshKeyRing, logger, kubernetes.ClusterOptions{
+			AllowedNamespaces:  append(*k8sAllowNamespace, *k8sNamespaceWhitelist...),
+			ExcludedNamespaces: *k8sExcludeNamespace,
+			SyncSelector:       syncSelector,
+			ExportKinds:        exportKinds,
+		})
+		for _, f := range *syncIgnoreFields {
+			field, err := kubernetes.ParseIgnoredField(f)
+			if err != nil {
+				logger.Log("err", fmt.Sprintf("invalid --sync-ignore-field %q: %s", f, err))
+				os.Exit(1)
+			}
+			k8sInst.IgnoreFields = append(k8sInst.IgnoreFields, field)
+		}
+		for _, s := range *syncSubstituteFrom {
+			src, err := kubernetes.ParseVarSource(s, string(namespace))
+			if err != nil {
+				logger.Log("err", fmt.Sprintf("invalid --sync-substitute-from %q: %s", s, err))
+				os.Exit(1)
+			}
+			k8sInst.SubstituteFrom = append(k8sInst.SubstituteFrom, src)
+		}
 
 		if err := k8sInst.Ping(); err != nil {
 			logger.Log("ping", err)
@@ -265,10 +718,57 @@ func main() {
 				imageCreds = credsWithDefaults
 			}
 		}
+		// Filter the images first, so no credentials are fetched
+		// for images that won't be scanned
+		imageCreds = registry.ImageCredsWithFilter(imageCreds, registry.ImageFilter{
+			Include: *registryIncludeImages,
+			Exclude: *registryExcludeImages,
+		})
+		var providers []registry.CredentialsProvider
+		if *dockerConfig != "" {
+			// Credential helpers named in the Docker config come
+			// before the platforms, as they would for `docker`
+			providers = append(providers, registry.NewCredentialHelperProvider(log.With(logger, "component", "credential-helper"), *dockerConfig))
+		}
+		if *registryOffline && len(*registryProviders) > 0 {
+			// These reach out to the cloud platforms' APIs
+			logger.Log("info", "not using --registry-credential-provider, since --registry-offline is set")
+			*registryProviders = nil
+		}
+		for _, name := range *registryProviders {
+			providerLogger := log.With(logger, "component", name)
+			switch name {
+			case "aws":
+				providers = append(providers, registry.NewECRProvider(providerLogger, registry.AWSRegistryConfig{
+					Regions:    *registryAWSRegions,
+					AccountIDs: *registryAWSAccountIDs,
+				}))
+			case "gcp":
+				providers = append(providers, registry.NewGCPProvider(providerLogger))
+			case "azure":
+				providers = append(providers, registry.NewACRProvider(providerLogger))
+			default:
+				logger.Log("err", fmt.Sprintf("unknown --registry-credential-provider %q; expected one of aws, gcp, azure", name))
+				os.Exit(1)
+			}
+		}
+		imageCreds = registry.ImageCredsWithProviders(imageCreds, providers...)
+		watchImageCredentials = k8sInst.WatchImageCredentials
+		if *k8sWorkloadCache {
+			startWorkloadCache = k8sInst.StartWorkloadCache
+		}
+		usedByAutomated = k8sInst.UsedByAutomated
 		k8s = k8sInst
 		// There is only one way we currently interpret a repo of
 		// files as manifests, and that's as Kubernetes yamels.
-		k8sManifests = &kubernetes.Manifests{}
+		manifests := &kubernetes.Manifests{}
+		if *manifestJsonnet {
+			manifests.Jsonnet = &kresource.Jsonnet{Exe: *manifestJsonnetExe, ImportPaths: *manifestJsonnetPath}
+		}
+		k8sManifests = manifests
+		if *manifestGeneration {
+			k8sManifests = cluster.NewConfigAware(k8sManifests)
+		}
 	}
 
 	// Registry components
@@ -277,34 +777,119 @@ func main() {
 	{
 		// Cache client, for use by registry and cache warmer
 		var cacheClient cache.Client
-		memcacheClient := registryMemcache.NewMemcacheClient(registryMemcache.MemcacheConfig{
-			Host:           *memcachedHostname,
-			Service:        *memcachedService,
-			Expiry:         *registryCacheExpiry,
-			Timeout:        *memcachedTimeout,
-			UpdateInterval: 1 * time.Minute,
-			Logger:         log.With(logger, "component", "memcached"),
-			MaxIdleConns:   *registryBurst,
-		})
-		defer memcacheClient.Stop()
-		cacheClient = cache.InstrumentClient(memcacheClient)
+		switch *registryCacheBackend {
+		case registryCacheMemcached:
+			memcacheClient := registryMemcache.NewMemcacheClient(registryMemcache.MemcacheConfig{
+				Host:           *memcachedHostname,
+				Service:        *memcachedService,
+				Expiry:         *registryCacheExpiry,
+				Timeout:        *memcachedTimeout,
+				UpdateInterval: 1 * time.Minute,
+				Logger:         log.With(logger, "component", "memcached"),
+				MaxIdleConns:   *registryBurst,
+			})
+			defer memcacheClient.Stop()
+			cacheClient = memcacheClient
+		case registryCacheRedis:
+			var password string
+			if *redisPasswordFile != "" {
+				bs, err := ioutil.ReadFile(*redisPasswordFile)
+				if err != nil {
+					logger.Log("err", errors.Wrap(err, "reading --redis-password-file"))
+					os.Exit(1)
+				}
+				password = strings.TrimSpace(string(bs))
+			}
+			redisClient := registryRedis.NewRedisClient(registryRedis.RedisConfig{
+				Addr:         *redisAddress,
+				Password:     password,
+				DB:           *redisDB,
+				Expiry:       *registryCacheExpiry,
+				Timeout:      *redisTimeout,
+				Logger:       log.With(logger, "component", "redis"),
+				MaxIdleConns: *registryBurst,
+			})
+			defer redisClient.Stop()
+			cacheClient = redisClient
+		case registryCacheMemory:
+			memoryClient := registryMemory.NewMemoryClient(registryMemory.MemoryConfig{
+				Expiry:       *registryCacheExpiry,
+				MaxBytes:     *registryCacheMaxSize << 20,
+				SnapshotFile: *registryCacheSnapshot,
+				Logger:       log.With(logger, "component", "cache"),
+			})
+			defer memoryClient.Stop()
+			cacheClient = memoryClient
+		default:
+			logger.Log("err", fmt.Sprintf("unknown --registry-cache %q; expected one of %s, %s, %s", *registryCacheBackend, registryCacheMemcached, registryCacheRedis, registryCacheMemory))
+			os.Exit(1)
+		}
+		cacheClient = cache.InstrumentClient(cacheClient)
 
 		cacheRegistry = &cache.Cache{
-			Reader: cacheClient,
+			Reader:     cacheClient,
+			StaleAfter: *registryStaleAfter,
 		}
 		cacheRegistry = registry.NewInstrumentedRegistry(cacheRegistry)
 
 		// Remote client, for warmer to refresh entries
 		registryLogger := log.With(logger, "component", "registry")
+		hostLimits := map[string]registryMiddleware.HostLimit{}
+		for _, hostLimit := range *registryHostLimits {
+			host, limit, err := registryMiddleware.ParseHostLimit(hostLimit)
+			if err != nil {
+				logger.Log("err", errors.Wrap(err, "parsing --registry-host-limit"))
+				os.Exit(1)
+			}
+			hostLimits[host] = limit
+		}
 		registryLimits := &registryMiddleware.RateLimiters{
-			RPS:   *registryRPS,
-			Burst: *registryBurst,
+			RPS:        *registryRPS,
+			Burst:      *registryBurst,
+			HostLimits: hostLimits,
+			Logger:     log.With(logger, "component", "ratelimiter"),
+		}
+		var platforms []registry.Platform
+		for _, p := range *registryPlatforms {
+			platform, err := registry.ParsePlatform(p)
+			if err != nil {
+				logger.Log("err", errors.Wrap(err, "parsing --registry-platform"))
+				os.Exit(1)
+			}
+			platforms = append(platforms, platform)
+		}
+		var requiredPlatforms []registry.Platform
+		for _, p := range *registryRequired {
+			platform, err := registry.ParsePlatform(p)
+			if err != nil {
+				logger.Log("err", errors.Wrap(err, "parsing --registry-require-platform"))
+				os.Exit(1)
+			}
+			requiredPlatforms = append(requiredPlatforms, platform)
+		}
+		// Unless told otherwise, get the metadata for the platforms
+		// that are required
+		if len(requiredPlatforms) > 0 && !fs.Changed("registry-platform") {
+			platforms = requiredPlatforms
+		}
+		var mirrors registry.Mirrors
+		for _, m := range *registryMirrors {
+			mirror, err := registry.ParseMirror(m)
+			if err != nil {
+				logger.Log("err", errors.Wrap(err, "parsing --registry-mirror"))
+				os.Exit(1)
+			}
+			mirrors = append(mirrors, mirror)
 		}
 		remoteFactory := &registry.RemoteClientFactory{
-			Logger:        registryLogger,
-			Limiters:      registryLimits,
-			Trace:         *registryTrace,
-			InsecureHosts: *registryInsecure,
+			Logger:            registryLogger,
+			Limiters:          registryLimits,
+			Trace:             *registryTrace,
+			InsecureHosts:     *registryInsecure,
+			Mirrors:           mirrors,
+			Offline:           *registryOffline,
+			Platforms:         platforms,
+			RequiredPlatforms: requiredPlatforms,
 		}
 
 		// Warmer
@@ -314,6 +899,9 @@ func main() {
 			logger.Log("err", err)
 			os.Exit(1)
 		}
+		cacheWarmer.Workers = *registryWorkers
+		cacheWarmer.HostWorkers = *registryHostWorkers
+		cacheWarmer.Prioritise = usedByAutomated
 	}
 
 	// Mechanical components.
@@ -341,6 +929,18 @@ func main() {
 		shutdownWg.Wait()
 	}()
 
+	if *tracingZipkinURL != "" {
+		exporter, err := tracing.NewZipkinExporter(*tracingZipkinURL, "fluxd", &http.Client{Timeout: 10 * time.Second}, log.With(logger, "component", "tracing"))
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		tracing.SetExporter(exporter, *tracingSampleRate)
+		shutdownWg.Add(1)
+		go exporter.Loop(shutdown, shutdownWg)
+		logger.Log("tracing", "zipkin", "sample-rate", *tracingSampleRate)
+	}
+
 	// Checkpoint: we want to include the fact of whether the daemon
 	// was given a Git repo it could clone; but the expected scenario
 	// is that it will have been set up already, and we don't want to
@@ -357,15 +957,31 @@ func main() {
 	gitConfig := git.Config{
 		Paths:       *gitPath,
 		Branch:      *gitBranch,
+		Tag:         *gitTag,
+		TagPattern:  *gitTagPatt,
 		SyncTag:     *gitSyncTag,
 		NotesRef:    *gitNotesRef,
 		UserName:    *gitUser,
 		UserEmail:   *gitEmail,
 		SetAuthor:   *gitSetAuthor,
 		SkipMessage: *gitSkipMessage,
+		SigningKey:  *gitSigningKey,
 	}
 
-	repo := git.NewRepo(gitRemote, git.PollInterval(*gitPollInterval))
+	repoOpts := []git.Option{git.PollInterval(*gitPollInterval)}
+	if *gitReadOnly {
+		repoOpts = append(repoOpts, git.ReadOnly)
+	}
+	if *gitCloneDepth > 0 {
+		repoOpts = append(repoOpts, git.CloneDepth(*gitCloneDepth))
+	}
+	if *gitSparse {
+		repoOpts = append(repoOpts, git.SparseCheckout)
+	}
+	if *gitSubmodules != string(git.SubmodulesOff) {
+		repoOpts = append(repoOpts, git.Submodules(*gitSubmodules))
+	}
+	repo := git.NewRepo(gitRemote, repoOpts...)
 	{
 		shutdownWg.Add(1)
 		go func() {
@@ -378,11 +994,15 @@ func main() {
 
 	logger.Log(
 		"url", *gitURL,
+		"tag", *gitTag,
+		"tag-pattern", *gitTagPatt,
 		"user", *gitUser,
 		"email", *gitEmail,
 		"sync-tag", *gitSyncTag,
 		"notes-ref", *gitNotesRef,
 		"set-author", *gitSetAuthor,
+		"signing-key", *gitSigningKey,
+		"readonly", *gitReadOnly,
 	)
 
 	var jobs *job.Queue
@@ -390,49 +1010,225 @@ func main() {
 		jobs = job.NewQueue(shutdown, shutdownWg)
 	}
 
+	if syncState == nil && *gitReadOnly {
+		// We can't push a tag, so fall back to remembering the
+		// revision; this means everything is treated as new on
+		// restart.
+		logger.Log("warning", fmt.Sprintf("--git-readonly given with --sync-state=%s; the revision synced will only be kept in memory", syncStateGit))
+		syncState = &fluxsync.InMemoryState{}
+	}
+
 	daemon := &daemon.Daemon{
-		V:              version,
-		Cluster:        k8s,
-		Manifests:      k8sManifests,
-		Registry:       cacheRegistry,
-		ImageRefresh:   make(chan image.Name, 100), // size chosen by fair dice roll
-		Repo:           repo,
-		GitConfig:      gitConfig,
-		Jobs:           jobs,
-		JobStatusCache: &job.StatusCache{Size: 100},
-		Logger:         log.With(logger, "component", "daemon"),
+		V:               version,
+		Cluster:         k8s,
+		Manifests:       k8sManifests,
+		Registry:        cacheRegistry,
+		ImageRefresh:    make(chan image.Name, 100), // size chosen by fair dice roll
+		Repo:            repo,
+		GitConfig:       gitConfig,
+		Jobs:            jobs,
+		JobStatusCache:  &job.StatusCache{Size: 100},
+		SyncState:       syncState,
+		Claims:          claims,
+		CommitTemplates: commitTemplates,
+		ClusterID:       *clusterID,
+		Logger:          log.With(logger, "component", "daemon"),
 		LoopVars: &daemon.LoopVars{
-			SyncInterval:         *syncInterval,
-			RegistryPollInterval: *registryPollInterval,
+			SyncInterval:           *syncInterval,
+			RegistryPollInterval:   *registryPollInterval,
+			SyncPathsInOrder:       *syncPathsInOrder,
+			PathSyncIntervals:      pathSyncIntervals,
+			ImageUpdateBatchWindow: *automationBatchWindow,
+			RequireApproval:        *automationApproval,
+			AutomationWindow:       defaultAutomationWindow,
+			CompareURLTemplate:     compareURLTemplate,
+			RollbackErrorThreshold: *syncRollbackErrors,
+
+			AutomationRollbackTimeout: *automationRollback,
 		},
 	}
 
+	if *commitStatusProvider != "" {
+		statusConfig := commitstatus.Config{
+			Provider: *commitStatusProvider,
+			APIURL:   *commitStatusAPIURL,
+			Repo:     *commitStatusRepo,
+		}
+		if statusConfig.Repo == "" {
+			repoPath, err := commitstatus.RepoFromURL(*gitURL)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			statusConfig.Repo = repoPath
+		}
+		if *commitStatusTokenFile != "" {
+			bs, err := ioutil.ReadFile(*commitStatusTokenFile)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			statusConfig.Token = strings.TrimSpace(string(bs))
+		}
+		poster, err := commitstatus.New(statusConfig, gitAPIClient)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		daemon.CommitStatus = poster
+		logger.Log("commit-status", statusConfig.Provider, "repo", statusConfig.Repo)
+	}
+
+	if *pullRequestProvider != "" {
+		prConfig := pullrequest.Config{
+			Provider: *pullRequestProvider,
+			APIURL:   *pullRequestAPIURL,
+			Repo:     *pullRequestRepo,
+		}
+		if prConfig.Repo == "" {
+			repoPath, err := commitstatus.RepoFromURL(*gitURL)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			prConfig.Repo = repoPath
+		}
+		if *pullRequestTokenFile != "" {
+			bs, err := ioutil.ReadFile(*pullRequestTokenFile)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			prConfig.Token = strings.TrimSpace(string(bs))
+		}
+		opener, err := pullrequest.New(prConfig, gitAPIClient)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		daemon.PullRequests = opener
+		logger.Log("pull-requests", prConfig.Provider, "repo", prConfig.Repo, "base", *gitBranch)
+	}
+
 	{
-		// Connect to fluxsvc if given an upstream address
-		if *upstreamURL != "" {
-			upstreamLogger := log.With(logger, "component", "upstream")
+		var sinks []audit.Sink
+		for _, spec := range *auditLogSinks {
+			sink, err := audit.ParseSink(spec, &http.Client{Timeout: 10 * time.Second})
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			sinks = append(sinks, sink)
+		}
+		daemon.Audit = audit.New(audit.DefaultRetain, sinks...)
+		if len(sinks) > 0 {
+			logger.Log("audit-log", strings.Join(*auditLogSinks, ","))
+		}
+	}
+
+	if len(*notifySlackURLs)+len(*notifyMSTeamsURLs)+len(*notifyWebhookURLs) > 0 {
+		notifyConfig := notify.Config{
+			Kinds:     *notifyEvents,
+			Templates: map[string]*template.Template{},
+		}
+		client := &http.Client{Timeout: 10 * time.Second}
+		for _, targets := range []struct {
+			kind string
+			urls []string
+		}{
+			{notify.TargetSlack, *notifySlackURLs},
+			{notify.TargetMSTeams, *notifyMSTeamsURLs},
+			{notify.TargetWebhook, *notifyWebhookURLs},
+		} {
+			for _, u := range targets.urls {
+				target, err := notify.NewTarget(targets.kind, u, client)
+				if err != nil {
+					logger.Log("err", err)
+					os.Exit(1)
+				}
+				notifyConfig.Targets = append(notifyConfig.Targets, target)
+			}
+		}
+		for _, kindTemplate := range *notifyTemplates {
+			parts := strings.SplitN(kindTemplate, "=", 2)
+			if len(parts) != 2 {
+				logger.Log("err", fmt.Sprintf("--notify-template %q should be of the form kind=template", kindTemplate))
+				os.Exit(1)
+			}
+			tmpl, err := notify.ParseTemplate(parts[0], parts[1])
+			if err != nil {
+				logger.Log("err", fmt.Sprintf("invalid --notify-template for %q: %s", parts[0], err))
+				os.Exit(1)
+			}
+			notifyConfig.Templates[parts[0]] = tmpl
+		}
+		notifier, err := notify.New(notifyConfig, log.With(logger, "component", "notify"))
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		daemon.Notifier = notifier
+		shutdownWg.Add(1)
+		go notifier.Loop(shutdown, shutdownWg)
+		logger.Log("notify", len(notifyConfig.Targets), "events", strings.Join(*notifyEvents, ","))
+	}
+
+	if *releaseGateURL != "" {
+		daemon.ReleaseGate = releasegate.NewWebhook(*releaseGateURL, &http.Client{Timeout: *releaseGateTimeout})
+		logger.Log("release-gate", *releaseGateURL)
+	}
+
+	if vulnScanner != nil {
+		daemon.VulnScanner = vulnScanner
+		daemon.VulnThreshold = vulnThreshold
+		daemon.VulnUnknown = vulnUnknown
+		logger.Log("vuln-scanner", *vulnScannerURL, "max-severity", vulnThreshold, "unknown-severity", vulnUnknown)
+	}
+
+	{
+		// Connect to fluxsvc, or a self-hosted service, if given an
+		// upstream address
+		var upstream daemonhttp.Upstream = daemonhttp.Standalone{}
+		upstreamLogger := log.With(logger, "component", "upstream")
+		upstreamServer := remote.NewErrorLoggingUpstreamServer(daemon, upstreamLogger)
+		ua := fmt.Sprintf("fluxd/%v", version)
+		var err error
+		switch {
+		case *upstreamURL != "" && *upstreamWebsocketURL != "":
+			logger.Log("err", "--connect and --upstream-websocket-url can't both be given")
+			os.Exit(1)
+		case *upstreamURL != "":
 			upstreamLogger.Log("URL", *upstreamURL)
-			upstream, err := daemonhttp.NewUpstream(
+			upstream, err = daemonhttp.NewUpstream(
 				&http.Client{Timeout: 10 * time.Second},
-				fmt.Sprintf("fluxd/%v", version),
+				ua,
 				client.Token(*token),
 				transport.NewUpstreamRouter(),
 				*upstreamURL,
-				remote.NewErrorLoggingUpstreamServer(daemon, upstreamLogger),
+				upstreamServer,
 				upstreamLogger,
 			)
-			if err != nil {
-				logger.Log("err", err)
-				os.Exit(1)
+		case *upstreamWebsocketURL != "":
+			upstreamLogger.Log("URL", *upstreamWebsocketURL, "events", *upstreamEventsURL)
+			var config daemonhttp.WebsocketConfig
+			config, err = daemonhttp.ParseWebsocketConfig(*upstreamWebsocketURL, *upstreamEventsURL, *upstreamHeaders)
+			if err == nil {
+				upstream, err = daemonhttp.NewWebsocketUpstream(&http.Client{Timeout: 10 * time.Second}, ua, config, upstreamServer, upstreamLogger)
 			}
-			daemon.EventWriter = upstream
-			go func() {
-				<-shutdown
-				upstream.Close()
-			}()
-		} else {
+		default:
 			logger.Log("upstream", "no upstream URL given")
 		}
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		if _, standalone := upstream.(daemonhttp.Standalone); !standalone {
+			daemon.EventWriter = upstream
+		}
+		go func() {
+			<-shutdown
+			upstream.Close()
+		}()
 	}
 
 	shutdownWg.Add(1)
@@ -442,15 +1238,102 @@ func main() {
 	cacheWarmer.Priority = daemon.ImageRefresh
 	shutdownWg.Add(1)
 	go cacheWarmer.Loop(log.With(logger, "component", "warmer"), shutdown, shutdownWg, imageCreds)
+	watchImageCredentials(shutdown, cacheWarmer.RefreshCredentials)
+	if startWorkloadCache != nil {
+		startWorkloadCache(shutdown)
+	}
+
+	var apiAuth daemonhttp.Auth
+	if *apiTokensFile != "" {
+		tokens, err := daemonhttp.NewTokenFile(*apiTokensFile)
+		if err != nil {
+			logger.Log("err", errors.Wrap(err, "reading --api-tokens-file"))
+			os.Exit(1)
+		}
+		apiAuth.Tokens = tokens
+	}
+	var listenTLS *tls.Config
+	if *listenTLSCert != "" || *listenTLSKey != "" || *listenTLSClientCA != "" {
+		if *listenTLSCert == "" || *listenTLSKey == "" {
+			logger.Log("err", "--listen-tls-cert and --listen-tls-key must both be given, including when --listen-tls-client-ca is")
+			os.Exit(1)
+		}
+		var err error
+		if listenTLS, err = daemonhttp.ServerTLSConfig(*listenTLSCert, *listenTLSKey, *listenTLSClientCA); err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		apiAuth.RequireClientCert = *listenTLSClientCA != ""
+	}
+	var apiServer api.Server = daemon
+	if *apiAuthzFile != "" {
+		if apiAuth.Tokens == nil && !apiAuth.RequireClientCert {
+			logger.Log("err", "--api-authorization-file needs callers to be identified, by --api-tokens-file or --listen-tls-client-ca")
+			os.Exit(1)
+		}
+		authzPolicy, err := authz.LoadPolicy(*apiAuthzFile)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		apiServer = authz.NewServer(daemon, authzPolicy)
+	}
 
 	go func() {
 		mux := http.DefaultServeMux
-		mux.Handle("/metrics", promhttp.Handler())
-		handler := daemonhttp.NewHandler(daemon, daemonhttp.NewRouter())
-		mux.Handle("/api/flux/", http.StripPrefix("/api/flux", handler))
-		logger.Log("addr", *listenAddr)
+		if *clusterID != "" {
+			mux.Handle("/metrics", promhttp.HandlerFor(fluxmetrics.WithConstLabel(prometheus.DefaultGatherer, "cluster_id", *clusterID), promhttp.HandlerOpts{}))
+		} else {
+			mux.Handle("/metrics", promhttp.Handler())
+		}
+		mux.Handle("/readyz", daemonhttp.ReadinessHandler(daemon))
+		handler := daemonhttp.NewHandler(apiServer, daemonhttp.NewRouter())
+		mux.Handle("/api/flux/", tracing.HTTPHandler(http.StripPrefix("/api/flux", apiAuth.Wrap(handler))))
+		logger.Log("addr", *listenAddr, "tls", listenTLS != nil, "api-tokens", apiAuth.Tokens != nil, "client-certs", apiAuth.RequireClientCert, "authorization", *apiAuthzFile != "")
+		if listenTLS != nil {
+			server := &http.Server{Addr: *listenAddr, Handler: mux, TLSConfig: listenTLS}
+			errc <- server.ListenAndServeTLS("", "")
+			return
+		}
 		errc <- http.ListenAndServe(*listenAddr, mux)
 	}()
 
+	if *grpcListenAddr != "" {
+		var opts []grpc.ServerOption
+		if listenTLS != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(listenTLS)))
+		}
+		grpcServer := daemongrpc.NewGRPCServer(apiServer, apiAuth, opts...)
+		go func() {
+			listener, err := net.Listen("tcp", *grpcListenAddr)
+			if err != nil {
+				errc <- err
+				return
+			}
+			logger.Log("grpc-addr", *grpcListenAddr)
+			errc <- grpcServer.Serve(listener)
+		}()
+	}
+
+	if *webhookListenAddr != "" {
+		webhookLogger := log.With(logger, "component", "webhook")
+		var secret []byte
+		if *webhookSecretFile != "" {
+			bs, err := ioutil.ReadFile(*webhookSecretFile)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			secret = []byte(strings.TrimSpace(string(bs)))
+		} else {
+			webhookLogger.Log("warning", "no --webhook-secret-file given; webhooks will not be authenticated")
+		}
+		receiver := daemonhttp.NewWebhookReceiver(daemon, secret, *gitURL, *gitBranch, webhookLogger)
+		go func() {
+			webhookLogger.Log("addr", *webhookListenAddr)
+			errc <- http.ListenAndServe(*webhookListenAddr, receiver.Handler())
+		}()
+	}
+
 	// Fall off the end, into the waiting procedure.
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -11,20 +12,27 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/weaveworks/flux/checkpoint"
+	"github.com/weaveworks/flux/cluster/kubernetes/timeout"
 	"github.com/weaveworks/flux/git"
+	transport "github.com/weaveworks/flux/http"
 	clientset "github.com/weaveworks/flux/integrations/client/clientset/versioned"
 	ifinformers "github.com/weaveworks/flux/integrations/client/informers/externalversions"
+	ifv1alpha2 "github.com/weaveworks/flux/integrations/client/informers/externalversions/helm.integrations.flux.weave.works/v1alpha2"
 	fluxhelm "github.com/weaveworks/flux/integrations/helm"
 	helmop "github.com/weaveworks/flux/integrations/helm"
 	"github.com/weaveworks/flux/integrations/helm/chartsync"
 	"github.com/weaveworks/flux/integrations/helm/operator"
 	"github.com/weaveworks/flux/integrations/helm/release"
 	"github.com/weaveworks/flux/integrations/helm/status"
+	"github.com/weaveworks/flux/logging"
+	"github.com/weaveworks/flux/tracing"
 )
 
 var (
@@ -34,9 +42,15 @@ var (
 	kubectl string
 
 	versionFlag *bool
+	logFormat   *string
+	logLevel    *string
 
-	kubeconfig *string
-	master     *string
+	kubeconfig        *string
+	master            *string
+	k8sQPS            *float32
+	k8sBurst          *int
+	k8sRequestTimeout *time.Duration
+	k8sAllowNamespace *[]string
 
 	tillerIP        *string
 	tillerPort      *string
@@ -50,18 +64,31 @@ var (
 
 	chartsSyncInterval *time.Duration
 	chartsSyncTimeout  *time.Duration
+	chartsDiscovery    *bool
 	logReleaseDiffs    *bool
 
+	releaseForceDelete  *time.Duration
+	purgeFailedInstalls *bool
+
 	gitURL          *string
 	gitBranch       *string
 	gitChartsPath   *string
 	gitPollInterval *time.Duration
+	gitSubmodules   *string
+	gitTLSCAFile    *string
+	gitTLSInsecure  *bool
+
+	proxyURL *string
 
 	queueWorkerCount *int
 
+	tracingZipkinURL  *string
+	tracingSampleRate *float64
+
 	name       *string
 	listenAddr *string
 	gcInterval *time.Duration
+	clusterID  *string
 )
 
 const (
@@ -85,9 +112,17 @@ func init() {
 	}
 
 	versionFlag = fs.Bool("version", false, "Print version and exit")
+	logFormat = fs.String("log-format", logging.FormatLogfmt, "format of log lines: 'logfmt' or 'json'")
+	logLevel = fs.String("log-level", "info", "least important level of log lines to write (debug, info, warn or error), optionally with levels for components, e.g., 'warn,helm=debug'")
+	listenAddr = fs.StringP("listen", "l", ":3030", "listen address where /metrics, and chart sync metrics at /metrics/charts, will be served")
+	clusterID = fs.String("cluster-id", "", "if set, a name for the cluster the operator runs in, with which the resources it releases are annotated (as flux.weave.works/cluster-id), alongside the FluxHelmRelease they came from")
 
 	kubeconfig = fs.String("kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	master = fs.String("master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	k8sQPS = fs.Float32("k8s-qps", rest.DefaultQPS, "the most requests a second to make to the Kubernetes API server, on average")
+	k8sBurst = fs.Int("k8s-burst", rest.DefaultBurst, "the most requests to make to the Kubernetes API server in a burst, above --k8s-qps")
+	k8sAllowNamespace = fs.StringSlice("allow-namespace", nil, "if set, only look at FluxHelmReleases in (and release charts to) these namespaces, which lets the operator run without permissions across the cluster; all namespaces are looked at otherwise")
+	k8sRequestTimeout = fs.Duration("k8s-request-timeout", time.Minute, "how long to wait for each request to the Kubernetes API server (other than watches) before giving up; zero means wait indefinitely")
 
 	tillerIP = fs.String("tiller-ip", "", "Tiller IP address. Only required if out-of-cluster.")
 	tillerPort = fs.String("tiller-port", "", "Tiller port.")
@@ -101,14 +136,27 @@ func init() {
 
 	chartsSyncInterval = fs.Duration("charts-sync-interval", 3*time.Minute, "Interval at which to check for changed charts")
 	chartsSyncTimeout = fs.Duration("charts-sync-timeout", 1*time.Minute, "Timeout when checking for changed charts")
+	chartsDiscovery = fs.Bool("charts-discovery", false, "look for all the charts in the git repo whenever it changes, and check the chart of every FluxHelmRelease is among them, setting its ChartFound condition")
 	logReleaseDiffs = fs.Bool("log-release-diffs", false, "Log the diff when a chart release diverges; potentially insecure")
 
+	releaseForceDelete = fs.Duration("release-force-delete-after", 0, "if set, force the deletion (skipping hooks) of a release that has been deleting for longer than this, e.g., '30m'; otherwise such releases are left alone")
+
+	purgeFailedInstalls = fs.Bool("purge-failed-installs", false, "if set, purge a release whose first install failed (so that it has never been deployed) before installing it again, since its name can't otherwise be re-used")
+
 	gitURL = fs.String("git-url", "", "URL of git repo with Helm Charts; e.g., git@github.com:weaveworks/flux-example")
 	gitBranch = fs.String("git-branch", "master", "branch of git repo")
 	gitChartsPath = fs.String("git-charts-path", defaultGitChartsPath, "path within git repo to locate Helm Charts (relative path)")
 	gitPollInterval = fs.Duration("git-poll-interval", 5*time.Minute, "period on which to poll for changes to the git repo")
+	gitSubmodules = fs.String("git-submodules", string(git.SubmodulesOff), "whether to check out submodules of the git repo, e.g., for charts vendored in them: 'recursive', 'shallow' or 'off'")
+	gitTLSCAFile = fs.String("git-tls-ca-file", "", "PEM file of CA certificates to verify the certificate of an HTTPS git host against, instead of the usual ones; e.g., for a git host with an internal CA")
+	gitTLSInsecure = fs.Bool("git-tls-insecure-skip-verify", false, "if set, don't verify the certificate of an HTTPS git host at all; insecure, and only for trying things out")
+
+	proxyURL = fs.String("proxy-url", "", "URL of an HTTP proxy through which to reach HTTPS git hosts, e.g., http://proxy.example.com:3128; overrides HTTP_PROXY and HTTPS_PROXY. Hosts in NO_PROXY, the Kubernetes API server and Tiller are reached directly")
 
 	queueWorkerCount = fs.Int("queue-worker-count", 2, "Number of workers to process queue with Chart release jobs. Two by default")
+
+	tracingZipkinURL = fs.String("tracing-zipkin-url", "", "URL of a Zipkin (or Jaeger, with its Zipkin endpoint enabled) collector to send trace spans to; e.g., http://zipkin:9411/api/v2/spans")
+	tracingSampleRate = fs.Float64("tracing-sample-rate", 1, "proportion of traces to record, from 0 to 1")
 }
 
 func main() {
@@ -124,9 +172,24 @@ func main() {
 
 	// LOGGING ------------------------------------------------------------------------------
 	{
-		logger = log.NewLogfmtLogger(os.Stderr)
-		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
-		logger = log.With(logger, "caller", log.DefaultCaller)
+		levels, err := logging.ParseLevels(*logLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --log-level: %s\n", err)
+			os.Exit(1)
+		}
+		logger, err = logging.NewLogger(os.Stderr, *logFormat, levels)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --log-format: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// This has to come before anything makes an HTTP request, since
+	// the proxy environment is only looked at once. Tiller is in the
+	// cluster, so it's reached directly, like the API server.
+	if err := transport.ConfigureProxy(*proxyURL, *tillerIP); err != nil {
+		logger.Log("error", fmt.Sprintf("--proxy-url: %v", err))
+		os.Exit(1)
 	}
 
 	// SHUTDOWN  ----------------------------------------------------------------------------
@@ -150,12 +213,38 @@ func main() {
 
 	mainLogger := log.With(logger, "component", "helm-operator")
 
+	// TRACING ------------------------------------------------------------------------------
+	if *tracingZipkinURL != "" {
+		exporter, err := tracing.NewZipkinExporter(*tracingZipkinURL, "helm-operator", &http.Client{Timeout: 10 * time.Second}, log.With(logger, "component", "tracing"))
+		if err != nil {
+			mainLogger.Log("error", err)
+			os.Exit(1)
+		}
+		tracing.SetExporter(exporter, *tracingSampleRate)
+		shutdownWg.Add(1)
+		go exporter.Loop(shutdown, shutdownWg)
+	}
+
+	// METRICS ------------------------------------------------------------------------------
+	go func() {
+		// The metrics of syncing charts from git are served apart
+		// from the others, to be looked at on their own.
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		mux.Handle("/metrics/charts", promhttp.HandlerFor(chartsync.Registry, promhttp.HandlerOpts{}))
+		mainLogger.Log("info", "listening", "addr", *listenAddr)
+		errc <- http.ListenAndServe(*listenAddr, mux)
+	}()
+
 	// CLUSTER ACCESS -----------------------------------------------------------------------
 	cfg, err := clientcmd.BuildConfigFromFlags(*master, *kubeconfig)
 	if err != nil {
 		mainLogger.Log("error", fmt.Sprintf("Error building kubeconfig: %v", err))
 		os.Exit(1)
 	}
+	cfg.QPS = *k8sQPS
+	cfg.Burst = *k8sBurst
+	timeout.WithRequestTimeout(cfg, *k8sRequestTimeout)
 
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
@@ -185,11 +274,19 @@ func main() {
 
 	// The status updater, to keep track the release status for each
 	// FluxHelmRelease. It runs as a separate loop for now.
-	statusUpdater := status.New(ifClient, kubeClient, helmClient)
+	statusUpdater := status.New(ifClient, kubeClient, helmClient, *k8sAllowNamespace)
 	go statusUpdater.Loop(shutdown, log.With(logger, "component", "annotator"))
 
+	if _, err := git.ConfigureTLS(*gitTLSCAFile, *gitTLSInsecure); err != nil {
+		mainLogger.Log("error", fmt.Sprintf("--git-tls-ca-file: %v", err))
+		os.Exit(1)
+	}
+	if *gitTLSInsecure {
+		mainLogger.Log("warning", "not verifying the certificates of HTTPS git hosts (--git-tls-insecure-skip-verify)")
+	}
+
 	gitRemote := git.Remote{URL: *gitURL}
-	repo := git.NewRepo(gitRemote, git.PollInterval(*gitPollInterval), git.ReadOnly)
+	repo := git.NewRepo(gitRemote, git.PollInterval(*gitPollInterval), git.ReadOnly, git.Submodules(*gitSubmodules))
 
 	// 		Chart releases sync due to Custom Resources changes -------------------------------
 	{
@@ -212,6 +309,11 @@ func main() {
 
 	releaseConfig := release.Config{
 		ChartsPath: *gitChartsPath,
+		ClusterID:  *clusterID,
+
+		ForceDeleteAfter: *releaseForceDelete,
+
+		PurgeFailedInstalls: *purgeFailedInstalls,
 	}
 	repoConfig := helmop.RepoConfig{
 		Repo:       repo,
@@ -225,20 +327,32 @@ func main() {
 	chartSync := chartsync.New(log.With(logger, "component", "chartsync"),
 		chartsync.Polling{Interval: *chartsSyncInterval, Timeout: *chartsSyncTimeout},
 		chartsync.Clients{KubeClient: *kubeClient, IfClient: *ifClient},
-		rel, repoConfig, *logReleaseDiffs)
+		rel, repoConfig, *logReleaseDiffs, *chartsDiscovery, *k8sAllowNamespace)
 	chartSync.Run(shutdown, errc, shutdownWg)
 
 	// OPERATOR - CUSTOM RESOURCE CHANGE SYNC -----------------------------------------------
 	// CUSTOM RESOURCES CACHING SETUP -------------------------------------------------------
 	//				SharedInformerFactory sets up informer, that maps resource type to a cache shared informer.
 	//				operator attaches event handler to the informer and syncs the informer cache
-	ifInformerFactory := ifinformers.NewSharedInformerFactory(ifClient, 30*time.Second)
+	//				When namespaces are allowed, there's a factory for each, so nothing is watched across the cluster.
+	var ifInformerFactories []ifinformers.SharedInformerFactory
+	if len(*k8sAllowNamespace) == 0 {
+		ifInformerFactories = append(ifInformerFactories, ifinformers.NewSharedInformerFactory(ifClient, 30*time.Second))
+	}
+	for _, ns := range *k8sAllowNamespace {
+		ifInformerFactories = append(ifInformerFactories, ifinformers.NewFilteredSharedInformerFactory(ifClient, 30*time.Second, ns, nil))
+	}
 	// Reference to shared index informers for the FluxHelmRelease
-	fhrInformer := ifInformerFactory.Helm().V1alpha2().FluxHelmReleases()
+	var fhrInformers []ifv1alpha2.FluxHelmReleaseInformer
+	for _, factory := range ifInformerFactories {
+		fhrInformers = append(fhrInformers, factory.Helm().V1alpha2().FluxHelmReleases())
+	}
 
-	opr := operator.New(log.With(logger, "component", "operator"), *logReleaseDiffs, kubeClient, fhrInformer, chartSync, repoConfig)
+	opr := operator.New(log.With(logger, "component", "operator"), *logReleaseDiffs, kubeClient, fhrInformers, chartSync, repoConfig)
 	// Starts handling k8s events related to the given resource kind
-	go ifInformerFactory.Start(shutdown)
+	for _, factory := range ifInformerFactories {
+		go factory.Start(shutdown)
+	}
 
 	checkpoint.CheckForUpdates(product, version, nil, log.With(logger, "component", "checkpoint"))
 
@@ -0,0 +1,172 @@
+// Package commitstatus reports the outcome of syncing a revision back
+// to the git hosting provider, as a commit status, so that it shows
+// up alongside the commit (and any pull request it belongs to).
+package commitstatus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// State is the outcome being reported.
+type State string
+
+const (
+	Success State = "success"
+	Failure State = "failure"
+	Pending State = "pending"
+)
+
+// DefaultContext is the name under which statuses are posted, to
+// distinguish them from those posted by e.g., CI.
+const DefaultContext = "flux/sync"
+
+// maxDescription is the longest description GitHub will accept, in
+// characters.
+const maxDescription = 140
+
+type Status struct {
+	State       State
+	Description string
+}
+
+// Poster posts statuses for commits.
+type Poster interface {
+	Post(ctx context.Context, revision string, status Status) error
+}
+
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+// Config describes where, and as whom, to post statuses.
+type Config struct {
+	Provider string // one of the Provider* constants
+	APIURL   string // base URL of the API; the public service is used if empty
+	Repo     string // "owner/name" (GitHub) or "group/project" (GitLab)
+	Token    string
+	Context  string
+}
+
+// New creates a Poster for the provider given in the config.
+func New(config Config, client *http.Client) (Poster, error) {
+	if config.Repo == "" {
+		return nil, fmt.Errorf("no repository given for commit statuses")
+	}
+	if config.Context == "" {
+		config.Context = DefaultContext
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	switch config.Provider {
+	case ProviderGitHub:
+		if config.APIURL == "" {
+			config.APIURL = "https://api.github.com"
+		}
+		return &github{config, client}, nil
+	case ProviderGitLab:
+		if config.APIURL == "" {
+			config.APIURL = "https://gitlab.com/api/v4"
+		}
+		return &gitlab{config, client}, nil
+	}
+	return nil, fmt.Errorf("unknown commit status provider %q (expected %q or %q)", config.Provider, ProviderGitHub, ProviderGitLab)
+}
+
+var repoPathRE = regexp.MustCompile(`^(?:[a-z+]+://)?(?:[^@/]+@)?[^:/]+(?::[0-9]+)?[:/](.+?)(?:\.git)?/?$`)
+
+// RepoFromURL extracts the repository path (e.g., "weaveworks/flux")
+// from a git URL, whether in scp-like or URL form.
+func RepoFromURL(gitURL string) (string, error) {
+	m := repoPathRE.FindStringSubmatch(gitURL)
+	if m == nil {
+		return "", fmt.Errorf("could not determine repository from git URL %q", gitURL)
+	}
+	return strings.TrimPrefix(m[1], "/"), nil
+}
+
+// truncate shortens s to at most maxDescription characters, cutting
+// on a character boundary so the result is still valid UTF-8.
+func truncate(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxDescription {
+		return s
+	}
+	return string(runes[:maxDescription-3]) + "..."
+}
+
+type github struct {
+	Config
+	client *http.Client
+}
+
+func (g *github) Post(ctx context.Context, revision string, status Status) error {
+	body, err := json.Marshal(map[string]string{
+		"state":       string(status.State),
+		"description": truncate(status.Description),
+		"context":     g.Context,
+	})
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/repos/%s/statuses/%s", strings.TrimSuffix(g.APIURL, "/"), g.Repo, revision)
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "token "+g.Token)
+	}
+	return do(ctx, g.client, req)
+}
+
+type gitlab struct {
+	Config
+	client *http.Client
+}
+
+func (g *gitlab) Post(ctx context.Context, revision string, status Status) error {
+	state := string(status.State)
+	if status.State == Failure {
+		state = "failed"
+	}
+	form := url.Values{}
+	form.Set("state", state)
+	form.Set("name", g.Context)
+	form.Set("description", truncate(status.Description))
+	u := fmt.Sprintf("%s/projects/%s/statuses/%s", strings.TrimSuffix(g.APIURL, "/"), url.PathEscape(g.Repo), revision)
+	req, err := http.NewRequest("POST", u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if g.Token != "" {
+		req.Header.Set("Private-Token", g.Token)
+	}
+	return do(ctx, g.client, req)
+}
+
+func do(ctx context.Context, client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("posting commit status: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package commitstatus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRepoFromURL(t *testing.T) {
+	for url, expected := range map[string]string{
+		"git@github.com:weaveworks/flux-example":           "weaveworks/flux-example",
+		"git@github.com:weaveworks/flux-example.git":       "weaveworks/flux-example",
+		"ssh://git@github.com/weaveworks/flux-example.git": "weaveworks/flux-example",
+		"https://gitlab.com/group/subgroup/project.git":    "group/subgroup/project",
+		"ssh://git@gitlab.example.com:2222/group/project":  "group/project",
+	} {
+		repo, err := RepoFromURL(url)
+		if err != nil {
+			t.Errorf("%s: %s", url, err)
+			continue
+		}
+		if repo != expected {
+			t.Errorf("%s: expected %q, got %q", url, expected, repo)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	short := "sync failed"
+	if got := truncate(short); got != short {
+		t.Errorf("expected %q unchanged, got %q", short, got)
+	}
+	long := strings.Repeat("é", maxDescription+10)
+	got := truncate(long)
+	if !utf8.ValidString(got) {
+		t.Errorf("expected valid UTF-8, got %q", got)
+	}
+	if n := utf8.RuneCountInString(got); n != maxDescription {
+		t.Errorf("expected %d characters, got %d", maxDescription, n)
+	}
+	if !strings.HasSuffix(got, "...") {
+		t.Errorf("expected an ellipsis, got %q", got)
+	}
+}
+
+func TestGitHubPost(t *testing.T) {
+	var path string
+	var body map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.Header.Get("Authorization") != "token s3cr3t" {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	p, err := New(Config{Provider: ProviderGitHub, APIURL: srv.URL, Repo: "weaveworks/flux", Token: "s3cr3t"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Post(context.Background(), "abc123", Status{State: Failure, Description: "oops"}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/repos/weaveworks/flux/statuses/abc123" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if body["state"] != "failure" || body["description"] != "oops" || body["context"] != DefaultContext {
+		t.Errorf("unexpected body %+v", body)
+	}
+}
+
+func TestGitLabPost(t *testing.T) {
+	var path, state string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		r.ParseForm()
+		state = r.PostForm.Get("state")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	p, err := New(Config{Provider: ProviderGitLab, APIURL: srv.URL, Repo: "group/project"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Post(context.Background(), "abc123", Status{State: Failure}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/projects/group%2Fproject/statuses/abc123" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if state != "failed" {
+		t.Errorf("expected state failed, got %q", state)
+	}
+}
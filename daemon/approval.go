@@ -0,0 +1,118 @@
+package daemon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+// pendingRelease is an automated release waiting to be approved: the
+// updates to the containers of a single workload.
+type pendingRelease struct {
+	v10.PendingRelease
+	changes []update.Change
+}
+
+// pendingReleaseID identifies a release by what it would change, so
+// the same updates found on successive polls -- or after a restart
+// -- are given the same ID.
+func pendingReleaseID(workload flux.ResourceID, changes []update.Change) string {
+	h := sha256.New()
+	fmt.Fprintln(h, workload)
+	for _, c := range changes {
+		fmt.Fprintf(h, "%s=%s\n", c.Container.Name, c.ImageID)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// stageForApproval replaces the releases waiting for approval with
+// those for the changes given, one for each workload. Releases found
+// again keep when they were first staged; those not found again,
+// e.g., because there's an even newer image, or the workload is no
+// longer automated, are dropped.
+func (d *Daemon) stageForApproval(changes *update.Automated, logger log.Logger) {
+	byWorkload := map[flux.ResourceID][]update.Change{}
+	for _, c := range changes.Changes {
+		byWorkload[c.ServiceID] = append(byWorkload[c.ServiceID], c)
+	}
+
+	now := time.Now().UTC()
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	pending := map[string]*pendingRelease{}
+	for workload, changes := range byWorkload {
+		sort.Slice(changes, func(i, j int) bool {
+			return changes[i].Container.Name < changes[j].Container.Name
+		})
+		id := pendingReleaseID(workload, changes)
+		if p, ok := d.pending[id]; ok {
+			pending[id] = p
+			continue
+		}
+		p := &pendingRelease{
+			PendingRelease: v10.PendingRelease{ID: id, Workload: workload, StagedAt: now},
+			changes:        changes,
+		}
+		for _, c := range changes {
+			p.Changes = append(p.Changes, v10.PendingChange{
+				Container: c.Container.Name,
+				Current:   c.Container.Image.String(),
+				Target:    c.ImageID.String(),
+			})
+		}
+		pending[id] = p
+		logger.Log("info", "automated release waiting for approval", "id", id, "service", workload, "summary", summariseChanges(&update.Automated{Changes: changes}))
+	}
+	d.pending = pending
+	pendingReleasesCount.Set(float64(len(pending)))
+}
+
+// PendingReleases gives the automated releases waiting for approval,
+// oldest first. Like Status, it's not part of the api.Server
+// interface.
+func (d *Daemon) PendingReleases(ctx context.Context) []v10.PendingRelease {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	releases := []v10.PendingRelease{}
+	for _, p := range d.pending {
+		releases = append(releases, p.PendingRelease)
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		if !releases[i].StagedAt.Equal(releases[j].StagedAt) {
+			return releases[i].StagedAt.Before(releases[j].StagedAt)
+		}
+		return releases[i].Workload.String() < releases[j].Workload.String()
+	})
+	return releases
+}
+
+// ApproveRelease queues the automated release with the ID given to
+// be committed, with the approver as the cause, and returns the ID
+// of the job doing so.
+func (d *Daemon) ApproveRelease(ctx context.Context, id string, cause update.Cause) (job.ID, error) {
+	d.pendingMu.Lock()
+	p, ok := d.pending[id]
+	if ok {
+		delete(d.pending, id)
+		pendingReleasesCount.Set(float64(len(d.pending)))
+	}
+	d.pendingMu.Unlock()
+	if !ok {
+		return "", unknownPendingReleaseError(id)
+	}
+	return d.UpdateManifests(ctx, update.Spec{
+		Type:  update.Auto,
+		Cause: cause,
+		Spec:  &update.Automated{Changes: p.changes},
+	})
+}
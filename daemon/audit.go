@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/audit"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+// AuditRecords returns the records kept in the audit log that match
+// the query, oldest first.
+func (d *Daemon) AuditRecords(ctx context.Context, q audit.Query) []audit.Record {
+	if d.Audit == nil {
+		return nil
+	}
+	return d.Audit.Records(q)
+}
+
+// recordAudit adds a record to the audit log, if there is one. Not
+// being able to write to the log doesn't stop anything else.
+func (d *Daemon) recordAudit(r audit.Record, logger log.Logger) {
+	if d.Audit == nil {
+		return
+	}
+	if err := d.Audit.Record(r); err != nil {
+		logger.Log("err", err, "audit", r.Action)
+	}
+}
+
+// makeAuditedJobFunc returns a jobFunc that records the outcome of the
+// job in the audit log, whether it succeeded or not, along with the
+// identities of the caller that asked for it.
+func (d *Daemon) makeAuditedJobFunc(spec update.Spec, identities []string, f jobFunc) jobFunc {
+	return func(ctx context.Context, id job.ID, logger log.Logger) (job.Result, error) {
+		started := time.Now().UTC()
+		result, err := f(ctx, id, logger)
+		if err == git.ErrNoChanges {
+			// Nothing happened, so there's nothing to record
+			return result, err
+		}
+		r := audit.Record{
+			Time:       started,
+			Action:     auditAction(spec.Type),
+			User:       spec.Cause.User,
+			Identities: identities,
+			Message:    spec.Cause.Message,
+			Workloads:  result.Result.AffectedResources(),
+			Revision:   result.Revision,
+			JobID:      string(id),
+			Summary:    auditSummary(spec, result.Result),
+		}
+		if err != nil {
+			r.Error = err.Error()
+		} else if r.Error = result.Result.Error(); r.Error != "" {
+			// The update was made, but not to everything asked for
+			r.Severity = audit.SeverityWarning
+		}
+		d.recordAudit(r, logger)
+		return result, err
+	}
+}
+
+func auditAction(updateType string) audit.Action {
+	switch updateType {
+	case update.Auto:
+		return audit.AutomatedRelease
+	case update.Policy, update.Policies:
+		return audit.Policy
+	case update.HelmValues:
+		return audit.HelmValues
+	}
+	return audit.Release
+}
+
+// auditSummary describes what an update did: the images it changed,
+// the policies, or the Helm values.
+func auditSummary(spec update.Spec, result update.Result) string {
+	var updates policy.Updates
+	switch s := spec.Spec.(type) {
+	case update.HelmValueUpdates:
+		return "values: " + helmValuesList(s.Values)
+	case policy.Updates:
+		updates = s
+	case update.PolicySelector:
+		updates = policy.Updates{}
+		for _, id := range result.AffectedResources() {
+			updates[id] = s.Update
+		}
+	default:
+		images := result.ChangedImages()
+		if len(images) == 0 {
+			return "no image changes"
+		}
+		return "images: " + strings.Join(images, ", ")
+	}
+	var lines []string
+	for _, e := range policyEvents(updates, time.Now()) {
+		lines = append(lines, e.String())
+	}
+	if len(lines) == 0 {
+		return "no policy changes"
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,198 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/image"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+// How often the rollouts of automated image updates are checked, when
+// there are any being watched.
+const rolloutCheckInterval = 15 * time.Second
+
+// watchedRollout is an automated image update to a workload that is
+// reverted if it doesn't roll out.
+type watchedRollout struct {
+	revision   string
+	containers []update.ContainerUpdate
+	timeout    time.Duration
+	deadline   time.Time // zero if there's no timeout
+}
+
+// watchRollouts starts watching the rollouts of the workloads updated
+// by the automated release given, which has just been synced, if they
+// have the rollback_on_failure policy. Updates that revert a failed
+// rollout aren't themselves watched, so a bad image and the one
+// before it don't take turns.
+func (d *Daemon) watchRollouts(revision string, result update.Result, resources map[string]resource.Resource, logger log.Logger) {
+	now := time.Now()
+	for id, controllerResult := range result {
+		if controllerResult.Status != update.ReleaseStatusSuccess {
+			continue
+		}
+		res, ok := resources[id.String()]
+		if !ok {
+			continue
+		}
+		timeout, ok := d.rollbackTimeout(res.Policy(), log.With(logger, "service", id))
+		if !ok {
+			continue
+		}
+		var containers []update.ContainerUpdate
+		for _, c := range controllerResult.PerContainer {
+			if failed, ok := d.rolloutFailed[id.String()+":"+c.Container]; ok && failed.CanonicalRef() == c.Current.CanonicalRef() {
+				continue
+			}
+			containers = append(containers, c)
+		}
+		if len(containers) == 0 {
+			continue
+		}
+		watched := watchedRollout{revision: revision, containers: containers, timeout: timeout}
+		if timeout > 0 {
+			watched.deadline = now.Add(timeout)
+		}
+		if d.watchedRollouts == nil {
+			d.watchedRollouts = map[flux.ResourceID]watchedRollout{}
+		}
+		d.watchedRollouts[id] = watched
+		logger.Log("info", "watching rollout of automated release", "service", id, "revision", revision, "timeout", timeout)
+	}
+}
+
+// rollbackTimeout gives how long the rollout of an automated update
+// to a workload with the policies given has to finish, and whether
+// it's to be watched at all.
+func (d *Daemon) rollbackTimeout(p policy.Set, logger log.Logger) (time.Duration, bool) {
+	value, ok := p.Get(policy.RollbackOnFailure)
+	if !ok || value == "false" {
+		return 0, false
+	}
+	if value == "true" {
+		return d.AutomationRollbackTimeout, true
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		logger.Log("warning", "invalid rollback_on_failure policy; using the default timeout", "value", value)
+		return d.AutomationRollbackTimeout, true
+	}
+	return timeout, true
+}
+
+// checkRollouts looks at the workloads whose rollouts are being
+// watched. Those that have rolled out are no longer watched; those
+// whose rollouts have failed, or run out of time, have their images
+// put back as they were, with a new commit, and an event recorded.
+func (d *Daemon) checkRollouts(logger log.Logger) {
+	if len(d.watchedRollouts) == 0 {
+		return
+	}
+	var ids []flux.ResourceID
+	for id := range d.watchedRollouts {
+		ids = append(ids, id)
+	}
+	controllers, err := d.Cluster.SomeControllers(ids)
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "checking rollouts of automated releases"))
+		return
+	}
+	found := map[flux.ResourceID]cluster.Controller{}
+	for _, c := range controllers {
+		found[c.ID] = c
+	}
+
+	now := time.Now()
+	revert := &update.Automated{}
+	for id, watched := range d.watchedRollouts {
+		controller, ok := found[id]
+		if !ok {
+			// It's gone from the cluster; there's nothing to roll back
+			delete(d.watchedRollouts, id)
+			continue
+		}
+		var reason string
+		switch {
+		case controller.Status == cluster.StatusError:
+			reason = "rollout failed"
+			if len(controller.Rollout.Messages) > 0 {
+				reason += ": " + strings.Join(controller.Rollout.Messages, "; ")
+			}
+		case rolledOut(controller, watched.containers):
+			delete(d.watchedRollouts, id)
+			automatedRollouts.With(fluxmetrics.LabelSuccess, "true").Add(1)
+			logger.Log("info", "automated release rolled out", "service", id, "revision", watched.revision)
+			continue
+		case !watched.deadline.IsZero() && now.After(watched.deadline):
+			reason = fmt.Sprintf("not rolled out within %s", watched.timeout)
+		default:
+			continue
+		}
+
+		delete(d.watchedRollouts, id)
+		automatedRollouts.With(fluxmetrics.LabelSuccess, "false").Add(1)
+		logger.Log("warning", "rolling back automated release", "service", id, "revision", watched.revision, "reason", reason)
+		if d.rolloutFailed == nil {
+			d.rolloutFailed = map[string]image.Ref{}
+		}
+		for _, c := range watched.containers {
+			d.rolloutFailed[id.String()+":"+c.Container] = c.Target
+			revert.Changes = append(revert.Changes, update.Change{
+				ServiceID: id,
+				Container: resource.Container{Name: c.Container, Image: c.Target},
+				ImageID:   c.Current,
+			})
+		}
+		if err := d.LogEvent(event.Event{
+			ServiceIDs: []flux.ResourceID{id},
+			Type:       event.EventAutoRollback,
+			StartedAt:  now.UTC(),
+			EndedAt:    now.UTC(),
+			LogLevel:   event.LogLevelError,
+			Metadata: &event.AutoRollbackEventMetadata{
+				Revision:   watched.revision,
+				Containers: watched.containers,
+				Reason:     reason,
+			},
+		}); err != nil {
+			logger.Log("err", err)
+		}
+	}
+	if len(revert.Changes) > 0 {
+		d.UpdateManifests(context.Background(), update.Spec{Type: update.Auto, Spec: revert})
+	}
+}
+
+// rolledOut reports whether a controller is running the images it was
+// updated to, on all its pods.
+func rolledOut(controller cluster.Controller, updates []update.ContainerUpdate) bool {
+	if controller.Status != cluster.StatusReady {
+		return false
+	}
+	rollout := controller.Rollout
+	if rollout.Updated < rollout.Desired || rollout.Ready < rollout.Desired || rollout.Outdated > 0 {
+		return false
+	}
+	images := map[string]string{}
+	for _, c := range controller.ContainersOrNil() {
+		images[c.Name] = c.Image.CanonicalRef().String()
+	}
+	for _, u := range updates {
+		if images[u.Container] != u.Target.CanonicalRef().String() {
+			return false
+		}
+	}
+	return true
+}
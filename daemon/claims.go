@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/resource"
+)
+
+// claimResources claims the resources from the repo that this daemon
+// would apply, so other shards syncing from the same repo leave them
+// alone, and records those already claimed by another shard so they
+// aren't applied.
+func (d *Daemon) claimResources(ctx context.Context, allResources map[string]resource.Resource, logger log.Logger) error {
+	filter, _ := d.Cluster.(cluster.SyncFilter)
+	var ids []flux.ResourceID
+	for _, res := range allResources {
+		if filter == nil || filter.Syncs(res) {
+			ids = append(ids, res.ResourceID())
+		}
+	}
+	conflicts, err := d.Claims.Claim(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for id, shard := range conflicts {
+		if d.claimConflicts[id] != shard {
+			logger.Log("warning", "resource claimed by another shard; not applying it", "resource", id, "shard", shard)
+		}
+	}
+	d.claimConflicts = conflicts
+	return nil
+}
+
+// unclaimedResources gives the resources among those given that
+// haven't been claimed by another shard.
+func (d *Daemon) unclaimedResources(resources map[string]resource.Resource) map[string]resource.Resource {
+	if len(d.claimConflicts) == 0 {
+		return resources
+	}
+	unclaimed := map[string]resource.Resource{}
+	for id, res := range resources {
+		if _, ok := d.claimConflicts[res.ResourceID()]; !ok {
+			unclaimed[id] = res
+		}
+	}
+	return unclaimed
+}
+
+// claimErrors reports each of the resources given that was claimed
+// by another shard, and so not applied.
+func (d *Daemon) claimErrors(allResources map[string]resource.Resource) []event.ResourceError {
+	var errs []event.ResourceError
+	for _, res := range allResources {
+		if shard, ok := d.claimConflicts[res.ResourceID()]; ok {
+			errs = append(errs, event.ResourceError{
+				ID:    res.ResourceID(),
+				Path:  res.Source(),
+				Line:  resource.SourceLine(res),
+				Error: fmt.Sprintf("also claimed by shard %q; not applied", shard),
+			})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,149 @@
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+// CommitTemplates customises the commits made for each type of
+// update (as in `update.Spec.Type`, e.g., "auto" for automated image
+// updates, "image" for releases, "policy" for policy changes). Types
+// without a template or author get the usual message, and the
+// committer as author.
+type CommitTemplates struct {
+	Messages map[string]*template.Template
+	Authors  map[string]string // e.g., "Flux Automation <flux@example.com>"
+}
+
+// CommitData is the value given to commit message templates.
+type CommitData struct {
+	Type           string // the type of update
+	User           string // who asked for the update, if known
+	Message        string // the message given with the update, if any
+	DefaultMessage string // the message that would be used if there were no template
+	ClusterID      string // the cluster fluxd is running in, if it's been given an ID
+	Changes        []CommitChange
+}
+
+// CommitChange describes the change made to a single workload (and,
+// for image updates, a single container).
+type CommitChange struct {
+	Workload  string
+	Container string
+	Image     string // the image repository, without a tag
+	OldTag    string
+	NewTag    string
+	Changelog string            // for automated updates, a link to the changes in the image, or where it was built from, if its labels say
+	Add       map[string]string // policies added, with their values
+	Remove    []string          // policies removed
+	Values    map[string]string // for Helm releases, the values set, by key
+}
+
+// ParseCommitTemplate parses a template for commit messages, as
+// given by an operator.
+func ParseCommitTemplate(updateType, text string) (*template.Template, error) {
+	return template.New(updateType).Option("missingkey=error").Parse(text)
+}
+
+// commitAction makes the commit action for an update, using any
+// template and author given for its type.
+func (d *Daemon) commitAction(spec update.Spec, defaultMessage string, changes []CommitChange) (git.CommitAction, error) {
+	// Say which cluster made the commit, for those with more than
+	// one fluxd committing to the same repo
+	if d.ClusterID != "" {
+		defaultMessage += "\n\nFlux-Cluster: " + d.ClusterID
+	}
+	action := git.CommitAction{Message: defaultMessage}
+	if d.CommitTemplates != nil {
+		action.Author = d.CommitTemplates.Authors[spec.Type]
+		if tmpl, ok := d.CommitTemplates.Messages[spec.Type]; ok {
+			buf := &bytes.Buffer{}
+			err := tmpl.Execute(buf, CommitData{
+				Type:           spec.Type,
+				User:           spec.Cause.User,
+				Message:        spec.Cause.Message,
+				DefaultMessage: defaultMessage,
+				ClusterID:      d.ClusterID,
+				Changes:        changes,
+			})
+			if err != nil {
+				return action, fmt.Errorf("executing commit message template for %q: %s", spec.Type, err)
+			}
+			action.Message = buf.String()
+		}
+	}
+	if d.GitConfig.SetAuthor && spec.Cause.User != "" {
+		action.Author = spec.Cause.User
+	}
+	return action, nil
+}
+
+// imageChanges lists the successful image updates in a release
+// result.
+func imageChanges(result update.Result) []CommitChange {
+	var changes []CommitChange
+	for _, id := range sortedIDs(result) {
+		res := result[id]
+		if res.Status != update.ReleaseStatusSuccess {
+			continue
+		}
+		for _, c := range res.PerContainer {
+			change := CommitChange{
+				Workload:  id.String(),
+				Container: c.Container,
+				Image:     c.Target.Name.String(),
+				OldTag:    c.Current.Tag,
+				NewTag:    c.Target.Tag,
+			}
+			if c.Changelog != nil {
+				change.Changelog = c.Changelog.String()
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// policyChanges lists the policy updates made to the workloads given.
+func policyChanges(updates policy.Updates, ids []flux.ResourceID) []CommitChange {
+	var changes []CommitChange
+	for _, id := range ids {
+		u := updates[id]
+		change := CommitChange{Workload: id.String(), Add: map[string]string{}}
+		for p, v := range u.Add {
+			change.Add[string(p)] = v
+		}
+		for p := range u.Remove {
+			change.Remove = append(change.Remove, string(p))
+		}
+		sort.Strings(change.Remove)
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// helmValueChanges describes the values set in a FluxHelmRelease.
+func helmValueChanges(id flux.ResourceID, values []cluster.HelmValue) []CommitChange {
+	change := CommitChange{Workload: id.String(), Values: map[string]string{}}
+	for _, v := range values {
+		change.Values[v.Key()] = v.Value
+	}
+	return []CommitChange{change}
+}
+
+func sortedIDs(result update.Result) flux.ResourceIDs {
+	ids := flux.ResourceIDs{}
+	for id := range result {
+		ids = append(ids, id)
+	}
+	ids.Sort()
+	return ids
+}
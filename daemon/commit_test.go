@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+func TestCommitAction_Template(t *testing.T) {
+	tmpl, err := ParseCommitTemplate(update.Auto, `auto-update{{range .Changes}}
+{{.Workload}} {{.Container}} {{.Image}} {{.OldTag}} -> {{.NewTag}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{
+		CommitTemplates: &CommitTemplates{
+			Messages: map[string]*template.Template{update.Auto: tmpl},
+			Authors:  map[string]string{update.Auto: "Flux Automation <flux@example.com>"},
+		},
+	}
+
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	result := update.Result{
+		id: update.ControllerResult{
+			Status: update.ReleaseStatusSuccess,
+			PerContainer: []update.ContainerUpdate{{
+				Container: "greeter",
+				Current:   mustParseImageRef("quay.io/weaveworks/helloworld:master-a000001"),
+				Target:    mustParseImageRef("quay.io/weaveworks/helloworld:master-a000002"),
+			}},
+		},
+	}
+	action, err := d.commitAction(update.Spec{Type: update.Auto}, "Auto-release", imageChanges(result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := git.CommitAction{
+		Author:  "Flux Automation <flux@example.com>",
+		Message: "auto-update\ndefault:deployment/helloworld greeter quay.io/weaveworks/helloworld master-a000001 -> master-a000002",
+	}
+	if action != expected {
+		t.Errorf("expected %+v, got %+v", expected, action)
+	}
+}
+
+func TestCommitAction_Defaults(t *testing.T) {
+	d := &Daemon{GitConfig: git.Config{SetAuthor: true}}
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	updates := policy.Updates{id: policy.Update{Add: policy.Set{policy.Automated: "true"}}}
+	spec := update.Spec{Type: update.Policy, Cause: update.Cause{User: "Jo <jo@example.com>"}}
+
+	action, err := d.commitAction(spec, "Automated: default:deployment/helloworld", policyChanges(updates, []flux.ResourceID{id}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Message != "Automated: default:deployment/helloworld" || action.Author != "Jo <jo@example.com>" {
+		t.Errorf("unexpected commit action %+v", action)
+	}
+}
+
+func TestCommitAction_ClusterID(t *testing.T) {
+	tmpl, err := ParseCommitTemplate(update.Policy, `{{.ClusterID}}: {{.Type}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{ClusterID: "prod-eu-1"}
+	action, err := d.commitAction(update.Spec{Type: update.Auto}, "Auto-release", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Message != "Auto-release\n\nFlux-Cluster: prod-eu-1" {
+		t.Errorf("expected the cluster to be given in the commit message, got %q", action.Message)
+	}
+
+	d.CommitTemplates = &CommitTemplates{Messages: map[string]*template.Template{update.Policy: tmpl}}
+	action, err = d.commitAction(update.Spec{Type: update.Policy}, "Automated: default:deployment/helloworld", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Message != "prod-eu-1: policy" {
+		t.Errorf("unexpected commit message %q", action.Message)
+	}
+}
@@ -16,17 +16,26 @@ import (
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/audit"
+	"github.com/weaveworks/flux/authz"
 	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/commitstatus"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/guid"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/notify"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/pullrequest"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/releasegate"
 	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
+	"github.com/weaveworks/flux/tracing"
 	"github.com/weaveworks/flux/update"
+	"github.com/weaveworks/flux/vulnscan"
 )
 
 const (
@@ -36,22 +45,36 @@ const (
 	// a (generous) threshold for considering a job stuck and
 	// abandoning it
 	defaultJobTimeout = 60 * time.Second
+	// Branches pushed for pull requests are named with this prefix
+	pullRequestBranchPrefix = "flux-update-"
 )
 
 // Daemon is the fully-functional state of a daemon (compare to
 // `NotReadyDaemon`).
 type Daemon struct {
-	V              string
-	Cluster        cluster.Cluster
-	Manifests      cluster.Manifests
-	Registry       registry.Registry
-	ImageRefresh   chan image.Name
-	Repo           *git.Repo
-	GitConfig      git.Config
-	Jobs           *job.Queue
-	JobStatusCache *job.StatusCache
-	EventWriter    event.EventWriter
-	Logger         log.Logger
+	V               string
+	Cluster         cluster.Cluster
+	Manifests       cluster.Manifests
+	Registry        registry.Registry
+	ImageRefresh    chan image.Name
+	Repo            *git.Repo
+	GitConfig       git.Config
+	Jobs            *job.Queue
+	JobStatusCache  *job.StatusCache
+	EventWriter     event.EventWriter
+	CommitStatus    commitstatus.Poster // optional; if set, sync outcomes are posted to the git provider
+	SyncState       fluxsync.State      // optional; if set, used instead of the sync tag to record the revision synced
+	Claims          fluxsync.Claims     // optional; if set, resources are claimed before syncing, and those claimed by other daemons aren't applied
+	PullRequests    pullrequest.Opener  // optional; if set, changes are proposed in pull requests rather than pushed to the branch
+	CommitTemplates *CommitTemplates    // optional; customises commit messages and authors
+	Audit           *audit.Log          // optional; if set, releases, policy changes and syncs are recorded in it
+	Notifier        *notify.Dispatcher  // optional; if set, events are sent as notifications
+	ReleaseGate     releasegate.Gate    // optional; if set, asked whether each automated image update may go ahead
+	VulnScanner     vulnscan.Scanner    // optional; if set, automation passes over images with vulnerabilities worse than VulnThreshold
+	VulnThreshold   vulnscan.Severity
+	VulnUnknown     vulnscan.Severity // the severity assumed for vulnerabilities the scanner doesn't rate; critical, if not set
+	ClusterID       string            // optional; if set, identifies the cluster in events and commit messages
+	Logger          log.Logger
 	// bookkeeping
 	*LoopVars
 }
@@ -126,18 +149,117 @@ func (d *Daemon) ListServices(ctx context.Context, namespace string) ([]v6.Contr
 			Containers: containers2containers(service.ContainersOrNil()),
 			ReadOnly:   readOnly,
 			Status:     service.Status,
+			Rollout:    rollout2rollout(service.Rollout),
 			Antecedent: service.Antecedent,
 			Labels:     service.Labels,
 			Automated:  policies.Has(policy.Automated),
 			Locked:     policies.Has(policy.Locked),
 			Ignore:     policies.Has(policy.Ignore),
 			Policies:   policies.ToStringMap(),
+
+			Autoscaler:        autoscaler2autoscaler(service.Autoscaler),
+			DisruptionBudgets: budgets2budgets(service.DisruptionBudgets),
 		})
 	}
 
 	return res, nil
 }
 
+// ListServicesWithOptions lists the workloads in the namespace given
+// (or in all namespaces) that match the label selector and policies
+// given, and, if asked, only those with newer images to release. Only
+// the images of the workloads that match otherwise are looked at.
+func (d *Daemon) ListServicesWithOptions(ctx context.Context, opts v10.ListServicesOptions) ([]v6.ControllerStatus, error) {
+	services, err := d.ListServices(ctx, opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	res, err := opts.Filter(services)
+	if err != nil || !opts.OutOfDate || len(res) == 0 {
+		return res, err
+	}
+	ids := make([]flux.ResourceID, len(res))
+	for i, s := range res {
+		ids[i] = s.ID
+	}
+	outOfDate, err := d.outOfDate(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []v6.ControllerStatus{}
+	for _, s := range res {
+		if outOfDate[s.ID] {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered, nil
+}
+
+// outOfDate finds which of the workloads given have a container for
+// which there's a newer image that its filters allow.
+func (d *Daemon) outOfDate(ctx context.Context, ids []flux.ResourceID) (map[flux.ResourceID]bool, error) {
+	services, err := d.Cluster.SomeControllers(ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting services from cluster")
+	}
+	resources, _, err := d.getResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	imageRepos, err := update.FetchImageRepos(d.Registry, clusterContainers(services), d.Logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting images for services")
+	}
+	outOfDate := map[flux.ResourceID]bool{}
+	for _, service := range services {
+		containers, err := getServiceContainers(service, imageRepos, resources[service.ID.String()], []string{"Name", "NewFilteredImagesCount"})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range containers {
+			if c.NewFilteredImagesCount > 0 {
+				outOfDate[service.ID] = true
+			}
+		}
+	}
+	return outOfDate, nil
+}
+
+func rollout2rollout(r cluster.RolloutStatus) v6.RolloutStatus {
+	return v6.RolloutStatus{
+		Desired:   r.Desired,
+		Updated:   r.Updated,
+		Ready:     r.Ready,
+		Available: r.Available,
+		Outdated:  r.Outdated,
+		Messages:  r.Messages,
+	}
+}
+
+func autoscaler2autoscaler(a *cluster.Autoscaler) *v6.Autoscaler {
+	if a == nil {
+		return nil
+	}
+	return &v6.Autoscaler{
+		Name:            a.Name,
+		MinReplicas:     a.MinReplicas,
+		MaxReplicas:     a.MaxReplicas,
+		CurrentReplicas: a.CurrentReplicas,
+	}
+}
+
+func budgets2budgets(bs []cluster.DisruptionBudget) []v6.DisruptionBudget {
+	var res []v6.DisruptionBudget
+	for _, b := range bs {
+		res = append(res, v6.DisruptionBudget{
+			Name:           b.Name,
+			MinAvailable:   b.MinAvailable,
+			MaxUnavailable: b.MaxUnavailable,
+		})
+	}
+	return res
+}
+
 type clusterContainers []cluster.Controller
 
 func (cs clusterContainers) Len() int {
@@ -220,13 +342,16 @@ func (d *Daemon) makeJobFromUpdate(update updateFunc) jobFunc {
 
 // executeJob runs a job func and keeps track of its status, so the
 // daemon can report it when asked.
-func (d *Daemon) executeJob(id job.ID, do jobFunc, logger log.Logger) (job.Result, error) {
+func (d *Daemon) executeJob(id job.ID, spec *update.Spec, do jobFunc, logger log.Logger) (job.Result, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultJobTimeout)
 	defer cancel()
-	d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusRunning})
+	ctx, span := tracing.Start(ctx, "job")
+	span.SetTag("job", string(id))
+	d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusRunning, Result: job.Result{Spec: spec}})
 	result, err := do(ctx, id, logger)
+	span.Finish(err)
 	if err != nil {
-		d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusFailed, Err: err.Error()})
+		d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusFailed, Err: err.Error(), Result: job.Result{Spec: spec}})
 		return result, err
 	}
 	d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusSucceeded, Result: result})
@@ -270,15 +395,18 @@ func (d *Daemon) makeLoggingJobFunc(f jobFunc) jobFunc {
 	}
 }
 
-// queueJob queues a job func to be executed.
-func (d *Daemon) queueJob(do jobFunc) job.ID {
+// queueJob queues a job func to be executed. The spec of the update
+// it makes, if it makes one, is kept in the job's status while it's
+// waiting or running, or if it fails, so that it's known what the job
+// is about before there's a result.
+func (d *Daemon) queueJob(spec *update.Spec, do jobFunc) job.ID {
 	id := job.ID(guid.New())
 	enqueuedAt := time.Now()
 	d.Jobs.Enqueue(&job.Job{
 		ID: id,
 		Do: func(logger log.Logger) error {
 			queueDuration.Observe(time.Since(enqueuedAt).Seconds())
-			_, err := d.executeJob(id, do, logger)
+			_, err := d.executeJob(id, spec, do, logger)
 			if err != nil {
 				return err
 			}
@@ -286,7 +414,7 @@ func (d *Daemon) queueJob(do jobFunc) job.ID {
 		},
 	})
 	queueLength.Set(float64(d.Jobs.Len()))
-	d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusQueued})
+	d.JobStatusCache.SetStatus(id, job.Status{StatusString: job.StatusQueued, Result: job.Result{Spec: spec}})
 	return id
 }
 
@@ -296,18 +424,43 @@ func (d *Daemon) UpdateManifests(ctx context.Context, spec update.Spec) (job.ID,
 	if spec.Type == "" {
 		return id, errors.New("no type in update spec")
 	}
+	// Who's asking, as authenticated; as opposed to spec.Cause.User,
+	// which is whatever the caller says
+	identities, _ := authz.Identities(ctx)
 	switch s := spec.Spec.(type) {
 	case release.Changes:
 		if s.ReleaseKind() == update.ReleaseKindPlan {
 			id := job.ID(guid.New())
-			_, err := d.executeJob(id, d.makeJobFromUpdate(d.release(spec, s)), d.Logger)
+			_, err := d.executeJob(id, &spec, d.makeJobFromUpdate(d.release(spec, s)), d.Logger)
 			return id, err
 		}
-		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.release(spec, s)))), nil
+		if d.Repo.ReadOnly() {
+			return id, readOnlyRepoError("release")
+		}
+		return d.queueJob(&spec, d.makeAuditedJobFunc(spec, identities, d.makeLoggingJobFunc(d.makeJobFromUpdate(d.release(spec, s))))), nil
 	case policy.Updates:
-		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.updatePolicy(spec, s)))), nil
+		if d.Repo.ReadOnly() {
+			return id, readOnlyRepoError("update policies")
+		}
+		return d.queueJob(&spec, d.makeAuditedJobFunc(spec, identities, d.makeLoggingJobFunc(d.makeJobFromUpdate(d.updatePolicy(spec, s))))), nil
+	case update.PolicySelector:
+		if d.Repo.ReadOnly() {
+			return id, readOnlyRepoError("update policies")
+		}
+		if err := s.Validate(); err != nil {
+			return id, policySelectorError(err)
+		}
+		return d.queueJob(&spec, d.makeAuditedJobFunc(spec, identities, d.makeLoggingJobFunc(d.makeJobFromUpdate(d.updateSelectedPolicies(spec, s))))), nil
+	case update.HelmValueUpdates:
+		if d.Repo.ReadOnly() {
+			return id, readOnlyRepoError("set Helm values")
+		}
+		if err := s.Validate(); err != nil {
+			return id, err
+		}
+		return d.queueJob(&spec, d.makeAuditedJobFunc(spec, identities, d.makeLoggingJobFunc(d.makeJobFromUpdate(d.updateHelmValues(spec, s))))), nil
 	case update.ManualSync:
-		return d.queueJob(d.sync()), nil
+		return d.queueJob(nil, d.sync()), nil
 	default:
 		return id, fmt.Errorf(`unknown update type "%s"`, spec.Type)
 	}
@@ -322,7 +475,11 @@ func (d *Daemon) sync() jobFunc {
 		if err != nil {
 			return result, err
 		}
-		head, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+		ref, err := d.syncRef(ctx)
+		if err != nil {
+			return result, err
+		}
+		head, err := d.Repo.Revision(ctx, ref)
 		if err != nil {
 			return result, err
 		}
@@ -350,49 +507,38 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 				anythingAutomated = true
 			}
 			// find the service manifest
-			err := cluster.UpdateManifest(d.Manifests, working.Dir(), working.ManifestDirs(), serviceID, func(def []byte) ([]byte, error) {
-				newDef, err := d.Manifests.UpdatePolicies(def, serviceID, u)
-				if err != nil {
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusFailed,
-						Error:  err.Error(),
-					}
-					return nil, err
-				}
-				if string(newDef) == string(def) {
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusSkipped,
-					}
-				} else {
-					serviceIDs = append(serviceIDs, serviceID)
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusSuccess,
-					}
-				}
-				return newDef, nil
-			})
+			changed, err := cluster.UpdateManifestPolicies(d.Manifests, working.Dir(), working.ManifestDirs(), serviceID, u)
 			if err != nil {
-				switch err := err.(type) {
-				case cluster.ManifestError:
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusFailed,
-						Error:  err.Error(),
-					}
-				default:
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusFailed,
+					Error:  err.Error(),
+				}
+				if _, ok := err.(cluster.ManifestError); !ok {
 					return result, err
 				}
+				continue
+			}
+			if changed {
+				serviceIDs = append(serviceIDs, serviceID)
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusSuccess,
+				}
+			} else {
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusSkipped,
+				}
 			}
 		}
 		if len(serviceIDs) == 0 {
 			return result, nil
 		}
 
-		commitAuthor := ""
-		if d.GitConfig.SetAuthor {
-			commitAuthor = spec.Cause.User
+		commitAction, err := d.commitAction(spec, policyCommitMessage(updates, spec.Cause), policyChanges(updates, serviceIDs))
+		if err != nil {
+			return result, err
 		}
-		commitAction := git.CommitAction{Author: commitAuthor, Message: policyCommitMessage(updates, spec.Cause)}
-		if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec}); err != nil {
+		revision, err := d.commitAndPush(ctx, working, commitAction, &note{JobID: jobID, Spec: spec}, logger)
+		if err != nil {
 			// On the chance pushing failed because it was not
 			// possible to fast-forward, ask for a sync so the
 			// next attempt is more likely to succeed.
@@ -403,49 +549,150 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 			d.AskForImagePoll()
 		}
 
-		var err error
-		result.Revision, err = working.HeadRevision(ctx)
+		result.Revision = revision
+		return result, nil
+	}
+}
+
+// updateSelectedPolicies makes the same policy update to each of the
+// workloads selected, out of those running in the cluster and defined
+// in the repo. It's recorded as though each workload had been named
+// in a policy update.
+func (d *Daemon) updateSelectedPolicies(spec update.Spec, s update.PolicySelector) updateFunc {
+	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
+		workloads, err := d.Cluster.AllControllers("")
+		if err != nil {
+			return job.Result{}, errors.Wrap(err, "getting workloads from cluster")
+		}
+		resources, err := d.Manifests.LoadManifests(working.Dir(), working.ManifestDirs())
+		if err != nil {
+			return job.Result{}, manifestLoadError(err)
+		}
+		var defined []cluster.Controller
+		for _, w := range workloads {
+			if _, ok := resources[w.ID.String()]; ok && !w.IsSystem {
+				defined = append(defined, w)
+			}
+		}
+		ids, err := s.Select(defined)
 		if err != nil {
+			return job.Result{}, err
+		}
+		if len(ids) == 0 {
+			return job.Result{}, errors.New("no workloads defined in the repo match the patterns and label selector given")
+		}
+
+		updates := policy.Updates{}
+		for _, id := range ids {
+			updates[id] = s.Update
+		}
+		policySpec := update.Spec{Type: update.Policy, Cause: spec.Cause, Spec: updates}
+		return d.updatePolicy(policySpec, updates)(ctx, jobID, working, logger)
+	}
+}
+
+// updateHelmValues sets values in the manifest for a
+// FluxHelmRelease, and commits the change.
+func (d *Daemon) updateHelmValues(spec update.Spec, u update.HelmValueUpdates) updateFunc {
+	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
+		result := job.Result{
+			Spec:   &spec,
+			Result: update.Result{},
+		}
+		changed, err := cluster.UpdateManifestHelmValues(d.Manifests, working.Dir(), working.ManifestDirs(), u.Release, u.Values)
+		if err != nil {
+			result.Result[u.Release] = update.ControllerResult{
+				Status: update.ReleaseStatusFailed,
+				Error:  err.Error(),
+			}
+			if _, ok := err.(cluster.ManifestError); ok {
+				return result, nil
+			}
 			return result, err
 		}
+		if !changed {
+			result.Result[u.Release] = update.ControllerResult{
+				Status: update.ReleaseStatusSkipped,
+			}
+			return result, nil
+		}
+		result.Result[u.Release] = update.ControllerResult{
+			Status: update.ReleaseStatusSuccess,
+		}
+
+		commitMsg := spec.Cause.Message
+		if commitMsg == "" {
+			commitMsg = fmt.Sprintf("Set values in %s: %s", u.Release, helmValuesList(u.Values))
+		}
+		commitAction, err := d.commitAction(spec, commitMsg, helmValueChanges(u.Release, u.Values))
+		if err != nil {
+			return result, err
+		}
+		revision, err := d.commitAndPush(ctx, working, commitAction, &note{JobID: jobID, Spec: spec}, logger)
+		if err != nil {
+			// On the chance pushing failed because it was not
+			// possible to fast-forward, ask for a sync so the
+			// next attempt is more likely to succeed.
+			d.AskForSync()
+			return result, err
+		}
+		result.Revision = revision
 		return result, nil
 	}
 }
 
+func helmValuesList(values []cluster.HelmValue) string {
+	var kvs []string
+	for _, v := range values {
+		kvs = append(kvs, v.String())
+	}
+	return strings.Join(kvs, ", ")
+}
+
 func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
 		rc := release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working)
+		_, span := tracing.Start(ctx, "release.calculate")
 		result, err := release.Release(rc, c, logger)
+		span.Finish(err)
 
 		var zero job.Result
 		if err != nil {
 			return zero, err
 		}
 
-		var revision string
+		commitMsg := spec.Cause.Message
+		if commitMsg == "" {
+			commitMsg = c.CommitMessage(result)
+		}
+		commitAction, err := d.commitAction(spec, commitMsg, imageChanges(result))
+		if err != nil {
+			return zero, err
+		}
 
-		if c.ReleaseKind() == update.ReleaseKindExecute {
-			commitMsg := spec.Cause.Message
-			if commitMsg == "" {
-				commitMsg = c.CommitMessage(result)
-			}
-			commitAuthor := ""
-			if d.GitConfig.SetAuthor {
-				commitAuthor = spec.Cause.User
-			}
-			commitAction := git.CommitAction{Author: commitAuthor, Message: commitMsg}
-			if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec, Result: result}); err != nil {
-				// On the chance pushing failed because it was not
-				// possible to fast-forward, ask the repo to fetch
-				// from upstream ASAP, so the next attempt is more
-				// likely to succeed.
-				d.Repo.Notify()
-				return zero, err
-			}
-			revision, err = working.HeadRevision(ctx)
+		if c.ReleaseKind() != update.ReleaseKindExecute {
+			// The changes have been made in the working clone, but
+			// won't be committed; report what they would be.
+			diffs, err := working.Diffs(ctx)
 			if err != nil {
 				return zero, err
 			}
+			return job.Result{
+				Spec:          &spec,
+				Result:        result,
+				Diffs:         diffs,
+				CommitMessage: commitAction.Message,
+			}, nil
+		}
+
+		revision, err := d.commitAndPush(ctx, working, commitAction, &note{JobID: jobID, Spec: spec, Result: result}, logger)
+		if err != nil {
+			// On the chance pushing failed because it was not
+			// possible to fast-forward, ask the repo to fetch
+			// from upstream ASAP, so the next attempt is more
+			// likely to succeed.
+			d.Repo.Notify()
+			return zero, err
 		}
 		return job.Result{
 			Revision: revision,
@@ -455,6 +702,44 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 	}
 }
 
+// commitAndPush commits the changes made in the working clone, and
+// pushes them to the branch being synced; or, if pull requests are
+// configured, to a branch of their own, which is then proposed in a
+// pull request. It returns the revision pushed to the branch being
+// synced, which is empty if a pull request was opened instead.
+func (d *Daemon) commitAndPush(ctx context.Context, working *git.Checkout, commitAction git.CommitAction, n *note, logger log.Logger) (string, error) {
+	if d.PullRequests == nil {
+		if err := working.CommitAndPush(ctx, commitAction, n); err != nil {
+			return "", err
+		}
+		return working.HeadRevision(ctx)
+	}
+
+	branch, err := working.CommitAndPushBranch(ctx, commitAction, n, pullRequestBranchPrefix)
+	if err != nil {
+		return "", err
+	}
+	title, body := commitAction.Message, ""
+	if i := strings.Index(title, "\n"); i >= 0 {
+		title, body = title[:i], strings.TrimSpace(title[i+1:])
+	}
+	url, err := d.PullRequests.Open(ctx, pullrequest.PullRequest{
+		Head:  branch,
+		Base:  d.GitConfig.Branch,
+		Title: title,
+		Body:  body,
+	})
+	switch {
+	case err == pullrequest.ErrAlreadyOpen:
+		logger.Log("info", "pull request already open", "branch", branch)
+	case err != nil:
+		return "", errors.Wrapf(err, "opening pull request for branch %s", branch)
+	default:
+		logger.Log("info", "opened pull request", "branch", branch, "url", url)
+	}
+	return "", nil
+}
+
 // Tell the daemon to synchronise the cluster with the manifests in
 // the git repo. This has an error return value because upstream there
 // may be comms difficulties or other sources of problems; here, we
@@ -474,7 +759,11 @@ func (d *Daemon) NotifyChange(ctx context.Context, change v9.Change) error {
 		d.Repo.Notify()
 	case v9.ImageChange:
 		imageUpdate := change.Source.(v9.ImageUpdate)
-		d.ImageRefresh <- imageUpdate.Name
+		select {
+		case d.ImageRefresh <- imageUpdate.Name:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 	return nil
 }
@@ -530,7 +819,24 @@ func (d *Daemon) JobStatus(ctx context.Context, jobID job.ID) (job.Status, error
 // you'll get all the commits yet to be applied. If you send a hash
 // and it's applied at or _past_ it, you'll get an empty list.
 func (d *Daemon) SyncStatus(ctx context.Context, commitRef string) ([]string, error) {
-	commits, err := d.Repo.CommitsBetween(ctx, d.GitConfig.SyncTag, commitRef, d.GitConfig.Paths...)
+	var commits []git.Commit
+	var err error
+	if d.SyncState != nil {
+		// There's no sync tag to refer to, but the sync state keeps
+		// track of the last revision synced.
+		var synced string
+		synced, err = d.SyncState.GetRevision(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if synced != "" {
+			commits, err = d.Repo.CommitsBetween(ctx, synced, commitRef, d.GitConfig.Paths...)
+		} else {
+			commits, err = d.Repo.CommitsBefore(ctx, commitRef, d.GitConfig.Paths...)
+		}
+	} else {
+		commits, err = d.Repo.CommitsBetween(ctx, d.GitConfig.SyncTag, commitRef, d.GitConfig.Paths...)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -578,6 +884,12 @@ func (d *Daemon) WithClone(ctx context.Context, fn func(*git.Checkout) error) er
 }
 
 func (d *Daemon) LogEvent(ev event.Event) error {
+	if ev.ClusterID == "" {
+		ev.ClusterID = d.ClusterID
+	}
+	if d.Notifier != nil {
+		d.Notifier.Notify(ev)
+	}
 	if d.EventWriter == nil {
 		d.Logger.Log("event", ev, "logupstream", "false")
 		return nil
@@ -602,18 +914,21 @@ func containers2containers(cs []resource.Container) []v6.Container {
 }
 
 func getServiceContainers(service cluster.Controller, imageRepos update.ImageRepos, resource resource.Resource, fields []string) (res []v6.Container, err error) {
+	var policies policy.Set
+	if resource != nil {
+		policies = resource.Policy()
+	}
 	for _, c := range service.ContainersOrNil() {
-		imageRepo := c.Image.Name
-		var policies policy.Set
-		if resource != nil {
-			policies = resource.Policy()
+		if policy.IgnoresContainer(policies, c.Name) {
+			continue
 		}
+		imageRepo := c.Image.Name
 		tagPattern := policy.GetTagPattern(policies, c.Name)
 
 		images := imageRepos.GetRepoImages(imageRepo)
 		currentImage := images.FindWithRef(c.Image)
 
-		container, err := v6.NewContainer(c.Name, images, currentImage, tagPattern, fields)
+		container, err := v6.NewContainer(c.Name, images, imageRepos.GetRepoError(imageRepo), currentImage, tagPattern, fields)
 		if err != nil {
 			return res, err
 		}
@@ -660,6 +975,9 @@ func policyEvents(us policy.Updates, now time.Time) map[string]event.Event {
 					LogLevel:   event.LogLevelInfo,
 				}
 			}
+			if eventType == event.EventLock && e.Metadata == nil {
+				e.Metadata = lockEventMetadata(update.Add)
+			}
 			e.ServiceIDs = append(e.ServiceIDs, serviceID)
 			eventsByType[eventType] = e
 		}
@@ -667,6 +985,25 @@ func policyEvents(us policy.Updates, now time.Time) map[string]event.Event {
 	return eventsByType
 }
 
+// lockEventMetadata records who locked workloads, why, and until
+// when, from the policies added with the lock; or returns nil if none
+// of those were given.
+func lockEventMetadata(add policy.Set) event.EventMetadata {
+	user, _ := add.Get(policy.LockedUser)
+	msg, _ := add.Get(policy.LockedMsg)
+	until, _ := add.Get(policy.LockedUntil)
+	if user == "" && msg == "" && until == "" {
+		return nil
+	}
+	return &event.LockEventMetadata{User: user, Message: msg, Until: until}
+}
+
+// isLockDetail reports whether the policy is one recorded alongside
+// a lock, so counts as part of locking or unlocking.
+func isLockDetail(p policy.Policy) bool {
+	return p == policy.LockedUser || p == policy.LockedMsg || p == policy.LockedUntil
+}
+
 // policyEventTypes is a deduped list of all event types this update contains
 func policyEventTypes(u policy.Update) []string {
 	types := map[string]struct{}{}
@@ -676,6 +1013,7 @@ func policyEventTypes(u policy.Update) []string {
 			types[event.EventAutomate] = struct{}{}
 		case p == policy.Locked:
 			types[event.EventLock] = struct{}{}
+		case isLockDetail(p) && u.Add.Has(policy.Locked):
 		default:
 			types[event.EventUpdatePolicy] = struct{}{}
 		}
@@ -687,6 +1025,7 @@ func policyEventTypes(u policy.Update) []string {
 			types[event.EventDeautomate] = struct{}{}
 		case p == policy.Locked:
 			types[event.EventUnlock] = struct{}{}
+		case isLockDetail(p) && u.Remove.Has(policy.Locked):
 		default:
 			types[event.EventUpdatePolicy] = struct{}{}
 		}
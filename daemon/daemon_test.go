@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -17,6 +18,8 @@ import (
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/audit"
+	"github.com/weaveworks/flux/authz"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
@@ -27,10 +30,13 @@ import (
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/pullrequest"
 	"github.com/weaveworks/flux/registry"
 	registryMock "github.com/weaveworks/flux/registry/mock"
+	"github.com/weaveworks/flux/releasegate"
 	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/update"
+	"github.com/weaveworks/flux/vulnscan"
 )
 
 const (
@@ -135,6 +141,37 @@ func TestDaemon_ListServices(t *testing.T) {
 	}
 }
 
+// When I list services with options, only those matching are listed
+func TestDaemon_ListServicesWithOptions(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+
+	ctx := context.Background()
+	svcID := flux.MustParseResourceID(svc)
+
+	for _, c := range []struct {
+		name     string
+		opts     v10.ListServicesOptions
+		expected []flux.ResourceID
+	}{
+		{"all", v10.ListServicesOptions{}, []flux.ResourceID{svcID, flux.MustParseResourceID(anotherSvc)}},
+		{"out of date", v10.ListServicesOptions{OutOfDate: true}, []flux.ResourceID{svcID}},
+		{"out of date in namespace", v10.ListServicesOptions{Namespace: ns, OutOfDate: true}, []flux.ResourceID{svcID}},
+		{"none out of date in namespace", v10.ListServicesOptions{Namespace: "another", OutOfDate: true}, nil},
+	} {
+		services, err := d.ListServicesWithOptions(ctx, c.opts)
+		if !assert.NoError(t, err, c.name) {
+			continue
+		}
+		var got []flux.ResourceID
+		for _, s := range services {
+			got = append(got, s.ID)
+		}
+		assert.ElementsMatch(t, c.expected, got, c.name)
+	}
+}
+
 // When I call list images for a service, it should return images
 func TestDaemon_ListImagesWithOptions(t *testing.T) {
 	d, start, clean, _, _, _ := mockDaemon(t)
@@ -408,6 +445,56 @@ func TestDaemon_Release(t *testing.T) {
 
 }
 
+// When I plan a release, I should be told the changes it would make to
+// files and the message it would commit them with, and nothing should
+// be pushed
+func TestDaemon_ReleasePlan(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+
+	ctx := context.Background()
+	head, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := updateManifest(ctx, t, d, update.Spec{
+		Type: update.Images,
+		Spec: update.ReleaseSpec{
+			Kind:         update.ReleaseKindPlan,
+			ServiceSpecs: []update.ResourceSpec{update.ResourceSpecAll},
+			ImageSpec:    newHelloImage,
+		},
+	})
+	stat, err := d.JobStatus(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.StatusString != job.StatusSucceeded {
+		t.Fatalf("Expected %v but got %v", job.StatusSucceeded, stat.StatusString)
+	}
+	if stat.Result.Revision != "" {
+		t.Errorf("Expected no revision, got %q", stat.Result.Revision)
+	}
+	if !strings.Contains(stat.Result.CommitMessage, "Release "+newHelloImage) {
+		t.Errorf("Expected the commit message to describe the release, got %q", stat.Result.CommitMessage)
+	}
+	if len(stat.Result.Diffs) != 1 {
+		t.Fatalf("Expected a diff of one file, got %d", len(stat.Result.Diffs))
+	}
+	diff := stat.Result.Diffs[0]
+	if !strings.HasSuffix(diff.Path, "helloworld-deploy.yaml") || !strings.Contains(diff.Diff, "+        image: "+newHelloImage) {
+		t.Errorf("Expected the diff to update the image, got %s:\n%s", diff.Path, diff.Diff)
+	}
+
+	if after, err := d.Repo.Revision(ctx, d.GitConfig.Branch); err != nil {
+		t.Fatal(err)
+	} else if after != head {
+		t.Errorf("Expected nothing to be pushed, but the branch moved from %s to %s", head, after)
+	}
+}
+
 // When I update a policy, I expect it to add to the queue
 // When I update a policy, it should add an annotation to the manifest
 func TestDaemon_PolicyUpdate(t *testing.T) {
@@ -440,6 +527,157 @@ func TestDaemon_PolicyUpdate(t *testing.T) {
 	}, "Waiting for new annotation")
 }
 
+// When I update a policy, it should be recorded in the audit log,
+// along with the sync that follows
+func TestDaemon_Audit(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	d.Audit = audit.New(0)
+	start()
+	defer clean()
+	w := newWait(t)
+
+	// The user given in the cause is only what the caller says; who
+	// they were authenticated as is recorded too
+	ctx := authz.WithIdentities(context.Background(), "ops")
+	id := updateManifest(ctx, t, d, update.Spec{
+		Type:  update.Policy,
+		Cause: update.Cause{User: "alice", Message: "hold off"},
+		Spec: policy.Updates{
+			flux.MustParseResourceID(svc): {Add: policy.Set{policy.Locked: "true"}},
+		},
+	})
+	stat := w.ForJobSucceeded(d, id)
+
+	var policyRecord audit.Record
+	w.Eventually(func() bool {
+		// Keep asking, in case a sync happens before the commit is
+		// fetched
+		d.AskForSync()
+		// Automated updates may be committed on top of the policy
+		// update, so any sync after it will do
+		var synced bool
+		for _, r := range d.AuditRecords(context.Background(), audit.Query{}) {
+			switch {
+			case r.Action == audit.Policy:
+				policyRecord = r
+			case r.Action == audit.Sync && policyRecord.JobID != "" && r.Time.After(policyRecord.Time):
+				synced = true
+			}
+		}
+		return synced
+	}, "Waiting for the policy update and its sync to be recorded")
+
+	assert.Equal(t, string(id), policyRecord.JobID)
+	assert.Equal(t, "alice", policyRecord.User)
+	assert.Equal(t, []string{"ops"}, policyRecord.Identities)
+	assert.Equal(t, "hold off", policyRecord.Message)
+	assert.Equal(t, stat.Result.Revision, policyRecord.Revision)
+	assert.Equal(t, []flux.ResourceID{flux.MustParseResourceID(svc)}, policyRecord.Workloads)
+	assert.Equal(t, "Locked: "+svc, policyRecord.Summary)
+}
+
+func TestDaemon_PolicyUpdate_PullRequest(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	prs := &mockPullRequests{}
+	d.PullRequests = prs
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	id := updatePolicy(ctx, t, d)
+	stat := w.ForJobSucceeded(d, id)
+	if stat.Result.Revision != "" {
+		t.Errorf("expected no revision to be reported for a pull request, got %q", stat.Result.Revision)
+	}
+
+	prs.Lock()
+	defer prs.Unlock()
+	if len(prs.opened) != 1 {
+		t.Fatalf("expected one pull request to be opened, got %d", len(prs.opened))
+	}
+	pr := prs.opened[0]
+	if pr.Base != d.GitConfig.Branch || !strings.HasPrefix(pr.Head, pullRequestBranchPrefix) {
+		t.Errorf("unexpected pull request %+v", pr)
+	}
+}
+
+// When a lock expires, the workload should be unlocked
+func TestDaemon_LockExpiry(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	id := updateManifest(ctx, t, d, update.Spec{
+		Type: update.Policy,
+		Spec: policy.Updates{
+			flux.MustParseResourceID(svc): {
+				Add: policy.Set{
+					policy.Locked:      "true",
+					policy.LockedUser:  "alice",
+					policy.LockedUntil: "2000-01-01T00:00:00Z",
+				},
+			},
+		},
+	})
+	w.ForJobSucceeded(d, id)
+	d.AskForSync()
+
+	w.Eventually(func() bool {
+		// Cloning may fail while the unlock is being pushed; try
+		// again if so
+		co, err := d.Repo.Clone(ctx, d.GitConfig)
+		if err != nil {
+			return false
+		}
+		defer co.Clean()
+		m, err := d.Manifests.LoadManifests(co.Dir(), co.ManifestDirs())
+		if err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+		p := m[svc].Policy()
+		return !p.Has(policy.Locked) && !p.Has(policy.LockedUser) && !p.Has(policy.LockedUntil)
+	}, "Waiting for expired lock to be removed")
+}
+
+// When I update the policies of selected workloads, only those in the
+// cluster and the repo which match should be updated
+func TestDaemon_SelectedPolicyUpdate(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	id := updateManifest(ctx, t, d, update.Spec{
+		Type: update.Policies,
+		Spec: update.PolicySelector{
+			Workloads: []string{"*:deployment/*"},
+			Update: policy.Update{
+				Add: policy.Set{policy.Locked: "true"},
+			},
+		},
+	})
+	stat := w.ForJobSucceeded(d, id)
+
+	// The other workload in the cluster isn't defined in the repo
+	expected := update.Result{
+		flux.MustParseResourceID(svc): {Status: update.ReleaseStatusSuccess},
+	}
+	if !reflect.DeepEqual(stat.Result.Result, expected) {
+		t.Errorf("expected result %+v, got %+v", expected, stat.Result.Result)
+	}
+
+	if _, err := d.UpdateManifests(ctx, update.Spec{
+		Type: update.Policies,
+		Spec: update.PolicySelector{LabelSelector: "name in (", Update: policy.Update{}},
+	}); err == nil {
+		t.Error("expected an error for a malformed label selector")
+	}
+}
+
 // When I call sync status, it should return a commit showing the sync
 // that is about to take place. Then it should return empty once it is
 // complete
@@ -511,6 +749,333 @@ func TestDaemon_Automated(t *testing.T) {
 	w.ForImageTag(t, d, svc, container, "2")
 }
 
+func TestDaemon_Automated_batched(t *testing.T) {
+	d, start, clean, k8s, _, _ := mockDaemon(t)
+	d.ImageUpdateBatchWindow = 200 * time.Millisecond
+	start()
+	defer clean()
+	w := newWait(t)
+
+	service := cluster.Controller{
+		ID: flux.MakeResourceID(ns, "deployment", "helloworld"),
+		Containers: cluster.ContainersOrExcuse{
+			Containers: []resource.Container{
+				{
+					Name:  container,
+					Image: mustParseImageRef(currentHelloImage),
+				},
+			},
+		},
+	}
+	k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{service}, nil
+	}
+
+	// The update is held back for the batch window, then made
+	w.ForImageTag(t, d, svc, container, "2")
+}
+
+func TestDaemon_Automated_window(t *testing.T) {
+	d, start, clean, k8s, _, restart := mockDaemon(t)
+	// A window that never opens
+	closed, err := policy.ParseWindow("* * 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.AutomationWindow = closed
+	service := cluster.Controller{
+		ID: flux.MakeResourceID(ns, "deployment", "helloworld"),
+		Containers: cluster.ContainersOrExcuse{
+			Containers: []resource.Container{
+				{
+					Name:  container,
+					Image: mustParseImageRef(currentHelloImage),
+				},
+			},
+		},
+	}
+	k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{service}, nil
+	}
+	start()
+	defer clean()
+	w := newWait(t)
+
+	// The update is held while outside the window ..
+	time.Sleep(200 * time.Millisecond)
+	w.ForImageTag(t, d, svc, container, mustParseImageRef(currentHelloImage).Tag)
+
+	// .. and made once it's open
+	restart(func() {
+		d.AutomationWindow = nil
+	})
+	w.ForImageTag(t, d, svc, container, "2")
+}
+
+type gateFunc func(releasegate.Update) releasegate.Result
+
+func (f gateFunc) Check(ctx context.Context, u releasegate.Update) (releasegate.Result, error) {
+	return f(u), nil
+}
+
+func TestDaemon_Automated_releaseGate(t *testing.T) {
+	d, start, clean, k8s, _, restart := mockDaemon(t)
+	var (
+		mu    sync.Mutex
+		asked []releasegate.Update
+	)
+	d.ReleaseGate = gateFunc(func(u releasegate.Update) releasegate.Result {
+		mu.Lock()
+		asked = append(asked, u)
+		mu.Unlock()
+		return releasegate.Result{Decision: releasegate.Delay, Reason: "canary analysis running"}
+	})
+	service := cluster.Controller{
+		ID: flux.MakeResourceID(ns, "deployment", "helloworld"),
+		Containers: cluster.ContainersOrExcuse{
+			Containers: []resource.Container{
+				{
+					Name:  container,
+					Image: mustParseImageRef(currentHelloImage),
+				},
+			},
+		},
+	}
+	k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{service}, nil
+	}
+	start()
+	defer clean()
+	w := newWait(t)
+
+	// The update is delayed while the gate says so ..
+	w.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(asked) > 0
+	}, "Waiting for the release gate to be asked about the update")
+	w.ForImageTag(t, d, svc, container, mustParseImageRef(currentHelloImage).Tag)
+	mu.Lock()
+	assert.Equal(t, service.ID, asked[0].Workload)
+	assert.Equal(t, "2", asked[0].Target.Tag)
+	mu.Unlock()
+
+	// .. and made once it says to proceed
+	restart(func() {
+		d.ReleaseGate = gateFunc(func(releasegate.Update) releasegate.Result {
+			return releasegate.Result{Decision: releasegate.Proceed}
+		})
+	})
+	w.ForImageTag(t, d, svc, container, "2")
+}
+
+type scannerFunc func(image string) vulnscan.Report
+
+func (f scannerFunc) Scan(ctx context.Context, image string) (vulnscan.Report, error) {
+	return f(image), nil
+}
+
+func TestDaemon_Automated_rollbackOnFailure(t *testing.T) {
+	d, start, clean, k8s, events, restart := mockDaemon(t)
+	registry := d.Registry
+	d.Registry = &registryMock.Registry{Images: []image.Info{makeImageInfo(currentHelloImage, time.Now())}}
+	service := cluster.Controller{
+		ID: flux.MakeResourceID(ns, "deployment", "helloworld"),
+		Containers: cluster.ContainersOrExcuse{
+			Containers: []resource.Container{
+				{
+					Name:  container,
+					Image: mustParseImageRef(currentHelloImage),
+				},
+			},
+		},
+	}
+	k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{service}, nil
+	}
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	w.ForJobSucceeded(d, updateManifest(ctx, t, d, update.Spec{
+		Type: update.Policy,
+		Spec: policy.Updates{
+			flux.MustParseResourceID(svc): {
+				Add: policy.Set{policy.RollbackOnFailure: "true"},
+			},
+		},
+	}))
+
+	// Once there's a new image, the workload is updated to it, and
+	// its rollout watched ..
+	restart(func() {
+		d.Registry = registry
+	})
+	w.ForImageTag(t, d, svc, container, "2")
+	hasEvent := func(eventType string) func() bool {
+		return func() bool {
+			evs, _ := events.AllEvents(time.Time{}, -1, time.Time{})
+			for _, ev := range evs {
+				if ev.Type == eventType {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	w.Eventually(hasEvent(event.EventAutoRelease), "timeout waiting for the automated release to be synced")
+
+	// .. and when the rollout fails, the update is reverted
+	restart(func() {
+		if _, ok := d.watchedRollouts[service.ID]; !ok {
+			t.Fatalf("expected the rollout of %s to be watched", service.ID)
+		}
+		failed := service
+		failed.Containers = cluster.ContainersOrExcuse{
+			Containers: []resource.Container{{Name: container, Image: mustParseImageRef("quay.io/weaveworks/helloworld:2")}},
+		}
+		failed.Status = cluster.StatusError
+		failed.Rollout.Messages = []string{"Deployment has timed out progressing."}
+		k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+			return []cluster.Controller{failed}, nil
+		}
+		d.checkRollouts(log.NewNopLogger())
+	})
+	w.Eventually(hasEvent(event.EventAutoRollback), "timeout waiting for the rollout to be rolled back")
+	w.ForImageTag(t, d, svc, container, mustParseImageRef(currentHelloImage).Tag)
+
+	// The image that failed isn't tried again
+	restart(func() {
+		k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+			return []cluster.Controller{service}, nil
+		}
+		d.pollForNewImages(log.NewNopLogger())
+		select {
+		case <-d.Jobs.Ready():
+			t.Error("expected no update to the image that failed to roll out")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestDaemon_Automated_vulnScan(t *testing.T) {
+	d, start, clean, k8s, events, restart := mockDaemon(t)
+	var images []image.Info
+	for i, ref := range []string{oldHelloImage, currentHelloImage, newHelloImage} {
+		info := makeImageInfo(ref, time.Now().Add(time.Duration(i)*time.Second))
+		info.Digest = fmt.Sprintf("sha256:%d", i)
+		images = append(images, info)
+	}
+	d.Registry = &registryMock.Registry{Images: images}
+	var scanned []string
+	d.VulnThreshold = vulnscan.Medium
+	d.VulnScanner = scannerFunc(func(image string) vulnscan.Report {
+		scanned = append(scanned, image)
+		return vulnscan.Report{Vulnerabilities: []vulnscan.Vulnerability{{ID: "CVE-2019-0001", Severity: vulnscan.Critical}}}
+	})
+	service := cluster.Controller{
+		ID: flux.MakeResourceID(ns, "deployment", "helloworld"),
+		Containers: cluster.ContainersOrExcuse{
+			Containers: []resource.Container{
+				{
+					Name:  container,
+					Image: mustParseImageRef(currentHelloImage),
+				},
+			},
+		},
+	}
+	k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{service}, nil
+	}
+	start()
+	defer clean()
+	w := newWait(t)
+
+	// The new image is passed over, and an event recorded ..
+	w.Eventually(func() bool {
+		evs, _ := events.AllEvents(time.Time{}, -1, time.Time{})
+		for _, ev := range evs {
+			if ev.Type == event.EventRejectImage {
+				return true
+			}
+		}
+		return false
+	}, "timeout waiting for the image to be rejected")
+	w.ForImageTag(t, d, svc, container, mustParseImageRef(currentHelloImage).Tag)
+
+	// .. until the scanner finds nothing wrong with it
+	restart(func() {
+		// Only the image newer than the current one is scanned
+		assert.Equal(t, "quay.io/weaveworks/helloworld@sha256:2", scanned[0])
+		d.vulnScans = nil
+		d.VulnScanner = scannerFunc(func(string) vulnscan.Report {
+			return vulnscan.Report{Vulnerabilities: []vulnscan.Vulnerability{{ID: "CVE-2019-0002", Severity: vulnscan.Low}}}
+		})
+	})
+	w.ForImageTag(t, d, svc, container, "2")
+}
+
+func TestDaemon_forgetVulnScans(t *testing.T) {
+	now := time.Now()
+	d := &Daemon{LoopVars: &LoopVars{vulnScans: map[string]vulnScan{
+		"sha256:old":    {scannedAt: now.Add(-vulnScanForget - time.Minute), rejected: "bad"},
+		"sha256:recent": {scannedAt: now.Add(-vulnScanRecheck), rejected: "bad"},
+	}}}
+	d.forgetVulnScans(now)
+	assert.Equal(t, map[string]vulnScan{
+		"sha256:recent": {scannedAt: now.Add(-vulnScanRecheck), rejected: "bad"},
+	}, d.vulnScans)
+}
+
+func TestDaemon_Automated_approval(t *testing.T) {
+	d, start, clean, k8s, _, _ := mockDaemon(t)
+	d.RequireApproval = true
+	service := cluster.Controller{
+		ID: flux.MakeResourceID(ns, "deployment", "helloworld"),
+		Containers: cluster.ContainersOrExcuse{
+			Containers: []resource.Container{
+				{
+					Name:  container,
+					Image: mustParseImageRef(currentHelloImage),
+				},
+			},
+		},
+	}
+	k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{service}, nil
+	}
+	start()
+	defer clean()
+	w := newWait(t)
+
+	// The update waits to be approved ..
+	ctx := context.Background()
+	var pending []v10.PendingRelease
+	w.Eventually(func() bool {
+		pending = d.PendingReleases(ctx)
+		return len(pending) > 0
+	}, "timeout waiting for the update to be staged")
+	if len(pending) != 1 || pending[0].Workload != service.ID || len(pending[0].Changes) != 1 {
+		t.Fatalf("expected a single pending release for %s, got %+v", service.ID, pending)
+	}
+	if target := pending[0].Changes[0].Target; !strings.HasSuffix(target, ":2") {
+		t.Errorf("expected the update to be to helloworld:2, got %s", target)
+	}
+	w.ForImageTag(t, d, svc, container, mustParseImageRef(currentHelloImage).Tag)
+
+	// .. and is made once it's approved
+	if _, err := d.ApproveRelease(ctx, "not-an-id", update.Cause{}); err == nil {
+		t.Error("expected an error approving a release that isn't pending")
+	}
+	id, err := d.ApproveRelease(ctx, pending[0].ID, update.Cause{User: "approver"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.ForJobSucceeded(d, id)
+	w.ForImageTag(t, d, svc, container, "2")
+}
+
 func TestDaemon_Automated_semver(t *testing.T) {
 	d, start, clean, k8s, _, _ := mockDaemon(t)
 	start()
@@ -708,6 +1273,18 @@ func (w *mockEventWriter) AllEvents(_ time.Time, _ int64, _ time.Time) ([]event.
 	return w.events, nil
 }
 
+type mockPullRequests struct {
+	opened []pullrequest.PullRequest
+	sync.Mutex
+}
+
+func (m *mockPullRequests) Open(_ context.Context, pr pullrequest.PullRequest) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.opened = append(m.opened, pr)
+	return "https://example.com/pulls/1", nil
+}
+
 // DAEMON TEST HELPERS
 type wait struct {
 	t       *testing.T
@@ -829,3 +1406,93 @@ func updateManifest(ctx context.Context, t *testing.T, d *Daemon, spec update.Sp
 	}
 	return id
 }
+
+func TestDaemon_Graph(t *testing.T) {
+	d, start, clean, k8s, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+
+	release := flux.MustParseResourceID("default:fluxhelmrelease/helloworld")
+	allServices := k8s.AllServicesFunc
+	k8s.AllServicesFunc = func(maybeNamespace string) ([]cluster.Controller, error) {
+		controllers, err := allServices(maybeNamespace)
+		return append(controllers, cluster.Controller{
+			ID:         flux.MustParseResourceID("default:deployment/helloworld-chart"),
+			Antecedent: release,
+		}), err
+	}
+
+	graph, err := d.Graph(context.Background(), ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if graph.Revision == "" {
+		t.Error("expected the revision of the repo to be given")
+	}
+	if len(graph.Workloads) != 2 {
+		t.Fatalf("expected 2 workloads, got %+v", graph.Workloads)
+	}
+	hello := graph.Workloads[0]
+	if hello.Path != "helloworld-deploy.yaml" || hello.Line == 0 {
+		t.Errorf("expected %s to be found in git, got %+v", svc, hello)
+	}
+	if len(hello.Containers) != 1 || hello.Containers[0].Image != currentHelloImage {
+		t.Errorf("expected the image running to be given, got %+v", hello.Containers)
+	}
+	chart := graph.Workloads[1]
+	if chart.Path != "" || chart.Antecedent != release || chart.AntecedentPath != "" {
+		t.Errorf("expected only the antecedent, which is not in git, got %+v", chart)
+	}
+}
+
+func TestDaemon_Diff(t *testing.T) {
+	d, start, clean, k8s, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+
+	const created = "default:deployment/locked-service"
+	k8s.CompareFunc = func(resources map[string]resource.Resource) map[string]cluster.Comparison {
+		comparisons := map[string]cluster.Comparison{}
+		for id := range resources {
+			switch id {
+			case svc:
+				comparisons[id] = cluster.Comparison{Applied: []byte("replicas: 2\n"), Live: []byte("replicas: 1\n")}
+			case created:
+				comparisons[id] = cluster.Comparison{Applied: []byte("replicas: 1\n")}
+			default:
+				comparisons[id] = cluster.Comparison{Applied: []byte("replicas: 1\n"), Live: []byte("replicas: 1\n")}
+			}
+		}
+		return comparisons
+	}
+
+	diff, err := d.Diff(context.Background(), ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Revision == "" {
+		t.Error("expected the revision of the repo to be given")
+	}
+	statuses := map[string]v10.ResourceDiff{}
+	for _, r := range diff.Resources {
+		if ns, _, _ := r.ID.Components(); ns != "default" {
+			t.Errorf("expected only resources in the namespace given, got %s", r.ID)
+		}
+		statuses[r.ID.String()] = r
+	}
+	hello := statuses[svc]
+	if hello.Status != v10.DiffUpdate || hello.Path != "helloworld-deploy.yaml" {
+		t.Errorf("expected %s to be updated, got %+v", svc, hello)
+	}
+	if !strings.Contains(hello.Diff, "-replicas: 1\n+replicas: 2\n") {
+		t.Errorf("expected a diff of the change, got:\n%s", hello.Diff)
+	}
+	if r := statuses[created]; r.Status != v10.DiffCreate || !strings.Contains(r.Diff, "--- /dev/null") {
+		t.Errorf("expected %s to be created, got %+v", created, r)
+	}
+	for id, r := range statuses {
+		if id != svc && id != created && (r.Status != v10.DiffUnchanged || r.Diff != "") {
+			t.Errorf("expected %s to be unchanged, got %+v", id, r)
+		}
+	}
+}
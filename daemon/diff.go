@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// Diff compares the manifests at the head of the branch with the
+// resources in the cluster (or in the namespace given), and gives
+// for each a diff of what syncing would change, without syncing.
+// Resources marked as ignored, or that otherwise wouldn't be synced,
+// are left out.
+func (d *Daemon) Diff(ctx context.Context, namespace string) (v10.Diff, error) {
+	var diff v10.Diff
+	comparer, ok := d.Cluster.(cluster.Comparer)
+	if !ok {
+		return diff, errors.New("resources can't be compared with this cluster")
+	}
+
+	var resources map[string]resource.Resource
+	var loadErr error
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		var err error
+		if diff.Revision, err = checkout.HeadRevision(ctx); err != nil {
+			return errors.Wrap(err, "getting the revision of the repo")
+		}
+		resources, loadErr = d.Manifests.LoadManifests(checkout.Dir(), checkout.ManifestDirs())
+		return nil
+	})
+	if err != nil {
+		return diff, err
+	}
+	if loadErr != nil {
+		return diff, manifestLoadError(loadErr)
+	}
+
+	compare := map[string]resource.Resource{}
+	for id, res := range resources {
+		if ns, _, _ := res.ResourceID().Components(); namespace != "" && ns != namespace {
+			continue
+		}
+		if res.Policy().Has(policy.Ignore) {
+			continue
+		}
+		compare[id] = res
+	}
+
+	diff.Resources = []v10.ResourceDiff{}
+	for id, cmp := range comparer.Compare(compare) {
+		if cmp.Skipped {
+			continue
+		}
+		res := compare[id]
+		rd := v10.ResourceDiff{ID: res.ResourceID(), Path: res.Source()}
+		switch {
+		case cmp.Error != nil:
+			rd.Status, rd.Error = v10.DiffError, cmp.Error.Error()
+		case cmp.Live == nil:
+			rd.Status = v10.DiffCreate
+		case string(cmp.Live) == string(cmp.Applied):
+			rd.Status = v10.DiffUnchanged
+		default:
+			rd.Status = v10.DiffUpdate
+		}
+		if rd.Status == v10.DiffCreate || rd.Status == v10.DiffUpdate {
+			if rd.Diff, err = unifiedDiff(rd.ID.String(), cmp.Live, cmp.Applied); err != nil {
+				return diff, err
+			}
+		}
+		diff.Resources = append(diff.Resources, rd)
+	}
+	sort.Slice(diff.Resources, func(i, j int) bool {
+		return diff.Resources[i].ID.String() < diff.Resources[j].ID.String()
+	})
+	return diff, nil
+}
+
+// unifiedDiff gives the changes from the definition in the cluster
+// to the definition to be applied, with the resource named in the
+// header. A resource not in the cluster is diffed against nothing,
+// so its whole definition is shown as added.
+func unifiedDiff(name string, live, applied []byte) (string, error) {
+	from := "live/" + name
+	if live == nil {
+		from = "/dev/null"
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(live),
+		B:        splitLines(applied),
+		FromFile: from,
+		ToFile:   "git/" + name,
+		Context:  3,
+	})
+}
+
+// splitLines splits a definition into lines, each ending in a newline,
+// as difflib expects.
+func splitLines(def []byte) []string {
+	if len(def) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(string(def), "\n"), "\n")
+	lines[len(lines)-1] += "\n"
+	return lines
+}
@@ -60,3 +60,51 @@ daemon if possible:
 `,
 	}
 }
+
+func readOnlyRepoError(operation string) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  fmt.Errorf("cannot %s: the git repo is read-only", operation),
+		Help: `Cannot make changes to a read-only git repo
+
+Flux has been started with --git-readonly, meaning it will not commit
+or push anything to the git repo. Operations that would change the
+manifests in git (releasing images, changing policies such as
+automated or locked) are therefore not possible.
+
+You can still make these changes by committing them to the git repo
+yourself, and flux will sync them to the cluster as usual.
+`,
+	}
+}
+
+func policySelectorError(reason error) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  reason,
+		Help: `Cannot select workloads for the policy update
+
+Workloads are selected by giving patterns for their IDs, e.g.,
+'default:deployment/*', and/or a label selector, e.g., 'team=payments'.
+At least one of these must be given. Patterns use '*' to match any
+characters other than '/', and '?' to match a single character;
+label selectors use the same syntax as kubectl's --selector.
+`,
+	}
+}
+
+func unknownPendingReleaseError(id string) error {
+	return &fluxerr.Error{
+		Type: fluxerr.Missing,
+		Err:  fmt.Errorf("no pending release %q", id),
+		Help: `Pending release not found
+
+Automated releases waiting for approval are found again each time
+flux looks for new images; a release that has been superseded -- for
+instance, because there is an even newer image, or the workload is no
+longer automated -- is replaced or dropped, and can't be approved.
+
+Use 'fluxctl list-pending' to see the releases waiting for approval.
+`,
+	}
+}
@@ -0,0 +1,73 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/resource"
+)
+
+// Graph relates each workload in the cluster (or in the namespace
+// given) to the file in git it's defined in, to the resource it was
+// created because of, if there is one -- e.g., the FluxHelmRelease
+// for a workload created by the Helm operator -- and to the images it
+// runs. Workloads not defined in git (and antecedents likewise) are
+// given without a path.
+func (d *Daemon) Graph(ctx context.Context, namespace string) (v10.Graph, error) {
+	var graph v10.Graph
+	controllers, err := d.Cluster.AllControllers(namespace)
+	if err != nil {
+		return graph, errors.Wrap(err, "getting workloads from cluster")
+	}
+
+	var resources map[string]resource.Resource
+	var loadErr error
+	err = d.WithClone(ctx, func(checkout *git.Checkout) error {
+		var err error
+		if graph.Revision, err = checkout.HeadRevision(ctx); err != nil {
+			return errors.Wrap(err, "getting the revision of the repo")
+		}
+		resources, loadErr = d.Manifests.LoadManifests(checkout.Dir(), checkout.ManifestDirs())
+		return nil
+	})
+	// Without a repo to look in, there are no paths to give; but the
+	// workloads and their antecedents are still worth knowing.
+	_, notReady := err.(git.NotReadyError)
+	switch {
+	case notReady || err == git.ErrNoConfig:
+	case err != nil:
+		return graph, err
+	case loadErr != nil:
+		return graph, manifestLoadError(loadErr)
+	}
+
+	source := func(id string) (string, int) {
+		if res, ok := resources[id]; ok {
+			return res.Source(), resource.SourceLine(res)
+		}
+		return "", 0
+	}
+	graph.Workloads = []v10.WorkloadGraph{}
+	for _, c := range controllers {
+		w := v10.WorkloadGraph{
+			ID:         c.ID,
+			Antecedent: c.Antecedent,
+		}
+		w.Path, w.Line = source(c.ID.String())
+		if c.Antecedent != (flux.ResourceID{}) {
+			w.AntecedentPath, w.AntecedentLine = source(c.Antecedent.String())
+		}
+		for _, container := range c.ContainersOrNil() {
+			w.Containers = append(w.Containers, v10.ContainerGraph{
+				Name:  container.Name,
+				Image: container.Image.String(),
+			})
+		}
+		graph.Workloads = append(graph.Workloads, w)
+	}
+	return graph, nil
+}
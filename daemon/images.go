@@ -3,17 +3,27 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/releasegate"
 	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/update"
 )
 
 func (d *Daemon) pollForNewImages(logger log.Logger) {
+	if d.Repo.ReadOnly() {
+		logger.Log("msg", "git repo is read-only; not checking for automated image updates")
+		return
+	}
 	logger.Log("msg", "polling images")
 
 	ctx := context.Background()
@@ -25,6 +35,9 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 	}
 	if len(candidateServices) == 0 {
 		logger.Log("msg", "no automated services")
+		if d.RequireApproval {
+			d.stageForApproval(&update.Automated{}, logger)
+		}
 		return
 	}
 	// Find images to check
@@ -41,32 +54,48 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 	}
 
 	changes := &update.Automated{}
+	// Updates for workloads outside their automation window are held
+	// until it opens; they'll be found again then.
+	held := &update.Automated{}
+	now := time.Now()
 	for _, service := range services {
 		var p policy.Set
 		if resource, ok := candidateServices[service.ID]; ok {
 			p = resource.Policy()
 		}
+		inWindow := d.inAutomationWindow(p, now, log.With(logger, "service", service.ID))
 	containers:
 		for _, container := range service.ContainersOrNil() {
+			if policy.IgnoresContainer(p, container.Name) {
+				continue containers
+			}
 			currentImageID := container.Image
 			pattern := policy.GetTagPattern(p, container.Name)
 			repo := currentImageID.Name
 			logger := log.With(logger, "service", service.ID, "container", container.Name, "repo", repo, "pattern", pattern, "current", currentImageID)
 
-			filteredImages := imageRepos.GetRepoImages(repo).FilterAndSort(pattern)
+			repoImages := imageRepos.GetRepoImages(repo)
+			filteredImages := repoImages.FilterAndSort(pattern)
 
-			if latest, ok := filteredImages.Latest(); ok && latest.ID != currentImageID {
+			latest, ok := d.latestAcceptedImage(ctx, service.ID, container, filteredImages, p.Has(policy.PinDigest), logger)
+			if !ok {
+				continue containers
+			}
+			newImage, changed := update.UpdatedImage(currentImageID, latest, p.Has(policy.PinDigest))
+			if changed {
 				if latest.ID.Tag == "" {
 					logger.Log("warning", "untagged image in available images", "action", "skip container")
 					continue containers
 				}
 				currentCreatedAt := ""
 				for _, info := range filteredImages {
-					if info.CreatedAt.IsZero() {
+					// Images ordered by their tags can
+					// do without timestamps
+					if info.CreatedAt.IsZero() && !policy.OrdersByTag(pattern) {
 						logger.Log("warning", "image with zero created timestamp", "image", info.ID, "action", "skip container")
 						continue containers
 					}
-					if info.ID == currentImageID {
+					if info.ID == currentImageID.WithDigest("") {
 						currentCreatedAt = info.CreatedAt.String()
 					}
 				}
@@ -74,16 +103,149 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 					currentCreatedAt = "filtered out or missing"
 					logger.Log("warning", "current image not in filtered images", "action", "proceed anyway")
 				}
-				newImage := currentImageID.WithNewTag(latest.ID.Tag)
-				changes.Add(service.ID, container, newImage)
-				logger.Log("info", "added update to automation run", "new", newImage, "reason", fmt.Sprintf("latest %s (%s) > current %s (%s)", latest.ID.Tag, latest.CreatedAt, currentImageID.Tag, currentCreatedAt))
+				// An image whose rollout failed, and was rolled
+				// back, isn't tried again; a newer one will be
+				if failed, ok := d.rolloutFailed[service.ID.String()+":"+container.Name]; ok {
+					if failed.CanonicalRef() == newImage.CanonicalRef() {
+						logger.Log("info", "skipping image that failed to roll out", "new", newImage)
+						continue containers
+					}
+					delete(d.rolloutFailed, service.ID.String()+":"+container.Name)
+				}
+				if !inWindow {
+					held.Add(service.ID, container, newImage)
+					continue containers
+				}
+				changelog, err := update.NewChangelog(repoImages.FindWithRef(currentImageID).Labels, latest.Labels, d.CompareURLTemplate)
+				if err != nil {
+					logger.Log("warning", err)
+				}
+				changes.Changes = append(changes.Changes, update.Change{
+					ServiceID: service.ID,
+					Container: container,
+					ImageID:   newImage,
+					Changelog: changelog,
+				})
+				logger.Log("info", "added update to automation run", "new", newImage, "reason", fmt.Sprintf("latest %s (%s) > current %s (%s)", newImage.TagWithDigest(), latest.CreatedAt, currentImageID.TagWithDigest(), currentCreatedAt))
 			}
 		}
 	}
 
-	if len(changes.Changes) > 0 {
-		d.UpdateManifests(ctx, update.Spec{Type: update.Auto, Spec: changes})
+	heldUpdates.Set(float64(len(held.Changes)))
+	if len(held.Changes) > 0 {
+		logger.Log("msg", "automated image updates held outside automation window", "held", len(held.Changes), "summary", summariseChanges(held))
+	}
+
+	if len(changes.Changes) == 0 {
+		d.imageUpdatesSince = time.Time{}
+		if d.RequireApproval {
+			d.stageForApproval(changes, logger)
+		}
+		return
+	}
+	if d.ImageUpdateBatchWindow > 0 {
+		// Each poll finds all the updates still to be made, so
+		// holding off until the window has passed means they all
+		// end up in a single commit.
+		now := time.Now()
+		if d.imageUpdatesSince.IsZero() {
+			d.imageUpdatesSince = now
+		}
+		if wait := d.imageUpdatesSince.Add(d.ImageUpdateBatchWindow).Sub(now); wait > 0 {
+			logger.Log("msg", "batching automated image updates", "pending", len(changes.Changes), "wait", wait)
+			time.AfterFunc(wait, d.AskForImagePoll)
+			return
+		}
+		d.imageUpdatesSince = time.Time{}
+	}
+	if d.ReleaseGate != nil {
+		changes = d.checkReleaseGate(ctx, changes, logger)
+	}
+	// With approval required, the updates wait to be approved (with
+	// `fluxctl approve`) rather than being committed now
+	if d.RequireApproval {
+		d.stageForApproval(changes, logger)
+		return
+	}
+	if len(changes.Changes) == 0 {
+		return
+	}
+	d.UpdateManifests(ctx, update.Spec{Type: update.Auto, Spec: changes})
+}
+
+// checkReleaseGate asks the release gate about each of the changes
+// given, and returns those that may go ahead. Changes that are
+// delayed are found again on the next poll, and asked about again;
+// those that are aborted are skipped until there's a different image
+// to update to.
+func (d *Daemon) checkReleaseGate(ctx context.Context, changes *update.Automated, logger log.Logger) *update.Automated {
+	if d.releaseGateAborted == nil {
+		d.releaseGateAborted = map[string]image.Ref{}
+	}
+	proceed := &update.Automated{}
+	for _, change := range changes.Changes {
+		key := change.ServiceID.String() + ":" + change.Container.Name
+		if aborted, ok := d.releaseGateAborted[key]; ok && aborted == change.ImageID {
+			continue
+		}
+		delete(d.releaseGateAborted, key)
+
+		logger := log.With(logger, "service", change.ServiceID, "container", change.Container.Name, "new", change.ImageID)
+		result, err := d.ReleaseGate.Check(ctx, releasegate.Update{
+			Workload:  change.ServiceID,
+			Container: change.Container.Name,
+			Current:   change.Container.Image,
+			Target:    change.ImageID,
+		})
+		if err != nil {
+			// Better to wait than to make an update that may not
+			// be wanted
+			releaseGateDecisions.With(fluxmetrics.LabelDecision, "error").Add(1)
+			logger.Log("warning", "could not check release gate; delaying update", "err", err)
+			continue
+		}
+		releaseGateDecisions.With(fluxmetrics.LabelDecision, string(result.Decision)).Add(1)
+		switch result.Decision {
+		case releasegate.Proceed:
+			proceed.Changes = append(proceed.Changes, change)
+		case releasegate.Delay:
+			logger.Log("info", "release gate delayed update", "reason", result.Reason)
+		case releasegate.Abort:
+			d.releaseGateAborted[key] = change.ImageID
+			logger.Log("info", "release gate aborted update", "reason", result.Reason)
+		}
+	}
+	return proceed
+}
+
+// inAutomationWindow reports whether automated updates may be made to
+// a workload with the policies given, at the time given: that is,
+// whether it's in the workload's automation window, or if it doesn't
+// have one, the daemon's.
+func (d *Daemon) inAutomationWindow(p policy.Set, now time.Time, logger log.Logger) bool {
+	window := d.AutomationWindow
+	if expr, ok := p.Get(policy.AutomationWindow); ok {
+		w, err := policy.ParseWindow(expr)
+		if err != nil {
+			// Better to hold updates than make them when they
+			// may not be wanted
+			logger.Log("warning", "invalid automation window; holding updates", "err", err)
+			return false
+		}
+		window = w
+	}
+	return window == nil || window.Contains(now)
+}
+
+// summariseChanges lists the updates given, briefly, as
+// `workload:container -> tag`.
+func summariseChanges(changes *update.Automated) string {
+	var lines []string
+	for _, change := range changes.Changes {
+		lines = append(lines, fmt.Sprintf("%s:%s -> %s", change.ServiceID, change.Container.Name, change.ImageID.TagWithDigest()))
 	}
+	sort.Strings(lines)
+	return strings.Join(lines, ", ")
 }
 
 type resources map[flux.ResourceID]resource.Resource
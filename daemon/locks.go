@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+// unlockExpired queues a policy update to unlock the workloads whose
+// locks have expired, unless one is already waiting to be run. The
+// resources are those just loaded by a sync, from the head of the
+// branch.
+func (d *Daemon) unlockExpired(ctx context.Context, resources map[string]resource.Resource, logger log.Logger) {
+	if d.Repo.ReadOnly() {
+		return
+	}
+	if d.unlockJob != "" {
+		if status, ok := d.JobStatusCache.Status(d.unlockJob); ok &&
+			(status.StatusString == job.StatusQueued || status.StatusString == job.StatusRunning) {
+			return
+		}
+		d.unlockJob = ""
+	}
+
+	now := time.Now()
+	updates := policy.Updates{}
+	var expired []flux.ResourceID
+	for _, resource := range resources {
+		if policy.LockExpired(resource.Policy(), now) {
+			id := resource.ResourceID()
+			updates[id] = policy.Update{
+				Remove: policy.Set{}.
+					Add(policy.Locked).
+					Add(policy.LockedMsg).
+					Add(policy.LockedUser).
+					Add(policy.LockedUntil),
+			}
+			expired = append(expired, id)
+		}
+	}
+	if len(updates) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+	defer cancel()
+	id, err := d.UpdateManifests(ctx, update.Spec{
+		Type:  update.Policy,
+		Cause: update.Cause{Message: "Unlock workloads whose locks have expired"},
+		Spec:  updates,
+	})
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "unlocking workloads with expired locks"))
+		return
+	}
+	d.unlockJob = id
+	logger.Log("info", "unlocking workloads with expired locks", "workloads", len(expired), "jobID", id)
+}
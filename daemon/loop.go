@@ -3,35 +3,136 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/audit"
 	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/commitstatus"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/job"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/resource"
 	fluxsync "github.com/weaveworks/flux/sync"
+	"github.com/weaveworks/flux/tracing"
 	"github.com/weaveworks/flux/update"
 )
 
 const (
 	// Timeout for git operations we're prepared to abandon
 	gitOpTimeout = 15 * time.Second
+	// Timeout for posting a commit status to the git provider
+	commitStatusTimeout = 10 * time.Second
+	// How long to wait for definitions applied from one path to be
+	// established, before moving on to the next path
+	establishedTimeout = time.Minute
 )
 
 type LoopVars struct {
 	SyncInterval         time.Duration
 	RegistryPollInterval time.Duration
+	// Apply the manifests from each git path in turn, in the order
+	// given, rather than all at once
+	SyncPathsInOrder bool
+	// How often to reapply unchanged resources under each git path,
+	// if not on every sync
+	PathSyncIntervals map[string]time.Duration
+	// How long to wait, after finding new images for automated
+	// workloads, for any more to turn up before committing the
+	// updates together; zero means commit them straight away
+	ImageUpdateBatchWindow time.Duration
+	// When automated image updates may be made, unless a workload
+	// has its own automation window; nil means at any time
+	AutomationWindow *policy.Window
+	// Makes a link to the changes between the revisions the old and
+	// new images in an automated update were built from, when their
+	// labels say; nil means no links are made
+	CompareURLTemplate *template.Template
+	// Stage automated image updates as pending releases, which are
+	// only committed once approved, rather than committing them
+	// straight away
+	RequireApproval bool
+	// If syncing a new revision results in at least this many
+	// resources failing to apply, apply the previous revision
+	// again; zero means never roll back
+	RollbackErrorThreshold int
+	// How long the rollout of an automated image update has to
+	// finish, for workloads with the rollback_on_failure policy and
+	// no duration of their own, before the update is reverted; zero
+	// means only revert rollouts that report having failed
+	AutomationRollbackTimeout time.Duration
 
 	initOnce       sync.Once
 	syncSoon       chan struct{}
 	pollImagesSoon chan struct{}
+
+	// The last commit status posted, so we don't post the same one
+	// after every sync. Only used from the loop.
+	lastStatusRev string
+	lastStatus    commitstatus.Status
+
+	// When each resource was last applied, for those that are
+	// reapplied less often than every sync. Only used from the loop.
+	applied map[string]appliedRecord
+
+	// When new images were first found for automated workloads,
+	// since the last automated update. Only used from the loop.
+	imageUpdatesSince time.Time
+
+	// The image each container was going to be updated to, when the
+	// release gate aborted the update, so it's not asked again
+	// about the same image. Only used from the loop.
+	releaseGateAborted map[string]image.Ref
+
+	// What the vulnerability scanner made of each image, by digest,
+	// so images aren't scanned on every poll. Only used from the
+	// loop.
+	vulnScans map[string]vulnScan
+
+	// The rollouts of automated image updates being watched, to
+	// revert them if they fail. Only used from the loop.
+	watchedRollouts map[flux.ResourceID]watchedRollout
+
+	// The image each container was updated to when its rollout
+	// failed and was reverted, so it's not updated to that image
+	// again. Only used from the loop.
+	rolloutFailed map[string]image.Ref
+
+	// The automated releases waiting to be approved, by ID; these
+	// are approved from outside the loop, so are guarded by
+	// pendingMu.
+	pendingMu sync.Mutex
+	pending   map[string]*pendingRelease
+
+	// The job queued to unlock workloads whose locks have expired,
+	// so another isn't queued while it's waiting. Only used from
+	// the loop.
+	unlockJob job.ID
+
+	// The resources claimed by other shards syncing from the same
+	// repo, with the shard that claimed each, as of the last sync.
+	// Only used from the loop.
+	claimConflicts map[flux.ResourceID]string
+
+	// A revision that was rolled back, and shouldn't be synced
+	// again. Only used from the loop.
+	rolledBackFrom string
+
+	// The outcome of the last sync, for reporting status; this is
+	// read from outside the loop, so is guarded by syncResultMu.
+	syncResultMu sync.RWMutex
+	syncResult   v10.SyncResult
 }
 
 func (loop *LoopVars) ensureInit() {
@@ -51,6 +152,10 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 	// Similarly checking to see if any controllers have new images
 	// available.
 	imagePollTimer := time.NewTimer(d.RegistryPollInterval)
+	// And checking the rollouts of automated image updates, for
+	// workloads that revert them if they fail.
+	rolloutTicker := time.NewTicker(rolloutCheckInterval)
+	defer rolloutTicker.Stop()
 
 	// Keep track of current HEAD, so we can know when to treat a repo
 	// mirror notification as a change. Otherwise, we'll just sync
@@ -76,6 +181,8 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 			imagePollTimer.Reset(d.RegistryPollInterval)
 		case <-imagePollTimer.C:
 			d.AskForImagePoll()
+		case <-rolloutTicker.C:
+			d.checkRollouts(logger)
 		case <-d.syncSoon:
 			if !syncTimer.Stop() {
 				select {
@@ -85,19 +192,27 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 			}
 			if err := d.doSync(logger); err != nil {
 				logger.Log("err", err)
+				d.recordSyncError(err)
 			}
 			syncTimer.Reset(d.SyncInterval)
 		case <-syncTimer.C:
 			d.AskForSync()
 		case <-d.Repo.C:
 			ctx, cancel := context.WithTimeout(context.Background(), gitOpTimeout)
-			newSyncHead, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+			ref, err := d.syncRef(ctx)
+			var newSyncHead string
+			if err == nil {
+				newSyncHead, err = d.Repo.Revision(ctx, ref)
+			}
+			if err == nil {
+				d.recordRevisionLag(ctx, newSyncHead)
+			}
 			cancel()
 			if err != nil {
 				logger.Log("url", d.Repo.Origin().URL, "err", err)
 				continue
 			}
-			logger.Log("event", "refreshed", "url", d.Repo.Origin().URL, "branch", d.GitConfig.Branch, "HEAD", newSyncHead)
+			logger.Log("event", "refreshed", "url", d.Repo.Origin().URL, "ref", ref, "HEAD", newSyncHead)
 			if newSyncHead != syncHead {
 				syncHead = newSyncHead
 				d.AskForSync()
@@ -159,10 +274,12 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 	// We don't care how long this takes overall, only about not
 	// getting bogged down in certain operations, so use an
 	// undeadlined context in general.
-	ctx := context.Background()
+	ctx, span := tracing.Start(context.Background(), "sync")
+	defer func() { span.Finish(retErr) }()
 
 	// checkout a working clone so we can mess around with tags later
 	var working *git.Checkout
+	var onBranch bool
 	{
 		var err error
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
@@ -172,42 +289,119 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 			return err
 		}
 		defer working.Clean()
+
+		// If we're syncing a tag rather than the branch, move the
+		// working clone to it.
+		ref, err := d.syncRef(ctx)
+		if err != nil {
+			return err
+		}
+		if ref != d.GitConfig.Branch {
+			if err := working.Checkout(ctx, ref); err != nil {
+				return err
+			}
+		}
+		onBranch = ref == d.GitConfig.Branch
 	}
 
 	// For comparison later.
-	oldTagRev, err := working.SyncRevision(ctx)
-	if err != nil && !isUnknownRevision(err) {
-		return err
+	var oldTagRev string
+	var err error
+	if d.SyncState != nil {
+		oldTagRev, err = d.SyncState.GetRevision(ctx)
+		if err != nil {
+			return errors.Wrap(err, "getting revision last synced")
+		}
+	} else {
+		oldTagRev, err = working.SyncRevision(ctx)
+		if err != nil && !isUnknownRevision(err) {
+			return err
+		}
 	}
 
 	newTagRev, err := working.HeadRevision(ctx)
 	if err != nil {
 		return err
 	}
+	headRev := newTagRev
+	span.SetTag("revision", newTagRev)
+
+	// If this revision had to be rolled back, don't try it again;
+	// stick with the revision rolled back to until there's a new one.
+	if d.rolledBackFrom != "" && newTagRev == d.rolledBackFrom && oldTagRev != "" {
+		logger.Log("warning", "not syncing revision that was rolled back", "revision", newTagRev, "syncing", oldTagRev)
+		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+		err := working.Checkout(ctx, oldTagRev)
+		cancel()
+		if err != nil {
+			return err
+		}
+		newTagRev = oldTagRev
+	}
 
 	// Get a map of all resources defined in the repo
+	_, loadSpan := tracing.Start(ctx, "manifests.load")
 	allResources, err := d.Manifests.LoadManifests(working.Dir(), working.ManifestDirs())
+	loadSpan.SetTag("resources", strconv.Itoa(len(allResources)))
+	loadSpan.Finish(err)
 	if err != nil {
-		return errors.Wrap(err, "loading resources from repo")
+		err = errors.Wrap(err, "loading resources from repo")
+		d.postCommitStatus(logger, newTagRev, err, nil)
+		return err
+	}
+
+	// When what's being synced is the head of the branch, the same
+	// resources tell which locks have expired; otherwise, wait for a
+	// sync that is.
+	if onBranch && newTagRev == headRev {
+		d.unlockExpired(ctx, allResources, logger)
+	}
+
+	if d.Claims != nil {
+		if err := d.claimResources(ctx, allResources, logger); err != nil {
+			err = errors.Wrap(err, "claiming resources")
+			d.postCommitStatus(logger, newTagRev, err, nil)
+			return err
+		}
 	}
 
 	var syncErrors []event.ResourceError
-	// TODO supply deletes argument from somewhere (command-line?)
-	if err := fluxsync.Sync(d.Manifests, allResources, d.Cluster, false, logger); err != nil {
+	_, applySpan := tracing.Start(ctx, "sync.apply")
+	err = d.applyResources(working, allResources, logger)
+	applySpan.Finish(err)
+	if err != nil {
 		logger.Log("err", err)
 		switch syncerr := err.(type) {
-		case cluster.SyncError:
-			for _, e := range syncerr {
-				syncErrors = append(syncErrors, event.ResourceError{
-					ID:    e.ResourceID(),
-					Path:  e.Source(),
-					Error: e.Error.Error(),
-				})
+		case cluster.ValidationError:
+			// Nothing was applied, so don't record this as synced
+			for _, e := range resourceErrors(syncerr.SyncError) {
+				logger.Log("err", e.Error, "resource", e.ID, "path", e.Path, "line", e.Line)
 			}
+			d.postCommitStatus(logger, newTagRev, err, nil)
+			return err
+		case cluster.SyncError:
+			syncErrors = resourceErrors(syncerr)
 		default:
+			d.postCommitStatus(logger, newTagRev, err, nil)
 			return err
 		}
 	}
+	if d.shouldRollBack(oldTagRev, newTagRev, syncErrors) {
+		return d.rollBack(working, oldTagRev, newTagRev, syncErrors, logger)
+	}
+	// Resources left to other shards aren't counted towards rolling
+	// back, but are reported, since the repo says to apply them
+	syncErrors = append(syncErrors, d.claimErrors(allResources)...)
+	d.postCommitStatus(logger, newTagRev, nil, syncErrors)
+	d.recordSynced(newTagRev, syncErrors)
+	lastSyncTimestamp.Set(float64(time.Now().Unix()))
+	syncResources.With(fluxmetrics.LabelSuccess, "true").Set(float64(len(allResources) - len(syncErrors)))
+	syncResources.With(fluxmetrics.LabelSuccess, "false").Set(float64(len(syncErrors)))
+	{
+		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+		d.recordRevisionLag(ctx, headRev)
+		cancel()
+	}
 
 	// update notes and emit events for applied commits
 
@@ -343,6 +537,7 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 					},
 				})
 				includes[event.EventAutoRelease] = true
+				d.watchRollouts(commits[i].Revision, n.Result, allResources, logger)
 			case update.Policy:
 				// Use this to mean any change to policy
 				includes[event.EventUpdatePolicy] = true
@@ -358,6 +553,17 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 			cs[i].Revision = c.Revision
 			cs[i].Message = c.Message
 		}
+		syncRecord := audit.Record{
+			Time:      started,
+			Action:    audit.Sync,
+			Workloads: serviceIDs.ToSlice(),
+			Revision:  newTagRev,
+			Summary:   fmt.Sprintf("synced %d commit(s)", len(commits)),
+		}
+		if len(syncErrors) > 0 {
+			syncRecord.Error = fmt.Sprintf("%d resource(s) failed to apply", len(syncErrors))
+		}
+		d.recordAudit(syncRecord, logger)
 		if err = d.LogEvent(event.Event{
 			ServiceIDs: serviceIDs.ToSlice(),
 			Type:       event.EventSync,
@@ -385,7 +591,20 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 		}
 	}
 
-	// Move the tag and push it so we know how far we've gotten.
+	// Record how far we've gotten, either in the sync state given, or
+	// by moving the tag and pushing it.
+	if d.SyncState != nil {
+		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+		err := d.SyncState.UpdateMarker(ctx, newTagRev)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "recording revision synced")
+		}
+		if oldTagRev != newTagRev {
+			logger.Log("synced", newTagRev, "old", oldTagRev)
+		}
+		return nil
+	}
 	{
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
 		err := working.MoveSyncTagAndPush(ctx, newTagRev, "Sync pointer")
@@ -406,8 +625,157 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 	return nil
 }
 
+// syncRef returns the ref that should be synced to the cluster: the
+// configured tag, the latest tag matching the configured pattern, or
+// if neither is given, the branch.
+func (d *Daemon) syncRef(ctx context.Context) (string, error) {
+	switch {
+	case d.GitConfig.Tag != "":
+		return d.GitConfig.Tag, nil
+	case d.GitConfig.TagPattern != "":
+		return d.Repo.LatestTag(ctx, d.GitConfig.TagPattern, d.GitConfig.SyncTag)
+	default:
+		return d.GitConfig.Branch, nil
+	}
+}
+
+// recordRevisionLag sets the metric for how many commits the revision
+// last synced is behind the head given.
+func (d *Daemon) recordRevisionLag(ctx context.Context, head string) {
+	d.syncResultMu.RLock()
+	synced := d.syncResult.Revision
+	d.syncResultMu.RUnlock()
+	if synced == "" {
+		return
+	}
+	commits, err := d.Repo.CommitsBetween(ctx, synced, head)
+	if err != nil {
+		return
+	}
+	syncRevisionLag.Set(float64(len(commits)))
+}
+
 func isUnknownRevision(err error) bool {
 	return err != nil &&
 		(strings.Contains(err.Error(), "unknown revision or path not in the working tree.") ||
 			strings.Contains(err.Error(), "bad revision"))
 }
+
+// resourceErrors gives the errors from a sync in the form in which
+// they are reported.
+func resourceErrors(syncErr cluster.SyncError) []event.ResourceError {
+	var errs []event.ResourceError
+	for _, e := range syncErr {
+		errs = append(errs, event.ResourceError{
+			ID:    e.ResourceID(),
+			Path:  e.Source(),
+			Line:  resource.SourceLine(e.Resource),
+			Error: e.Error.Error(),
+		})
+	}
+	return errs
+}
+
+// applyResources syncs the resources given to the cluster. If the
+// paths are to be synced in order, the resources from each path are
+// applied in turn, and any definitions among them (e.g., CRDs) given
+// a chance to be established before moving on to the next path. All
+// the paths are loaded before any is applied; but if a path fails
+// validation once those before it have been applied, the sync is
+// reported as partly applied (a cluster.SyncError) rather than as
+// having failed validation.
+func (d *Daemon) applyResources(working *git.Checkout, allResources map[string]resource.Resource, logger log.Logger) error {
+	apply := func(resources map[string]resource.Resource) error {
+		now := time.Now()
+		due := d.dueResources(d.unclaimedResources(resources), now, logger)
+		// TODO supply deletes argument from somewhere (command-line?)
+		err := fluxsync.Sync(d.Manifests, due, d.Cluster, false, logger)
+		d.recordApplied(due, err, now)
+		return err
+	}
+
+	dirs := working.ManifestDirs()
+	if !d.SyncPathsInOrder || len(dirs) < 2 {
+		return apply(allResources)
+	}
+
+	pathResources := make([]map[string]resource.Resource, len(dirs))
+	for i, dir := range dirs {
+		resources, err := d.Manifests.LoadManifests(working.Dir(), []string{dir})
+		if err != nil {
+			return errors.Wrap(err, "loading resources from repo")
+		}
+		pathResources[i] = resources
+	}
+
+	var syncErrs cluster.SyncError
+	for i, dir := range dirs {
+		resources := pathResources[i]
+		if err := apply(resources); err != nil {
+			switch err := err.(type) {
+			case cluster.ValidationError:
+				if i == 0 {
+					return err
+				}
+				// The paths before this one have been applied, so
+				// this can't be reported as nothing having been
+				// applied
+				logger.Log("err", "validation failed; not applying this or later paths", "path", dir, "applied", strings.Join(dirs[:i], ","))
+				return append(syncErrs, err.SyncError...)
+			case cluster.SyncError:
+				syncErrs = append(syncErrs, err...)
+			default:
+				return err
+			}
+		}
+		if waiter, ok := d.Cluster.(cluster.EstablishedWaiter); ok {
+			var applied []resource.Resource
+			for _, res := range resources {
+				applied = append(applied, res)
+			}
+			if err := waiter.WaitEstablished(applied, establishedTimeout); err != nil {
+				logger.Log("warning", "continuing with next path", "path", dir, "err", err)
+			}
+		}
+	}
+	// If `nil`, syncErrs is a cluster.SyncError(nil) rather than error(nil)
+	if syncErrs != nil {
+		return syncErrs
+	}
+	return nil
+}
+
+// postCommitStatus reports the outcome of syncing a revision to the
+// git provider, if the daemon has been configured to do so. Failing
+// to post the status is logged, but otherwise ignored.
+func (d *Daemon) postCommitStatus(logger log.Logger, rev string, syncErr error, resourceErrors []event.ResourceError) {
+	if d.CommitStatus == nil {
+		return
+	}
+	status := commitstatus.Status{
+		State:       commitstatus.Success,
+		Description: "Synced to cluster",
+	}
+	switch {
+	case syncErr != nil:
+		status.State = commitstatus.Failure
+		status.Description = "Sync failed: " + syncErr.Error()
+	case len(resourceErrors) > 0:
+		status.State = commitstatus.Failure
+		var ids []string
+		for _, e := range resourceErrors {
+			ids = append(ids, e.ID.String())
+		}
+		status.Description = fmt.Sprintf("Sync failed for %d resource(s): %s", len(ids), strings.Join(ids, ", "))
+	}
+	if rev == d.lastStatusRev && status == d.lastStatus {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commitStatusTimeout)
+	defer cancel()
+	if err := d.CommitStatus.Post(ctx, rev, status); err != nil {
+		logger.Log("err", errors.Wrap(err, "posting commit status"), "revision", rev)
+		return
+	}
+	d.lastStatusRev, d.lastStatus = rev, status
+}
@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -17,12 +18,14 @@ import (
 	"github.com/weaveworks/flux/cluster"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/commitstatus"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
 	"github.com/weaveworks/flux/job"
 	registryMock "github.com/weaveworks/flux/registry/mock"
 	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
 )
 
 const (
@@ -309,3 +312,403 @@ func TestDoSync_WithNewCommit(t *testing.T) {
 		t.Errorf("Should have moved sync tag to HEAD (%s), but was moved to: %s", newRevision, revs[len(revs)-1].Revision)
 	}
 }
+
+type recordingStatusPoster struct {
+	revisions []string
+	statuses  []commitstatus.Status
+}
+
+func (p *recordingStatusPoster) Post(ctx context.Context, rev string, status commitstatus.Status) error {
+	p.revisions = append(p.revisions, rev)
+	p.statuses = append(p.statuses, status)
+	return nil
+}
+
+func TestDoSync_PostsCommitStatus(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	poster := &recordingStatusPoster{}
+	d.CommitStatus = poster
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		return nil
+	}
+
+	logger := log.NewLogfmtLogger(ioutil.Discard)
+	if err := d.doSync(logger); err != nil {
+		t.Fatal(err)
+	}
+	if len(poster.statuses) != 1 || poster.statuses[0].State != commitstatus.Success {
+		t.Fatalf("expected a single success status, got %+v", poster.statuses)
+	}
+
+	head, err := d.Repo.Revision(context.Background(), "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poster.revisions[0] != head {
+		t.Errorf("expected status for %s, got %s", head, poster.revisions[0])
+	}
+
+	// The same outcome for the same revision isn't posted again
+	if err := d.doSync(logger); err != nil {
+		t.Fatal(err)
+	}
+	if len(poster.statuses) != 1 {
+		t.Errorf("expected no further statuses, got %+v", poster.statuses)
+	}
+}
+
+func TestDoSync_WithSyncState(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	state := &fluxsync.InMemoryState{}
+	d.SyncState = state
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		return nil
+	}
+
+	ctx := context.Background()
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := d.Repo.Revision(ctx, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced, err := state.GetRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced != head {
+		t.Errorf("expected sync state to record %s, got %s", head, synced)
+	}
+
+	// The sync tag should not have been created
+	if _, err := d.Repo.Revision(ctx, gitSyncTag); err == nil {
+		t.Errorf("expected no sync tag, but found one")
+	}
+
+	revs, err := d.SyncStatus(ctx, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 0 {
+		t.Errorf("expected nothing left to sync, got %v", revs)
+	}
+}
+
+func TestDoSync_RollsBack(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	state := &fluxsync.InMemoryState{}
+	d.SyncState = state
+	d.RollbackErrorThreshold = 1
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		return nil
+	}
+
+	ctx := context.Background()
+	logger := log.NewLogfmtLogger(ioutil.Discard)
+	if err := d.doSync(logger); err != nil {
+		t.Fatal(err)
+	}
+	goodRevision, err := state.GetRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Push a change which will fail to apply
+	var badRevision string
+	err = d.WithClone(ctx, func(checkout *git.Checkout) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err := cluster.UpdateManifest(k8s, checkout.Dir(), checkout.ManifestDirs(), flux.MustParseResourceID("default:deployment/helloworld"), func(def []byte) ([]byte, error) {
+			return []byte(strings.Replace(string(def), "replicas: 5", "replicas: 4", -1)), nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := checkout.CommitAndPush(ctx, git.CommitAction{Message: "bad commit"}, nil); err != nil {
+			return err
+		}
+		badRevision, err = checkout.HeadRevision(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var syncs []cluster.SyncDef
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		syncs = append(syncs, def)
+		if len(syncs) == 1 {
+			return cluster.SyncError{{Resource: def.Actions[0].Apply, Error: errors.New("boom")}}
+		}
+		return nil
+	}
+	if err := d.doSync(logger); err == nil {
+		t.Fatal("expected an error from a sync that was rolled back")
+	}
+	if len(syncs) != 2 {
+		t.Fatalf("expected the failed sync and the rollback, got %d syncs", len(syncs))
+	}
+
+	// The revision recorded is still the good one
+	synced, err := state.GetRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced != goodRevision {
+		t.Errorf("expected %s to still be recorded as synced, got %s", goodRevision, synced)
+	}
+
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := es[len(es)-1]
+	if last.Type != event.EventRollback {
+		t.Fatalf("expected a rollback event, got %#v", last)
+	}
+	if metadata := last.Metadata.(*event.RollbackEventMetadata); metadata.FailedRevision != badRevision || metadata.Revision != goodRevision {
+		t.Errorf("unexpected rollback metadata %+v", metadata)
+	}
+
+	// The bad revision isn't tried again
+	syncs = nil
+	if err := d.doSync(logger); err != nil {
+		t.Fatal(err)
+	}
+	if len(syncs) != 1 {
+		t.Errorf("expected one sync of the good revision, got %d", len(syncs))
+	}
+}
+
+func TestDoSync_RecordsStatus(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	head, err := d.Repo.Revision(context.Background(), "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := d.Status(context.Background())
+	if status.Git.Status != string(git.RepoReady) || status.Git.Error != "" {
+		t.Errorf("expected git repo to be ready, got %+v", status.Git)
+	}
+	if status.LastSync.Revision != head || status.LastSync.Time.IsZero() || status.LastSync.Error != "" {
+		t.Errorf("expected last sync of %s, got %+v", head, status.LastSync)
+	}
+
+	d.recordSyncError(errors.New("boom"))
+	status = d.Status(context.Background())
+	if status.LastSync.Revision != head || status.LastSync.Error != "boom" {
+		t.Errorf("expected failed sync after %s, got %+v", head, status.LastSync)
+	}
+}
+
+func TestDoSync_RecordsResourceErrors(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	var failed resource.Resource
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		failed = def.Actions[0].Apply
+		return cluster.SyncError{{Resource: failed, Error: errors.New("boom")}}
+	}
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+
+	status := d.Status(context.Background())
+	if len(status.LastSync.Errors) != 1 {
+		t.Fatalf("expected one resource error, got %+v", status.LastSync)
+	}
+	e := status.LastSync.Errors[0]
+	if e.ID != failed.ResourceID() || e.Path != failed.Source() || e.Line < 1 || e.Error != "boom" {
+		t.Errorf("expected error for %s in %s, with line, got %+v", failed.ResourceID(), failed.Source(), e)
+	}
+
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata *event.SyncEventMetadata
+	for _, ev := range es {
+		if ev.Type == event.EventSync {
+			metadata = ev.Metadata.(*event.SyncEventMetadata)
+		}
+	}
+	if metadata == nil || len(metadata.Errors) != 1 || metadata.Errors[0].Line != e.Line {
+		t.Errorf("expected sync event to report the error, got %+v", metadata)
+	}
+}
+
+func TestDoSync_PathsInOrderPartlyApplied(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.SyncPathsInOrder = true
+	d.GitConfig.Paths = []string{"test", "charts"}
+
+	var applied resource.Resource
+	var syncs int
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		syncs++
+		if syncs == 1 {
+			applied = def.Actions[0].Apply
+			return nil
+		}
+		return cluster.ValidationError{SyncError: cluster.SyncError{{Resource: applied, Error: errors.New("invalid")}}}
+	}
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	if syncs != 2 {
+		t.Fatalf("expected each path to be synced, got %d syncs", syncs)
+	}
+
+	head, err := d.Repo.Revision(context.Background(), "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := d.Status(context.Background())
+	if status.LastSync.Revision != head || len(status.LastSync.Errors) != 1 {
+		t.Errorf("expected the partly applied sync of %s to be recorded with its error, got %+v", head, status.LastSync)
+	}
+}
+
+// claimsByOthers has every resource not in mine claimed by another
+// shard.
+type claimsByOthers struct {
+	mine map[flux.ResourceID]bool
+}
+
+func (c claimsByOthers) Claim(ctx context.Context, ids []flux.ResourceID) (map[flux.ResourceID]string, error) {
+	conflicts := map[flux.ResourceID]string{}
+	for _, id := range ids {
+		if !c.mine[id] {
+			conflicts[id] = "other"
+		}
+	}
+	return conflicts, nil
+}
+
+func TestDoSync_LeavesResourcesClaimedByOthers(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	helloworld := flux.MustParseResourceID("default:deployment/helloworld")
+	d.Claims = claimsByOthers{mine: map[flux.ResourceID]bool{helloworld: true}}
+	var applied []flux.ResourceID
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		for _, action := range def.Actions {
+			applied = append(applied, action.Apply.ResourceID())
+		}
+		return nil
+	}
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 1 || applied[0] != helloworld {
+		t.Errorf("expected only %s to be applied, got %v", helloworld, applied)
+	}
+	status := d.Status(context.Background())
+	if len(status.LastSync.Errors) == 0 {
+		t.Fatal("expected the resources claimed by another shard to be reported")
+	}
+	for _, e := range status.LastSync.Errors {
+		if e.ID == helloworld || !strings.Contains(e.Error, `"other"`) {
+			t.Errorf("unexpected error %+v", e)
+		}
+	}
+}
+
+func TestReady(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	k8s.PingFunc = func() error { return nil }
+	if err := d.Ready(context.Background()); err != nil {
+		t.Errorf("expected daemon to be ready, got %s", err)
+	}
+
+	k8s.PingFunc = func() error { return errors.New("connection refused") }
+	if err := d.Ready(context.Background()); err == nil {
+		t.Error("expected daemon not to be ready when the cluster is unreachable")
+	}
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	k8s.PingFunc = func() error { <-unblock; return nil }
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.Ready(ctx); err == nil {
+		t.Error("expected daemon not to be ready when the cluster doesn't answer in time")
+	}
+}
+
+func TestDueResources(t *testing.T) {
+	d := &Daemon{LoopVars: &LoopVars{
+		PathSyncIntervals: map[string]time.Duration{"crds": time.Hour},
+	}}
+	resources, err := kresource.ParseMultidoc([]byte(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: often
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: rarely
+  annotations:
+    flux.weave.works/sync_interval: 1h
+`), "app/manifests.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crds, err := kresource.ParseMultidoc([]byte(`---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+`), "crds/widgets.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range crds {
+		resources[id] = res
+	}
+
+	logger := log.NewLogfmtLogger(ioutil.Discard)
+	now := time.Now()
+	if due := d.dueResources(resources, now, logger); len(due) != 3 {
+		t.Fatalf("expected everything to be due the first time, got %d", len(due))
+	}
+	d.recordApplied(resources, nil, now)
+
+	due := d.dueResources(resources, now.Add(time.Minute), logger)
+	if len(due) != 1 {
+		t.Errorf("expected only the resource without an interval to be due, got %v", due)
+	}
+	if _, ok := due["default:configmap/often"]; !ok {
+		t.Errorf("expected default:configmap/often to be due, got %v", due)
+	}
+
+	if due := d.dueResources(resources, now.Add(2*time.Hour), logger); len(due) != 3 {
+		t.Errorf("expected everything to be due once the interval has passed, got %d", len(due))
+	}
+}
@@ -18,6 +18,29 @@ var (
 		Buckets:   []float64{0.5, 5, 10, 20, 30, 40, 50, 60, 75, 90, 120, 240},
 	}, []string{fluxmetrics.LabelSuccess})
 
+	// Alerting on how long ago this was is the way to find out
+	// that flux hasn't synced for a while, whatever the reason.
+	lastSyncTimestamp = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "last_sync_timestamp_seconds",
+		Help:      "Time of the last successful git-to-cluster synchronisation, in seconds since the epoch.",
+	}, []string{})
+
+	syncResources = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "sync_resources_count",
+		Help:      "Count of resources applied in the last synchronisation, by whether they were applied successfully.",
+	}, []string{fluxmetrics.LabelSuccess})
+
+	syncRevisionLag = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "sync_revision_lag_count",
+		Help:      "Count of commits in the upstream git repo that have not yet been synced.",
+	}, []string{})
+
 	// For most jobs, the majority of the time will be spent pushing
 	// changes (git objects and refs) upstream.
 	jobDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
@@ -44,4 +67,39 @@ var (
 		Name:      "queue_length_count",
 		Help:      "Count of jobs waiting in the queue to be run.",
 	}, []string{})
+
+	heldUpdates = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "automation_held_updates_count",
+		Help:      "Count of automated image updates held because they are outside the automation window.",
+	}, []string{})
+
+	pendingReleasesCount = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "pending_releases_count",
+		Help:      "Count of automated releases waiting to be approved.",
+	}, []string{})
+
+	releaseGateDecisions = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "release_gate_decisions_total",
+		Help:      "Count of decisions made by the release gate about automated image updates.",
+	}, []string{fluxmetrics.LabelDecision})
+
+	vulnScanDecisions = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "vuln_scan_decisions_total",
+		Help:      "Count of images accepted or rejected for automated updates after scanning for vulnerabilities.",
+	}, []string{fluxmetrics.LabelDecision})
+
+	automatedRollouts = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "automated_rollouts_total",
+		Help:      "Count of watched rollouts of automated image updates that finished, or failed and were reverted.",
+	}, []string{fluxmetrics.LabelSuccess})
 )
@@ -0,0 +1,83 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/audit"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git"
+)
+
+// shouldRollBack says whether syncing a new revision went badly
+// enough that the last revision synced should be applied again.
+func (d *Daemon) shouldRollBack(oldRev, newRev string, syncErrors []event.ResourceError) bool {
+	return d.RollbackErrorThreshold > 0 &&
+		oldRev != "" && oldRev != newRev &&
+		len(syncErrors) >= d.RollbackErrorThreshold
+}
+
+// rollBack applies the resources from the last revision synced,
+// after syncing a new revision has failed, and remembers not to sync
+// the new revision again. It always returns an error, since the new
+// revision has not been synced.
+func (d *Daemon) rollBack(working *git.Checkout, goodRev, badRev string, syncErrors []event.ResourceError, logger log.Logger) error {
+	started := time.Now().UTC()
+	logger.Log("warning", "rolling back after errors syncing", "errors", len(syncErrors), "threshold", d.RollbackErrorThreshold, "failed", badRev, "revision", goodRev)
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitOpTimeout)
+	err := working.Checkout(ctx, goodRev)
+	cancel()
+	if err != nil {
+		return errors.Wrap(err, "checking out revision to roll back to")
+	}
+	resources, err := d.Manifests.LoadManifests(working.Dir(), working.ManifestDirs())
+	if err != nil {
+		return errors.Wrap(err, "loading resources to roll back to")
+	}
+	if err := d.applyResources(working, resources, logger); err != nil {
+		// Some resources may not have been in a good state before,
+		// either; carry on regardless.
+		logger.Log("err", errors.Wrap(err, "applying resources when rolling back"))
+	}
+	d.rolledBackFrom = badRev
+
+	rollbackErr := fmt.Errorf("rolled back to %s after %d errors syncing %s", goodRev, len(syncErrors), badRev)
+	d.postCommitStatus(logger, badRev, rollbackErr, syncErrors)
+
+	ids := flux.ResourceIDSet{}
+	for _, e := range syncErrors {
+		ids.Add([]flux.ResourceID{e.ID})
+	}
+	d.recordAudit(audit.Record{
+		Time:      started,
+		Action:    audit.Rollback,
+		Workloads: ids.ToSlice(),
+		Revision:  goodRev,
+		Summary:   fmt.Sprintf("rolled back from %s", badRev),
+		Error:     fmt.Sprintf("%d resource(s) failed to apply", len(syncErrors)),
+		// The cluster is back to a good state, but someone should
+		// look at the commit that failed
+		Severity: audit.SeverityWarning,
+	}, logger)
+	if err := d.LogEvent(event.Event{
+		ServiceIDs: ids.ToSlice(),
+		Type:       event.EventRollback,
+		StartedAt:  started,
+		EndedAt:    time.Now().UTC(),
+		LogLevel:   event.LogLevelError,
+		Metadata: &event.RollbackEventMetadata{
+			FailedRevision: badRev,
+			Revision:       goodRev,
+			Errors:         syncErrors,
+		},
+	}); err != nil {
+		logger.Log("err", err)
+	}
+	return rollbackErr
+}
@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git"
+)
+
+// Status reports the state of the git mirror, the outcome of the
+// last sync, and how much work is queued.
+func (d *Daemon) Status(ctx context.Context) v10.Status {
+	var status v10.Status
+
+	gitStatus, err := d.Repo.Status()
+	status.Git = v10.GitStatus{
+		URL:    d.Repo.Origin().URL,
+		Status: string(gitStatus),
+	}
+	if err != nil {
+		status.Git.Error = err.Error()
+	}
+
+	d.syncResultMu.RLock()
+	status.LastSync = d.syncResult
+	d.syncResultMu.RUnlock()
+
+	status.Queues.Jobs = d.Jobs.Len()
+	return status
+}
+
+// Ready returns an error if the daemon can't do its job: because the
+// git mirror can't fetch from upstream, or the Kubernetes API can't
+// be reached. If the context given is done before the cluster
+// answers, that's taken as the cluster being unreachable.
+func (d *Daemon) Ready(ctx context.Context) error {
+	status, err := d.Repo.Status()
+	if status != git.RepoNoConfig && err != nil {
+		return errors.Wrap(err, "git repo")
+	}
+	// Ping doesn't take a context, so wait for it only as long as
+	// the context allows
+	pinged := make(chan error, 1)
+	go func() { pinged <- d.Cluster.Ping() }()
+	select {
+	case err := <-pinged:
+		if err != nil {
+			return errors.Wrap(err, "cluster")
+		}
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "cluster")
+	}
+	return nil
+}
+
+// recordSynced notes that the revision given has been applied.
+func (d *Daemon) recordSynced(revision string, syncErrors []event.ResourceError) {
+	d.syncResultMu.Lock()
+	now := time.Now().UTC()
+	d.syncResult = v10.SyncResult{
+		Revision:       revision,
+		Time:           now,
+		Attempted:      now,
+		ResourceErrors: len(syncErrors),
+		Errors:         statusErrors(syncErrors),
+	}
+	d.syncResultMu.Unlock()
+}
+
+// recordSyncError notes that the last attempt to sync failed,
+// keeping the record of the revision last applied.
+func (d *Daemon) recordSyncError(err error) {
+	d.syncResultMu.Lock()
+	d.syncResult.Error = err.Error()
+	d.syncResult.Attempted = time.Now().UTC()
+	if validationErr, ok := errors.Cause(err).(cluster.ValidationError); ok {
+		d.syncResult.Errors = statusErrors(resourceErrors(validationErr.SyncError))
+	}
+	d.syncResultMu.Unlock()
+}
+
+func statusErrors(syncErrors []event.ResourceError) []v10.ResourceError {
+	var errs []v10.ResourceError
+	for _, e := range syncErrors {
+		errs = append(errs, v10.ResourceError{
+			ID:    e.ID,
+			Path:  e.Path,
+			Line:  e.Line,
+			Error: e.Error,
+		})
+	}
+	return errs
+}
@@ -0,0 +1,86 @@
+package daemon
+
+import (
+	"crypto/sha256"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// appliedRecord notes when a resource was last applied, and what its
+// definition was at the time.
+type appliedRecord struct {
+	checksum [sha256.Size]byte
+	at       time.Time
+}
+
+// syncInterval returns how often the resource should be reapplied if
+// it hasn't changed, if that's been configured either with an
+// annotation or for the path in which the resource is defined. A
+// zero duration means it should be applied on every sync.
+func (d *Daemon) syncInterval(res resource.Resource) (time.Duration, error) {
+	if value, ok := res.Policy().Get(policy.SyncInterval); ok {
+		return time.ParseDuration(value)
+	}
+	source := filepath.ToSlash(res.Source())
+	var longest string
+	var interval time.Duration
+	for path, pathInterval := range d.PathSyncIntervals {
+		path = strings.Trim(filepath.ToSlash(path), "/")
+		if (source == path || strings.HasPrefix(source, path+"/")) && len(path) >= len(longest) {
+			longest, interval = path, pathInterval
+		}
+	}
+	return interval, nil
+}
+
+// dueResources returns those resources which should be applied in
+// this sync: any that have changed, that have no sync interval, or
+// whose sync interval has elapsed since they were last applied.
+func (d *Daemon) dueResources(resources map[string]resource.Resource, now time.Time, logger log.Logger) map[string]resource.Resource {
+	if d.applied == nil {
+		d.applied = map[string]appliedRecord{}
+	}
+	due := map[string]resource.Resource{}
+	for id, res := range resources {
+		interval, err := d.syncInterval(res)
+		if err != nil {
+			logger.Log("warning", "invalid sync interval; applying on every sync", "resource", id, "err", err)
+		}
+		last, ok := d.applied[id]
+		if interval > 0 && ok && last.checksum == sha256.Sum256(res.Bytes()) && now.Sub(last.at) < interval {
+			continue
+		}
+		due[id] = res
+	}
+	return due
+}
+
+// recordApplied notes the resources given as having been applied at
+// the time given, except for those which failed.
+func (d *Daemon) recordApplied(resources map[string]resource.Resource, syncErr error, now time.Time) {
+	if d.applied == nil {
+		d.applied = map[string]appliedRecord{}
+	}
+	failed := map[string]bool{}
+	if errs, ok := syncErr.(cluster.SyncError); ok {
+		for _, e := range errs {
+			failed[e.ResourceID().String()] = true
+		}
+	} else if syncErr != nil {
+		return
+	}
+	for id, res := range resources {
+		if failed[id] {
+			delete(d.applied, id)
+			continue
+		}
+		d.applied[id] = appliedRecord{checksum: sha256.Sum256(res.Bytes()), at: now}
+	}
+}
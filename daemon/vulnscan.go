@@ -0,0 +1,149 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/image"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+	"github.com/weaveworks/flux/vulnscan"
+)
+
+const (
+	// How long what the scanner made of an image is trusted for,
+	// before it's asked again; new vulnerabilities are found in old
+	// images all the time.
+	vulnScanRecheck = time.Hour
+	// How long what the scanner made of an image is kept for, once
+	// it's no longer asked about it; images still being considered
+	// are asked about again well before then.
+	vulnScanForget = 24 * time.Hour
+	// How many images newer than the current one are considered
+	// for a container, if the newest are rejected.
+	maxVulnScanCandidates = 10
+)
+
+// vulnScan is what the vulnerability scanner made of an image: if it
+// was rejected, why.
+type vulnScan struct {
+	scannedAt time.Time
+	rejected  string
+}
+
+// latestAcceptedImage gives the image a container should be updated
+// to automatically: the latest of those given, or if there's a
+// vulnerability scanner, the latest that it doesn't find has
+// vulnerabilities worse than the threshold. If the scanner can't be
+// asked about an image, the container isn't updated, until it can.
+func (d *Daemon) latestAcceptedImage(ctx context.Context, workload flux.ResourceID, container resource.Container, images update.SortedImageInfos, pinDigest bool, logger log.Logger) (image.Info, bool) {
+	if d.VulnScanner == nil {
+		return images.Latest()
+	}
+	for i, info := range images {
+		if _, changed := update.UpdatedImage(container.Image, info, pinDigest); !changed || i >= maxVulnScanCandidates {
+			break
+		}
+		rejected, err := d.scanImage(ctx, workload, container, info, logger)
+		if err != nil {
+			vulnScanDecisions.With(fluxmetrics.LabelDecision, "error").Add(1)
+			logger.Log("warning", "could not scan image for vulnerabilities; delaying update", "image", info.ID, "err", err)
+			return image.Info{}, false
+		}
+		if rejected == "" {
+			return info, true
+		}
+	}
+	return image.Info{}, false
+}
+
+// scanImage asks the scanner about an image, unless it's been asked
+// recently, and returns why the image is rejected, or "" if it's
+// accepted. Each time an image is newly rejected, an event is
+// recorded.
+func (d *Daemon) scanImage(ctx context.Context, workload flux.ResourceID, container resource.Container, info image.Info, logger log.Logger) (string, error) {
+	if info.Digest == "" {
+		return "", fmt.Errorf("no digest for image %s", info.ID)
+	}
+	if d.vulnScans == nil {
+		d.vulnScans = map[string]vulnScan{}
+	}
+	now := time.Now()
+	previous, scanned := d.vulnScans[info.Digest]
+	if scanned && now.Sub(previous.scannedAt) < vulnScanRecheck {
+		return previous.rejected, nil
+	}
+
+	report, err := d.VulnScanner.Scan(ctx, info.ID.CanonicalName().String()+"@"+info.Digest)
+	if err != nil {
+		return "", err
+	}
+	rejected := describeVulnerabilities(report.Exceeding(d.VulnThreshold, d.VulnUnknown), d.VulnThreshold)
+	d.forgetVulnScans(now)
+	d.vulnScans[info.Digest] = vulnScan{scannedAt: now, rejected: rejected}
+	if rejected == "" {
+		vulnScanDecisions.With(fluxmetrics.LabelDecision, "accept").Add(1)
+		return "", nil
+	}
+	vulnScanDecisions.With(fluxmetrics.LabelDecision, "reject").Add(1)
+	if scanned && previous.rejected != "" {
+		return rejected, nil
+	}
+	logger.Log("info", "passing over image with vulnerabilities", "image", info.ID, "reason", rejected)
+	if err := d.LogEvent(event.Event{
+		ServiceIDs: []flux.ResourceID{workload},
+		Type:       event.EventRejectImage,
+		StartedAt:  now.UTC(),
+		EndedAt:    now.UTC(),
+		LogLevel:   event.LogLevelWarn,
+		Metadata: &event.RejectImageEventMetadata{
+			Container: container.Name,
+			Image:     info.ID.String(),
+			Reason:    rejected,
+		},
+	}); err != nil {
+		logger.Log("err", err)
+	}
+	return rejected, nil
+}
+
+// forgetVulnScans drops what the scanner made of the images it hasn't
+// been asked about for a while, so that images automation has moved
+// past don't pile up.
+func (d *Daemon) forgetVulnScans(now time.Time) {
+	for digest, scan := range d.vulnScans {
+		if now.Sub(scan.scannedAt) > vulnScanForget {
+			delete(d.vulnScans, digest)
+		}
+	}
+}
+
+// describeVulnerabilities says, briefly, what's wrong with an image
+// with the vulnerabilities given, worst first; or "" if there are
+// none.
+func describeVulnerabilities(vulns []vulnscan.Vulnerability, threshold vulnscan.Severity) string {
+	if len(vulns) == 0 {
+		return ""
+	}
+	sort.SliceStable(vulns, func(i, j int) bool {
+		return vulns[i].Severity.Exceeds(vulns[j].Severity)
+	})
+	const maxListed = 3
+	var listed []string
+	for i, v := range vulns {
+		if i == maxListed {
+			listed = append(listed, "...")
+			break
+		}
+		listed = append(listed, fmt.Sprintf("%s (%s)", v.ID, v.Severity))
+	}
+	return fmt.Sprintf("%d vulnerabilities more severe than %s: %s", len(vulns), threshold, strings.Join(listed, ", "))
+}
@@ -33,6 +33,9 @@ const (
 	// can't happen at present (e.g., because you've not supplied some
 	// config yet)
 	User = "user"
+	// The operation was well-formed, but whoever asked for it isn't
+	// allowed to do it
+	Forbidden = "forbidden"
 )
 
 func IsMissing(err error) bool {
@@ -24,6 +24,9 @@ const (
 	EventLock         = "lock"
 	EventUnlock       = "unlock"
 	EventUpdatePolicy = "update_policy"
+	EventRollback     = "rollback"
+	EventRejectImage  = "reject_image"
+	EventAutoRollback = "autorollback"
 
 	// This is used to label e.g., commits that we _don't_ consider an event in themselves.
 	NoneOfTheAbove = "other"
@@ -54,6 +57,10 @@ type Event struct {
 	// be the same as StartedAt.
 	EndedAt time.Time `json:"endedAt"`
 
+	// ClusterID identifies the cluster the event happened in, if the
+	// daemon recording it has been given an ID.
+	ClusterID string `json:"clusterID,omitempty"`
+
 	// LogLevel for this event. Used to indicate how important it is.
 	// `debug|info|warn|error`
 	LogLevel string `json:"logLevel"`
@@ -152,17 +159,46 @@ func (e Event) String() string {
 		if len(strServiceIDs) > 0 {
 			svcStr = strings.Join(strServiceIDs, ", ")
 		}
-		return fmt.Sprintf("Sync: %s, %s", revStr, svcStr)
+		var errStr string
+		if len(metadata.Errors) > 0 {
+			errStr = fmt.Sprintf(" (%d errors)", len(metadata.Errors))
+		}
+		return fmt.Sprintf("Sync: %s, %s%s", revStr, svcStr, errStr)
 	case EventAutomate:
 		return fmt.Sprintf("Automated: %s", strings.Join(strServiceIDs, ", "))
 	case EventDeautomate:
 		return fmt.Sprintf("Deautomated: %s", strings.Join(strServiceIDs, ", "))
 	case EventLock:
-		return fmt.Sprintf("Locked: %s", strings.Join(strServiceIDs, ", "))
+		var details string
+		if metadata, ok := e.Metadata.(*LockEventMetadata); ok {
+			if metadata.User != "" {
+				details += fmt.Sprintf(", by %s", metadata.User)
+			}
+			if metadata.Until != "" {
+				details += fmt.Sprintf(", until %s", metadata.Until)
+			}
+			if metadata.Message != "" {
+				details += fmt.Sprintf(", with message %q", metadata.Message)
+			}
+		}
+		return fmt.Sprintf("Locked: %s%s", strings.Join(strServiceIDs, ", "), details)
 	case EventUnlock:
 		return fmt.Sprintf("Unlocked: %s", strings.Join(strServiceIDs, ", "))
 	case EventUpdatePolicy:
 		return fmt.Sprintf("Updated policies: %s", strings.Join(strServiceIDs, ", "))
+	case EventRollback:
+		metadata := e.Metadata.(*RollbackEventMetadata)
+		return fmt.Sprintf("Rolled back from %s to %s after %d errors syncing", shortRevision(metadata.FailedRevision), shortRevision(metadata.Revision), len(metadata.Errors))
+	case EventRejectImage:
+		metadata := e.Metadata.(*RejectImageEventMetadata)
+		return fmt.Sprintf("Rejected image %s for %s (container %s): %s", metadata.Image, strings.Join(strServiceIDs, ", "), metadata.Container, metadata.Reason)
+	case EventAutoRollback:
+		metadata := e.Metadata.(*AutoRollbackEventMetadata)
+		var images []string
+		for _, c := range metadata.Containers {
+			images = append(images, fmt.Sprintf("%s -> %s", c.Target, c.Current))
+		}
+		return fmt.Sprintf("Rolling back automated release of %s: %s (%s)", strings.Join(strServiceIDs, ", "), metadata.Reason, strings.Join(images, ", "))
 	default:
 		return fmt.Sprintf("Unknown event: %s", e.Type)
 	}
@@ -195,9 +231,12 @@ type Commit struct {
 	Message  string `json:"message"`
 }
 
+// ResourceError is a resource that failed to sync, where it's defined
+// in the repo, and why it failed.
 type ResourceError struct {
 	ID    flux.ResourceID
 	Path  string
+	Line  int // the line in the file at Path where the resource is defined; 0 if not known
 	Error string
 }
 
@@ -253,6 +292,43 @@ type AutoReleaseEventMetadata struct {
 	Spec update.Automated `json:"spec"`
 }
 
+// RollbackEventMetadata is the metadata for when syncing a revision
+// failed badly enough that the last revision synced successfully was
+// applied again
+type RollbackEventMetadata struct {
+	FailedRevision string          `json:"failedRevision"`
+	Revision       string          `json:"revision"` // the revision rolled back to
+	Errors         []ResourceError `json:"errors,omitempty"`
+}
+
+// LockEventMetadata is the metadata for when workloads are locked:
+// who locked them, why, and when the lock expires, as far as they
+// were recorded
+type LockEventMetadata struct {
+	User    string `json:"user,omitempty"`
+	Message string `json:"message,omitempty"`
+	Until   string `json:"until,omitempty"`
+}
+
+// RejectImageEventMetadata is the metadata for when automation
+// passes over an image, e.g., because a scanner found serious
+// vulnerabilities in it
+type RejectImageEventMetadata struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Reason    string `json:"reason"`
+}
+
+// AutoRollbackEventMetadata is the metadata for when the rollout of
+// an automated release fails, and the images it updated are being
+// put back as they were
+type AutoRollbackEventMetadata struct {
+	Revision string `json:"revision"` // the revision with the automated release
+	// The container updates being reverted, as they were released
+	Containers []update.ContainerUpdate `json:"containers"`
+	Reason     string                   `json:"reason"`
+}
+
 type UnknownEventMetadata map[string]interface{}
 
 func (e *Event) UnmarshalJSON(in []byte) error {
@@ -302,6 +378,37 @@ func (e *Event) UnmarshalJSON(in []byte) error {
 		}
 		e.Metadata = &metadata
 		break
+	case EventRollback:
+		var metadata RollbackEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventRejectImage:
+		var metadata RejectImageEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventAutoRollback:
+		var metadata AutoRollbackEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventLock:
+		// Locks from before metadata was recorded have none
+		if len(wireEvent.MetadataBytes) > 0 {
+			var metadata LockEventMetadata
+			if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+				return err
+			}
+			e.Metadata = &metadata
+		}
+		break
 	default:
 		if len(wireEvent.MetadataBytes) > 0 {
 			var metadata UnknownEventMetadata
@@ -341,6 +448,22 @@ func (rem *AutoReleaseEventMetadata) Type() string {
 	return EventAutoRelease
 }
 
+func (rem *RollbackEventMetadata) Type() string {
+	return EventRollback
+}
+
+func (lem *LockEventMetadata) Type() string {
+	return EventLock
+}
+
+func (rem *RejectImageEventMetadata) Type() string {
+	return EventRejectImage
+}
+
+func (arm *AutoRollbackEventMetadata) Type() string {
+	return EventAutoRollback
+}
+
 // Special exception from pointer receiver rule, as UnknownEventMetadata is a
 // type alias for a map
 func (uem UnknownEventMetadata) Type() string {
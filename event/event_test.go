@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -60,3 +61,24 @@ func TestEvent_ParseNoMetadata(t *testing.T) {
 		t.Fatal("Hasn't been unmarshalled properly")
 	}
 }
+
+func TestEvent_LockMetadata(t *testing.T) {
+	e := Event{
+		ServiceIDs: []flux.ResourceID{flux.MustParseResourceID("default:deployment/helloworld")},
+		Type:       EventLock,
+		Metadata:   &LockEventMetadata{User: "alice", Message: "investigating", Until: "2019-06-01T12:00:00Z"},
+	}
+	expected := `Locked: default:deployment/helloworld, by alice, until 2019-06-01T12:00:00Z, with message "investigating"`
+	if got := e.String(); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	bytes, _ := json.Marshal(e)
+	var parsed Event
+	if err := json.Unmarshal(bytes, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.String(); got != expected {
+		t.Errorf("expected %q after round trip, got %q", expected, got)
+	}
+}
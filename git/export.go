@@ -28,5 +28,8 @@ func (r *Repo) Export(ctx context.Context, ref string) (*Export, error) {
 	if err = checkout(ctx, dir, ref); err != nil {
 		return nil, err
 	}
+	if err = r.updateSubmodules(ctx, dir); err != nil {
+		return nil, err
+	}
 	return &Export{dir}, nil
 }
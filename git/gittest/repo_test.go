@@ -177,3 +177,53 @@ func TestCheckout(t *testing.T) {
 	close(sd)
 	sg.Wait()
 }
+
+func TestCommitAndPushBranch(t *testing.T) {
+	first, repo, cleanup := CheckoutWithConfig(t, TestConfig)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	second, err := repo.Clone(ctx, TestConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Clean()
+
+	// The same change, committed in each of two clones, should be
+	// pushed to the same branch once
+	var branches, revs []string
+	for _, checkout := range []*git.Checkout{first, second} {
+		path := filepath.Join(checkout.ManifestDirs()[0], "helloworld-deploy.yaml")
+		if err := ioutil.WriteFile(path, []byte("CHANGED"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		branch, err := checkout.CommitAndPushBranch(ctx, git.CommitAction{Message: "Changed file"}, nil, "proposed-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		head, err := checkout.HeadRevision(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		branches, revs = append(branches, branch), append(revs, head)
+		time.Sleep(time.Second) // so the second commit differs
+	}
+	if branches[0] != branches[1] {
+		t.Fatalf("expected the same changes to be pushed to the same branch, got %v", branches)
+	}
+	if revs[0] == revs[1] {
+		t.Fatalf("expected distinct commits, got %v", revs)
+	}
+
+	if err := repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pushed, err := repo.Revision(ctx, branches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed != revs[0] {
+		t.Errorf("expected branch to be left at the first commit %s, got %s", revs[0], pushed)
+	}
+}
@@ -0,0 +1,34 @@
+package git
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+var (
+	fetchDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "git",
+		Name:      "fetch_duration_seconds",
+		Help:      "Duration of fetches from the upstream git repo, in seconds.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20},
+	}, []string{fluxmetrics.LabelSuccess})
+
+	// Alerting on how long ago this was is a way to find out that
+	// the mirror has stopped keeping up with the upstream.
+	lastFetchTimestamp = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "git",
+		Name:      "last_fetch_timestamp_seconds",
+		Help:      "Time of the last successful fetch from the upstream git repo, in seconds since the epoch.",
+	}, []string{})
+
+	cloneFailures = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "git",
+		Name:      "clone_failures_total",
+		Help:      "Count of failed attempts to clone the upstream git repo.",
+	}, []string{})
+)
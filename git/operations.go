@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"context"
@@ -43,9 +46,47 @@ func clone(ctx context.Context, workingDir, repoURL, repoBranch string) (path st
 	return repoPath, nil
 }
 
-func mirror(ctx context.Context, workingDir, repoURL string) (path string, err error) {
+// sparseClone makes a clone in which only the paths given (and any
+// manifest generation config files) are checked out.
+func sparseClone(ctx context.Context, workingDir, repoURL, repoBranch string, paths []string) (path string, err error) {
+	repoPath := workingDir
+	args := []string{"clone", "--no-checkout"}
+	if repoBranch != "" {
+		args = append(args, "--branch", repoBranch)
+	}
+	args = append(args, repoURL, repoPath)
+	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
+		return "", errors.Wrap(err, "git clone --no-checkout")
+	}
+	if err := execGitCmd(ctx, repoPath, nil, "config", "core.sparseCheckout", "true"); err != nil {
+		return "", errors.Wrap(err, "enabling sparse checkout")
+	}
+	patterns := []string{".flux.yaml"}
+	for _, p := range paths {
+		patterns = append(patterns, "/"+strings.Trim(p, "/")+"/")
+	}
+	sparseFile := filepath.Join(repoPath, ".git", "info", "sparse-checkout")
+	if err := os.MkdirAll(filepath.Dir(sparseFile), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(sparseFile, []byte(strings.Join(patterns, "\n")+"\n"), 0644); err != nil {
+		return "", errors.Wrap(err, "writing sparse checkout patterns")
+	}
+	if err := execGitCmd(ctx, repoPath, nil, "checkout", "--quiet", "HEAD"); err != nil {
+		return "", errors.Wrap(err, "git checkout")
+	}
+	return repoPath, nil
+}
+
+// mirror makes a bare mirror of the repo. If depth is greater than
+// zero, the mirror is shallow, containing only that many commits of
+// history.
+func mirror(ctx context.Context, workingDir, repoURL string, depth int) (path string, err error) {
 	repoPath := workingDir
 	args := []string{"clone", "--mirror"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
 	args = append(args, repoURL, repoPath)
 	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
 		return "", errors.Wrap(err, "git clone --mirror")
@@ -53,6 +94,46 @@ func mirror(ctx context.Context, workingDir, repoURL string) (path string, err e
 	return repoPath, nil
 }
 
+// shallowUnsupportedMessages are the messages git gives when the
+// server, or the transport, can't do shallow clones.
+var shallowUnsupportedMessages = []string{
+	"server does not support shallow clients",
+	"server does not support shallow requests",
+	"dumb http transport does not support shallow capabilities",
+}
+
+// isShallowUnsupported reports whether an error from git indicates
+// that the server (or transport) can't do shallow clones.
+func isShallowUnsupported(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, m := range shallowUnsupportedMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateSubmodules checks out the submodules of a working clone, if
+// it has any. Relative submodule URLs are resolved against the
+// upstream URL given, rather than the mirror the clone was made from.
+func updateSubmodules(ctx context.Context, workingDir, upstreamURL string, mode Submodules) error {
+	if mode == "" || mode == SubmodulesOff {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(workingDir, ".gitmodules")); os.IsNotExist(err) {
+		return nil
+	}
+	args := []string{"-c", "remote.origin.url=" + upstreamURL, "submodule", "update", "--init", "--recursive"}
+	if mode == SubmodulesShallow {
+		args = append(args, "--depth", "1")
+	}
+	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
+		return errors.Wrap(err, "git submodule update")
+	}
+	return nil
+}
+
 func checkout(ctx context.Context, workingDir, ref string) error {
 	return execGitCmd(ctx, workingDir, nil, "checkout", ref)
 }
@@ -72,22 +153,14 @@ func checkPush(ctx context.Context, workingDir, upstream string) error {
 }
 
 func commit(ctx context.Context, workingDir string, commitAction CommitAction) error {
-	commitAuthor := commitAction.Author
-	if commitAuthor != "" {
-		if err := execGitCmd(ctx,
-			workingDir, nil,
-			"commit",
-			"--no-verify", "-a", "--author", commitAuthor, "-m", commitAction.Message,
-		); err != nil {
-			return errors.Wrap(err, "git commit")
-		}
-		return nil
+	args := []string{"commit", "--no-verify", "-a", "-m", commitAction.Message}
+	if commitAction.Author != "" {
+		args = append(args, "--author", commitAction.Author)
 	}
-	if err := execGitCmd(ctx,
-		workingDir, nil,
-		"commit",
-		"--no-verify", "-a", "-m", commitAction.Message,
-	); err != nil {
+	if commitAction.SigningKey != "" {
+		args = append(args, fmt.Sprintf("--gpg-sign=%s", commitAction.SigningKey))
+	}
+	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
 		return errors.Wrap(err, "git commit")
 	}
 	return nil
@@ -181,6 +254,44 @@ func refRevision(ctx context.Context, path, ref string) (string, error) {
 	return strings.TrimSpace(out.String()), nil
 }
 
+// patchID returns git's stable patch ID for the changes introduced by
+// the commit given, which stays the same if the same changes are made
+// on top of a different parent.
+func patchID(ctx context.Context, path, rev string) (string, error) {
+	diff := &bytes.Buffer{}
+	if err := execGitCmd(ctx, path, diff, "show", "--format=", rev); err != nil {
+		return "", err
+	}
+	out := &bytes.Buffer{}
+	if err := execGitCmdWithInput(ctx, path, diff, out, "patch-id", "--stable"); err != nil {
+		return "", err
+	}
+	// The output is "<patch ID> <commit ID>"
+	fields := strings.Fields(out.String())
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no changes in %s to make a patch ID from", rev)
+	}
+	return fields[0], nil
+}
+
+// lsRemote returns the revisions of those refs given that exist in
+// the upstream.
+func lsRemote(ctx context.Context, workingDir, upstream string, refs ...string) (map[string]string, error) {
+	out := &bytes.Buffer{}
+	args := append([]string{"ls-remote", upstream}, refs...)
+	if err := execGitCmd(ctx, workingDir, out, args...); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("git ls-remote %s %s", upstream, refs))
+	}
+	revs := map[string]string{}
+	for _, line := range splitList(out.String()) {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			revs[fields[1]] = fields[0]
+		}
+	}
+	return revs, nil
+}
+
 func revlist(ctx context.Context, path, ref string) ([]string, error) {
 	out := &bytes.Buffer{}
 	if err := execGitCmd(ctx, path, out, "rev-list", ref); err != nil {
@@ -252,7 +363,23 @@ func changed(ctx context.Context, path, ref string, subPaths []string) ([]string
 	return splitList(out.String()), nil
 }
 
+// diffFile gives the changes to a file since the ref given, as a
+// unified diff.
+func diffFile(ctx context.Context, path, ref, file string) (string, error) {
+	out := &bytes.Buffer{}
+	if err := execGitCmd(ctx, path, out, "diff", "--no-color", "--no-ext-diff", ref, "--", file); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
 func execGitCmd(ctx context.Context, dir string, out io.Writer, args ...string) error {
+	return execGitCmdWithInput(ctx, dir, nil, out, args...)
+}
+
+// execGitCmdWithInput runs a git command as execGitCmd does, giving
+// it the input supplied.
+func execGitCmdWithInput(ctx context.Context, dir string, in io.Reader, out io.Writer, args ...string) error {
 	if trace {
 		print("TRACE: git")
 		for _, arg := range args {
@@ -265,6 +392,7 @@ func execGitCmd(ctx context.Context, dir string, out io.Writer, args ...string)
 	if dir != "" {
 		c.Dir = dir
 	}
+	c.Stdin = in
 	c.Env = env()
 	c.Stdout = ioutil.Discard
 	if out != nil {
@@ -289,7 +417,28 @@ func execGitCmd(ctx context.Context, dir string, out io.Writer, args ...string)
 }
 
 func env() []string {
-	return []string{"GIT_TERMINAL_PROMPT=0"}
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	// gpg needs to be able to find its keyring, if we're signing
+	// commits; so pass through anything that tells it where to look.
+	for _, k := range []string{"HOME", "GNUPGHOME"} {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	// ... and ssh needs to know how to check host keys, if that's
+	// been configured.
+	if v, ok := os.LookupEnv("GIT_SSH_COMMAND"); ok {
+		env = append(env, "GIT_SSH_COMMAND="+v)
+	}
+	// ... and how to check the certificates of HTTPS remotes, and
+	// whether to reach them through a proxy.
+	for _, k := range []string{envSSLCAInfo, envSSLNoVerify,
+		"http_proxy", "https_proxy", "HTTPS_PROXY", "all_proxy", "ALL_PROXY", "no_proxy", "NO_PROXY"} {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	return env
 }
 
 // check returns true if there are changes locally.
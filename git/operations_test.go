@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
@@ -143,6 +145,37 @@ func TestChangedFiles_NoPath(t *testing.T) {
 	}
 }
 
+func TestDiffFile(t *testing.T) {
+	newDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	nestedDir := "test/dir"
+	if err := createRepo(newDir, []string{nestedDir}); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateFile(filepath.Join(newDir, nestedDir), map[string]string{"helloworld-deploy.yaml": "changed\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := changed(context.Background(), newDir, "HEAD", []string{nestedDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "test/dir/helloworld-deploy.yaml" {
+		t.Fatalf("expected only the updated file to have changed, got %v", files)
+	}
+	diff, err := diffFile(context.Background(), newDir, "HEAD", files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(diff, "diff --git a/test/dir/helloworld-deploy.yaml b/test/dir/helloworld-deploy.yaml\n") {
+		t.Errorf("expected a diff of the file, got:\n%s", diff)
+	}
+	if !strings.Contains(diff, "\n+changed\n") {
+		t.Errorf("expected the diff to include the added line, got:\n%s", diff)
+	}
+}
+
 func TestOnelinelog_NoGitpath(t *testing.T) {
 	newDir, cleanup := testfiles.TempDir(t)
 	defer cleanup()
@@ -216,6 +249,190 @@ func TestCheckPush(t *testing.T) {
 	}
 }
 
+func TestPatchID(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := createRepo(dir, []string{"config"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the same change on master, and on a branch from an
+	// earlier commit
+	var ids []string
+	for _, branch := range []string{"master", "other"} {
+		if branch != "master" {
+			if err := execCommand("git", "-C", dir, "checkout", "-b", branch, "HEAD~2"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "config", "added.yaml"), []byte("added: true\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := execCommand("git", "-C", dir, "add", "--all"); err != nil {
+			t.Fatal(err)
+		}
+		if err := execCommand("git", "-C", dir, "commit", "-m", "Add a file"); err != nil {
+			t.Fatal(err)
+		}
+		id, err := patchID(context.Background(), dir, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if ids[0] == "" || ids[0] != ids[1] {
+		t.Errorf("expected the same patch ID for the same changes, got %v", ids)
+	}
+}
+
+func TestSparseClone(t *testing.T) {
+	upstreamDir, upstreamCleanup := testfiles.TempDir(t)
+	defer upstreamCleanup()
+	if err := createRepo(upstreamDir, []string{"dev", "prod"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cloneDir, cloneCleanup := testfiles.TempDir(t)
+	defer cloneCleanup()
+
+	working, err := sparseClone(context.Background(), cloneDir, upstreamDir, "master", []string{"dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(working, "dev")); err != nil {
+		t.Errorf("expected dev to be checked out: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(working, "prod")); !os.IsNotExist(err) {
+		t.Errorf("expected prod not to be checked out, got %v", err)
+	}
+}
+
+func TestShallowMirror(t *testing.T) {
+	upstreamDir, upstreamCleanup := testfiles.TempDir(t)
+	defer upstreamCleanup()
+	if err := createRepo(upstreamDir, []string{"dev", "prod"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mirrorDir, mirrorCleanup := testfiles.TempDir(t)
+	defer mirrorCleanup()
+
+	// Local paths are cloned in full regardless of --depth, so use
+	// a file:// URL.
+	dir, err := mirror(context.Background(), mirrorDir, "file://"+upstreamDir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := onelinelog(context.Background(), dir, "HEAD", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 {
+		t.Errorf("expected only one commit in a shallow mirror, got %d", len(commits))
+	}
+}
+
+func TestIsShallowUnsupported(t *testing.T) {
+	for msg, expected := range map[string]bool{
+		"fatal: dumb http transport does not support shallow capabilities":    true,
+		"fatal: Server does not support shallow clients":                      true,
+		"git clone --mirror: fatal: Server does not support shallow requests": true,
+		"fatal: could not read from remote repository":                        false,
+		"error: shallow update not allowed":                                   false,
+		"fatal: repository 'shallow-repo' not found":                          false,
+	} {
+		if got := isShallowUnsupported(fmt.Errorf("%s", msg)); got != expected {
+			t.Errorf("%q: expected %v, got %v", msg, expected, got)
+		}
+	}
+}
+
+func TestUpdateSubmodules(t *testing.T) {
+	upstreamDir, upstreamCleanup := testfiles.TempDir(t)
+	defer upstreamCleanup()
+
+	// Newer versions of git won't clone submodules from local paths
+	// unless told they may.
+	home := filepath.Join(upstreamDir, "home")
+	if err := os.Mkdir(home, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[protocol \"file\"]\n\tallow = always\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", oldHome)
+
+	subDir := filepath.Join(upstreamDir, "sub")
+	mainDir := filepath.Join(upstreamDir, "main")
+	for _, dir := range []string{subDir, mainDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createRepo(subDir, []string{"charts"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := createRepo(mainDir, []string{"config"}); err != nil {
+		t.Fatal(err)
+	}
+	// A relative URL, to check it's resolved against the upstream
+	// rather than the mirror
+	if err := execCommand("git", "-C", mainDir, "submodule", "add", "../sub", "vendor/sub"); err != nil {
+		t.Fatal(err)
+	}
+	if err := execCommand("git", "-C", mainDir, "commit", "-m", "'Add submodule'"); err != nil {
+		t.Fatal(err)
+	}
+
+	mirrorDir, mirrorCleanup := testfiles.TempDir(t)
+	defer mirrorCleanup()
+	mirrored, err := mirror(context.Background(), mirrorDir, mainDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// git ignores --depth for plain local paths, so give the
+	// upstream as a file:// URL
+	upstreamURL := "file://" + mainDir
+	for _, mode := range []Submodules{SubmodulesOff, SubmodulesRecursive, SubmodulesShallow} {
+		cloneDir, cloneCleanup := testfiles.TempDir(t)
+		defer cloneCleanup()
+		working, err := clone(context.Background(), cloneDir, mirrored, "master")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := updateSubmodules(context.Background(), working, upstreamURL, mode); err != nil {
+			t.Fatal(err)
+		}
+		subWorking := filepath.Join(working, "vendor", "sub")
+		_, err = os.Stat(filepath.Join(subWorking, "charts"))
+		switch {
+		case mode == SubmodulesOff && !os.IsNotExist(err):
+			t.Errorf("expected submodule not to be checked out, got %v", err)
+		case mode != SubmodulesOff && err != nil:
+			t.Errorf("%s: expected submodule to be checked out: %s", mode, err)
+		}
+		if mode == SubmodulesOff {
+			continue
+		}
+		// The submodule repo has two commits; a shallow checkout
+		// should have only the one
+		commits, err := onelinelog(context.Background(), subWorking, "HEAD", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := 2
+		if mode == SubmodulesShallow {
+			expected = 1
+		}
+		if len(commits) != expected {
+			t.Errorf("%s: expected %d commits in submodule, got %d", mode, expected, len(commits))
+		}
+	}
+}
+
 // ---
 
 func createRepo(dir string, subdirs []string) error {
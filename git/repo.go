@@ -2,12 +2,17 @@ package git
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"sync"
 
 	"context"
 	"time"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+	"github.com/weaveworks/flux/tracing"
 )
 
 const (
@@ -52,9 +57,12 @@ type Remote struct {
 
 type Repo struct {
 	// As supplied to constructor
-	origin   Remote
-	interval time.Duration
-	readonly bool
+	origin     Remote
+	interval   time.Duration
+	readonly   bool
+	depth      int  // if > 0, make a shallow mirror with this much history
+	sparse     bool // check out only the paths we care about in working clones
+	submodules Submodules
 
 	// State
 	mu     sync.RWMutex
@@ -86,6 +94,35 @@ var ReadOnly optionFunc = func(r *Repo) {
 	r.readonly = true
 }
 
+// CloneDepth makes the mirror a shallow clone, with the given number
+// of commits of history. If the upstream doesn't support shallow
+// clones, a full clone is made instead.
+type CloneDepth int
+
+func (d CloneDepth) apply(r *Repo) {
+	r.depth = int(d)
+}
+
+// SparseCheckout means working clones only check out the paths given
+// in the config, rather than the whole tree.
+var SparseCheckout optionFunc = func(r *Repo) {
+	r.sparse = true
+}
+
+// Submodules says whether, and how, to check out submodules in
+// working clones.
+type Submodules string
+
+const (
+	SubmodulesOff       Submodules = "off"
+	SubmodulesRecursive Submodules = "recursive" // check out submodules, and theirs, with full history
+	SubmodulesShallow   Submodules = "shallow"   // check out submodules, and theirs, with only the commit needed
+)
+
+func (s Submodules) apply(r *Repo) {
+	r.submodules = s
+}
+
 // NewRepo constructs a repo mirror which will sync itself.
 func NewRepo(origin Remote, opts ...Option) *Repo {
 	status := RepoNew
@@ -113,6 +150,12 @@ func (r *Repo) Origin() Remote {
 	return r.origin
 }
 
+// ReadOnly reports whether the repo was constructed as read-only,
+// i.e., whether it will refuse to push changes upstream.
+func (r *Repo) ReadOnly() bool {
+	return r.readonly
+}
+
 // Dir returns the local directory into which the repo has been
 // cloned, if it has been cloned.
 func (r *Repo) Dir() string {
@@ -238,9 +281,26 @@ func (r *Repo) step(bg context.Context) bool {
 			panic(err)
 		}
 
+		r.mu.RLock()
+		depth := r.depth
+		r.mu.RUnlock()
+
 		ctx, cancel := context.WithTimeout(bg, opTimeout)
-		dir, err = mirror(ctx, rootdir, url)
+		dir, err = mirror(ctx, rootdir, url, depth)
 		cancel()
+		if err != nil && depth > 0 && isShallowUnsupported(err) {
+			// Fall back to a full clone, and don't bother trying
+			// a shallow clone again.
+			r.mu.Lock()
+			r.depth = 0
+			r.mu.Unlock()
+			os.RemoveAll(rootdir)
+			if err = os.Mkdir(rootdir, 0700); err == nil {
+				ctx, cancel := context.WithTimeout(bg, opTimeout)
+				dir, err = mirror(ctx, rootdir, url, 0)
+				cancel()
+			}
+		}
 		if err == nil {
 			r.mu.Lock()
 			r.dir = dir
@@ -253,6 +313,7 @@ func (r *Repo) step(bg context.Context) bool {
 			r.setUnready(RepoCloned, ErrClonedOnly)
 			return true
 		}
+		cloneFailures.Add(1)
 		dir = ""
 		os.RemoveAll(rootdir)
 		r.setUnready(RepoNew, err)
@@ -376,7 +437,26 @@ func (r *Repo) refreshLoop(shutdown <-chan struct{}) error {
 }
 
 // fetch gets updated refs, and associated objects, from the upstream.
-func (r *Repo) fetch(ctx context.Context) error {
+func (r *Repo) fetch(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "git.fetch")
+	start := time.Now()
+	defer func() {
+		span.Finish(err)
+		fetchDuration.With(
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(start).Seconds())
+		if err == nil {
+			lastFetchTimestamp.Set(float64(time.Now().Unix()))
+		}
+	}()
+	if r.depth > 0 {
+		// Keep the mirror shallow; otherwise, fetching tags may
+		// bring in the entire history.
+		if err := fetch(ctx, r.dir, "origin", "--depth", strconv.Itoa(r.depth)); err != nil {
+			return err
+		}
+		return nil
+	}
 	if err := fetch(ctx, r.dir, "origin"); err != nil {
 		return err
 	}
@@ -384,8 +464,10 @@ func (r *Repo) fetch(ctx context.Context) error {
 }
 
 // workingClone makes a non-bare clone, at `ref` (probably a branch),
-// and returns the filesystem path to it.
-func (r *Repo) workingClone(ctx context.Context, ref string) (string, error) {
+// and returns the filesystem path to it. If the repo was constructed
+// with SparseCheckout and paths are given, only those paths are
+// checked out.
+func (r *Repo) workingClone(ctx context.Context, ref string, paths ...string) (string, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	if err := r.errorIfNotReady(); err != nil {
@@ -395,5 +477,14 @@ func (r *Repo) workingClone(ctx context.Context, ref string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if r.sparse && len(paths) > 0 {
+		return sparseClone(ctx, working, r.dir, ref, paths)
+	}
 	return clone(ctx, working, r.dir, ref)
 }
+
+// updateSubmodules checks out the submodules in a working clone,
+// according to how the repo was constructed.
+func (r *Repo) updateSubmodules(ctx context.Context, dir string) error {
+	return updateSubmodules(ctx, dir, r.Origin().URL, r.submodules)
+}
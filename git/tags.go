@@ -0,0 +1,100 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/ryanuber/go-glob"
+)
+
+const semverPrefix = "semver:"
+
+// ErrNoMatchingTag is returned when asked for the latest tag matching
+// a pattern, and there aren't any.
+type ErrNoMatchingTag string
+
+func (err ErrNoMatchingTag) Error() string {
+	return fmt.Sprintf("no tags match the pattern %q", string(err))
+}
+
+// ValidTagPattern checks that a tag pattern, as accepted by
+// `LatestTag`, is well-formed.
+func ValidTagPattern(pattern string) error {
+	if strings.HasPrefix(pattern, semverPrefix) {
+		_, err := semver.NewConstraint(strings.TrimPrefix(pattern, semverPrefix))
+		return err
+	}
+	if pattern == "" {
+		return fmt.Errorf("empty tag pattern")
+	}
+	return nil
+}
+
+// LatestTag returns the newest tag matching the pattern given. If
+// the pattern is prefixed with `semver:`, the rest is treated as a
+// semver constraint, and the tag with the highest version is
+// returned; otherwise, the pattern is treated as a glob, and the most
+// recently created tag is returned. The sync tag is never returned,
+// since it's moved on every sync and would otherwise always be the
+// most recent match.
+func (r *Repo) LatestTag(ctx context.Context, pattern, syncTag string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.errorIfNotReady(); err != nil {
+		return "", err
+	}
+	tags, err := tagsByDate(ctx, r.dir)
+	if err != nil {
+		return "", err
+	}
+	if tag, ok := latestMatchingTag(tags, pattern, syncTag); ok {
+		return tag, nil
+	}
+	return "", ErrNoMatchingTag(pattern)
+}
+
+// latestMatchingTag picks the newest of the tags that match the
+// pattern, other than the sync tag, assuming the tags are given most
+// recent first.
+func latestMatchingTag(tags []string, pattern, syncTag string) (string, bool) {
+	if strings.HasPrefix(pattern, semverPrefix) {
+		constraints, err := semver.NewConstraint(strings.TrimPrefix(pattern, semverPrefix))
+		if err != nil {
+			return "", false
+		}
+		var latest string
+		var latestVersion *semver.Version
+		for _, tag := range tags {
+			if tag == syncTag {
+				continue
+			}
+			v, err := semver.NewVersion(tag)
+			if err != nil || !constraints.Check(v) {
+				continue
+			}
+			if latestVersion == nil || v.GreaterThan(latestVersion) {
+				latest, latestVersion = tag, v
+			}
+		}
+		return latest, latestVersion != nil
+	}
+
+	for _, tag := range tags {
+		if tag != syncTag && glob.Glob(pattern, tag) {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+// tagsByDate lists the tags in the repo, most recently created first.
+func tagsByDate(ctx context.Context, workingDir string) ([]string, error) {
+	out := &bytes.Buffer{}
+	if err := execGitCmd(ctx, workingDir, out, "for-each-ref", "--sort=-creatordate", "--format=%(refname:short)", "refs/tags"); err != nil {
+		return nil, err
+	}
+	return splitList(out.String()), nil
+}
@@ -0,0 +1,40 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestLatestMatchingTag(t *testing.T) {
+	// most recent first, as from `tagsByDate`
+	tags := []string{"flux-sync", "v1.10.0-rc.1", "v1.2.0", "v1.10.0", "v2.0.0", "release-b", "release-a"}
+	syncTag := "flux-sync"
+
+	for _, c := range []struct {
+		pattern string
+		want    string
+		ok      bool
+	}{
+		{"*", "v1.10.0-rc.1", true},
+		{"flux-*", "", false},
+		{"release-*", "release-b", true},
+		{"v1.*", "v1.10.0-rc.1", true},
+		{"semver:~1", "v1.10.0", true},
+		{"semver:*", "v2.0.0", true},
+		{"semver:>= 3", "", false},
+		{"nomatch-*", "", false},
+	} {
+		got, ok := latestMatchingTag(tags, c.pattern, syncTag)
+		if got != c.want || ok != c.ok {
+			t.Errorf("pattern %q: expected (%q, %v), got (%q, %v)", c.pattern, c.want, c.ok, got, ok)
+		}
+	}
+}
+
+func TestValidTagPattern(t *testing.T) {
+	if err := ValidTagPattern("semver:not a constraint"); err == nil {
+		t.Error("expected invalid semver constraint to be rejected")
+	}
+	if err := ValidTagPattern("v*"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// restoreEnv puts back the environment variables ConfigureTLS may
+// set, since they affect every test run after it.
+func restoreEnv(t *testing.T, names ...string) func() {
+	saved := map[string]*string{}
+	for _, name := range names {
+		if v, ok := os.LookupEnv(name); ok {
+			saved[name] = &v
+		} else {
+			saved[name] = nil
+		}
+	}
+	return func() {
+		for name, v := range saved {
+			if v == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *v)
+			}
+		}
+	}
+}
+
+func writeSelfSignedCert(t *testing.T, dir string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "git.example.com"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigureTLS(t *testing.T) {
+	defer restoreEnv(t, envSSLCAInfo, envSSLNoVerify)()
+	os.Unsetenv(envSSLCAInfo)
+	os.Unsetenv(envSSLNoVerify)
+
+	config, err := ConfigureTLS("", false)
+	if err != nil || config != nil {
+		t.Fatalf("expected nothing to be configured, got %+v, %v", config, err)
+	}
+	if _, ok := os.LookupEnv(envSSLCAInfo); ok {
+		t.Errorf("did not expect %s to be set", envSSLCAInfo)
+	}
+
+	dir, err := ioutil.TempDir("", "flux-git-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConfigureTLS(notPEM, false); err == nil {
+		t.Error("expected an error for a file without certificates")
+	}
+	if _, err := ConfigureTLS(filepath.Join(dir, "missing.pem"), false); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	caFile := writeSelfSignedCert(t, dir)
+	config, err = ConfigureTLS(caFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config == nil || config.RootCAs == nil || config.InsecureSkipVerify {
+		t.Errorf("expected a config trusting only the CA file, got %+v", config)
+	}
+	if got := os.Getenv(envSSLCAInfo); got != caFile {
+		t.Errorf("expected %s=%q, got %q", envSSLCAInfo, caFile, got)
+	}
+	if _, ok := os.LookupEnv(envSSLNoVerify); ok {
+		t.Errorf("did not expect %s to be set", envSSLNoVerify)
+	}
+
+	config, err = ConfigureTLS("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config == nil || !config.InsecureSkipVerify {
+		t.Errorf("expected a config skipping verification, got %+v", config)
+	}
+	if got := os.Getenv(envSSLNoVerify); got != "true" {
+		t.Errorf("expected %s=true, got %q", envSSLNoVerify, got)
+	}
+}
@@ -5,16 +5,20 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+
+	"github.com/weaveworks/flux/tracing"
 )
 
 var (
-	ErrReadOnly = errors.New("cannot make a working clone of a read-only git repo")
+	ErrReadOnly = errors.New("cannot push changes to a read-only git repo")
 )
 
 // Config holds some values we use when working in the working clone of
 // a repo.
 type Config struct {
-	Branch      string   // branch we're syncing to
+	Branch      string   // branch we're syncing to, and committing to
+	Tag         string   // if non-empty, sync this tag rather than the branch head
+	TagPattern  string   // if non-empty, sync the latest tag matching this pattern rather than the branch head
 	Paths       []string // paths within the repo containing files we care about
 	SyncTag     string
 	NotesRef    string
@@ -22,6 +26,7 @@ type Config struct {
 	UserEmail   string
 	SetAuthor   bool
 	SkipMessage string
+	SigningKey  string // if non-empty, the key used to sign commits
 }
 
 // Checkout is a local working clone of the remote repo. It is
@@ -32,6 +37,8 @@ type Checkout struct {
 	config       Config
 	upstream     Remote
 	realNotesRef string // cache the notes ref, since we use it to push as well
+	readonly     bool   // the upstream must not be written to
+	submodules   Submodules
 }
 
 type Commit struct {
@@ -41,19 +48,22 @@ type Commit struct {
 
 // CommitAction - struct holding commit information
 type CommitAction struct {
-	Author  string
-	Message string
+	Author     string
+	Message    string
+	SigningKey string
 }
 
 // Clone returns a local working clone of the sync'ed `*Repo`, using
-// the config given.
-func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
-	if r.readonly {
-		return nil, ErrReadOnly
-	}
+// the config given. If the repo is read-only, the clone can be
+// inspected, but attempts to push from it will fail with
+// `ErrReadOnly`.
+func (r *Repo) Clone(ctx context.Context, conf Config) (_ *Checkout, err error) {
+	ctx, span := tracing.Start(ctx, "git.clone")
+	span.SetTag("ref", conf.Branch)
+	defer func() { span.Finish(err) }()
 
 	upstream := r.Origin()
-	repoDir, err := r.workingClone(ctx, conf.Branch)
+	repoDir, err := r.workingClone(ctx, conf.Branch, conf.Paths...)
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +73,11 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 		return nil, err
 	}
 
+	if err := r.updateSubmodules(ctx, repoDir); err != nil {
+		os.RemoveAll(repoDir)
+		return nil, err
+	}
+
 	// We'll need the notes ref for pushing it, so make sure we have
 	// it. This assumes we're syncing it (otherwise we'll likely get conflicts)
 	realNotesRef, err := getNotesRef(ctx, repoDir, conf.NotesRef)
@@ -84,6 +99,8 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 		upstream:     upstream,
 		realNotesRef: realNotesRef,
 		config:       conf,
+		readonly:     r.readonly,
+		submodules:   r.submodules,
 	}, nil
 }
 
@@ -117,11 +134,56 @@ func (c *Checkout) ManifestDirs() []string {
 // CommitAndPush commits changes made in this checkout, along with any
 // extra data as a note, and pushes the commit and note to the remote repo.
 func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction, note interface{}) error {
+	if err := c.commitWithNote(ctx, commitAction, note); err != nil {
+		return err
+	}
+	return c.pushWithNotes(ctx, c.config.Branch)
+}
+
+// CommitAndPushBranch commits changes made in this checkout, along
+// with any extra data as a note, and pushes the commit to a branch
+// other than the configured branch, rather than to the configured
+// branch. The branch is named by appending the patch ID of the
+// changes to the prefix given, so that committing the same changes
+// again names the same branch; if that branch has already been
+// pushed, it's left as it is. The name of the branch is returned.
+func (c *Checkout) CommitAndPushBranch(ctx context.Context, commitAction CommitAction, note interface{}, prefix string) (string, error) {
+	if err := c.commitWithNote(ctx, commitAction, note); err != nil {
+		return "", err
+	}
+	id, err := patchID(ctx, c.dir, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	branch := prefix + id[:12]
+	ref := "refs/heads/" + branch
+	remote, err := lsRemote(ctx, c.dir, c.upstream.URL, ref)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := remote[ref]; ok {
+		return branch, nil
+	}
+	if err := c.pushWithNotes(ctx, "HEAD:"+ref); err != nil {
+		return "", err
+	}
+	return branch, nil
+}
+
+func (c *Checkout) commitWithNote(ctx context.Context, commitAction CommitAction, note interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "git.commit")
+	defer func() { span.Finish(err) }()
+	if c.readonly {
+		return ErrReadOnly
+	}
 	if !check(ctx, c.dir, c.config.Paths) {
 		return ErrNoChanges
 	}
 
 	commitAction.Message += c.config.SkipMessage
+	if commitAction.SigningKey == "" {
+		commitAction.SigningKey = c.config.SigningKey
+	}
 
 	if err := commit(ctx, c.dir, commitAction); err != nil {
 		return err
@@ -136,14 +198,34 @@ func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction,
 			return err
 		}
 	}
+	return nil
+}
 
-	refs := []string{c.config.Branch}
+// pushWithNotes pushes the refspec given, along with the notes ref
+// if there is one and it has changed.
+func (c *Checkout) pushWithNotes(ctx context.Context, refspec string) (err error) {
+	ctx, span := tracing.Start(ctx, "git.push")
+	span.SetTag("refspec", refspec)
+	defer func() { span.Finish(err) }()
+	refs := []string{refspec}
 	ok, err := refExists(ctx, c.dir, c.realNotesRef)
-	if ok {
-		refs = append(refs, c.realNotesRef)
-	} else if err != nil {
+	if err != nil {
 		return err
 	}
+	if ok {
+		// Only push the notes if they differ from those upstream
+		local, err := refRevision(ctx, c.dir, c.realNotesRef)
+		if err != nil {
+			return err
+		}
+		remote, err := lsRemote(ctx, c.dir, c.upstream.URL, c.realNotesRef)
+		if err != nil {
+			return err
+		}
+		if remote[c.realNotesRef] != local {
+			refs = append(refs, c.realNotesRef)
+		}
+	}
 
 	if err := push(ctx, c.dir, c.upstream.URL, refs); err != nil {
 		return PushError(c.upstream.URL, err)
@@ -156,6 +238,16 @@ func (c *Checkout) GetNote(ctx context.Context, rev string, note interface{}) (b
 	return getNote(ctx, c.dir, c.realNotesRef, rev, note)
 }
 
+// Checkout switches the working clone to the given ref, e.g., a
+// tag. Since this detaches HEAD, it's not expected that anything will
+// be committed afterwards.
+func (c *Checkout) Checkout(ctx context.Context, ref string) error {
+	if err := checkout(ctx, c.dir, ref); err != nil {
+		return err
+	}
+	return updateSubmodules(ctx, c.dir, c.upstream.URL, c.submodules)
+}
+
 func (c *Checkout) HeadRevision(ctx context.Context) (string, error) {
 	return refRevision(ctx, c.dir, "HEAD")
 }
@@ -164,7 +256,13 @@ func (c *Checkout) SyncRevision(ctx context.Context) (string, error) {
 	return refRevision(ctx, c.dir, c.config.SyncTag)
 }
 
-func (c *Checkout) MoveSyncTagAndPush(ctx context.Context, ref, msg string) error {
+func (c *Checkout) MoveSyncTagAndPush(ctx context.Context, ref, msg string) (err error) {
+	if c.readonly {
+		return ErrReadOnly
+	}
+	ctx, span := tracing.Start(ctx, "git.move-sync-tag")
+	span.SetTag("revision", ref)
+	defer func() { span.Finish(err) }()
 	return moveTagAndPush(ctx, c.dir, c.config.SyncTag, ref, msg, c.upstream.URL)
 }
 
@@ -179,6 +277,31 @@ func (c *Checkout) ChangedFiles(ctx context.Context, ref string) ([]string, erro
 	return list, err
 }
 
+// FileDiff is the change made to a file in a checkout, and not yet
+// committed, as a unified diff.
+type FileDiff struct {
+	Path string `json:"path"` // relative to the top of the repo
+	Diff string `json:"diff"`
+}
+
+// Diffs gives the changes made to the files in the checkout's paths
+// since the last commit, a file at a time.
+func (c *Checkout) Diffs(ctx context.Context) ([]FileDiff, error) {
+	files, err := changed(ctx, c.dir, "HEAD", c.config.Paths)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []FileDiff
+	for _, file := range files {
+		diff, err := diffFile(ctx, c.dir, "HEAD", file)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, FileDiff{Path: file, Diff: diff})
+	}
+	return diffs, nil
+}
+
 func (c *Checkout) NoteRevList(ctx context.Context) (map[string]struct{}, error) {
 	return noteRevList(ctx, c.dir, c.realNotesRef)
 }
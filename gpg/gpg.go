@@ -0,0 +1,67 @@
+// Package gpg has helpers for making GPG keys available to git, so
+// that commits made by the daemon can be signed.
+package gpg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ImportKeys looks for all keys in a directory, and imports them into
+// the current user's keyring. A path to a directory or a file may be
+// provided. If the path is a directory, regular files in the
+// directory will be imported, but not subdirectories (i.e., no
+// recursion). It returns the basenames of the successfully imported
+// keys.
+func ImportKeys(src string) ([]string, error) {
+	info, err := os.Stat(src)
+	var files []string
+	switch {
+	case err != nil:
+		return nil, err
+	case info.IsDir():
+		infos, err := ioutil.ReadDir(src)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range infos {
+			if f.Mode().IsRegular() {
+				files = append(files, filepath.Join(src, f.Name()))
+			}
+		}
+	default:
+		files = []string{src}
+	}
+
+	var imported []string
+	var failed []string
+	for _, path := range files {
+		if err := gpgImport(path); err != nil {
+			failed = append(failed, filepath.Base(path))
+			continue
+		}
+		imported = append(imported, filepath.Base(path))
+	}
+
+	if len(failed) > 0 {
+		return imported, fmt.Errorf("errored importing keys: %v", failed)
+	}
+	return imported, nil
+}
+
+func gpgImport(path string) error {
+	cmd := exec.Command("gpg", "--import", path)
+	errOut := &bytes.Buffer{}
+	cmd.Stderr = errOut
+	if err := cmd.Run(); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("importing key from %s: %s", path, strings.TrimSpace(errOut.String())))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	"context"
+	"crypto/tls"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/weaveworks/flux/authz"
+	httpdaemon "github.com/weaveworks/flux/http/daemon"
+)
+
+// authenticate checks the credentials presented with a call -- its
+// client certificate, and the token given in the `authorization`
+// metadata, just as for the REST API -- and puts the identities of
+// the caller in the context, for authorization.
+func authenticate(ctx context.Context, auth httpdaemon.Auth) (context.Context, error) {
+	if !auth.Required() {
+		return ctx, nil
+	}
+	var conn *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			conn = &info.State
+		}
+	}
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md["authorization"]; len(values) > 0 {
+			token = httpdaemon.AuthorizationToken(values[0])
+		}
+	}
+	identities, err := auth.Identify(conn, token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return authz.WithIdentities(ctx, identities...), nil
+}
+
+func unaryAuth(auth httpdaemon.Auth) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, auth)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuth(auth httpdaemon.Auth) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), auth)
+		if err != nil {
+			return err
+		}
+		return handler(srv, authenticatedStream{stream, ctx})
+	}
+}
+
+// authenticatedStream is a stream with the context from
+// authenticate.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,252 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	pkgerrors "github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/audit"
+	fluxerr "github.com/weaveworks/flux/errors"
+	"github.com/weaveworks/flux/grpc/fluxpb"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+// errorStatus gives the gRPC status for an error from the API,
+// corresponding to the HTTP status the REST API would respond with.
+func errorStatus(err error) error {
+	code := codes.Internal
+	if ferr, ok := pkgerrors.Cause(err).(*fluxerr.Error); ok {
+		switch ferr.Type {
+		case fluxerr.Missing:
+			code = codes.NotFound
+		case fluxerr.User:
+			code = codes.FailedPrecondition
+		case fluxerr.Forbidden:
+			code = codes.PermissionDenied
+		}
+	}
+	return status.Error(code, err.Error())
+}
+
+// --- from protobuf
+
+var errNoUpdate = errors.New("no update given; give either release or policies")
+
+func causeFromProto(c *fluxpb.Cause) update.Cause {
+	if c == nil {
+		return update.Cause{}
+	}
+	return update.Cause{User: c.User, Message: c.Message}
+}
+
+func specFromProto(req *fluxpb.UpdateManifestsRequest) (update.Spec, error) {
+	spec := update.Spec{Cause: causeFromProto(req.Cause)}
+	switch {
+	case req.GetRelease() != nil:
+		release, err := releaseFromProto(req.GetRelease())
+		if err != nil {
+			return spec, err
+		}
+		spec.Type, spec.Spec = update.Images, release
+	case req.GetPolicies() != nil:
+		updates, err := policiesFromProto(req.GetPolicies())
+		if err != nil {
+			return spec, err
+		}
+		spec.Type, spec.Spec = update.Policy, updates
+	default:
+		return spec, errNoUpdate
+	}
+	return spec, nil
+}
+
+func releaseFromProto(r *fluxpb.ReleaseImages) (update.ReleaseSpec, error) {
+	var spec update.ReleaseSpec
+	if len(r.Workloads) == 0 {
+		return spec, fmt.Errorf("no workloads given to release to; give %s for all of them", update.ResourceSpecAll)
+	}
+	for _, w := range r.Workloads {
+		s, err := update.ParseResourceSpec(w)
+		if err != nil {
+			return spec, pkgerrors.Wrapf(err, "parsing workload %q", w)
+		}
+		spec.ServiceSpecs = append(spec.ServiceSpecs, s)
+	}
+	if r.Image == "" {
+		return spec, fmt.Errorf("no image given to release; give %s for the latest of each", update.ImageSpecLatest)
+	}
+	imageSpec, err := update.ParseImageSpec(r.Image)
+	if err != nil {
+		return spec, pkgerrors.Wrapf(err, "parsing image %q", r.Image)
+	}
+	spec.ImageSpec = imageSpec
+	for _, ex := range r.Excludes {
+		id, err := flux.ParseResourceID(ex)
+		if err != nil {
+			return spec, pkgerrors.Wrapf(err, "parsing excluded workload %q", ex)
+		}
+		spec.Excludes = append(spec.Excludes, id)
+	}
+	spec.Kind = update.ReleaseKindExecute
+	if r.DryRun {
+		spec.Kind = update.ReleaseKindPlan
+	}
+	spec.Force = r.Force
+	return spec, nil
+}
+
+func policiesFromProto(p *fluxpb.UpdatePolicies) (policy.Updates, error) {
+	if len(p.Workloads) == 0 {
+		return nil, errors.New("no workloads given to update policies of")
+	}
+	updates := policy.Updates{}
+	for w, u := range p.Workloads {
+		id, err := flux.ParseResourceID(w)
+		if err != nil {
+			return nil, pkgerrors.Wrapf(err, "parsing workload %q", w)
+		}
+		if u == nil {
+			continue
+		}
+		updates[id] = policy.Update{Add: policySet(u.Add), Remove: policySet(u.Remove)}
+	}
+	return updates, nil
+}
+
+func policySet(m map[string]string) policy.Set {
+	if len(m) == 0 {
+		return nil
+	}
+	set := policy.Set{}
+	for p, v := range m {
+		set[policy.Policy(p)] = v
+	}
+	return set
+}
+
+// --- to protobuf
+
+func timestampProto(t time.Time) *timestamp.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	ts, err := ptypes.TimestampProto(t)
+	if err != nil {
+		return nil
+	}
+	return ts
+}
+
+func workloadToProto(w v6.ControllerStatus) *fluxpb.Workload {
+	return &fluxpb.Workload{
+		Id:         w.ID.String(),
+		Containers: containersToProto(w.Containers),
+		ReadOnly:   string(w.ReadOnly),
+		Status:     w.Status,
+		Rollout: &fluxpb.Rollout{
+			Desired:   w.Rollout.Desired,
+			Updated:   w.Rollout.Updated,
+			Ready:     w.Rollout.Ready,
+			Available: w.Rollout.Available,
+			Outdated:  w.Rollout.Outdated,
+			Messages:  w.Rollout.Messages,
+		},
+		Labels:    w.Labels,
+		Policies:  w.Policies,
+		Automated: w.Automated,
+		Locked:    w.Locked,
+		Ignore:    w.Ignore,
+	}
+}
+
+func containersToProto(cs []v6.Container) []*fluxpb.Container {
+	var result []*fluxpb.Container
+	for _, c := range cs {
+		pc := &fluxpb.Container{
+			Name:                    c.Name,
+			Current:                 imageToProto(c.Current),
+			LatestFiltered:          imageToProto(c.LatestFiltered),
+			AvailableError:          c.AvailableError,
+			AvailableStale:          c.AvailableStale,
+			AvailableImagesCount:    int32(c.AvailableImagesCount),
+			NewAvailableImagesCount: int32(c.NewAvailableImagesCount),
+			FilteredImagesCount:     int32(c.FilteredImagesCount),
+			NewFilteredImagesCount:  int32(c.NewFilteredImagesCount),
+		}
+		for _, im := range c.Available {
+			pc.Available = append(pc.Available, imageToProto(im))
+		}
+		result = append(result, pc)
+	}
+	return result
+}
+
+func imageToProto(im image.Info) *fluxpb.Image {
+	if im.ID == (image.Ref{}) {
+		return nil
+	}
+	return &fluxpb.Image{
+		Id:        im.ID.String(),
+		Digest:    im.Digest,
+		ImageId:   im.ImageID,
+		CreatedAt: timestampProto(im.CreatedAt),
+	}
+}
+
+func jobStatusToProto(st job.Status) *fluxpb.JobStatusResponse {
+	res := &fluxpb.JobStatusResponse{
+		Status:   string(st.StatusString),
+		Error:    st.Err,
+		Revision: st.Result.Revision,
+	}
+	for id, r := range st.Result.Result {
+		wr := &fluxpb.WorkloadResult{
+			Id:     id.String(),
+			Status: string(r.Status),
+			Error:  r.Error,
+		}
+		for _, c := range r.PerContainer {
+			wr.Containers = append(wr.Containers, &fluxpb.ContainerUpdate{
+				Name:    c.Container,
+				Current: c.Current.String(),
+				Target:  c.Target.String(),
+			})
+		}
+		res.Results = append(res.Results, wr)
+	}
+	sort.Slice(res.Results, func(i, j int) bool {
+		return res.Results[i].Id < res.Results[j].Id
+	})
+	return res
+}
+
+func eventToProto(r audit.Record) *fluxpb.Event {
+	e := &fluxpb.Event{
+		Id:       r.ID,
+		Time:     timestampProto(r.Time),
+		Action:   string(r.Action),
+		User:     r.User,
+		Message:  r.Message,
+		Revision: r.Revision,
+		JobId:    r.JobID,
+		Summary:  r.Summary,
+		Error:    r.Error,
+		Severity: string(r.Severity),
+	}
+	for _, id := range r.Workloads {
+		e.Workloads = append(e.Workloads, id.String())
+	}
+	return e
+}
@@ -0,0 +1,184 @@
+// Package daemon serves the daemon's API as gRPC, as defined in
+// package fluxpb. It sits alongside the REST API served by package
+// http/daemon, and calls the same api.Server, so each can be used in
+// place of the other.
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"go.opencensus.io/plugin/ocgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/audit"
+	"github.com/weaveworks/flux/grpc/fluxpb"
+	httpdaemon "github.com/weaveworks/flux/http/daemon"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+// How often to look for new records in the audit log, when watching
+// events.
+const defaultEventsPollInterval = time.Second
+
+// Server adapts an api.Server to fluxpb.FluxServer.
+type Server struct {
+	server             api.Server
+	eventsPollInterval time.Duration
+}
+
+var _ fluxpb.FluxServer = &Server{}
+
+func NewServer(s api.Server) *Server {
+	return &Server{server: s, eventsPollInterval: defaultEventsPollInterval}
+}
+
+// NewGRPCServer makes a gRPC server for the API, which lets through
+// only calls that present the credentials the auth given requires.
+// Calls are traced, continuing the caller's trace if it sent one.
+func NewGRPCServer(s api.Server, auth httpdaemon.Auth, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.StatsHandler(&ocgrpc.ServerHandler{}),
+		grpc.UnaryInterceptor(unaryAuth(auth)),
+		grpc.StreamInterceptor(streamAuth(auth)))
+	g := grpc.NewServer(opts...)
+	fluxpb.RegisterFluxServer(g, NewServer(s))
+	return g
+}
+
+func (s *Server) ListWorkloads(ctx context.Context, req *fluxpb.ListWorkloadsRequest) (*fluxpb.ListWorkloadsResponse, error) {
+	workloads, err := s.server.ListServices(ctx, req.Namespace)
+	if err != nil {
+		return nil, errorStatus(err)
+	}
+	res := &fluxpb.ListWorkloadsResponse{}
+	for _, w := range workloads {
+		res.Workloads = append(res.Workloads, workloadToProto(w))
+	}
+	return res, nil
+}
+
+func (s *Server) ListImages(ctx context.Context, req *fluxpb.ListImagesRequest) (*fluxpb.ListImagesResponse, error) {
+	spec := update.ResourceSpecAll
+	if req.Workload != "" {
+		var err error
+		if spec, err = update.ParseResourceSpec(req.Workload); err != nil {
+			return nil, invalidArgument("parsing workload %q: %s", req.Workload, err)
+		}
+	}
+	images, err := s.server.ListImagesWithOptions(ctx, v10.ListImagesOptions{
+		Spec:                    spec,
+		OverrideContainerFields: req.ContainerFields,
+	})
+	if err != nil {
+		return nil, errorStatus(err)
+	}
+	res := &fluxpb.ListImagesResponse{}
+	for _, w := range images {
+		res.Workloads = append(res.Workloads, &fluxpb.WorkloadImages{
+			Id:         w.ID.String(),
+			Containers: containersToProto(w.Containers),
+		})
+	}
+	return res, nil
+}
+
+func (s *Server) UpdateManifests(ctx context.Context, req *fluxpb.UpdateManifestsRequest) (*fluxpb.JobResponse, error) {
+	spec, err := specFromProto(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return s.updateManifests(ctx, spec)
+}
+
+func (s *Server) Sync(ctx context.Context, req *fluxpb.SyncRequest) (*fluxpb.JobResponse, error) {
+	return s.updateManifests(ctx, update.Spec{
+		Type:  update.Sync,
+		Cause: causeFromProto(req.Cause),
+		Spec:  update.ManualSync{},
+	})
+}
+
+func (s *Server) updateManifests(ctx context.Context, spec update.Spec) (*fluxpb.JobResponse, error) {
+	id, err := s.server.UpdateManifests(ctx, spec)
+	if err != nil {
+		return nil, errorStatus(err)
+	}
+	return &fluxpb.JobResponse{JobId: string(id)}, nil
+}
+
+func (s *Server) JobStatus(ctx context.Context, req *fluxpb.JobStatusRequest) (*fluxpb.JobStatusResponse, error) {
+	st, err := s.server.JobStatus(ctx, job.ID(req.JobId))
+	if err != nil {
+		return nil, errorStatus(err)
+	}
+	return jobStatusToProto(st), nil
+}
+
+func (s *Server) SyncStatus(ctx context.Context, req *fluxpb.SyncStatusRequest) (*fluxpb.SyncStatusResponse, error) {
+	revisions, err := s.server.SyncStatus(ctx, req.Ref)
+	if err != nil {
+		return nil, errorStatus(err)
+	}
+	return &fluxpb.SyncStatusResponse{Revisions: revisions}, nil
+}
+
+// WatchEvents sends the records from the audit log that match the
+// request, looking for new ones every so often, until the caller
+// goes away. It resumes from the event with the ID given, if one is.
+func (s *Server) WatchEvents(req *fluxpb.WatchEventsRequest, stream fluxpb.Flux_WatchEventsServer) error {
+	reader, ok := s.server.(httpdaemon.AuditReader)
+	if !ok {
+		return status.Error(codes.Unimplemented, "the audit log is not available from this server")
+	}
+	q := audit.Query{AfterID: req.AfterId}
+	if req.Since != nil {
+		since, err := ptypes.Timestamp(req.Since)
+		if err != nil {
+			return invalidArgument("invalid since: %s", err)
+		}
+		q.Since = since
+	} else if q.AfterID == 0 {
+		q.Since = time.Now()
+	}
+	if req.MinSeverity != "" {
+		sev, err := audit.ParseSeverity(req.MinSeverity)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		q.MinSeverity = sev
+	}
+	for _, a := range req.Actions {
+		action, err := audit.ParseAction(a)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		q.Actions = append(q.Actions, action)
+	}
+
+	ctx := stream.Context()
+	for {
+		for _, r := range reader.AuditRecords(ctx, q) {
+			if err := stream.Send(eventToProto(r)); err != nil {
+				return err
+			}
+			q.AfterID = r.ID
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.eventsPollInterval):
+		}
+	}
+}
+
+func invalidArgument(format string, args ...interface{}) error {
+	return status.Error(codes.InvalidArgument, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,239 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/audit"
+	fluxerr "github.com/weaveworks/flux/errors"
+	"github.com/weaveworks/flux/grpc/fluxpb"
+	httpdaemon "github.com/weaveworks/flux/http/daemon"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/remote"
+	"github.com/weaveworks/flux/update"
+)
+
+// serve serves the API from the server given, and returns a client
+// connected to it.
+func serve(t *testing.T, g *grpc.Server) (fluxpb.FluxClient, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go g.Serve(l)
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fluxpb.NewFluxClient(conn), func() {
+		conn.Close()
+		g.Stop()
+	}
+}
+
+func TestServer_ListWorkloads(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	mock := &remote.MockServer{
+		ListServicesAnswer: []v6.ControllerStatus{{
+			ID:       id,
+			Status:   "ready",
+			Locked:   true,
+			Policies: map[string]string{"locked": "true"},
+			Containers: []v6.Container{{
+				Name:    "greeter",
+				Current: image.Info{ID: image.Ref{Name: image.Name{Image: "weaveworks/helloworld"}, Tag: "master-a000001"}},
+			}},
+		}},
+	}
+	client, stop := serve(t, NewGRPCServer(mock, httpdaemon.Auth{}))
+	defer stop()
+
+	res, err := client.ListWorkloads(context.Background(), &fluxpb.ListWorkloadsRequest{})
+	if !assert.NoError(t, err) || !assert.Len(t, res.Workloads, 1) {
+		return
+	}
+	w := res.Workloads[0]
+	assert.Equal(t, id.String(), w.Id)
+	assert.Equal(t, "ready", w.Status)
+	assert.True(t, w.Locked)
+	assert.Equal(t, map[string]string{"locked": "true"}, w.Policies)
+	if assert.Len(t, w.Containers, 1) {
+		assert.Equal(t, "greeter", w.Containers[0].Name)
+		assert.Equal(t, "weaveworks/helloworld:master-a000001", w.Containers[0].Current.Id)
+		assert.Nil(t, w.Containers[0].LatestFiltered)
+	}
+
+	mock.ListServicesError = &fluxerr.Error{Type: fluxerr.Missing, Err: errors.New("no such namespace")}
+	_, err = client.ListWorkloads(context.Background(), &fluxpb.ListWorkloadsRequest{Namespace: "nowhere"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_UpdateManifests(t *testing.T) {
+	var got update.Spec
+	mock := &remote.MockServer{
+		UpdateManifestsArgTest: func(s update.Spec) error {
+			got = s
+			return nil
+		},
+		UpdateManifestsAnswer: "job-1",
+	}
+	client, stop := serve(t, NewGRPCServer(mock, httpdaemon.Auth{}))
+	defer stop()
+	ctx := context.Background()
+
+	res, err := client.UpdateManifests(ctx, &fluxpb.UpdateManifestsRequest{
+		Spec: &fluxpb.UpdateManifestsRequest_Release{Release: &fluxpb.ReleaseImages{
+			Workloads: []string{"default:deployment/helloworld"},
+			Image:     "<all latest>",
+			DryRun:    true,
+		}},
+		Cause: &fluxpb.Cause{User: "alice", Message: "testing"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "job-1", res.JobId)
+	assert.Equal(t, update.Images, got.Type)
+	assert.Equal(t, update.Cause{User: "alice", Message: "testing"}, got.Cause)
+	assert.Equal(t, update.ReleaseSpec{
+		ServiceSpecs: []update.ResourceSpec{"default:deployment/helloworld"},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindPlan,
+	}, got.Spec)
+
+	_, err = client.UpdateManifests(ctx, &fluxpb.UpdateManifestsRequest{
+		Spec: &fluxpb.UpdateManifestsRequest_Policies{Policies: &fluxpb.UpdatePolicies{
+			Workloads: map[string]*fluxpb.PolicyUpdate{
+				"default:deployment/helloworld": {Add: map[string]string{"automated": "true"}},
+			},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, update.Policy, got.Type)
+
+	_, err = client.Sync(ctx, &fluxpb.SyncRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, update.Sync, got.Type)
+
+	for _, bad := range []*fluxpb.UpdateManifestsRequest{
+		{},
+		{Spec: &fluxpb.UpdateManifestsRequest_Release{Release: &fluxpb.ReleaseImages{Image: "<all latest>"}}},
+		{Spec: &fluxpb.UpdateManifestsRequest_Release{Release: &fluxpb.ReleaseImages{Workloads: []string{"<all>"}}}},
+	} {
+		_, err = client.UpdateManifests(ctx, bad)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "%v", bad)
+	}
+}
+
+type auditServer struct {
+	api.Server
+	log *audit.Log
+}
+
+func (s auditServer) AuditRecords(_ context.Context, q audit.Query) []audit.Record {
+	return s.log.Records(q)
+}
+
+func TestServer_WatchEvents(t *testing.T) {
+	log := audit.New(0)
+	start := time.Now()
+	log.Record(audit.Record{Time: start.Add(-time.Minute), Action: audit.Sync, Revision: "before"})
+	log.Record(audit.Record{Time: start.Add(-time.Second), Action: audit.Release, Revision: "filtered"})
+
+	g := grpc.NewServer()
+	fluxpb.RegisterFluxServer(g, &Server{
+		server:             auditServer{&remote.MockServer{}, log},
+		eventsPollInterval: 10 * time.Millisecond,
+	})
+	client, stop := serve(t, g)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	since, _ := ptypes.TimestampProto(start.Add(-time.Hour))
+	stream, err := client.WatchEvents(ctx, &fluxpb.WatchEventsRequest{Since: since, Actions: []string{"sync"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := stream.Recv()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "before", event.Revision)
+	assert.Equal(t, "info", event.Severity)
+
+	log.Record(audit.Record{Action: audit.Sync, Revision: "after", Error: "it went wrong"})
+	event, err = stream.Recv()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "after", event.Revision)
+	assert.Equal(t, "error", event.Severity)
+	afterID := event.Id
+
+	// Resuming from an event gives only those after it
+	log.Record(audit.Record{Action: audit.Sync, Revision: "resumed"})
+	stream, err = client.WatchEvents(ctx, &fluxpb.WatchEventsRequest{AfterId: afterID})
+	if !assert.NoError(t, err) {
+		return
+	}
+	event, err = stream.Recv()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "resumed", event.Revision)
+	}
+
+	// Errors in a stream come when receiving from it
+	stream, err = client.WatchEvents(ctx, &fluxpb.WatchEventsRequest{Actions: []string{"nonesuch"}})
+	if assert.NoError(t, err) {
+		_, err = stream.Recv()
+	}
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Auth(t *testing.T) {
+	f, err := ioutil.TempFile("", "flux-api-tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("secret ci\n")
+	f.Close()
+	tokens, err := httpdaemon.NewTokenFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, stop := serve(t, NewGRPCServer(&remote.MockServer{}, httpdaemon.Auth{Tokens: tokens}))
+	defer stop()
+
+	withToken := func(token string) context.Context {
+		return metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+	_, err = client.ListWorkloads(context.Background(), &fluxpb.ListWorkloadsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.ListWorkloads(withToken("wrong"), &fluxpb.ListWorkloadsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.ListWorkloads(withToken("secret"), &fluxpb.ListWorkloadsRequest{})
+	assert.NoError(t, err)
+
+	stream, err := client.WatchEvents(context.Background(), &fluxpb.WatchEventsRequest{})
+	if assert.NoError(t, err) {
+		_, err = stream.Recv()
+	}
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
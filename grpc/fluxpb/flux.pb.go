@@ -0,0 +1,1469 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: flux.proto
+
+/*
+Package fluxpb is a generated protocol buffer package.
+
+It is generated from these files:
+
+	flux.proto
+
+It has these top-level messages:
+
+	ListWorkloadsRequest
+	ListWorkloadsResponse
+	Workload
+	Rollout
+	Container
+	Image
+	ListImagesRequest
+	ListImagesResponse
+	WorkloadImages
+	Cause
+	UpdateManifestsRequest
+	ReleaseImages
+	UpdatePolicies
+	PolicyUpdate
+	SyncRequest
+	JobResponse
+	JobStatusRequest
+	JobStatusResponse
+	WorkloadResult
+	ContainerUpdate
+	SyncStatusRequest
+	SyncStatusResponse
+	WatchEventsRequest
+	Event
+*/
+package fluxpb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import google_protobuf "github.com/golang/protobuf/ptypes/timestamp"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type ListWorkloadsRequest struct {
+	// Only workloads in this namespace, if given
+	Namespace string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+}
+
+func (m *ListWorkloadsRequest) Reset()                    { *m = ListWorkloadsRequest{} }
+func (m *ListWorkloadsRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListWorkloadsRequest) ProtoMessage()               {}
+func (*ListWorkloadsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *ListWorkloadsRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+type ListWorkloadsResponse struct {
+	Workloads []*Workload `protobuf:"bytes,1,rep,name=workloads" json:"workloads,omitempty"`
+}
+
+func (m *ListWorkloadsResponse) Reset()                    { *m = ListWorkloadsResponse{} }
+func (m *ListWorkloadsResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListWorkloadsResponse) ProtoMessage()               {}
+func (*ListWorkloadsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *ListWorkloadsResponse) GetWorkloads() []*Workload {
+	if m != nil {
+		return m.Workloads
+	}
+	return nil
+}
+
+type Workload struct {
+	// e.g., `default:deployment/helloworld`
+	Id         string       `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Containers []*Container `protobuf:"bytes,2,rep,name=containers" json:"containers,omitempty"`
+	// Why the workload can't be changed, if it can't
+	ReadOnly  string            `protobuf:"bytes,3,opt,name=read_only,json=readOnly" json:"read_only,omitempty"`
+	Status    string            `protobuf:"bytes,4,opt,name=status" json:"status,omitempty"`
+	Rollout   *Rollout          `protobuf:"bytes,5,opt,name=rollout" json:"rollout,omitempty"`
+	Labels    map[string]string `protobuf:"bytes,6,rep,name=labels" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Policies  map[string]string `protobuf:"bytes,7,rep,name=policies" json:"policies,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Automated bool              `protobuf:"varint,8,opt,name=automated" json:"automated,omitempty"`
+	Locked    bool              `protobuf:"varint,9,opt,name=locked" json:"locked,omitempty"`
+	Ignore    bool              `protobuf:"varint,10,opt,name=ignore" json:"ignore,omitempty"`
+}
+
+func (m *Workload) Reset()                    { *m = Workload{} }
+func (m *Workload) String() string            { return proto.CompactTextString(m) }
+func (*Workload) ProtoMessage()               {}
+func (*Workload) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Workload) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Workload) GetContainers() []*Container {
+	if m != nil {
+		return m.Containers
+	}
+	return nil
+}
+
+func (m *Workload) GetReadOnly() string {
+	if m != nil {
+		return m.ReadOnly
+	}
+	return ""
+}
+
+func (m *Workload) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *Workload) GetRollout() *Rollout {
+	if m != nil {
+		return m.Rollout
+	}
+	return nil
+}
+
+func (m *Workload) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *Workload) GetPolicies() map[string]string {
+	if m != nil {
+		return m.Policies
+	}
+	return nil
+}
+
+func (m *Workload) GetAutomated() bool {
+	if m != nil {
+		return m.Automated
+	}
+	return false
+}
+
+func (m *Workload) GetLocked() bool {
+	if m != nil {
+		return m.Locked
+	}
+	return false
+}
+
+func (m *Workload) GetIgnore() bool {
+	if m != nil {
+		return m.Ignore
+	}
+	return false
+}
+
+type Rollout struct {
+	Desired   int32    `protobuf:"varint,1,opt,name=desired" json:"desired,omitempty"`
+	Updated   int32    `protobuf:"varint,2,opt,name=updated" json:"updated,omitempty"`
+	Ready     int32    `protobuf:"varint,3,opt,name=ready" json:"ready,omitempty"`
+	Available int32    `protobuf:"varint,4,opt,name=available" json:"available,omitempty"`
+	Outdated  int32    `protobuf:"varint,5,opt,name=outdated" json:"outdated,omitempty"`
+	Messages  []string `protobuf:"bytes,6,rep,name=messages" json:"messages,omitempty"`
+}
+
+func (m *Rollout) Reset()                    { *m = Rollout{} }
+func (m *Rollout) String() string            { return proto.CompactTextString(m) }
+func (*Rollout) ProtoMessage()               {}
+func (*Rollout) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *Rollout) GetDesired() int32 {
+	if m != nil {
+		return m.Desired
+	}
+	return 0
+}
+
+func (m *Rollout) GetUpdated() int32 {
+	if m != nil {
+		return m.Updated
+	}
+	return 0
+}
+
+func (m *Rollout) GetReady() int32 {
+	if m != nil {
+		return m.Ready
+	}
+	return 0
+}
+
+func (m *Rollout) GetAvailable() int32 {
+	if m != nil {
+		return m.Available
+	}
+	return 0
+}
+
+func (m *Rollout) GetOutdated() int32 {
+	if m != nil {
+		return m.Outdated
+	}
+	return 0
+}
+
+func (m *Rollout) GetMessages() []string {
+	if m != nil {
+		return m.Messages
+	}
+	return nil
+}
+
+type Container struct {
+	Name                    string   `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Current                 *Image   `protobuf:"bytes,2,opt,name=current" json:"current,omitempty"`
+	LatestFiltered          *Image   `protobuf:"bytes,3,opt,name=latest_filtered,json=latestFiltered" json:"latest_filtered,omitempty"`
+	Available               []*Image `protobuf:"bytes,4,rep,name=available" json:"available,omitempty"`
+	AvailableError          string   `protobuf:"bytes,5,opt,name=available_error,json=availableError" json:"available_error,omitempty"`
+	AvailableStale          bool     `protobuf:"varint,6,opt,name=available_stale,json=availableStale" json:"available_stale,omitempty"`
+	AvailableImagesCount    int32    `protobuf:"varint,7,opt,name=available_images_count,json=availableImagesCount" json:"available_images_count,omitempty"`
+	NewAvailableImagesCount int32    `protobuf:"varint,8,opt,name=new_available_images_count,json=newAvailableImagesCount" json:"new_available_images_count,omitempty"`
+	FilteredImagesCount     int32    `protobuf:"varint,9,opt,name=filtered_images_count,json=filteredImagesCount" json:"filtered_images_count,omitempty"`
+	NewFilteredImagesCount  int32    `protobuf:"varint,10,opt,name=new_filtered_images_count,json=newFilteredImagesCount" json:"new_filtered_images_count,omitempty"`
+}
+
+func (m *Container) Reset()                    { *m = Container{} }
+func (m *Container) String() string            { return proto.CompactTextString(m) }
+func (*Container) ProtoMessage()               {}
+func (*Container) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *Container) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Container) GetCurrent() *Image {
+	if m != nil {
+		return m.Current
+	}
+	return nil
+}
+
+func (m *Container) GetLatestFiltered() *Image {
+	if m != nil {
+		return m.LatestFiltered
+	}
+	return nil
+}
+
+func (m *Container) GetAvailable() []*Image {
+	if m != nil {
+		return m.Available
+	}
+	return nil
+}
+
+func (m *Container) GetAvailableError() string {
+	if m != nil {
+		return m.AvailableError
+	}
+	return ""
+}
+
+func (m *Container) GetAvailableStale() bool {
+	if m != nil {
+		return m.AvailableStale
+	}
+	return false
+}
+
+func (m *Container) GetAvailableImagesCount() int32 {
+	if m != nil {
+		return m.AvailableImagesCount
+	}
+	return 0
+}
+
+func (m *Container) GetNewAvailableImagesCount() int32 {
+	if m != nil {
+		return m.NewAvailableImagesCount
+	}
+	return 0
+}
+
+func (m *Container) GetFilteredImagesCount() int32 {
+	if m != nil {
+		return m.FilteredImagesCount
+	}
+	return 0
+}
+
+func (m *Container) GetNewFilteredImagesCount() int32 {
+	if m != nil {
+		return m.NewFilteredImagesCount
+	}
+	return 0
+}
+
+type Image struct {
+	// e.g., `quay.io/weaveworks/helloworld:master-a000001`
+	Id        string                     `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Digest    string                     `protobuf:"bytes,2,opt,name=digest" json:"digest,omitempty"`
+	ImageId   string                     `protobuf:"bytes,3,opt,name=image_id,json=imageId" json:"image_id,omitempty"`
+	CreatedAt *google_protobuf.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
+}
+
+func (m *Image) Reset()                    { *m = Image{} }
+func (m *Image) String() string            { return proto.CompactTextString(m) }
+func (*Image) ProtoMessage()               {}
+func (*Image) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *Image) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Image) GetDigest() string {
+	if m != nil {
+		return m.Digest
+	}
+	return ""
+}
+
+func (m *Image) GetImageId() string {
+	if m != nil {
+		return m.ImageId
+	}
+	return ""
+}
+
+func (m *Image) GetCreatedAt() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+type ListImagesRequest struct {
+	// A workload ID, or `<all>`, which is the default
+	Workload string `protobuf:"bytes,1,opt,name=workload" json:"workload,omitempty"`
+	// Give only these fields of each container, if any are given
+	ContainerFields []string `protobuf:"bytes,2,rep,name=container_fields,json=containerFields" json:"container_fields,omitempty"`
+}
+
+func (m *ListImagesRequest) Reset()                    { *m = ListImagesRequest{} }
+func (m *ListImagesRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListImagesRequest) ProtoMessage()               {}
+func (*ListImagesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *ListImagesRequest) GetWorkload() string {
+	if m != nil {
+		return m.Workload
+	}
+	return ""
+}
+
+func (m *ListImagesRequest) GetContainerFields() []string {
+	if m != nil {
+		return m.ContainerFields
+	}
+	return nil
+}
+
+type ListImagesResponse struct {
+	Workloads []*WorkloadImages `protobuf:"bytes,1,rep,name=workloads" json:"workloads,omitempty"`
+}
+
+func (m *ListImagesResponse) Reset()                    { *m = ListImagesResponse{} }
+func (m *ListImagesResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListImagesResponse) ProtoMessage()               {}
+func (*ListImagesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *ListImagesResponse) GetWorkloads() []*WorkloadImages {
+	if m != nil {
+		return m.Workloads
+	}
+	return nil
+}
+
+type WorkloadImages struct {
+	Id         string       `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Containers []*Container `protobuf:"bytes,2,rep,name=containers" json:"containers,omitempty"`
+}
+
+func (m *WorkloadImages) Reset()                    { *m = WorkloadImages{} }
+func (m *WorkloadImages) String() string            { return proto.CompactTextString(m) }
+func (*WorkloadImages) ProtoMessage()               {}
+func (*WorkloadImages) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *WorkloadImages) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *WorkloadImages) GetContainers() []*Container {
+	if m != nil {
+		return m.Containers
+	}
+	return nil
+}
+
+type Cause struct {
+	User    string `protobuf:"bytes,1,opt,name=user" json:"user,omitempty"`
+	Message string `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`
+}
+
+func (m *Cause) Reset()                    { *m = Cause{} }
+func (m *Cause) String() string            { return proto.CompactTextString(m) }
+func (*Cause) ProtoMessage()               {}
+func (*Cause) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *Cause) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
+func (m *Cause) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+type UpdateManifestsRequest struct {
+	// Types that are valid to be assigned to Spec:
+	//	*UpdateManifestsRequest_Release
+	//	*UpdateManifestsRequest_Policies
+	Spec  isUpdateManifestsRequest_Spec `protobuf_oneof:"spec"`
+	Cause *Cause                        `protobuf:"bytes,3,opt,name=cause" json:"cause,omitempty"`
+}
+
+func (m *UpdateManifestsRequest) Reset()                    { *m = UpdateManifestsRequest{} }
+func (m *UpdateManifestsRequest) String() string            { return proto.CompactTextString(m) }
+func (*UpdateManifestsRequest) ProtoMessage()               {}
+func (*UpdateManifestsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+type isUpdateManifestsRequest_Spec interface{ isUpdateManifestsRequest_Spec() }
+
+type UpdateManifestsRequest_Release struct {
+	Release *ReleaseImages `protobuf:"bytes,1,opt,name=release,oneof"`
+}
+type UpdateManifestsRequest_Policies struct {
+	Policies *UpdatePolicies `protobuf:"bytes,2,opt,name=policies,oneof"`
+}
+
+func (*UpdateManifestsRequest_Release) isUpdateManifestsRequest_Spec()  {}
+func (*UpdateManifestsRequest_Policies) isUpdateManifestsRequest_Spec() {}
+
+func (m *UpdateManifestsRequest) GetSpec() isUpdateManifestsRequest_Spec {
+	if m != nil {
+		return m.Spec
+	}
+	return nil
+}
+
+func (m *UpdateManifestsRequest) GetRelease() *ReleaseImages {
+	if x, ok := m.GetSpec().(*UpdateManifestsRequest_Release); ok {
+		return x.Release
+	}
+	return nil
+}
+
+func (m *UpdateManifestsRequest) GetPolicies() *UpdatePolicies {
+	if x, ok := m.GetSpec().(*UpdateManifestsRequest_Policies); ok {
+		return x.Policies
+	}
+	return nil
+}
+
+func (m *UpdateManifestsRequest) GetCause() *Cause {
+	if m != nil {
+		return m.Cause
+	}
+	return nil
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*UpdateManifestsRequest) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
+	return _UpdateManifestsRequest_OneofMarshaler, _UpdateManifestsRequest_OneofUnmarshaler, _UpdateManifestsRequest_OneofSizer, []interface{}{
+		(*UpdateManifestsRequest_Release)(nil),
+		(*UpdateManifestsRequest_Policies)(nil),
+	}
+}
+
+func _UpdateManifestsRequest_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*UpdateManifestsRequest)
+	// spec
+	switch x := m.Spec.(type) {
+	case *UpdateManifestsRequest_Release:
+		b.EncodeVarint(1<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Release); err != nil {
+			return err
+		}
+	case *UpdateManifestsRequest_Policies:
+		b.EncodeVarint(2<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Policies); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		return fmt.Errorf("UpdateManifestsRequest.Spec has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _UpdateManifestsRequest_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*UpdateManifestsRequest)
+	switch tag {
+	case 1: // spec.release
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(ReleaseImages)
+		err := b.DecodeMessage(msg)
+		m.Spec = &UpdateManifestsRequest_Release{msg}
+		return true, err
+	case 2: // spec.policies
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(UpdatePolicies)
+		err := b.DecodeMessage(msg)
+		m.Spec = &UpdateManifestsRequest_Policies{msg}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+func _UpdateManifestsRequest_OneofSizer(msg proto.Message) (n int) {
+	m := msg.(*UpdateManifestsRequest)
+	// spec
+	switch x := m.Spec.(type) {
+	case *UpdateManifestsRequest_Release:
+		s := proto.Size(x.Release)
+		n += proto.SizeVarint(1<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *UpdateManifestsRequest_Policies:
+		s := proto.Size(x.Policies)
+		n += proto.SizeVarint(2<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case nil:
+	default:
+		panic(fmt.Sprintf("proto: unexpected type %T in oneof", x))
+	}
+	return n
+}
+
+type ReleaseImages struct {
+	// Workload IDs, or `<all>`
+	Workloads []string `protobuf:"bytes,1,rep,name=workloads" json:"workloads,omitempty"`
+	// An image ref, or `<all latest>`
+	Image    string   `protobuf:"bytes,2,opt,name=image" json:"image,omitempty"`
+	Excludes []string `protobuf:"bytes,3,rep,name=excludes" json:"excludes,omitempty"`
+	// Work out what would be released, without committing it
+	DryRun bool `protobuf:"varint,4,opt,name=dry_run,json=dryRun" json:"dry_run,omitempty"`
+	// Release to workloads even if they're locked, or to images even
+	// if they don't match the tag filter
+	Force bool `protobuf:"varint,5,opt,name=force" json:"force,omitempty"`
+}
+
+func (m *ReleaseImages) Reset()                    { *m = ReleaseImages{} }
+func (m *ReleaseImages) String() string            { return proto.CompactTextString(m) }
+func (*ReleaseImages) ProtoMessage()               {}
+func (*ReleaseImages) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *ReleaseImages) GetWorkloads() []string {
+	if m != nil {
+		return m.Workloads
+	}
+	return nil
+}
+
+func (m *ReleaseImages) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *ReleaseImages) GetExcludes() []string {
+	if m != nil {
+		return m.Excludes
+	}
+	return nil
+}
+
+func (m *ReleaseImages) GetDryRun() bool {
+	if m != nil {
+		return m.DryRun
+	}
+	return false
+}
+
+func (m *ReleaseImages) GetForce() bool {
+	if m != nil {
+		return m.Force
+	}
+	return false
+}
+
+type UpdatePolicies struct {
+	// The changes to make, by workload ID
+	Workloads map[string]*PolicyUpdate `protobuf:"bytes,1,rep,name=workloads" json:"workloads,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *UpdatePolicies) Reset()                    { *m = UpdatePolicies{} }
+func (m *UpdatePolicies) String() string            { return proto.CompactTextString(m) }
+func (*UpdatePolicies) ProtoMessage()               {}
+func (*UpdatePolicies) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *UpdatePolicies) GetWorkloads() map[string]*PolicyUpdate {
+	if m != nil {
+		return m.Workloads
+	}
+	return nil
+}
+
+type PolicyUpdate struct {
+	// e.g., `automated: "true"`, `tag.app: "semver:~1"`
+	Add    map[string]string `protobuf:"bytes,1,rep,name=add" json:"add,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Remove map[string]string `protobuf:"bytes,2,rep,name=remove" json:"remove,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *PolicyUpdate) Reset()                    { *m = PolicyUpdate{} }
+func (m *PolicyUpdate) String() string            { return proto.CompactTextString(m) }
+func (*PolicyUpdate) ProtoMessage()               {}
+func (*PolicyUpdate) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *PolicyUpdate) GetAdd() map[string]string {
+	if m != nil {
+		return m.Add
+	}
+	return nil
+}
+
+func (m *PolicyUpdate) GetRemove() map[string]string {
+	if m != nil {
+		return m.Remove
+	}
+	return nil
+}
+
+type SyncRequest struct {
+	Cause *Cause `protobuf:"bytes,1,opt,name=cause" json:"cause,omitempty"`
+}
+
+func (m *SyncRequest) Reset()                    { *m = SyncRequest{} }
+func (m *SyncRequest) String() string            { return proto.CompactTextString(m) }
+func (*SyncRequest) ProtoMessage()               {}
+func (*SyncRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *SyncRequest) GetCause() *Cause {
+	if m != nil {
+		return m.Cause
+	}
+	return nil
+}
+
+type JobResponse struct {
+	JobId string `protobuf:"bytes,1,opt,name=job_id,json=jobId" json:"job_id,omitempty"`
+}
+
+func (m *JobResponse) Reset()                    { *m = JobResponse{} }
+func (m *JobResponse) String() string            { return proto.CompactTextString(m) }
+func (*JobResponse) ProtoMessage()               {}
+func (*JobResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *JobResponse) GetJobId() string {
+	if m != nil {
+		return m.JobId
+	}
+	return ""
+}
+
+type JobStatusRequest struct {
+	JobId string `protobuf:"bytes,1,opt,name=job_id,json=jobId" json:"job_id,omitempty"`
+}
+
+func (m *JobStatusRequest) Reset()                    { *m = JobStatusRequest{} }
+func (m *JobStatusRequest) String() string            { return proto.CompactTextString(m) }
+func (*JobStatusRequest) ProtoMessage()               {}
+func (*JobStatusRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *JobStatusRequest) GetJobId() string {
+	if m != nil {
+		return m.JobId
+	}
+	return ""
+}
+
+type JobStatusResponse struct {
+	// One of queued, running, failed, succeeded
+	Status string `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	Error  string `protobuf:"bytes,2,opt,name=error" json:"error,omitempty"`
+	// The revision committed or synced, once the job has succeeded
+	Revision string            `protobuf:"bytes,3,opt,name=revision" json:"revision,omitempty"`
+	Results  []*WorkloadResult `protobuf:"bytes,4,rep,name=results" json:"results,omitempty"`
+}
+
+func (m *JobStatusResponse) Reset()                    { *m = JobStatusResponse{} }
+func (m *JobStatusResponse) String() string            { return proto.CompactTextString(m) }
+func (*JobStatusResponse) ProtoMessage()               {}
+func (*JobStatusResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *JobStatusResponse) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *JobStatusResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *JobStatusResponse) GetRevision() string {
+	if m != nil {
+		return m.Revision
+	}
+	return ""
+}
+
+func (m *JobStatusResponse) GetResults() []*WorkloadResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+type WorkloadResult struct {
+	Id         string             `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Status     string             `protobuf:"bytes,2,opt,name=status" json:"status,omitempty"`
+	Error      string             `protobuf:"bytes,3,opt,name=error" json:"error,omitempty"`
+	Containers []*ContainerUpdate `protobuf:"bytes,4,rep,name=containers" json:"containers,omitempty"`
+}
+
+func (m *WorkloadResult) Reset()                    { *m = WorkloadResult{} }
+func (m *WorkloadResult) String() string            { return proto.CompactTextString(m) }
+func (*WorkloadResult) ProtoMessage()               {}
+func (*WorkloadResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
+
+func (m *WorkloadResult) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *WorkloadResult) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *WorkloadResult) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *WorkloadResult) GetContainers() []*ContainerUpdate {
+	if m != nil {
+		return m.Containers
+	}
+	return nil
+}
+
+type ContainerUpdate struct {
+	Name    string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Current string `protobuf:"bytes,2,opt,name=current" json:"current,omitempty"`
+	Target  string `protobuf:"bytes,3,opt,name=target" json:"target,omitempty"`
+}
+
+func (m *ContainerUpdate) Reset()                    { *m = ContainerUpdate{} }
+func (m *ContainerUpdate) String() string            { return proto.CompactTextString(m) }
+func (*ContainerUpdate) ProtoMessage()               {}
+func (*ContainerUpdate) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
+
+func (m *ContainerUpdate) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ContainerUpdate) GetCurrent() string {
+	if m != nil {
+		return m.Current
+	}
+	return ""
+}
+
+func (m *ContainerUpdate) GetTarget() string {
+	if m != nil {
+		return m.Target
+	}
+	return ""
+}
+
+type SyncStatusRequest struct {
+	// A git ref, usually a revision from a job's result
+	Ref string `protobuf:"bytes,1,opt,name=ref" json:"ref,omitempty"`
+}
+
+func (m *SyncStatusRequest) Reset()                    { *m = SyncStatusRequest{} }
+func (m *SyncStatusRequest) String() string            { return proto.CompactTextString(m) }
+func (*SyncStatusRequest) ProtoMessage()               {}
+func (*SyncStatusRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
+
+func (m *SyncStatusRequest) GetRef() string {
+	if m != nil {
+		return m.Ref
+	}
+	return ""
+}
+
+type SyncStatusResponse struct {
+	// The commits not yet synced; empty once the ref has been synced
+	Revisions []string `protobuf:"bytes,1,rep,name=revisions" json:"revisions,omitempty"`
+}
+
+func (m *SyncStatusResponse) Reset()                    { *m = SyncStatusResponse{} }
+func (m *SyncStatusResponse) String() string            { return proto.CompactTextString(m) }
+func (*SyncStatusResponse) ProtoMessage()               {}
+func (*SyncStatusResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+
+func (m *SyncStatusResponse) GetRevisions() []string {
+	if m != nil {
+		return m.Revisions
+	}
+	return nil
+}
+
+type WatchEventsRequest struct {
+	// Only events after this time; if neither this nor after_id is
+	// given, only events from now on
+	Since *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=since" json:"since,omitempty"`
+	// Only events at least this severe: info, warning or error
+	MinSeverity string `protobuf:"bytes,2,opt,name=min_severity,json=minSeverity" json:"min_severity,omitempty"`
+	// Only events of these actions, if any are given
+	Actions []string `protobuf:"bytes,3,rep,name=actions" json:"actions,omitempty"`
+	// Only events after the one with this ID; to resume watching,
+	// give the ID of the last event seen
+	AfterId uint64 `protobuf:"varint,4,opt,name=after_id,json=afterId" json:"after_id,omitempty"`
+}
+
+func (m *WatchEventsRequest) Reset()                    { *m = WatchEventsRequest{} }
+func (m *WatchEventsRequest) String() string            { return proto.CompactTextString(m) }
+func (*WatchEventsRequest) ProtoMessage()               {}
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+
+func (m *WatchEventsRequest) GetSince() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Since
+	}
+	return nil
+}
+
+func (m *WatchEventsRequest) GetMinSeverity() string {
+	if m != nil {
+		return m.MinSeverity
+	}
+	return ""
+}
+
+func (m *WatchEventsRequest) GetActions() []string {
+	if m != nil {
+		return m.Actions
+	}
+	return nil
+}
+
+func (m *WatchEventsRequest) GetAfterId() uint64 {
+	if m != nil {
+		return m.AfterId
+	}
+	return 0
+}
+
+type Event struct {
+	Time      *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=time" json:"time,omitempty"`
+	Action    string                     `protobuf:"bytes,2,opt,name=action" json:"action,omitempty"`
+	User      string                     `protobuf:"bytes,3,opt,name=user" json:"user,omitempty"`
+	Message   string                     `protobuf:"bytes,4,opt,name=message" json:"message,omitempty"`
+	Workloads []string                   `protobuf:"bytes,5,rep,name=workloads" json:"workloads,omitempty"`
+	Revision  string                     `protobuf:"bytes,6,opt,name=revision" json:"revision,omitempty"`
+	JobId     string                     `protobuf:"bytes,7,opt,name=job_id,json=jobId" json:"job_id,omitempty"`
+	Summary   string                     `protobuf:"bytes,8,opt,name=summary" json:"summary,omitempty"`
+	Error     string                     `protobuf:"bytes,9,opt,name=error" json:"error,omitempty"`
+	Severity  string                     `protobuf:"bytes,10,opt,name=severity" json:"severity,omitempty"`
+	// IDs increase from one event to the next
+	Id uint64 `protobuf:"varint,11,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *Event) Reset()                    { *m = Event{} }
+func (m *Event) String() string            { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()               {}
+func (*Event) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+
+func (m *Event) GetTime() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Time
+	}
+	return nil
+}
+
+func (m *Event) GetAction() string {
+	if m != nil {
+		return m.Action
+	}
+	return ""
+}
+
+func (m *Event) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
+func (m *Event) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *Event) GetWorkloads() []string {
+	if m != nil {
+		return m.Workloads
+	}
+	return nil
+}
+
+func (m *Event) GetRevision() string {
+	if m != nil {
+		return m.Revision
+	}
+	return ""
+}
+
+func (m *Event) GetJobId() string {
+	if m != nil {
+		return m.JobId
+	}
+	return ""
+}
+
+func (m *Event) GetSummary() string {
+	if m != nil {
+		return m.Summary
+	}
+	return ""
+}
+
+func (m *Event) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *Event) GetSeverity() string {
+	if m != nil {
+		return m.Severity
+	}
+	return ""
+}
+
+func (m *Event) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*ListWorkloadsRequest)(nil), "flux.v1.ListWorkloadsRequest")
+	proto.RegisterType((*ListWorkloadsResponse)(nil), "flux.v1.ListWorkloadsResponse")
+	proto.RegisterType((*Workload)(nil), "flux.v1.Workload")
+	proto.RegisterType((*Rollout)(nil), "flux.v1.Rollout")
+	proto.RegisterType((*Container)(nil), "flux.v1.Container")
+	proto.RegisterType((*Image)(nil), "flux.v1.Image")
+	proto.RegisterType((*ListImagesRequest)(nil), "flux.v1.ListImagesRequest")
+	proto.RegisterType((*ListImagesResponse)(nil), "flux.v1.ListImagesResponse")
+	proto.RegisterType((*WorkloadImages)(nil), "flux.v1.WorkloadImages")
+	proto.RegisterType((*Cause)(nil), "flux.v1.Cause")
+	proto.RegisterType((*UpdateManifestsRequest)(nil), "flux.v1.UpdateManifestsRequest")
+	proto.RegisterType((*ReleaseImages)(nil), "flux.v1.ReleaseImages")
+	proto.RegisterType((*UpdatePolicies)(nil), "flux.v1.UpdatePolicies")
+	proto.RegisterType((*PolicyUpdate)(nil), "flux.v1.PolicyUpdate")
+	proto.RegisterType((*SyncRequest)(nil), "flux.v1.SyncRequest")
+	proto.RegisterType((*JobResponse)(nil), "flux.v1.JobResponse")
+	proto.RegisterType((*JobStatusRequest)(nil), "flux.v1.JobStatusRequest")
+	proto.RegisterType((*JobStatusResponse)(nil), "flux.v1.JobStatusResponse")
+	proto.RegisterType((*WorkloadResult)(nil), "flux.v1.WorkloadResult")
+	proto.RegisterType((*ContainerUpdate)(nil), "flux.v1.ContainerUpdate")
+	proto.RegisterType((*SyncStatusRequest)(nil), "flux.v1.SyncStatusRequest")
+	proto.RegisterType((*SyncStatusResponse)(nil), "flux.v1.SyncStatusResponse")
+	proto.RegisterType((*WatchEventsRequest)(nil), "flux.v1.WatchEventsRequest")
+	proto.RegisterType((*Event)(nil), "flux.v1.Event")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Flux service
+
+type FluxClient interface {
+	// ListWorkloads gives the status of the workloads in the cluster,
+	// in all namespaces or the one given.
+	ListWorkloads(ctx context.Context, in *ListWorkloadsRequest, opts ...grpc.CallOption) (*ListWorkloadsResponse, error)
+	// ListImages gives the images available for each container of the
+	// workloads selected.
+	ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error)
+	// UpdateManifests starts a job to release images or change
+	// policies, and gives its ID.
+	UpdateManifests(ctx context.Context, in *UpdateManifestsRequest, opts ...grpc.CallOption) (*JobResponse, error)
+	// Sync starts a job to sync the cluster with git now, and gives
+	// its ID.
+	Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*JobResponse, error)
+	// JobStatus gives the progress, or the result, of a job.
+	JobStatus(ctx context.Context, in *JobStatusRequest, opts ...grpc.CallOption) (*JobStatusResponse, error)
+	// SyncStatus gives the commits up to the ref given that have not
+	// yet been applied to the cluster.
+	SyncStatus(ctx context.Context, in *SyncStatusRequest, opts ...grpc.CallOption) (*SyncStatusResponse, error)
+	// WatchEvents sends the records from the daemon's audit log as
+	// they are made, starting with those after the time given.
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Flux_WatchEventsClient, error)
+}
+
+type fluxClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewFluxClient(cc *grpc.ClientConn) FluxClient {
+	return &fluxClient{cc}
+}
+
+func (c *fluxClient) ListWorkloads(ctx context.Context, in *ListWorkloadsRequest, opts ...grpc.CallOption) (*ListWorkloadsResponse, error) {
+	out := new(ListWorkloadsResponse)
+	err := grpc.Invoke(ctx, "/flux.v1.Flux/ListWorkloads", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fluxClient) ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error) {
+	out := new(ListImagesResponse)
+	err := grpc.Invoke(ctx, "/flux.v1.Flux/ListImages", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fluxClient) UpdateManifests(ctx context.Context, in *UpdateManifestsRequest, opts ...grpc.CallOption) (*JobResponse, error) {
+	out := new(JobResponse)
+	err := grpc.Invoke(ctx, "/flux.v1.Flux/UpdateManifests", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fluxClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*JobResponse, error) {
+	out := new(JobResponse)
+	err := grpc.Invoke(ctx, "/flux.v1.Flux/Sync", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fluxClient) JobStatus(ctx context.Context, in *JobStatusRequest, opts ...grpc.CallOption) (*JobStatusResponse, error) {
+	out := new(JobStatusResponse)
+	err := grpc.Invoke(ctx, "/flux.v1.Flux/JobStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fluxClient) SyncStatus(ctx context.Context, in *SyncStatusRequest, opts ...grpc.CallOption) (*SyncStatusResponse, error) {
+	out := new(SyncStatusResponse)
+	err := grpc.Invoke(ctx, "/flux.v1.Flux/SyncStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fluxClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Flux_WatchEventsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Flux_serviceDesc.Streams[0], c.cc, "/flux.v1.Flux/WatchEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fluxWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Flux_WatchEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type fluxWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *fluxWatchEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Flux service
+
+type FluxServer interface {
+	// ListWorkloads gives the status of the workloads in the cluster,
+	// in all namespaces or the one given.
+	ListWorkloads(context.Context, *ListWorkloadsRequest) (*ListWorkloadsResponse, error)
+	// ListImages gives the images available for each container of the
+	// workloads selected.
+	ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error)
+	// UpdateManifests starts a job to release images or change
+	// policies, and gives its ID.
+	UpdateManifests(context.Context, *UpdateManifestsRequest) (*JobResponse, error)
+	// Sync starts a job to sync the cluster with git now, and gives
+	// its ID.
+	Sync(context.Context, *SyncRequest) (*JobResponse, error)
+	// JobStatus gives the progress, or the result, of a job.
+	JobStatus(context.Context, *JobStatusRequest) (*JobStatusResponse, error)
+	// SyncStatus gives the commits up to the ref given that have not
+	// yet been applied to the cluster.
+	SyncStatus(context.Context, *SyncStatusRequest) (*SyncStatusResponse, error)
+	// WatchEvents sends the records from the daemon's audit log as
+	// they are made, starting with those after the time given.
+	WatchEvents(*WatchEventsRequest, Flux_WatchEventsServer) error
+}
+
+func RegisterFluxServer(s *grpc.Server, srv FluxServer) {
+	s.RegisterService(&_Flux_serviceDesc, srv)
+}
+
+func _Flux_ListWorkloads_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWorkloadsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FluxServer).ListWorkloads(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flux.v1.Flux/ListWorkloads",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FluxServer).ListWorkloads(ctx, req.(*ListWorkloadsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Flux_ListImages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListImagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FluxServer).ListImages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flux.v1.Flux/ListImages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FluxServer).ListImages(ctx, req.(*ListImagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Flux_UpdateManifests_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateManifestsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FluxServer).UpdateManifests(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flux.v1.Flux/UpdateManifests",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FluxServer).UpdateManifests(ctx, req.(*UpdateManifestsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Flux_Sync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FluxServer).Sync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flux.v1.Flux/Sync",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FluxServer).Sync(ctx, req.(*SyncRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Flux_JobStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FluxServer).JobStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flux.v1.Flux/JobStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FluxServer).JobStatus(ctx, req.(*JobStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Flux_SyncStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FluxServer).SyncStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flux.v1.Flux/SyncStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FluxServer).SyncStatus(ctx, req.(*SyncStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Flux_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FluxServer).WatchEvents(m, &fluxWatchEventsServer{stream})
+}
+
+type Flux_WatchEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type fluxWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *fluxWatchEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Flux_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "flux.v1.Flux",
+	HandlerType: (*FluxServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListWorkloads",
+			Handler:    _Flux_ListWorkloads_Handler,
+		},
+		{
+			MethodName: "ListImages",
+			Handler:    _Flux_ListImages_Handler,
+		},
+		{
+			MethodName: "UpdateManifests",
+			Handler:    _Flux_UpdateManifests_Handler,
+		},
+		{
+			MethodName: "Sync",
+			Handler:    _Flux_Sync_Handler,
+		},
+		{
+			MethodName: "JobStatus",
+			Handler:    _Flux_JobStatus_Handler,
+		},
+		{
+			MethodName: "SyncStatus",
+			Handler:    _Flux_SyncStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Flux_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "flux.proto",
+}
+
+func init() { proto.RegisterFile("flux.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 1500 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x57, 0x5b, 0x73, 0xd3, 0xc6,
+	0x17, 0x47, 0xb6, 0x65, 0x5b, 0xc7, 0xe0, 0x24, 0xfb, 0x4f, 0x82, 0x10, 0xfc, 0x21, 0x68, 0x68,
+	0x1b, 0xda, 0x8e, 0x01, 0x43, 0x5a, 0x52, 0xfa, 0x02, 0x34, 0x99, 0x84, 0xd2, 0xcb, 0x28, 0x74,
+	0x98, 0xe1, 0xc5, 0x23, 0x4b, 0xeb, 0x54, 0x20, 0x4b, 0xee, 0xee, 0x2a, 0xc1, 0x1f, 0xa0, 0x33,
+	0x7d, 0xea, 0xf4, 0x13, 0xf4, 0xbd, 0xed, 0x53, 0xbf, 0x13, 0x2f, 0x7d, 0xe9, 0x67, 0xe8, 0xec,
+	0x4d, 0x17, 0x5b, 0x61, 0xca, 0x4c, 0xdf, 0x74, 0xae, 0x7b, 0xf6, 0x5c, 0x7e, 0x67, 0x05, 0x30,
+	0x89, 0xb3, 0xd7, 0x83, 0x19, 0x49, 0x59, 0x8a, 0x3a, 0xe2, 0xfb, 0xe4, 0x8e, 0x73, 0xed, 0x38,
+	0x4d, 0x8f, 0x63, 0x7c, 0x4b, 0xb0, 0xc7, 0xd9, 0xe4, 0x16, 0x8b, 0xa6, 0x98, 0x32, 0x7f, 0x3a,
+	0x93, 0x9a, 0xee, 0x3d, 0x58, 0x7f, 0x1a, 0x51, 0xf6, 0x3c, 0x25, 0xaf, 0xe2, 0xd4, 0x0f, 0xa9,
+	0x87, 0x7f, 0xc8, 0x30, 0x65, 0xe8, 0x0a, 0x58, 0x89, 0x3f, 0xc5, 0x74, 0xe6, 0x07, 0xd8, 0x36,
+	0xb6, 0x8c, 0x6d, 0xcb, 0x2b, 0x18, 0xee, 0x01, 0x6c, 0x2c, 0x58, 0xd1, 0x59, 0x9a, 0x50, 0x8c,
+	0x6e, 0x81, 0x75, 0xaa, 0x99, 0xb6, 0xb1, 0xd5, 0xdc, 0xee, 0x0d, 0xd7, 0x06, 0x2a, 0x98, 0x81,
+	0x56, 0xf7, 0x0a, 0x1d, 0xf7, 0xaf, 0x26, 0x74, 0x35, 0x1f, 0xf5, 0xa1, 0x11, 0x85, 0xea, 0xb4,
+	0x46, 0x14, 0xa2, 0x21, 0x40, 0x90, 0x26, 0xcc, 0x8f, 0x12, 0x4c, 0xa8, 0xdd, 0x10, 0xee, 0x50,
+	0xee, 0xee, 0xb1, 0x16, 0x79, 0x25, 0x2d, 0x74, 0x19, 0x2c, 0x82, 0xfd, 0x70, 0x94, 0x26, 0xf1,
+	0xdc, 0x6e, 0x0a, 0x57, 0x5d, 0xce, 0xf8, 0x26, 0x89, 0xe7, 0x68, 0x13, 0xda, 0x94, 0xf9, 0x2c,
+	0xa3, 0x76, 0x4b, 0x48, 0x14, 0x85, 0x3e, 0x84, 0x0e, 0x49, 0xe3, 0x38, 0xcd, 0x98, 0x6d, 0x6e,
+	0x19, 0xdb, 0xbd, 0xe1, 0x6a, 0x7e, 0x8a, 0x27, 0xf9, 0x9e, 0x56, 0x40, 0x3b, 0xd0, 0x8e, 0xfd,
+	0x31, 0x8e, 0xa9, 0xdd, 0x16, 0x01, 0xfd, 0x7f, 0xe9, 0x7e, 0x83, 0xa7, 0x42, 0xbe, 0x97, 0x30,
+	0x32, 0xf7, 0x94, 0x32, 0x7a, 0x00, 0xdd, 0x59, 0x1a, 0x47, 0x41, 0x84, 0xa9, 0xdd, 0x11, 0x86,
+	0xd7, 0x96, 0x0d, 0xbf, 0x55, 0x1a, 0xd2, 0x34, 0x37, 0xe0, 0xd5, 0xf0, 0x33, 0x96, 0x4e, 0x7d,
+	0x86, 0x43, 0xbb, 0xbb, 0x65, 0x6c, 0x77, 0xbd, 0x82, 0xc1, 0x6f, 0x15, 0xa7, 0xc1, 0x2b, 0x1c,
+	0xda, 0x96, 0x10, 0x29, 0x8a, 0xf3, 0xa3, 0xe3, 0x24, 0x25, 0xd8, 0x06, 0xc9, 0x97, 0x94, 0xb3,
+	0x0b, 0xbd, 0x52, 0x84, 0x68, 0x15, 0x9a, 0xaf, 0xf0, 0x5c, 0xa5, 0x9d, 0x7f, 0xa2, 0x75, 0x30,
+	0x4f, 0xfc, 0x38, 0xc3, 0x76, 0x43, 0xf0, 0x24, 0xf1, 0x59, 0xe3, 0xbe, 0xe1, 0x3c, 0x80, 0x0b,
+	0x95, 0x18, 0xdf, 0xc5, 0xd8, 0xfd, 0xcd, 0x80, 0x8e, 0x4a, 0x27, 0xb2, 0xa1, 0x13, 0x62, 0x1a,
+	0x11, 0x2c, 0xeb, 0x6d, 0x7a, 0x9a, 0xe4, 0x92, 0x6c, 0x16, 0x8a, 0x9b, 0x36, 0xa4, 0x44, 0x91,
+	0xdc, 0x33, 0xaf, 0xa4, 0x2c, 0xab, 0xe9, 0x49, 0x42, 0xe4, 0xe6, 0xc4, 0x8f, 0x62, 0x7f, 0x1c,
+	0x63, 0x51, 0x56, 0xd3, 0x2b, 0x18, 0xc8, 0x81, 0x6e, 0x9a, 0x31, 0xe9, 0xce, 0x14, 0xc2, 0x9c,
+	0xe6, 0xb2, 0x29, 0xa6, 0xd4, 0x3f, 0xc6, 0xb2, 0x96, 0x96, 0x97, 0xd3, 0xee, 0x9b, 0x26, 0x58,
+	0x79, 0x83, 0x21, 0x04, 0x2d, 0xde, 0xfc, 0xea, 0x9a, 0xe2, 0x1b, 0x6d, 0x43, 0x27, 0xc8, 0x08,
+	0xc1, 0x09, 0x13, 0x71, 0xf6, 0x86, 0xfd, 0xbc, 0x9e, 0x87, 0x53, 0xff, 0x18, 0x7b, 0x5a, 0x8c,
+	0x3e, 0x85, 0x95, 0xd8, 0x67, 0x98, 0xb2, 0xd1, 0x24, 0x8a, 0x19, 0xe6, 0x77, 0x6e, 0xd6, 0x5a,
+	0xf4, 0xa5, 0xda, 0xbe, 0xd2, 0x42, 0x1f, 0x57, 0xaf, 0xd6, 0xac, 0x31, 0x29, 0x5d, 0xf5, 0x03,
+	0x58, 0xc9, 0x89, 0x11, 0x26, 0x24, 0x25, 0xe2, 0xc6, 0x96, 0xd7, 0xcf, 0xd9, 0x7b, 0x9c, 0x5b,
+	0x55, 0xa4, 0xcc, 0x8f, 0xb1, 0xdd, 0x16, 0x0d, 0x52, 0x28, 0x1e, 0x71, 0x2e, 0xba, 0x07, 0x9b,
+	0x85, 0x62, 0xc4, 0xcf, 0xa3, 0xa3, 0x20, 0xcd, 0x12, 0x66, 0x77, 0x44, 0x2a, 0xd7, 0x73, 0xa9,
+	0x08, 0x86, 0x3e, 0xe6, 0x32, 0xf4, 0x00, 0x9c, 0x04, 0x9f, 0x8e, 0xce, 0xb0, 0xec, 0x0a, 0xcb,
+	0x8b, 0x09, 0x3e, 0x7d, 0x58, 0x67, 0x3c, 0x84, 0x0d, 0x9d, 0xa4, 0xaa, 0x9d, 0x25, 0xec, 0xfe,
+	0xa7, 0x85, 0x65, 0x9b, 0x5d, 0xb8, 0xc4, 0x0f, 0xac, 0xb7, 0x03, 0x61, 0xb7, 0x99, 0xe0, 0xd3,
+	0xfd, 0x65, 0x53, 0xf7, 0x47, 0x03, 0x4c, 0x41, 0x2f, 0x61, 0xcf, 0x26, 0xb4, 0xc3, 0xe8, 0x18,
+	0x53, 0xa6, 0xfa, 0x58, 0x51, 0xe8, 0x12, 0x74, 0x85, 0xff, 0x51, 0x14, 0x2a, 0x78, 0xe9, 0x08,
+	0xfa, 0x30, 0x44, 0xbb, 0x00, 0x01, 0xc1, 0xbc, 0xb5, 0x46, 0x3e, 0x13, 0xad, 0xd8, 0x1b, 0x3a,
+	0x03, 0x89, 0xc0, 0x03, 0x8d, 0xc0, 0x83, 0x67, 0x1a, 0x81, 0x3d, 0x4b, 0x69, 0x3f, 0x64, 0xee,
+	0x0b, 0x58, 0xe3, 0x80, 0x2a, 0x43, 0xd3, 0x18, 0xec, 0x40, 0x57, 0x03, 0xa5, 0x0a, 0x2c, 0xa7,
+	0xd1, 0x4d, 0x58, 0xcd, 0x41, 0x6f, 0x34, 0x89, 0x70, 0x1c, 0x4a, 0x80, 0xb4, 0xbc, 0x95, 0x9c,
+	0xbf, 0x2f, 0xd8, 0xee, 0x97, 0x80, 0xca, 0xbe, 0x15, 0x52, 0xef, 0x2c, 0x23, 0xf5, 0xc5, 0x25,
+	0x40, 0x52, 0x36, 0x25, 0xbc, 0x7e, 0x06, 0xfd, 0xaa, 0xf0, 0xbf, 0x00, 0x6d, 0x77, 0x07, 0xcc,
+	0xc7, 0x7e, 0x46, 0x31, 0x1f, 0xb4, 0x8c, 0x62, 0xa2, 0x07, 0x8d, 0x7f, 0x73, 0x40, 0x50, 0x63,
+	0xa9, 0x4a, 0xa1, 0x49, 0xf7, 0x4f, 0x03, 0x36, 0xbf, 0x13, 0xe0, 0xf0, 0x95, 0x9f, 0x44, 0x13,
+	0x4c, 0x59, 0x9e, 0xbb, 0x21, 0x74, 0x08, 0x8e, 0xb1, 0x4f, 0xe5, 0xd0, 0xf6, 0x86, 0x9b, 0x05,
+	0xa2, 0x4b, 0xbe, 0x0c, 0xff, 0xe0, 0x9c, 0xa7, 0x15, 0xd1, 0x4e, 0x09, 0xa2, 0xe5, 0x48, 0x17,
+	0x19, 0x91, 0xc7, 0x68, 0xec, 0x3b, 0x38, 0x57, 0x02, 0xe7, 0x1b, 0x60, 0x06, 0x3c, 0xf8, 0xa5,
+	0xa1, 0x16, 0x57, 0xf2, 0xa4, 0xf0, 0x51, 0x1b, 0x5a, 0x74, 0x86, 0x03, 0xf7, 0x67, 0x03, 0x2e,
+	0x54, 0x22, 0xe0, 0x00, 0x56, 0xad, 0x84, 0x55, 0x4a, 0x38, 0x07, 0x3d, 0xd1, 0x5f, 0x1a, 0x4e,
+	0x05, 0xc1, 0x5b, 0x03, 0xbf, 0x0e, 0xe2, 0x2c, 0xc4, 0xd4, 0x6e, 0x4a, 0xe8, 0xd2, 0x34, 0xba,
+	0x08, 0x9d, 0x90, 0xcc, 0x47, 0x24, 0x4b, 0x44, 0x0f, 0x76, 0xbd, 0x76, 0x48, 0xe6, 0x5e, 0x96,
+	0x70, 0x57, 0x93, 0x94, 0x04, 0x58, 0xc0, 0x42, 0xd7, 0x93, 0x84, 0xfb, 0x87, 0x01, 0xfd, 0xea,
+	0xed, 0xd0, 0x17, 0xcb, 0xbd, 0xf1, 0xfe, 0x19, 0x99, 0xc8, 0x5b, 0x45, 0xed, 0xac, 0xc2, 0xd0,
+	0x39, 0x82, 0x7e, 0x55, 0x58, 0xb3, 0x2c, 0x3e, 0x2a, 0x2f, 0x8b, 0xde, 0x70, 0x23, 0x3f, 0x45,
+	0xf8, 0x9f, 0xcb, 0xb3, 0xca, 0x3b, 0xe4, 0x6f, 0x03, 0xce, 0x97, 0x65, 0xe8, 0x36, 0x34, 0xfd,
+	0x30, 0x54, 0x51, 0x5e, 0xad, 0xb5, 0x1f, 0x3c, 0x0c, 0x43, 0x19, 0x1d, 0x57, 0x45, 0xbb, 0xd0,
+	0x26, 0x78, 0x9a, 0x9e, 0x60, 0xd5, 0x9c, 0xd7, 0xeb, 0x8d, 0x3c, 0xa1, 0xa3, 0x96, 0xb8, 0x34,
+	0x70, 0x3e, 0x81, 0xae, 0xf6, 0xf5, 0x4e, 0x6b, 0x73, 0x17, 0x7a, 0x25, 0x77, 0xef, 0xb4, 0x34,
+	0xef, 0x42, 0xef, 0x68, 0x9e, 0x04, 0xba, 0xaf, 0xf3, 0x66, 0x33, 0xde, 0xd2, 0x6c, 0xee, 0x0d,
+	0xe8, 0x3d, 0x49, 0xc7, 0xf9, 0xac, 0x6f, 0x40, 0xfb, 0x65, 0x3a, 0x1e, 0xe5, 0x63, 0x6a, 0xbe,
+	0x4c, 0xc7, 0x87, 0xa1, 0x7b, 0x13, 0x56, 0x9f, 0xa4, 0xe3, 0x23, 0xf1, 0x04, 0xd2, 0xfe, 0xcf,
+	0x50, 0xfd, 0xc5, 0x80, 0xb5, 0x92, 0xae, 0xf2, 0x5b, 0x3c, 0xa7, 0x8c, 0xca, 0x73, 0x6a, 0x1d,
+	0x4c, 0xb9, 0x7f, 0xd4, 0x6d, 0x04, 0xc1, 0x7b, 0x96, 0xe0, 0x93, 0x88, 0x46, 0x69, 0x52, 0x3c,
+	0xcc, 0x24, 0x8d, 0xee, 0xf0, 0x71, 0xa5, 0x59, 0xcc, 0xa8, 0xda, 0x73, 0xcb, 0x58, 0xe4, 0x09,
+	0xb9, 0xa7, 0xf5, 0xdc, 0x9f, 0x0c, 0xe8, 0x57, 0x65, 0x75, 0x18, 0xae, 0xe2, 0x6b, 0xd4, 0xc7,
+	0xd7, 0x2c, 0xc7, 0x77, 0xbf, 0x02, 0x5c, 0x32, 0x0c, 0x7b, 0x19, 0xb8, 0x54, 0x4f, 0x96, 0xe1,
+	0xeb, 0x39, 0xac, 0x2c, 0x88, 0x6b, 0x5f, 0x0c, 0x76, 0xf5, 0xc5, 0x60, 0x15, 0x2f, 0x84, 0x4d,
+	0x68, 0x33, 0x9f, 0x1c, 0x63, 0xa6, 0x22, 0x52, 0x94, 0xfb, 0x1e, 0xac, 0xf1, 0xe2, 0x57, 0x4b,
+	0xb4, 0x0a, 0x4d, 0x82, 0x27, 0xba, 0x7b, 0x08, 0x9e, 0xb8, 0x43, 0x40, 0x65, 0x35, 0x55, 0x9d,
+	0x2b, 0x60, 0xe9, 0xfc, 0xe6, 0xb8, 0x92, 0x33, 0xdc, 0x5f, 0x0d, 0x40, 0xcf, 0x7d, 0x16, 0x7c,
+	0xbf, 0x77, 0x82, 0x93, 0x02, 0x37, 0x6f, 0x83, 0x49, 0xa3, 0x24, 0xd0, 0xfd, 0xf5, 0xb6, 0xf5,
+	0x25, 0x15, 0xd1, 0x75, 0x38, 0x3f, 0x8d, 0x92, 0x11, 0xc5, 0x27, 0x98, 0x44, 0x6c, 0xae, 0xae,
+	0xd6, 0x9b, 0x46, 0xc9, 0x91, 0x62, 0xf1, 0x8b, 0xfb, 0x01, 0x13, 0x71, 0x48, 0xb0, 0xd2, 0x24,
+	0xdf, 0xa6, 0xfe, 0x84, 0x61, 0xc2, 0x1b, 0x8e, 0x83, 0x55, 0xcb, 0xeb, 0x08, 0xfa, 0x30, 0x74,
+	0x7f, 0x6f, 0x80, 0x29, 0x62, 0x43, 0x03, 0x68, 0xf1, 0xdf, 0x96, 0x7f, 0x11, 0x92, 0xd0, 0xe3,
+	0xd9, 0x94, 0xfe, 0x75, 0xd9, 0x25, 0x95, 0x2f, 0x97, 0x66, 0xfd, 0x72, 0x69, 0x55, 0x96, 0x4b,
+	0x15, 0x96, 0xcd, 0x45, 0x58, 0x2e, 0x37, 0x73, 0x7b, 0xa1, 0x99, 0x8b, 0x19, 0xea, 0x94, 0x66,
+	0x88, 0x1f, 0x45, 0xb3, 0xe9, 0xd4, 0x27, 0x73, 0xf1, 0x08, 0xb2, 0x3c, 0x4d, 0x16, 0xfd, 0x68,
+	0x2d, 0xcc, 0x4b, 0x9e, 0x54, 0x90, 0x47, 0x68, 0x5a, 0x75, 0x7a, 0x4f, 0x64, 0xac, 0x11, 0x85,
+	0xc3, 0x37, 0x4d, 0x68, 0xed, 0xc7, 0xd9, 0x6b, 0xf4, 0x35, 0x5c, 0xa8, 0xfc, 0x99, 0xa1, 0xe2,
+	0xf7, 0xa4, 0xee, 0x3f, 0xcf, 0xb9, 0x7a, 0x96, 0x58, 0x35, 0xd1, 0x1e, 0x40, 0xf1, 0x78, 0x40,
+	0x4e, 0x45, 0xbb, 0xf2, 0x5a, 0x71, 0x2e, 0xd7, 0xca, 0x94, 0x9b, 0x03, 0x58, 0x59, 0x58, 0xd4,
+	0xe8, 0xda, 0xc2, 0x46, 0x59, 0x5c, 0xe1, 0xce, 0x7a, 0xae, 0x50, 0xc6, 0xb2, 0x21, 0xb4, 0x78,
+	0xaf, 0xa3, 0x42, 0x5a, 0x82, 0xc7, 0x33, 0x6c, 0x1e, 0x81, 0x95, 0x83, 0x17, 0xba, 0x54, 0x56,
+	0xa9, 0x4c, 0x96, 0xe3, 0xd4, 0x89, 0x8a, 0x44, 0x14, 0x33, 0x56, 0x4a, 0xc4, 0xd2, 0x7c, 0x3a,
+	0x97, 0x6b, 0x65, 0xca, 0xcd, 0xe7, 0xd0, 0x2b, 0x4d, 0x1d, 0x2a, 0x74, 0x97, 0x67, 0xd1, 0x29,
+	0xc0, 0x5d, 0xf0, 0x6f, 0x1b, 0x8f, 0xba, 0x2f, 0xda, 0x9c, 0x35, 0x1b, 0x8f, 0xdb, 0xa2, 0xfb,
+	0xef, 0xfe, 0x33, 0x00, 0xde, 0x50, 0x76, 0x18, 0xf6, 0x0f, 0x00, 0x00,
+}
@@ -1,13 +1,17 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
@@ -15,6 +19,7 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/audit"
 	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/event"
 	transport "github.com/weaveworks/flux/http"
@@ -39,6 +44,9 @@ type Client struct {
 	token    Token
 	router   *mux.Router
 	endpoint string
+
+	versionsMu sync.Mutex
+	versions   *transport.APIVersions // once fetched
 }
 
 var _ api.Server = &Client{}
@@ -52,12 +60,77 @@ func New(c *http.Client, router *mux.Router, endpoint string, t Token) *Client {
 	}
 }
 
+// APIVersions fetches what the server says about the API it serves;
+// or, if it doesn't say (i.e., it's from before servers did), gives
+// transport.LegacyAPI. It's fetched once, and remembered.
+func (c *Client) APIVersions(ctx context.Context) (transport.APIVersions, error) {
+	c.versionsMu.Lock()
+	defer c.versionsMu.Unlock()
+	if c.versions != nil {
+		return *c.versions, nil
+	}
+
+	u, err := transport.MakeURL(c.endpoint, c.router, transport.Versions)
+	if err != nil {
+		return transport.APIVersions{}, errors.Wrap(err, "constructing URL")
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return transport.APIVersions{}, errors.Wrapf(err, "constructing request %s", u)
+	}
+	req = req.WithContext(ctx)
+	c.token.Set(req)
+	req.Header.Set("Accept", "application/json")
+
+	var versions transport.APIVersions
+	resp, err := c.executeRequest(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusNotFound:
+		versions = transport.LegacyAPI
+	case err != nil:
+		return transport.APIVersions{}, err
+	default:
+		if err := json.NewDecoder(resp.Body).Decode(&versions); err != nil {
+			return transport.APIVersions{}, errors.Wrap(err, "decoding response from server")
+		}
+	}
+	c.versions = &versions
+	return versions, nil
+}
+
+// Supports reports whether the server serves the endpoint named (as
+// in the transport package), so that callers can fall back to
+// something the server does serve, or say it needs upgrading.
+func (c *Client) Supports(ctx context.Context, endpoint string) (bool, error) {
+	versions, err := c.APIVersions(ctx)
+	if err != nil {
+		return false, err
+	}
+	return versions.Supports(endpoint), nil
+}
+
 func (c *Client) ListServices(ctx context.Context, namespace string) ([]v6.ControllerStatus, error) {
 	var res []v6.ControllerStatus
 	err := c.Get(ctx, &res, transport.ListServices, "namespace", namespace)
 	return res, err
 }
 
+// ListServicesWithOptions fetches the workloads matching the options
+// given. Like DaemonStatus, it's not part of api.Server.
+func (c *Client) ListServicesWithOptions(ctx context.Context, opts v10.ListServicesOptions) ([]v6.ControllerStatus, error) {
+	var res []v6.ControllerStatus
+	err := c.Get(ctx, &res, transport.ListServicesWithOptions,
+		"namespace", opts.Namespace,
+		"selector", opts.Selector,
+		"automated", strconv.FormatBool(opts.Automated),
+		"locked", strconv.FormatBool(opts.Locked),
+		"outOfDate", strconv.FormatBool(opts.OutOfDate))
+	return res, err
+}
+
 func (c *Client) ListImages(ctx context.Context, s update.ResourceSpec) ([]v6.ImageStatus, error) {
 	var res []v6.ImageStatus
 	err := c.Get(ctx, &res, transport.ListImages, "service", string(s))
@@ -82,6 +155,141 @@ func (c *Client) SyncStatus(ctx context.Context, ref string) ([]string, error) {
 	return res, err
 }
 
+// DaemonStatus fetches the status of the daemon. It's not part of
+// the api.Server interface, since only a daemon can report it.
+func (c *Client) DaemonStatus(ctx context.Context) (v10.Status, error) {
+	var res v10.Status
+	err := c.Get(ctx, &res, transport.DaemonStatus)
+	return res, err
+}
+
+// Graph fetches the relationships between the workloads in the
+// cluster (or in the namespace given), the files in git they are
+// defined in, their antecedents, and their images. Like DaemonStatus,
+// it's not part of api.Server.
+func (c *Client) Graph(ctx context.Context, namespace string) (v10.Graph, error) {
+	var res v10.Graph
+	err := c.Get(ctx, &res, transport.Graph, "namespace", namespace)
+	return res, err
+}
+
+// Diff fetches the changes syncing the manifests at the head of the
+// branch would make to the resources in the cluster (or in the
+// namespace given). Like DaemonStatus, it's not part of api.Server.
+func (c *Client) Diff(ctx context.Context, namespace string) (v10.Diff, error) {
+	var res v10.Diff
+	err := c.Get(ctx, &res, transport.Diff, "namespace", namespace)
+	return res, err
+}
+
+// PendingReleases fetches the automated releases waiting for
+// approval. Like DaemonStatus, it's not part of api.Server.
+func (c *Client) PendingReleases(ctx context.Context) ([]v10.PendingRelease, error) {
+	var res []v10.PendingRelease
+	err := c.Get(ctx, &res, transport.PendingReleases)
+	return res, err
+}
+
+// ApproveRelease asks for the pending release with the ID given to be
+// committed, and returns the ID of the job doing so.
+func (c *Client) ApproveRelease(ctx context.Context, id string, cause update.Cause) (job.ID, error) {
+	var res job.ID
+	err := c.methodWithResp(ctx, "POST", &res, transport.ApproveRelease, cause, "id", id)
+	return res, err
+}
+
+// AuditEvents fetches the records in the daemon's audit log that
+// match the query. Like DaemonStatus, it's not part of api.Server.
+func (c *Client) AuditEvents(ctx context.Context, q audit.Query) ([]audit.Record, error) {
+	params := auditQueryParams(q)
+	if q.Limit > 0 {
+		params = append(params, "limit", strconv.Itoa(q.Limit))
+	}
+	var res []audit.Record
+	err := c.Get(ctx, &res, transport.AuditEvents, params...)
+	return res, err
+}
+
+// WatchAuditEvents calls the func given with each record in the
+// daemon's audit log that matches the query, as the records are
+// made, until the context is cancelled, the func returns an error, or
+// the stream is closed (which is reported as an error). To resume
+// after an error, call it again with the ID of the last record seen
+// as the query's AfterID.
+func (c *Client) WatchAuditEvents(ctx context.Context, q audit.Query, fn func(audit.Record) error) error {
+	u, err := transport.MakeURL(c.endpoint, c.router, transport.AuditEventsStream, auditQueryParams(q)...)
+	if err != nil {
+		return errors.Wrap(err, "constructing URL")
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "constructing request %s", u)
+	}
+	req = req.WithContext(ctx)
+	c.token.Set(req)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.executeRequest(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Each event is some `field: value` lines, ending with a blank
+	// line. The record is in the `data` field; the other fields,
+	// and comments (lines starting with a colon), can be ignored.
+	scanner := bufio.NewScanner(resp.Body)
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0 && len(data) > 0:
+			var r audit.Record
+			if err := json.Unmarshal(data, &r); err != nil {
+				return errors.Wrap(err, "decoding event from server")
+			}
+			if err := fn(r); err != nil {
+				return err
+			}
+			data = nil
+		case bytes.HasPrefix(line, []byte("data:")):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			value := bytes.TrimPrefix(line[len("data:"):], []byte(" "))
+			data = append(data, value...)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "reading events from server")
+	}
+	return errors.New("the server closed the stream of events")
+}
+
+func auditQueryParams(q audit.Query) []string {
+	var params []string
+	if !q.Since.IsZero() {
+		params = append(params, "since", q.Since.UTC().Format(time.RFC3339))
+	}
+	if q.AfterID > 0 {
+		params = append(params, "after", strconv.FormatUint(q.AfterID, 10))
+	}
+	if q.MinSeverity != "" {
+		params = append(params, "severity", string(q.MinSeverity))
+	}
+	if len(q.Actions) > 0 {
+		var actions []string
+		for _, a := range q.Actions {
+			actions = append(actions, string(a))
+		}
+		params = append(params, "actions", strings.Join(actions, ","))
+	}
+	return params
+}
+
 func (c *Client) UpdateManifests(ctx context.Context, spec update.Spec) (job.ID, error) {
 	var res job.ID
 	err := c.methodWithResp(ctx, "POST", &res, transport.UpdateManifests, spec)
@@ -0,0 +1,171 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weaveworks/flux/audit"
+	transport "github.com/weaveworks/flux/http"
+)
+
+// AuditReader is the part of the daemon that can answer queries
+// about its audit log.
+type AuditReader interface {
+	AuditRecords(context.Context, audit.Query) []audit.Record
+}
+
+var (
+	// How often a stream of events looks for new records
+	auditStreamPollInterval = time.Second
+	// How often a stream of events sends something, even if there
+	// are no new records, so that proxies don't close it as idle
+	auditStreamKeepaliveInterval = 15 * time.Second
+)
+
+var errAuditNotAvailable = errors.New("the audit log is not available from this server")
+
+// auditQuery makes a query from the parameters of a request for
+// events: `since` (an RFC3339 timestamp), `after` (the ID of an
+// event), `severity`, `actions` (comma-separated), and `limit`.
+func auditQuery(r *http.Request) (audit.Query, error) {
+	var q audit.Query
+	values := r.URL.Query()
+	if s := values.Get("since"); s != "" {
+		var err error
+		if q.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("invalid since %q: %s", s, err)
+		}
+	}
+	if a := values.Get("after"); a != "" {
+		var err error
+		if q.AfterID, err = strconv.ParseUint(a, 10, 64); err != nil {
+			return q, fmt.Errorf("invalid after %q; expected the ID of an event", a)
+		}
+	}
+	if l := values.Get("limit"); l != "" {
+		var err error
+		if q.Limit, err = strconv.Atoi(l); err != nil || q.Limit < 0 {
+			return q, fmt.Errorf("invalid limit %q", l)
+		}
+	}
+	if sev := values.Get("severity"); sev != "" {
+		var err error
+		if q.MinSeverity, err = audit.ParseSeverity(sev); err != nil {
+			return q, err
+		}
+	}
+	if actions := values.Get("actions"); actions != "" {
+		for _, a := range strings.Split(actions, ",") {
+			action, err := audit.ParseAction(a)
+			if err != nil {
+				return q, err
+			}
+			q.Actions = append(q.Actions, action)
+		}
+	}
+	return q, nil
+}
+
+// AuditEvents responds with the records in the daemon's audit log,
+// optionally only those after `since` (an RFC3339 timestamp) or the
+// event with ID `after`, at least as severe as `severity`, and of the
+// comma-separated `actions`; and at most `limit` of them.
+func (s HTTPServer) AuditEvents(w http.ResponseWriter, r *http.Request) {
+	reader, ok := s.server.(AuditReader)
+	if !ok {
+		transport.WriteError(w, r, http.StatusNotImplemented, errAuditNotAvailable)
+		return
+	}
+	q, err := auditQuery(r)
+	if err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	records := reader.AuditRecords(r.Context(), q)
+	if records == nil {
+		records = []audit.Record{}
+	}
+	transport.JSONResponse(w, r, records)
+}
+
+// AuditEventsStream sends the records in the daemon's audit log as
+// they are made, as server-sent events (`text/event-stream`), until
+// the client goes away. It takes the same parameters as AuditEvents,
+// except `limit`; and, as is usual for server-sent events, a client
+// reconnecting can give the ID of the last event it saw in the
+// `Last-Event-ID` header instead of `after`. If neither `since` nor
+// an ID is given, only records made from now on are sent.
+func (s HTTPServer) AuditEventsStream(w http.ResponseWriter, r *http.Request) {
+	reader, ok := s.server.(AuditReader)
+	if !ok {
+		transport.WriteError(w, r, http.StatusNotImplemented, errAuditNotAvailable)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		transport.WriteError(w, r, http.StatusInternalServerError, errors.New("streaming is not supported by this server"))
+		return
+	}
+	q, err := auditQuery(r)
+	if err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	q.Limit = 0
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		if q.AfterID, err = strconv.ParseUint(last, 10, 64); err != nil {
+			transport.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid Last-Event-ID %q; expected the ID of an event", last))
+			return
+		}
+	}
+	if q.Since.IsZero() && q.AfterID == 0 {
+		q.Since = time.Now()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	poll := time.NewTicker(auditStreamPollInterval)
+	defer poll.Stop()
+	lastSent := time.Now()
+	for {
+		records := reader.AuditRecords(r.Context(), q)
+		for _, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", record.ID, data); err != nil {
+				return
+			}
+			q.AfterID = record.ID
+		}
+		switch {
+		case len(records) > 0:
+			lastSent = time.Now()
+		case time.Since(lastSent) >= auditStreamKeepaliveInterval:
+			// A line starting with a colon is a comment, which
+			// clients ignore
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			lastSent = time.Now()
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-poll.C:
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/api"
+	"github.com/weaveworks/flux/audit"
+	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/http/client"
+	"github.com/weaveworks/flux/remote"
+)
+
+type auditServer struct {
+	api.Server
+	log *audit.Log
+}
+
+func (s auditServer) AuditRecords(_ context.Context, q audit.Query) []audit.Record {
+	return s.log.Records(q)
+}
+
+func withFastAuditStream() func() {
+	poll, keepalive := auditStreamPollInterval, auditStreamKeepaliveInterval
+	auditStreamPollInterval, auditStreamKeepaliveInterval = 10*time.Millisecond, 50*time.Millisecond
+	return func() {
+		auditStreamPollInterval, auditStreamKeepaliveInterval = poll, keepalive
+	}
+}
+
+func TestAuditEventsStream(t *testing.T) {
+	defer withFastAuditStream()()
+
+	log := audit.New(0)
+	start := time.Now()
+	log.Record(audit.Record{Time: start.Add(-time.Minute), Action: audit.Sync, Revision: "before"})
+	log.Record(audit.Record{Time: start.Add(-time.Second), Action: audit.Release, Revision: "filtered"})
+	server := httptest.NewServer(NewHandler(auditServer{&remote.MockServer{}, log}, NewRouter()))
+	defer server.Close()
+	c := client.New(http.DefaultClient, transport.NewAPIRouter(), server.URL, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan audit.Record)
+	done := make(chan error)
+	go func() {
+		q := audit.Query{Since: start.Add(-time.Hour), Actions: []audit.Action{audit.Sync}}
+		done <- c.WatchAuditEvents(ctx, q, func(r audit.Record) error {
+			received <- r
+			return nil
+		})
+	}()
+
+	receive := func() audit.Record {
+		select {
+		case r := <-received:
+			return r
+		case err := <-done:
+			t.Fatalf("stream ended: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+		return audit.Record{}
+	}
+	before := receive()
+	assert.Equal(t, "before", before.Revision)
+	assert.NotZero(t, before.ID)
+
+	log.Record(audit.Record{Action: audit.Sync, Revision: "after"})
+	assert.Equal(t, "after", receive().Revision)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	// A client reconnecting gives the ID of the last event it saw
+	req, _ := http.NewRequest("GET", server.URL+"/v10/events/stream", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatUint(before.ID, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(resp.Body)
+	var lines []string
+	for scanner.Scan() && !strings.HasPrefix(scanner.Text(), ": keepalive") {
+		lines = append(lines, scanner.Text())
+	}
+	// The filtered release, then the sync after
+	if assert.Len(t, lines, 6) {
+		assert.Contains(t, lines[1], `"filtered"`)
+		assert.Equal(t, "id: "+strconv.FormatUint(before.ID+2, 10), lines[3])
+		assert.Contains(t, lines[4], `"after"`)
+	}
+}
+
+func TestAuditEventsStream_BadRequest(t *testing.T) {
+	server := httptest.NewServer(NewHandler(auditServer{&remote.MockServer{}, audit.New(0)}, NewRouter()))
+	defer server.Close()
+	for _, query := range []string{"after=latest", "severity=critical"} {
+		resp, err := http.Get(server.URL + "/v10/events/stream?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
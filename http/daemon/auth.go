@@ -0,0 +1,229 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux/authz"
+	transport "github.com/weaveworks/flux/http"
+)
+
+// TokenFile holds the tokens accepted for the API, read from a file
+// with one token per line (blank lines and those starting with `#`
+// are ignored) -- typically mounted from a Kubernetes Secret. A token
+// may be followed by a name for whoever uses it, to which an
+// authorization policy can give rights. The file is read again when
+// it changes, so tokens can be rotated without restarting.
+type TokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	tokens  []namedToken
+}
+
+type namedToken struct {
+	token []byte
+	name  string
+}
+
+// NewTokenFile reads the tokens from the file given, which must have
+// at least one.
+func NewTokenFile(path string) (*TokenFile, error) {
+	f := &TokenFile{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reload reads the file if it's changed. If it can't be read, or has
+// no tokens in it, the tokens already read are kept.
+func (f *TokenFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size && f.tokens != nil {
+		return nil
+	}
+	bs, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	var tokens []namedToken
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		t := namedToken{token: []byte(fields[0])}
+		if len(fields) > 1 {
+			t.name = fields[1]
+		}
+		tokens = append(tokens, t)
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("no API tokens in %s", f.path)
+	}
+	f.tokens, f.modTime, f.size = tokens, info.ModTime(), info.Size()
+	return nil
+}
+
+// Identify reports whether the token given is one of those accepted
+// and, if so, the name given to it (which may be empty).
+func (f *TokenFile) Identify(token string) (string, bool) {
+	f.reload() // if this fails, carry on with the tokens we have
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var name string
+	valid := 0
+	for _, t := range f.tokens {
+		if subtle.ConstantTimeCompare(t.token, []byte(token)) == 1 {
+			valid, name = 1, t.name
+		}
+	}
+	return name, valid == 1
+}
+
+// Valid reports whether the token given is one of those accepted.
+func (f *TokenFile) Valid(token string) bool {
+	_, ok := f.Identify(token)
+	return ok
+}
+
+// requestToken gets the token presented with a request, given either
+// as a bearer token, or as fluxctl gives a service token.
+func requestToken(r *http.Request) string {
+	return AuthorizationToken(r.Header.Get("Authorization"))
+}
+
+// AuthorizationToken gets the token from the value of an
+// Authorization header (or the equivalent gRPC metadata), if it has
+// one.
+func AuthorizationToken(header string) string {
+	for _, prefix := range []string{"Bearer ", "Scope-Probe token="} {
+		if strings.HasPrefix(header, prefix) {
+			return strings.TrimSpace(header[len(prefix):])
+		}
+	}
+	return ""
+}
+
+// Auth says what requests to the API must present. The zero value
+// lets every request through.
+type Auth struct {
+	// If not nil, requests must present one of these tokens
+	Tokens *TokenFile
+	// If true, requests must come with a client certificate that
+	// has been verified (see ServerTLSConfig)
+	RequireClientCert bool
+}
+
+var (
+	errNoToken      = errors.New("no API token given; give one as a bearer token")
+	errInvalidToken = errors.New("the API token given is not valid")
+	errNoClientCert = errors.New("no verified client certificate given")
+)
+
+// Required reports whether any credentials are required.
+func (a Auth) Required() bool {
+	return a.Tokens != nil || a.RequireClientCert
+}
+
+// Identify checks the credentials presented -- the state of the TLS
+// connection, if there is one, and the token, if one is given --
+// against those required, and gives the identities of the caller:
+// the common name of its client certificate, and the name given to
+// its token.
+func (a Auth) Identify(conn *tls.ConnectionState, token string) ([]string, error) {
+	var identities []string
+	if a.RequireClientCert {
+		if conn == nil || len(conn.VerifiedChains) == 0 {
+			return nil, errNoClientCert
+		}
+		if cn := conn.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+			identities = append(identities, cn)
+		}
+	}
+	if a.Tokens != nil {
+		if token == "" {
+			return nil, errNoToken
+		}
+		name, ok := a.Tokens.Identify(token)
+		if !ok {
+			return nil, errInvalidToken
+		}
+		if name != "" {
+			identities = append(identities, name)
+		}
+	}
+	return identities, nil
+}
+
+// Wrap returns a handler that only passes on requests that present
+// the credentials required; others are refused as unauthorized. The
+// identities of the caller are put in the request context, for
+// authorization (see package authz).
+func (a Auth) Wrap(h http.Handler) http.Handler {
+	if !a.Required() {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identities, err := a.Identify(r.TLS, requestToken(r))
+		switch err {
+		case nil:
+			h.ServeHTTP(w, r.WithContext(authz.WithIdentities(r.Context(), identities...)))
+			return
+		case errNoToken:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="flux"`)
+		case errInvalidToken:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="flux", error="invalid_token"`)
+		}
+		transport.WriteError(w, r, http.StatusUnauthorized, err)
+	})
+}
+
+// ServerTLSConfig makes the TLS config for serving with the
+// certificate and key given. If a CA certificate is given, client
+// certificates signed by it are verified -- but not required, so
+// that e.g., readiness probes and metrics scrapers can still connect;
+// use Auth.RequireClientCert to require them for the API.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate and key: %s", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA certificate: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
@@ -0,0 +1,201 @@
+package daemon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/authz"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "flux-api-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestAuth_Tokens(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "tokens")
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("# no tokens yet\n\n"), 0600))
+	_, err := NewTokenFile(path)
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("# for fluxctl\nsecret1\n  secret2  \n"), 0600))
+	tokens, err := NewTokenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Auth{Tokens: tokens}.Wrap(okHandler)
+
+	status := func(header string) int {
+		req := httptest.NewRequest("GET", "/v11/services", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, status(""))
+	assert.Equal(t, http.StatusUnauthorized, status("Bearer wrong"))
+	assert.Equal(t, http.StatusOK, status("Bearer secret1"))
+	assert.Equal(t, http.StatusOK, status("Bearer secret2"))
+	assert.Equal(t, http.StatusOK, status("Scope-Probe token=secret2"))
+	assert.Equal(t, http.StatusUnauthorized, status("Basic c2VjcmV0MQ=="))
+
+	// Rotating the tokens takes effect without restarting
+	assert.NoError(t, ioutil.WriteFile(path, []byte("secret3\n"), 0600))
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	assert.Equal(t, http.StatusUnauthorized, status("Bearer secret1"))
+	assert.Equal(t, http.StatusOK, status("Bearer secret3"))
+
+	// .. but emptying the file doesn't lock everyone out
+	assert.NoError(t, ioutil.WriteFile(path, nil, 0600))
+	later = later.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	assert.Equal(t, http.StatusOK, status("Bearer secret3"))
+}
+
+func TestAuth_Identities(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "tokens")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("secret1 team-a\nsecret2\n"), 0600))
+	tokens, err := NewTokenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var identities []string
+	handler := Auth{Tokens: tokens}.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identities, _ = authz.Identities(r.Context())
+	}))
+	identify := func(token string) []string {
+		identities = nil
+		req := httptest.NewRequest("GET", "/v11/services", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return identities
+	}
+	assert.Equal(t, []string{"team-a"}, identify("secret1"))
+	assert.Empty(t, identify("secret2"))
+	assert.Nil(t, identify("team-a"))
+}
+
+func TestAuth_None(t *testing.T) {
+	w := httptest.NewRecorder()
+	Auth{}.Wrap(okHandler).ServeHTTP(w, httptest.NewRequest("GET", "/v11/services", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// writeCert makes a certificate, signed by the parent given (or
+// self-signed if that's nil), and writes it and its key to files.
+func writeCert(t *testing.T, dir, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return cert, key
+}
+
+func TestAuth_ClientCerts(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	ca, caKey := writeCert(t, dir, "ca", true, nil, nil)
+	writeCert(t, dir, "server", false, ca, caKey)
+	writeCert(t, dir, "client", false, ca, caKey)
+	writeCert(t, dir, "stranger", false, nil, nil)
+
+	config, err := ServerTLSConfig(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(Auth{RequireClientCert: true}.Wrap(okHandler))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(clientCert string) (int, error) {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if clientCert != "" {
+			cert, err := tls.LoadX509KeyPair(filepath.Join(dir, clientCert+".crt"), filepath.Join(dir, clientCert+".key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(server.URL + "/v11/services")
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	code, err := get("client")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+
+	// Connecting without a certificate is allowed (e.g., for
+	// readiness probes), but the API refuses the request
+	code, err = get("")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// A certificate not signed by the CA is not presented (or, if it
+	// were, would fail the handshake); either way, the API refuses it
+	code, err = get("stranger")
+	if err == nil {
+		assert.Equal(t, http.StatusUnauthorized, code)
+	}
+}
@@ -0,0 +1,105 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/flux/api/v6"
+	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/http/client"
+	"github.com/weaveworks/flux/remote"
+)
+
+// These pin the requests fluxctls from before the API was advertised
+// make, so that upgrading a daemon doesn't break the fluxctls still
+// talking to it.
+func TestCompat_OldClientNewDaemon(t *testing.T) {
+	handler := NewHandler(&remote.MockServer{}, NewRouter())
+	for _, c := range []struct {
+		method, path, body string
+	}{
+		{"GET", "/v6/services?namespace=", ""},
+		{"GET", "/v6/images?service=%3Call%3E", ""},
+		{"GET", "/v10/images?service=%3Call%3E&containerFields=", ""},
+		{"POST", "/v9/update-manifests", `{"type":"policy","cause":{},"spec":{}}`},
+		{"GET", "/v6/jobs?id=job", ""},
+		{"GET", "/v6/sync?ref=master", ""},
+		{"GET", "/v6/export", ""},
+		{"POST", "/v9/git-repo-config", "false"},
+		{"GET", "/v6/identity.pub", ""},
+		{"POST", "/v6/identity.pub", ""},
+	} {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code == http.StatusNotFound || rec.Code == http.StatusGone {
+			t.Errorf("%s %s: expected it to be served, got %d", c.method, c.path, rec.Code)
+		}
+	}
+}
+
+func TestCompat_NewClientNewDaemon(t *testing.T) {
+	server := httptest.NewServer(NewHandler(&remote.MockServer{}, NewRouter()))
+	defer server.Close()
+	c := client.New(http.DefaultClient, transport.NewAPIRouter(), server.URL, "")
+
+	versions, err := c.APIVersions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"v6", "v9", "v10"}; !reflect.DeepEqual(versions.Versions, expected) {
+		t.Errorf("expected versions %v, got %v", expected, versions.Versions)
+	}
+	transport.NewAPIRouter().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if !versions.Supports(route.GetName()) {
+			t.Errorf("expected %s to be advertised", route.GetName())
+		}
+		return nil
+	})
+}
+
+// An old daemon serves only the legacy endpoints, and doesn't say
+// what it serves.
+func TestCompat_NewClientOldDaemon(t *testing.T) {
+	router := NewRouter()
+	handler := NewHandler(&remote.MockServer{
+		ListServicesAnswer: []v6.ControllerStatus{{}},
+	}, router)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+		if router.Match(r, &match) && transport.LegacyAPI.Supports(match.Route.GetName()) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		transport.WriteError(w, r, http.StatusNotFound, transport.MakeAPINotFound(r.URL.Path))
+	}))
+	defer server.Close()
+	c := client.New(http.DefaultClient, transport.NewAPIRouter(), server.URL, "")
+
+	ctx := context.Background()
+	versions, err := c.APIVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, transport.LegacyAPI) {
+		t.Errorf("expected the legacy API to be assumed, got %+v", versions)
+	}
+	for endpoint, expected := range map[string]bool{
+		transport.ListServices:            true,
+		transport.ListServicesWithOptions: false,
+		transport.Graph:                   false,
+	} {
+		if got, err := c.Supports(ctx, endpoint); err != nil || got != expected {
+			t.Errorf("%s: expected supported to be %v, got %v (%v)", endpoint, expected, got, err)
+		}
+	}
+	if services, err := c.ListServices(ctx, ""); err != nil || len(services) != 1 {
+		t.Errorf("expected the legacy endpoints to work, got %v (%v)", services, err)
+	}
+}
@@ -0,0 +1,33 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/weaveworks/flux/api/v10"
+	transport "github.com/weaveworks/flux/http"
+)
+
+// DiffReader is the part of the daemon that can say what a sync
+// would change.
+type DiffReader interface {
+	Diff(ctx context.Context, namespace string) (v10.Diff, error)
+}
+
+// Diff responds with the changes syncing the manifests at the head of
+// the branch would make to the resources in the cluster, optionally
+// only those in `namespace`.
+func (s HTTPServer) Diff(w http.ResponseWriter, r *http.Request) {
+	reader, ok := s.server.(DiffReader)
+	if !ok {
+		transport.WriteError(w, r, http.StatusNotImplemented, errors.New("diffs are not available from this server"))
+		return
+	}
+	diff, err := reader.Diff(r.Context(), r.URL.Query().Get("namespace"))
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, diff)
+}
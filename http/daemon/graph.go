@@ -0,0 +1,33 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/weaveworks/flux/api/v10"
+	transport "github.com/weaveworks/flux/http"
+)
+
+// GraphReader is the part of the daemon that can say where its
+// workloads came from.
+type GraphReader interface {
+	Graph(ctx context.Context, namespace string) (v10.Graph, error)
+}
+
+// Graph responds with the relationships between the workloads in the
+// cluster, optionally only those in `namespace`, the files in git
+// they are defined in, their antecedents, and their images.
+func (s HTTPServer) Graph(w http.ResponseWriter, r *http.Request) {
+	reader, ok := s.server.(GraphReader)
+	if !ok {
+		transport.WriteError(w, r, http.StatusNotImplemented, errors.New("the graph of workloads is not available from this server"))
+		return
+	}
+	graph, err := reader.Graph(r.Context(), r.URL.Query().Get("namespace"))
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, graph)
+}
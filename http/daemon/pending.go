@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/weaveworks/flux/api/v10"
+	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+// PendingReleaser is the part of the daemon that keeps automated
+// releases waiting for approval.
+type PendingReleaser interface {
+	PendingReleases(ctx context.Context) []v10.PendingRelease
+	ApproveRelease(ctx context.Context, id string, cause update.Cause) (job.ID, error)
+}
+
+var errNoPendingReleases = errors.New("pending releases are not available from this server")
+
+// PendingReleases responds with the automated releases waiting for
+// approval.
+func (s HTTPServer) PendingReleases(w http.ResponseWriter, r *http.Request) {
+	releaser, ok := s.server.(PendingReleaser)
+	if !ok {
+		transport.WriteError(w, r, http.StatusNotImplemented, errNoPendingReleases)
+		return
+	}
+	transport.JSONResponse(w, r, releaser.PendingReleases(r.Context()))
+}
+
+// ApproveRelease queues the pending release given by `id` to be
+// committed, with the cause in the request body, and responds with
+// the ID of the job doing so.
+func (s HTTPServer) ApproveRelease(w http.ResponseWriter, r *http.Request) {
+	releaser, ok := s.server.(PendingReleaser)
+	if !ok {
+		transport.WriteError(w, r, http.StatusNotImplemented, errNoPendingReleases)
+		return
+	}
+	var cause update.Cause
+	if err := json.NewDecoder(r.Body).Decode(&cause); err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	jobID, err := releaser.ApproveRelease(r.Context(), r.URL.Query().Get("id"), cause)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, jobID)
+}
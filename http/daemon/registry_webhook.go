@@ -0,0 +1,201 @@
+package daemon
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/weaveworks/flux/api/v9"
+	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/image"
+)
+
+// The image registries we know how to receive push notifications
+// from. `generic` is for anything that can send a JSON body with an
+// `image` field.
+const (
+	RegistryWebhookDockerHub    = "dockerhub"
+	RegistryWebhookDistribution = "distribution" // Docker Registry v2 notifications
+	RegistryWebhookQuay         = "quay"
+	RegistryWebhookECR          = "ecr" // EventBridge events, forwarded by e.g., an API destination
+	RegistryWebhookGeneric      = "generic"
+)
+
+var registryWebhookProviders = []string{
+	RegistryWebhookDockerHub,
+	RegistryWebhookDistribution,
+	RegistryWebhookQuay,
+	RegistryWebhookECR,
+	RegistryWebhookGeneric,
+}
+
+func (wh *WebhookReceiver) handleRegistry(provider string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Most registries can't sign their notifications, so the
+		// secret is given back verbatim instead.
+		if !wh.authenticateToken(r) {
+			wh.logger.Log("registry", provider, "err", errWebhookSignature)
+			transport.WriteError(w, r, http.StatusUnauthorized, errWebhookSignature)
+			return
+		}
+		body, ok := readPayload(w, r)
+		if !ok {
+			return
+		}
+		names, err := parseRegistryWebhook(provider, body)
+		if err != nil {
+			wh.logger.Log("registry", provider, "err", err)
+			transport.WriteError(w, r, http.StatusBadRequest, errWebhookPayload)
+			return
+		}
+		if len(names) == 0 {
+			// e.g., a pull, or a layer being uploaded
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		for _, name := range names {
+			change := v9.Change{
+				Kind:   v9.ImageChange,
+				Source: v9.ImageUpdate{Name: name},
+			}
+			if err := wh.notifier.NotifyChange(r.Context(), change); err != nil {
+				transport.ErrorResponse(w, r, err)
+				return
+			}
+			wh.logger.Log("registry", provider, "msg", "notified of image push", "image", name.String())
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// authenticateToken checks for the shared secret given either as a
+// bearer token or as the query parameter `token`.
+func (wh *WebhookReceiver) authenticateToken(r *http.Request) bool {
+	if len(wh.secret) == 0 {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return hmac.Equal([]byte(token), wh.secret)
+}
+
+// parseRegistryWebhook returns the names of the images pushed
+// according to the notification, if any.
+func parseRegistryWebhook(provider string, body []byte) ([]image.Name, error) {
+	switch provider {
+	case RegistryWebhookDockerHub:
+		var payload struct {
+			Repository struct {
+				RepoName string `json:"repo_name"`
+			} `json:"repository"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, err
+		}
+		return parseImageNames(payload.Repository.RepoName)
+
+	case RegistryWebhookDistribution:
+		var payload struct {
+			Events []struct {
+				Action string `json:"action"`
+				Target struct {
+					MediaType  string `json:"mediaType"`
+					Repository string `json:"repository"`
+					URL        string `json:"url"`
+					Tag        string `json:"tag"`
+				} `json:"target"`
+				Request struct {
+					Host string `json:"host"`
+				} `json:"request"`
+			} `json:"events"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, err
+		}
+		var names []image.Name
+		seen := map[image.Name]bool{}
+		for _, e := range payload.Events {
+			// Pushing an image also pushes its layers, which are
+			// of no interest until there's a manifest.
+			if e.Action != "push" || (e.Target.Tag == "" && !strings.Contains(e.Target.MediaType, "manifest")) {
+				continue
+			}
+			host := e.Request.Host
+			if host == "" {
+				u, err := url.Parse(e.Target.URL)
+				if err != nil {
+					return nil, err
+				}
+				host = u.Host
+			}
+			name := image.Name{Domain: host, Image: e.Target.Repository}
+			if host == "" || name.Image == "" {
+				return nil, errors.New("registry or repository missing from event")
+			}
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		return names, nil
+
+	case RegistryWebhookQuay:
+		var payload struct {
+			DockerURL string `json:"docker_url"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, err
+		}
+		return parseImageNames(payload.DockerURL)
+
+	case RegistryWebhookECR:
+		var payload struct {
+			DetailType string `json:"detail-type"`
+			Account    string `json:"account"`
+			Region     string `json:"region"`
+			Detail     struct {
+				ActionType     string `json:"action-type"`
+				Result         string `json:"result"`
+				RepositoryName string `json:"repository-name"`
+			} `json:"detail"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, err
+		}
+		if payload.DetailType != "ECR Image Action" || payload.Detail.ActionType != "PUSH" || payload.Detail.Result != "SUCCESS" {
+			return nil, nil
+		}
+		if payload.Account == "" || payload.Region == "" || payload.Detail.RepositoryName == "" {
+			return nil, errors.New("account, region or repository missing from event")
+		}
+		domain := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", payload.Account, payload.Region)
+		if strings.HasPrefix(payload.Region, "cn-") {
+			domain += ".cn"
+		}
+		return []image.Name{{Domain: domain, Image: payload.Detail.RepositoryName}}, nil
+
+	case RegistryWebhookGeneric:
+		var payload struct {
+			Image string `json:"image"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, err
+		}
+		return parseImageNames(payload.Image)
+	}
+	return nil, fmt.Errorf("unknown registry webhook provider %q", provider)
+}
+
+func parseImageNames(s string) ([]image.Name, error) {
+	ref, err := image.ParseRef(s)
+	if err != nil {
+		return nil, err
+	}
+	return []image.Name{ref.Name}, nil
+}
@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/image"
+)
+
+func TestRegistryWebhookToken(t *testing.T) {
+	n := &recordingNotifier{}
+	wh := NewWebhookReceiver(n, []byte("s3cr3t"), "git@example.com:org/repo", "master", log.NewNopLogger())
+	h := wh.Handler()
+
+	body := []byte(`{"push_data":{"tag":"1.0"},"repository":{"repo_name":"org/app"}}`)
+	for _, c := range []struct {
+		path, auth string
+		code       int
+		notified   int
+	}{
+		{"/hook/registry/dockerhub", "", http.StatusUnauthorized, 0},
+		{"/hook/registry/dockerhub?token=wrong", "", http.StatusUnauthorized, 0},
+		{"/hook/registry/dockerhub?token=s3cr3t", "", http.StatusAccepted, 1},
+		{"/hook/registry/dockerhub", "Bearer s3cr3t", http.StatusAccepted, 1},
+	} {
+		req := httptest.NewRequest("POST", c.path, bytes.NewReader(body))
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Errorf("%s, auth %q: expected status %d, got %d", c.path, c.auth, c.code, rec.Code)
+		}
+		if len(n.changes) != c.notified {
+			t.Errorf("%s, auth %q: expected %d notifications, got %d", c.path, c.auth, c.notified, len(n.changes))
+		}
+		for _, change := range n.changes {
+			update := change.Source.(v9.ImageUpdate)
+			if change.Kind != v9.ImageChange || update.Name.String() != "org/app" {
+				t.Errorf("unexpected change %+v", change)
+			}
+		}
+		n.changes = nil
+	}
+}
+
+func TestRegistryWebhookTooLarge(t *testing.T) {
+	n := &recordingNotifier{}
+	wh := NewWebhookReceiver(n, nil, "git@example.com:org/repo", "master", log.NewNopLogger())
+	body := bytes.Repeat([]byte(" "), maxWebhookPayload+1)
+	req := httptest.NewRequest("POST", "/hook/registry/generic", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	wh.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+	if len(n.changes) != 0 {
+		t.Errorf("expected no notifications, got %d", len(n.changes))
+	}
+}
+
+func TestParseRegistryWebhook(t *testing.T) {
+	for _, c := range []struct {
+		provider string
+		body     string
+		expected []image.Name
+	}{
+		{RegistryWebhookQuay,
+			`{"repository":"org/app","docker_url":"quay.io/org/app","updated_tags":["1.0"]}`,
+			[]image.Name{{Domain: "quay.io", Image: "org/app"}}},
+		{RegistryWebhookDistribution,
+			`{"events":[
+			  {"action":"push","target":{"mediaType":"application/octet-stream","repository":"org/app"},"request":{"host":"registry.example.com"}},
+			  {"action":"push","target":{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","repository":"org/app","tag":"1.0"},"request":{"host":"registry.example.com"}},
+			  {"action":"push","target":{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","repository":"org/app","tag":"latest"},"request":{"host":"registry.example.com"}},
+			  {"action":"pull","target":{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","repository":"org/other","url":"https://localhost:5000/v2/org/other/manifests/1.0"}},
+			  {"action":"push","target":{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","repository":"org/other","url":"https://localhost:5000/v2/org/other/manifests/sha256:abc"}}
+			]}`,
+			[]image.Name{{Domain: "registry.example.com", Image: "org/app"}, {Domain: "localhost:5000", Image: "org/other"}}},
+		{RegistryWebhookECR,
+			`{"detail-type":"ECR Image Action","source":"aws.ecr","account":"123456789012","region":"eu-west-1",
+			  "detail":{"result":"SUCCESS","repository-name":"app","action-type":"PUSH","image-tag":"1.0"}}`,
+			[]image.Name{{Domain: "123456789012.dkr.ecr.eu-west-1.amazonaws.com", Image: "app"}}},
+		{RegistryWebhookECR,
+			`{"detail-type":"ECR Image Action","source":"aws.ecr","account":"123456789012","region":"eu-west-1",
+			  "detail":{"result":"SUCCESS","repository-name":"app","action-type":"DELETE","image-tag":"1.0"}}`,
+			nil},
+		{RegistryWebhookGeneric,
+			`{"image":"registry.example.com/org/app:1.0"}`,
+			[]image.Name{{Domain: "registry.example.com", Image: "org/app"}}},
+	} {
+		names, err := parseRegistryWebhook(c.provider, []byte(c.body))
+		if err != nil {
+			t.Errorf("%s: %v", c.provider, err)
+			continue
+		}
+		if len(names) != len(c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.provider, c.expected, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != c.expected[i] {
+				t.Errorf("%s: expected %v, got %v", c.provider, c.expected, names)
+			}
+		}
+	}
+}
@@ -47,7 +47,9 @@ func NewRouter() *mux.Router {
 
 func NewHandler(s api.Server, r *mux.Router) http.Handler {
 	handle := HTTPServer{s}
+	r.Get(transport.Versions).HandlerFunc(handle.Versions(r))
 	r.Get(transport.ListServices).HandlerFunc(handle.ListServices)
+	r.Get(transport.ListServicesWithOptions).HandlerFunc(handle.ListServicesWithOptions)
 	r.Get(transport.ListImages).HandlerFunc(handle.ListImagesWithOptions)
 	r.Get(transport.ListImagesWithOptions).HandlerFunc(handle.ListImagesWithOptions)
 	r.Get(transport.UpdateManifests).HandlerFunc(handle.UpdateManifests)
@@ -55,6 +57,13 @@ func NewHandler(s api.Server, r *mux.Router) http.Handler {
 	r.Get(transport.SyncStatus).HandlerFunc(handle.SyncStatus)
 	r.Get(transport.Export).HandlerFunc(handle.Export)
 	r.Get(transport.GitRepoConfig).HandlerFunc(handle.GitRepoConfig)
+	r.Get(transport.DaemonStatus).HandlerFunc(handle.DaemonStatus)
+	r.Get(transport.AuditEvents).HandlerFunc(handle.AuditEvents)
+	r.Get(transport.AuditEventsStream).HandlerFunc(handle.AuditEventsStream)
+	r.Get(transport.Graph).HandlerFunc(handle.Graph)
+	r.Get(transport.Diff).HandlerFunc(handle.Diff)
+	r.Get(transport.PendingReleases).HandlerFunc(handle.PendingReleases)
+	r.Get(transport.ApproveRelease).HandlerFunc(handle.ApproveRelease)
 
 	// These handlers persist to support requests from older fluxctls. In general we
 	// should avoid adding references to them so that they can eventually be removed.
@@ -63,16 +72,35 @@ func NewHandler(s api.Server, r *mux.Router) http.Handler {
 	r.Get(transport.GetPublicSSHKey).HandlerFunc(handle.GetPublicSSHKey)
 	r.Get(transport.RegeneratePublicSSHKey).HandlerFunc(handle.RegeneratePublicSSHKey)
 
-	return middleware.Instrument{
+	instrumented := middleware.Instrument{
 		RouteMatcher: r,
 		Duration:     requestDuration,
 	}.Wrap(r)
+	// Streams aren't instrumented: they last as long as the client
+	// likes, and the instrumenting middleware hides the
+	// http.Flusher they need.
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var match mux.RouteMatch
+		if r.Match(req, &match) && match.Route.GetName() == transport.AuditEventsStream {
+			r.ServeHTTP(w, req)
+			return
+		}
+		instrumented.ServeHTTP(w, req)
+	})
 }
 
 type HTTPServer struct {
 	server api.Server
 }
 
+// Versions responds with the versions and endpoints of the API the
+// router serves.
+func (s HTTPServer) Versions(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transport.JSONResponse(w, r, transport.ServedAPI(router))
+	}
+}
+
 func (s HTTPServer) JobStatus(w http.ResponseWriter, r *http.Request) {
 	id := job.ID(mux.Vars(r)["id"])
 	status, err := s.server.JobStatus(r.Context(), id)
@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v6"
+	transport "github.com/weaveworks/flux/http"
+)
+
+// ServiceFilterer is the part of the daemon that can list only the
+// workloads matching options, including whether they're out of date.
+type ServiceFilterer interface {
+	ListServicesWithOptions(ctx context.Context, opts v10.ListServicesOptions) ([]v6.ControllerStatus, error)
+}
+
+// ListServicesWithOptions responds with the workloads in the
+// namespace given (or in all namespaces) that match the label
+// selector and policies given, and, if asked, only those with newer
+// images to release. Servers that can't filter workloads themselves
+// have them filtered here, except by whether they're out of date.
+func (s HTTPServer) ListServicesWithOptions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := v10.ListServicesOptions{
+		Namespace: query.Get("namespace"),
+		Selector:  query.Get("selector"),
+	}
+	for param, dest := range map[string]*bool{
+		"automated": &opts.Automated,
+		"locked":    &opts.Locked,
+		"outOfDate": &opts.OutOfDate,
+	} {
+		if value := query.Get(param); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing %s", param))
+				return
+			}
+			*dest = b
+		}
+	}
+	if _, err := labels.Parse(opts.Selector); err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing selector %q", opts.Selector))
+		return
+	}
+
+	if filterer, ok := s.server.(ServiceFilterer); ok {
+		res, err := filterer.ListServicesWithOptions(r.Context(), opts)
+		if err != nil {
+			transport.ErrorResponse(w, r, err)
+			return
+		}
+		transport.JSONResponse(w, r, res)
+		return
+	}
+	if opts.OutOfDate {
+		transport.WriteError(w, r, http.StatusNotImplemented, errors.New("this server can't tell which workloads are out of date"))
+		return
+	}
+	services, err := s.server.ListServices(r.Context(), opts.Namespace)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	res, err := opts.Filter(services)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, res)
+}
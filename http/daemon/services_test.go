@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/remote"
+)
+
+func TestListServicesWithOptions(t *testing.T) {
+	web := flux.MustParseResourceID("default:deployment/web")
+	db := flux.MustParseResourceID("default:deployment/db")
+	worker := flux.MustParseResourceID("default:deployment/worker")
+	server := &remote.MockServer{
+		ListServicesAnswer: []v6.ControllerStatus{
+			{ID: web, Labels: map[string]string{"app": "web", "team": "a"}, Automated: true},
+			{ID: db, Labels: map[string]string{"app": "db", "team": "a"}, Locked: true},
+			{ID: worker, Labels: map[string]string{"app": "worker", "team": "b"}, Automated: true},
+		},
+	}
+	handler := NewHandler(server, NewRouter())
+
+	for _, c := range []struct {
+		query    string
+		code     int
+		expected []flux.ResourceID
+	}{
+		{"", http.StatusOK, []flux.ResourceID{web, db, worker}},
+		{"selector=team%3Da", http.StatusOK, []flux.ResourceID{web, db}},
+		{"selector=team%3Da&automated=true", http.StatusOK, []flux.ResourceID{web}},
+		{"locked=true", http.StatusOK, []flux.ResourceID{db}},
+		// Only the daemon can tell which workloads are out of date
+		{"outOfDate=true", http.StatusNotImplemented, nil},
+		{"automated=false", http.StatusOK, []flux.ResourceID{web, db, worker}},
+		{"automated=maybe", http.StatusBadRequest, nil},
+		{"selector=%3D%3D", http.StatusBadRequest, nil},
+	} {
+		req := httptest.NewRequest("GET", "/v10/services?"+c.query, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Errorf("%q: expected status %d, got %d (%s)", c.query, c.code, rec.Code, rec.Body.String())
+			continue
+		}
+		if c.code != http.StatusOK {
+			continue
+		}
+		var services []v6.ControllerStatus
+		if err := json.NewDecoder(rec.Body).Decode(&services); err != nil {
+			t.Fatal(err)
+		}
+		var got []flux.ResourceID
+		for _, s := range services {
+			got = append(got, s.ID)
+		}
+		if len(got) != len(c.expected) {
+			t.Errorf("%q: expected %v, got %v", c.query, c.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.expected[i] {
+				t.Errorf("%q: expected %v, got %v", c.query, c.expected, got)
+				break
+			}
+		}
+	}
+}
+
+type filteringServer struct {
+	*remote.MockServer
+	opts v10.ListServicesOptions
+}
+
+func (s *filteringServer) ListServicesWithOptions(_ context.Context, opts v10.ListServicesOptions) ([]v6.ControllerStatus, error) {
+	s.opts = opts
+	return []v6.ControllerStatus{{ID: flux.MustParseResourceID("test:deployment/web")}}, nil
+}
+
+func TestListServicesWithOptionsFilterer(t *testing.T) {
+	server := &filteringServer{MockServer: &remote.MockServer{}}
+	handler := NewHandler(server, NewRouter())
+
+	req := httptest.NewRequest("GET", "/v10/services?namespace=test&selector=app%3Dweb&outOfDate=true", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	expected := v10.ListServicesOptions{Namespace: "test", Selector: "app=web", OutOfDate: true}
+	if server.opts != expected {
+		t.Errorf("expected the options %+v to be passed on, got %+v", expected, server.opts)
+	}
+}
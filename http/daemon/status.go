@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/weaveworks/flux/api/v10"
+	transport "github.com/weaveworks/flux/http"
+)
+
+// How long a readiness check may take before it's considered to
+// have failed.
+const readinessTimeout = 5 * time.Second
+
+// StatusReporter is the part of the daemon that can say how it's
+// getting on, for monitoring and readiness probes.
+type StatusReporter interface {
+	Status(context.Context) v10.Status
+	Ready(context.Context) error
+}
+
+// DaemonStatus responds with the daemon's status, if the server
+// given to the handler can report it.
+func (s HTTPServer) DaemonStatus(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := s.server.(StatusReporter)
+	if !ok {
+		transport.WriteError(w, r, http.StatusNotImplemented, errors.New("status is not available from this server"))
+		return
+	}
+	transport.JSONResponse(w, r, reporter.Status(r.Context()))
+}
+
+// ReadinessHandler responds with 200 OK if the daemon is ready, and
+// 503 Service Unavailable, with the reason, if not; it is meant to be
+// used as a Kubernetes readiness probe.
+func ReadinessHandler(reporter StatusReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		if err := reporter.Ready(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "OK")
+	})
+}
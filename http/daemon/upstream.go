@@ -1,10 +1,17 @@
 package daemon
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -21,21 +28,42 @@ import (
 	"github.com/weaveworks/flux/remote/rpc"
 )
 
-// Upstream handles communication from the daemon to a service
-type Upstream struct {
-	client    *http.Client
-	ua        string
-	token     fluxclient.Token
-	url       *url.URL
-	endpoint  string
-	apiClient *fluxclient.Client
-	server    api.UpstreamServer
-	logger    log.Logger
-	quit      chan struct{}
+// Upstream is a connection from the daemon to a service (e.g., Weave
+// Cloud, or a self-hosted control plane) which calls the daemon's API,
+// and to which the daemon sends its events. NewUpstream connects to
+// Weave Cloud, and NewWebsocketUpstream to other services that speak
+// the same protocol; other transports can implement this.
+type Upstream interface {
+	event.EventWriter
+	// Close disconnects from the service, and stops reconnecting.
+	Close() error
+}
 
-	ws websocket.Websocket
+// Standalone is the Upstream of a daemon that isn't connected to a
+// service: its events go nowhere beyond its own log.
+type Standalone struct{}
+
+var _ Upstream = Standalone{}
+
+func (Standalone) LogEvent(event.Event) error {
+	return nil
 }
 
+func (Standalone) Close() error {
+	return nil
+}
+
+// How long to wait before reconnecting after a connection attempt
+// fails, or a connection is lost; the wait doubles each time, up to
+// the maximum, and is reset once a connection has stayed up for a
+// while, so a service that accepts connections then drops them
+// straight away isn't reconnected to in a tight loop.
+const (
+	minReconnectBackoff = 5 * time.Second
+	maxReconnectBackoff = 5 * time.Minute
+	minStableConnection = time.Minute
+)
+
 var (
 	ErrEndpointDeprecated = errors.New("Your fluxd version is deprecated - please upgrade, see https://github.com/weaveworks/flux/releases")
 	connectionDuration    = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
@@ -44,9 +72,39 @@ var (
 		Name:      "connection_duration_seconds",
 		Help:      "Duration in seconds of the current connection to fluxsvc. Zero means unconnected.",
 	}, []string{"target"})
+	connectionAttempts = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "fluxd",
+		Name:      "connection_attempts_total",
+		Help:      "Number of attempts to connect to the upstream service.",
+	}, []string{"target", "success"})
+	connectionBackoff = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "fluxd",
+		Name:      "connection_backoff_seconds",
+		Help:      "Seconds to wait before attempting to reconnect to the upstream service. Zero means connected, or connecting.",
+	}, []string{"target"})
 )
 
-func NewUpstream(client *http.Client, ua string, t fluxclient.Token, router *mux.Router, endpoint string, s api.UpstreamServer, logger log.Logger) (*Upstream, error) {
+// websocketUpstream connects to a service over a websocket, and
+// serves the daemon's API to it over RPC.
+type websocketUpstream struct {
+	client   *http.Client
+	header   http.Header
+	url      *url.URL
+	endpoint string
+	logEvent func(context.Context, event.Event) error
+	server   api.UpstreamServer
+	logger   log.Logger
+	quit     chan struct{}
+
+	mu sync.Mutex
+	ws websocket.Websocket
+}
+
+// NewUpstream connects to Weave Cloud, or another service with the
+// same API, at the base address given.
+func NewUpstream(client *http.Client, ua string, t fluxclient.Token, router *mux.Router, endpoint string, s api.UpstreamServer, logger log.Logger) (Upstream, error) {
 	httpEndpoint, wsEndpoint, err := inferEndpoints(endpoint)
 	if err != nil {
 		return nil, errors.Wrap(err, "inferring WS/HTTP endpoints")
@@ -57,21 +115,127 @@ func NewUpstream(client *http.Client, ua string, t fluxclient.Token, router *mux
 		return nil, errors.Wrap(err, "constructing URL")
 	}
 
-	a := &Upstream{
-		client:    client,
-		ua:        ua,
-		token:     t,
-		url:       u,
-		endpoint:  wsEndpoint,
-		apiClient: fluxclient.New(client, router, httpEndpoint, t),
-		server:    s,
-		logger:    logger,
-		quit:      make(chan struct{}),
+	// Send version in user-agent, and authentication if provided
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "constructing request %s", u)
+	}
+	req.Header.Set("User-Agent", ua)
+	t.Set(req)
+
+	apiClient := fluxclient.New(client, router, httpEndpoint, t)
+	a := &websocketUpstream{
+		client:   client,
+		header:   req.Header,
+		url:      u,
+		endpoint: wsEndpoint,
+		logEvent: apiClient.LogEvent,
+		server:   s,
+		logger:   logger,
+		quit:     make(chan struct{}),
+	}
+	go a.loop()
+	return a, nil
+}
+
+// WebsocketConfig says how to connect to a self-hosted service.
+type WebsocketConfig struct {
+	// The websocket URL to connect to, with the scheme ws or wss.
+	// The service calls the daemon's API over the connection, as
+	// Weave Cloud does.
+	URL *url.URL
+	// Headers to send when connecting, and with events; e.g., for
+	// authentication
+	Header http.Header
+	// Where to POST events, as JSON; if not given, events are not
+	// sent
+	EventsURL *url.URL
+}
+
+// ParseWebsocketConfig makes the configuration for connecting to a
+// self-hosted service from the URLs given, and headers given as
+// `Name: value`.
+func ParseWebsocketConfig(wsURL, eventsURL string, headers []string) (WebsocketConfig, error) {
+	var config WebsocketConfig
+	var err error
+	if config.URL, err = url.Parse(wsURL); err != nil {
+		return WebsocketConfig{}, errors.Wrapf(err, "parsing websocket URL %s", wsURL)
+	}
+	if eventsURL != "" {
+		if config.EventsURL, err = url.Parse(eventsURL); err != nil {
+			return WebsocketConfig{}, errors.Wrapf(err, "parsing events URL %s", eventsURL)
+		}
+	}
+	config.Header = http.Header{}
+	for _, h := range headers {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return WebsocketConfig{}, fmt.Errorf("expected a header given as 'Name: value', got %q", h)
+		}
+		config.Header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return config, nil
+}
+
+// NewWebsocketUpstream connects to a service at the URL given, rather
+// than at Weave Cloud's routes, so that anyone can build a service
+// to manage daemons.
+func NewWebsocketUpstream(client *http.Client, ua string, config WebsocketConfig, s api.UpstreamServer, logger log.Logger) (Upstream, error) {
+	if config.URL == nil || (config.URL.Scheme != "ws" && config.URL.Scheme != "wss") {
+		return nil, errors.New("a websocket URL, with the scheme ws or wss, is needed")
+	}
+	header := http.Header{}
+	for k, v := range config.Header {
+		header[k] = v
+	}
+	header.Set("User-Agent", ua)
+
+	a := &websocketUpstream{
+		client:   client,
+		header:   header,
+		url:      config.URL,
+		endpoint: config.URL.String(),
+		server:   s,
+		logger:   logger,
+		quit:     make(chan struct{}),
+	}
+	a.logEvent = func(context.Context, event.Event) error {
+		return nil
+	}
+	if config.EventsURL != nil {
+		a.logEvent = func(ctx context.Context, ev event.Event) error {
+			return postEvent(ctx, client, header, config.EventsURL, ev)
+		}
 	}
 	go a.loop()
 	return a, nil
 }
 
+func postEvent(ctx context.Context, client *http.Client, header http.Header, u *url.URL, ev event.Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return errors.Wrap(err, "encoding event")
+	}
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "constructing request %s", u)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "sending event")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("sending event: %s %s", resp.Status, msg)
+	}
+	return nil
+}
+
 func inferEndpoints(endpoint string) (httpEndpoint, wsEndpoint string, err error) {
 	endpointURL, err := url.Parse(endpoint)
 	if err != nil {
@@ -100,42 +264,76 @@ func inferEndpoints(endpoint string) (httpEndpoint, wsEndpoint string, err error
 	}
 }
 
-func (a *Upstream) loop() {
-	backoff := 5 * time.Second
-	errc := make(chan error, 1)
+func (a *websocketUpstream) loop() {
+	backoff := minReconnectBackoff
+	results := make(chan connectResult, 1)
 	for {
 		go func() {
-			errc <- a.connect()
+			results <- a.connect()
 		}()
 		select {
-		case err := <-errc:
-			if err != nil {
+		case res := <-results:
+			if err := res.err; err != nil {
 				a.logger.Log("err", err)
 				if err == ErrEndpointDeprecated {
 					// We have logged the deprecation error, now crashloop to garner attention
 					os.Exit(1)
 				}
 			}
-			time.Sleep(backoff)
+			if res.connected >= minStableConnection {
+				backoff = minReconnectBackoff
+			}
 		case <-a.quit:
 			return
 		}
+
+		wait := reconnectWait(backoff)
+		connectionBackoff.With("target", a.endpoint).Set(wait.Seconds())
+		a.logger.Log("reconnecting-in", wait)
+		select {
+		case <-time.After(wait):
+		case <-a.quit:
+			return
+		}
+		connectionBackoff.With("target", a.endpoint).Set(0)
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
 	}
 }
 
-func (a *Upstream) connect() error {
+// reconnectWait gives how long to wait before reconnecting: somewhere
+// between half the backoff and the backoff, so that many daemons
+// don't all reconnect at once, e.g., after the service restarts, but
+// never longer than the backoff.
+func reconnectWait(backoff time.Duration) time.Duration {
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// connectResult says how long a connection was up for, and if it
+// couldn't be made, why.
+type connectResult struct {
+	connected time.Duration
+	err       error
+}
+
+// connect connects to the service, and serves the daemon's API over
+// the connection until it's closed.
+func (a *websocketUpstream) connect() connectResult {
 	a.setConnectionDuration(0)
 	a.logger.Log("connecting", true)
-	ws, err := websocket.Dial(a.client, a.ua, a.token, a.url)
+	ws, err := websocket.DialWithHeader(a.client, a.header, a.url)
+	connectionAttempts.With("target", a.endpoint, "success", fmt.Sprint(err == nil)).Add(1)
 	if err != nil {
 		if err, ok := err.(*websocket.DialErr); ok && err.HTTPResponse != nil && err.HTTPResponse.StatusCode == http.StatusGone {
-			return ErrEndpointDeprecated
+			return connectResult{err: ErrEndpointDeprecated}
 		}
-		return errors.Wrapf(err, "executing websocket %s", a.url)
+		return connectResult{err: errors.Wrapf(err, "executing websocket %s", a.url)}
 	}
-	a.ws = ws
+	a.setWebsocket(ws)
 	defer func() {
-		a.ws = nil
+		a.setWebsocket(nil)
 		// TODO: handle this error
 		a.logger.Log("connection closing", true, "err", ws.Close())
 	}()
@@ -163,24 +361,32 @@ func (a *Upstream) connect() error {
 	// _server_.
 	rpcserver, err := rpc.NewServer(a.server)
 	if err != nil {
-		return errors.Wrap(err, "initializing rpc server")
+		return connectResult{connected: time.Since(connectedAt), err: errors.Wrap(err, "initializing rpc server")}
 	}
 	rpcserver.ServeConn(ws)
 	a.logger.Log("disconnected", true)
-	return nil
+	return connectResult{connected: time.Since(connectedAt)}
+}
+
+func (a *websocketUpstream) setWebsocket(ws websocket.Websocket) {
+	a.mu.Lock()
+	a.ws = ws
+	a.mu.Unlock()
 }
 
-func (a *Upstream) setConnectionDuration(duration float64) {
+func (a *websocketUpstream) setConnectionDuration(duration float64) {
 	connectionDuration.With("target", a.endpoint).Set(duration)
 }
 
-func (a *Upstream) LogEvent(event event.Event) error {
-	return a.apiClient.LogEvent(context.TODO(), event)
+func (a *websocketUpstream) LogEvent(event event.Event) error {
+	return a.logEvent(context.TODO(), event)
 }
 
 // Close closes the connection to the service
-func (a *Upstream) Close() error {
+func (a *websocketUpstream) Close() error {
 	close(a.quit)
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	if a.ws == nil {
 		return nil
 	}
@@ -1,7 +1,20 @@
 package daemon
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/http/websocket"
+	"github.com/weaveworks/flux/remote"
+	"github.com/weaveworks/flux/remote/rpc"
 )
 
 func TestEndpointInference(t *testing.T) {
@@ -37,3 +50,93 @@ func TestUnsupportedEndpoint(t *testing.T) {
 		t.Error("Expected err, got nil")
 	}
 }
+
+func TestParseWebsocketConfig(t *testing.T) {
+	config, err := ParseWebsocketConfig("wss://flux.example.com/connect", "https://flux.example.com/events", []string{"Authorization: Bearer s3cr3t", "X-Cluster: prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, "wss://flux.example.com/connect", config.URL.String())
+	assertEquals(t, "https://flux.example.com/events", config.EventsURL.String())
+	assertEquals(t, "Bearer s3cr3t", config.Header.Get("Authorization"))
+	assertEquals(t, "prod", config.Header.Get("X-Cluster"))
+
+	if _, err := ParseWebsocketConfig("wss://flux.example.com/connect", "", []string{"no colon"}); err == nil {
+		t.Error("expected an error for a header without a value")
+	}
+}
+
+// A self-hosted service is connected to at the URL given, with the
+// headers given, and can call the daemon's API over the connection.
+func TestWebsocketUpstream(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	events := make(chan event.Event, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connect", func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		ws, err := websocket.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer ws.Close()
+		if err := rpc.NewClientV10(ws).Ping(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		var ev event.Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		events <- ev
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/connect"
+	config, err := ParseWebsocketConfig(wsURL, server.URL+"/events", []string{"Authorization: Bearer s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream, err := NewWebsocketUpstream(&http.Client{Timeout: 5 * time.Second}, "fluxd/test", config, &remote.MockServer{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+
+	select {
+	case h := <-headers:
+		assertEquals(t, "Bearer s3cr3t", h.Get("Authorization"))
+		assertEquals(t, "fluxd/test", h.Get("User-Agent"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the daemon to connect")
+	}
+
+	if err := upstream.LogEvent(event.Event{Type: event.EventSync, Metadata: &event.SyncEventMetadata{}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != event.EventSync {
+			t.Errorf("expected a sync event, got %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event to be posted")
+	}
+
+	if _, err := NewWebsocketUpstream(http.DefaultClient, "fluxd/test", WebsocketConfig{URL: config.EventsURL}, &remote.MockServer{}, log.NewNopLogger()); err == nil {
+		t.Error("expected an error for a URL that isn't a websocket URL")
+	}
+}
+
+func TestReconnectWait(t *testing.T) {
+	for _, backoff := range []time.Duration{minReconnectBackoff, maxReconnectBackoff} {
+		for i := 0; i < 1000; i++ {
+			wait := reconnectWait(backoff)
+			if wait < backoff/2 || wait > backoff {
+				t.Fatalf("expected a wait between %s and %s, got %s", backoff/2, backoff, wait)
+			}
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package daemon
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/flux/api/v9"
+	transport "github.com/weaveworks/flux/http"
+)
+
+// The git hosting providers we know how to receive push webhooks
+// from. `generic` is for anything else that can be persuaded to send
+// a JSON body with a `ref` or `branch` field, and sign it.
+const (
+	WebhookGitHub    = "github"
+	WebhookGitLab    = "gitlab"
+	WebhookBitbucket = "bitbucket"
+	WebhookGeneric   = "generic"
+)
+
+// The largest payload accepted; GitHub caps its payloads at 25MB, and
+// nothing else sends more.
+const maxWebhookPayload = 25 << 20
+
+var (
+	errWebhookSignature = errors.New("webhook signature missing or invalid")
+	errWebhookPayload   = errors.New("webhook payload could not be parsed")
+)
+
+// ChangeNotifier is the part of the daemon API a webhook receiver
+// needs to tell the daemon there's something new in git.
+type ChangeNotifier interface {
+	NotifyChange(context.Context, v9.Change) error
+}
+
+// WebhookReceiver accepts push notifications from git hosting
+// providers, and passes them on to the daemon as git changes, so that
+// it will fetch from upstream (and therefore sync) straight away
+// rather than waiting for the next poll. It likewise accepts push
+// notifications from image registries, which become image changes.
+type WebhookReceiver struct {
+	notifier ChangeNotifier
+	secret   []byte
+	url      string
+	branch   string
+	logger   log.Logger
+}
+
+// NewWebhookReceiver constructs a receiver which will notify about
+// changes to the repo URL and branch given. If secret is empty,
+// requests will not be authenticated.
+func NewWebhookReceiver(notifier ChangeNotifier, secret []byte, url, branch string, logger log.Logger) *WebhookReceiver {
+	return &WebhookReceiver{
+		notifier: notifier,
+		secret:   secret,
+		url:      url,
+		branch:   branch,
+		logger:   logger,
+	}
+}
+
+// Handler returns an http.Handler serving a path per provider,
+// e.g., `/hook/github`, and per image registry, e.g.,
+// `/hook/registry/dockerhub`.
+func (wh *WebhookReceiver) Handler() http.Handler {
+	r := mux.NewRouter()
+	for _, provider := range []string{WebhookGitHub, WebhookGitLab, WebhookBitbucket, WebhookGeneric} {
+		r.NewRoute().Name("Webhook:" + provider).Methods("POST").Path("/hook/" + provider).Handler(wh.handle(provider))
+	}
+	for _, provider := range registryWebhookProviders {
+		r.NewRoute().Name("RegistryWebhook:" + provider).Methods("POST").Path("/hook/registry/" + provider).Handler(wh.handleRegistry(provider))
+	}
+	return r
+}
+
+// readPayload reads the request body, up to the maximum size
+// accepted, and writes an error response if it can't.
+func readPayload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		status := http.StatusBadRequest
+		if len(body) >= maxWebhookPayload {
+			status = http.StatusRequestEntityTooLarge
+		}
+		transport.WriteError(w, r, status, err)
+		return nil, false
+	}
+	return body, true
+}
+
+func (wh *WebhookReceiver) handle(provider string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readPayload(w, r)
+		if !ok {
+			return
+		}
+		if !wh.authenticate(provider, r, body) {
+			wh.logger.Log("provider", provider, "err", errWebhookSignature)
+			transport.WriteError(w, r, http.StatusUnauthorized, errWebhookSignature)
+			return
+		}
+
+		push, branch, err := parseWebhook(provider, r.Header, body)
+		if err != nil {
+			wh.logger.Log("provider", provider, "err", err)
+			transport.WriteError(w, r, http.StatusBadRequest, errWebhookPayload)
+			return
+		}
+		if !push {
+			// e.g., GitHub's ping event, or some other event we
+			// don't care about; acknowledge it so the provider
+			// doesn't report the hook as broken.
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if branch != "" && branch != wh.branch {
+			wh.logger.Log("provider", provider, "msg", "ignoring push to unrelated branch", "branch", branch)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		change := v9.Change{
+			Kind:   v9.GitChange,
+			Source: v9.GitUpdate{URL: wh.url, Branch: wh.branch},
+		}
+		if err := wh.notifier.NotifyChange(r.Context(), change); err != nil {
+			transport.ErrorResponse(w, r, err)
+			return
+		}
+		wh.logger.Log("provider", provider, "msg", "notified of push", "branch", wh.branch)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// authenticate checks the request against the shared secret, in
+// whichever way the provider does it.
+func (wh *WebhookReceiver) authenticate(provider string, r *http.Request, body []byte) bool {
+	if len(wh.secret) == 0 {
+		return true
+	}
+	switch provider {
+	case WebhookGitLab:
+		// GitLab just sends the secret back as a header
+		return hmac.Equal([]byte(r.Header.Get("X-Gitlab-Token")), wh.secret)
+	case WebhookGitHub, WebhookBitbucket:
+		// Bitbucket Server uses the same scheme as GitHub
+		if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+			return validSignature(sig, body, wh.secret)
+		}
+		return validSignature(r.Header.Get("X-Hub-Signature"), body, wh.secret)
+	default:
+		return validSignature(r.Header.Get("X-Signature"), body, wh.secret)
+	}
+}
+
+// validSignature checks a signature of the form `<algo>=<hex HMAC>`,
+// as sent by GitHub and others.
+func validSignature(sig string, body, secret []byte) bool {
+	parts := strings.SplitN(sig, "=", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	var h func() hash.Hash
+	switch parts[0] {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	default:
+		return false
+	}
+	got, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(h, secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// parseWebhook figures out whether the webhook is about a push, and
+// if so, the branch pushed to (if it can be determined).
+func parseWebhook(provider string, header http.Header, body []byte) (push bool, branch string, err error) {
+	switch provider {
+	case WebhookGitHub:
+		if event := header.Get("X-GitHub-Event"); event != "push" {
+			return false, "", nil
+		}
+		var payload struct {
+			Ref string `json:"ref"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return false, "", err
+		}
+		return true, branchFromRef(payload.Ref), nil
+
+	case WebhookGitLab:
+		if event := header.Get("X-Gitlab-Event"); event != "Push Hook" {
+			return false, "", nil
+		}
+		var payload struct {
+			Ref string `json:"ref"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return false, "", err
+		}
+		return true, branchFromRef(payload.Ref), nil
+
+	case WebhookBitbucket:
+		var payload struct {
+			// Bitbucket Cloud
+			Push struct {
+				Changes []struct {
+					New struct {
+						Type string `json:"type"`
+						Name string `json:"name"`
+					} `json:"new"`
+				} `json:"changes"`
+			} `json:"push"`
+			// Bitbucket Server
+			Changes []struct {
+				Ref struct {
+					ID string `json:"id"`
+				} `json:"ref"`
+			} `json:"changes"`
+		}
+		switch event := header.Get("X-Event-Key"); event {
+		case "repo:push", "repo:refs_changed":
+		default:
+			return false, "", nil
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return false, "", err
+		}
+		// A push can include more than one branch; if there's
+		// only one, we can filter on it, otherwise just say
+		// something happened.
+		var branches []string
+		for _, c := range payload.Push.Changes {
+			if c.New.Type == "branch" {
+				branches = append(branches, c.New.Name)
+			}
+		}
+		for _, c := range payload.Changes {
+			if b := branchFromRef(c.Ref.ID); b != "" {
+				branches = append(branches, b)
+			}
+		}
+		if len(branches) == 1 {
+			return true, branches[0], nil
+		}
+		return true, "", nil
+
+	case WebhookGeneric:
+		var payload struct {
+			Ref    string `json:"ref"`
+			Branch string `json:"branch"`
+		}
+		if len(body) == 0 {
+			return true, "", nil
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return false, "", err
+		}
+		if payload.Branch != "" {
+			return true, payload.Branch, nil
+		}
+		return true, branchFromRef(payload.Ref), nil
+	}
+	return false, "", fmt.Errorf("unknown webhook provider %q", provider)
+}
+
+// branchFromRef returns the branch name for a ref like
+// `refs/heads/master`, or the empty string if it's not a branch.
+func branchFromRef(ref string) string {
+	const prefix = "refs/heads/"
+	if strings.HasPrefix(ref, prefix) {
+		return strings.TrimPrefix(ref, prefix)
+	}
+	return ""
+}
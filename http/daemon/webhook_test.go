@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/api/v9"
+)
+
+type recordingNotifier struct {
+	changes []v9.Change
+}
+
+func (n *recordingNotifier) NotifyChange(_ context.Context, c v9.Change) error {
+	n.changes = append(n.changes, c)
+	return nil
+}
+
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(body)
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookGitHubPush(t *testing.T) {
+	secret := []byte("s3cr3t")
+	n := &recordingNotifier{}
+	wh := NewWebhookReceiver(n, secret, "git@example.com:org/repo", "master", log.NewNopLogger())
+	h := wh.Handler()
+
+	for _, c := range []struct {
+		branch    string
+		signature string
+		code      int
+		notified  int
+	}{
+		{"master", "", http.StatusUnauthorized, 0},
+		{"master", "sha1=deadbeef", http.StatusUnauthorized, 0},
+		{"other", "valid", http.StatusNoContent, 0},
+		{"master", "valid", http.StatusAccepted, 1},
+	} {
+		body := []byte(`{"ref":"refs/heads/` + c.branch + `"}`)
+		req := httptest.NewRequest("POST", "/hook/github", bytes.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "push")
+		sig := c.signature
+		if sig == "valid" {
+			sig = sign(secret, body)
+		}
+		if sig != "" {
+			req.Header.Set("X-Hub-Signature", sig)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.code {
+			t.Errorf("branch %q, signature %q: expected status %d, got %d", c.branch, c.signature, c.code, rec.Code)
+		}
+		if len(n.changes) != c.notified {
+			t.Errorf("branch %q, signature %q: expected %d notifications, got %d", c.branch, c.signature, c.notified, len(n.changes))
+		}
+		n.changes = nil
+	}
+}
+
+func TestWebhookGitLabToken(t *testing.T) {
+	n := &recordingNotifier{}
+	wh := NewWebhookReceiver(n, []byte("s3cr3t"), "git@example.com:org/repo", "master", log.NewNopLogger())
+	h := wh.Handler()
+
+	body := []byte(`{"ref":"refs/heads/master"}`)
+	req := httptest.NewRequest("POST", "/hook/gitlab", bytes.NewReader(body))
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Token", "s3cr3t")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+	if len(n.changes) != 1 {
+		t.Fatalf("expected one notification, got %d", len(n.changes))
+	}
+	update := n.changes[0].Source.(v9.GitUpdate)
+	if update.Branch != "master" || update.URL != "git@example.com:org/repo" {
+		t.Errorf("unexpected git update %+v", update)
+	}
+}
+
+func TestParseWebhookBitbucket(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Event-Key", "repo:push")
+	push, branch, err := parseWebhook(WebhookBitbucket, header, []byte(`{"push":{"changes":[{"new":{"type":"branch","name":"dev"}}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !push || branch != "dev" {
+		t.Errorf("expected push to dev, got push=%v branch=%q", push, branch)
+	}
+
+	header.Set("X-Event-Key", "repo:refs_changed")
+	push, branch, err = parseWebhook(WebhookBitbucket, header, []byte(`{"changes":[{"ref":{"id":"refs/heads/master"}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !push || branch != "master" {
+		t.Errorf("expected push to master, got push=%v branch=%q", push, branch)
+	}
+}
@@ -34,6 +34,11 @@ make sure you supply a service token, either by setting the
 environment variable FLUX_SERVICE_TOKEN, or using the argument --token
 with fluxctl.
 
+If the daemon's API is secured with its own tokens, supply one by
+setting the environment variable FLUX_AUTH_TOKEN, or using the
+argument --auth-token; if it requires a client certificate, supply
+one with --tls-cert and --tls-key.
+
 `,
 	Err: errors.New("request failed authentication"),
 }
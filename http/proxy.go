@@ -0,0 +1,68 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// The environment variables that say which proxy to use, and which
+// hosts not to use it for; Go's HTTP clients and git (by way of
+// libcurl) both look at these.
+var (
+	proxyEnv   = []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"}
+	noProxyEnv = []string{"NO_PROXY", "no_proxy"}
+)
+
+// ConfigureProxy makes the HTTP and HTTPS requests from this process,
+// including those git makes, go through the proxy at the URL given,
+// by setting the usual proxy environment variables. Hosts listed in
+// NO_PROXY are still reached directly, as are the Kubernetes API
+// server, if we're running in a cluster, and any hosts given. Go
+// reads the environment for proxies only once, so this must be called
+// before any requests are made.
+func ConfigureProxy(proxyURL string, direct ...string) error {
+	if proxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%q is not the URL of a proxy; expected e.g., http://proxy.example.com:3128", proxyURL)
+	}
+	for _, k := range proxyEnv {
+		os.Setenv(k, proxyURL)
+	}
+
+	// The API server is in the cluster, and almost certainly not
+	// reachable through a proxy outside it.
+	direct = append([]string{os.Getenv("KUBERNETES_SERVICE_HOST")}, direct...)
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	for _, host := range direct {
+		if host == "" || containsHost(noProxy, host) {
+			continue
+		}
+		if noProxy != "" {
+			noProxy += ","
+		}
+		noProxy += host
+	}
+	if noProxy != "" {
+		for _, k := range noProxyEnv {
+			os.Setenv(k, noProxy)
+		}
+	}
+	return nil
+}
+
+func containsHost(noProxy, host string) bool {
+	for _, h := range strings.Split(noProxy, ",") {
+		if strings.TrimSpace(h) == host {
+			return true
+		}
+	}
+	return false
+}
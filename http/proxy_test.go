@@ -0,0 +1,64 @@
+package http
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfigureProxy(t *testing.T) {
+	vars := append(append([]string{"KUBERNETES_SERVICE_HOST"}, proxyEnv...), noProxyEnv...)
+	saved := map[string]string{}
+	for _, k := range vars {
+		if v, ok := os.LookupEnv(k); ok {
+			saved[k] = v
+		}
+		os.Unsetenv(k)
+	}
+	defer func() {
+		for _, k := range vars {
+			if v, ok := saved[k]; ok {
+				os.Setenv(k, v)
+			} else {
+				os.Unsetenv(k)
+			}
+		}
+	}()
+
+	if err := ConfigureProxy(""); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := os.LookupEnv("HTTPS_PROXY"); ok {
+		t.Errorf("did not expect HTTPS_PROXY to be set, got %q", v)
+	}
+
+	for _, bad := range []string{"proxy.example.com:3128", "://nope"} {
+		if err := ConfigureProxy(bad); err == nil {
+			t.Errorf("expected an error for proxy URL %q", bad)
+		}
+	}
+
+	os.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	os.Setenv("no_proxy", "internal.example.com")
+	const proxy = "http://proxy.example.com:3128"
+	if err := ConfigureProxy(proxy, "10.0.0.7"); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range proxyEnv {
+		if got := os.Getenv(k); got != proxy {
+			t.Errorf("expected %s=%q, got %q", k, proxy, got)
+		}
+	}
+	for _, k := range noProxyEnv {
+		if got := os.Getenv(k); got != "internal.example.com,10.96.0.1,10.0.0.7" {
+			t.Errorf("expected %s to exempt the API server and Tiller, got %q", k, got)
+		}
+	}
+
+	// Doing it again doesn't add the hosts twice
+	if err := ConfigureProxy(proxy, "10.0.0.7"); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("NO_PROXY"); got != "internal.example.com,10.96.0.1,10.0.0.7" {
+		t.Errorf("expected each host to be exempted once, got %q", got)
+	}
+}
@@ -1,14 +1,23 @@
 package http
 
 const (
-	ListServices          = "ListServices"
-	ListImages            = "ListImages"
-	ListImagesWithOptions = "ListImagesWithOptions"
-	UpdateManifests       = "UpdateManifests"
-	JobStatus             = "JobStatus"
-	SyncStatus            = "SyncStatus"
-	Export                = "Export"
-	GitRepoConfig         = "GitRepoConfig"
+	Versions                = "Versions"
+	ListServices            = "ListServices"
+	ListServicesWithOptions = "ListServicesWithOptions"
+	ListImages              = "ListImages"
+	ListImagesWithOptions   = "ListImagesWithOptions"
+	UpdateManifests         = "UpdateManifests"
+	JobStatus               = "JobStatus"
+	SyncStatus              = "SyncStatus"
+	Export                  = "Export"
+	GitRepoConfig           = "GitRepoConfig"
+	DaemonStatus            = "DaemonStatus"
+	AuditEvents             = "AuditEvents"
+	AuditEventsStream       = "AuditEventsStream"
+	Graph                   = "Graph"
+	Diff                    = "Diff"
+	PendingReleases         = "PendingReleases"
+	ApproveRelease          = "ApproveRelease"
 
 	UpdateImages           = "UpdateImages"
 	UpdatePolicies         = "UpdatePolicies"
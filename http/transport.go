@@ -29,7 +29,9 @@ func DeprecateVersions(r *mux.Router, versions ...string) {
 func NewAPIRouter() *mux.Router {
 	r := mux.NewRouter()
 
+	r.NewRoute().Name(Versions).Methods("GET").Path("/")
 	r.NewRoute().Name(ListServices).Methods("GET").Path("/v6/services")
+	r.NewRoute().Name(ListServicesWithOptions).Methods("GET").Path("/v10/services")
 	r.NewRoute().Name(ListImages).Methods("GET").Path("/v6/images")
 	r.NewRoute().Name(ListImagesWithOptions).Methods("GET").Path("/v10/images")
 
@@ -38,6 +40,13 @@ func NewAPIRouter() *mux.Router {
 	r.NewRoute().Name(SyncStatus).Methods("GET").Path("/v6/sync").Queries("ref", "{ref}")
 	r.NewRoute().Name(Export).Methods("HEAD", "GET").Path("/v6/export")
 	r.NewRoute().Name(GitRepoConfig).Methods("POST").Path("/v9/git-repo-config")
+	r.NewRoute().Name(DaemonStatus).Methods("GET").Path("/v10/status")
+	r.NewRoute().Name(AuditEvents).Methods("GET").Path("/v10/events")
+	r.NewRoute().Name(AuditEventsStream).Methods("GET").Path("/v10/events/stream")
+	r.NewRoute().Name(Graph).Methods("GET").Path("/v10/graph")
+	r.NewRoute().Name(Diff).Methods("GET").Path("/v10/diff")
+	r.NewRoute().Name(PendingReleases).Methods("GET").Path("/v10/pending")
+	r.NewRoute().Name(ApproveRelease).Methods("POST").Path("/v10/pending/approve").Queries("id", "{id}")
 
 	// These routes persist to support requests from older fluxctls. In general we
 	// should avoid adding references to them so that they can eventually be removed.
@@ -153,6 +162,8 @@ func ErrorResponse(w http.ResponseWriter, r *http.Request, apiError error) {
 		code = http.StatusNotFound
 	case fluxerr.User:
 		code = http.StatusUnprocessableEntity
+	case fluxerr.Forbidden:
+		code = http.StatusForbidden
 	case fluxerr.Server:
 		code = http.StatusInternalServerError
 	default:
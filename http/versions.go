@@ -0,0 +1,82 @@
+package http
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// APIVersions is what a server says about the API it serves, at the
+// root of the API (e.g., `/api/flux/`), so that clients can tell
+// what they can ask of it before asking.
+type APIVersions struct {
+	// The versions of the API with endpoints served, oldest first,
+	// e.g., "v6"
+	Versions []string `json:"versions"`
+	// The names of the endpoints served, as in this package, e.g.,
+	// "ListServicesWithOptions"
+	Endpoints []string `json:"endpoints"`
+}
+
+// LegacyAPI is what's assumed of servers that don't say what they
+// serve: the endpoints daemons served before they did.
+var LegacyAPI = APIVersions{
+	Versions: []string{"v6", "v9", "v10"},
+	Endpoints: []string{
+		ListServices,
+		ListImages,
+		ListImagesWithOptions,
+		UpdateManifests,
+		JobStatus,
+		SyncStatus,
+		Export,
+		GitRepoConfig,
+		UpdateImages,
+		UpdatePolicies,
+		GetPublicSSHKey,
+		RegeneratePublicSSHKey,
+	},
+}
+
+// Supports reports whether the endpoint named is served.
+func (v APIVersions) Supports(endpoint string) bool {
+	for _, e := range v.Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+var versionRegexp = regexp.MustCompile(`^/(v([0-9]+))/`)
+
+// ServedAPI gives the versions and endpoints served by a router: the
+// routes of the API with handlers. Deprecated versions, which are
+// served only to say so, are left out.
+func ServedAPI(router *mux.Router) APIVersions {
+	api := APIVersions{Versions: []string{}, Endpoints: []string{}}
+	versions := map[string]int{}
+	NewAPIRouter().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		name := route.GetName()
+		if served := router.Get(name); served == nil || served.GetHandler() == nil {
+			return nil
+		}
+		api.Endpoints = append(api.Endpoints, name)
+		if path, err := route.GetPathTemplate(); err == nil {
+			if m := versionRegexp.FindStringSubmatch(path); m != nil {
+				versions[m[1]], _ = strconv.Atoi(m[2])
+			}
+		}
+		return nil
+	})
+	for v := range versions {
+		api.Versions = append(api.Versions, v)
+	}
+	sort.Slice(api.Versions, func(i, j int) bool {
+		return versions[api.Versions[i]] < versions[api.Versions[j]]
+	})
+	sort.Strings(api.Endpoints)
+	return api
+}
@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -38,8 +39,14 @@ func Dial(client *http.Client, ua string, token client.Token, u *url.URL) (Webso
 	// Add authentication if provided
 	token.Set(req)
 
+	return DialWithHeader(client, req.Header, u)
+}
+
+// DialWithHeader initiates a new websocket connection, sending the
+// headers given (e.g., for authentication) with the request.
+func DialWithHeader(client *http.Client, header http.Header, u *url.URL) (Websocket, error) {
 	// Use http client to do the http request
-	conn, resp, err := dialer(client).Dial(u.String(), req.Header)
+	conn, resp, err := dialer(client).Dial(u.String(), header)
 	if err != nil {
 		if resp != nil {
 			err = &DialErr{u, resp}
@@ -52,13 +59,19 @@ func Dial(client *http.Client, ua string, token client.Token, u *url.URL) (Webso
 }
 
 func dialer(client *http.Client) *websocket.Dialer {
+	// Use the TLS configuration of the client's transport, if it has
+	// one, e.g., to trust a self-hosted service's CA
+	var tlsConfig *tls.Config
+	if t, ok := client.Transport.(*http.Transport); ok {
+		tlsConfig = t.TLSClientConfig
+	}
 	return &websocket.Dialer{
 		NetDial: func(network, addr string) (net.Conn, error) {
 			return net.DialTimeout(network, addr, client.Timeout)
 		},
 		HandshakeTimeout: client.Timeout,
 		Jar:              client.Jar,
-		// TODO: TLSClientConfig: client.TLSClientConfig,
-		// TODO: Proxy
+		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  tlsConfig,
 	}
 }
@@ -102,16 +102,20 @@ func (i Name) ToRef(tag string) Ref {
 
 // Ref represents a versioned (i.e., tagged) image. The tag is
 // allowed to be empty, though it is in general undefined what that
-// means. As such, `Ref` also includes all `Name` values.
+// means. As such, `Ref` also includes all `Name` values. A ref may
+// also be pinned to a digest, in which case that's what is used to
+// pull the image, and the tag is for the benefit of people reading.
 //
 // Examples (stringified):
 //  * alpine:3.5
 //  * library/alpine:3.5
 //  * quay.io/weaveworks/flux:1.1.0
 //  * localhost:5000/arbitrary/path/to/repo:revision-sha1
+//  * quay.io/weaveworks/flux:1.1.0@sha256:6d6d(...)
 type Ref struct {
 	Name
-	Tag string
+	Tag    string
+	Digest string
 }
 
 // CanonicalRef is an image ref with none of the fields left to be
@@ -126,9 +130,23 @@ func (i Ref) String() string {
 	if i.Tag != "" {
 		tag = ":" + i.Tag
 	}
+	if i.Digest != "" {
+		tag += "@" + i.Digest
+	}
 	return fmt.Sprintf("%s%s", i.Name.String(), tag)
 }
 
+// TagWithDigest returns the tag, followed by the digest if there is
+// one, e.g., `1.0@sha256:6d6d(...)`; i.e., what comes after the name
+// in String(). This is what to use where the tag is given separately
+// from the name.
+func (i Ref) TagWithDigest() string {
+	if i.Digest != "" {
+		return i.Tag + "@" + i.Digest
+	}
+	return i.Tag
+}
+
 // ParseRef parses a string representation of an image id into an
 // Ref value. The grammar is shown here:
 // https://github.com/docker/distribution/blob/master/reference/reference.go
@@ -141,6 +159,13 @@ func ParseRef(s string) (Ref, error) {
 	if strings.HasPrefix(s, "/") || strings.HasSuffix(s, "/") {
 		return id, ErrMalformedImageID
 	}
+	if at := strings.LastIndex(s, "@"); at >= 0 {
+		if !digestRegexp.MatchString(s[at+1:]) {
+			return id, ErrMalformedImageID
+		}
+		id.Digest = s[at+1:]
+		s = s[:at]
+	}
 
 	elements := strings.Split(s, "/")
 	switch len(elements) {
@@ -182,6 +207,9 @@ var (
 	domainComponent = `([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
 	domain          = fmt.Sprintf(`localhost|(%s([.]%s)+)(:[0-9]+)?`, domainComponent, domainComponent)
 	domainRegexp    = regexp.MustCompile(domain)
+	// e.g., sha256:6d6d(...); see
+	// https://github.com/opencontainers/image-spec/blob/master/descriptor.md#digests
+	digestRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[+._-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
 )
 
 // ImageID is serialized/deserialized as a string
@@ -205,8 +233,9 @@ func (i Ref) CanonicalRef() CanonicalRef {
 	name := i.CanonicalName()
 	return CanonicalRef{
 		Ref: Ref{
-			Name: name.Name,
-			Tag:  i.Tag,
+			Name:   name.Name,
+			Tag:    i.Tag,
+			Digest: i.Digest,
 		},
 	}
 }
@@ -215,11 +244,21 @@ func (i Ref) Components() (domain, repo, tag string) {
 	return i.Domain, i.Image, i.Tag
 }
 
-// WithNewTag makes a new copy of an ImageID with a new tag
+// WithNewTag makes a new copy of an ImageID with a new tag. Since
+// any digest would have been for the old tag, it is dropped.
 func (i Ref) WithNewTag(t string) Ref {
 	var img Ref
 	img = i
 	img.Tag = t
+	img.Digest = ""
+	return img
+}
+
+// WithDigest makes a new copy of an ImageID pinned to the digest
+// given, or if it's empty, not pinned.
+func (i Ref) WithDigest(d string) Ref {
+	img := i
+	img.Digest = d
 	return img
 }
 
@@ -237,22 +276,67 @@ type Info struct {
 	ImageID string `json:",omitempty"`
 	// the time at which the image pointed at was created
 	CreatedAt time.Time `json:",omitempty"`
+	// for a multi-platform image, the digest of the image for each
+	// platform (given as e.g., `linux/arm64/v8`)
+	PlatformDigests map[string]string `json:",omitempty"`
+	// where the image was built from, if its labels say
+	Labels Labels
+}
+
+// The labels, from an image's config, that say where the image was
+// built from: those from the OCI image spec, and their predecessors
+// from label-schema.org.
+const (
+	LabelRevision       = "org.opencontainers.image.revision"
+	LabelSource         = "org.opencontainers.image.source"
+	LabelSchemaRevision = "org.label-schema.vcs-ref"
+	LabelSchemaSource   = "org.label-schema.vcs-url"
+)
+
+// Labels gives the source code repository and revision an image was
+// built from, as far as its labels say.
+type Labels struct {
+	Revision string `json:",omitempty"`
+	Source   string `json:",omitempty"`
+}
+
+// LabelsFrom picks out the labels saying where an image was built
+// from, from all those in its config. The OCI labels take precedence
+// over the label-schema.org ones.
+func LabelsFrom(labels map[string]string) Labels {
+	pick := func(keys ...string) string {
+		for _, k := range keys {
+			if v := labels[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	return Labels{
+		Revision: pick(LabelRevision, LabelSchemaRevision),
+		Source:   pick(LabelSource, LabelSchemaSource),
+	}
 }
 
 // MarshalJSON returns the Info value in JSON (as bytes). It is
 // implemented so that we can omit the `CreatedAt` value when it's
 // zero, which would otherwise be tricky for e.g., JavaScript to
-// detect.
+// detect; and the `Labels`, when there aren't any.
 func (im Info) MarshalJSON() ([]byte, error) {
 	type InfoAlias Info // alias to shed existing MarshalJSON implementation
 	var t string
 	if !im.CreatedAt.IsZero() {
 		t = im.CreatedAt.UTC().Format(time.RFC3339Nano)
 	}
+	var labels *Labels
+	if im.Labels != (Labels{}) {
+		labels = &im.Labels
+	}
 	encode := struct {
 		InfoAlias
-		CreatedAt string `json:",omitempty"`
-	}{InfoAlias(im), t}
+		CreatedAt string  `json:",omitempty"`
+		Labels    *Labels `json:",omitempty"`
+	}{InfoAlias(im), t, labels}
 	return json.Marshal(encode)
 }
 
@@ -262,10 +346,14 @@ func (im *Info) UnmarshalJSON(b []byte) error {
 	type InfoAlias Info
 	unencode := struct {
 		InfoAlias
-		CreatedAt string `json:",omitempty"`
+		CreatedAt string  `json:",omitempty"`
+		Labels    *Labels `json:",omitempty"`
 	}{}
 	json.Unmarshal(b, &unencode)
 	*im = Info(unencode.InfoAlias)
+	if unencode.Labels != nil {
+		im.Labels = *unencode.Labels
+	}
 	if unencode.CreatedAt == "" {
 		im.CreatedAt = time.Time{}
 	} else {
@@ -30,6 +30,8 @@ func TestDomainRegexp(t *testing.T) {
 	}
 }
 
+const testDigest = "6d6d0e8b8e9ba6fd8ae0c1f8a3e8fc2b9e8a3f8df4f1b8e4e9a6a9c0b8e4e9a6"
+
 func TestParseRef(t *testing.T) {
 	for _, x := range []struct {
 		test     string
@@ -53,6 +55,9 @@ func TestParseRef(t *testing.T) {
 		{"quay.io/library/alpine:latest", "quay.io", "library/alpine", "quay.io/library/alpine:latest"},
 		{"quay.io/library/alpine:mytag", "quay.io", "library/alpine", "quay.io/library/alpine:mytag"},
 		{"localhost:5000/path/to/repo/alpine:mytag", "localhost:5000", "path/to/repo/alpine", "localhost:5000/path/to/repo/alpine:mytag"},
+		// A ref can be pinned to a digest, with or without a tag
+		{"alpine@sha256:" + testDigest, dockerHubHost, "library/alpine", "index.docker.io/library/alpine@sha256:" + testDigest},
+		{"localhost:5000/hello:v1.1@sha256:" + testDigest, "localhost:5000", "hello", "localhost:5000/hello:v1.1@sha256:" + testDigest},
 	} {
 		i, err := ParseRef(x.test)
 		if err != nil {
@@ -81,6 +86,8 @@ func TestParseRefErrorCases(t *testing.T) {
 		{":tag"},
 		{"/leading/slash"},
 		{"trailing/slash/"},
+		{"alpine@"},
+		{"alpine:3.5@notadigest"},
 	} {
 		_, err := ParseRef(x.test)
 		if err == nil {
@@ -152,6 +159,7 @@ func TestImageInfoSerialisation(t *testing.T) {
 	info := mustMakeInfo("my/image:tag", t0)
 	info.Digest = "sha256:digest"
 	info.ImageID = "sha256:layerID"
+	info.Labels = Labels{Revision: "a1b2c3d", Source: "https://github.com/my/image"}
 	bytes, err := json.Marshal(info)
 	if err != nil {
 		t.Fatal(err)
@@ -179,6 +187,9 @@ func TestImageInfoCreatedAtZero(t *testing.T) {
 	if _, ok := info1["CreatedAt"]; ok {
 		t.Errorf("serialised Info included zero time field; expected it to be omitted\n%s", string(bytes))
 	}
+	if _, ok := info1["Labels"]; ok {
+		t.Errorf("serialised Info included empty labels; expected them to be omitted\n%s", string(bytes))
+	}
 }
 
 func TestImage_OrderByCreationDate(t *testing.T) {
@@ -234,6 +245,23 @@ func TestImage_OrderBySemverTagDesc(t *testing.T) {
 	assert.Equal(t, tags(expected), tags(imgs))
 }
 
+func TestImage_OrderBySemverPrerelease(t *testing.T) {
+	ti := time.Time{}
+	aa := mustMakeInfo("my/image:1.2.0-rc.1", ti)
+	bb := mustMakeInfo("my/image:1.2.0", ti)
+	cc := mustMakeInfo("my/image:1.1.9", ti)
+	dd := mustMakeInfo("my/image:1.2.0-beta.2", ti)
+	ee := mustMakeInfo("my/image:1.2.0-rc.10", ti)
+
+	imgs := []Info{aa, bb, cc, dd, ee}
+	Sort(imgs, NewerBySemver)
+
+	// A release is newer than its prereleases, which are ordered by
+	// their identifiers (numerically, where they are numbers)
+	expected := []Info{bb, ee, aa, dd, cc}
+	assert.Equal(t, tags(expected), tags(imgs))
+}
+
 func tags(imgs []Info) []string {
 	var vs []string
 	for _, i := range imgs {
@@ -249,3 +277,18 @@ func reverse(imgs []Info) {
 	}
 }
 
+func TestRefDigest(t *testing.T) {
+	ref, err := ParseRef("quay.io/weaveworks/flux:1.1.0@sha256:" + testDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Tag != "1.1.0" || ref.Digest != "sha256:"+testDigest {
+		t.Errorf("unexpected tag %q and digest %q", ref.Tag, ref.Digest)
+	}
+	if ref.TagWithDigest() != "1.1.0@sha256:"+testDigest {
+		t.Errorf("unexpected tag with digest %q", ref.TagWithDigest())
+	}
+	if newRef := ref.WithNewTag("1.2.0"); newRef.String() != "quay.io/weaveworks/flux:1.2.0" {
+		t.Errorf("expected digest to be dropped with new tag, got %q", newRef.String())
+	}
+}
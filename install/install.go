@@ -0,0 +1,90 @@
+// Package install generates the Kubernetes manifests needed to run
+// fluxd (and memcached) in a cluster, from a few parameters, so they
+// needn't be copied from deploy/ and edited by hand.
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultImage is the fluxd image used if none is given.
+const DefaultImage = "quay.io/weaveworks/flux:1.5.0"
+
+// TemplateParameters are the values filled in to the manifests.
+type TemplateParameters struct {
+	GitURL             string
+	GitBranch          string
+	GitPaths           []string
+	GitLabel           string
+	GitUser            string
+	GitEmail           string
+	Namespace          string
+	Image              string
+	AdditionalFluxArgs []string
+}
+
+// FillInTemplates returns the manifests for running fluxd, by file
+// name, with the parameters given filled in.
+func FillInTemplates(params TemplateParameters) (map[string][]byte, error) {
+	if params.GitURL == "" {
+		return nil, errors.New("no git URL given")
+	}
+	if params.GitBranch == "" {
+		params.GitBranch = "master"
+	}
+	if params.Namespace == "" {
+		params.Namespace = "default"
+	}
+	if params.Image == "" {
+		params.Image = DefaultImage
+	}
+
+	result := map[string][]byte{}
+	for name, text := range templates {
+		tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{"quote": quote}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template %s: %s", name, err)
+		}
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, params); err != nil {
+			return nil, fmt.Errorf("filling in template %s: %s", name, err)
+		}
+		result[name] = buf.Bytes()
+	}
+	return result, nil
+}
+
+// quote returns the string given as a YAML scalar, quoted if it
+// would otherwise be read as something other than that string.
+func quote(s string) (string, error) {
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	scalar := strings.TrimSuffix(string(out), "\n")
+	if !strings.Contains(scalar, "\n") {
+		return scalar, nil
+	}
+	// yaml.v2 uses a block scalar for multi-line strings, which
+	// can't go inline; JSON strings are also YAML scalars.
+	out, err = json.Marshal(s)
+	return string(out), err
+}
+
+// FileNames returns the names of the manifests in a stable order.
+func FileNames(manifests map[string][]byte) []string {
+	var names []string
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,105 @@
+package install
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestFillInTemplates(t *testing.T) {
+	manifests, err := FillInTemplates(TemplateParameters{
+		GitURL:    "git@github.com:weaveworks/flux-example",
+		GitBranch: "prod",
+		GitPaths:  []string{"namespaces", "workloads"},
+		Namespace: "flux",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != len(templates) {
+		t.Fatalf("expected %d manifests, got %d", len(templates), len(manifests))
+	}
+
+	for name, bytes := range manifests {
+		for _, doc := range strings.Split(string(bytes), "\n---\n") {
+			var obj struct {
+				Kind     string
+				Metadata struct {
+					Name      string
+					Namespace string
+				}
+			}
+			if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+				t.Errorf("%s: %s", name, err)
+				continue
+			}
+			if obj.Kind != "ClusterRole" && obj.Kind != "ClusterRoleBinding" && obj.Metadata.Namespace != "flux" {
+				t.Errorf("%s: expected %s %s to be in namespace flux, got %q", name, obj.Kind, obj.Metadata.Name, obj.Metadata.Namespace)
+			}
+		}
+	}
+
+	deployment := string(manifests["flux-deployment.yaml"])
+	for _, arg := range []string{
+		"- --git-url=git@github.com:weaveworks/flux-example\n",
+		"- --git-branch=prod\n",
+		"- --git-path=namespaces\n",
+		"- --git-path=workloads\n",
+		"image: " + DefaultImage + "\n",
+	} {
+		if !strings.Contains(deployment, arg) {
+			t.Errorf("expected deployment to contain %q:\n%s", arg, deployment)
+		}
+	}
+}
+
+func TestFillInTemplates_Quoting(t *testing.T) {
+	awkward := []string{
+		"a: b",
+		"a #b",
+		"{a}",
+		"[a]",
+		"&a",
+		"*a",
+		"!a",
+		`"a'`,
+		"a\nb",
+	}
+	params := TemplateParameters{
+		GitURL:             "git@github.com:weaveworks/flux-example",
+		GitUser:            "a: b",
+		GitEmail:           "me@example.com #flux",
+		AdditionalFluxArgs: awkward,
+	}
+	manifests, err := FillInTemplates(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deployment struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Args []string
+					}
+				}
+			}
+		}
+	}
+	if err := yaml.Unmarshal(manifests["flux-deployment.yaml"], &deployment); err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Join(deployment.Spec.Template.Spec.Containers[0].Args, "\n")
+	for _, arg := range append([]string{"--git-user=a: b", "--git-email=me@example.com #flux"}, awkward...) {
+		if !strings.Contains(args, arg) {
+			t.Errorf("expected args to include %q, got:\n%s", arg, args)
+		}
+	}
+}
+
+func TestFillInTemplates_NoGitURL(t *testing.T) {
+	if _, err := FillInTemplates(TemplateParameters{}); err == nil {
+		t.Error("expected an error when no git URL is given")
+	}
+}
@@ -0,0 +1,172 @@
+package install
+
+// The templates for the manifests, by file name. These follow the
+// examples in deploy/, with the parts that usually need editing
+// filled in from the parameters. Values are filled in with `quote`,
+// so that they can't change the structure of the YAML.
+var templates = map[string]string{
+	"flux-account.yaml": `---
+# The service account, cluster roles, and cluster role binding are
+# only needed for Kubernetes with role-based access control (RBAC).
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  labels:
+    name: flux
+  name: flux
+  namespace: {{ quote .Namespace }}
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRole
+metadata:
+  labels:
+    name: flux
+  name: flux
+rules:
+  - apiGroups: ['*']
+    resources: ['*']
+    verbs: ['*']
+  - nonResourceURLs: ['*']
+    verbs: ['*']
+---
+apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: ClusterRoleBinding
+metadata:
+  labels:
+    name: flux
+  name: flux
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: flux
+subjects:
+  - kind: ServiceAccount
+    name: flux
+    namespace: {{ quote .Namespace }}
+`,
+
+	"flux-deployment.yaml": `---
+apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: flux
+  namespace: {{ quote .Namespace }}
+spec:
+  replicas: 1
+  strategy:
+    type: Recreate
+  template:
+    metadata:
+      labels:
+        name: flux
+    spec:
+      serviceAccount: flux
+      volumes:
+      - name: git-key
+        secret:
+          secretName: flux-git-deploy
+          defaultMode: 0400 # when mounted read-only, we won't be able to chmod
+
+      # This is a tmpfs used for generating SSH keys. In K8s >= 1.10,
+      # mounted secrets are read-only, so we need a separate volume we
+      # can write to.
+      - name: git-keygen
+        emptyDir:
+          medium: Memory
+
+      containers:
+      - name: flux
+        image: {{ quote .Image }}
+        imagePullPolicy: IfNotPresent
+        ports:
+        - containerPort: 3030 # informational
+        readinessProbe:
+          httpGet:
+            path: /readyz
+            port: 3030
+          initialDelaySeconds: 5
+          periodSeconds: 10
+        volumeMounts:
+        - name: git-key
+          mountPath: /etc/fluxd/ssh # to match location given in image's /etc/ssh/config
+          readOnly: true # this will be the case perforce in K8s >=1.10
+        - name: git-keygen
+          mountPath: /var/fluxd/keygen # to match location given in image's /etc/ssh/config
+        args:
+        # this must be supplied, and be in the tmpfs (emptyDir)
+        # mounted above, for K8s >= 1.10
+        - --ssh-keygen-dir=/var/fluxd/keygen
+        - {{ printf "--memcached-hostname=memcached.%s.svc.cluster.local" .Namespace | quote }}
+        - {{ printf "--git-url=%s" .GitURL | quote }}
+        - {{ printf "--git-branch=%s" .GitBranch | quote }}
+{{- range .GitPaths }}
+        - {{ printf "--git-path=%s" . | quote }}
+{{- end }}
+{{- if .GitLabel }}
+        - {{ printf "--git-label=%s" .GitLabel | quote }}
+{{- end }}
+{{- if .GitUser }}
+        - {{ printf "--git-user=%s" .GitUser | quote }}
+{{- end }}
+{{- if .GitEmail }}
+        - {{ printf "--git-email=%s" .GitEmail | quote }}
+{{- end }}
+{{- range .AdditionalFluxArgs }}
+        - {{ quote . }}
+{{- end }}
+`,
+
+	"flux-secret.yaml": `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: flux-git-deploy
+  namespace: {{ quote .Namespace }}
+type: Opaque
+`,
+
+	"memcache-dep.yaml": `---
+# memcached is used by the Flux daemon to cache container image
+# metadata.
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: memcached
+  namespace: {{ quote .Namespace }}
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        name: memcached
+    spec:
+      containers:
+      - name: memcached
+        image: memcached:1.4.25
+        imagePullPolicy: IfNotPresent
+        args:
+        - -m 64    # Maximum memory to use, in megabytes. 64MB is default.
+        - -p 11211    # Default port, but being explicit is nice.
+        - -vv    # This gets us to the level of request logs.
+        ports:
+        - name: clients
+          containerPort: 11211
+`,
+
+	"memcache-svc.yaml": `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: memcached
+  namespace: {{ quote .Namespace }}
+spec:
+  # The memcache client uses DNS to get a list of memcached servers and then
+  # uses a consistent hash of the key to determine which server to pick.
+  clusterIP: None
+  ports:
+    - name: memcached
+      port: 11211
+  selector:
+    name: memcached
+`,
+}
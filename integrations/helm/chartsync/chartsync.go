@@ -38,9 +38,14 @@ package chartsync
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -48,6 +53,7 @@ import (
 	google_protobuf "github.com/golang/protobuf/ptypes/any"
 	"github.com/google/go-cmp/cmp"
 	"github.com/ncabatoff/go-seq/seq"
+	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
@@ -59,6 +65,8 @@ import (
 	ifclientset "github.com/weaveworks/flux/integrations/client/clientset/versioned"
 	helmop "github.com/weaveworks/flux/integrations/helm"
 	"github.com/weaveworks/flux/integrations/helm/release"
+	fhrstatus "github.com/weaveworks/flux/integrations/helm/status"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
 )
 
 type Polling struct {
@@ -79,12 +87,31 @@ type ChartChangeSync struct {
 	release    *release.Release
 	config     helmop.RepoConfig
 	logDiffs   bool
+	discover   bool
+	namespaces []string // if given, the only namespaces looked at
 
-	mu    sync.RWMutex
-	clone *git.Export
+	mu       sync.RWMutex
+	clone    *git.Export
+	revision string   // the revision the clone is of
+	charts   []string // the charts found in the clone, when discovering them
+
+	failuresMu sync.Mutex
+	failures   map[string]upgradeFailures // by release name
+}
+
+// upgradeFailures counts the failed attempts to upgrade a release to
+// the same chart and values, so those to be rolled back aren't tried
+// again and again.
+type upgradeFailures struct {
+	key   string
+	count int
 }
 
-func New(logger log.Logger, polling Polling, clients Clients, release *release.Release, config helmop.RepoConfig, logReleaseDiffs bool) *ChartChangeSync {
+// New makes a ChartChangeSync. If discoverCharts is true, it looks
+// for all the charts in the repo whenever it changes, and checks the
+// chart of every FluxHelmRelease against them. If namespaces are
+// given, only the FluxHelmReleases in those are looked at.
+func New(logger log.Logger, polling Polling, clients Clients, release *release.Release, config helmop.RepoConfig, logReleaseDiffs, discoverCharts bool, namespaces []string) *ChartChangeSync {
 	return &ChartChangeSync{
 		logger:     logger,
 		Polling:    polling,
@@ -93,6 +120,9 @@ func New(logger log.Logger, polling Polling, clients Clients, release *release.R
 		release:    release,
 		config:     config,
 		logDiffs:   logReleaseDiffs,
+		discover:   discoverCharts,
+		namespaces: namespaces,
+		failures:   map[string]upgradeFailures{},
 	}
 }
 
@@ -113,7 +143,8 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 		currentRevision, err := chs.config.Repo.Revision(ctx, chs.config.Branch)
 		if err == nil {
 			chs.mu.Lock()
-			chs.clone, err = chs.config.Repo.Export(ctx, currentRevision)
+			chs.clone, err = chs.export(ctx, currentRevision)
+			chs.revision = currentRevision
 			chs.mu.Unlock()
 		}
 		cancel()
@@ -121,6 +152,10 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 			errc <- err
 			return
 		}
+		if chs.discover {
+			chs.discoverCharts()
+		}
+		lastSyncTimestamp.Set(float64(time.Now().Unix()))
 		defer chs.clone.Clean()
 
 		ticker := time.NewTicker(chs.Polling.Interval)
@@ -139,11 +174,18 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 
 				if head == currentRevision {
 					chs.logger.Log("info", "no new commits on branch", "branch", chs.config.Branch, "head", head)
+					mirrorLagCommits.Set(0)
+					lastSyncTimestamp.Set(float64(time.Now().Unix()))
 					continue
 				}
 
 				ctx, cancel = context.WithTimeout(context.Background(), helmop.GitOperationTimeout)
-				newClone, err := chs.config.Repo.Export(ctx, head)
+				if commits, err := chs.config.Repo.CommitsBetween(ctx, currentRevision, head); err == nil {
+					mirrorLagCommits.Set(float64(len(commits)))
+				} else {
+					chs.logger.Log("warning", "unable to count commits since the revision in use", "revision", currentRevision, "head", head, "error", err)
+				}
+				newClone, err := chs.export(ctx, head)
 				cancel()
 				if err != nil {
 					chs.logger.Log("warning", "failure to clone git repo", "error", err)
@@ -152,14 +194,21 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 				chs.mu.Lock()
 				chs.clone.Clean()
 				chs.clone = newClone
+				chs.revision = head
 				chs.mu.Unlock()
 
+				if chs.discover {
+					chs.discoverCharts()
+				}
+
 				chs.logger.Log("info", fmt.Sprint("Start of chartsync"))
 				err = chs.applyChartChanges(currentRevision, head)
 				if err != nil {
 					chs.logger.Log("error", fmt.Sprintf("Failure to do chart sync: %s", err))
 				}
 				currentRevision = head
+				mirrorLagCommits.Set(0)
+				lastSyncTimestamp.Set(float64(time.Now().Unix()))
 				chs.logger.Log("info", fmt.Sprint("End of chartsync"))
 
 			case <-ticker.C:
@@ -180,6 +229,18 @@ func (chs *ChartChangeSync) Run(stopCh <-chan struct{}, errc chan error, wg *syn
 	}()
 }
 
+// export exports a revision from the git mirror, for reading charts
+// from.
+func (chs *ChartChangeSync) export(ctx context.Context, revision string) (_ *git.Export, err error) {
+	start := time.Now()
+	defer func() {
+		exportDuration.With(
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(start).Seconds())
+	}()
+	return chs.config.Repo.Export(ctx, revision)
+}
+
 // ReconcileReleaseDef asks the ChartChangeSync to examine the release
 // associated with a FluxHelmRelease, compared to what is in the git
 // repo, and install or upgrade the release if necessary. This may
@@ -220,11 +281,10 @@ func (chs *ChartChangeSync) applyChartChanges(prevRef, head string) error {
 		}
 		if changed {
 			rlsName := release.GetReleaseName(fhr)
-			opts := release.InstallOptions{DryRun: false}
 			chs.mu.RLock()
-			if _, err = chs.release.Install(chs.clone.Dir(), rlsName, fhr, release.UpgradeAction, opts); err != nil {
+			if chs.chartFound(chs.clone.Dir(), fhr) {
 				// NB in this step, failure to release is considered non-fatal, i.e,. we move on to the next rather than giving up entirely.
-				chs.logger.Log("warning", "failure to release chart with changes in git", "error", err, "chart", chartPath, "release", rlsName)
+				chs.upgrade(rlsName, fhr)
 			}
 			chs.mu.RUnlock()
 		}
@@ -248,6 +308,10 @@ func (chs *ChartChangeSync) reconcileReleaseDef(fhr ifv1.FluxHelmRelease) {
 	chs.mu.RLock()
 	defer chs.mu.RUnlock()
 
+	if !chs.chartFound(chs.clone.Dir(), fhr) {
+		return
+	}
+
 	opts := release.InstallOptions{DryRun: false}
 	if rel == nil {
 		_, err := chs.release.Install(chs.clone.Dir(), releaseName, fhr, release.InstallAction, opts)
@@ -263,11 +327,210 @@ func (chs *ChartChangeSync) reconcileReleaseDef(fhr ifv1.FluxHelmRelease) {
 		return
 	}
 	if changed {
-		_, err := chs.release.Install(chs.clone.Dir(), releaseName, fhr, release.UpgradeAction, opts)
+		chs.upgrade(releaseName, fhr)
+	}
+}
+
+// upgrade upgrades a release from the clone, which must be locked
+// for reading. If that fails, and the FluxHelmRelease asks for it,
+// the release is rolled back; and it's not upgraded to the same chart
+// and values again more than `maxRetries` times. The chart is
+// compared by its contents, so commits elsewhere in the repo don't
+// make it look like a new chart.
+func (chs *ChartChangeSync) upgrade(releaseName string, fhr ifv1.FluxHelmRelease) {
+	rollback := fhr.Spec.Rollback
+	values, _ := fhr.Spec.Values.YAML()
+	chartHash, err := hashChart(filepath.Join(chs.clone.Dir(), chs.config.ChartsPath, fhr.Spec.ChartGitPath))
+	if err != nil {
+		chs.logger.Log("warning", "failed to read chart", "namespace", fhr.Namespace, "name", fhr.Name, "chart", fhr.Spec.ChartGitPath, "error", err)
+		return
+	}
+	key := chartHash + "\n" + values
+
+	chs.failuresMu.Lock()
+	failed := chs.failures[releaseName]
+	chs.failuresMu.Unlock()
+	if rollback.Enable && failed.key == key && failed.count > rollback.MaxRetries {
+		chs.logger.Log("info", "not upgrading release again, since it was rolled back", "namespace", fhr.Namespace, "name", fhr.Name, "release", releaseName, "failures", failed.count, "chart", fhr.Spec.ChartGitPath)
+		return
+	}
+
+	opts := release.InstallOptions{DryRun: false}
+	_, err = chs.release.Install(chs.clone.Dir(), releaseName, fhr, release.UpgradeAction, opts)
+	if err == nil {
+		chs.failuresMu.Lock()
+		delete(chs.failures, releaseName)
+		chs.failuresMu.Unlock()
+		return
+	}
+	chs.logger.Log("warning", "Failed to upgrade chart", "namespace", fhr.Namespace, "name", fhr.Name, "release", releaseName, "error", err)
+	if !rollback.Enable {
+		return
+	}
+
+	chs.failuresMu.Lock()
+	if failed.key != key {
+		failed = upgradeFailures{key: key}
+	}
+	failed.count++
+	chs.failures[releaseName] = failed
+	chs.failuresMu.Unlock()
+
+	if _, err := chs.release.Rollback(releaseName, rollback); err != nil {
+		chs.logger.Log("warning", "Failed to roll back release", "namespace", fhr.Namespace, "name", fhr.Name, "release", releaseName, "error", err)
+	}
+}
+
+// chartFound reports whether the chart of a FluxHelmRelease is in the
+// clone given, logging and counting the failure if not. Either way,
+// it's recorded in the FluxHelmRelease's ChartFound condition.
+func (chs *ChartChangeSync) chartFound(repoDir string, fhr ifv1.FluxHelmRelease) bool {
+	reason := resolveChart(repoDir, chs.config.ChartsPath, fhr.Spec.ChartGitPath)
+	if reason == "" {
+		// The revision is left out, so that the condition (and the
+		// resource) isn't updated with every commit
+		chs.setChartFound(fhr, v1.ConditionTrue, "ChartFound", fmt.Sprintf("chart found at %q", fhr.Spec.ChartGitPath))
+		return true
+	}
+	chartResolutionFailures.With(labelReason, reason).Add(1)
+	chs.logger.Log("warning", "chart not found in git repo", "namespace", fhr.Namespace, "name", fhr.Name, "chart", fhr.Spec.ChartGitPath, "reason", reason)
+	chs.setChartFound(fhr, v1.ConditionFalse, conditionReasons[reason], chs.notFoundMessage(fhr, reason))
+	return false
+}
+
+// The reasons given in the ChartFound condition, by the reason for
+// the failure to find a chart.
+var conditionReasons = map[string]string{
+	reasonMissing:  "ChartGitPathMissing",
+	reasonOutside:  "ChartGitPathOutside",
+	reasonNotFound: "ChartNotFound",
+}
+
+func (chs *ChartChangeSync) notFoundMessage(fhr ifv1.FluxHelmRelease, reason string) string {
+	switch reason {
+	case reasonMissing:
+		return "no chartGitPath given"
+	case reasonOutside:
+		return fmt.Sprintf("chartGitPath %q is outside the git repo", fhr.Spec.ChartGitPath)
+	}
+	msg := fmt.Sprintf("no chart (Chart.yaml) at %q under %q in revision %s", fhr.Spec.ChartGitPath, chs.config.ChartsPath, chs.revision)
+	if chs.discover {
+		if len(chs.charts) == 0 {
+			msg += "; no charts were found in the repo"
+		} else {
+			msg += "; charts found in the repo: " + strings.Join(chs.charts, ", ")
+		}
+	}
+	return msg
+}
+
+func (chs *ChartChangeSync) setChartFound(fhr ifv1.FluxHelmRelease, status v1.ConditionStatus, reason, message string) {
+	condition := fhrstatus.NewCondition(ifv1.ChartFound, status, reason, message)
+	if err := fhrstatus.SetCondition(&chs.ifClient, fhr, condition); err != nil {
+		chs.logger.Log("warning", "failed to set condition of FluxHelmRelease", "namespace", fhr.Namespace, "name", fhr.Name, "condition", ifv1.ChartFound, "error", err)
+	}
+}
+
+// discoverCharts finds the charts in the clone, and checks the chart
+// of each FluxHelmRelease is among them.
+func (chs *ChartChangeSync) discoverCharts() {
+	chs.mu.Lock()
+	charts, err := findCharts(chs.clone.Dir(), chs.config.ChartsPath)
+	if err != nil {
+		chs.mu.Unlock()
+		chs.logger.Log("warning", "failed to look for charts in git repo", "path", chs.config.ChartsPath, "error", err)
+		return
+	}
+	if !cmp.Equal(charts, chs.charts) {
+		chs.logger.Log("info", "charts found in git repo", "revision", chs.revision, "count", len(charts), "charts", strings.Join(charts, ","))
+	}
+	chs.charts = charts
+	chs.mu.Unlock()
+
+	resources, err := chs.getCustomResources()
+	if err != nil {
+		chs.logger.Log("warning", "failed to get FluxHelmRelease resources to check charts of", "error", err)
+		return
+	}
+	chs.mu.RLock()
+	defer chs.mu.RUnlock()
+	for _, fhr := range resources {
+		chs.chartFound(chs.clone.Dir(), fhr)
+	}
+}
+
+// findCharts gives the paths, relative to the charts path, of the
+// charts (i.e., directories with a Chart.yaml) in a clone of the
+// repo. Charts within charts (e.g., dependencies vendored in their
+// charts/ directory) aren't included.
+func findCharts(repoDir, chartsPath string) ([]string, error) {
+	root := filepath.Join(repoDir, chartsPath)
+	var charts []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			chs.logger.Log("warning", "Failed to upgrade chart", "namespace", fhr.Namespace, "name", fhr.Name, "error", err)
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == ".git" {
+			return filepath.SkipDir
 		}
+		if _, err := os.Stat(filepath.Join(path, "Chart.yaml")); err == nil {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			charts = append(charts, filepath.ToSlash(rel))
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return charts, err
+}
+
+// hashChart gives a hash of the contents of a chart directory: the
+// path, relative to the directory, and the content of each file in
+// it.
+func hashChart(chartDir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(chartDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(chartDir, path)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), len(content))
+		h.Write(content)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resolveChart gives the reason a chart can't be found at the path
+// given (relative to the charts path) in a clone of the repo, or the
+// empty string if it can.
+func resolveChart(repoDir, chartsPath, chartPath string) string {
+	if chartPath == "" {
+		return reasonMissing
 	}
+	chartDir := filepath.Join(repoDir, chartsPath, chartPath)
+	if rel, err := filepath.Rel(repoDir, chartDir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return reasonOutside
+	}
+	if _, err := os.Stat(filepath.Join(chartDir, "Chart.yaml")); err != nil {
+		return reasonNotFound
+	}
+	return ""
 }
 
 // reapplyReleaseDefs goes through the resource definitions and
@@ -288,33 +551,34 @@ func (chs *ChartChangeSync) reapplyReleaseDefs() error {
 
 // DeleteRelease deletes the helm release associated with a
 // FluxHelmRelease. This exists mainly so that the operator code can
-// call it when it is handling a resource deletion.
-func (chs *ChartChangeSync) DeleteRelease(fhr ifv1.FluxHelmRelease) {
+// call it when it is handling a resource deletion. If the release
+// can't be deleted yet, it returns an error, so it can be tried again.
+func (chs *ChartChangeSync) DeleteRelease(fhr ifv1.FluxHelmRelease) error {
 	name := release.GetReleaseName(fhr)
+	chs.failuresMu.Lock()
+	delete(chs.failures, name)
+	chs.failuresMu.Unlock()
 	err := chs.release.Delete(name)
 	if err != nil {
 		chs.logger.Log("warning", "Chart release not deleted", "release", name, "error", err)
 	}
+	return err
 }
 
 // ---
 
-// getNamespaces gets current kubernetes cluster namespaces
+// getNamespaces gets the namespaces to look at: those allowed, or
+// otherwise all the kubernetes cluster namespaces
 func (chs *ChartChangeSync) getNamespaces() ([]string, error) {
-	var ns []string
-	nso, err := chs.kubeClient.CoreV1().Namespaces().List(metav1.ListOptions{})
+	ns, err := helmop.Namespaces(&chs.kubeClient, chs.namespaces)
 	if err != nil {
 		return nil, fmt.Errorf("Failure while retrieving kubernetes namespaces: %s", err)
 	}
-
-	for _, n := range nso.Items {
-		ns = append(ns, n.GetName())
-	}
-
 	return ns, nil
 }
 
-// getCustomResources assembles all custom resources in all namespaces
+// getCustomResources assembles all custom resources in the namespaces
+// looked at
 func (chs *ChartChangeSync) getCustomResources() ([]ifv1.FluxHelmRelease, error) {
 	namespaces, err := chs.getNamespaces()
 	if err != nil {
@@ -0,0 +1,120 @@
+package chartsync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveChart(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "flux-chartsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	chartDir := filepath.Join(repoDir, "charts", "mychart")
+	if err := os.MkdirAll(chartDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: mychart\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repoDir, "charts", "notachart"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for chartPath, expected := range map[string]string{
+		"mychart":         "",
+		"":                reasonMissing,
+		"../../elsewhere": reasonOutside,
+		"notachart":       reasonNotFound,
+		"nosuchchart":     reasonNotFound,
+	} {
+		if reason := resolveChart(repoDir, "charts", chartPath); reason != expected {
+			t.Errorf("chart path %q: expected reason %q, got %q", chartPath, expected, reason)
+		}
+	}
+}
+
+func TestFindCharts(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "flux-chartsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	for _, dir := range []string{
+		"charts/mychart",
+		"charts/team/other",
+		"charts/mychart/charts/dependency", // a dependency, not a chart of its own
+		"notcharts/elsewhere",
+	} {
+		if err := os.MkdirAll(filepath.Join(repoDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(repoDir, dir, "Chart.yaml"), []byte("name: chart\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(repoDir, "charts", "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	charts, err := findCharts(repoDir, "charts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"mychart", "team/other"}
+	if !reflect.DeepEqual(charts, expected) {
+		t.Errorf("expected charts %v, got %v", expected, charts)
+	}
+}
+
+func TestHashChart(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "flux-chartsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	chartDir := filepath.Join(repoDir, "charts", "mychart")
+	if err := os.MkdirAll(filepath.Join(chartDir, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path, content string) {
+		if err := ioutil.WriteFile(filepath.Join(repoDir, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("charts/mychart/Chart.yaml", "name: mychart\n")
+	write("charts/mychart/templates/deployment.yaml", "kind: Deployment\n")
+
+	hash, err := hashChart(chartDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A change elsewhere in the repo doesn't change the chart's hash
+	write("README.md", "a change\n")
+	if again, _ := hashChart(chartDir); again != hash {
+		t.Error("expected the hash not to change when nothing in the chart did")
+	}
+
+	// A change to the chart does
+	write("charts/mychart/templates/deployment.yaml", "kind: Deployment\nmetadata: {}\n")
+	if changed, _ := hashChart(chartDir); changed == hash {
+		t.Error("expected the hash to change when a file in the chart did")
+	}
+
+	// So does moving a file within the chart
+	write("charts/mychart/templates/deployment.yaml", "kind: Deployment\n")
+	if err := os.Rename(filepath.Join(chartDir, "templates", "deployment.yaml"), filepath.Join(chartDir, "templates", "deploy.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if moved, _ := hashChart(chartDir); moved == hash {
+		t.Error("expected the hash to change when a file in the chart was renamed")
+	}
+}
@@ -0,0 +1,64 @@
+package chartsync
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+const (
+	labelReason = "reason"
+
+	reasonMissing  = "missing"   // the FluxHelmRelease gives no chart path
+	reasonOutside  = "outside"   // the chart path is outside the repo
+	reasonNotFound = "not_found" // there's no chart at the path
+)
+
+// Registry has the metrics of syncing charts from git. They're kept
+// apart from the metrics of releases, and served on their own, since
+// they're what to look at when the operator doesn't seem to be seeing
+// changes to charts.
+var Registry = stdprometheus.NewRegistry()
+
+var (
+	mirrorLagVec = stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_chartsync",
+		Name:      "mirror_lag_commits",
+		Help:      "Number of commits on the branch in the git mirror that charts haven't yet been synced to.",
+	}, []string{})
+
+	// Alerting on how long ago this was is a way to find out that
+	// charts aren't keeping up with the git mirror.
+	lastSyncVec = stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "helm_chartsync",
+		Name:      "last_sync_timestamp_seconds",
+		Help:      "Time charts were last found to be up to date with the branch in the git mirror, in seconds since the epoch.",
+	}, []string{})
+
+	exportDurationVec = stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "helm_chartsync",
+		Name:      "export_duration_seconds",
+		Help:      "Duration of exporting a revision from the git mirror to read charts from, in seconds.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20},
+	}, []string{fluxmetrics.LabelSuccess})
+
+	resolutionFailuresVec = stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "helm_chartsync",
+		Name:      "chart_resolution_failures_total",
+		Help:      "Count of failures to find the chart of a FluxHelmRelease in the git repo, by reason.",
+	}, []string{labelReason})
+
+	mirrorLagCommits        = prometheus.NewGauge(mirrorLagVec)
+	lastSyncTimestamp       = prometheus.NewGauge(lastSyncVec)
+	exportDuration          = prometheus.NewHistogram(exportDurationVec)
+	chartResolutionFailures = prometheus.NewCounter(resolutionFailuresVec)
+)
+
+func init() {
+	Registry.MustRegister(mirrorLagVec, lastSyncVec, exportDurationVec, resolutionFailuresVec)
+}
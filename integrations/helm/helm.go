@@ -36,6 +36,26 @@ type TillerOptions struct {
 	TLSCACert string
 }
 
+// Namespaces gives the namespaces the operator is to look at: those
+// allowed, if any are given, or otherwise all the namespaces in the
+// cluster. The allowed namespaces aren't checked, so that listing
+// namespaces (which needs permission across the cluster) isn't
+// needed when they're given.
+func Namespaces(kubeClient kubernetes.Interface, allowed []string) ([]string, error) {
+	if len(allowed) > 0 {
+		return allowed, nil
+	}
+	list, err := kubeClient.CoreV1().Namespaces().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var namespaces []string
+	for _, ns := range list.Items {
+		namespaces = append(namespaces, ns.Name)
+	}
+	return namespaces, nil
+}
+
 // Helm struct provides access to helm client
 type Helm struct {
 	logger log.Logger
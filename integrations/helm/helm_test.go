@@ -0,0 +1,39 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNamespaces(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}},
+	)
+
+	all, err := Namespaces(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"default", "team"}; !reflect.DeepEqual(all, expected) {
+		t.Errorf("expected all namespaces %v, got %v", expected, all)
+	}
+
+	// The namespaces allowed are given as they are, without listing
+	// the namespaces in the cluster
+	client.ClearActions()
+	allowed, err := Namespaces(client, []string{"team", "elsewhere"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"team", "elsewhere"}; !reflect.DeepEqual(allowed, expected) {
+		t.Errorf("expected allowed namespaces %v, got %v", expected, allowed)
+	}
+	if actions := client.Actions(); len(actions) > 0 {
+		t.Errorf("expected no requests to the API server, got %v", actions)
+	}
+}
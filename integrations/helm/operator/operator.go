@@ -54,8 +54,10 @@ type Controller struct {
 	logger   log.Logger
 	logDiffs bool
 
-	fhrLister iflister.FluxHelmReleaseLister
-	fhrSynced cache.InformerSynced
+	// There's an informer for each namespace looked at, or just one
+	// for all namespaces
+	fhrListers []iflister.FluxHelmReleaseLister
+	fhrSynced  []cache.InformerSynced
 
 	sync   *chartsync.ChartChangeSync
 	config helmop.RepoConfig
@@ -67,17 +69,25 @@ type Controller struct {
 	// simultaneously in two different workers.
 	releaseWorkqueue workqueue.RateLimitingInterface
 
+	// FluxHelmReleases that have been deleted, by their workqueue
+	// key, until their releases have been deleted too. Deletions
+	// go through the workqueue, so they're retried if the release
+	// can't be deleted yet.
+	deletedMu sync.Mutex
+	deleted   map[string]ifv1.FluxHelmRelease
+
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
 }
 
-// New returns a new helm-operator
+// New returns a new helm-operator, which handles the FluxHelmReleases
+// of the informers given.
 func New(
 	logger log.Logger,
 	logReleaseDiffs bool,
 	kubeclientset kubernetes.Interface,
-	fhrInformer fhrv1.FluxHelmReleaseInformer,
+	fhrInformers []fhrv1.FluxHelmReleaseInformer,
 	sync *chartsync.ChartChangeSync,
 	config helmop.RepoConfig) *Controller {
 
@@ -92,9 +102,8 @@ func New(
 	controller := &Controller{
 		logger:           logger,
 		logDiffs:         logReleaseDiffs,
-		fhrLister:        fhrInformer.Lister(),
-		fhrSynced:        fhrInformer.Informer().HasSynced,
 		releaseWorkqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ChartRelease"),
+		deleted:          map[string]ifv1.FluxHelmRelease{},
 		recorder:         recorder,
 		sync:             sync,
 		config:           config,
@@ -103,28 +112,53 @@ func New(
 	controller.logger.Log("info", "Setting up event handlers")
 
 	// ----- EVENT HANDLERS for FluxHelmRelease resources change ---------
-	fhrInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+	for _, fhrInformer := range fhrInformers {
+		controller.fhrListers = append(controller.fhrListers, fhrInformer.Lister())
+		controller.fhrSynced = append(controller.fhrSynced, fhrInformer.Informer().HasSynced)
+		fhrInformer.Informer().AddEventHandler(controller.eventHandlers())
+	}
+	controller.logger.Log("info", "Event handlers set up")
+
+	return controller
+}
+
+func (c *Controller) eventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
 		AddFunc: func(new interface{}) {
-			controller.logger.Log("info", "CREATING release")
-			controller.logger.Log("info", "Custom Resource driven release install")
-			_, ok := checkCustomResourceType(controller.logger, new)
+			c.logger.Log("info", "CREATING release")
+			c.logger.Log("info", "Custom Resource driven release install")
+			_, ok := checkCustomResourceType(c.logger, new)
 			if ok {
-				controller.enqueueJob(new)
+				c.enqueueJob(new)
 			}
 		},
 		UpdateFunc: func(old, new interface{}) {
-			controller.enqueueUpateJob(old, new)
+			c.enqueueUpateJob(old, new)
 		},
 		DeleteFunc: func(old interface{}) {
-			fhr, ok := checkCustomResourceType(controller.logger, old)
+			// The informer may have missed the deletion, and only
+			// know the last state of the resource
+			if tombstone, ok := old.(cache.DeletedFinalStateUnknown); ok {
+				old = tombstone.Obj
+			}
+			fhr, ok := checkCustomResourceType(c.logger, old)
 			if ok {
-				controller.deleteRelease(fhr)
+				c.enqueueDeleteJob(fhr)
 			}
 		},
-	})
-	controller.logger.Log("info", "Event handlers set up")
+	}
+}
 
-	return controller
+// getRelease gets a FluxHelmRelease from the cache of whichever
+// informer has it.
+func (c *Controller) getRelease(namespace, name string) (fhr *ifv1.FluxHelmRelease, err error) {
+	for _, lister := range c.fhrListers {
+		fhr, err = lister.FluxHelmReleases(namespace).Get(name)
+		if err == nil || !k8serrors.IsNotFound(err) {
+			break
+		}
+	}
+	return fhr, err
 }
 
 // Run sets up the event handlers for our Custom Resource, as well
@@ -139,7 +173,7 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}, wg *sync.WaitG
 	// Wait for the caches to be synced before starting workers
 	c.logger.Log("info", "Waiting for informer caches to sync")
 
-	if ok := cache.WaitForCacheSync(stopCh, c.fhrSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, c.fhrSynced...); !ok {
 		return errors.New("failed to wait for caches to sync")
 	}
 	c.logger.Log("info", "Informer caches synced")
@@ -207,8 +241,10 @@ func (c *Controller) processNextWorkItem() bool {
 		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// FluxHelmRelease resource to sync the corresponding Chart release.
-		// If the sync failed, then we return while the item will get requeued
+		// If the sync failed, then we requeue the item, to be tried
+		// again after a back-off period.
 		if err := c.syncHandler(key); err != nil {
+			c.releaseWorkqueue.AddRateLimited(key)
 			return fmt.Errorf("error syncing '%s': %s", key, err.Error())
 		}
 		// If no error occurs we Forget this item so it does not
@@ -228,7 +264,8 @@ func (c *Controller) processNextWorkItem() bool {
 }
 
 // syncHandler acts according to the action
-// 		Deletes/creates or updates a Chart release
+// 		Deletes/creates or updates a Chart release. An error means
+// 		it's to be tried again.
 func (c *Controller) syncHandler(key string) error {
 	c.logger.Log("debug", fmt.Sprintf("Starting to sync cache key %s", key))
 
@@ -241,9 +278,12 @@ func (c *Controller) syncHandler(key string) error {
 	}
 
 	// Custom Resource fhr contains all information we need to know about the Chart release
-	fhr, err := c.fhrLister.FluxHelmReleases(namespace).Get(name)
+	fhr, err := c.getRelease(namespace, name)
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
+			if deleted, ok := c.deletedRelease(key); ok {
+				return c.deleteRelease(key, deleted)
+			}
 			c.logger.Log("info", fmt.Sprintf("FluxHelmRelease '%s' referred to in work queue no longer exists", key))
 			runtime.HandleError(fmt.Errorf("FluxHelmRelease '%s' referred to in work queue no longer exists", key))
 			return nil
@@ -252,6 +292,9 @@ func (c *Controller) syncHandler(key string) error {
 		return err
 	}
 
+	// If it was deleted, it's been created again since, so its
+	// release is reconciled rather than deleted
+	c.forgetDeletion(key)
 	c.sync.ReconcileReleaseDef(*fhr)
 	c.recorder.Event(fhr, corev1.EventTypeNormal, ChartSynced, MessageChartSynced)
 	return nil
@@ -312,8 +355,40 @@ func (c *Controller) enqueueUpateJob(old, new interface{}) {
 	}
 }
 
-func (c *Controller) deleteRelease(fhr ifv1.FluxHelmRelease) {
+// enqueueDeleteJob remembers a FluxHelmRelease that's been deleted,
+// and puts it on the work queue, so its release is deleted.
+func (c *Controller) enqueueDeleteJob(fhr ifv1.FluxHelmRelease) {
+	key, err := getCacheKey(&fhr)
+	if err != nil {
+		return
+	}
+	c.deletedMu.Lock()
+	c.deleted[key] = fhr
+	c.deletedMu.Unlock()
+	c.releaseWorkqueue.AddRateLimited(key)
+}
+
+// deletedRelease gives the FluxHelmRelease with the key given, if it's
+// been deleted and its release hasn't been yet.
+func (c *Controller) deletedRelease(key string) (ifv1.FluxHelmRelease, bool) {
+	c.deletedMu.Lock()
+	defer c.deletedMu.Unlock()
+	fhr, ok := c.deleted[key]
+	return fhr, ok
+}
+
+func (c *Controller) forgetDeletion(key string) {
+	c.deletedMu.Lock()
+	delete(c.deleted, key)
+	c.deletedMu.Unlock()
+}
+
+func (c *Controller) deleteRelease(key string, fhr ifv1.FluxHelmRelease) error {
 	c.logger.Log("info", "DELETING release")
 	c.logger.Log("info", "Custom Resource driven release deletion")
-	c.sync.DeleteRelease(fhr)
+	if err := c.sync.DeleteRelease(fhr); err != nil {
+		return err
+	}
+	c.forgetDeletion(key)
+	return nil
 }
@@ -6,19 +6,23 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	k8shelm "k8s.io/helm/pkg/helm"
 	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/timeconv"
 
 	"github.com/weaveworks/flux"
 	ifv1 "github.com/weaveworks/flux/apis/helm.integrations.flux.weave.works/v1alpha2"
 	fluxk8s "github.com/weaveworks/flux/cluster/kubernetes"
+	"github.com/weaveworks/flux/tracing"
 )
 
 var (
 	ErrChartGitPathMissing = "Chart deploy configuration (%s) has empty Chart git path"
+	ErrChartGitPathOutside = "Chart deploy configuration (%s) has Chart git path %q outside the git repo; charts can only be used from the repo"
 )
 
 type Action string
@@ -30,13 +34,22 @@ const (
 
 type Config struct {
 	ChartsPath string
+	// The cluster the operator runs in, if it's been given an ID;
+	// resources released are annotated with it
+	ClusterID string
+	// How long a release can be deleting before its deletion is
+	// forced; when zero, it never is
+	ForceDeleteAfter time.Duration
+	// Whether to purge a release whose first install failed, so it
+	// can be installed again under the same name
+	PurgeFailedInstalls bool
 }
 
 // Release contains clients needed to provide functionality related to helm releases
 type Release struct {
 	logger log.Logger
 
-	HelmClient *k8shelm.Client
+	HelmClient k8shelm.Interface
 
 	config Config
 }
@@ -57,7 +70,7 @@ type InstallOptions struct {
 }
 
 // New creates a new Release instance.
-func New(logger log.Logger, helmClient *k8shelm.Client, config Config) *Release {
+func New(logger log.Logger, helmClient k8shelm.Interface, config Config) *Release {
 	// TODO(michael): check we don't have nil values in the config
 	r := &Release{
 		logger:     logger,
@@ -94,44 +107,73 @@ func (r *Release) GetDeployedRelease(name string) (*hapi_release.Release, error)
 	return nil, nil
 }
 
-func (r *Release) canDelete(name string) (bool, error) {
+// canDelete says whether a release can be deleted, and if so, whether
+// it has to be forced because it's stuck being deleted. A release
+// with an install, upgrade or rollback pending gives an error, so its
+// deletion can be tried again once that's finished.
+func (r *Release) canDelete(name string) (ok, force bool, err error) {
 	rls, err := r.HelmClient.ReleaseStatus(name)
-
+	if isNotFound(err, name) {
+		r.logger.Log("info", fmt.Sprintf("Release (%s) not found, so there's nothing to delete", name))
+		return false, false, nil
+	}
 	if err != nil {
 		r.logger.Log("error", fmt.Sprintf("Error finding status for release (%s): %#v", name, err))
-		return false, err
+		return false, false, err
 	}
-	/*
-		"UNKNOWN":          0,
-		"DEPLOYED":         1,
-		"DELETED":          2,
-		"SUPERSEDED":       3,
-		"FAILED":           4,
-		"DELETING":         5,
-		"PENDING_INSTALL":  6,
-		"PENDING_UPGRADE":  7,
-		"PENDING_ROLLBACK": 8,
-	*/
-	status := rls.GetInfo().GetStatus()
+	info := rls.GetInfo()
+	status := info.GetStatus()
 	r.logger.Log("info", fmt.Sprintf("Release [%s] status: %s", name, status.Code.String()))
 	switch status.Code {
-	case 1, 4:
+	case hapi_release.Status_DEPLOYED, hapi_release.Status_FAILED:
 		r.logger.Log("info", fmt.Sprintf("Deleting release (%s)", name))
-		return true, nil
-	case 2:
+		return true, false, nil
+	case hapi_release.Status_DELETED:
 		r.logger.Log("info", fmt.Sprintf("Release (%s) already deleted", name))
-		return false, nil
+		return false, false, nil
+	case hapi_release.Status_DELETING:
+		if r.config.ForceDeleteAfter == 0 {
+			r.logger.Log("info", fmt.Sprintf("Release (%s) is already being deleted", name))
+			return false, false, nil
+		}
+		// Tiller records when the deletion started; if it's been
+		// going on for too long, it has most likely failed silently.
+		// Until then, it may yet finish.
+		if info.GetDeleted() != nil {
+			since := time.Since(timeconv.Time(info.GetDeleted()))
+			if since > r.config.ForceDeleteAfter {
+				r.logger.Log("warning", fmt.Sprintf("Release (%s) has been deleting for %s; forcing its deletion", name, since.Round(time.Second)))
+				return true, true, nil
+			}
+		}
+		return false, false, fmt.Errorf("Release (%s) is still being deleted", name)
+	case hapi_release.Status_PENDING_INSTALL, hapi_release.Status_PENDING_UPGRADE, hapi_release.Status_PENDING_ROLLBACK:
+		r.logger.Log("info", fmt.Sprintf("Release (%s) is %s; it will be deleted once that's finished", name, status.Code.String()))
+		return false, false, fmt.Errorf("Release (%s) is %s, so cannot be deleted yet", name, status.Code.String())
 	default:
 		r.logger.Log("info", fmt.Sprintf("Release (%s) with status %s cannot be deleted", name, status.Code.String()))
-		return false, fmt.Errorf("Release (%s) with status %s cannot be deleted", name, status.Code.String())
+		return false, false, fmt.Errorf("Release (%s) with status %s cannot be deleted", name, status.Code.String())
 	}
 }
 
+// isNotFound says whether an error from Tiller is because there's no
+// release of the name given. Tiller doesn't give a code for that, so
+// this looks for its message, as the helm command does.
+func isNotFound(err error, name string) bool {
+	return err != nil && strings.Contains(err.Error(), fmt.Sprintf("release: %q not found", name))
+}
+
 // Install performs a Chart release given the directory containing the
 // charts, and the FluxHelmRelease specifying the release. Depending
 // on the release type, this is either a new release, or an upgrade of
 // an existing one.
-func (r *Release) Install(repoDir, releaseName string, fhr ifv1.FluxHelmRelease, action Action, opts InstallOptions) (*hapi_release.Release, error) {
+func (r *Release) Install(repoDir, releaseName string, fhr ifv1.FluxHelmRelease, action Action, opts InstallOptions) (_ *hapi_release.Release, err error) {
+	_, span := tracing.Start(context.Background(), "helm.install")
+	span.SetTag("release", releaseName)
+	span.SetTag("action", string(action))
+	span.SetTag("dry-run", fmt.Sprint(opts.DryRun))
+	defer func() { span.Finish(err) }()
+
 	r.logger.Log("info", fmt.Sprintf("releaseName= %s, action=%s, install options: %+v", releaseName, action, opts))
 
 	chartPath := fhr.Spec.ChartGitPath
@@ -145,7 +187,13 @@ func (r *Release) Install(repoDir, releaseName string, fhr ifv1.FluxHelmRelease,
 		namespace = "default"
 	}
 
+	// Charts only ever come from the repo; nothing is fetched from
+	// elsewhere, nor read from outside the clone.
 	chartDir := filepath.Join(repoDir, r.config.ChartsPath, chartPath)
+	if rel, err := filepath.Rel(repoDir, chartDir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		r.logger.Log("error", fmt.Sprintf(ErrChartGitPathOutside, fhr.GetName(), chartPath))
+		return nil, fmt.Errorf(ErrChartGitPathOutside, fhr.GetName(), chartPath)
+	}
 
 	strVals, err := fhr.Spec.Values.YAML()
 	if err != nil {
@@ -156,6 +204,11 @@ func (r *Release) Install(repoDir, releaseName string, fhr ifv1.FluxHelmRelease,
 
 	switch action {
 	case InstallAction:
+		if !opts.DryRun && r.config.PurgeFailedInstalls {
+			if err := r.purgeIfFailedInstall(releaseName); err != nil {
+				return nil, err
+			}
+		}
 		res, err := r.HelmClient.InstallRelease(
 			chartDir,
 			namespace,
@@ -211,9 +264,63 @@ func (r *Release) Install(repoDir, releaseName string, fhr ifv1.FluxHelmRelease,
 	}
 }
 
-// Delete purges a Chart release
-func (r *Release) Delete(name string) error {
-	ok, err := r.canDelete(name)
+// purgeIfFailedInstall purges a release that failed to install and
+// has never been deployed, since otherwise its name can't be used
+// again. A release that doesn't exist is left alone.
+func (r *Release) purgeIfFailedInstall(name string) error {
+	rls, err := r.HelmClient.ReleaseContent(name)
+	if isNotFound(err, name) {
+		return nil
+	}
+	if err != nil {
+		r.logger.Log("error", fmt.Sprintf("Error getting release (%s) to check whether it failed to install: %#v", name, err))
+		return err
+	}
+	rel := rls.GetRelease()
+	if rel.GetInfo().GetStatus().GetCode() != hapi_release.Status_FAILED || rel.GetVersion() != 1 {
+		return nil
+	}
+	r.logger.Log("info", fmt.Sprintf("Release (%s) failed to install and has never been deployed; purging it before installing it again", name))
+	if _, err := r.HelmClient.DeleteRelease(name, k8shelm.DeletePurge(true)); err != nil {
+		r.logger.Log("error", fmt.Sprintf("Failed to purge release (%s): %#v", name, err))
+		return err
+	}
+	return nil
+}
+
+// Rollback rolls a release back to the version before the current
+// one, as configured by the FluxHelmRelease.
+func (r *Release) Rollback(name string, rollback ifv1.Rollback) (_ *hapi_release.Release, err error) {
+	_, span := tracing.Start(context.Background(), "helm.rollback")
+	span.SetTag("release", name)
+	defer func() { span.Finish(err) }()
+
+	opts := []k8shelm.RollbackOption{
+		k8shelm.RollbackForce(rollback.Force),
+		k8shelm.RollbackRecreate(rollback.Recreate),
+		k8shelm.RollbackDisableHooks(rollback.DisableHooks),
+	}
+	if rollback.Timeout > 0 {
+		opts = append(opts, k8shelm.RollbackTimeout(rollback.Timeout))
+	}
+	res, err := r.HelmClient.RollbackRelease(name, opts...)
+	if err != nil {
+		r.logger.Log("error", fmt.Sprintf("Chart rollback failed: %s: %#v", name, err))
+		return nil, err
+	}
+	r.logger.Log("info", fmt.Sprintf("Release rolled back: [%s]", name))
+	return res.Release, nil
+}
+
+// Delete purges a Chart release. If the release can't be deleted yet,
+// e.g., because an upgrade of it is pending, it returns an error, and
+// can be tried again later.
+func (r *Release) Delete(name string) (err error) {
+	_, span := tracing.Start(context.Background(), "helm.delete")
+	span.SetTag("release", name)
+	defer func() { span.Finish(err) }()
+
+	ok, force, err := r.canDelete(name)
 	if !ok {
 		if err != nil {
 			return err
@@ -221,7 +328,9 @@ func (r *Release) Delete(name string) error {
 		return nil
 	}
 
-	_, err = r.HelmClient.DeleteRelease(name, k8shelm.DeletePurge(true))
+	// Forcing the deletion skips the hooks, since they're the likely
+	// reason it got stuck.
+	_, err = r.HelmClient.DeleteRelease(name, k8shelm.DeletePurge(true), k8shelm.DeleteDisableHooks(force))
 	if err != nil {
 		r.logger.Log("error", fmt.Sprintf("Release deletion error: %#v", err))
 		return err
@@ -260,6 +369,9 @@ func (r *Release) annotateResources(release *hapi_release.Release, fhr ifv1.Flux
 	args = append(args, "--namespace", release.Namespace)
 	args = append(args, "-f", "-")
 	args = append(args, fluxk8s.AntecedentAnnotation+"="+fhrResourceID(fhr).String())
+	if r.config.ClusterID != "" {
+		args = append(args, fluxk8s.ClusterIDAnnotation+"="+r.config.ClusterID)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
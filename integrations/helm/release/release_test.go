@@ -0,0 +1,141 @@
+package release
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	k8shelm "k8s.io/helm/pkg/helm"
+	hapi_release "k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/proto/hapi/services"
+	"k8s.io/helm/pkg/timeconv"
+)
+
+// tillerClient is a fake helm client that says a release isn't found
+// the way Tiller does.
+type tillerClient struct {
+	*k8shelm.FakeClient
+}
+
+func (c tillerClient) ReleaseStatus(name string, opts ...k8shelm.StatusOption) (*services.GetReleaseStatusResponse, error) {
+	res, err := c.FakeClient.ReleaseStatus(name, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("rpc error: code = Unknown desc = release: %q not found", name)
+	}
+	return res, nil
+}
+
+func (c tillerClient) ReleaseContent(name string, opts ...k8shelm.ContentOption) (*services.GetReleaseContentResponse, error) {
+	res, err := c.FakeClient.ReleaseContent(name, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("rpc error: code = Unknown desc = release: %q not found", name)
+	}
+	return res, nil
+}
+
+func mockRelease(name string, version int32, status hapi_release.Status_Code) *hapi_release.Release {
+	return k8shelm.ReleaseMock(&k8shelm.MockReleaseOptions{Name: name, Version: version, StatusCode: status})
+}
+
+func released(client *k8shelm.FakeClient, name string) bool {
+	for _, rel := range client.Rels {
+		if rel.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDelete(t *testing.T) {
+	deletingSince := func(name string, ago time.Duration) *hapi_release.Release {
+		rel := mockRelease(name, 1, hapi_release.Status_DELETING)
+		rel.Info.Deleted = timeconv.Timestamp(time.Now().Add(-ago))
+		return rel
+	}
+
+	for _, c := range []struct {
+		name       string
+		release    *hapi_release.Release
+		forceAfter time.Duration
+		expectErr  bool
+		expectGone bool
+	}{
+		{name: "deployed", release: mockRelease("deployed", 1, hapi_release.Status_DEPLOYED), expectGone: true},
+		{name: "failed", release: mockRelease("failed", 1, hapi_release.Status_FAILED), expectGone: true},
+		// Pending operations are waited on, by trying again later
+		{name: "pending-install", release: mockRelease("pending-install", 1, hapi_release.Status_PENDING_INSTALL), expectErr: true},
+		{name: "pending-upgrade", release: mockRelease("pending-upgrade", 2, hapi_release.Status_PENDING_UPGRADE), expectErr: true},
+		{name: "pending-rollback", release: mockRelease("pending-rollback", 3, hapi_release.Status_PENDING_ROLLBACK), expectErr: true},
+		// A release that's deleting is left alone, unless it's been
+		// deleting for longer than allowed
+		{name: "deleting", release: deletingSince("deleting", time.Hour)},
+		{name: "deleting-not-long", release: deletingSince("deleting-not-long", time.Minute), forceAfter: 30 * time.Minute, expectErr: true},
+		{name: "deleting-stuck", release: deletingSince("deleting-stuck", time.Hour), forceAfter: 30 * time.Minute, expectGone: true},
+		// There's nothing to do for a release that doesn't exist
+		{name: "missing"},
+	} {
+		client := &k8shelm.FakeClient{}
+		if c.release != nil {
+			client.Rels = append(client.Rels, c.release)
+		}
+		r := New(log.NewNopLogger(), tillerClient{client}, Config{ForceDeleteAfter: c.forceAfter})
+
+		err := r.Delete(c.name)
+		if c.expectErr && err == nil {
+			t.Errorf("%s: expected an error, so the deletion is tried again", c.name)
+		} else if !c.expectErr && err != nil {
+			t.Errorf("%s: expected no error, got %v", c.name, err)
+		}
+		if gone := c.release != nil && !released(client, c.name); gone != c.expectGone {
+			t.Errorf("%s: expected the release to be deleted: %v, but it was: %v", c.name, c.expectGone, gone)
+		}
+	}
+}
+
+// erroringClient is a fake helm client that can't reach Tiller.
+type erroringClient struct {
+	*k8shelm.FakeClient
+}
+
+func (c erroringClient) ReleaseContent(name string, opts ...k8shelm.ContentOption) (*services.GetReleaseContentResponse, error) {
+	return nil, fmt.Errorf("rpc error: code = Unavailable desc = transport is closing")
+}
+
+func TestPurgeIfFailedInstall(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		release    *hapi_release.Release
+		expectGone bool
+	}{
+		// Only a release that failed its first install is purged
+		{name: "failed-install", release: mockRelease("failed-install", 1, hapi_release.Status_FAILED), expectGone: true},
+		{name: "failed-upgrade", release: mockRelease("failed-upgrade", 2, hapi_release.Status_FAILED)},
+		{name: "deployed", release: mockRelease("deployed", 1, hapi_release.Status_DEPLOYED)},
+		{name: "missing"},
+	} {
+		client := &k8shelm.FakeClient{}
+		if c.release != nil {
+			client.Rels = append(client.Rels, c.release)
+		}
+		r := New(log.NewNopLogger(), tillerClient{client}, Config{PurgeFailedInstalls: true})
+
+		if err := r.purgeIfFailedInstall(c.name); err != nil {
+			t.Errorf("%s: expected no error, got %v", c.name, err)
+		}
+		if gone := c.release != nil && !released(client, c.name); gone != c.expectGone {
+			t.Errorf("%s: expected the release to be purged: %v, but it was: %v", c.name, c.expectGone, gone)
+		}
+	}
+
+	// If it can't be told whether there's a failed release, it's an
+	// error, rather than taken to mean there's no release
+	client := &k8shelm.FakeClient{Rels: []*hapi_release.Release{mockRelease("failed-install", 1, hapi_release.Status_FAILED)}}
+	r := New(log.NewNopLogger(), erroringClient{client}, Config{PurgeFailedInstalls: true})
+	if err := r.purgeIfFailedInstall("failed-install"); err == nil {
+		t.Error("expected an error when the release can't be got")
+	}
+	if !released(client, "failed-install") {
+		t.Error("expected the release not to be purged when it can't be got")
+	}
+}
@@ -0,0 +1,67 @@
+package status
+
+import (
+	"encoding/json"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	fluxhelmtypes "github.com/weaveworks/flux/apis/helm.integrations.flux.weave.works/v1alpha2"
+	fluxhelm "github.com/weaveworks/flux/integrations/client/clientset/versioned"
+)
+
+// NewCondition makes a condition with the type, status, reason and
+// message given.
+func NewCondition(condType fluxhelmtypes.FluxHelmReleaseConditionType, status v1.ConditionStatus, reason, message string) fluxhelmtypes.FluxHelmReleaseCondition {
+	return fluxhelmtypes.FluxHelmReleaseCondition{
+		Type:               condType,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// SetCondition sets a condition in the status of a FluxHelmRelease,
+// replacing any of the same type. It does nothing if the
+// FluxHelmRelease already has the condition, with the same status,
+// reason and message.
+func SetCondition(client fluxhelm.Interface, fhr fluxhelmtypes.FluxHelmRelease, condition fluxhelmtypes.FluxHelmReleaseCondition) error {
+	conditions, changed := withCondition(fhr.Status.Conditions, condition)
+	if !changed {
+		return nil
+	}
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": conditions,
+		},
+	})
+	if err == nil {
+		// As with the release status, a merge patch is fine, since
+		// the conditions are set unconditionally.
+		_, err = client.HelmV1alpha2().FluxHelmReleases(fhr.Namespace).Patch(fhr.Name, types.MergePatchType, patchBytes)
+	}
+	return err
+}
+
+// withCondition gives the conditions with the one given put in place
+// of any of the same type, and whether that changes anything. The
+// transition time is kept if the status of the condition hasn't
+// changed.
+func withCondition(conditions []fluxhelmtypes.FluxHelmReleaseCondition, condition fluxhelmtypes.FluxHelmReleaseCondition) ([]fluxhelmtypes.FluxHelmReleaseCondition, bool) {
+	var result []fluxhelmtypes.FluxHelmReleaseCondition
+	for _, c := range conditions {
+		if c.Type != condition.Type {
+			result = append(result, c)
+			continue
+		}
+		if c.Status == condition.Status {
+			if c.Reason == condition.Reason && c.Message == condition.Message {
+				return conditions, false
+			}
+			condition.LastTransitionTime = c.LastTransitionTime
+		}
+	}
+	return append(result, condition), true
+}
@@ -0,0 +1,57 @@
+package status
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fluxhelmtypes "github.com/weaveworks/flux/apis/helm.integrations.flux.weave.works/v1alpha2"
+)
+
+func TestWithCondition(t *testing.T) {
+	then := metav1.NewTime(time.Now().Add(-time.Hour))
+	notFound := fluxhelmtypes.FluxHelmReleaseCondition{
+		Type:               fluxhelmtypes.ChartFound,
+		Status:             v1.ConditionFalse,
+		LastTransitionTime: then,
+		Reason:             "ChartNotFound",
+		Message:            "no chart at \"foo\"",
+	}
+	other := fluxhelmtypes.FluxHelmReleaseCondition{Type: "Other", Status: v1.ConditionTrue}
+	conditions := []fluxhelmtypes.FluxHelmReleaseCondition{other, notFound}
+
+	// The same condition again changes nothing
+	again := NewCondition(fluxhelmtypes.ChartFound, v1.ConditionFalse, "ChartNotFound", "no chart at \"foo\"")
+	if _, changed := withCondition(conditions, again); changed {
+		t.Error("expected no change for the same condition")
+	}
+
+	// A different message, with the same status, keeps the time of
+	// the transition
+	moved := NewCondition(fluxhelmtypes.ChartFound, v1.ConditionFalse, "ChartNotFound", "no chart at \"bar\"")
+	result, changed := withCondition(conditions, moved)
+	if !changed || len(result) != 2 {
+		t.Fatalf("expected a change, with two conditions; got %v, %+v", changed, result)
+	}
+	if result[0] != other {
+		t.Errorf("expected other conditions to be kept, got %+v", result[0])
+	}
+	if result[1].Message != moved.Message || !result[1].LastTransitionTime.Equal(&then) {
+		t.Errorf("expected new message with old transition time, got %+v", result[1])
+	}
+
+	// A different status is a transition
+	found := NewCondition(fluxhelmtypes.ChartFound, v1.ConditionTrue, "ChartFound", "")
+	result, changed = withCondition(conditions, found)
+	if !changed || result[1].Status != v1.ConditionTrue || result[1].LastTransitionTime.Equal(&then) {
+		t.Errorf("expected a transition to True, got %+v", result[1])
+	}
+
+	// A condition not there before is added
+	result, changed = withCondition(nil, found)
+	if !changed || len(result) != 1 || result[0] != found {
+		t.Errorf("expected the condition to be added, got %+v", result)
+	}
+}
@@ -25,6 +25,7 @@ import (
 
 	fluxhelmtypes "github.com/weaveworks/flux/apis/helm.integrations.flux.weave.works/v1alpha2"
 	fluxhelm "github.com/weaveworks/flux/integrations/client/clientset/versioned"
+	fluxhelmop "github.com/weaveworks/flux/integrations/helm"
 	"github.com/weaveworks/flux/integrations/helm/release"
 )
 
@@ -34,13 +35,17 @@ type Updater struct {
 	fluxhelm   fluxhelm.Interface
 	kube       kube.Interface
 	helmClient *helm.Client
+	namespaces []string
 }
 
-func New(fhrClient fluxhelm.Interface, kubeClient kube.Interface, helmClient *helm.Client) *Updater {
+// New makes an Updater. If namespaces are given, only the
+// FluxHelmReleases in those are updated.
+func New(fhrClient fluxhelm.Interface, kubeClient kube.Interface, helmClient *helm.Client, namespaces []string) *Updater {
 	return &Updater{
 		fluxhelm:   fhrClient,
 		kube:       kubeClient,
 		helmClient: helmClient,
+		namespaces: namespaces,
 	}
 }
 
@@ -56,13 +61,13 @@ bail:
 		case <-ticker.C:
 		}
 		// Look up FluxHelmReleases
-		namespaces, err := a.kube.CoreV1().Namespaces().List(metav1.ListOptions{})
+		namespaces, err := fluxhelmop.Namespaces(a.kube, a.namespaces)
 		if err != nil {
 			logErr = err
 			break bail
 		}
-		for _, ns := range namespaces.Items {
-			fhrIf := a.fluxhelm.HelmV1alpha2().FluxHelmReleases(ns.Name)
+		for _, ns := range namespaces {
+			fhrIf := a.fluxhelm.HelmV1alpha2().FluxHelmReleases(ns)
 			fhrs, err := fhrIf.List(metav1.ListOptions{})
 			if err != nil {
 				logErr = err
@@ -91,7 +96,7 @@ bail:
 						_, err = fhrIf.Patch(fhr.Name, types.MergePatchType, patchBytes)
 					}
 					if err != nil {
-						logger.Log("namespace", ns.Name, "resource", fhr.Name, "err", err)
+						logger.Log("namespace", ns, "resource", fhr.Name, "err", err)
 						continue
 					}
 				}
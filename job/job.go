@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 
+	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -33,6 +34,10 @@ type Result struct {
 	Revision string        `json:"revision,omitempty"`
 	Spec     *update.Spec  `json:"spec,omitempty"`
 	Result   update.Result `json:"result,omitempty"`
+	// For a release that's only planned (a dry run), the changes it
+	// would make to files, and the message it would commit them with
+	Diffs         []git.FileDiff `json:"diffs,omitempty"`
+	CommitMessage string         `json:"commitMessage,omitempty"`
 }
 
 // Status holds the possible states of a job; either,
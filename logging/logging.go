@@ -0,0 +1,203 @@
+// Package logging sets up the loggers used by the daemon and the
+// Helm operator: in logfmt or JSON, with each line given a level, and
+// lines below the level wanted -- which may be different for each
+// component -- dropped.
+//
+// Code logs with go-kit loggers as usual. The level of a line is
+// given by a `level` key (as from `github.com/go-kit/kit/log/level`)
+// if there is one, and otherwise worked out from the keys used by
+// convention: `err` or `error` for errors, `warn` or `warning` for
+// warnings, and `debug` for debugging; anything else is info. The
+// component is the value of the `component` key, as added with
+// `log.With(logger, "component", ...)`.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Formats in which lines can be written.
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// Level is how important a line is; lines below the level wanted are
+// dropped.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses the name of a level; `warning` is accepted for
+// `warn`.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (expected one of %s)", s, strings.Join(levelNames, ", "))
+}
+
+// Levels says which lines to write: those at or above the level for
+// their component, or the default level for components not named.
+type Levels struct {
+	Default    Level
+	Components map[string]Level
+}
+
+// ParseLevels parses levels given as a comma-separated list of
+// `component=level`, and optionally a bare level to use as the
+// default; e.g., `warn,registry=debug,sync-loop=info`. The default
+// is info if not given.
+func ParseLevels(s string) (Levels, error) {
+	levels := Levels{Default: LevelInfo, Components: map[string]Level{}}
+	if strings.TrimSpace(s) == "" {
+		return levels, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) == 1 {
+			l, err := ParseLevel(parts[0])
+			if err != nil {
+				return levels, err
+			}
+			levels.Default = l
+			continue
+		}
+		component := strings.TrimSpace(parts[0])
+		if component == "" {
+			return levels, fmt.Errorf("no component given in log level %q", item)
+		}
+		l, err := ParseLevel(parts[1])
+		if err != nil {
+			return levels, err
+		}
+		levels.Components[component] = l
+	}
+	return levels, nil
+}
+
+func (ls Levels) String() string {
+	parts := []string{ls.Default.String()}
+	var components []string
+	for c := range ls.Components {
+		components = append(components, c)
+	}
+	sort.Strings(components)
+	for _, c := range components {
+		parts = append(parts, c+"="+ls.Components[c].String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// levelFor returns the level for the component. A level given for
+// `sync` also applies to `sync-loop`, unless that has its own.
+func (ls Levels) levelFor(component string) Level {
+	for c := component; c != ""; {
+		if l, ok := ls.Components[c]; ok {
+			return l
+		}
+		i := strings.LastIndex(c, "-")
+		if i < 0 {
+			break
+		}
+		c = c[:i]
+	}
+	return ls.Default
+}
+
+// NewLogger returns a logger that writes lines in the format given,
+// at or above the levels given, with a timestamp and the caller.
+func NewLogger(w io.Writer, format string, levels Levels) (log.Logger, error) {
+	var logger log.Logger
+	switch format {
+	case FormatLogfmt, "":
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(w))
+	case FormatJSON:
+		logger = log.NewJSONLogger(log.NewSyncWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown log format %q (expected %s or %s)", format, FormatLogfmt, FormatJSON)
+	}
+	logger = &filter{next: logger, levels: levels}
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+	logger = log.With(logger, "caller", log.DefaultCaller)
+	return logger, nil
+}
+
+// filter drops lines below the level for their component, and gives
+// those it passes on a `level`, if they don't have one.
+type filter struct {
+	next   log.Logger
+	levels Levels
+}
+
+func (f *filter) Log(keyvals ...interface{}) error {
+	lvl, explicit, component := LevelInfo, false, ""
+	inferred := LevelInfo
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		k, v := keyvals[i], keyvals[i+1]
+		if k == level.Key() {
+			if l, err := ParseLevel(fmt.Sprint(v)); err == nil {
+				lvl, explicit = l, true
+			}
+			continue
+		}
+		key, ok := k.(string)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "component":
+			component = fmt.Sprint(v)
+		case "err", "error":
+			if v != nil {
+				inferred = LevelError
+			}
+		case "warn", "warning":
+			if inferred < LevelWarn {
+				inferred = LevelWarn
+			}
+		case "debug":
+			// Only if nothing says otherwise
+			if inferred == LevelInfo {
+				inferred = LevelDebug
+			}
+		}
+	}
+	if !explicit {
+		lvl = inferred
+	}
+	if lvl < f.levels.levelFor(component) {
+		return nil
+	}
+	if explicit {
+		return f.next.Log(keyvals...)
+	}
+	return f.next.Log(append([]interface{}{"level", lvl.String()}, keyvals...)...)
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelInfo, levels.Default)
+
+	levels, err = ParseLevels("warn,registry=debug, sync-loop=error")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelWarn, levels.Default)
+	assert.Equal(t, map[string]Level{"registry": LevelDebug, "sync-loop": LevelError}, levels.Components)
+	assert.Equal(t, "warn,registry=debug,sync-loop=error", levels.String())
+
+	for _, s := range []string{"loud", "registry=loud", "=debug"} {
+		_, err := ParseLevels(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLevels_LevelFor(t *testing.T) {
+	levels, _ := ParseLevels("sync=debug,sync-loop=error")
+	assert.Equal(t, LevelError, levels.levelFor("sync-loop"))
+	assert.Equal(t, LevelDebug, levels.levelFor("sync-other"))
+	assert.Equal(t, LevelInfo, levels.levelFor("registry"))
+	assert.Equal(t, LevelInfo, levels.levelFor(""))
+}
+
+func TestNewLogger_Filtering(t *testing.T) {
+	out := &bytes.Buffer{}
+	levels, _ := ParseLevels("warn,registry=debug")
+	logger, err := NewLogger(out, FormatJSON, levels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := log.With(logger, "component", "registry")
+	daemon := log.With(logger, "component", "daemon")
+
+	daemon.Log("info", "dropped")
+	daemon.Log("url", "git@example.com", "err", errors.New("kept"))
+	daemon.Log("warning", "kept")
+	daemon.Log("err", nil, "msg", "dropped, since there's no error")
+	registry.Log("debug", "kept")
+	level.Debug(daemon).Log("msg", "dropped")
+	level.Error(daemon).Log("msg", "kept")
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("%q: %s", line, err)
+		}
+		lines = append(lines, fields)
+	}
+	if !assert.Len(t, lines, 4) {
+		return
+	}
+	assert.Equal(t, "error", lines[0]["level"])
+	assert.Equal(t, "kept", lines[0]["err"])
+	assert.Equal(t, "warn", lines[1]["level"])
+	assert.Equal(t, "debug", lines[2]["level"])
+	assert.Equal(t, "registry", lines[2]["component"])
+	assert.Equal(t, "error", lines[3]["level"])
+	for _, l := range lines {
+		assert.Contains(t, l, "ts")
+		assert.Contains(t, l, "caller")
+	}
+}
+
+func TestNewLogger_Format(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger, err := NewLogger(out, FormatLogfmt, Levels{Default: LevelInfo})
+	assert.NoError(t, err)
+	logger.Log("info", "hello")
+	assert.True(t, strings.HasPrefix(out.String(), "level=info ts="), out.String())
+
+	_, err = NewLogger(out, "xml", Levels{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// WithConstLabel returns a gatherer that gives the metrics gathered by
+// the one given, with a label of the name and value given added to
+// each (unless it already has a label of that name); e.g., to say
+// which cluster the metrics come from, when those from several are
+// collected together.
+func WithConstLabel(g prometheus.Gatherer, name, value string) prometheus.Gatherer {
+	return &constLabelGatherer{gatherer: g, name: name, value: value}
+}
+
+type constLabelGatherer struct {
+	gatherer    prometheus.Gatherer
+	name, value string
+}
+
+func (c *constLabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := c.gatherer.Gather()
+	for _, family := range families {
+	metrics:
+		for _, m := range family.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == c.name {
+					continue metrics
+				}
+			}
+			name, value := c.name, c.value
+			m.Label = append(m.Label, &dto.LabelPair{Name: &name, Value: &value})
+			sort.Slice(m.Label, func(i, j int) bool {
+				return m.Label[i].GetName() < m.Label[j].GetName()
+			})
+		}
+	}
+	return families, err
+}
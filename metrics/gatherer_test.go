@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithConstLabel(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "things_total", Help: "Things."}, []string{"kind", "zone"})
+	registry.MustRegister(counter)
+	counter.WithLabelValues("a", "b").Inc()
+
+	families, err := WithConstLabel(registry, "cluster_id", "prod").Gather()
+	assert.NoError(t, err)
+	if assert.Len(t, families, 1) && assert.Len(t, families[0].Metric, 1) {
+		var labels []string
+		for _, l := range families[0].Metric[0].Label {
+			labels = append(labels, l.GetName()+"="+l.GetValue())
+		}
+		assert.Equal(t, []string{"cluster_id=prod", "kind=a", "zone=b"}, labels)
+	}
+
+	// A metric's own label of the same name is left as it is
+	families, err = WithConstLabel(registry, "zone", "c").Gather()
+	assert.NoError(t, err)
+	assert.Len(t, families[0].Metric[0].Label, 2)
+	assert.Equal(t, "b", families[0].Metric[0].Label[1].GetValue())
+}
@@ -14,4 +14,13 @@ const (
 	LabelReleaseType = "release_type"
 	LabelReleaseKind = "release_kind"
 	LabelStage       = "stage"
+
+	// Labels for sync metrics
+	LabelKind = "kind"
+
+	// Labels for automation metrics
+	LabelDecision = "decision"
+
+	// Labels for notification metrics
+	LabelTarget = "target"
 )
@@ -0,0 +1,17 @@
+package notify
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+var (
+	notificationsSent = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "notify",
+		Name:      "notifications_total",
+		Help:      "Count of notifications sent, by target and whether they were accepted.",
+	}, []string{fluxmetrics.LabelTarget, fluxmetrics.LabelSuccess})
+)
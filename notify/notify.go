@@ -0,0 +1,247 @@
+// Package notify sends notifications of events -- syncs, releases,
+// automated updates and so on -- to chat services and webhooks,
+// straight from the daemon rather than by way of an upstream service.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/event"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+const (
+	// KindSyncError is a sync in which some resources failed to
+	// apply. The other kinds of notification are the event types.
+	KindSyncError = "sync_error"
+
+	// How many notifications can be waiting to be sent before more
+	// are dropped
+	queueSize = 100
+	// How long to wait for each target to accept a notification
+	sendTimeout = 10 * time.Second
+	// How many of the resources that failed to sync to list
+	maxErrorsListed = 5
+)
+
+// DefaultKinds are the kinds of event notified of, if none are given.
+var DefaultKinds = []string{KindSyncError, event.EventRelease, event.EventAutoRelease, event.EventRollback, event.EventAutoRollback}
+
+// Kinds are all the kinds of event that can be notified of.
+var Kinds = []string{
+	KindSyncError,
+	event.EventSync,
+	event.EventRelease,
+	event.EventAutoRelease,
+	event.EventCommit,
+	event.EventRollback,
+	event.EventRejectImage,
+	event.EventAutoRollback,
+}
+
+// Message is a notification, ready to be sent.
+type Message struct {
+	// The kind of event, e.g., "release"
+	Kind string
+	// The text of the notification
+	Text string
+	// Set for errors, so targets can show them differently
+	IsError bool
+	Event   event.Event
+}
+
+// Target is somewhere notifications are sent.
+type Target interface {
+	Send(context.Context, Message) error
+	// String names the target for logs and metrics; since webhook
+	// URLs often include a secret, it shouldn't give the whole URL.
+	String() string
+}
+
+// TemplateData is what message templates are given.
+type TemplateData struct {
+	Kind      string
+	Workloads []string
+	// The default text of the notification
+	Text  string
+	Event event.Event
+}
+
+// Config says where to send notifications, for what, and how to
+// write them.
+type Config struct {
+	Targets []Target
+	// The kinds of event to notify of; if empty, DefaultKinds
+	Kinds []string
+	// Templates for the text of notifications of each kind, given a
+	// TemplateData; kinds without a template get the default text
+	Templates map[string]*template.Template
+}
+
+// Dispatcher sends notifications of events to its targets, in the
+// background, so that slow or unavailable targets don't hold anything
+// else up.
+type Dispatcher struct {
+	config Config
+	kinds  map[string]bool
+	logger log.Logger
+	queue  chan Message
+}
+
+// New makes a Dispatcher with the config given, checking that the
+// kinds of event named are known.
+func New(config Config, logger log.Logger) (*Dispatcher, error) {
+	if len(config.Kinds) == 0 {
+		config.Kinds = DefaultKinds
+	}
+	kinds := map[string]bool{}
+	for _, k := range config.Kinds {
+		if !isKind(k) {
+			return nil, fmt.Errorf("unknown kind of notification %q (expected one of %s)", k, strings.Join(Kinds, ", "))
+		}
+		kinds[k] = true
+	}
+	for k := range config.Templates {
+		if !isKind(k) {
+			return nil, fmt.Errorf("template given for unknown kind of notification %q (expected one of %s)", k, strings.Join(Kinds, ", "))
+		}
+	}
+	return &Dispatcher{
+		config: config,
+		kinds:  kinds,
+		logger: logger,
+		queue:  make(chan Message, queueSize),
+	}, nil
+}
+
+// ParseTemplate parses a template for the text of notifications of
+// a kind, as given by an operator.
+func ParseTemplate(kind, text string) (*template.Template, error) {
+	return template.New(kind).Option("missingkey=error").Parse(text)
+}
+
+func isKind(k string) bool {
+	for _, kind := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify queues a notification of the event, if it's of a kind
+// notified of. It doesn't wait for the notification to be sent; if
+// too many are waiting, it's dropped.
+func (d *Dispatcher) Notify(ev event.Event) {
+	msg, ok := d.message(ev)
+	if !ok {
+		return
+	}
+	select {
+	case d.queue <- msg:
+	default:
+		d.logger.Log("warning", "too many notifications waiting to be sent; dropping one", "kind", msg.Kind)
+	}
+}
+
+// message makes the notification for an event, if it's of a kind
+// notified of.
+func (d *Dispatcher) message(ev event.Event) (Message, bool) {
+	kind := ev.Type
+	var syncErrors []event.ResourceError
+	if metadata, ok := ev.Metadata.(*event.SyncEventMetadata); ok && len(metadata.Errors) > 0 {
+		syncErrors = metadata.Errors
+		// A sync with errors is notified of if either sync errors
+		// or all syncs are wanted
+		if d.kinds[KindSyncError] {
+			kind = KindSyncError
+		}
+	}
+	if !d.kinds[kind] {
+		return Message{}, false
+	}
+
+	msg := Message{
+		Kind:    kind,
+		Text:    ev.String(),
+		IsError: kind == KindSyncError || kind == event.EventRollback || ev.LogLevel == event.LogLevelError,
+		Event:   ev,
+	}
+	if len(syncErrors) > 0 {
+		msg.IsError = true
+		msg.Text += describeErrors(syncErrors)
+	}
+	if ev.ClusterID != "" {
+		msg.Text = fmt.Sprintf("[%s] %s", ev.ClusterID, msg.Text)
+	}
+	if tmpl, ok := d.config.Templates[kind]; ok {
+		data := TemplateData{
+			Kind:      kind,
+			Workloads: ev.ServiceIDStrings(),
+			Text:      msg.Text,
+			Event:     ev,
+		}
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, data); err != nil {
+			// Better to send the default text than nothing
+			d.logger.Log("err", fmt.Errorf("executing notification template for %q: %s", kind, err))
+		} else {
+			msg.Text = buf.String()
+		}
+	}
+	return msg, true
+}
+
+// describeErrors lists some of the resources that failed to sync.
+func describeErrors(errs []event.ResourceError) string {
+	buf := &bytes.Buffer{}
+	for i, e := range errs {
+		if i == maxErrorsListed {
+			fmt.Fprintf(buf, "\n... and %d more", len(errs)-maxErrorsListed)
+			break
+		}
+		fmt.Fprintf(buf, "\n%s", e.ID)
+		if e.Path != "" {
+			fmt.Fprintf(buf, " (%s", e.Path)
+			if e.Line > 0 {
+				fmt.Fprintf(buf, ":%d", e.Line)
+			}
+			fmt.Fprint(buf, ")")
+		}
+		fmt.Fprintf(buf, ": %s", e.Error)
+	}
+	return buf.String()
+}
+
+// Loop sends the notifications queued, until told to stop.
+func (d *Dispatcher) Loop(stop chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		case msg := <-d.queue:
+			d.send(msg)
+		}
+	}
+}
+
+func (d *Dispatcher) send(msg Message) {
+	for _, target := range d.config.Targets {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := target.Send(ctx, msg)
+		cancel()
+		notificationsSent.With(fluxmetrics.LabelTarget, target.String(), fluxmetrics.LabelSuccess, fmt.Sprint(err == nil)).Add(1)
+		if err != nil {
+			d.logger.Log("err", err, "target", target, "kind", msg.Kind)
+		}
+	}
+}
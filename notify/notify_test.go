@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/event"
+)
+
+func syncEvent(errs ...event.ResourceError) event.Event {
+	return event.Event{
+		Type:       event.EventSync,
+		ServiceIDs: []flux.ResourceID{flux.MustParseResourceID("default:deployment/helloworld")},
+		Metadata: &event.SyncEventMetadata{
+			Commits: []event.Commit{{Revision: "abc1234567", Message: "Update helloworld"}},
+			Errors:  errs,
+		},
+	}
+}
+
+func releaseEvent() event.Event {
+	return event.Event{
+		Type:       event.EventRelease,
+		ServiceIDs: []flux.ResourceID{flux.MustParseResourceID("default:deployment/helloworld")},
+		Message:    "released",
+	}
+}
+
+func TestNew_Kinds(t *testing.T) {
+	_, err := New(Config{Kinds: []string{"sync", "wibble"}}, log.NewNopLogger())
+	assert.Error(t, err)
+
+	tmpl, _ := ParseTemplate("wibble", "hello")
+	_, err = New(Config{Templates: map[string]*template.Template{"wibble": tmpl}}, log.NewNopLogger())
+	assert.Error(t, err)
+
+	d, err := New(Config{}, log.NewNopLogger())
+	assert.NoError(t, err)
+	for _, k := range DefaultKinds {
+		assert.True(t, d.kinds[k], k)
+	}
+}
+
+func TestDispatcher_Message(t *testing.T) {
+	d, _ := New(Config{}, log.NewNopLogger())
+
+	// Syncs without errors aren't notified of by default ..
+	_, ok := d.message(syncEvent())
+	assert.False(t, ok)
+
+	// .. but those with errors are, as sync errors
+	errs := []event.ResourceError{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		errs = append(errs, event.ResourceError{
+			ID:    flux.MustParseResourceID("default:deployment/" + name),
+			Path:  name + ".yaml",
+			Line:  3,
+			Error: "invalid",
+		})
+	}
+	msg, ok := d.message(syncEvent(errs...))
+	assert.True(t, ok)
+	assert.Equal(t, KindSyncError, msg.Kind)
+	assert.True(t, msg.IsError)
+	assert.Contains(t, msg.Text, "default:deployment/a (a.yaml:3): invalid")
+	assert.NotContains(t, msg.Text, "default:deployment/f")
+	assert.Contains(t, msg.Text, "... and 2 more")
+
+	msg, ok = d.message(releaseEvent())
+	assert.True(t, ok)
+	assert.Equal(t, event.EventRelease, msg.Kind)
+	assert.False(t, msg.IsError)
+
+	// Events from a cluster with an ID say so
+	ev := releaseEvent()
+	ev.ClusterID = "prod-eu-1"
+	msg, _ = d.message(ev)
+	assert.True(t, strings.HasPrefix(msg.Text, "[prod-eu-1] "), msg.Text)
+
+	// When all syncs are wanted, but not sync errors in particular,
+	// a sync with errors is notified of as a sync
+	d, _ = New(Config{Kinds: []string{event.EventSync}}, log.NewNopLogger())
+	msg, ok = d.message(syncEvent(errs[0]))
+	assert.True(t, ok)
+	assert.Equal(t, event.EventSync, msg.Kind)
+	assert.True(t, msg.IsError)
+	_, ok = d.message(releaseEvent())
+	assert.False(t, ok)
+}
+
+func TestDispatcher_Template(t *testing.T) {
+	tmpl, err := ParseTemplate(event.EventRelease, `{{.Kind}} of {{join .Workloads ","}}`)
+	assert.Error(t, err, "functions not given aren't available")
+
+	tmpl, err = ParseTemplate(event.EventRelease, `{{.Kind}} of {{range .Workloads}}{{.}}{{end}}: {{.Text}}`)
+	assert.NoError(t, err)
+	broken, err := ParseTemplate(event.EventRollback, `{{.Event.Metadata.Nonesuch}}`)
+	assert.NoError(t, err)
+
+	d, _ := New(Config{Templates: map[string]*template.Template{
+		event.EventRelease:  tmpl,
+		event.EventRollback: broken,
+	}}, log.NewNopLogger())
+	ev := releaseEvent()
+	msg, _ := d.message(ev)
+	assert.Equal(t, "release of default:deployment/helloworld: "+ev.String(), msg.Text)
+
+	// A template that can't be executed gives way to the default text
+	ev.Type = event.EventRollback
+	msg, _ = d.message(ev)
+	assert.Equal(t, ev.String(), msg.Text)
+}
+
+func TestTargets(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies = map[string]map[string]interface{}{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "no such hook", http.StatusNotFound)
+			return
+		}
+		bs, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(bs, &body); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		bodies[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	var targets []Target
+	for _, kind := range []string{TargetSlack, TargetMSTeams, TargetWebhook} {
+		target, err := NewTarget(kind, server.URL+"/"+kind+"?secret", nil)
+		assert.NoError(t, err)
+		assert.NotContains(t, target.String(), "secret")
+		targets = append(targets, target)
+	}
+	failing, _ := NewTarget(TargetWebhook, server.URL+"/fail", nil)
+	targets = append(targets, failing)
+
+	_, err := NewTarget(TargetSlack, "hooks.slack.com/services/x", nil)
+	assert.Error(t, err)
+	_, err = NewTarget("irc", server.URL, nil)
+	assert.Error(t, err)
+
+	d, _ := New(Config{Targets: targets}, log.NewNopLogger())
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go d.Loop(stop, wg)
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	d.Notify(syncEvent()) // not notified of
+	d.Notify(releaseEvent())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(bodies)
+		mu.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected three notifications, got %d", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	attachments := bodies["/slack"]["attachments"].([]interface{})
+	assert.Equal(t, "released", attachments[0].(map[string]interface{})["text"])
+	assert.Equal(t, colourOK, attachments[0].(map[string]interface{})["color"])
+	assert.Equal(t, "MessageCard", bodies["/msteams"]["@type"])
+	assert.Equal(t, event.EventRelease, bodies["/webhook"]["kind"])
+	assert.Equal(t, false, bodies["/webhook"]["error"])
+	assert.NotNil(t, bodies["/webhook"]["event"])
+}
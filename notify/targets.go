@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// Kinds of target
+const (
+	TargetSlack   = "slack"
+	TargetMSTeams = "msteams"
+	TargetWebhook = "webhook"
+)
+
+// Colours used by Slack and Teams for notifications of errors, and
+// of everything else
+const (
+	colourError = "#d0021b"
+	colourOK    = "#4a90e2"
+)
+
+// NewTarget makes a target of the kind given (one of the Target*
+// constants), that posts to the URL given.
+func NewTarget(kind, targetURL string, client *http.Client) (Target, error) {
+	u, err := url.Parse(targetURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s URL; expected an http(s) URL", kind)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	t := poster{url: targetURL, host: u.Host, client: client}
+	switch kind {
+	case TargetSlack:
+		return &slack{t}, nil
+	case TargetMSTeams:
+		return &msteams{t}, nil
+	case TargetWebhook:
+		return &webhook{t}, nil
+	}
+	return nil, fmt.Errorf("unknown kind of notification target %q", kind)
+}
+
+type poster struct {
+	url    string
+	host   string
+	client *http.Client
+}
+
+func (p poster) post(ctx context.Context, name string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		// The error includes the URL, which may be secret
+		return fmt.Errorf("sending notification to %s at %s failed", name, p.host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s at %s responded with %s: %s", name, p.host, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func colour(msg Message) string {
+	if msg.IsError {
+		return colourError
+	}
+	return colourOK
+}
+
+// slack posts to a Slack incoming webhook.
+type slack struct {
+	poster
+}
+
+func (s *slack) Send(ctx context.Context, msg Message) error {
+	return s.post(ctx, TargetSlack, map[string]interface{}{
+		"username": "Flux",
+		"attachments": []map[string]interface{}{{
+			"fallback": msg.Text,
+			"text":     msg.Text,
+			"color":    colour(msg),
+		}},
+	})
+}
+
+func (s *slack) String() string {
+	return TargetSlack
+}
+
+// msteams posts a message card to a Microsoft Teams incoming webhook.
+type msteams struct {
+	poster
+}
+
+func (t *msteams) Send(ctx context.Context, msg Message) error {
+	return t.post(ctx, TargetMSTeams, map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    "Flux " + msg.Kind,
+		"themeColor": colour(msg)[1:],
+		"title":      "Flux " + msg.Kind,
+		"text":       msg.Text,
+	})
+}
+
+func (t *msteams) String() string {
+	return TargetMSTeams
+}
+
+// webhook posts the event, and the text of the notification, as JSON.
+type webhook struct {
+	poster
+}
+
+func (w *webhook) Send(ctx context.Context, msg Message) error {
+	return w.post(ctx, TargetWebhook, map[string]interface{}{
+		"kind":  msg.Kind,
+		"text":  msg.Text,
+		"error": msg.IsError,
+		"event": msg.Event,
+	})
+}
+
+func (w *webhook) String() string {
+	return TargetWebhook + " " + w.host
+}
@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/image"
+)
+
+// The values for the TagSort policy
+const (
+	SortByCreated = "created"
+	SortBySemver  = "semver"
+	// Given as `timestamp:<regexp>` or `timestamp(<layout>):<regexp>`
+	SortByTimestamp = "timestamp"
+)
+
+// The layout for timestamps given as seconds since the epoch; this is
+// the default
+const layoutUnix = "unix"
+
+// WithOrdering returns the pattern given, ordering images as the
+// TagSort policy says, if it's set.
+func WithOrdering(policies Set, pattern Pattern) Pattern {
+	value, _ := policies.Get(TagSort)
+	switch {
+	case value == SortBySemver:
+		return semverOrdered{pattern}
+	case strings.HasPrefix(value, SortByTimestamp):
+		ts, err := parseTimestampOrder(value)
+		if err != nil {
+			// An invalid ordering can't be set with fluxctl; if it's
+			// been put in the manifest by hand, fall back to the
+			// usual ordering.
+			return pattern
+		}
+		return timestampOrdered{pattern, ts}
+	}
+	return pattern
+}
+
+// ValidTagSort reports whether the value given is a valid value for
+// the TagSort policy.
+func ValidTagSort(value string) bool {
+	if strings.HasPrefix(value, SortByTimestamp) {
+		_, err := parseTimestampOrder(value)
+		return err == nil
+	}
+	return value == SortByCreated || value == SortBySemver
+}
+
+// OrdersByTag reports whether the pattern orders images by their
+// tags, rather than by when they were created, so doesn't need images
+// to have creation times.
+func OrdersByTag(p Pattern) bool {
+	switch p.(type) {
+	case SemverPattern, semverOrdered, timestampOrdered:
+		return true
+	}
+	return false
+}
+
+// semverOrdered filters images with another pattern, but orders them
+// by the semantic versions in their tags.
+type semverOrdered struct {
+	Pattern
+}
+
+func (s semverOrdered) Newer(a, b *image.Info) bool {
+	return image.NewerBySemver(a, b)
+}
+
+// timestampOrder extracts timestamps from tags, e.g., the `1551095237`
+// in `master-1a2b3c4-1551095237`. The timestamp is the first
+// subexpression of the regular expression (or the whole match, if it
+// has none), and is parsed using the layout, which is either `unix`
+// for seconds since the epoch, or a Go time layout, e.g.,
+// `20060102150405`.
+type timestampOrder struct {
+	re     *regexp.Regexp
+	layout string
+}
+
+func parseTimestampOrder(value string) (timestampOrder, error) {
+	spec := strings.TrimPrefix(value, SortByTimestamp)
+	layout := layoutUnix
+	if strings.HasPrefix(spec, "(") {
+		end := strings.Index(spec, ")")
+		if end < 0 {
+			return timestampOrder{}, errors.Errorf("unclosed layout in %q", value)
+		}
+		layout, spec = spec[1:end], spec[end+1:]
+	}
+	if !strings.HasPrefix(spec, ":") {
+		return timestampOrder{}, errors.Errorf("expected %s:<regexp> or %s(<layout>):<regexp>, got %q", SortByTimestamp, SortByTimestamp, value)
+	}
+	re, err := regexp.Compile(spec[1:])
+	if err != nil {
+		return timestampOrder{}, errors.Wrapf(err, "regular expression in %q", value)
+	}
+	return timestampOrder{re: re, layout: layout}, nil
+}
+
+// timestamp gives the time in the tag, if there is one.
+func (o timestampOrder) timestamp(tag string) (time.Time, bool) {
+	m := o.re.FindStringSubmatch(tag)
+	if m == nil {
+		return time.Time{}, false
+	}
+	s := m[0]
+	if len(m) > 1 {
+		s = m[1]
+	}
+	if o.layout == layoutUnix {
+		secs, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(secs, 0), true
+	}
+	t, err := time.Parse(o.layout, s)
+	return t, err == nil
+}
+
+// timestampOrdered filters images with another pattern, but orders
+// them by the timestamps in their tags. Images with a timestamp are
+// considered newer than those without; those without are ordered by
+// when they were created.
+type timestampOrdered struct {
+	Pattern
+	order timestampOrder
+}
+
+func (t timestampOrdered) Newer(a, b *image.Info) bool {
+	at, aok := t.order.timestamp(a.ID.Tag)
+	bt, bok := t.order.timestamp(b.ID.Tag)
+	switch {
+	case !aok && !bok:
+		return image.NewerByCreated(a, b)
+	case aok != bok:
+		return aok
+	case at.Equal(bt):
+		return a.ID.String() < b.ID.String()
+	}
+	return at.After(bt)
+}
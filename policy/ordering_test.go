@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+)
+
+func mustInfo(t *testing.T, ref string, created time.Time) image.Info {
+	id, err := image.ParseRef(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return image.Info{ID: id, CreatedAt: created}
+}
+
+func tags(infos []image.Info) []string {
+	var ts []string
+	for _, i := range infos {
+		ts = append(ts, i.ID.Tag)
+	}
+	return ts
+}
+
+func TestOrdersByTag(t *testing.T) {
+	assert.False(t, OrdersByTag(NewPattern("glob:*")))
+	assert.True(t, OrdersByTag(NewPattern("semver:~1")))
+	assert.True(t, OrdersByTag(GetTagPattern(Set{TagSort: SortBySemver}, "app")))
+	assert.True(t, OrdersByTag(GetTagPattern(Set{TagSort: `timestamp:-(\d+)$`}, "app")))
+}
+
+func TestValidTagSort(t *testing.T) {
+	for value, valid := range map[string]bool{
+		SortByCreated:                          true,
+		SortBySemver:                           true,
+		`timestamp:-(\d+)$`:                    true,
+		`timestamp(20060102150405):-(\d{14})$`: true,
+		"":                                     false,
+		"alphabetical":                         false,
+		"timestamp":                            false,
+		`timestamp:-(\d+$`:                     false,
+		`timestamp(20060102:-(\d+)$`:           false,
+	} {
+		assert.Equal(t, valid, ValidTagSort(value), value)
+	}
+}
+
+func TestTimestampOrdering(t *testing.T) {
+	// The registry's creation times are the wrong way around, as
+	// can happen when they are made up
+	created := time.Now()
+	infos := []image.Info{
+		mustInfo(t, "my/image:master-0a1b2c3-1551000000", created.Add(3*time.Hour)),
+		mustInfo(t, "my/image:master-4d5e6f7-1551090000", created.Add(2*time.Hour)),
+		mustInfo(t, "my/image:latest", created.Add(time.Hour)),
+		mustInfo(t, "my/image:master-8a9b0c1-1551000500", created),
+	}
+
+	pattern := GetTagPattern(Set{TagSort: `timestamp:^master-[0-9a-f]+-(\d+)$`}, "app")
+	image.Sort(infos, pattern.Newer)
+	assert.Equal(t, []string{
+		"master-4d5e6f7-1551090000",
+		"master-8a9b0c1-1551000500",
+		"master-0a1b2c3-1551000000",
+		"latest",
+	}, tags(infos))
+
+	// With a layout
+	infos = []image.Info{
+		mustInfo(t, "my/image:build-20190301093000", created),
+		mustInfo(t, "my/image:build-20190302080000", created),
+	}
+	pattern = GetTagPattern(Set{TagSort: `timestamp(20060102150405):^build-(\d{14})$`}, "app")
+	image.Sort(infos, pattern.Newer)
+	assert.Equal(t, []string{"build-20190302080000", "build-20190301093000"}, tags(infos))
+}
@@ -4,14 +4,17 @@ import (
 	"github.com/Masterminds/semver"
 	"github.com/ryanuber/go-glob"
 	"github.com/weaveworks/flux/image"
-	"strings"
 	"regexp"
+	"strings"
 )
 
 const (
 	globPrefix   = "glob:"
 	semverPrefix = "semver:"
 	regexpPrefix = "regexp:"
+	// Also accepted for regular expressions, since it's easily
+	// mistaken for the above
+	regexPrefix = "regex:"
 )
 
 var (
@@ -43,21 +46,21 @@ type SemverPattern struct {
 
 // RegexpPattern matches by regular expression.
 type RegexpPattern struct {
-	pattern	string // pattern without prefix
-	regexp	*regexp.Regexp
+	pattern string // pattern without prefix
+	regexp  *regexp.Regexp
 }
 
 // NewPattern instantiates a Pattern according to the prefix
 // it finds. The prefix can be either `glob:` (default if omitted),
-// `semver:` or `regexp:`.
+// `semver:` or `regexp:` (or `regex:`).
 func NewPattern(pattern string) Pattern {
 	switch {
 	case strings.HasPrefix(pattern, semverPrefix):
 		pattern = strings.TrimPrefix(pattern, semverPrefix)
 		c, _ := semver.NewConstraint(pattern)
 		return SemverPattern{pattern, c}
-	case strings.HasPrefix(pattern, regexpPrefix):
-		pattern = strings.TrimPrefix(pattern, regexpPrefix)
+	case strings.HasPrefix(pattern, regexpPrefix), strings.HasPrefix(pattern, regexPrefix):
+		pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, regexpPrefix), regexPrefix)
 		r, _ := regexp.Compile(pattern)
 		return RegexpPattern{pattern, r}
 	default:
@@ -106,6 +106,12 @@ func TestRegexpPattern_Matches(t *testing.T) {
 			true:    []string{"foo", "BAR", "fooBAR"},
 			false:   []string{"1", "foo-1"},
 		},
+		{
+			name:    "regex",
+			pattern: `regex:^v\d+`,
+			true:    []string{"v1", "v23.1"},
+			false:   []string{"1", "latest"},
+		},
 	} {
 		pattern := NewPattern(tt.pattern)
 		assert.IsType(t, RegexpPattern{}, pattern)
@@ -121,3 +127,8 @@ func TestRegexpPattern_Matches(t *testing.T) {
 		}
 	}
 }
+
+func TestRegexPrefix_String(t *testing.T) {
+	assert.Equal(t, `regexp:^v\d+`, NewPattern(`regex:^v\d+`).String())
+	assert.False(t, NewPattern("regex:^v(").Valid())
+}
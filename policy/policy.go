@@ -2,7 +2,9 @@ package policy
 
 import (
 	"encoding/json"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/weaveworks/flux"
 )
@@ -14,6 +16,42 @@ const (
 	LockedMsg  = Policy("locked_msg")
 	Automated  = Policy("automated")
 	TagAll     = Policy("tag_all")
+	// LockedUntil is when a lock expires, as an RFC3339 timestamp;
+	// the daemon unlocks the workload once it has passed.
+	LockedUntil = Policy("locked_until")
+	// TagSort is how to order images when picking the newest; either
+	// by when they were created (the default), or by the semantic
+	// versions in their tags.
+	TagSort = Policy("tag_sort")
+	// SyncInterval is how often to reapply a resource that hasn't
+	// changed, e.g., "1h"; by default, it's applied on every sync.
+	SyncInterval = Policy("sync_interval")
+	// ScanImages, if "false", means the images used by a workload
+	// aren't scanned for metadata, unless other workloads use them.
+	ScanImages = Policy("scan_images")
+	// PinDigest means images are updated to their digest as well as
+	// their tag, e.g., `repo:1.0@sha256:...`, so the workload runs
+	// exactly the image that was scanned, even if the tag is later
+	// pushed again.
+	PinDigest = Policy("pin_digest")
+	// AutomationWindow is when automated image updates may be made,
+	// as cron-like expressions (see Window), e.g., `* 9-16 * * 1-5`.
+	// Outside the window, updates are held until it opens.
+	AutomationWindow = Policy("automation_window")
+	// IgnoreFields are fields of a resource to leave out when it's
+	// applied, and leave alone in the cluster, since something else
+	// looks after them; given as dotted paths separated by commas,
+	// e.g., `spec.replicas,spec.template.metadata.annotations`.
+	IgnoreFields = Policy("ignore_fields")
+	// RollbackOnFailure, if "true" or a duration, means that if the
+	// rollout of an automated image update fails, or doesn't finish
+	// within the duration (or the daemon's default), the update is
+	// reverted with another commit.
+	RollbackOnFailure = Policy("rollback_on_failure")
+	// Substitute means `${NAME}` placeholders in the resource's
+	// manifest are replaced, when it's applied, with the values of
+	// the variables fluxd has been given (e.g., from a ConfigMap).
+	Substitute = Policy("substitute")
 )
 
 // Policy is an string, denoting the current deployment policy of a service,
@@ -22,12 +60,27 @@ type Policy string
 
 func Boolean(policy Policy) bool {
 	switch policy {
-	case Locked, Automated, Ignore:
+	case Locked, Automated, Ignore, PinDigest, Substitute:
 		return true
 	}
 	return false
 }
 
+// LockExpired reports whether the policies given include a lock with
+// an expiry, and it has passed by the time given. A lock with an
+// expiry that can't be parsed doesn't expire.
+func LockExpired(policies Set, now time.Time) bool {
+	if !policies.Has(Locked) {
+		return false
+	}
+	until, ok := policies.Get(LockedUntil)
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, until)
+	return err == nil && !now.Before(t)
+}
+
 func TagPrefix(container string) Policy {
 	return Policy("tag." + container)
 }
@@ -36,15 +89,63 @@ func Tag(policy Policy) bool {
 	return strings.HasPrefix(string(policy), "tag.")
 }
 
+// IgnoreContainerPrefix gives the policy that, if "true", leaves the
+// container named out of image listings, automated updates and
+// releases; e.g., for a sidecar injected by a service mesh, which is
+// looked after by something else.
+func IgnoreContainerPrefix(container string) Policy {
+	return Policy("ignore_container." + container)
+}
+
+// IgnoresContainer reports whether the policies leave the container
+// named out of image listings and updates.
+func IgnoresContainer(policies Set, container string) bool {
+	v, ok := policies.Get(IgnoreContainerPrefix(container))
+	return ok && v == "true"
+}
+
+// The form of a tag, as in the Docker distribution reference grammar
+var tagRegexp = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+// TagPinPrefix gives the policy that pins the container named to the
+// tag given as its value. Automated updates, and releases of all
+// images, will only ever update the container to that tag; unlike a
+// lock, it doesn't stop the container being released to a particular
+// image, and the pin then moves to the tag released.
+func TagPinPrefix(container string) Policy {
+	return Policy("tag_pin." + container)
+}
+
+// ValidPinnedTag reports whether the tag given can be pinned; that
+// is, whether it's a tag an image could have.
+func ValidPinnedTag(tag string) bool {
+	return tagRegexp.MatchString(tag)
+}
+
+// PinnedTag gives the tag the container named is pinned to, if it is.
+func PinnedTag(policies Set, container string) (string, bool) {
+	tag, ok := policies.Get(TagPinPrefix(container))
+	if !ok || !ValidPinnedTag(tag) {
+		return "", false
+	}
+	return tag, true
+}
+
+// GetTagPattern gives the pattern for the tags the container named
+// may be updated to: only its pinned tag, if it's pinned, or
+// otherwise those matching its tag filter.
 func GetTagPattern(policies Set, container string) Pattern {
 	if policies == nil {
 		return PatternAll
 	}
+	if tag, ok := PinnedTag(policies, container); ok {
+		return NewPattern(globPrefix + tag)
+	}
 	pattern, ok := policies.Get(TagPrefix(container))
 	if !ok {
-		return PatternAll
+		return WithOrdering(policies, PatternAll)
 	}
-	return NewPattern(pattern)
+	return WithOrdering(policies, NewPattern(pattern))
 }
 
 type Updates map[flux.ResourceID]Update
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -81,6 +82,45 @@ func Test_GetTagPattern(t *testing.T) {
 			},
 			want: NewPattern("master-*"),
 		},
+		{
+			name: "Ordered by semver",
+			args: args{
+				policies: Set{
+					Policy(fmt.Sprintf("tag.%s", container)): "glob:master-*",
+					TagSort:                                  SortBySemver,
+				},
+				container: container,
+			},
+			want: semverOrdered{NewPattern("master-*")},
+		},
+		{
+			name: "No match, ordered by semver",
+			args: args{
+				policies:  Set{TagSort: SortBySemver},
+				container: container,
+			},
+			want: semverOrdered{PatternAll},
+		},
+		{
+			name: "Ordered by creation",
+			args: args{
+				policies:  Set{TagSort: SortByCreated},
+				container: container,
+			},
+			want: PatternAll,
+		},
+		{
+			name: "Pinned, whatever the filter",
+			args: args{
+				policies: Set{
+					Policy(fmt.Sprintf("tag.%s", container)): "glob:master-*",
+					TagPinPrefix(container):                  "1.2.3",
+					TagSort:                                  SortBySemver,
+				},
+				container: container,
+			},
+			want: NewPattern("1.2.3"),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -88,3 +128,56 @@ func Test_GetTagPattern(t *testing.T) {
 		})
 	}
 }
+
+func TestLockExpired(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		policies Set
+		expired  bool
+	}{
+		{Set{}, false},
+		{Set{Locked: "true"}, false},
+		{Set{Locked: "true", LockedUntil: "2019-06-01T11:00:00Z"}, true},
+		{Set{Locked: "true", LockedUntil: "2019-06-01T12:00:00Z"}, true},
+		{Set{Locked: "true", LockedUntil: "2019-06-01T13:00:00+02:00"}, true},
+		{Set{Locked: "true", LockedUntil: "2019-06-01T13:00:00Z"}, false},
+		{Set{Locked: "true", LockedUntil: "tomorrow"}, false},
+		{Set{LockedUntil: "2019-06-01T11:00:00Z"}, false},
+	} {
+		if got := LockExpired(c.policies, now); got != c.expired {
+			t.Errorf("%v: expected expired = %v, got %v", c.policies, c.expired, got)
+		}
+	}
+}
+
+func TestIgnoresContainer(t *testing.T) {
+	policies := Set{}.
+		Add(IgnoreContainerPrefix("istio-proxy")).
+		Set(IgnoreContainerPrefix("linkerd-proxy"), "false")
+	for container, expected := range map[string]bool{
+		"istio-proxy":   true,
+		"linkerd-proxy": false,
+		"app":           false,
+	} {
+		if got := IgnoresContainer(policies, container); got != expected {
+			t.Errorf("%s: expected %v, got %v", container, expected, got)
+		}
+	}
+	if IgnoresContainer(nil, "app") {
+		t.Error("expected no containers to be ignored without policies")
+	}
+}
+
+func TestPinnedTag(t *testing.T) {
+	policies := Set{}.
+		Set(TagPinPrefix("app"), "1.2.3").
+		Set(TagPinPrefix("sidecar"), "not a tag")
+	if tag, ok := PinnedTag(policies, "app"); !ok || tag != "1.2.3" {
+		t.Errorf("expected app to be pinned to 1.2.3, got %q, %v", tag, ok)
+	}
+	for _, container := range []string{"sidecar", "other"} {
+		if tag, ok := PinnedTag(policies, container); ok {
+			t.Errorf("expected %s not to be pinned, got %q", container, tag)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is a set of times, given as cron-like expressions, e.g.,
+// `* 9-16 * * MON-FRI` for (UTC) business hours. Each expression has
+// five fields: minute, hour, day of the month, month and day of the
+// week; a time is in the window if its minute matches any of the
+// expressions. The expressions are separated by `;`, and may be
+// preceded by `TZ=<location> ` to give the time zone they're in.
+type Window struct {
+	source   string
+	location *time.Location
+	specs    []windowSpec
+}
+
+// windowSpec is a single cron-like expression; each field is the set
+// of values matched.
+type windowSpec struct {
+	minute, hour, dom, month, dow map[int]bool
+	// If both the day of the month and the day of the week are
+	// restricted, a day matching either will do, as for cron.
+	domAny, dowAny bool
+}
+
+var (
+	monthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	dayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// ParseWindow parses a window given as one or more cron-like
+// expressions (see Window).
+func ParseWindow(s string) (*Window, error) {
+	w := &Window{source: s, location: time.UTC}
+	expr := strings.TrimSpace(s)
+	for _, prefix := range []string{"TZ=", "CRON_TZ="} {
+		if strings.HasPrefix(expr, prefix) {
+			fields := strings.SplitN(expr[len(prefix):], " ", 2)
+			loc, err := time.LoadLocation(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid time zone in window %q: %s", s, err)
+			}
+			w.location = loc
+			expr = ""
+			if len(fields) == 2 {
+				expr = fields[1]
+			}
+			break
+		}
+	}
+	for _, part := range strings.Split(expr, ";") {
+		spec, err := parseWindowSpec(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %s", s, err)
+		}
+		w.specs = append(w.specs, spec)
+	}
+	return w, nil
+}
+
+func parseWindowSpec(expr string) (windowSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return windowSpec{}, fmt.Errorf("expected five fields (minute, hour, day of month, month, day of week), got %d", len(fields))
+	}
+	var spec windowSpec
+	var err error
+	if spec.minute, err = parseWindowField(fields[0], 0, 59, nil); err != nil {
+		return spec, err
+	}
+	if spec.hour, err = parseWindowField(fields[1], 0, 23, nil); err != nil {
+		return spec, err
+	}
+	if spec.dom, err = parseWindowField(fields[2], 1, 31, nil); err != nil {
+		return spec, err
+	}
+	if spec.month, err = parseWindowField(fields[3], 1, 12, monthNames); err != nil {
+		return spec, err
+	}
+	// Sunday is 0 or 7
+	if spec.dow, err = parseWindowField(fields[4], 0, 7, dayNames); err != nil {
+		return spec, err
+	}
+	if spec.dow[7] {
+		spec.dow[0] = true
+	}
+	spec.domAny, spec.dowAny = fields[2] == "*", fields[4] == "*"
+	return spec, nil
+}
+
+// parseWindowField parses a comma-separated list of values, ranges
+// (`a-b`) or `*`, each optionally with a step (`/n`).
+func parseWindowField(field string, min, max int, names map[string]int) (map[int]bool, error) {
+	values := map[int]bool{}
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%q is not a number from %d to %d", s, min, max)
+		}
+		return n, nil
+	}
+	for _, item := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if slash := strings.Index(item, "/"); slash >= 0 {
+			n, err := strconv.Atoi(item[slash+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", item)
+			}
+			step, stepped, item = n, true, item[:slash]
+		}
+		from, to := min, max
+		if item != "*" {
+			var err error
+			bounds := strings.SplitN(item, "-", 2)
+			if from, err = value(bounds[0]); err != nil {
+				return nil, err
+			}
+			// As for cron, `a/n` means from a to the maximum, in
+			// steps of n
+			to = from
+			if stepped {
+				to = max
+			}
+			if len(bounds) == 2 {
+				if to, err = value(bounds[1]); err != nil {
+					return nil, err
+				}
+			}
+			if to < from {
+				return nil, fmt.Errorf("invalid range %q", item)
+			}
+		}
+		for n := from; n <= to; n += step {
+			values[n] = true
+		}
+	}
+	return values, nil
+}
+
+// Contains reports whether the time given is in the window.
+func (w *Window) Contains(t time.Time) bool {
+	t = t.In(w.location)
+	for _, spec := range w.specs {
+		if spec.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s windowSpec) matches(t time.Time) bool {
+	if !s.minute[t.Minute()] || !s.hour[t.Hour()] || !s.month[int(t.Month())] {
+		return false
+	}
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	switch {
+	case s.domAny || s.dowAny:
+		return dom && dow
+	default:
+		return dom || dow
+	}
+}
+
+func (w *Window) String() string {
+	return w.source
+}
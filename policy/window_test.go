@@ -0,0 +1,90 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow_Contains(t *testing.T) {
+	// 2019-03-01 is a Friday
+	at := func(s string) time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	for _, tt := range []struct {
+		window string
+		in     []string
+		out    []string
+	}{
+		{
+			window: "* 9-16 * * MON-FRI",
+			in:     []string{"2019-03-01T09:00:00Z", "2019-03-01T16:59:00Z", "2019-03-04T12:30:00Z"},
+			out:    []string{"2019-03-01T08:59:00Z", "2019-03-01T17:00:00Z", "2019-03-02T12:00:00Z"},
+		},
+		{
+			window: "*/15 * * * *",
+			in:     []string{"2019-03-01T09:00:00Z", "2019-03-01T09:45:00Z"},
+			out:    []string{"2019-03-01T09:01:00Z"},
+		},
+		{
+			window: "30/10 0 * * *",
+			in:     []string{"2019-03-01T00:30:00Z", "2019-03-01T00:50:00Z"},
+			out:    []string{"2019-03-01T00:20:00Z", "2019-03-01T00:35:00Z"},
+		},
+		{
+			// Either the first of the month, or a Sunday
+			window: "* * 1 * 0",
+			in:     []string{"2019-03-01T12:00:00Z", "2019-03-03T12:00:00Z"},
+			out:    []string{"2019-03-02T12:00:00Z"},
+		},
+		{
+			window: "* * * 1-11 *; * * 1-15 dec *",
+			in:     []string{"2019-03-01T12:00:00Z", "2019-12-15T23:59:00Z"},
+			out:    []string{"2019-12-16T00:00:00Z", "2019-12-25T12:00:00Z"},
+		},
+		{
+			window: "TZ=America/New_York * 9-16 * * 1-5",
+			in:     []string{"2019-03-01T14:00:00Z"},
+			out:    []string{"2019-03-01T09:00:00Z"},
+		},
+		{
+			// Sunday can be 7
+			window: "* * * * 7",
+			in:     []string{"2019-03-03T12:00:00Z"},
+			out:    []string{"2019-03-01T12:00:00Z"},
+		},
+	} {
+		w, err := ParseWindow(tt.window)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.window, err)
+		}
+		for _, s := range tt.in {
+			assert.True(t, w.Contains(at(s)), "%s should contain %s", tt.window, s)
+		}
+		for _, s := range tt.out {
+			assert.False(t, w.Contains(at(s)), "%s should not contain %s", tt.window, s)
+		}
+	}
+}
+
+func TestParseWindow_Errors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * foo *",
+		"* 17-9 * * *",
+		"*/0 * * * *",
+		"TZ=Nowhere/Special * * * * *",
+	} {
+		_, err := ParseWindow(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,157 @@
+// Package pullrequest opens pull requests (merge requests, in GitLab)
+// with the git hosting provider, so that changes can be proposed to a
+// branch that can't be pushed to directly, e.g., because it is
+// protected.
+package pullrequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+// ErrAlreadyOpen is returned by Open when there is already an open
+// pull request for the branch given.
+var ErrAlreadyOpen = errors.New("pull request already open")
+
+// PullRequest proposes merging the branch Head into the branch Base.
+type PullRequest struct {
+	Head  string
+	Base  string
+	Title string
+	Body  string
+}
+
+// Opener opens pull requests, returning the URL of the pull request
+// opened.
+type Opener interface {
+	Open(ctx context.Context, pr PullRequest) (string, error)
+}
+
+// Config describes where, and as whom, to open pull requests.
+type Config struct {
+	Provider string // one of the Provider* constants
+	APIURL   string // base URL of the API; the public service is used if empty
+	Repo     string // "owner/name" (GitHub) or "group/project" (GitLab)
+	Token    string
+}
+
+// New creates an Opener for the provider given in the config.
+func New(config Config, client *http.Client) (Opener, error) {
+	if config.Repo == "" {
+		return nil, fmt.Errorf("no repository given for pull requests")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	switch config.Provider {
+	case ProviderGitHub:
+		if config.APIURL == "" {
+			config.APIURL = "https://api.github.com"
+		}
+		return &github{config, client}, nil
+	case ProviderGitLab:
+		if config.APIURL == "" {
+			config.APIURL = "https://gitlab.com/api/v4"
+		}
+		return &gitlab{config, client}, nil
+	}
+	return nil, fmt.Errorf("unknown pull request provider %q (expected %q or %q)", config.Provider, ProviderGitHub, ProviderGitLab)
+}
+
+type github struct {
+	Config
+	client *http.Client
+}
+
+func (g *github) Open(ctx context.Context, pr PullRequest) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"title": pr.Title,
+		"head":  pr.Head,
+		"base":  pr.Base,
+		"body":  pr.Body,
+	})
+	if err != nil {
+		return "", err
+	}
+	u := fmt.Sprintf("%s/repos/%s/pulls", strings.TrimSuffix(g.APIURL, "/"), g.Repo)
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "token "+g.Token)
+	}
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	// GitHub responds with 422 Unprocessable Entity for (amongst
+	// other things) a pull request that already exists.
+	if err := do(ctx, g.client, req, http.StatusUnprocessableEntity, "A pull request already exists", &created); err != nil {
+		return "", err
+	}
+	return created.HTMLURL, nil
+}
+
+type gitlab struct {
+	Config
+	client *http.Client
+}
+
+func (g *gitlab) Open(ctx context.Context, pr PullRequest) (string, error) {
+	form := url.Values{}
+	form.Set("source_branch", pr.Head)
+	form.Set("target_branch", pr.Base)
+	form.Set("title", pr.Title)
+	form.Set("description", pr.Body)
+	form.Set("remove_source_branch", "true")
+	u := fmt.Sprintf("%s/projects/%s/merge_requests", strings.TrimSuffix(g.APIURL, "/"), url.PathEscape(g.Repo))
+	req, err := http.NewRequest("POST", u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if g.Token != "" {
+		req.Header.Set("Private-Token", g.Token)
+	}
+	var created struct {
+		WebURL string `json:"web_url"`
+	}
+	if err := do(ctx, g.client, req, http.StatusConflict, "already exists", &created); err != nil {
+		return "", err
+	}
+	return created.WebURL, nil
+}
+
+// do sends the request and decodes the response into `into`. A
+// response with the status code given, and a message containing
+// alreadyMsg, means the pull request already exists.
+func do(ctx context.Context, client *http.Client, req *http.Request, alreadyStatus int, alreadyMsg string, into interface{}) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode == alreadyStatus && strings.Contains(string(msg), alreadyMsg) {
+			return ErrAlreadyOpen
+		}
+		return fmt.Errorf("opening pull request: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(into)
+}
@@ -0,0 +1,89 @@
+package pullrequest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGitHubOpen(t *testing.T) {
+	var path string
+	var body map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.Header.Get("Authorization") != "token s3cr3t" {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url": "https://github.com/weaveworks/flux/pull/1"}`))
+	}))
+	defer srv.Close()
+
+	o, err := New(Config{Provider: ProviderGitHub, APIURL: srv.URL, Repo: "weaveworks/flux", Token: "s3cr3t"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := o.Open(context.Background(), PullRequest{Head: "flux-update-abc", Base: "master", Title: "Update images"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "https://github.com/weaveworks/flux/pull/1" {
+		t.Errorf("unexpected URL %q", u)
+	}
+	if path != "/repos/weaveworks/flux/pulls" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if body["head"] != "flux-update-abc" || body["base"] != "master" || body["title"] != "Update images" {
+		t.Errorf("unexpected body %+v", body)
+	}
+}
+
+func TestGitHubAlreadyOpen(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message":"Validation Failed","errors":[{"message":"A pull request already exists for weaveworks:flux-update-abc."}]}`))
+	}))
+	defer srv.Close()
+
+	o, err := New(Config{Provider: ProviderGitHub, APIURL: srv.URL, Repo: "weaveworks/flux"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Open(context.Background(), PullRequest{Head: "flux-update-abc", Base: "master"}); err != ErrAlreadyOpen {
+		t.Errorf("expected ErrAlreadyOpen, got %v", err)
+	}
+}
+
+func TestGitLabOpen(t *testing.T) {
+	var path, source, target string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		r.ParseForm()
+		source = r.PostForm.Get("source_branch")
+		target = r.PostForm.Get("target_branch")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"web_url": "https://gitlab.com/group/project/merge_requests/1"}`))
+	}))
+	defer srv.Close()
+
+	o, err := New(Config{Provider: ProviderGitLab, APIURL: srv.URL, Repo: "group/project"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := o.Open(context.Background(), PullRequest{Head: "flux-update-abc", Base: "master"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "https://gitlab.com/group/project/merge_requests/1" {
+		t.Errorf("unexpected URL %q", u)
+	}
+	if path != "/projects/group%2Fproject/merge_requests" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if source != "flux-update-abc" || target != "master" {
+		t.Errorf("unexpected branches %q -> %q", source, target)
+	}
+}
@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"encoding/base64"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// ecrHostRegexp matches the hosts of ECR registries, capturing the
+// account ID, the region and the suffix for the partition (`.cn` for
+// China). The SDK works out the partition from the region.
+var ecrHostRegexp = regexp.MustCompile(`^([0-9]{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// AWSRegistryConfig says which ECR registries to get credentials for.
+type AWSRegistryConfig struct {
+	// Only registries in these regions; all regions, if empty
+	Regions []string
+	// Only registries belonging to these accounts; all accounts, if
+	// empty
+	AccountIDs []string
+}
+
+func (c AWSRegistryConfig) includes(region, accountID string) bool {
+	return (len(c.Regions) == 0 || contains(c.Regions, region)) &&
+		(len(c.AccountIDs) == 0 || contains(c.AccountIDs, accountID))
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ecrProvider gets authorization tokens for ECR registries, using
+// the AWS SDK's default credential chain: credentials from the
+// environment or the shared config, a service account token via IAM
+// roles for service accounts, or the EC2 instance's role.
+type ecrProvider struct {
+	config AWSRegistryConfig
+	// Gives the ECR client for a region; this can be replaced in
+	// tests.
+	clientFor func(region string) (ecriface.ECRAPI, error)
+	cache     *tokenCache
+}
+
+// NewECRProvider returns a provider of credentials for the Amazon ECR
+// registries included by the config.
+func NewECRProvider(logger log.Logger, config AWSRegistryConfig) CredentialsProvider {
+	clients := &ecrClients{clients: map[string]ecriface.ECRAPI{}}
+	p := &ecrProvider{
+		config:    config,
+		clientFor: clients.forRegion,
+	}
+	p.cache = newTokenCache("ECR", logger, p.getToken)
+	return p
+}
+
+// ecrClients makes an ECR client for each region as it's needed. The
+// clients share a session, so the AWS credentials are only got again
+// when they expire.
+type ecrClients struct {
+	mu      sync.Mutex
+	sess    *session.Session
+	clients map[string]ecriface.ECRAPI
+}
+
+func (c *ecrClients) forRegion(region string) (ecriface.ECRAPI, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[region]; ok {
+		return client, nil
+	}
+	if c.sess == nil {
+		sess, err := session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "creating AWS session")
+		}
+		c.sess = sess
+	}
+	client := ecr.New(c.sess, aws.NewConfig().
+		WithRegion(region).
+		WithHTTPClient(&http.Client{Timeout: 10 * time.Second}))
+	c.clients[region] = client
+	return client, nil
+}
+
+func (p *ecrProvider) credsFor(host string) (creds, bool) {
+	m := ecrHostRegexp.FindStringSubmatch(host)
+	if m == nil || !p.config.includes(m[2], m[1]) {
+		return creds{}, false
+	}
+	return p.cache.get(host)
+}
+
+// getToken asks the ECR API for an authorization token for the
+// registry.
+func (p *ecrProvider) getToken(host string) (creds, time.Time, error) {
+	m := ecrHostRegexp.FindStringSubmatch(host)
+	accountID, region := m[1], m[2]
+	client, err := p.clientFor(region)
+	if err != nil {
+		return creds{}, time.Time{}, err
+	}
+	out, err := client.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(accountID)},
+	})
+	if err != nil {
+		return creds{}, time.Time{}, err
+	}
+	if len(out.AuthorizationData) == 0 {
+		return creds{}, time.Time{}, errors.New("no authorization data in ECR response")
+	}
+	data := out.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(aws.StringValue(data.AuthorizationToken))
+	if err != nil {
+		return creds{}, time.Time{}, errors.Wrap(err, "decoding ECR authorization token")
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return creds{}, time.Time{}, errors.New("ECR authorization token is not in the form user:password")
+	}
+	return creds{
+		registry:   host,
+		provenance: "ECR",
+		username:   parts[0],
+		password:   parts[1],
+	}, aws.TimeValue(data.ExpiresAt), nil
+}
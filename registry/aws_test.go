@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeECR gives authorization tokens, as the ECR API does, counting
+// the requests for them.
+type fakeECR struct {
+	ecriface.ECRAPI
+	region   string
+	requests *int
+	now      *time.Time
+}
+
+func (f fakeECR) GetAuthorizationToken(in *ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+	*f.requests++
+	accountID := aws.StringValue(in.RegistryIds[0])
+	token := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("AWS:password-%d", *f.requests)))
+	return &ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{{
+			AuthorizationToken: aws.String(token),
+			ExpiresAt:          aws.Time(f.now.Add(12 * time.Hour)),
+			ProxyEndpoint:      aws.String(fmt.Sprintf("https://%s.dkr.ecr.%s.amazonaws.com", accountID, f.region)),
+		}},
+	}, nil
+}
+
+func setupECR(t *testing.T, config AWSRegistryConfig) (*ecrProvider, *int, *time.Time) {
+	var requests int
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &ecrProvider{
+		config: config,
+		clientFor: func(region string) (ecriface.ECRAPI, error) {
+			return fakeECR{region: region, requests: &requests, now: &now}, nil
+		},
+	}
+	p.cache = newTokenCache("ECR", log.NewNopLogger(), p.getToken)
+	p.cache.now = func() time.Time { return now }
+	return p, &requests, &now
+}
+
+func TestECRProvider_Creds(t *testing.T) {
+	p, requests, now := setupECR(t, AWSRegistryConfig{})
+
+	c, ok := p.credsFor("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.True(t, ok)
+	assert.Equal(t, "AWS", c.username)
+	assert.Equal(t, "password-1", c.password)
+	assert.Equal(t, 1, *requests)
+
+	// The token is used until most of its twelve hours are up
+	*now = now.Add(8 * time.Hour)
+	p.credsFor("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.Equal(t, 1, *requests)
+
+	*now = now.Add(90 * time.Minute)
+	c, _ = p.credsFor("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.Equal(t, "password-2", c.password)
+	assert.Equal(t, 2, *requests)
+}
+
+func TestECRProvider_Config(t *testing.T) {
+	p, requests, _ := setupECR(t, AWSRegistryConfig{
+		Regions:    []string{"eu-west-1"},
+		AccountIDs: []string{"123456789012"},
+	})
+
+	for host, included := range map[string]bool{
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com":      true,
+		"123456789012.dkr.ecr-fips.eu-west-1.amazonaws.com": true,
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com":      false,
+		"210987654321.dkr.ecr.eu-west-1.amazonaws.com":      false,
+		"123456789012.dkr.ecr.eu-west-1.example.com":        false,
+	} {
+		_, ok := p.credsFor(host)
+		assert.Equal(t, included, ok, host)
+	}
+	assert.Equal(t, 2, *requests)
+}
+
+func TestECRHostRegexp(t *testing.T) {
+	m := ecrHostRegexp.FindStringSubmatch("123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn")
+	assert.Equal(t, []string{"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn", "123456789012", "cn-north-1", ".cn"}, m)
+}
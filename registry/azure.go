@@ -0,0 +1,194 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// The cloud provider configuration on AKS (and aks-engine) nodes,
+	// which includes the identity of the cluster
+	azureCloudConfigFile    = "/etc/kubernetes/azure.json"
+	azureManagementResource = "https://management.azure.com/"
+	// The username to give with an ACR refresh token
+	acrTokenUsername = "00000000-0000-0000-0000-000000000000"
+	// ACR refresh tokens are good for three hours
+	acrRefreshTokenLifetime = 3 * time.Hour
+	// How often to read service principal credentials again, in case
+	// they've been rotated
+	azureCredentialsReloadInterval = time.Hour
+)
+
+// acrHostRegexp matches the hosts of Azure Container Registry
+// registries, in each of the Azure clouds.
+var acrHostRegexp = regexp.MustCompile(`^[a-z0-9]+\.azurecr\.(?:io|cn|de|us)$`)
+
+// acrProvider gets credentials for Azure Container Registry, either
+// for a service principal, given by the environment variables
+// AZURE_CLIENT_ID and AZURE_CLIENT_SECRET or by the cloud provider
+// configuration, or for the managed identity of the VM, which is
+// exchanged for an ACR refresh token.
+type acrProvider struct {
+	getenv     func(string) string
+	client     *http.Client
+	configFile string
+	imdsURL    string
+	// The URL of the endpoint for exchanging Azure AD tokens for ACR
+	// tokens; this can be replaced in tests.
+	exchangeURL func(host string) string
+	cache       *tokenCache
+}
+
+// NewACRProvider returns a provider of credentials for Azure
+// Container Registry.
+func NewACRProvider(logger log.Logger) CredentialsProvider {
+	// This never returns an error; it's the well-known IMDS address
+	imdsURL, _ := adal.GetMSIVMEndpoint()
+	p := &acrProvider{
+		getenv:     os.Getenv,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		configFile: azureCloudConfigFile,
+		imdsURL:    imdsURL,
+		exchangeURL: func(host string) string {
+			return "https://" + host + "/oauth2/exchange"
+		},
+	}
+	p.cache = newTokenCache("ACR", logger, p.getToken)
+	return p
+}
+
+func (p *acrProvider) credsFor(host string) (creds, bool) {
+	if !acrHostRegexp.MatchString(host) {
+		return creds{}, false
+	}
+	return p.cache.get(host)
+}
+
+type azureIdentity struct {
+	clientID, clientSecret string
+	provenance             string
+}
+
+// identity works out which identity to use. A client ID without a
+// secret picks a user-assigned managed identity.
+func (p *acrProvider) identity() (azureIdentity, error) {
+	if id := p.getenv("AZURE_CLIENT_ID"); id != "" {
+		return azureIdentity{
+			clientID:     id,
+			clientSecret: p.getenv("AZURE_CLIENT_SECRET"),
+			provenance:   "environment",
+		}, nil
+	}
+
+	bytes, err := ioutil.ReadFile(p.configFile)
+	if os.IsNotExist(err) {
+		return azureIdentity{provenance: "managed identity"}, nil
+	}
+	if err != nil {
+		return azureIdentity{}, err
+	}
+	var config struct {
+		AADClientID            string `json:"aadClientId"`
+		AADClientSecret        string `json:"aadClientSecret"`
+		UserAssignedIdentityID string `json:"userAssignedIdentityID"`
+	}
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return azureIdentity{}, errors.Wrapf(err, "decoding %s", p.configFile)
+	}
+	// Clusters using a managed identity have "msi" for the client ID
+	if config.AADClientSecret != "" && config.AADClientID != "msi" {
+		return azureIdentity{
+			clientID:     config.AADClientID,
+			clientSecret: config.AADClientSecret,
+			provenance:   p.configFile,
+		}, nil
+	}
+	return azureIdentity{clientID: config.UserAssignedIdentityID, provenance: "managed identity"}, nil
+}
+
+func (p *acrProvider) getToken(host string) (creds, time.Time, error) {
+	identity, err := p.identity()
+	if err != nil {
+		return creds{}, time.Time{}, err
+	}
+	now := p.cache.now()
+	// Registries accept service principals' credentials as they are
+	if identity.clientSecret != "" {
+		return creds{
+			registry:   host,
+			provenance: identity.provenance,
+			username:   identity.clientID,
+			password:   identity.clientSecret,
+		}, now.Add(azureCredentialsReloadInterval), nil
+	}
+
+	aadToken, err := p.managedIdentityToken(identity.clientID)
+	if err != nil {
+		return creds{}, time.Time{}, errors.Wrap(err, "getting managed identity token")
+	}
+	refreshToken, err := p.exchange(host, aadToken)
+	if err != nil {
+		return creds{}, time.Time{}, errors.Wrap(err, "exchanging managed identity token for registry token")
+	}
+	return creds{
+		registry:   host,
+		provenance: identity.provenance,
+		username:   acrTokenUsername,
+		password:   refreshToken,
+	}, now.Add(acrRefreshTokenLifetime), nil
+}
+
+// managedIdentityToken gets an Azure AD access token for the VM's
+// managed identity, or if a client ID is given, for that
+// user-assigned identity.
+func (p *acrProvider) managedIdentityToken(clientID string) (string, error) {
+	var spt *adal.ServicePrincipalToken
+	var err error
+	if clientID != "" {
+		spt, err = adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(p.imdsURL, azureManagementResource, clientID)
+	} else {
+		spt, err = adal.NewServicePrincipalTokenFromMSI(p.imdsURL, azureManagementResource)
+	}
+	if err != nil {
+		return "", err
+	}
+	spt.SetSender(p.client)
+	if err := spt.Refresh(); err != nil {
+		return "", err
+	}
+	return spt.OAuthToken(), nil
+}
+
+// exchange trades an Azure AD access token for a refresh token for
+// the registry, which can be used as a password.
+func (p *acrProvider) exchange(host, aadToken string) (string, error) {
+	resp, err := p.client.PostForm(p.exchangeURL(host), url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {host},
+		"access_token": {aadToken},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from registry: %s", resp.Status)
+	}
+	var token struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	return token.RefreshToken, nil
+}
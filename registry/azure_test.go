@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupACR(t *testing.T, env map[string]string, config string) (*acrProvider, func()) {
+	dir, err := ioutil.TempDir("", "flux-acr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "azure.json")
+	if config != "" {
+		if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata/identity/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get("Metadata"))
+		fmt.Fprintf(w, `{"access_token":"aad-token-%s"}`, r.URL.Query().Get("client_id"))
+	})
+	mux.HandleFunc("/oauth2/exchange", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "myregistry.azurecr.io", r.FormValue("service"))
+		fmt.Fprintf(w, `{"refresh_token":"refresh-for-%s"}`, r.FormValue("access_token"))
+	})
+	server := httptest.NewServer(mux)
+
+	p := &acrProvider{
+		getenv:      func(k string) string { return env[k] },
+		client:      server.Client(),
+		configFile:  configFile,
+		imdsURL:     server.URL + "/metadata/identity/oauth2/token",
+		exchangeURL: func(string) string { return server.URL + "/oauth2/exchange" },
+	}
+	p.cache = newTokenCache("ACR", log.NewNopLogger(), p.getToken)
+	return p, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestACRProvider_ServicePrincipal(t *testing.T) {
+	p, cleanup := setupACR(t, map[string]string{
+		"AZURE_CLIENT_ID":     "client",
+		"AZURE_CLIENT_SECRET": "secret",
+	}, "")
+	defer cleanup()
+	c, ok := p.credsFor("myregistry.azurecr.io")
+	assert.True(t, ok)
+	assert.Equal(t, "client", c.username)
+	assert.Equal(t, "secret", c.password)
+
+	_, ok = p.credsFor("myregistry.example.com")
+	assert.False(t, ok)
+}
+
+func TestACRProvider_ManagedIdentity(t *testing.T) {
+	p, cleanup := setupACR(t, nil, `{"aadClientId":"msi","aadClientSecret":"msi","userAssignedIdentityID":"identity"}`)
+	defer cleanup()
+	c, ok := p.credsFor("myregistry.azurecr.io")
+	assert.True(t, ok)
+	assert.Equal(t, acrTokenUsername, c.username)
+	assert.Equal(t, "refresh-for-aad-token-identity", c.password)
+}
@@ -0,0 +1,225 @@
+package memory
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+const (
+	DefaultExpiry           = time.Hour
+	DefaultMaxBytes         = 256 << 20
+	DefaultSnapshotInterval = 5 * time.Minute
+)
+
+// MemoryClient is a cache client that keeps values in memory, up to
+// a maximum total size, evicting those least recently used to make
+// room. It can periodically save its contents to a file, and load
+// them from that file when started, so it doesn't start from scratch
+// each time fluxd restarts.
+type MemoryClient struct {
+	ttl          time.Duration
+	maxBytes     int
+	snapshotFile string
+	logger       log.Logger
+	now          func() time.Time
+
+	mu    sync.Mutex
+	lru   *simplelru.LRU
+	bytes int
+
+	quit chan struct{}
+	wait sync.WaitGroup
+}
+
+// MemoryConfig defines how a MemoryClient should be constructed.
+type MemoryConfig struct {
+	Expiry   time.Duration
+	MaxBytes int
+	// If not empty, the contents of the cache are loaded from this
+	// file on start, and saved to it every SnapshotInterval and on
+	// Stop.
+	SnapshotFile     string
+	SnapshotInterval time.Duration
+	Logger           log.Logger
+}
+
+type entry struct {
+	Key    string
+	Value  []byte
+	Expiry time.Time
+}
+
+func (e *entry) size() int {
+	return len(e.Key) + len(e.Value)
+}
+
+func NewMemoryClient(config MemoryConfig) *MemoryClient {
+	c := &MemoryClient{
+		ttl:          config.Expiry,
+		maxBytes:     config.MaxBytes,
+		snapshotFile: config.SnapshotFile,
+		logger:       config.Logger,
+		now:          time.Now,
+		quit:         make(chan struct{}),
+	}
+	if c.ttl == 0 {
+		c.ttl = DefaultExpiry
+	}
+	if c.maxBytes <= 0 {
+		c.maxBytes = DefaultMaxBytes
+	}
+	// The size is kept within bounds by counting bytes rather than
+	// entries, so the limit on entries is never reached.
+	c.lru, _ = simplelru.NewLRU(math.MaxInt32, func(_, value interface{}) {
+		c.bytes -= value.(*entry).size()
+	})
+
+	if c.snapshotFile != "" {
+		if err := c.load(); err != nil {
+			c.logger.Log("err", errors.Wrapf(err, "loading cache snapshot from %s", c.snapshotFile))
+		}
+		interval := config.SnapshotInterval
+		if interval <= 0 {
+			interval = DefaultSnapshotInterval
+		}
+		c.wait.Add(1)
+		go c.snapshotLoop(interval)
+	}
+	return c
+}
+
+// GetKey gets the value and its expiry time from the cache.
+func (c *MemoryClient) GetKey(k cache.Keyer) ([]byte, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.lru.Get(k.Key())
+	if !ok {
+		return []byte{}, time.Time{}, cache.ErrNotCached
+	}
+	e := value.(*entry)
+	if !c.now().Before(e.Expiry) {
+		c.lru.Remove(k.Key())
+		return []byte{}, time.Time{}, cache.ErrNotCached
+	}
+	return e.Value, e.Expiry, nil
+}
+
+// SetKey sets the value at a key.
+func (c *MemoryClient) SetKey(k cache.Keyer, v []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(&entry{Key: k.Key(), Value: v, Expiry: c.now().Add(c.ttl)})
+	return nil
+}
+
+// add puts an entry in the cache, evicting others if necessary. It
+// must be called with the lock held.
+func (c *MemoryClient) add(e *entry) {
+	if e.size() > c.maxBytes {
+		return // it would only evict everything, then itself
+	}
+	// Remove any existing entry first, so its size is accounted for
+	c.lru.Remove(e.Key)
+	c.lru.Add(e.Key, e)
+	c.bytes += e.size()
+	for c.bytes > c.maxBytes {
+		c.lru.RemoveOldest()
+	}
+}
+
+// Stop the memory client, saving a snapshot if configured to.
+func (c *MemoryClient) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+	if c.snapshotFile != "" {
+		if err := c.save(); err != nil {
+			c.logger.Log("err", errors.Wrapf(err, "saving cache snapshot to %s", c.snapshotFile))
+		}
+	}
+}
+
+func (c *MemoryClient) snapshotLoop(interval time.Duration) {
+	defer c.wait.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.save(); err != nil {
+				c.logger.Log("err", errors.Wrapf(err, "saving cache snapshot to %s", c.snapshotFile))
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// save writes the unexpired entries to the snapshot file, least
+// recently used first. The file is replaced in one go, so a reader
+// never sees half a snapshot.
+func (c *MemoryClient) save() error {
+	c.mu.Lock()
+	now := c.now()
+	var entries []*entry
+	for _, key := range c.lru.Keys() {
+		if value, ok := c.lru.Peek(key); ok && now.Before(value.(*entry).Expiry) {
+			entries = append(entries, value.(*entry))
+		}
+	}
+	c.mu.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.snapshotFile), filepath.Base(c.snapshotFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(entries); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.snapshotFile)
+}
+
+// load fills the cache with the unexpired entries in the snapshot
+// file, if there is one.
+func (c *MemoryClient) load() error {
+	f, err := os.Open(c.snapshotFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var entries []*entry
+	if err := gob.NewDecoder(f).Decode(&entries); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	var loaded int
+	for _, e := range entries {
+		if now.Before(e.Expiry) {
+			c.add(e)
+			loaded++
+		}
+	}
+	c.logger.Log("info", "loaded cache snapshot", "file", c.snapshotFile, "entries", loaded)
+	return nil
+}
@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+type testKey string
+
+func (t testKey) Key() string {
+	return string(t)
+}
+
+func TestMemory_Eviction(t *testing.T) {
+	// Room for two entries of 1+9 bytes each
+	c := NewMemoryClient(MemoryConfig{MaxBytes: 20, Logger: log.NewNopLogger()})
+	defer c.Stop()
+
+	c.SetKey(testKey("a"), []byte("123456789"))
+	c.SetKey(testKey("b"), []byte("123456789"))
+	// Using a makes b the least recently used
+	_, _, err := c.GetKey(testKey("a"))
+	assert.NoError(t, err)
+	c.SetKey(testKey("c"), []byte("123456789"))
+
+	_, _, err = c.GetKey(testKey("b"))
+	assert.Equal(t, cache.ErrNotCached, err)
+	for _, k := range []testKey{"a", "c"} {
+		v, _, err := c.GetKey(k)
+		assert.NoError(t, err)
+		assert.Equal(t, "123456789", string(v))
+	}
+
+	// Replacing an entry doesn't count it twice
+	c.SetKey(testKey("c"), []byte("987654321"))
+	_, _, err = c.GetKey(testKey("a"))
+	assert.NoError(t, err)
+
+	// Something too big to ever fit is not kept
+	c.SetKey(testKey("d"), make([]byte, 21))
+	_, _, err = c.GetKey(testKey("d"))
+	assert.Equal(t, cache.ErrNotCached, err)
+	assert.Equal(t, 20, c.bytes)
+}
+
+func TestMemory_Expiry(t *testing.T) {
+	now := time.Now()
+	c := NewMemoryClient(MemoryConfig{Expiry: time.Minute, Logger: log.NewNopLogger()})
+	defer c.Stop()
+	c.now = func() time.Time { return now }
+
+	c.SetKey(testKey("a"), []byte("value"))
+	_, expiry, err := c.GetKey(testKey("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), expiry)
+
+	now = now.Add(time.Minute)
+	_, _, err = c.GetKey(testKey("a"))
+	assert.Equal(t, cache.ErrNotCached, err)
+	assert.Equal(t, 0, c.bytes)
+}
+
+func TestMemory_Snapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := MemoryConfig{
+		Expiry:       time.Hour,
+		SnapshotFile: filepath.Join(dir, "snapshot"),
+		Logger:       log.NewNopLogger(),
+	}
+
+	c := NewMemoryClient(config)
+	c.SetKey(testKey("a"), []byte("value"))
+	_, expiry, _ := c.GetKey(testKey("a"))
+	c.Stop()
+
+	c = NewMemoryClient(config)
+	defer c.Stop()
+	v, loadedExpiry, err := c.GetKey(testKey("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "value", string(v))
+	assert.True(t, expiry.Equal(loadedExpiry))
+}
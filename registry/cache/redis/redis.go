@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+const (
+	DefaultExpiry = time.Hour
+)
+
+// RedisClient is a cache client for a Redis server.
+type RedisClient struct {
+	pool   *redigo.Pool
+	ttl    time.Duration
+	logger log.Logger
+}
+
+// RedisConfig defines how a RedisClient should be constructed.
+type RedisConfig struct {
+	Addr         string // host:port
+	Password     string // if empty, no AUTH is sent
+	DB           int
+	Expiry       time.Duration
+	Timeout      time.Duration
+	Logger       log.Logger
+	MaxIdleConns int
+}
+
+func NewRedisClient(config RedisConfig) *RedisClient {
+	options := []redigo.DialOption{
+		redigo.DialConnectTimeout(config.Timeout),
+		redigo.DialReadTimeout(config.Timeout),
+		redigo.DialWriteTimeout(config.Timeout),
+		redigo.DialDatabase(config.DB),
+	}
+	if config.Password != "" {
+		options = append(options, redigo.DialPassword(config.Password))
+	}
+	c := &RedisClient{
+		pool: &redigo.Pool{
+			MaxIdle: config.MaxIdleConns,
+			Dial: func() (redigo.Conn, error) {
+				return redigo.Dial("tcp", config.Addr, options...)
+			},
+		},
+		ttl:    config.Expiry,
+		logger: config.Logger,
+	}
+	if c.ttl == 0 {
+		c.ttl = DefaultExpiry
+	}
+	return c
+}
+
+// As with memcached, we want to know the expiry of a value when we
+// get it, so we prepend the expiry to the value when setting, and
+// read it back when getting.
+
+// GetKey gets the value and its expiry time from the cache.
+func (c *RedisClient) GetKey(k cache.Keyer) ([]byte, time.Time, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	value, err := redigo.Bytes(conn.Do("GET", k.Key()))
+	if err != nil {
+		if err == redigo.ErrNil {
+			return []byte{}, time.Time{}, cache.ErrNotCached
+		}
+		c.logger.Log("err", errors.Wrap(err, "fetching from redis"))
+		return []byte{}, time.Time{}, err
+	}
+	if len(value) < 4 {
+		err := fmt.Errorf("unexpected value from redis for key %s", k.Key())
+		c.logger.Log("err", err)
+		return []byte{}, time.Time{}, err
+	}
+	exTime := binary.BigEndian.Uint32(value)
+	return value[4:], time.Unix(int64(exTime), 0), nil
+}
+
+// SetKey sets the value at a key.
+func (c *RedisClient) SetKey(k cache.Keyer, v []byte) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	exTime := time.Now().Add(c.ttl).Unix()
+	exBytes := make([]byte, 4, 4+len(v))
+	binary.BigEndian.PutUint32(exBytes, uint32(exTime))
+	ttlSeconds := int64(c.ttl / time.Second)
+	if ttlSeconds < 1 {
+		ttlSeconds = 1
+	}
+	if _, err := conn.Do("SET", k.Key(), append(exBytes, v...), "EX", ttlSeconds); err != nil {
+		c.logger.Log("err", errors.Wrap(err, "storing in redis"))
+		return err
+	}
+	return nil
+}
+
+// Stop the redis client, closing any idle connections.
+func (c *RedisClient) Stop() {
+	c.pool.Close()
+}
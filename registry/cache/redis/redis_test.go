@@ -0,0 +1,177 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+type testKey string
+
+func (t testKey) Key() string {
+	return string(t)
+}
+
+// fakeRedis serves GET, SET, AUTH and SELECT from a map.
+type fakeRedis struct {
+	net.Listener
+	password string
+
+	mu       sync.Mutex
+	kv       map[string]string
+	commands [][]string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{Listener: l, password: password, kv: map[string]string{}}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := s.password == ""
+	for {
+		var n int
+		if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+			return
+		}
+		args := make([]string, n)
+		for i := range args {
+			var l int
+			if _, err := fmt.Fscanf(r, "$%d\r\n", &l); err != nil {
+				return
+			}
+			buf := make([]byte, l+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:l])
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authed = args[1] == s.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "GET" && args[1] == "wrongtype":
+			reply = "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+		case args[0] == "SET":
+			s.kv[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			if v, ok := s.kv[args[1]]; ok {
+				reply = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+		c.Write([]byte(reply))
+	}
+}
+
+func TestRedis_ExpiryReadWrite(t *testing.T) {
+	s := newFakeRedis(t, "s3cr3t")
+	defer s.Close()
+	c := NewRedisClient(RedisConfig{
+		Addr:         s.Addr().String(),
+		Password:     "s3cr3t",
+		DB:           2,
+		Timeout:      time.Second,
+		Logger:       log.NewNopLogger(),
+		MaxIdleConns: 1,
+	})
+	defer c.Stop()
+
+	_, _, err := c.GetKey(testKey("missing"))
+	assert.Equal(t, cache.ErrNotCached, err)
+
+	assert.NoError(t, c.SetKey(testKey("key"), []byte("value\r\nwith a newline")))
+	value, expiry, err := c.GetKey(testKey("key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "value\r\nwith a newline", string(value))
+	assert.True(t, expiry.After(time.Now()))
+	assert.True(t, expiry.Before(time.Now().Add(DefaultExpiry+time.Second)))
+
+	// The connection is reused, so it's only authenticated once.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Equal(t, []string{"AUTH", "s3cr3t"}, s.commands[0])
+	assert.Equal(t, []string{"SELECT", "2"}, s.commands[1])
+	assert.Equal(t, []string{"GET", "missing"}, s.commands[2])
+	assert.Equal(t, []string{"SET", "key"}, s.commands[3][:2])
+	assert.Equal(t, []string{"EX", "3600"}, s.commands[3][3:])
+	assert.Len(t, s.commands, 5)
+}
+
+func TestRedis_AuthFailure(t *testing.T) {
+	s := newFakeRedis(t, "s3cr3t")
+	defer s.Close()
+	c := NewRedisClient(RedisConfig{
+		Addr:     s.Addr().String(),
+		Password: "wrong",
+		Timeout:  time.Second,
+		Logger:   log.NewNopLogger(),
+	})
+	_, _, err := c.GetKey(testKey("key"))
+	assert.Error(t, err)
+	assert.NotEqual(t, cache.ErrNotCached, err)
+}
+
+func TestRedis_ErrorReply(t *testing.T) {
+	s := newFakeRedis(t, "")
+	defer s.Close()
+	c := NewRedisClient(RedisConfig{
+		Addr:         s.Addr().String(),
+		Timeout:      time.Second,
+		Logger:       log.NewNopLogger(),
+		MaxIdleConns: 1,
+	})
+	defer c.Stop()
+
+	_, _, err := c.GetKey(testKey("wrongtype"))
+	assert.Error(t, err)
+	assert.NotEqual(t, cache.ErrNotCached, err)
+
+	// An error reply doesn't stop the connection from being used
+	// again
+	assert.NoError(t, c.SetKey(testKey("key"), []byte("value")))
+	value, _, err := c.GetKey(testKey("key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "value", string(value))
+}
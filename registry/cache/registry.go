@@ -29,10 +29,16 @@ repository.
 // Cache is a local cache of image metadata.
 type Cache struct {
 	Reader Reader
+	// StaleAfter is how long after the images in a repository were
+	// last refreshed they are considered stale. If zero, they are
+	// only stale if the last attempt to refresh them failed.
+	StaleAfter time.Duration
 }
 
 // GetRepositoryImages returns the list of image manifests in an image
-// repository (e.g,. at "quay.io/weaveworks/flux")
+// repository (e.g,. at "quay.io/weaveworks/flux"). If the images
+// could not be refreshed recently, the last known images are
+// returned along with a *registry.StaleError.
 func (c *Cache) GetRepositoryImages(id image.Name) ([]image.Info, error) {
 	repoKey := NewRepositoryKey(id.CanonicalName())
 	bytes, _, err := c.Reader.GetKey(repoKey)
@@ -59,6 +65,13 @@ func (c *Cache) GetRepositoryImages(id image.Name) ([]image.Info, error) {
 		images[i] = im
 		i++
 	}
+
+	switch {
+	case repo.LastError != "":
+		return images, &registry.StaleError{LastUpdate: repo.LastUpdate, Err: errors.New(repo.LastError)}
+	case c.StaleAfter > 0 && time.Since(repo.LastUpdate) > c.StaleAfter:
+		return images, &registry.StaleError{LastUpdate: repo.LastUpdate}
+	}
 	return images, nil
 }
 
@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net"
 	"strings"
 	"sync"
@@ -25,6 +26,17 @@ type Warmer struct {
 	burst         int
 	Priority      chan image.Name
 	Notify        func()
+
+	// Workers is the number of images refreshed at once, and
+	// HostWorkers the number of those that may be from the same
+	// registry host. If not set, images are refreshed one at a time.
+	Workers, HostWorkers int
+	// Prioritise, if set, says whether an image should be refreshed
+	// before the others, e.g., because it's used by an automated
+	// workload.
+	Prioritise func(image.Name) bool
+
+	credentialsChanged chan struct{}
 }
 
 // NewWarmer creates cache warmer that (when Loop is invoked) will
@@ -34,9 +46,10 @@ func NewWarmer(cf registry.ClientFactory, cacheClient Client, burst int) (*Warme
 		return nil, errors.New("arguments must be non-nil (or > 0 in the case of burst)")
 	}
 	return &Warmer{
-		clientFactory: cf,
-		cache:         cacheClient,
-		burst:         burst,
+		clientFactory:      cf,
+		cache:              cacheClient,
+		burst:              burst,
+		credentialsChanged: make(chan struct{}, 1),
 	}, nil
 }
 
@@ -46,85 +59,203 @@ type backlogItem struct {
 	registry.Credentials
 }
 
+// RefreshCredentials tells the warmer that the registry credentials
+// may have changed, so it asks for them again rather than carrying
+// on with those it has until the next time it looks for new images.
+func (w *Warmer) RefreshCredentials() {
+	select {
+	case w.credentialsChanged <- struct{}{}:
+	default: // a refresh is already pending
+	}
+}
+
 // Loop continuously gets the images to populate the cache with,
 // and populate the cache with them.
 func (w *Warmer) Loop(logger log.Logger, stop <-chan struct{}, wg *sync.WaitGroup, imagesToFetchFunc func() registry.ImageCreds) {
 	defer wg.Done()
 
 	refresh := time.Tick(askForNewImagesInterval)
+	workers := newWorkerPool(w.Workers, w.HostWorkers)
 	imageCreds := imagesToFetchFunc()
-	backlog := imageCredsToBacklog(imageCreds)
+	backlog := imageCredsToBacklog(imageCreds, w.Prioritise, workers)
 
-	// We have some fine control over how long to spend on each fetch
-	// operation, since they are given a `context`. For now though,
-	// just rattle through them one by one, however long they take.
-	ctx := context.Background()
+	// Each image is refreshed however long it takes; but if we're
+	// stopped, those being refreshed are abandoned.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan image.Name)
 
 	// NB the implicit contract here is that the prioritised
 	// image has to have been running the last time we
-	// requested the credentials.
-	priorityWarm := func(name image.Name) {
+	// requested the credentials. The name may not be given the same
+	// way as in the workloads (e.g., when it comes from a registry
+	// notification), so it's looked for by canonical name too. It
+	// goes to the front of the backlog, to be refreshed as soon as
+	// there's a worker for it.
+	prioritise := func(name image.Name) {
 		logger.Log("priority", name.String())
-		if creds, ok := imageCreds[name]; ok {
-			w.warm(ctx, logger, name, creds)
-		} else {
+		creds, ok := imageCreds[name]
+		if !ok {
+			canonical := name.CanonicalName()
+			for inUse, inUseCreds := range imageCreds {
+				if inUse.CanonicalName() == canonical {
+					name, creds, ok = inUse, inUseCreds, true
+					break
+				}
+			}
+		}
+		if !ok {
 			logger.Log("priority", name.String(), "err", "no creds available")
+			return
+		}
+		rest := []backlogItem{{name, creds}}
+		for _, item := range backlog {
+			if item.Name != name {
+				rest = append(rest, item)
+			}
 		}
+		backlog = rest
 	}
 
-	// This loop acts keeps a kind of priority queue, whereby image
-	// names coming in on the `Priority` channel are looked up first.
-	// If there are none, images used in the cluster are refreshed;
-	// but no more often than once every `askForNewImagesInterval`,
-	// since there is no effective back-pressure on cache refreshes
-	// and it would spin freely otherwise.
+	// This loop keeps a kind of priority queue, whereby image names
+	// coming in on the `Priority` channel are refreshed first, then
+	// those the warmer is told to prioritise, then the rest of the
+	// images used in the cluster; but they are only looked for again
+	// once every `askForNewImagesInterval` after the backlog is
+	// empty, since there is no effective back-pressure on cache
+	// refreshes and it would spin freely otherwise.
 	for {
+		for {
+			item, ok := workers.next(backlog)
+			if !ok {
+				break
+			}
+			backlog = removeFromBacklog(backlog, item.Name)
+			workers.start(item.Name)
+			go func(item backlogItem) {
+				w.warm(ctx, logger, item.Name, item.Credentials)
+				done <- item.Name
+			}(item)
+		}
+
 		select {
 		case <-stop:
 			logger.Log("stopping", "true")
+			cancel()
+			for workers.running > 0 {
+				workers.finish(<-done)
+			}
 			return
+		case name := <-done:
+			workers.finish(name)
 		case name := <-w.Priority:
-			priorityWarm(name)
-			continue
-		default:
-		}
-
-		if len(backlog) > 0 {
-			im := backlog[0]
-			backlog = backlog[1:]
-			w.warm(ctx, logger, im.Name, im.Credentials)
-		} else {
-			select {
-			case <-stop:
-				logger.Log("stopping", "true")
-				return
-			case <-refresh:
+			prioritise(name)
+		case <-w.credentialsChanged:
+			imageCreds = imagesToFetchFunc()
+			backlog = refreshBacklogCredentials(backlog, imageCreds)
+		case <-refresh:
+			if len(backlog) == 0 {
 				imageCreds = imagesToFetchFunc()
-				backlog = imageCredsToBacklog(imageCreds)
-			case name := <-w.Priority:
-				priorityWarm(name)
+				backlog = imageCredsToBacklog(imageCreds, w.Prioritise, workers)
 			}
 		}
 	}
 }
 
-func imageCredsToBacklog(imageCreds registry.ImageCreds) []backlogItem {
-	backlog := make([]backlogItem, len(imageCreds))
-	var i int
+// imageCredsToBacklog makes a backlog of the images given, with any
+// to be prioritised first, leaving out those being refreshed
+// already.
+func imageCredsToBacklog(imageCreds registry.ImageCreds, prioritise func(image.Name) bool, workers *workerPool) []backlogItem {
+	var first, rest []backlogItem
 	for name, cred := range imageCreds {
-		backlog[i] = backlogItem{name, cred}
-		i++
+		if workers != nil && workers.scanning[name] {
+			continue
+		}
+		if prioritise != nil && prioritise(name) {
+			first = append(first, backlogItem{name, cred})
+		} else {
+			rest = append(rest, backlogItem{name, cred})
+		}
+	}
+	return append(first, rest...)
+}
+
+// refreshBacklogCredentials gives the images left in the backlog the
+// credentials given, dropping any images no longer in use. New images
+// are left for the next time the backlog is filled.
+func refreshBacklogCredentials(backlog []backlogItem, imageCreds registry.ImageCreds) []backlogItem {
+	var refreshed []backlogItem
+	for _, item := range backlog {
+		if creds, ok := imageCreds[item.Name]; ok {
+			refreshed = append(refreshed, backlogItem{item.Name, creds})
+		}
+	}
+	return refreshed
+}
+
+func removeFromBacklog(backlog []backlogItem, name image.Name) []backlogItem {
+	for i, item := range backlog {
+		if item.Name == name {
+			return append(backlog[:i:i], backlog[i+1:]...)
+		}
 	}
 	return backlog
 }
 
+// workerPool keeps track of the images being refreshed, so that no
+// more than a given number are refreshed at once, in total and from
+// each registry host, and the same image isn't refreshed twice at
+// once.
+type workerPool struct {
+	workers, hostWorkers int
+	running              int
+	hosts                map[string]int
+	scanning             map[image.Name]bool
+}
+
+func newWorkerPool(workers, hostWorkers int) *workerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if hostWorkers <= 0 || hostWorkers > workers {
+		hostWorkers = workers
+	}
+	return &workerPool{
+		workers:     workers,
+		hostWorkers: hostWorkers,
+		hosts:       map[string]int{},
+		scanning:    map[image.Name]bool{},
+	}
+}
+
+// next returns the first item in the backlog there's a worker for,
+// if any.
+func (p *workerPool) next(backlog []backlogItem) (backlogItem, bool) {
+	if p.running >= p.workers {
+		return backlogItem{}, false
+	}
+	for _, item := range backlog {
+		if !p.scanning[item.Name] && p.hosts[item.Name.Registry()] < p.hostWorkers {
+			return item, true
+		}
+	}
+	return backlogItem{}, false
+}
+
+func (p *workerPool) start(name image.Name) {
+	p.running++
+	p.hosts[name.Registry()]++
+	p.scanning[name] = true
+}
+
+func (p *workerPool) finish(name image.Name) {
+	p.running--
+	p.hosts[name.Registry()]--
+	delete(p.scanning, name)
+}
+
 func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, creds registry.Credentials) {
 	errorLogger := log.With(logger, "canonical_name", id.CanonicalName(), "auth", creds)
-	client, err := w.clientFactory.ClientFor(id.CanonicalName(), creds)
-	if err != nil {
-		errorLogger.Log("err", err.Error())
-		return
-	}
 
 	// This is what we're going to write back to the cache
 	var repo ImageRepository
@@ -145,7 +276,9 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 
 	// Now we have the previous result; everything after will be
 	// attempting to refresh that value. Whatever happens, at the end
-	// we'll write something back.
+	// we'll write something back. This keeps the last known images
+	// in the cache, to be served as stale, for as long as they can't
+	// be refreshed.
 	defer func() {
 		bytes, err := json.Marshal(repo)
 		if err == nil {
@@ -156,6 +289,13 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 		}
 	}()
 
+	client, err := w.clientFactory.ClientFor(id.CanonicalName(), creds)
+	if err != nil {
+		errorLogger.Log("err", err.Error())
+		repo.LastError = err.Error()
+		return
+	}
+
 	tags, err := client.Tags(ctx)
 	if err != nil {
 		if !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) && !strings.Contains(err.Error(), "net/http: request canceled") {
@@ -166,6 +306,9 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 	}
 
 	newImages := map[string]image.Info{}
+	// The tags of images that are excluded, so they're not taken
+	// to be new every time
+	excluded := StringSet{}
 
 	// Create a list of manifests that need updating
 	var toUpdate []image.Ref
@@ -189,9 +332,15 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 			errorLogger.Log("err", "empty byte array from cache", "tag", tag)
 			missing++
 		default:
-			var image image.Info
-			if err := json.Unmarshal(bytes, &image); err == nil {
-				newImages[tag] = image
+			var entry registry.ImageEntry
+			if err := json.Unmarshal(bytes, &entry); err == nil {
+				// An image that was excluded (e.g., because it's
+				// not for a platform that's required) stays out
+				if entry.ExcludedReason == "" {
+					newImages[tag] = entry.Info
+				} else {
+					excluded[tag] = struct{}{}
+				}
 				continue // i.e., no need to update this one
 			}
 			missing++
@@ -250,6 +399,8 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 				successCount++
 				if img.ExcludedReason == "" {
 					newImages[imageID.Tag] = img.Info
+				} else {
+					excluded[imageID.Tag] = struct{}{}
 				}
 				successMx.Unlock()
 			}(imID)
@@ -265,6 +416,8 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 			LastUpdate: time.Now(),
 			Images:     newImages,
 		}
+	} else if ctx.Err() == nil {
+		repo.LastError = fmt.Sprintf("could not fetch metadata for %d of %d images", len(toUpdate)-successCount, len(toUpdate))
 	}
 
 	if w.Notify != nil {
@@ -273,15 +426,21 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 			cacheTags[t] = struct{}{}
 		}
 
+		// Excluded images are never in the cache, so leave them out
+		// of the comparison.
+		tagSet := NewStringSet(tags)
+		for t := range excluded {
+			delete(tagSet, t)
+		}
+
 		// If there's more tags than there used to be, there must be
 		// at least one new tag.
-		if len(cacheTags) < len(tags) {
+		if len(cacheTags) < len(tagSet) {
 			w.Notify()
 			return
 		}
 		// Otherwise, check whether there are any entries in the
 		// fetched tags that aren't in the cached tags.
-		tagSet := NewStringSet(tags)
 		if !tagSet.Subset(cacheTags) {
 			w.Notify()
 		}
@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -86,3 +88,208 @@ func TestWarm(t *testing.T) {
 		}
 	}
 }
+
+// TestWarm_Excluded checks that an image which is excluded (e.g.,
+// because it's not for a platform that's required) is left out of the
+// repository's images, including when it's found already cached.
+func TestWarm_Excluded(t *testing.T) {
+	ref, _ := image.ParseRef("example.com/path/image:amd64-only")
+	good, _ := image.ParseRef("example.com/path/image:multi")
+	client := &mock.Client{
+		TagsFn: func() ([]string, error) {
+			return []string{"amd64-only", "multi"}, nil
+		},
+		ManifestFn: func(tag string) (registry.ImageEntry, error) {
+			if tag == "amd64-only" {
+				return registry.ImageEntry{Info: image.Info{ID: ref}, ExcludedReason: "image is for linux/amd64, but linux/arm64 required"}, nil
+			}
+			return registry.ImageEntry{Info: image.Info{ID: good, CreatedAt: time.Now()}}, nil
+		},
+	}
+	c := &mem{}
+	var notified int
+	warmer := &Warmer{clientFactory: &mock.ClientFactory{Client: client}, cache: c, burst: 10}
+	warmer.Notify = func() { notified++ }
+	cache := &Cache{Reader: c}
+
+	for i := 0; i < 2; i++ {
+		warmer.warm(context.TODO(), log.NewNopLogger(), ref.Name, registry.NoCredentials())
+		images, err := cache.GetRepositoryImages(ref.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(images) != 1 || images[0].ID.Tag != "multi" {
+			t.Errorf("warm %d: expected only the image that wasn't excluded, got %v", i+1, images)
+		}
+	}
+	// The first time there's a new image; the second time, the
+	// excluded image isn't taken to be new
+	if notified != 1 {
+		t.Errorf("expected to be notified of new images once, but was notified %d times", notified)
+	}
+}
+
+// TestWarm_Stale checks that if images can't be refreshed, the last
+// known images are still given, but flagged as stale.
+func TestWarm_Stale(t *testing.T) {
+	ref, _ := image.ParseRef("example.com/path/image:tag")
+	tagsErr := errors.New("registry unavailable")
+	var failing bool
+	client := &mock.Client{
+		TagsFn: func() ([]string, error) {
+			if failing {
+				return nil, tagsErr
+			}
+			return []string{"tag"}, nil
+		},
+		ManifestFn: func(tag string) (registry.ImageEntry, error) {
+			return registry.ImageEntry{Info: image.Info{ID: ref, CreatedAt: time.Now()}}, nil
+		},
+	}
+	c := &mem{}
+	warmer := &Warmer{clientFactory: &mock.ClientFactory{Client: client}, cache: c, burst: 10}
+	cache := &Cache{Reader: c, StaleAfter: time.Hour}
+
+	warmer.warm(context.TODO(), log.NewNopLogger(), ref.Name, registry.NoCredentials())
+	images, err := cache.GetRepositoryImages(ref.Name)
+	if err != nil || len(images) != 1 {
+		t.Fatalf("expected one image and no error, got %v, %v", images, err)
+	}
+
+	failing = true
+	warmer.warm(context.TODO(), log.NewNopLogger(), ref.Name, registry.NoCredentials())
+	images, err = cache.GetRepositoryImages(ref.Name)
+	staleErr, ok := err.(*registry.StaleError)
+	if !ok {
+		t.Fatalf("expected a stale error, got %v", err)
+	}
+	if staleErr.Err.Error() != tagsErr.Error() {
+		t.Errorf("expected the stale error to give the reason %q, got %q", tagsErr, staleErr.Err)
+	}
+	if len(images) != 1 {
+		t.Errorf("expected the last known image, got %v", images)
+	}
+
+	// Images not refreshed for long enough are stale, even without
+	// an error
+	failing = false
+	warmer.warm(context.TODO(), log.NewNopLogger(), ref.Name, registry.NoCredentials())
+	cache.StaleAfter = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, err = cache.GetRepositoryImages(ref.Name); !registry.IsStale(err) {
+		t.Errorf("expected a stale error, got %v", err)
+	}
+}
+
+func TestRefreshBacklogCredentials(t *testing.T) {
+	kept, _ := image.ParseRef("example.com/kept:tag")
+	gone, _ := image.ParseRef("example.com/gone:tag")
+	added, _ := image.ParseRef("example.com/added:tag")
+	newCreds := registry.NoCredentials()
+	backlog := []backlogItem{
+		{kept.Name, registry.NoCredentials()},
+		{gone.Name, registry.NoCredentials()},
+	}
+	refreshed := refreshBacklogCredentials(backlog, registry.ImageCreds{
+		kept.Name:  newCreds,
+		added.Name: newCreds,
+	})
+	if len(refreshed) != 1 || refreshed[0].Name != kept.Name {
+		t.Errorf("expected only %s left in the backlog, got %v", kept.Name, refreshed)
+	}
+}
+
+// hostsClientFactory gives clients that record how many images are
+// having their tags fetched at once, from each host.
+type hostsClientFactory struct {
+	mu              sync.Mutex
+	running         map[string]int
+	maxRunning      map[string]int
+	total, maxTotal int
+	started         []image.CanonicalName
+	finished        chan struct{}
+}
+
+func (f *hostsClientFactory) ClientFor(name image.CanonicalName, creds registry.Credentials) (registry.Client, error) {
+	return &mock.Client{
+		TagsFn: func() ([]string, error) {
+			f.mu.Lock()
+			f.started = append(f.started, name)
+			f.running[name.Domain]++
+			f.total++
+			if f.running[name.Domain] > f.maxRunning[name.Domain] {
+				f.maxRunning[name.Domain] = f.running[name.Domain]
+			}
+			if f.total > f.maxTotal {
+				f.maxTotal = f.total
+			}
+			f.mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			f.mu.Lock()
+			f.running[name.Domain]--
+			f.total--
+			f.mu.Unlock()
+			f.finished <- struct{}{}
+			return nil, nil
+		},
+	}, nil
+}
+
+func TestWarmer_LoopConcurrency(t *testing.T) {
+	imageCreds := registry.ImageCreds{}
+	for i := 0; i < 6; i++ {
+		ref, _ := image.ParseRef(fmt.Sprintf("a.example.com/image%d:tag", i))
+		imageCreds[ref.Name] = registry.NoCredentials()
+	}
+	for i := 0; i < 2; i++ {
+		ref, _ := image.ParseRef(fmt.Sprintf("b.example.com/image%d:tag", i))
+		imageCreds[ref.Name] = registry.NoCredentials()
+	}
+
+	factory := &hostsClientFactory{
+		running:    map[string]int{},
+		maxRunning: map[string]int{},
+		finished:   make(chan struct{}),
+	}
+	warmer, _ := NewWarmer(factory, &mem{}, 10)
+	warmer.Workers, warmer.HostWorkers = 3, 2
+	warmer.Prioritise = func(name image.Name) bool {
+		return name.Domain == "b.example.com"
+	}
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go warmer.Loop(log.NewNopLogger(), stop, wg, func() registry.ImageCreds { return imageCreds })
+	for i := 0; i < len(imageCreds); i++ {
+		select {
+		case <-factory.finished:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for images to be refreshed")
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if factory.maxTotal != 3 {
+		t.Errorf("expected three images to be refreshed at once, got %d", factory.maxTotal)
+	}
+	for host, max := range factory.maxRunning {
+		if max > 2 {
+			t.Errorf("expected at most two images from %s to be refreshed at once, got %d", host, max)
+		}
+	}
+	// The first three images are refreshed at once, so may start
+	// in any order; but both prioritised images are among them.
+	var prioritised int
+	for _, name := range factory.started[:3] {
+		if name.Domain == "b.example.com" {
+			prioritised++
+		}
+	}
+	if prioritised != 2 {
+		t.Errorf("expected prioritised images to be refreshed first, got %v", factory.started)
+	}
+}
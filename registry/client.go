@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/docker/distribution"
@@ -23,6 +25,39 @@ type ImageEntry struct {
 	ExcludedReason string `json:",omitempty"`
 }
 
+// MarshalJSON encodes the entry as its image.Info, with the reason
+// it's excluded (if it is) alongside. It's needed because image.Info
+// has its own MarshalJSON, which would otherwise be used for the
+// whole entry, leaving the reason out.
+func (entry ImageEntry) MarshalJSON() ([]byte, error) {
+	info, err := json.Marshal(entry.Info)
+	if err != nil || entry.ExcludedReason == "" {
+		return info, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(info, &fields); err != nil {
+		return nil, err
+	}
+	reason, err := json.Marshal(entry.ExcludedReason)
+	if err != nil {
+		return nil, err
+	}
+	fields["ExcludedReason"] = reason
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON is the companion to MarshalJSON above.
+func (entry *ImageEntry) UnmarshalJSON(b []byte) error {
+	var excluded struct {
+		ExcludedReason string
+	}
+	if err := json.Unmarshal(b, &excluded); err != nil {
+		return err
+	}
+	entry.ExcludedReason = excluded.ExcludedReason
+	return json.Unmarshal(b, &entry.Info)
+}
+
 // Client is a remote registry client for a particular image
 // repository (e.g., for quay.io/weaveworks/flux). It is an interface
 // so we can wrap it in instrumentation, write fake implementations,
@@ -41,8 +76,16 @@ type ClientFactory interface {
 
 type Remote struct {
 	transport http.RoundTripper
-	repo      image.CanonicalName
-	base      string
+	// The name given to the images, and the repository they are
+	// fetched from; these differ if it's a mirror
+	name image.CanonicalName
+	repo image.CanonicalName
+	base string
+	// The platforms to look for in manifest lists, in order of
+	// preference; if empty, DefaultPlatform
+	platforms []Platform
+	// The platforms an image must be available for, to be used
+	required []Platform
 }
 
 // Adapt to docker distribution `reference.Named`.
@@ -67,6 +110,12 @@ func (a *Remote) Tags(ctx context.Context) ([]string, error) {
 	return repository.Tags(ctx).All(ctx)
 }
 
+// imageConfig is the part of an image's config (the container
+// config, as opposed to the image's metadata) that's of interest.
+type imageConfig struct {
+	Labels map[string]string `json:"Labels"`
+}
+
 // Manifest fetches the metadata for an image reference; currently
 // assumed to be in the same repo as that provided to `NewRemote(...)`
 func (a *Remote) Manifest(ctx context.Context, ref string) (ImageEntry, error) {
@@ -79,15 +128,51 @@ func (a *Remote) Manifest(ctx context.Context, ref string) (ImageEntry, error) {
 		return ImageEntry{}, err
 	}
 	var manifestDigest digest.Digest
-	digestOpt := client.ReturnContentDigest(&manifestDigest)
-	manifest, fetchErr := manifests.Get(ctx, digest.Digest(ref), digestOpt, distribution.WithTagOption{ref})
+	manifest, err := manifests.Get(ctx, digest.Digest(ref), client.ReturnContentDigest(&manifestDigest), distribution.WithTagOption{ref})
+	if err != nil {
+		return ImageEntry{}, err
+	}
+
+	// The digest is that of whatever the tag points at, which for a
+	// multi-platform image is the manifest list (or OCI index).
+	info := image.Info{ID: a.name.ToRef(ref), Digest: manifestDigest.String()}
 
-interpret:
-	if fetchErr != nil {
-		return ImageEntry{}, fetchErr
+	if list, ok := manifest.(*manifestlist.DeserializedManifestList); ok {
+		info.PlatformDigests = map[string]string{}
+		var available []manifestlist.PlatformSpec
+		for _, m := range list.Manifests {
+			info.PlatformDigests[platformOf(m.Platform).String()] = m.Digest.String()
+			available = append(available, m.Platform)
+		}
+		if missing := missingPlatforms(a.required, available); len(missing) > 0 {
+			return ImageEntry{
+				Info:           info,
+				ExcludedReason: fmt.Sprintf("required platforms (%s) not in manifest list", strings.Join(missing, ", ")),
+			}, nil
+		}
+		platforms := a.platforms
+		if len(platforms) == 0 {
+			platforms = []Platform{DefaultPlatform}
+		}
+		chosen, ok := selectManifest(platforms, list.Manifests)
+		if !ok {
+			var wanted []string
+			for _, p := range platforms {
+				wanted = append(wanted, p.String())
+			}
+			return ImageEntry{
+				Info:           info,
+				ExcludedReason: fmt.Sprintf("no suitable manifest (%s) in manifest list", strings.Join(wanted, ", ")),
+			}, nil
+		}
+		if manifest, err = manifests.Get(ctx, chosen.Digest); err != nil {
+			return ImageEntry{}, err
+		}
 	}
 
-	info := image.Info{ID: a.repo.ToRef(ref), Digest: manifestDigest.String()}
+	// The platform of an image that's not in a manifest list is
+	// given in its config
+	var platform manifestlist.PlatformSpec
 
 	// TODO(michael): can we type switch? Not sure how dependable the
 	// underlying types are.
@@ -96,10 +181,11 @@ interpret:
 		var man schema1.Manifest = deserialised.Manifest
 		// for decoding the v1-compatibility entry in schema1 manifests
 		var v1 struct {
-			ID      string    `json:"id"`
-			Created time.Time `json:"created"`
-			OS      string    `json:"os"`
-			Arch    string    `json:"architecture"`
+			ID      string      `json:"id"`
+			Created time.Time   `json:"created"`
+			OS      string      `json:"os"`
+			Arch    string      `json:"architecture"`
+			Config  imageConfig `json:"config"`
 		}
 
 		if err = json.Unmarshal([]byte(man.History[0].V1Compatibility), &v1); err != nil {
@@ -109,6 +195,8 @@ interpret:
 		// identify the image as it's the topmost layer.
 		info.ImageID = v1.ID
 		info.CreatedAt = v1.Created
+		info.Labels = image.LabelsFrom(v1.Config.Labels)
+		platform = manifestlist.PlatformSpec{OS: v1.OS, Architecture: v1.Arch}
 	case *schema2.DeserializedManifest:
 		var man schema2.Manifest = deserialised.Manifest
 		configBytes, err := repository.Blobs(ctx).Get(ctx, man.Config.Digest)
@@ -117,9 +205,11 @@ interpret:
 		}
 
 		var config struct {
-			Arch    string    `json:"architecture"`
-			Created time.Time `json:"created"`
-			OS      string    `json:"os"`
+			Arch    string      `json:"architecture"`
+			Variant string      `json:"variant"`
+			Created time.Time   `json:"created"`
+			OS      string      `json:"os"`
+			Config  imageConfig `json:"config"`
 		}
 		if err = json.Unmarshal(configBytes, &config); err != nil {
 			return ImageEntry{}, err
@@ -127,19 +217,24 @@ interpret:
 		// This _is_ what Docker uses as its Image ID.
 		info.ImageID = man.Config.Digest.String()
 		info.CreatedAt = config.Created
+		info.Labels = image.LabelsFrom(config.Config.Labels)
+		platform = manifestlist.PlatformSpec{OS: config.OS, Architecture: config.Arch, Variant: config.Variant}
 	case *manifestlist.DeserializedManifestList:
-		var list manifestlist.ManifestList = deserialised.ManifestList
-		// TODO(michael): is it valid to just pick the first one that matches?
-		for _, m := range list.Manifests {
-			if m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
-				manifest, fetchErr = manifests.Get(ctx, m.Digest, digestOpt)
-				goto interpret
-			}
-		}
-		return ImageEntry{ExcludedReason: "no suitable manifest (linux amd64) in manifestlist"}, nil
+		return ImageEntry{}, errors.New("manifest list refers to another manifest list")
 	default:
 		t := reflect.TypeOf(manifest)
 		return ImageEntry{}, errors.New("unknown manifest type: " + t.String())
 	}
+
+	// An image from a manifest list has already been checked; one
+	// that isn't can only be for a single platform
+	if info.PlatformDigests == nil {
+		if missing := missingPlatforms(a.required, []manifestlist.PlatformSpec{platform}); len(missing) > 0 {
+			return ImageEntry{
+				Info:           info,
+				ExcludedReason: fmt.Sprintf("image is for %s, but %s required", platformOf(platform), strings.Join(missing, ", ")),
+			}, nil
+		}
+	}
 	return ImageEntry{Info: info}, nil
 }
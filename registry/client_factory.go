@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 	"sync"
@@ -19,6 +20,18 @@ type RemoteClientFactory struct {
 	Limiters      *middleware.RateLimiters
 	Trace         bool
 	InsecureHosts []string
+	// Mirrors to fetch the metadata for images from, rather than the
+	// registries they name
+	Mirrors Mirrors
+	// If set, only mirrors are used; any image without one is an
+	// error, rather than an attempt to reach its registry
+	Offline bool
+	// The platforms to pick from manifest lists, in order of
+	// preference
+	Platforms []Platform
+	// The platforms images must be available for; images that
+	// aren't are excluded, so they're never released
+	RequiredPlatforms []Platform
 
 	mu               sync.Mutex
 	challengeManager challenge.Manager
@@ -39,7 +52,11 @@ func (t *logging) RoundTrip(req *http.Request) (*http.Response, error) {
 	return res, err
 }
 
-func (f *RemoteClientFactory) ClientFor(repo image.CanonicalName, creds Credentials) (Client, error) {
+func (f *RemoteClientFactory) ClientFor(name image.CanonicalName, creds Credentials) (Client, error) {
+	repo, mirrored := f.Mirrors.Rewrite(name)
+	if !mirrored && f.Offline {
+		return nil, fmt.Errorf("offline, and there is no mirror for %s; not trying to reach %s", name, name.Domain)
+	}
 	tx := f.Limiters.RoundTripper(http.DefaultTransport, repo.Domain)
 	if f.Trace {
 		tx = &logging{f.Logger, tx}
@@ -95,7 +112,7 @@ func (f *RemoteClientFactory) ClientFor(repo image.CanonicalName, creds Credenti
 
 	cred := creds.credsFor(repo.Domain)
 	if f.Trace {
-		f.Logger.Log("repo", repo.String(), "auth", cred.String(), "api", registryURL.String())
+		f.Logger.Log("repo", name.String(), "mirror", repo.String(), "auth", cred.String(), "api", registryURL.String())
 	}
 
 	tokenHandler := auth.NewTokenHandler(tx, &store{cred}, repo.Image, "pull")
@@ -104,7 +121,7 @@ func (f *RemoteClientFactory) ClientFor(repo image.CanonicalName, creds Credenti
 
 	// For the API base we want only the scheme and host.
 	registryURL.Path = ""
-	client := &Remote{transport: tx, repo: repo, base: registryURL.String()}
+	client := &Remote{transport: tx, name: name, repo: repo, base: registryURL.String(), platforms: f.Platforms, required: f.RequiredPlatforms}
 	return NewInstrumentedClient(client), nil
 }
 
@@ -0,0 +1,262 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/go-kit/kit/log"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/registry/middleware"
+)
+
+type fakeBlob struct {
+	mediaType string
+	content   []byte
+}
+
+// newFakeRegistry serves the blobs given by path, with their media
+// types and digests.
+func newFakeRegistry(blobs map[string]fakeBlob) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		blob, ok := blobs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", blob.mediaType)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(blob.content).String())
+		w.Write(blob.content)
+	}))
+}
+
+// platformImage adds an image manifest and its config to the blobs,
+// and returns the digest of the manifest.
+func platformImage(blobs map[string]fakeBlob, mediaType string, created time.Time) digest.Digest {
+	config, _ := json.Marshal(map[string]interface{}{"created": created})
+	configDigest := digest.FromBytes(config)
+	blobs["/v2/org/app/blobs/"+configDigest.String()] = fakeBlob{"application/octet-stream", config}
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     mediaType,
+		"config":        map[string]interface{}{"digest": configDigest, "size": len(config)},
+	})
+	manifestDigest := digest.FromBytes(manifest)
+	blobs["/v2/org/app/manifests/"+manifestDigest.String()] = fakeBlob{mediaType, manifest}
+	return manifestDigest
+}
+
+func TestRemote_ManifestList(t *testing.T) {
+	amd64Created := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	arm64Created := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	for _, types := range []struct{ list, manifest string }{
+		{manifestlist.MediaTypeManifestList, schema2.MediaTypeManifest},
+		{MediaTypeOCIIndex, MediaTypeOCIManifest},
+	} {
+		blobs := map[string]fakeBlob{}
+		amd64 := platformImage(blobs, types.manifest, amd64Created)
+		arm64 := platformImage(blobs, types.manifest, arm64Created)
+		list, _ := json.Marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"mediaType":     types.list,
+			"manifests": []map[string]interface{}{
+				{"mediaType": types.manifest, "digest": amd64, "size": 1, "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+				{"mediaType": types.manifest, "digest": arm64, "size": 1, "platform": map[string]string{"os": "linux", "architecture": "arm64", "variant": "v8"}},
+			},
+		})
+		blobs["/v2/org/app/manifests/1.0"] = fakeBlob{types.list, list}
+		server := newFakeRegistry(blobs)
+		defer server.Close()
+		host, _ := url.Parse(server.URL)
+
+		for _, c := range []struct {
+			platforms []Platform
+			created   time.Time
+			excluded  bool
+		}{
+			{nil, amd64Created, false},
+			{[]Platform{{OS: "linux", Architecture: "arm64"}}, arm64Created, false},
+			{[]Platform{{OS: "linux", Architecture: "arm", Variant: "v7"}, {OS: "linux", Architecture: "arm64", Variant: "v8"}}, arm64Created, false},
+			{[]Platform{{OS: "windows", Architecture: "amd64"}}, time.Time{}, true},
+		} {
+			factory := &RemoteClientFactory{
+				Logger:        log.NewNopLogger(),
+				Limiters:      &middleware.RateLimiters{RPS: 100, Burst: 10},
+				InsecureHosts: []string{host.Host},
+				Platforms:     c.platforms,
+			}
+			client, err := factory.ClientFor(image.Name{Domain: host.Host, Image: "org/app"}.CanonicalName(), NoCredentials())
+			if err != nil {
+				t.Fatal(err)
+			}
+			entry, err := client.Manifest(context.Background(), "1.0")
+			if err != nil {
+				t.Fatalf("%s %v: %v", types.list, c.platforms, err)
+			}
+			assert.Equal(t, c.excluded, entry.ExcludedReason != "", types.list)
+			assert.Equal(t, "1.0", entry.ID.Tag)
+			assert.Equal(t, digest.FromBytes(list).String(), entry.Digest, types.list)
+			assert.Equal(t, c.created, entry.CreatedAt.UTC(), types.list)
+			assert.Equal(t, map[string]string{
+				"linux/amd64":    amd64.String(),
+				"linux/arm64/v8": arm64.String(),
+			}, entry.PlatformDigests, types.list)
+		}
+	}
+}
+
+// Images must be available for all the platforms required, whether
+// they're in manifest lists or not, so that an image which can't run
+// on the cluster's nodes is never released.
+func TestRemote_RequiredPlatforms(t *testing.T) {
+	created := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	blobs := map[string]fakeBlob{}
+	amd64 := platformImage(blobs, schema2.MediaTypeManifest, created)
+	arm64 := platformImage(blobs, schema2.MediaTypeManifest, created)
+	list, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     manifestlist.MediaTypeManifestList,
+		"manifests": []map[string]interface{}{
+			{"mediaType": schema2.MediaTypeManifest, "digest": amd64, "size": 1, "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+			{"mediaType": schema2.MediaTypeManifest, "digest": arm64, "size": 1, "platform": map[string]string{"os": "linux", "architecture": "arm64", "variant": "v8"}},
+		},
+	})
+	blobs["/v2/org/app/manifests/multi"] = fakeBlob{manifestlist.MediaTypeManifestList, list}
+	// An image that's not in a manifest list says what it's for in
+	// its config
+	config, _ := json.Marshal(map[string]interface{}{"created": created, "os": "linux", "architecture": "amd64"})
+	configDigest := digest.FromBytes(config)
+	blobs["/v2/org/app/blobs/"+configDigest.String()] = fakeBlob{"application/octet-stream", config}
+	single, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     schema2.MediaTypeManifest,
+		"config":        map[string]interface{}{"digest": configDigest, "size": len(config)},
+	})
+	blobs["/v2/org/app/manifests/amd64-only"] = fakeBlob{schema2.MediaTypeManifest, single}
+
+	server := newFakeRegistry(blobs)
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	arm64Platform := Platform{OS: "linux", Architecture: "arm64"}
+	amd64Platform := Platform{OS: "linux", Architecture: "amd64"}
+	armv7Platform := Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	for _, c := range []struct {
+		tag      string
+		required []Platform
+		excluded bool
+	}{
+		{"multi", nil, false},
+		{"multi", []Platform{arm64Platform}, false},
+		{"multi", []Platform{amd64Platform, arm64Platform}, false},
+		{"multi", []Platform{arm64Platform, armv7Platform}, true},
+		{"amd64-only", nil, false},
+		{"amd64-only", []Platform{amd64Platform}, false},
+		{"amd64-only", []Platform{arm64Platform}, true},
+		{"amd64-only", []Platform{amd64Platform, arm64Platform}, true},
+	} {
+		factory := &RemoteClientFactory{
+			Logger:            log.NewNopLogger(),
+			Limiters:          &middleware.RateLimiters{RPS: 100, Burst: 10},
+			InsecureHosts:     []string{host.Host},
+			Platforms:         c.required,
+			RequiredPlatforms: c.required,
+		}
+		client, err := factory.ClientFor(image.Name{Domain: host.Host, Image: "org/app"}.CanonicalName(), NoCredentials())
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := client.Manifest(context.Background(), c.tag)
+		if err != nil {
+			t.Fatalf("%s %v: %v", c.tag, c.required, err)
+		}
+		assert.Equal(t, c.excluded, entry.ExcludedReason != "", "%s %v: %s", c.tag, c.required, entry.ExcludedReason)
+	}
+}
+
+func TestImageEntry_JSON(t *testing.T) {
+	ref, _ := image.ParseRef("quay.io/example/app:1.0")
+	created := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, entry := range []ImageEntry{
+		{Info: image.Info{ID: ref, CreatedAt: created}},
+		{Info: image.Info{ID: ref, PlatformDigests: map[string]string{"linux/amd64": "sha256:1234"}}, ExcludedReason: "required platforms (linux/arm64) not in manifest list"},
+	} {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ImageEntry
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, entry, got, string(b))
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	for s, expected := range map[string]Platform{
+		"linux/amd64":  {OS: "linux", Architecture: "amd64"},
+		"linux/arm/v7": {OS: "linux", Architecture: "arm", Variant: "v7"},
+	} {
+		p, err := ParsePlatform(s)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, p)
+		assert.Equal(t, s, p.String())
+	}
+	for _, s := range []string{"linux", "/amd64", "linux/arm/v7/extra"} {
+		_, err := ParsePlatform(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRemote_ManifestLabels(t *testing.T) {
+	config, _ := json.Marshal(map[string]interface{}{
+		"created": time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		"config": map[string]interface{}{"Labels": map[string]string{
+			image.LabelRevision:     "a1b2c3d",
+			image.LabelSchemaSource: "https://github.com/org/app-old",
+			image.LabelSource:       "https://github.com/org/app",
+			"com.example.unrelated": "ignored",
+		}},
+	})
+	configDigest := digest.FromBytes(config)
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     schema2.MediaTypeManifest,
+		"config":        map[string]interface{}{"digest": configDigest, "size": len(config)},
+	})
+	server := newFakeRegistry(map[string]fakeBlob{
+		"/v2/org/app/blobs/" + configDigest.String(): {"application/octet-stream", config},
+		"/v2/org/app/manifests/1.0":                  {schema2.MediaTypeManifest, manifest},
+	})
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	factory := &RemoteClientFactory{
+		Logger:        log.NewNopLogger(),
+		Limiters:      &middleware.RateLimiters{RPS: 100, Burst: 10},
+		InsecureHosts: []string{host.Host},
+	}
+	client, err := factory.ClientFor(image.Name{Domain: host.Host, Image: "org/app"}.CanonicalName(), NoCredentials())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := client.Manifest(context.Background(), "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, image.Labels{Revision: "a1b2c3d", Source: "https://github.com/org/app"}, entry.Labels)
+}
@@ -0,0 +1,192 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// The prefix of the executables that are Docker credential
+	// helpers; e.g., the helper `ecr-login` is run as
+	// `docker-credential-ecr-login`.
+	credentialHelperPrefix = "docker-credential-"
+	// How long to wait for a credential helper to answer
+	credentialHelperTimeout = 30 * time.Second
+	// How long to use the credentials from a credential helper
+	// before asking for them again. Helpers don't say when the
+	// credentials they give expire, but some (e.g., `ecr-login` and
+	// `gcr`) give tokens that do.
+	credentialHelperLifetime = 10 * time.Minute
+	// The username a credential helper gives with an identity
+	// token, rather than a password
+	credentialHelperTokenUsername = "<token>"
+)
+
+// credentialHelperProvider gets credentials from the Docker
+// credential helpers named in a Docker config file: those given for
+// particular registries in `credHelpers`, and the `credsStore`, for
+// the registries listed (without credentials) in `auths`.
+type credentialHelperProvider struct {
+	configPath string
+	run        func(helper, serverURL string) ([]byte, error)
+	cache      *tokenCache
+
+	// The config file as last read, and the modification time and
+	// size it had then, so it's read again only when it changes
+	configMu      sync.Mutex
+	config        dockerConfig
+	configModTime time.Time
+	configSize    int64
+}
+
+// NewCredentialHelperProvider returns a provider of credentials from
+// the Docker credential helpers named in the Docker config file
+// given. The helpers are run as `docker-credential-<name>`, so must
+// be on the PATH.
+func NewCredentialHelperProvider(logger log.Logger, configPath string) CredentialsProvider {
+	p := &credentialHelperProvider{
+		configPath: configPath,
+		run:        runCredentialHelper,
+	}
+	p.cache = newTokenCache("credential helper", logger, p.getCreds)
+	return p
+}
+
+func (p *credentialHelperProvider) credsFor(host string) (creds, bool) {
+	if helper, _ := p.helperFor(host); helper == "" {
+		return creds{}, false
+	}
+	return p.cache.get(host)
+}
+
+// loadConfig returns the config file's contents, reading it again
+// if it has changed since it was last read. A missing or unreadable
+// file is treated as empty.
+func (p *credentialHelperProvider) loadConfig() dockerConfig {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	info, err := os.Stat(p.configPath)
+	if err != nil {
+		p.config, p.configModTime, p.configSize = dockerConfig{}, time.Time{}, 0
+		return p.config
+	}
+	if info.ModTime().Equal(p.configModTime) && info.Size() == p.configSize {
+		return p.config
+	}
+	var config dockerConfig
+	if bs, err := ioutil.ReadFile(p.configPath); err == nil {
+		if err := json.Unmarshal(bs, &config); err != nil {
+			config = dockerConfig{}
+		}
+	}
+	p.config, p.configModTime, p.configSize = config, info.ModTime(), info.Size()
+	return p.config
+}
+
+// helperFor returns the credential helper to use for the registry
+// host, if there is one, and the server URL to give it, as written in
+// the config file. When more than one entry is for the host (e.g.,
+// `gcr.io` and `https://gcr.io`), one written as the host itself
+// wins, then the first in lexical order.
+func (p *credentialHelperProvider) helperFor(host string) (helper, serverURL string) {
+	config := p.loadConfig()
+	if server := matchServer(host, keys(config.CredHelpers)); server != "" {
+		return config.CredHelpers[server], server
+	}
+	if config.CredsStore != "" {
+		var loggedIn []string
+		for server, entry := range config.Auths {
+			if entry.Auth == "" {
+				loggedIn = append(loggedIn, server)
+			}
+		}
+		if server := matchServer(host, loggedIn); server != "" {
+			return config.CredsStore, server
+		}
+	}
+	return "", ""
+}
+
+// matchServer picks the server URL from those given that is for the
+// host, preferring one that is exactly the host, or failing that the
+// first in lexical order; or returns the empty string if none are.
+func matchServer(host string, servers []string) string {
+	sort.Strings(servers)
+	match := ""
+	for _, server := range servers {
+		if server == host {
+			return server
+		}
+		if h, err := registryHost(server); err == nil && h == host && match == "" {
+			match = server
+		}
+	}
+	return match
+}
+
+func keys(m map[string]string) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+func (p *credentialHelperProvider) getCreds(host string) (creds, time.Time, error) {
+	helper, serverURL := p.helperFor(host)
+	if helper == "" {
+		return creds{}, time.Time{}, fmt.Errorf("no credential helper for %s", host)
+	}
+	out, err := p.run(helper, serverURL)
+	if err != nil {
+		return creds{}, time.Time{}, errors.Wrapf(err, "running credential helper %q", helper)
+	}
+	var result struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return creds{}, time.Time{}, errors.Wrapf(err, "decoding output of credential helper %q", helper)
+	}
+	if result.Username == credentialHelperTokenUsername {
+		return creds{}, time.Time{}, fmt.Errorf("credential helper %q gave an identity token, which is not supported", helper)
+	}
+	return creds{
+		registry:   host,
+		provenance: credentialHelperPrefix + helper,
+		username:   result.Username,
+		password:   result.Secret,
+	}, p.cache.now().Add(credentialHelperLifetime), nil
+}
+
+// runCredentialHelper asks the credential helper for the credentials
+// for the server, as `docker` would.
+func runCredentialHelper(helper, serverURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, credentialHelperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers mostly explain themselves on stdout
+		if msg := strings.TrimSpace(string(out) + " " + stderr.String()); msg != "" {
+			return nil, errors.Wrap(err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,156 @@
+package registry
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const helperConfig = `{
+  "auths": {
+    "https://index.docker.io/v1/": {},
+    "quay.io": {"auth": "dXNlcjpwYXNz"}
+  },
+  "credHelpers": {
+    "123456789012.dkr.ecr.eu-west-1.amazonaws.com": "ecr-login",
+    "https://gcr.io": "gcloud"
+  },
+  "credsStore": "secretservice"
+}`
+
+func writeHelperConfig(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "flux-docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(helperConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestCredentialHelperProvider(t *testing.T) {
+	path, cleanup := writeHelperConfig(t)
+	defer cleanup()
+
+	var asked []string
+	p := NewCredentialHelperProvider(log.NewNopLogger(), path).(*credentialHelperProvider)
+	p.run = func(helper, serverURL string) ([]byte, error) {
+		asked = append(asked, helper+" "+serverURL)
+		switch helper {
+		case "ecr-login":
+			return []byte(`{"ServerURL":"123456789012.dkr.ecr.eu-west-1.amazonaws.com","Username":"AWS","Secret":"ecr-token"}`), nil
+		case "secretservice":
+			return []byte(`{"ServerURL":"https://index.docker.io/v1/","Username":"hubuser","Secret":"hubpass"}`), nil
+		}
+		return nil, errors.New("credentials not found in native keychain")
+	}
+
+	c, ok := p.credsFor("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.True(t, ok)
+	assert.Equal(t, "AWS", c.username)
+	assert.Equal(t, "ecr-token", c.password)
+
+	// The credentials store is used for the registries logged in to
+	c, ok = p.credsFor("index.docker.io")
+	assert.True(t, ok)
+	assert.Equal(t, "hubuser", c.username)
+	assert.Equal(t, "hubpass", c.password)
+
+	// A helper that fails gives nothing
+	_, ok = p.credsFor("gcr.io")
+	assert.False(t, ok)
+
+	// .. and registries with no helper aren't asked about
+	_, ok = p.credsFor("quay.io")
+	assert.False(t, ok)
+	_, ok = p.credsFor("k8s.gcr.io")
+	assert.False(t, ok)
+
+	// Credentials are kept for a while
+	p.credsFor("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.Equal(t, []string{
+		"ecr-login 123456789012.dkr.ecr.eu-west-1.amazonaws.com",
+		"secretservice https://index.docker.io/v1/",
+		"gcloud https://gcr.io",
+	}, asked)
+}
+
+func TestCredentialHelperProvider_HelperFor(t *testing.T) {
+	path, cleanup := writeHelperConfig(t)
+	defer cleanup()
+	p := NewCredentialHelperProvider(log.NewNopLogger(), path).(*credentialHelperProvider)
+
+	write := func(config string, modTime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Several entries for the same host are chosen between the same
+	// way every time
+	write(`{"credHelpers": {"https://gcr.io": "b", "gcr.io": "a", "https://eu.gcr.io": "d", "http://eu.gcr.io": "c"}}`, time.Now().Add(-time.Minute))
+	for i := 0; i < 10; i++ {
+		helper, server := p.helperFor("gcr.io")
+		assert.Equal(t, "a", helper)
+		assert.Equal(t, "gcr.io", server)
+		helper, server = p.helperFor("eu.gcr.io")
+		assert.Equal(t, "c", helper)
+		assert.Equal(t, "http://eu.gcr.io", server)
+	}
+
+	// A changed config is read again
+	helper, _ := p.helperFor("quay.io")
+	assert.Equal(t, "", helper)
+	write(`{"credHelpers": {"quay.io": "quay"}}`, time.Now())
+	helper, _ = p.helperFor("quay.io")
+	assert.Equal(t, "quay", helper)
+
+	// .. and a removed one means no helpers
+	os.Remove(path)
+	helper, _ = p.helperFor("quay.io")
+	assert.Equal(t, "", helper)
+}
+
+func TestRunCredentialHelper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-credential-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := "#!/bin/sh\nread server\necho \"{\\\"ServerURL\\\":\\\"$server\\\",\\\"Username\\\":\\\"user\\\",\\\"Secret\\\":\\\"$1\\\"}\"\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, credentialHelperPrefix+"test"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	out, err := runCredentialHelper("test", "registry.example.com")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"ServerURL":"registry.example.com","Username":"user","Secret":"get"}`, string(out))
+
+	_, err = runCredentialHelper("missing", "registry.example.com")
+	assert.Error(t, err)
+}
+
+func TestParseCredentials_CredsStore(t *testing.T) {
+	c, err := ParseCredentials("test", []byte(helperConfig))
+	assert.NoError(t, err)
+	// The registries with credentials in the store are left to the
+	// credential helper provider
+	assert.Equal(t, []string{"quay.io"}, c.Hosts())
+
+	c, err = ParseCredentials("test", []byte(`{"credHelpers": {"gcr.io": "gcloud"}}`))
+	assert.NoError(t, err)
+	assert.Empty(t, c.Hosts())
+}
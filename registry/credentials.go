@@ -36,23 +36,37 @@ func NoCredentials() Credentials {
 	}
 }
 
-func ParseCredentials(from string, b []byte) (Credentials, error) {
-	var config struct {
-		Auths map[string]struct {
-			Auth string
-		}
+// dockerConfig is the part of a Docker config file (or image pull
+// secret) that says where to get registry credentials.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string
 	}
+	// Credential helpers to use for particular registries, and
+	// the credentials store to use for the others
+	CredHelpers map[string]string
+	CredsStore  string
+}
+
+func ParseCredentials(from string, b []byte) (Credentials, error) {
+	var config dockerConfig
 	if err := json.Unmarshal(b, &config); err != nil {
 		return Credentials{}, err
 	}
 	// If it's in k8s format, it won't have the surrounding "Auth". Try that too.
-	if len(config.Auths) == 0 {
+	if len(config.Auths) == 0 && len(config.CredHelpers) == 0 && config.CredsStore == "" {
 		if err := json.Unmarshal(b, &config.Auths); err != nil {
 			return Credentials{}, err
 		}
 	}
 	m := map[string]creds{}
 	for host, entry := range config.Auths {
+		// Registries logged in to with a credentials store are
+		// listed, but without credentials; those are got from
+		// the store (see NewCredentialHelperProvider).
+		if entry.Auth == "" && config.CredsStore != "" {
+			continue
+		}
 		decodedAuth, err := base64.StdEncoding.DecodeString(entry.Auth)
 		if err != nil {
 			return Credentials{}, err
@@ -63,30 +77,10 @@ func ParseCredentials(from string, b []byte) (Credentials, error) {
 				fmt.Errorf("decoded credential for %v has wrong number of fields (expected 2, got %d)", host, len(authParts))
 		}
 
-		// Some users were passing in credentials in the form of
-		// http://docker.io and http://docker.io/v1/, etc.
-		// So strip everything down to the host.
-		// Also, the registry might be local and on a different port.
-		// So we need to check for that because url.Parse won't parse the ip:port format very well.
-		u, err := url.Parse(host)
+		host, err = registryHost(host)
 		if err != nil {
 			return Credentials{}, err
 		}
-		if u.Host == "" && u.Path == "" && !strings.Contains(host, ":") || host == "http://" || host == "https://" {
-			return Credentials{}, errors.New("Empty registry auth url")
-		}
-		if u.Host == "" { // If there's no https:// prefix, it won't parse the host.
-			u, err = url.Parse(fmt.Sprintf("https://%s/", host))
-			if err != nil {
-				return Credentials{}, err
-			}
-			// If the host is still empty, then there's probably a rogue /
-			if u.Host == "" {
-				return Credentials{}, errors.New("Invalid registry auth url. Must be a valid http address (e.g. https://gcr.io/v1/)")
-			}
-		}
-		host = u.Host
-
 		m[host] = creds{
 			registry:   host,
 			provenance: from,
@@ -97,6 +91,34 @@ func ParseCredentials(from string, b []byte) (Credentials, error) {
 	return Credentials{m: m}, nil
 }
 
+// registryHost gives the host of a registry named in a Docker config
+// file.
+func registryHost(host string) (string, error) {
+	// Some users were passing in credentials in the form of
+	// http://docker.io and http://docker.io/v1/, etc.
+	// So strip everything down to the host.
+	// Also, the registry might be local and on a different port.
+	// So we need to check for that because url.Parse won't parse the ip:port format very well.
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" && u.Path == "" && !strings.Contains(host, ":") || host == "http://" || host == "https://" {
+		return "", errors.New("Empty registry auth url")
+	}
+	if u.Host == "" { // If there's no https:// prefix, it won't parse the host.
+		u, err = url.Parse(fmt.Sprintf("https://%s/", host))
+		if err != nil {
+			return "", err
+		}
+		// If the host is still empty, then there's probably a rogue /
+		if u.Host == "" {
+			return "", errors.New("Invalid registry auth url. Must be a valid http address (e.g. https://gcr.io/v1/)")
+		}
+	}
+	return u.Host, nil
+}
+
 func ImageCredsWithDefaults(lookup func() ImageCreds, configPath string) (func() ImageCreds, error) {
 	// pre-flight check
 	bs, err := ioutil.ReadFile(configPath)
@@ -131,11 +153,6 @@ func (cs Credentials) credsFor(host string) creds {
 	if cred, found := cs.m[host]; found {
 		return cred
 	}
-	if host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") {
-		if cred, err := GetGCPOauthToken(host); err == nil {
-			return cred
-		}
-	}
 	return creds{}
 }
 
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"github.com/ryanuber/go-glob"
+
+	"github.com/weaveworks/flux/image"
+)
+
+// ImageFilter says which images to scan, by way of globs matched
+// against image names (without a tag), e.g., `k8s.gcr.io/*`. A glob
+// matches a name if it matches either the name as written in the
+// workload, or its canonical form, which includes the registry host
+// (e.g., `index.docker.io/library/nginx` for `nginx`).
+type ImageFilter struct {
+	// Only images matching at least one of these; all images, if
+	// empty
+	Include []string
+	// No images matching any of these, even if they are included
+	Exclude []string
+}
+
+// Includes reports whether the image is to be scanned.
+func (f ImageFilter) Includes(name image.Name) bool {
+	if len(f.Include) > 0 && !matchesAny(f.Include, name) {
+		return false
+	}
+	return !matchesAny(f.Exclude, name)
+}
+
+func matchesAny(globs []string, name image.Name) bool {
+	names := []string{name.String(), name.CanonicalName().String()}
+	for _, g := range globs {
+		for _, n := range names {
+			if glob.Glob(g, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ImageCredsWithFilter wraps an image credentials func so that it
+// leaves out the images the filter doesn't include; those images
+// are then not scanned, which saves trying (and failing) to reach
+// registries that can't be reached, e.g., from air-gapped clusters.
+func ImageCredsWithFilter(lookup func() ImageCreds, filter ImageFilter) func() ImageCreds {
+	if len(filter.Include) == 0 && len(filter.Exclude) == 0 {
+		return lookup
+	}
+	return func() ImageCreds {
+		imageCreds := lookup()
+		for name := range imageCreds {
+			if !filter.Includes(name) {
+				delete(imageCreds, name)
+			}
+		}
+		return imageCreds
+	}
+}
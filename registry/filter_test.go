@@ -0,0 +1,44 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+)
+
+func TestImageFilter(t *testing.T) {
+	filter := ImageFilter{
+		Include: []string{"quay.io/*", "index.docker.io/library/*", "k8s.gcr.io/*"},
+		Exclude: []string{"k8s.gcr.io/*", "quay.io/weaveworks/*"},
+	}
+	for im, included := range map[string]bool{
+		"nginx":                     true,
+		"quay.io/coreos/etcd":       true,
+		"quay.io/weaveworks/flux":   false,
+		"k8s.gcr.io/pause":          false,
+		"docker.io/weaveworks/flux": false,
+		"gcr.io/foo/bar":            false,
+	} {
+		ref, err := image.ParseRef(im)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, included, filter.Includes(ref.Name), im)
+	}
+}
+
+func TestImageCredsWithFilter(t *testing.T) {
+	pause, _ := image.ParseRef("k8s.gcr.io/pause:3.1")
+	flux, _ := image.ParseRef("quay.io/weaveworks/flux:1.10.0")
+	lookup := func() ImageCreds {
+		return ImageCreds{
+			pause.Name: NoCredentials(),
+			flux.Name:  NoCredentials(),
+		}
+	}
+	imageCreds := ImageCredsWithFilter(lookup, ImageFilter{Exclude: []string{"k8s.gcr.io/*"}})()
+	assert.NotContains(t, imageCreds, pause.Name)
+	assert.Contains(t, imageCreds, flux.Name)
+}
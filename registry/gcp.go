@@ -1,52 +1,156 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 )
 
 const (
-	gcpDefaultTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	// The scope to ask for when exchanging a user's refresh token
+	gcpCloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+	// The username to give with an access token
+	gcpTokenUsername = "oauth2accesstoken"
+	// The username to give with a service account key
+	gcpJSONKeyUsername = "_json_key"
+	// How often to read a service account key file again, in case
+	// it's been replaced
+	gcpKeyFileReloadInterval = time.Hour
 )
 
-type gceToken struct {
-	AccessToken string `json:"access_token"`
-	ExpiresIn   int    `json:"expires_in"`
-	TokenType   string `json:"token_type"`
+// gcpHostRegexp matches the hosts of Google Container Registry and
+// (the Docker repositories of) Artifact Registry.
+var gcpHostRegexp = regexp.MustCompile(`^(?:[a-z0-9-]+\.)?gcr\.io$|^[a-z0-9-]+-docker\.pkg\.dev$`)
+
+// gcpProvider gets credentials for Google Container Registry and
+// Artifact Registry from the application default credentials: the
+// key file given by GOOGLE_APPLICATION_CREDENTIALS, or that written
+// by `gcloud auth application-default login`, or failing those, the
+// service account of the GCE instance (or GKE workload identity).
+type gcpProvider struct {
+	getenv func(string) string
+	// The context used for getting tokens; this can carry an
+	// oauth2.HTTPClient, in tests.
+	ctx context.Context
+	// The source of tokens for the instance's service account
+	metadata oauth2.TokenSource
+	cache    *tokenCache
 }
 
-func GetGCPOauthToken(host string) (creds, error) {
-	request, err := http.NewRequest("GET", gcpDefaultTokenURL, nil)
-	if err != nil {
-		return creds{}, err
+// NewGCPProvider returns a provider of credentials for Google's
+// image registries.
+func NewGCPProvider(logger log.Logger) CredentialsProvider {
+	p := &gcpProvider{
+		getenv:   os.Getenv,
+		ctx:      context.Background(),
+		metadata: google.ComputeTokenSource(""),
 	}
+	p.cache = newTokenCache("GCP", logger, p.getToken)
+	return p
+}
 
-	request.Header.Add("Metadata-Flavor", "Google")
+func (p *gcpProvider) credsFor(host string) (creds, bool) {
+	if !gcpHostRegexp.MatchString(host) {
+		return creds{}, false
+	}
+	return p.cache.get(host)
+}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+func (p *gcpProvider) getToken(host string) (creds, time.Time, error) {
+	if file := p.credentialsFile(); file != "" {
+		return p.fromCredentialsFile(host, file)
+	}
+	token, err := p.metadata.Token()
 	if err != nil {
-		return creds{}, err
+		return creds{}, time.Time{}, err
 	}
+	return creds{
+		registry:   host,
+		provenance: "GCP metadata",
+		username:   gcpTokenUsername,
+		password:   token.AccessToken,
+	}, token.Expiry, nil
+}
 
-	if response.StatusCode != http.StatusOK {
-		return creds{}, fmt.Errorf("unexpected status from metadata service: %s", response.Status)
+// credentialsFile returns the path of the application default
+// credentials file, or the empty string if there isn't one.
+func (p *gcpProvider) credentialsFile() string {
+	if file := p.getenv("GOOGLE_APPLICATION_CREDENTIALS"); file != "" {
+		return file
 	}
+	if home := p.getenv("HOME"); home != "" {
+		file := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
 
-	var token gceToken
-	decoder := json.NewDecoder(response.Body)
-	if err := decoder.Decode(&token); err != nil {
-		return creds{}, err
+// fromCredentialsFile gets credentials using the file, which is
+// either a service account key, which can be given to the registry
+// as it is, or a user's refresh token, which is exchanged for an
+// access token.
+func (p *gcpProvider) fromCredentialsFile(host, file string) (creds, time.Time, error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return creds{}, time.Time{}, err
+	}
+	var config struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return creds{}, time.Time{}, errors.Wrapf(err, "decoding %s", file)
 	}
 
-	if err := response.Body.Close(); err != nil {
-		return creds{}, err
+	switch config.Type {
+	case "service_account":
+		return creds{
+			registry:   host,
+			provenance: file,
+			username:   gcpJSONKeyUsername,
+			password:   string(bytes),
+		}, p.cache.now().Add(gcpKeyFileReloadInterval), nil
+	case "authorized_user":
+		credentials, err := google.CredentialsFromJSON(p.ctx, bytes, gcpCloudPlatformScope)
+		if err != nil {
+			return creds{}, time.Time{}, errors.Wrapf(err, "reading credentials from %s", file)
+		}
+		token, err := credentials.TokenSource.Token()
+		if err != nil {
+			return creds{}, time.Time{}, err
+		}
+		return creds{
+			registry:   host,
+			provenance: file,
+			username:   gcpTokenUsername,
+			password:   token.AccessToken,
+		}, token.Expiry, nil
+	default:
+		return creds{}, time.Time{}, fmt.Errorf("unsupported type of credentials %q in %s", config.Type, file)
 	}
+}
 
+// GetGCPOauthToken gets an access token for the instance's service
+// account, for the registry host given.
+func GetGCPOauthToken(host string) (creds, error) {
+	token, err := google.ComputeTokenSource("").Token()
+	if err != nil {
+		return creds{}, err
+	}
 	return creds{
 		registry:   host,
 		provenance: "",
-		username:   "oauth2accesstoken",
+		username:   gcpTokenUsername,
 		password:   token.AccessToken}, nil
 }
@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// redirectTransport sends every request to the test server, so that
+// requests to Google's token endpoint can be answered there.
+type redirectTransport struct {
+	server *httptest.Server
+}
+
+func (t redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(t.server.URL)
+	r.URL.Scheme, r.URL.Host = u.Scheme, u.Host
+	return t.server.Client().Transport.RoundTrip(r)
+}
+
+func setupGCP(t *testing.T, env map[string]string) (*gcpProvider, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			assert.Equal(t, "refresh", r.FormValue("refresh_token"))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"user-token","expires_in":3600,"token_type":"Bearer"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	client := &http.Client{Transport: redirectTransport{server}}
+	p := &gcpProvider{
+		getenv: func(k string) string { return env[k] },
+		ctx:    context.WithValue(context.Background(), oauth2.HTTPClient, client),
+		metadata: oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken: "metadata-token",
+			Expiry:      time.Now().Add(time.Hour),
+		}),
+	}
+	p.cache = newTokenCache("GCP", log.NewNopLogger(), p.getToken)
+	return p, server.Close
+}
+
+func TestGCPProvider_Hosts(t *testing.T) {
+	p, cleanup := setupGCP(t, nil)
+	defer cleanup()
+	for host, included := range map[string]bool{
+		"gcr.io":                         true,
+		"eu.gcr.io":                      true,
+		"europe-west1-docker.pkg.dev":    true,
+		"europe-west1-npm.pkg.dev":       false,
+		"index.docker.io":                false,
+		"123456789012.dkr.ecr.amazonaws": false,
+	} {
+		c, ok := p.credsFor(host)
+		assert.Equal(t, included, ok, host)
+		if ok {
+			assert.Equal(t, gcpTokenUsername, c.username)
+			assert.Equal(t, "metadata-token", c.password)
+		}
+	}
+}
+
+func TestGCPProvider_CredentialsFile(t *testing.T) {
+	for typ, expected := range map[string]creds{
+		"service_account": {username: gcpJSONKeyUsername},
+		"authorized_user": {username: gcpTokenUsername, password: "user-token"},
+	} {
+		file, err := ioutil.TempFile("", "flux-gcp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		key := `{"type":"` + typ + `","client_id":"id","client_secret":"secret","refresh_token":"refresh"}`
+		file.WriteString(key)
+		file.Close()
+		if expected.password == "" {
+			expected.password = key
+		}
+
+		p, cleanup := setupGCP(t, map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": file.Name()})
+		defer cleanup()
+		c, ok := p.credsFor("gcr.io")
+		assert.True(t, ok, typ)
+		assert.Equal(t, expected.username, c.username, typ)
+		assert.Equal(t, expected.password, c.password, typ)
+	}
+}
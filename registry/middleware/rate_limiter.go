@@ -2,17 +2,97 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/prometheus"
 	"github.com/pkg/errors"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/time/rate"
 )
 
+const (
+	// When a registry says to slow down, divide the rate by this ...
+	backOffBy = 2.0
+	// ... but not below this many requests per second.
+	minLimit = 0.1
+	// After each successful request, multiply the rate by this, until
+	// it's back to the rate configured.
+	recoverBy = 1.1
+	// The longest to wait when a registry says when to try again,
+	// in case it says something unreasonable.
+	maxRetryAfter = 10 * time.Minute
+)
+
+const labelHost = "host"
+
+var (
+	throttledRequests = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "registry",
+		Name:      "throttled_requests_total",
+		Help:      "Count of requests that an image registry refused because of rate limiting (status 429).",
+	}, []string{labelHost})
+	requestRateLimit = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "registry",
+		Name:      "rate_limit",
+		Help:      "The number of requests per second currently allowed to each image registry host.",
+	}, []string{labelHost})
+)
+
+// HostLimit is the rate limit for requests to a particular host.
+type HostLimit struct {
+	RPS   float64
+	Burst int
+}
+
+// ParseHostLimit parses a limit for a host given as
+// `host=rps[/burst]`, e.g., `index.docker.io=2/5`.
+func ParseHostLimit(s string) (string, HostLimit, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", HostLimit{}, fmt.Errorf("%q is not of the form host=rps[/burst]", s)
+	}
+	host, value := parts[0], parts[1]
+	var limit HostLimit
+	rpsBurst := strings.SplitN(value, "/", 2)
+	rps, err := strconv.ParseFloat(rpsBurst[0], 64)
+	if err != nil || rps <= 0 {
+		return "", HostLimit{}, fmt.Errorf("requests per second in %q must be a number greater than zero", s)
+	}
+	limit.RPS = rps
+	if len(rpsBurst) == 2 {
+		burst, err := strconv.Atoi(rpsBurst[1])
+		if err != nil || burst <= 0 {
+			return "", HostLimit{}, fmt.Errorf("burst in %q must be a whole number greater than zero", s)
+		}
+		limit.Burst = burst
+	}
+	return host, limit, nil
+}
+
+// RateLimiters keeps a token bucket rate limiter for each registry
+// host. When a host refuses a request because of its own rate
+// limiting (with status 429), the rate for that host is halved, and
+// if the host says when to try again (with a Retry-After header), no
+// more requests are made to it until then. The rate then recovers
+// bit by bit with each successful request.
 type RateLimiters struct {
 	RPS, Burst int
-	perHost    map[string]*rate.Limiter
-	mu         sync.Mutex
+	// Limits for particular hosts, overriding RPS and Burst. A
+	// burst of zero means use Burst.
+	HostLimits map[string]HostLimit
+	// If not nil, backing off and recovering are logged
+	Logger log.Logger
+
+	perHost map[string]*hostLimiter
+	mu      sync.Mutex
 }
 
 // Limit returns a RoundTripper for a particular host. We expect to do
@@ -22,31 +102,150 @@ func (limiters *RateLimiters) RoundTripper(rt http.RoundTripper, host string) ht
 	defer limiters.mu.Unlock()
 
 	if limiters.perHost == nil {
-		limiters.perHost = map[string]*rate.Limiter{}
+		limiters.perHost = map[string]*hostLimiter{}
 	}
 	if _, ok := limiters.perHost[host]; !ok {
-		rl := rate.NewLimiter(rate.Limit(limiters.RPS), limiters.Burst)
-		limiters.perHost[host] = rl
+		limit, burst := rate.Limit(limiters.RPS), limiters.Burst
+		if hostLimit, ok := limiters.HostLimits[host]; ok {
+			limit = rate.Limit(hostLimit.RPS)
+			if hostLimit.Burst > 0 {
+				burst = hostLimit.Burst
+			}
+		}
+		logger := limiters.Logger
+		if logger == nil {
+			logger = log.NewNopLogger()
+		}
+		limiters.perHost[host] = &hostLimiter{
+			host:   host,
+			logger: logger,
+			limit:  limit,
+			rl:     rate.NewLimiter(limit, burst),
+			now:    time.Now,
+		}
+		requestRateLimit.With(labelHost, host).Set(float64(limit))
 	}
 	return &RoundTripRateLimiter{
-		rl: limiters.perHost[host],
-		tx: rt,
+		limiter: limiters.perHost[host],
+		tx:      rt,
+	}
+}
+
+// hostLimiter limits the requests to one host, adapting the rate to
+// what the host will accept.
+type hostLimiter struct {
+	host   string
+	logger log.Logger
+	limit  rate.Limit // as configured
+	rl     *rate.Limiter
+	now    func() time.Time
+
+	mu           sync.Mutex
+	blockedUntil time.Time
+}
+
+// wait blocks until a request can be made, or returns an error if
+// the context is done (or will be) before then.
+func (l *hostLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	blockedUntil := l.blockedUntil
+	l.mu.Unlock()
+	if delay := blockedUntil.Sub(l.now()); delay > 0 {
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(blockedUntil) {
+			return fmt.Errorf("host %s asked to wait until %s", l.host, blockedUntil.Format(time.RFC3339))
+		}
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return l.rl.Wait(ctx)
+}
+
+// backOff reduces the rate, and if retryAfter is not zero, stops
+// requests until then.
+func (l *hostLimiter) backOff(retryAfter time.Time) {
+	throttledRequests.With(labelHost, l.host).Add(1)
+	newLimit := l.rl.Limit() / backOffBy
+	if newLimit < minLimit {
+		newLimit = minLimit
+	}
+	l.rl.SetLimit(newLimit)
+	requestRateLimit.With(labelHost, l.host).Set(float64(newLimit))
+
+	l.mu.Lock()
+	if retryAfter.After(l.blockedUntil) {
+		l.blockedUntil = retryAfter
+	}
+	l.mu.Unlock()
+	keyvals := []interface{}{"host", l.host, "info", "throttled by registry; reducing request rate", "rps", float64(newLimit)}
+	if !retryAfter.IsZero() {
+		keyvals = append(keyvals, "retry-after", retryAfter)
+	}
+	l.logger.Log(keyvals...)
+}
+
+// recover increases the rate, up to that configured.
+func (l *hostLimiter) recover() {
+	current := l.rl.Limit()
+	if current >= l.limit {
+		return
+	}
+	newLimit := current * recoverBy
+	if newLimit >= l.limit {
+		newLimit = l.limit
+		l.logger.Log("host", l.host, "info", "request rate recovered", "rps", float64(newLimit))
 	}
+	l.rl.SetLimit(newLimit)
+	requestRateLimit.With(labelHost, l.host).Set(float64(newLimit))
+}
+
+// parseRetryAfter interprets a Retry-After header, which can be
+// either a number of seconds or a date. It returns the zero time if
+// the header is missing or can't be parsed.
+func parseRetryAfter(header string, now time.Time) time.Time {
+	if header == "" {
+		return time.Time{}
+	}
+	var retryAfter time.Time
+	if seconds, err := strconv.Atoi(header); err == nil {
+		retryAfter = now.Add(time.Duration(seconds) * time.Second)
+	} else if date, err := http.ParseTime(header); err == nil {
+		retryAfter = date
+	} else {
+		return time.Time{}
+	}
+	if retryAfter.After(now.Add(maxRetryAfter)) {
+		retryAfter = now.Add(maxRetryAfter)
+	}
+	return retryAfter
 }
 
 type RoundTripRateLimiter struct {
-	rl *rate.Limiter
-	tx http.RoundTripper
+	limiter *hostLimiter
+	tx      http.RoundTripper
 }
 
 func (t *RoundTripRateLimiter) RoundTrip(r *http.Request) (*http.Response, error) {
 	// Wait errors out if the request cannot be processed within
 	// the deadline. This is preemptive, instead of waiting the
 	// entire duration.
-	if err := t.rl.Wait(r.Context()); err != nil {
+	if err := t.limiter.wait(r.Context()); err != nil {
 		return nil, errors.Wrap(err, "rate limited")
 	}
-	return t.tx.RoundTrip(r)
+	resp, err := t.tx.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.limiter.backOff(parseRetryAfter(resp.Header.Get("Retry-After"), t.limiter.now()))
+	} else if resp.StatusCode < http.StatusBadRequest {
+		t.limiter.recover()
+	}
+	return resp, nil
 }
 
 type ContextRoundTripper struct {
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestParseHostLimit(t *testing.T) {
+	for s, expected := range map[string]HostLimit{
+		"index.docker.io=2":     {RPS: 2},
+		"localhost:5000=0.5/10": {RPS: 0.5, Burst: 10},
+		"quay.io=20/5":          {RPS: 20, Burst: 5},
+	} {
+		_, limit, err := ParseHostLimit(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if limit != expected {
+			t.Errorf("%q: expected %+v, got %+v", s, expected, limit)
+		}
+	}
+	for _, s := range []string{"index.docker.io", "=2", "quay.io=0", "quay.io=fast", "quay.io=2/none"} {
+		if _, _, err := ParseHostLimit(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for header, expected := range map[string]time.Time{
+		"":                              {},
+		"soon":                          {},
+		"30":                            now.Add(30 * time.Second),
+		"Tue, 01 Jan 2019 00:01:00 GMT": now.Add(time.Minute),
+		"86400":                         now.Add(maxRetryAfter),
+	} {
+		if got := parseRetryAfter(header, now); !got.Equal(expected) {
+			t.Errorf("%q: expected %s, got %s", header, expected, got)
+		}
+	}
+}
+
+func TestRateLimiterBacksOff(t *testing.T) {
+	status := http.StatusTooManyRequests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	limiters := &RateLimiters{RPS: 10, Burst: 1}
+	tx := limiters.RoundTripper(http.DefaultTransport, "example.com")
+	limiter := limiters.perHost["example.com"]
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := tx.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if limiter.rl.Limit() != rate.Limit(5) {
+		t.Errorf("expected rate to be halved, got %v", limiter.rl.Limit())
+	}
+
+	// Requests are refused until the time given by Retry-After,
+	// when they can't wait that long
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := tx.RoundTrip(req.WithContext(ctx)); err == nil {
+		t.Error("expected request to be refused while backing off")
+	}
+
+	// Successful requests restore the rate, bit by bit
+	status = http.StatusOK
+	limiter.blockedUntil = time.Time{}
+	for i := 0; i < 10; i++ {
+		resp, err := tx.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if limiter.rl.Limit() != rate.Limit(10) {
+		t.Errorf("expected rate to have recovered, got %v", limiter.rl.Limit())
+	}
+}
@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/weaveworks/flux/image"
+)
+
+// Mirror says to fetch the metadata for images whose names start
+// with Prefix from the repository named by replacing the prefix with
+// Replacement instead; e.g., from an internal registry mirroring
+// Docker Hub, in an air-gapped cluster. The images are still known
+// by their own names. Prefixes are matched against canonical names,
+// which include the registry host: `nginx` is
+// `index.docker.io/library/nginx`.
+type Mirror struct {
+	Prefix, Replacement string
+}
+
+// ParseMirror parses a mirror given as prefix=replacement, e.g.,
+// `docker.io=registry.example.com/dockerhub`. A prefix matches whole
+// path elements, so `quay.io/foo` matches `quay.io/foo/bar`, but not
+// `quay.io/foobar`.
+func ParseMirror(s string) (Mirror, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Mirror{}, fmt.Errorf("mirror %q should be given as prefix=replacement, e.g., docker.io=registry.example.com/dockerhub", s)
+	}
+	prefix, replacement := strings.Trim(parts[0], "/"), strings.Trim(parts[1], "/")
+	// Docker Hub goes by two names; canonical names use the one
+	// given by image.Name.Registry()
+	hub := image.Name{Domain: "docker.io"}.Registry()
+	if prefix == "docker.io" || strings.HasPrefix(prefix, "docker.io/") {
+		prefix = hub + strings.TrimPrefix(prefix, "docker.io")
+	}
+	ref, err := image.ParseRef(replacement + "/image")
+	if err != nil || ref.Domain == "" || ref.Tag != "" {
+		return Mirror{}, fmt.Errorf("mirror %q: replacement should start with a registry host, e.g., registry.example.com/dockerhub", s)
+	}
+	return Mirror{Prefix: prefix, Replacement: replacement}, nil
+}
+
+// Mirrors is a set of mirrors, of which the one with the longest
+// prefix matching an image is used.
+type Mirrors []Mirror
+
+// Rewrite gives the name of the repository to fetch the metadata for
+// the images named from, and whether it's a mirror.
+func (ms Mirrors) Rewrite(name image.CanonicalName) (image.CanonicalName, bool) {
+	s := name.String()
+	var best *Mirror
+	for i, m := range ms {
+		if (s == m.Prefix || strings.HasPrefix(s, m.Prefix+"/")) && (best == nil || len(m.Prefix) > len(best.Prefix)) {
+			best = &ms[i]
+		}
+	}
+	if best == nil {
+		return name, false
+	}
+	ref, err := image.ParseRef(best.Replacement + strings.TrimPrefix(s, best.Prefix))
+	if err != nil || ref.Domain == "" {
+		return name, false
+	}
+	return ref.CanonicalName(), true
+}
@@ -0,0 +1,127 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/go-kit/kit/log"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/registry/middleware"
+)
+
+func TestParseMirror(t *testing.T) {
+	for in, want := range map[string]Mirror{
+		"docker.io=registry.example.com/dockerhub":           {"index.docker.io", "registry.example.com/dockerhub"},
+		"docker.io/library/=registry.example.com/library/":   {"index.docker.io/library", "registry.example.com/library"},
+		"quay.io/org=localhost:5000":                         {"quay.io/org", "localhost:5000"},
+		"gcr.io/project/app=registry.example.com/gcr/app":    {"gcr.io/project/app", "registry.example.com/gcr/app"},
+		"index.docker.io=registry.example.com/hub/mirror/v2": {"index.docker.io", "registry.example.com/hub/mirror/v2"},
+	} {
+		got, err := ParseMirror(in)
+		if assert.NoError(t, err, in) {
+			assert.Equal(t, want, got, in)
+		}
+	}
+
+	for _, in := range []string{
+		"docker.io",
+		"=registry.example.com",
+		"docker.io=",
+		"docker.io=dockerhub",
+		"docker.io=registry.example.com/hub:latest",
+	} {
+		_, err := ParseMirror(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestMirrors_Rewrite(t *testing.T) {
+	var mirrors Mirrors
+	for _, s := range []string{
+		"docker.io=registry.example.com/dockerhub",
+		"quay.io/org=registry.example.com/quay-org",
+		"quay.io/org/special=registry.example.com/special",
+	} {
+		m, err := ParseMirror(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mirrors = append(mirrors, m)
+	}
+
+	for name, want := range map[string]string{
+		"nginx":                      "registry.example.com/dockerhub/library/nginx",
+		"weaveworks/flux":            "registry.example.com/dockerhub/weaveworks/flux",
+		"quay.io/org/app":            "registry.example.com/quay-org/app",
+		"quay.io/org/special":        "registry.example.com/special",
+		"quay.io/org/special/nested": "registry.example.com/special/nested",
+		"quay.io/orgasm/app":         "", // not a whole path element
+		"gcr.io/project/app":         "",
+	} {
+		ref, err := image.ParseRef(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := mirrors.Rewrite(ref.CanonicalName())
+		if want == "" {
+			assert.False(t, ok, name)
+			assert.Equal(t, ref.CanonicalName(), got, name)
+			continue
+		}
+		assert.True(t, ok, name)
+		assert.Equal(t, want, got.String(), name)
+	}
+}
+
+func TestRemoteClientFactory_Mirror(t *testing.T) {
+	config, _ := json.Marshal(map[string]interface{}{
+		"created": time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	configDigest := digest.FromBytes(config)
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     schema2.MediaTypeManifest,
+		"config":        map[string]interface{}{"digest": configDigest, "size": len(config)},
+	})
+	server := newFakeRegistry(map[string]fakeBlob{
+		"/v2/quay/org/app/blobs/" + configDigest.String(): {"application/octet-stream", config},
+		"/v2/quay/org/app/manifests/1.0":                  {schema2.MediaTypeManifest, manifest},
+	})
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	mirror, err := ParseMirror("quay.io=" + host.Host + "/quay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := &RemoteClientFactory{
+		Logger:        log.NewNopLogger(),
+		Limiters:      &middleware.RateLimiters{RPS: 100, Burst: 10},
+		InsecureHosts: []string{host.Host},
+		Mirrors:       Mirrors{mirror},
+		Offline:       true,
+	}
+
+	name := image.Name{Domain: "quay.io", Image: "org/app"}.CanonicalName()
+	client, err := factory.ClientFor(name, NoCredentials())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := client.Manifest(context.Background(), "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fetched from the mirror, but known by its own name
+	assert.Equal(t, "quay.io/org/app:1.0", entry.ID.String())
+
+	// Offline, an image without a mirror isn't even tried
+	_, err = factory.ClientFor(image.Name{Domain: "gcr.io", Image: "project/app"}.CanonicalName(), NoCredentials())
+	assert.Error(t, err)
+}
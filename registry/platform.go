@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+)
+
+// The media types of OCI image indexes and manifests. These have the
+// same structure as Docker manifest lists and (schema 2) manifests,
+// so they are decoded as those.
+const (
+	MediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+)
+
+func init() {
+	indexFunc := func(b []byte) (distribution.Manifest, distribution.Descriptor, error) {
+		m := new(manifestlist.DeserializedManifestList)
+		if err := m.UnmarshalJSON(b); err != nil {
+			return nil, distribution.Descriptor{}, err
+		}
+		return m, distribution.Descriptor{Digest: digest.FromBytes(b), Size: int64(len(b)), MediaType: MediaTypeOCIIndex}, nil
+	}
+	manifestFunc := func(b []byte) (distribution.Manifest, distribution.Descriptor, error) {
+		m := new(schema2.DeserializedManifest)
+		if err := m.UnmarshalJSON(b); err != nil {
+			return nil, distribution.Descriptor{}, err
+		}
+		return m, distribution.Descriptor{Digest: digest.FromBytes(b), Size: int64(len(b)), MediaType: MediaTypeOCIManifest}, nil
+	}
+	// Registering these also means they are included in the Accept
+	// header when fetching manifests.
+	if err := distribution.RegisterManifestSchema(MediaTypeOCIIndex, indexFunc); err != nil {
+		panic(fmt.Sprintf("unable to register manifest: %s", err))
+	}
+	if err := distribution.RegisterManifestSchema(MediaTypeOCIManifest, manifestFunc); err != nil {
+		panic(fmt.Sprintf("unable to register manifest: %s", err))
+	}
+}
+
+// Platform is the operating system and architecture (and optionally,
+// the variant of the architecture) an image is built for.
+type Platform struct {
+	OS, Architecture, Variant string
+}
+
+// DefaultPlatform is the platform images are assumed to be run on,
+// if no other is given.
+var DefaultPlatform = Platform{OS: "linux", Architecture: "amd64"}
+
+// ParsePlatform parses a platform given as `os/arch[/variant]`,
+// e.g., `linux/arm64` or `linux/arm/v7`.
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("%q is not of the form os/arch[/variant]", s)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// matches says whether an image for the platform given can be run on
+// this platform. If no variant is given for this platform, any
+// variant will do.
+func (p Platform) matches(spec manifestlist.PlatformSpec) bool {
+	return p.OS == spec.OS && p.Architecture == spec.Architecture &&
+		(p.Variant == "" || p.Variant == spec.Variant)
+}
+
+func platformOf(spec manifestlist.PlatformSpec) Platform {
+	return Platform{OS: spec.OS, Architecture: spec.Architecture, Variant: spec.Variant}
+}
+
+// selectManifest picks the manifest for the first of the platforms
+// (in order of preference) that's in the list.
+func selectManifest(platforms []Platform, manifests []manifestlist.ManifestDescriptor) (manifestlist.ManifestDescriptor, bool) {
+	for _, p := range platforms {
+		for _, m := range manifests {
+			if p.matches(m.Platform) {
+				return m, true
+			}
+		}
+	}
+	return manifestlist.ManifestDescriptor{}, false
+}
+
+// missingPlatforms gives those of the required platforms that none of
+// the available platforms match.
+func missingPlatforms(required []Platform, available []manifestlist.PlatformSpec) []string {
+	var missing []string
+	for _, p := range required {
+		found := false
+		for _, spec := range available {
+			if p.matches(spec) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, p.String())
+		}
+	}
+	return missing
+}
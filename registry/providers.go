@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// How long to wait before trying again, after failing to get
+// credentials for a registry from a provider.
+const providerRetryInterval = 5 * time.Minute
+
+// CredentialsProvider gets credentials for the registries of a
+// platform (e.g., a cloud provider) from the platform itself, so
+// that images there can be scanned without image pull secrets.
+type CredentialsProvider interface {
+	// credsFor returns credentials for the host, if it's a registry
+	// the provider looks after and it can get credentials for it.
+	credsFor(host string) (creds, bool)
+}
+
+// ImageCredsWithProviders wraps an image credentials func so that
+// images in registries for which there are no other credentials are
+// given credentials from the first provider that can supply them.
+func ImageCredsWithProviders(lookup func() ImageCreds, providers ...CredentialsProvider) func() ImageCreds {
+	return func() ImageCreds {
+		imageCreds := lookup()
+		for name, cs := range imageCreds {
+			if _, ok := cs.m[name.Domain]; ok {
+				continue
+			}
+			for _, p := range providers {
+				if c, ok := p.credsFor(name.Domain); ok {
+					newCreds := NoCredentials()
+					newCreds.Merge(cs)
+					newCreds.m[name.Domain] = c
+					imageCreds[name] = newCreds
+					break
+				}
+			}
+		}
+		return imageCreds
+	}
+}
+
+type cachedCreds struct {
+	creds
+	fetchedAt time.Time
+	// zero, if the credentials don't expire
+	expiresAt time.Time
+}
+
+// stale reports whether the credentials ought to be refreshed; that
+// is, whether most of their lifetime has passed, which leaves time to
+// retry if refreshing fails.
+func (c cachedCreds) stale(now time.Time) bool {
+	if c.expiresAt.IsZero() {
+		return false
+	}
+	return now.After(c.fetchedAt.Add(c.expiresAt.Sub(c.fetchedAt) * 3 / 4))
+}
+
+func (c cachedCreds) expired(now time.Time) bool {
+	return !c.expiresAt.IsZero() && !now.Before(c.expiresAt)
+}
+
+// tokenCache keeps the credentials a provider fetches for each host
+// until they're close to expiring, and stops the provider from
+// asking again too often when fetching fails.
+type tokenCache struct {
+	name   string
+	logger log.Logger
+	fetch  func(host string) (c creds, expiresAt time.Time, err error)
+	now    func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]cachedCreds
+	failed map[string]time.Time
+}
+
+func newTokenCache(name string, logger log.Logger, fetch func(string) (creds, time.Time, error)) *tokenCache {
+	return &tokenCache{
+		name:   name,
+		logger: logger,
+		fetch:  fetch,
+		now:    time.Now,
+		tokens: map[string]cachedCreds{},
+		failed: map[string]time.Time{},
+	}
+}
+
+func (c *tokenCache) get(host string) (creds, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	cached, ok := c.tokens[host]
+	if ok && !cached.stale(now) {
+		return cached.creds, true
+	}
+	// The credentials we have may still be good for a while, if
+	// getting new ones fails
+	usable := ok && !cached.expired(now)
+	if failedAt, didFail := c.failed[host]; didFail && now.Before(failedAt.Add(providerRetryInterval)) {
+		return cached.creds, usable
+	}
+
+	fresh, expiresAt, err := c.fetch(host)
+	if err != nil {
+		c.logger.Log("registry", host, "err", errors.Wrapf(err, "getting %s credentials", c.name))
+		c.failed[host] = now
+		return cached.creds, usable
+	}
+	delete(c.failed, host)
+	c.tokens[host] = cachedCreds{creds: fresh, fetchedAt: now, expiresAt: expiresAt}
+	c.logger.Log("registry", host, "info", "refreshed "+c.name+" credentials", "expires", expiresAt)
+	return fresh, true
+}
@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+)
+
+type staticProvider map[string]creds
+
+func (p staticProvider) credsFor(host string) (creds, bool) {
+	c, ok := p[host]
+	return c, ok
+}
+
+func TestImageCredsWithProviders(t *testing.T) {
+	withSecret := image.Name{Domain: "gcr.io", Image: "foo/bar"}
+	withoutSecret := image.Name{Domain: "eu.gcr.io", Image: "foo/bar"}
+	unknown := image.Name{Domain: "quay.io", Image: "foo/bar"}
+	secretCreds := Credentials{m: map[string]creds{"gcr.io": {username: "secret"}}}
+	lookup := func() ImageCreds {
+		return ImageCreds{
+			withSecret:    secretCreds,
+			withoutSecret: NoCredentials(),
+			unknown:       NoCredentials(),
+		}
+	}
+	imageCreds := ImageCredsWithProviders(lookup,
+		staticProvider{"gcr.io": {username: "first"}, "eu.gcr.io": {username: "first"}},
+		staticProvider{"eu.gcr.io": {username: "second"}},
+	)()
+
+	assert.Equal(t, "secret", imageCreds[withSecret].credsFor("gcr.io").username)
+	assert.Equal(t, "first", imageCreds[withoutSecret].credsFor("eu.gcr.io").username)
+	assert.Equal(t, creds{}, imageCreds[unknown].credsFor("quay.io"))
+}
+
+func TestTokenCache_Failure(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	var fetches int
+	var fail bool
+	cache := newTokenCache("test", log.NewNopLogger(), func(host string) (creds, time.Time, error) {
+		fetches++
+		if fail {
+			return creds{}, time.Time{}, errors.New("failed")
+		}
+		return creds{username: "user"}, now.Add(time.Hour), nil
+	})
+	cache.now = func() time.Time { return now }
+
+	_, ok := cache.get("example.com")
+	assert.True(t, ok)
+	assert.Equal(t, 1, fetches)
+
+	// When refreshing fails, the credentials are still used until
+	// they expire; and it's not tried again straight away.
+	fail = true
+	now = now.Add(50 * time.Minute)
+	_, ok = cache.get("example.com")
+	assert.True(t, ok)
+	assert.Equal(t, 2, fetches)
+	_, ok = cache.get("example.com")
+	assert.True(t, ok)
+	assert.Equal(t, 2, fetches)
+
+	now = now.Add(providerRetryInterval)
+	_, ok = cache.get("example.com")
+	assert.True(t, ok)
+	assert.Equal(t, 3, fetches)
+
+	now = now.Add(providerRetryInterval)
+	_, ok = cache.get("example.com")
+	assert.False(t, ok)
+}
@@ -2,6 +2,8 @@ package registry
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/weaveworks/flux/image"
 )
@@ -10,6 +12,29 @@ var (
 	ErrNoImageData = errors.New("image data not available")
 )
 
+// StaleError is returned by GetRepositoryImages, along with the last
+// known images, when the images in a repository could not be
+// refreshed recently.
+type StaleError struct {
+	LastUpdate time.Time
+	Err        error // why the images could not be refreshed, if known
+}
+
+func (e *StaleError) Error() string {
+	msg := fmt.Sprintf("image data is stale, last refreshed at %s", e.LastUpdate.Format(time.RFC3339))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// IsStale reports whether the error given is only to say that the
+// images returned with it are stale.
+func IsStale(err error) bool {
+	_, ok := err.(*StaleError)
+	return ok
+}
+
 // Registry is a store of image metadata.
 type Registry interface {
 	GetRepositoryImages(image.Name) ([]image.Info, error)
@@ -9,6 +9,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/update"
@@ -41,6 +42,14 @@ func (rc *ReleaseContext) LoadManifests() (map[string]resource.Resource, error)
 func (rc *ReleaseContext) WriteUpdates(updates []*update.ControllerUpdate) error {
 	err := func() error {
 		for _, update := range updates {
+			if gen, ok := rc.manifests.(cluster.Generated); ok && gen.IsGenerated(update.Resource) {
+				for _, container := range update.Updates {
+					if err := gen.UpdateGeneratedImage(rc.repo.Dir(), update.Resource, container.Container, container.Target); err != nil {
+						return err
+					}
+				}
+				continue
+			}
 			manifestBytes, err := ioutil.ReadFile(update.ManifestPath)
 			if err != nil {
 				return err
@@ -50,6 +59,16 @@ func (rc *ReleaseContext) WriteUpdates(updates []*update.ControllerUpdate) error
 				if err != nil {
 					return err
 				}
+				// A container released to another tag than the
+				// one it's pinned to stays pinned, at the new tag
+				if tag, ok := policy.PinnedTag(update.Resource.Policy(), container.Container); ok && tag != container.Target.Tag {
+					manifestBytes, err = rc.manifests.UpdatePolicies(manifestBytes, update.ResourceID, policy.Update{
+						Add: policy.Set{policy.TagPinPrefix(container.Container): container.Target.Tag},
+					})
+					if err != nil {
+						return err
+					}
+				}
 			}
 			if err = ioutil.WriteFile(update.ManifestPath, manifestBytes, os.FileMode(0600)); err != nil {
 				return err
@@ -75,11 +94,21 @@ func (rc *ReleaseContext) SelectServices(results update.Result, prefilters, post
 	}
 
 	// Apply prefilters to select the controllers that we'll ask the
-	// cluster about.
+	// cluster about. Those rendered from files that can't be updated
+	// are passed over.
+	rendered, _ := rc.manifests.(cluster.Rendered)
 	var toAskClusterAbout []flux.ResourceID
 	for _, s := range allDefined {
 		res := s.Filter(prefilters...)
-		if res.Error == "" {
+		switch {
+		case res.Error != "":
+			results[s.ResourceID] = res
+		case rendered != nil && rendered.IsRendered(s.Resource):
+			results[s.ResourceID] = update.ControllerResult{
+				Status: update.ReleaseStatusSkipped,
+				Error:  fmt.Sprintf(update.GeneratedFrom, s.Resource.Source()),
+			}
+		default:
 			// Give these a default value, in case we don't find them
 			// in the cluster.
 			results[s.ResourceID] = update.ControllerResult{
@@ -87,8 +116,6 @@ func (rc *ReleaseContext) SelectServices(results update.Result, prefilters, post
 				Error:  update.NotInCluster,
 			}
 			toAskClusterAbout = append(toAskClusterAbout, s.ResourceID)
-		} else {
-			results[s.ResourceID] = res
 		}
 	}
 
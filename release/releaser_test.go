@@ -2,6 +2,8 @@ package release
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -15,6 +17,7 @@ import (
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
 	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	registryMock "github.com/weaveworks/flux/registry/mock"
 	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/update"
@@ -610,6 +613,132 @@ func Test_Force_filteredContainer(t *testing.T) {
 	}
 }
 
+func Test_IgnoredContainer(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	// Leave the sidecar out, as though it were looked after by a
+	// service mesh
+	path := filepath.Join(checkout.Dir(), "helloworld-deploy.yaml")
+	def, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err = mockManifests.UpdatePolicies(def, hwSvcID, policy.Update{
+		Add: policy.Set{}.Add(policy.IgnoreContainerPrefix(sidecarContainer)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, def, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := update.ReleaseSpec{
+		ServiceSpecs: []update.ResourceSpec{hwSvcSpec},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindExecute,
+		Excludes:     []flux.ResourceID{},
+	}
+	expected := update.Result{
+		flux.MustParseResourceID("default:deployment/helloworld"): update.ControllerResult{
+			Status: update.ReleaseStatusSuccess,
+			PerContainer: []update.ContainerUpdate{
+				update.ContainerUpdate{
+					Container: helloContainer,
+					Current:   oldRef,
+					Target:    newHwRef,
+				},
+			},
+		},
+		flux.MustParseResourceID("default:deployment/locked-service"): ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/test-service"):   ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/multi-deploy"):   ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/list-deploy"):    ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/semver"):         ignoredNotIncluded,
+	}
+	testRelease(t, &ReleaseContext{
+		cluster:   mockCluster(hwSvc, lockedSvc),
+		manifests: mockManifests,
+		registry:  mockRegistry,
+		repo:      checkout,
+	}, spec, expected)
+}
+
+func Test_PinnedContainer(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	path := filepath.Join(checkout.Dir(), "helloworld-deploy.yaml")
+	def, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err = mockManifests.UpdatePolicies(def, hwSvcID, policy.Update{
+		Add: policy.Set{policy.TagPinPrefix(helloContainer): oldRef.Tag},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, def, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &ReleaseContext{
+		cluster:   mockCluster(hwSvc, lockedSvc),
+		manifests: mockManifests,
+		registry:  mockRegistry,
+		repo:      checkout,
+	}
+	notIncluded := update.Result{
+		flux.MustParseResourceID("default:deployment/locked-service"): ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/test-service"):   ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/multi-deploy"):   ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/list-deploy"):    ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/semver"):         ignoredNotIncluded,
+	}
+	expect := func(updates ...update.ContainerUpdate) update.Result {
+		result := update.Result{hwSvcID: update.ControllerResult{
+			Status:       update.ReleaseStatusSuccess,
+			PerContainer: updates,
+		}}
+		for id, r := range notIncluded {
+			result[id] = r
+		}
+		return result
+	}
+
+	// Releasing all images leaves the pinned container at its tag
+	testRelease(t, ctx, update.ReleaseSpec{
+		ServiceSpecs: []update.ResourceSpec{hwSvcSpec},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindExecute,
+		Excludes:     []flux.ResourceID{},
+	}, expect(update.ContainerUpdate{
+		Container: sidecarContainer,
+		Current:   sidecarRef,
+		Target:    newSidecarRef,
+	}))
+
+	// Releasing a particular image updates it, and moves the pin
+	testRelease(t, ctx, update.ReleaseSpec{
+		ServiceSpecs: []update.ResourceSpec{hwSvcSpec},
+		ImageSpec:    update.ImageSpecFromRef(newHwRef),
+		Kind:         update.ReleaseKindExecute,
+		Excludes:     []flux.ResourceID{},
+	}, expect(update.ContainerUpdate{
+		Container: helloContainer,
+		Current:   oldRef,
+		Target:    newHwRef,
+	}))
+	resources, err := ctx.LoadManifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag, _ := policy.PinnedTag(resources[hwSvcID.String()].Policy(), helloContainer); tag != newHwRef.Tag {
+		t.Errorf("expected the pin to move to %s, got %q", newHwRef.Tag, tag)
+	}
+}
+
 func Test_ImageStatus(t *testing.T) {
 	cluster := mockCluster(hwSvc, lockedSvc, testSvc)
 	upToDateRegistry := &registryMock.Registry{
@@ -986,3 +1115,40 @@ func Test_BadRelease(t *testing.T) {
 		t.Fatal("did not return an error, but was expected to fail verification")
 	}
 }
+
+// renderedManifests renders the workload given from a file it can't
+// update.
+type renderedManifests struct {
+	kubernetes.Manifests
+	rendered flux.ResourceID
+}
+
+func (m *renderedManifests) IsRendered(res resource.Resource) bool {
+	return res.ResourceID() == m.rendered
+}
+
+func Test_RenderedSkipped(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+	ctx := &ReleaseContext{
+		cluster:   mockCluster(hwSvc, lockedSvc, testSvc),
+		manifests: &renderedManifests{rendered: hwSvcID},
+		repo:      checkout,
+		registry:  mockRegistry,
+	}
+	spec := update.ReleaseSpec{
+		ServiceSpecs: []update.ResourceSpec{update.ResourceSpecAll},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindExecute,
+	}
+	results, err := Release(ctx, spec, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, ok := results[hwSvcID]
+	if !ok {
+		t.Fatal("expected a result for the rendered workload")
+	}
+	assert.Equal(t, update.ReleaseStatusSkipped, result.Status)
+	assert.Equal(t, "generated from helloworld-deploy.yaml", result.Error)
+}
@@ -0,0 +1,104 @@
+// Package releasegate asks something outside flux -- e.g., a canary
+// controller -- whether an automated image update may go ahead, before
+// it is committed.
+package releasegate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+)
+
+// Decision is what to do with an update.
+type Decision string
+
+const (
+	// Proceed means make the update now.
+	Proceed Decision = "proceed"
+	// Delay means hold the update, and ask again next time.
+	Delay Decision = "delay"
+	// Abort means don't make the update; it won't be asked about
+	// again, until there's a different image to update to.
+	Abort Decision = "abort"
+)
+
+// Update is an automated image update waiting to be made.
+type Update struct {
+	Workload  flux.ResourceID `json:"workload"`
+	Container string          `json:"container"`
+	Current   image.Ref       `json:"current"`
+	Target    image.Ref       `json:"target"`
+}
+
+// Result is the decision made about an update, and why.
+type Result struct {
+	Decision Decision `json:"decision"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// Gate decides whether automated updates may go ahead.
+type Gate interface {
+	Check(ctx context.Context, update Update) (Result, error)
+}
+
+// maxResponse is the most of a response body that will be read.
+const maxResponse = 64 * 1024
+
+type webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook returns a Gate that POSTs each update, as JSON, to the
+// URL given, and expects a 2xx response with a Result in JSON; an
+// empty response means Proceed.
+func NewWebhook(url string, client *http.Client) Gate {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webhook{url: url, client: client}
+}
+
+func (w *webhook) Check(ctx context.Context, update Update) (Result, error) {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return Result{}, err
+	}
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return Result{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Result{}, fmt.Errorf("release gate %s responded with %s: %s", w.url, resp.Status, bytes.TrimSpace(respBody))
+	}
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		return Result{Decision: Proceed}, nil
+	}
+	var result Result
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return Result{}, fmt.Errorf("decoding response from release gate %s: %s", w.url, err)
+	}
+	switch result.Decision {
+	case Proceed, Delay, Abort:
+		return result, nil
+	}
+	return Result{}, fmt.Errorf("release gate %s gave unknown decision %q (expected %q, %q or %q)", w.url, result.Decision, Proceed, Delay, Abort)
+}
@@ -0,0 +1,59 @@
+package releasegate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+)
+
+func TestWebhook(t *testing.T) {
+	var received map[string]string
+	response, status := "", http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	gate := NewWebhook(server.URL, nil)
+	update := Update{
+		Workload:  flux.MustParseResourceID("default:deployment/helloworld"),
+		Container: "greeter",
+		Current:   image.Ref{Name: image.Name{Image: "weaveworks/helloworld"}, Tag: "1"},
+		Target:    image.Ref{Name: image.Name{Image: "weaveworks/helloworld"}, Tag: "2"},
+	}
+
+	for _, c := range []struct {
+		status   int
+		response string
+		result   Result
+		err      bool
+	}{
+		{http.StatusOK, "", Result{Decision: Proceed}, false},
+		{http.StatusOK, `{"decision":"delay","reason":"canary analysis running"}`, Result{Decision: Delay, Reason: "canary analysis running"}, false},
+		{http.StatusOK, `{"decision":"abort"}`, Result{Decision: Abort}, false},
+		{http.StatusOK, `{"decision":"maybe"}`, Result{}, true},
+		{http.StatusOK, `not json`, Result{}, true},
+		{http.StatusInternalServerError, `{"decision":"proceed"}`, Result{}, true},
+	} {
+		status, response = c.status, c.response
+		result, err := gate.Check(context.Background(), update)
+		assert.Equal(t, c.err, err != nil, c.response)
+		assert.Equal(t, c.result, result, c.response)
+	}
+
+	assert.Equal(t, map[string]string{
+		"workload":  "default:deployment/helloworld",
+		"container": "greeter",
+		"current":   "weaveworks/helloworld:1",
+		"target":    "weaveworks/helloworld:2",
+	}, received)
+}
@@ -14,6 +14,17 @@ type Resource interface {
 	Bytes() []byte               // the definition, for sending to cluster.Sync
 }
 
+// SourceLine gives the line in its source at which the resource is
+// defined, if the resource records that; otherwise, 0.
+func SourceLine(r Resource) int {
+	if l, ok := r.(interface {
+		SourceLine() int
+	}); ok {
+		return l.SourceLine()
+	}
+	return 0
+}
+
 type Container struct {
 	Name  string
 	Image image.Ref
@@ -0,0 +1,136 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const defaultPort = "22"
+
+// Values for the StrictHostKeyChecking option to ssh.
+const (
+	StrictHostKeyCheckingYes       = "yes"
+	StrictHostKeyCheckingNo        = "no"
+	StrictHostKeyCheckingAcceptNew = "accept-new"
+)
+
+// scpLikeRE matches git URLs in the scp-like form `[user@]host:path`,
+// which cannot include a port.
+var scpLikeRE = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):`)
+
+// HostFromURL returns the host and port that git will connect to
+// with SSH, for the git URL given. ok is false if the URL does not
+// use SSH (e.g., it's an HTTPS URL, or a local path).
+func HostFromURL(gitURL string) (host, port string, ok bool) {
+	if strings.Contains(gitURL, "://") {
+		u, err := url.Parse(gitURL)
+		if err != nil {
+			return "", "", false
+		}
+		switch u.Scheme {
+		case "ssh", "git+ssh", "ssh+git":
+		default:
+			return "", "", false
+		}
+		port = u.Port()
+		if port == "" {
+			port = defaultPort
+		}
+		return u.Hostname(), port, u.Hostname() != ""
+	}
+	m := scpLikeRE.FindStringSubmatch(gitURL)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], defaultPort, true
+}
+
+// knownHostsName gives the name by which a host is recorded in a
+// known_hosts file; hosts on non-standard ports are recorded as
+// `[host]:port`.
+func knownHostsName(host, port string) string {
+	if port == "" || port == defaultPort {
+		return host
+	}
+	return fmt.Sprintf("[%s]:%s", host, port)
+}
+
+// IsKnownHost reports whether there is a key for the host and port
+// given, in any of the known_hosts files given. As with ssh, a
+// leading `~/` in a path refers to the home directory. Files that
+// don't exist are ignored.
+func IsKnownHost(knownHostsFiles []string, host, port string) (bool, error) {
+	name := knownHostsName(host, port)
+	for _, file := range knownHostsFiles {
+		if strings.HasPrefix(file, "~/") {
+			file = filepath.Join(os.Getenv("HOME"), file[2:])
+		}
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+		cmd := exec.Command("ssh-keygen", "-F", name, "-f", file)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			return true, nil
+		}
+		// ssh-keygen exits non-zero and says nothing if the host
+		// is not found, and complains if there's a problem reading
+		// the file.
+		if _, ok := err.(*exec.ExitError); ok && len(bytes.TrimSpace(out)) == 0 {
+			continue
+		}
+		return false, fmt.Errorf("checking %s for host key: %s", file, string(bytes.TrimSpace(out)))
+	}
+	return false, nil
+}
+
+// KeyScan fetches the host keys for the host and port given using
+// ssh-keyscan, and appends them to the known_hosts file given. This
+// trusts whatever keys the host presents, so should only be used to
+// bootstrap a host that is not already known.
+func KeyScan(knownHostsFile, host, port string) error {
+	args := []string{"-T", "10"}
+	if port != "" && port != defaultPort {
+		args = append(args, "-p", port)
+	}
+	args = append(args, host)
+	var stderr bytes.Buffer
+	cmd := exec.Command("ssh-keyscan", args...)
+	cmd.Stderr = &stderr
+	keys, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("running ssh-keyscan for %s: %s", host, string(bytes.TrimSpace(stderr.Bytes())))
+	}
+	if len(bytes.TrimSpace(keys)) == 0 {
+		return fmt.Errorf("ssh-keyscan found no host keys for %s", knownHostsName(host, port))
+	}
+
+	f, err := os.OpenFile(knownHostsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(keys)
+	return err
+}
+
+// Command returns a command line for running ssh (e.g., for use as
+// GIT_SSH_COMMAND) which checks host keys against the known_hosts
+// files given, as well as the system-wide known_hosts file, according
+// to strictHostKeyChecking.
+func Command(knownHostsFiles []string, strictHostKeyChecking string) string {
+	args := []string{"ssh"}
+	if len(knownHostsFiles) > 0 {
+		args = append(args, "-o", fmt.Sprintf("'UserKnownHostsFile=%s'", strings.Join(knownHostsFiles, " ")))
+	}
+	if strictHostKeyChecking != "" {
+		args = append(args, "-o", "StrictHostKeyChecking="+strictHostKeyChecking)
+	}
+	return strings.Join(args, " ")
+}
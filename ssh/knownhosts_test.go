@@ -0,0 +1,33 @@
+package ssh
+
+import (
+	"testing"
+)
+
+func TestHostFromURL(t *testing.T) {
+	for _, c := range []struct {
+		url, host, port string
+		ok              bool
+	}{
+		{"git@github.com:weaveworks/flux", "github.com", "22", true},
+		{"githost:path/to/repo.git", "githost", "22", true},
+		{"ssh://git@githost/path/to/repo", "githost", "22", true},
+		{"ssh://git@githost:2222/path/to/repo", "githost", "2222", true},
+		{"git+ssh://githost:2222/repo", "githost", "2222", true},
+		{"https://github.com/weaveworks/flux", "", "", false},
+		{"/local/path/to/repo", "", "", false},
+	} {
+		host, port, ok := HostFromURL(c.url)
+		if host != c.host || port != c.port || ok != c.ok {
+			t.Errorf("%s: expected (%q, %q, %v), got (%q, %q, %v)", c.url, c.host, c.port, c.ok, host, port, ok)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	cmd := Command([]string{"/etc/fluxd/known_hosts", "/var/fluxd/keygen/known_hosts"}, StrictHostKeyCheckingYes)
+	expected := "ssh -o 'UserKnownHostsFile=/etc/fluxd/known_hosts /var/fluxd/keygen/known_hosts' -o StrictHostKeyChecking=yes"
+	if cmd != expected {
+		t.Errorf("expected %q, got %q", expected, cmd)
+	}
+}
@@ -0,0 +1,17 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/weaveworks/flux"
+)
+
+// Claims coordinates several daemons syncing from the same repo (each
+// a shard, applying a different part of it), so that no two of them
+// manage the same resource.
+type Claims interface {
+	// Claim records the resources given as managed by this shard,
+	// save for those another shard has already claimed; those are
+	// returned, each with the name of the shard that claimed it.
+	Claim(ctx context.Context, ids []flux.ResourceID) (map[flux.ResourceID]string, error)
+}
@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"context"
+	gosync "sync"
+)
+
+// State records how far the cluster has been synced with the git
+// repo, i.e., the revision last applied. By default this is kept as
+// a tag in the git repo itself; implementations of State provide
+// alternatives for when that's not possible or desirable.
+type State interface {
+	// GetRevision returns the revision last synced, or the empty
+	// string if nothing has been synced yet.
+	GetRevision(ctx context.Context) (string, error)
+	// UpdateMarker records the revision given as synced.
+	UpdateMarker(ctx context.Context, revision string) error
+}
+
+// InMemoryState keeps the revision synced in memory, so it is lost
+// on restart (and everything will be treated as new).
+type InMemoryState struct {
+	mu       gosync.RWMutex
+	revision string
+}
+
+var _ State = &InMemoryState{}
+
+func (s *InMemoryState) GetRevision(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.revision, nil
+}
+
+func (s *InMemoryState) UpdateMarker(ctx context.Context, revision string) error {
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,98 @@
+// Package tracing records spans -- named, timed operations, nested
+// within one another -- through syncs, jobs, git operations and
+// releases, so that slow ones can be taken apart. Spans are those of
+// OpenCensus, passed down in a context.Context, and carried across
+// API calls in the requests' headers (in Zipkin's B3 format), so a
+// trace begun by a client continues in the daemon. They are exported
+// (e.g., to Zipkin or Jaeger) when they finish.
+//
+// Until an exporter is set, no spans are sampled, so code can be
+// instrumented without it costing anything when tracing is off.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/plugin/ochttp/propagation/b3"
+	"go.opencensus.io/trace"
+)
+
+var (
+	mu       sync.Mutex
+	exporter trace.Exporter
+)
+
+func init() {
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.NeverSample()})
+}
+
+// SetExporter sets where finished spans are sent, replacing any set
+// before, and the proportion of traces (from 0 to 1) to record; the
+// rest are started, but not recorded, along with all the spans in
+// them. Giving a nil exporter turns tracing off.
+func SetExporter(e trace.Exporter, rate float64) {
+	mu.Lock()
+	defer mu.Unlock()
+	if exporter != nil {
+		trace.UnregisterExporter(exporter)
+	}
+	exporter = e
+	if e == nil {
+		trace.ApplyConfig(trace.Config{DefaultSampler: trace.NeverSample()})
+		return
+	}
+	trace.RegisterExporter(e)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(rate)})
+}
+
+// Span is an operation being traced. A nil *Span is valid, and does
+// nothing; so is a span in a trace that isn't being recorded.
+type Span struct {
+	span *trace.Span
+}
+
+// Start begins a span for the operation named, as a child of the span
+// in the context given if there is one, or else as the root of a new
+// trace. It returns a context carrying the new span, to pass to
+// operations within it.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	ctx, span := trace.StartSpan(ctx, name)
+	return ctx, &Span{span: span}
+}
+
+// SetTag records a detail of the operation, e.g., the revision
+// synced.
+func (s *Span) SetTag(key, value string) {
+	if s == nil {
+		return
+	}
+	s.span.AddAttributes(trace.StringAttribute(key, value))
+}
+
+// Finish ends the span, recording the error if the operation failed,
+// and sends it to the exporter. Only the first call has any effect.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	s.span.End()
+}
+
+// HTTPHandler wraps the handler so that each request is traced,
+// continuing the trace of the client if it sent one.
+func HTTPHandler(h http.Handler) http.Handler {
+	return &ochttp.Handler{Handler: h, Propagation: &b3.HTTPFormat{}}
+}
+
+// HTTPTransport wraps the transport (or http.DefaultTransport, if nil)
+// so that each request is traced, and carries the trace along to the
+// server.
+func HTTPTransport(base http.RoundTripper) http.RoundTripper {
+	return &ochttp.Transport{Base: base, Propagation: &b3.HTTPFormat{}}
+}
@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *recorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+}
+
+func TestStart_NoExporter(t *testing.T) {
+	SetExporter(nil, 1)
+	_, span := Start(context.Background(), "sync")
+	// These are fine to call regardless
+	span.SetTag("revision", "abc")
+	span.Finish(nil)
+	var none *Span
+	none.SetTag("revision", "abc")
+	none.Finish(nil)
+}
+
+func TestStart_Nested(t *testing.T) {
+	rec := &recorder{}
+	SetExporter(rec, 1)
+	defer SetExporter(nil, 1)
+
+	ctx, span := Start(context.Background(), "sync")
+	span.SetTag("revision", "abc")
+	_, child := Start(ctx, "git.clone")
+	child.Finish(errors.New("clone failed"))
+	span.Finish(nil)
+	span.Finish(nil) // only counts once
+
+	if !assert.Len(t, rec.spans, 2) {
+		return
+	}
+	clone, root := rec.spans[0], rec.spans[1]
+	assert.Equal(t, "git.clone", clone.Name)
+	assert.Equal(t, root.TraceID, clone.TraceID)
+	assert.Equal(t, root.SpanID, clone.ParentSpanID)
+	assert.Equal(t, "clone failed", clone.Status.Message)
+	assert.Equal(t, trace.SpanID{}, root.ParentSpanID)
+	assert.Equal(t, "abc", root.Attributes["revision"])
+	assert.NotEqual(t, root.SpanID, clone.SpanID)
+}
+
+func TestStart_Unsampled(t *testing.T) {
+	rec := &recorder{}
+	SetExporter(rec, 0)
+	defer SetExporter(nil, 1)
+
+	ctx, root := Start(context.Background(), "sync")
+	_, child := Start(ctx, "git.clone")
+	child.SetTag("ref", "master")
+	child.Finish(nil)
+	root.Finish(nil)
+	assert.Empty(t, rec.spans)
+}
+
+func TestHTTPPropagation(t *testing.T) {
+	rec := &recorder{}
+	SetExporter(rec, 1)
+	defer SetExporter(nil, 1)
+
+	server := httptest.NewServer(HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "job")
+		span.Finish(nil)
+	})))
+	defer server.Close()
+
+	ctx, root := Start(context.Background(), "fluxctl")
+	req, _ := http.NewRequest("GET", server.URL+"/api/flux/v6/services", nil)
+	client := &http.Client{Transport: HTTPTransport(nil)}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	root.Finish(nil)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var job *trace.SpanData
+	for _, s := range rec.spans {
+		// Everything, including the requests either side, is in
+		// the one trace
+		assert.Equal(t, rec.spans[len(rec.spans)-1].TraceID, s.TraceID, s.Name)
+		if s.Name == "job" {
+			job = s
+		}
+	}
+	assert.NotNil(t, job, "span started in the handler")
+}
+
+func TestZipkinExporter(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		posted []map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var spans []map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&spans); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		posted = append(posted, spans...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	_, err := NewZipkinExporter("zipkin:9411", "fluxd", nil, log.NewNopLogger())
+	assert.Error(t, err)
+
+	z, err := NewZipkinExporter(server.URL+"/api/v2/spans", "fluxd", nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go z.Loop(stop, wg)
+
+	start := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	z.ExportSpan(&trace.SpanData{
+		SpanContext: trace.SpanContext{
+			TraceID: trace.TraceID{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+			SpanID:  trace.SpanID{0xfe, 0xdc, 0xba, 0x98, 0x76, 0x54, 0x32, 0x10},
+		},
+		ParentSpanID: trace.SpanID{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+		Name:         "git.clone",
+		StartTime:    start,
+		EndTime:      start.Add(1500 * time.Millisecond),
+		Attributes:   map[string]interface{}{"ref": "master"},
+	})
+	// Stopping sends whatever is waiting
+	close(stop)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Len(t, posted, 1) {
+		return
+	}
+	span := posted[0]
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", span["traceId"])
+	assert.Equal(t, "0123456789abcdef", span["parentId"])
+	assert.Equal(t, "fedcba9876543210", span["id"])
+	assert.Equal(t, "git.clone", span["name"])
+	assert.Equal(t, float64(start.UnixNano()/1000), span["timestamp"])
+	assert.Equal(t, float64(1500000), span["duration"])
+	assert.Equal(t, map[string]interface{}{"serviceName": "fluxd"}, span["localEndpoint"])
+	assert.Equal(t, map[string]interface{}{"ref": "master"}, span["tags"])
+}
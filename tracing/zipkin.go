@@ -0,0 +1,177 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"go.opencensus.io/trace"
+)
+
+const (
+	// How many spans can be waiting to be sent before more are
+	// dropped
+	zipkinQueueSize = 1000
+	// How many spans to send at a time
+	zipkinBatchSize = 100
+	// How long to wait before sending the spans waiting, if there
+	// aren't enough to make a batch
+	zipkinFlushInterval = 5 * time.Second
+)
+
+// ZipkinExporter is an OpenCensus trace exporter that sends spans,
+// in batches, to a Zipkin collector's HTTP API (v2, in JSON). Jaeger's
+// collector accepts the same, if it has its Zipkin endpoint enabled.
+type ZipkinExporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	logger      log.Logger
+	queue       chan zipkinSpan
+}
+
+var _ trace.Exporter = &ZipkinExporter{}
+
+// NewZipkinExporter returns an exporter that posts spans, as coming
+// from the service named, to the URL given; e.g.,
+// `http://zipkin:9411/api/v2/spans`.
+func NewZipkinExporter(collectorURL, serviceName string, client *http.Client, logger log.Logger) (*ZipkinExporter, error) {
+	u, err := url.Parse(collectorURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Zipkin collector URL %q; expected an http(s) URL", collectorURL)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &ZipkinExporter{
+		url:         collectorURL,
+		serviceName: serviceName,
+		client:      client,
+		logger:      logger,
+		queue:       make(chan zipkinSpan, zipkinQueueSize),
+	}, nil
+}
+
+// ExportSpan queues the span to be sent. If too many are waiting,
+// it's dropped.
+func (z *ZipkinExporter) ExportSpan(span *trace.SpanData) {
+	select {
+	case z.queue <- z.toZipkin(span):
+	default:
+		z.logger.Log("warning", "too many trace spans waiting to be sent; dropping one", "span", span.Name)
+	}
+}
+
+// Loop sends the spans queued, in batches, until told to stop; then
+// sends any that are left.
+func (z *ZipkinExporter) Loop(stop chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(zipkinFlushInterval)
+	defer ticker.Stop()
+	var batch []zipkinSpan
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := z.send(batch); err != nil {
+			z.logger.Log("err", err, "spans", len(batch))
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case <-stop:
+			for {
+				select {
+				case span := <-z.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		case span := <-z.queue:
+			batch = append(batch, span)
+			if len(batch) >= zipkinBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind,omitempty"`
+	Timestamp     int64             `json:"timestamp"` // microseconds since the epoch
+	Duration      int64             `json:"duration"`  // microseconds
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+func (z *ZipkinExporter) toZipkin(s *trace.SpanData) zipkinSpan {
+	duration := int64(s.EndTime.Sub(s.StartTime) / time.Microsecond)
+	if duration < 1 {
+		// Zipkin takes a zero duration to mean "unknown"
+		duration = 1
+	}
+	span := zipkinSpan{
+		TraceID:       s.TraceID.String(),
+		ID:            s.SpanID.String(),
+		Name:          s.Name,
+		Timestamp:     s.StartTime.UnixNano() / int64(time.Microsecond),
+		Duration:      duration,
+		LocalEndpoint: zipkinEndpoint{ServiceName: z.serviceName},
+	}
+	if s.ParentSpanID != (trace.SpanID{}) {
+		span.ParentID = s.ParentSpanID.String()
+	}
+	switch s.SpanKind {
+	case trace.SpanKindServer:
+		span.Kind = "SERVER"
+	case trace.SpanKindClient:
+		span.Kind = "CLIENT"
+	}
+	if len(s.Attributes) > 0 || s.Status.Code != trace.StatusCodeOK {
+		span.Tags = map[string]string{}
+		for k, v := range s.Attributes {
+			span.Tags[k] = fmt.Sprint(v)
+		}
+		if s.Status.Code != trace.StatusCodeOK {
+			span.Tags["error"] = s.Status.Message
+		}
+	}
+	return span
+}
+
+func (z *ZipkinExporter) send(payload []zipkinSpan) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := z.client.Post(z.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("sending trace spans: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("sending trace spans: collector responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
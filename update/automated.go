@@ -18,10 +18,13 @@ type Change struct {
 	ServiceID flux.ResourceID
 	Container resource.Container
 	ImageID   image.Ref
+	// What changed between the image running and the new one, if
+	// the images say
+	Changelog *Changelog `json:",omitempty"`
 }
 
 func (a *Automated) Add(service flux.ResourceID, container resource.Container, image image.Ref) {
-	a.Changes = append(a.Changes, Change{service, container, image})
+	a.Changes = append(a.Changes, Change{ServiceID: service, Container: container, ImageID: image})
 }
 
 func (a *Automated) CalculateRelease(rc ReleaseContext, logger log.Logger) ([]*ControllerUpdate, Result, error) {
@@ -55,23 +58,61 @@ func (a *Automated) ReleaseKind() ReleaseKind {
 func (a *Automated) CommitMessage(result Result) string {
 	images := result.ChangedImages()
 	buf := &bytes.Buffer{}
-	prefix := ""
 	switch len(images) {
 	case 0: // FIXME(michael): can we get here?
 		fmt.Fprintln(buf, "Auto-release (no images)")
 	case 1:
-		fmt.Fprint(buf, "Auto-release ")
+		fmt.Fprintf(buf, "Auto-release %s\n", images[0])
 	default:
 		fmt.Fprintln(buf, "Auto-release multiple images")
 		fmt.Fprintln(buf)
-		prefix = " - "
-	}
-	for _, im := range images {
-		fmt.Fprintf(buf, "%s%s\n", prefix, im)
+		for _, im := range images {
+			fmt.Fprintf(buf, " - %s\n", im)
+		}
+		// List each change made, one per line, so that batched
+		// updates can be picked apart by other tooling.
+		fmt.Fprintln(buf)
+		ids := result.AffectedResources()
+		ids.Sort()
+		for _, id := range ids {
+			for _, c := range result[id].PerContainer {
+				fmt.Fprintf(buf, "%s %s %s %s -> %s\n", id, c.Container, c.Target.Name, c.Current.TagWithDigest(), c.Target.TagWithDigest())
+			}
+		}
 	}
+	writeChangelogs(buf, result)
 	return buf.String()
 }
 
+// writeChangelogs adds a paragraph linking to the changes in each
+// image updated, for those images that say where they're from.
+func writeChangelogs(buf *bytes.Buffer, result Result) {
+	seen := map[string]bool{}
+	var lines []string
+	ids := result.AffectedResources()
+	ids.Sort()
+	for _, id := range ids {
+		for _, c := range result[id].PerContainer {
+			if c.Changelog == nil {
+				continue
+			}
+			line := fmt.Sprintf("%s: %s", c.Target.String(), c.Changelog)
+			if !seen[line] {
+				seen[line] = true
+				lines = append(lines, line)
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "Changes:")
+	for _, line := range lines {
+		fmt.Fprintf(buf, " - %s\n", line)
+	}
+}
+
 func (a *Automated) markSkipped(results Result) {
 	for _, v := range a.serviceIDs() {
 		if _, ok := results[v]; !ok {
@@ -103,14 +144,16 @@ func (a *Automated) calculateImageUpdates(rc ReleaseContext, candidates []*Contr
 					continue
 				}
 
-				// We transplant the tag here, to make sure we keep
-				// the format of the image name as it is in the
-				// resource (e.g., to avoid canonicalising it)
-				newImageID := currentImageID.WithNewTag(change.ImageID.Tag)
+				// We transplant the tag (and digest, if pinned) here,
+				// to make sure we keep the format of the image name as
+				// it is in the resource (e.g., to avoid canonicalising
+				// it)
+				newImageID := currentImageID.WithNewTag(change.ImageID.Tag).WithDigest(change.ImageID.Digest)
 				containerUpdates = append(containerUpdates, ContainerUpdate{
 					Container: container.Name,
 					Current:   currentImageID,
 					Target:    newImageID,
+					Changelog: change.Changelog,
 				})
 			}
 		}
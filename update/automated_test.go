@@ -0,0 +1,76 @@
+package update
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+)
+
+func TestAutomatedCommitMessage_Multiple(t *testing.T) {
+	ref := func(s string) image.Ref {
+		r, err := image.ParseRef(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	result := Result{
+		flux.MustParseResourceID("default:deployment/helloworld"): ControllerResult{
+			Status: ReleaseStatusSuccess,
+			PerContainer: []ContainerUpdate{{
+				Container: "greeter",
+				Current:   ref("quay.io/weaveworks/helloworld:v1"),
+				Target:    ref("quay.io/weaveworks/helloworld:v2"),
+			}},
+		},
+		flux.MustParseResourceID("default:deployment/sidecar"): ControllerResult{
+			Status: ReleaseStatusSuccess,
+			PerContainer: []ContainerUpdate{{
+				Container: "sidecar",
+				Current:   ref("quay.io/weaveworks/sidecar:1.0"),
+				Target:    ref("quay.io/weaveworks/sidecar:1.1"),
+			}},
+		},
+	}
+
+	expected := `Auto-release multiple images
+
+ - quay.io/weaveworks/helloworld:v2
+ - quay.io/weaveworks/sidecar:1.1
+
+default:deployment/helloworld greeter quay.io/weaveworks/helloworld v1 -> v2
+default:deployment/sidecar sidecar quay.io/weaveworks/sidecar 1.0 -> 1.1
+`
+	if msg := (&Automated{}).CommitMessage(result); msg != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, msg)
+	}
+}
+
+func TestAutomatedCommitMessage_Changelog(t *testing.T) {
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:v2")
+	current, _ := image.ParseRef("quay.io/weaveworks/helloworld:v1")
+	result := Result{
+		flux.MustParseResourceID("default:deployment/helloworld"): ControllerResult{
+			Status: ReleaseStatusSuccess,
+			PerContainer: []ContainerUpdate{{
+				Container: "greeter",
+				Current:   current,
+				Target:    ref,
+				Changelog: &Changelog{
+					Source:     "https://github.com/weaveworks/helloworld",
+					CompareURL: "https://github.com/weaveworks/helloworld/compare/aaa...bbb",
+				},
+			}},
+		},
+	}
+
+	expected := `Auto-release quay.io/weaveworks/helloworld:v2
+
+Changes:
+ - quay.io/weaveworks/helloworld:v2: https://github.com/weaveworks/helloworld/compare/aaa...bbb
+`
+	if msg := (&Automated{}).CommitMessage(result); msg != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, msg)
+	}
+}
@@ -0,0 +1,77 @@
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/weaveworks/flux/image"
+)
+
+// DefaultCompareURLTemplate makes a link to the changes between two
+// revisions, as understood by GitHub, GitLab and Gitea, among others.
+const DefaultCompareURLTemplate = "{{.Source}}/compare/{{.FromRevision}}...{{.ToRevision}}"
+
+// Changelog says what changed between the image a container was
+// running and the one it's updated to, as far as the images' labels
+// say: the source code repository they were built from, and the
+// revisions of each.
+type Changelog struct {
+	Source       string `json:"source"`
+	FromRevision string `json:"fromRevision,omitempty"`
+	ToRevision   string `json:"toRevision,omitempty"`
+	// A link to the changes between the revisions, if one can be
+	// made
+	CompareURL string `json:"compareURL,omitempty"`
+}
+
+// ParseCompareURLTemplate parses a template for links to the changes
+// between two revisions; it's given a Changelog.
+func ParseCompareURLTemplate(text string) (*template.Template, error) {
+	return template.New("compare-url").Option("missingkey=error").Parse(text)
+}
+
+// NewChangelog makes the changelog for updating from the image with
+// the first labels to that with the second, using the template given
+// (if it's not nil) to link to the changes. If the new image doesn't
+// say where it's from, there's nothing to say, and it returns nil.
+func NewChangelog(from, to image.Labels, compareURL *template.Template) (*Changelog, error) {
+	if to.Source == "" {
+		return nil, nil
+	}
+	c := &Changelog{
+		Source:     trimSource(to.Source),
+		ToRevision: to.Revision,
+	}
+	// The old revision means nothing if it's from another repo
+	if trimSource(from.Source) == c.Source {
+		c.FromRevision = from.Revision
+	}
+	if compareURL != nil && c.FromRevision != "" && c.ToRevision != "" && c.FromRevision != c.ToRevision {
+		buf := &bytes.Buffer{}
+		if err := compareURL.Execute(buf, c); err != nil {
+			return c, fmt.Errorf("executing compare URL template: %s", err)
+		}
+		c.CompareURL = buf.String()
+	}
+	return c, nil
+}
+
+// String gives the link to the changes, if there is one, or
+// otherwise the repository and revisions.
+func (c Changelog) String() string {
+	switch {
+	case c.CompareURL != "":
+		return c.CompareURL
+	case c.FromRevision != "" && c.ToRevision != "":
+		return fmt.Sprintf("%s %s...%s", c.Source, c.FromRevision, c.ToRevision)
+	case c.ToRevision != "":
+		return fmt.Sprintf("%s %s", c.Source, c.ToRevision)
+	}
+	return c.Source
+}
+
+func trimSource(source string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(source, "/"), ".git")
+}
@@ -0,0 +1,40 @@
+package update
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux/image"
+)
+
+func TestNewChangelog(t *testing.T) {
+	tmpl, err := ParseCompareURLTemplate(DefaultCompareURLTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := "https://github.com/org/app"
+	for _, c := range []struct {
+		name     string
+		from, to image.Labels
+		expected string
+	}{
+		{"compare", image.Labels{Source: source, Revision: "aaa"}, image.Labels{Source: source + ".git", Revision: "bbb"}, source + "/compare/aaa...bbb"},
+		{"old image not labelled", image.Labels{}, image.Labels{Source: source, Revision: "bbb"}, source + " bbb"},
+		{"different repo", image.Labels{Source: "https://github.com/org/other", Revision: "aaa"}, image.Labels{Source: source, Revision: "bbb"}, source + " bbb"},
+		{"same revision", image.Labels{Source: source, Revision: "aaa"}, image.Labels{Source: source, Revision: "aaa"}, source + " aaa...aaa"},
+	} {
+		changelog, err := NewChangelog(c.from, c.to, tmpl)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if changelog == nil || changelog.String() != c.expected {
+			t.Errorf("%s: expected %q, got %v", c.name, c.expected, changelog)
+		}
+	}
+
+	if changelog, _ := NewChangelog(image.Labels{Source: source}, image.Labels{Revision: "bbb"}, tmpl); changelog != nil {
+		t.Errorf("expected no changelog for an image that doesn't give its source, got %v", changelog)
+	}
+	if changelog, _ := NewChangelog(image.Labels{Source: source, Revision: "aaa"}, image.Labels{Source: source, Revision: "bbb"}, nil); changelog.CompareURL != "" {
+		t.Errorf("expected no link without a template, got %q", changelog.CompareURL)
+	}
+}
@@ -18,6 +18,7 @@ const (
 	DoesNotUseImage      = "does not use image(s)"
 	ContainerNotFound    = "container(s) not found: %s"
 	ContainerTagMismatch = "container(s) tag mismatch: %s"
+	GeneratedFrom        = "generated from %s"
 )
 
 type SpecificImageFilter struct {
@@ -0,0 +1,27 @@
+package update
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+)
+
+// HelmValueUpdates is a set of values to set in a FluxHelmRelease,
+// in a single commit.
+type HelmValueUpdates struct {
+	Release flux.ResourceID     `json:"release"`
+	Values  []cluster.HelmValue `json:"values"`
+}
+
+// Validate checks that there are values to set, and that they are
+// being set in a FluxHelmRelease.
+func (u HelmValueUpdates) Validate() error {
+	if _, kind, _ := u.Release.Components(); kind != "fluxhelmrelease" {
+		return errors.Errorf("%s is not a FluxHelmRelease", u.Release)
+	}
+	if len(u.Values) == 0 {
+		return errors.New("no values given")
+	}
+	return nil
+}
@@ -19,6 +19,7 @@ type imageReposMap map[image.CanonicalName]ImageInfos
 // ImageRepos contains a map of image repositories to their images
 type ImageRepos struct {
 	imageRepos imageReposMap
+	errs       map[image.CanonicalName]error
 }
 
 // GetRepoImages returns image.Info entries for all the images in the
@@ -35,6 +36,14 @@ func (r ImageRepos) GetRepoImages(repo image.Name) ImageInfos {
 	return nil
 }
 
+// GetRepoError returns the error, if there was one, from getting the
+// images in the named image repository. If the images are stale, this
+// is a *registry.StaleError, and the last known images are still
+// returned by GetRepoImages.
+func (r ImageRepos) GetRepoError(repo image.Name) error {
+	return r.errs[repo.CanonicalName()]
+}
+
 // ImageInfos is a list of image.Info which can be filtered.
 type ImageInfos []image.Info
 
@@ -61,16 +70,36 @@ func (ii ImageInfos) FilterAndSort(pattern policy.Pattern) SortedImageInfos {
 }
 
 // FindWithRef returns image.Info given an image ref. If the image cannot be
-// found, it returns the image.Info with the ID provided.
+// found, it returns the image.Info with the ID provided. The images
+// are looked up by tag, so a ref pinned to a digest will still find
+// its image.
 func (ii ImageInfos) FindWithRef(ref image.Ref) image.Info {
 	for _, img := range ii {
-		if img.ID == ref {
+		if img.ID == ref.WithDigest("") {
+			img.ID = ref
 			return img
 		}
 	}
 	return image.Info{ID: ref}
 }
 
+// UpdatedImage works out the image a container using `current`
+// should be updated to, given the latest image available, and
+// whether that would be a change. The new image keeps the form of the
+// name used in `current`. If pinning digests, and the digest of the
+// latest image is known, it is included; otherwise, digests are left
+// alone while the tag stays the same.
+func UpdatedImage(current image.Ref, latest image.Info, pinDigest bool) (image.Ref, bool) {
+	if pinDigest && latest.Digest != "" {
+		updated := current.WithNewTag(latest.ID.Tag).WithDigest(latest.Digest)
+		return updated, updated != current
+	}
+	if current.Tag == latest.ID.Tag {
+		return current, false
+	}
+	return current.WithNewTag(latest.ID.Tag), true
+}
+
 // Latest returns the latest image from SortedImageInfos. If no such image exists,
 // returns a zero value and `false`, and the caller can decide whether
 // that's an error or not.
@@ -147,18 +176,24 @@ func FetchImageRepos(reg registry.Registry, cs containers, logger log.Logger) (I
 			imageRepos[container.Image.CanonicalName()] = nil
 		}
 	}
+	errs := map[image.CanonicalName]error{}
 	for repo := range imageRepos {
 		images, err := reg.GetRepositoryImages(repo.Name)
-		if err != nil {
+		switch {
+		case err == nil:
+		case registry.IsStale(err):
+			// Use the last known images, but note they are stale.
+			errs[repo] = err
+		case fluxerr.IsMissing(err):
 			// Not an error if missing. Use empty images.
-			if !fluxerr.IsMissing(err) {
-				logger.Log("err", errors.Wrapf(err, "fetching image metadata for %s", repo))
-				continue
-			}
+		default:
+			logger.Log("err", errors.Wrapf(err, "fetching image metadata for %s", repo))
+			errs[repo] = err
+			continue
 		}
 		imageRepos[repo] = images
 	}
-	return ImageRepos{imageRepos}, nil
+	return ImageRepos{imageRepos: imageRepos, errs: errs}, nil
 }
 
 // Create a map of image repos to images. It will check that each image exists.
@@ -175,7 +210,7 @@ func exactImageRepos(reg registry.Registry, images []image.Ref) (ImageRepos, err
 		}
 		m[id.CanonicalName()] = []image.Info{{ID: id}}
 	}
-	return ImageRepos{m}, nil
+	return ImageRepos{imageRepos: m}, nil
 }
 
 // Checks whether the given image exists in the repository.
@@ -23,7 +23,7 @@ var (
 // names (e.g., `index.docker.io/library/alpine`), but we ask
 // questions in terms of everyday names (e.g., `alpine`).
 func TestDecanon(t *testing.T) {
-	m := ImageRepos{imageReposMap{
+	m := ImageRepos{imageRepos: imageReposMap{
 		name: infos,
 	}}
 
@@ -79,7 +79,7 @@ func TestImageInfos_Filter_semver(t *testing.T) {
 }
 
 func TestAvail(t *testing.T) {
-	m := ImageRepos{imageReposMap{name: infos}}
+	m := ImageRepos{imageRepos: imageReposMap{name: infos}}
 	avail := m.GetRepoImages(mustParseName("weaveworks/goodbyeworld"))
 	if len(avail) > 0 {
 		t.Errorf("did not expect available images, but got %#v", avail)
@@ -93,3 +93,29 @@ func mustParseName(im string) image.Name {
 	}
 	return ref.Name
 }
+
+func TestUpdatedImage(t *testing.T) {
+	const digest = "sha256:5e9a5e1b8a1b7b8b1fba6a8d0c4f3d8a7b9d3a6c8f4c3e2d1b0a9f8e7d6c5b4a"
+	current := name.ToRef("v1")
+	latest := image.Info{ID: name.ToRef("v2"), Digest: digest}
+
+	updated, changed := UpdatedImage(current, latest, false)
+	assert.True(t, changed)
+	assert.Equal(t, name.ToRef("v2"), updated)
+
+	updated, changed = UpdatedImage(current, latest, true)
+	assert.True(t, changed)
+	assert.Equal(t, name.ToRef("v2").WithDigest(digest), updated)
+
+	// Already pinned to the latest image
+	_, changed = UpdatedImage(updated, latest, true)
+	assert.False(t, changed)
+	// .. and the digest is left alone if not pinning
+	updated, changed = UpdatedImage(updated, latest, false)
+	assert.False(t, changed)
+	assert.Equal(t, digest, updated.Digest)
+
+	// The same tag, pushed again, is a change when pinning
+	_, changed = UpdatedImage(name.ToRef("v2").WithDigest("sha256:0000"), latest, true)
+	assert.True(t, changed)
+}
@@ -0,0 +1,66 @@
+package update
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/policy"
+)
+
+// PolicySelector is a policy update to be made to every workload
+// selected, in a single commit. A workload is selected if its ID
+// matches any of the patterns given (or there are none), and its
+// labels match the label selector (if there is one).
+type PolicySelector struct {
+	// Patterns for workload IDs, e.g., `default:deployment/*`. As
+	// with file paths, `*` and `?` don't match the `/` between kind
+	// and name.
+	Workloads []string `json:"workloads,omitempty"`
+	// A Kubernetes label selector, e.g., `team=payments,tier!=db`
+	LabelSelector string        `json:"labelSelector,omitempty"`
+	Update        policy.Update `json:"update"`
+}
+
+// Validate checks that the patterns and label selector can be used.
+func (s PolicySelector) Validate() error {
+	if len(s.Workloads) == 0 && s.LabelSelector == "" {
+		return errors.New("no workload patterns or label selector given")
+	}
+	for _, pattern := range s.Workloads {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "workload pattern %q", pattern)
+		}
+	}
+	_, err := labels.Parse(s.LabelSelector)
+	return errors.Wrap(err, "label selector")
+}
+
+// Select gives the IDs of the workloads selected from those given.
+func (s PolicySelector) Select(workloads []cluster.Controller) ([]flux.ResourceID, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	selector, _ := labels.Parse(s.LabelSelector)
+
+	var ids []flux.ResourceID
+	for _, w := range workloads {
+		if !selector.Matches(labels.Set(w.Labels)) {
+			continue
+		}
+		if len(s.Workloads) == 0 {
+			ids = append(ids, w.ID)
+			continue
+		}
+		for _, pattern := range s.Workloads {
+			if ok, _ := path.Match(pattern, w.ID.String()); ok {
+				ids = append(ids, w.ID)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
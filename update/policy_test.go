@@ -0,0 +1,56 @@
+package update
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+)
+
+func TestPolicySelector(t *testing.T) {
+	workloads := []cluster.Controller{
+		{ID: flux.MustParseResourceID("default:deployment/frontend"), Labels: map[string]string{"team": "web"}},
+		{ID: flux.MustParseResourceID("default:deployment/payments"), Labels: map[string]string{"team": "payments"}},
+		{ID: flux.MustParseResourceID("default:statefulset/db"), Labels: map[string]string{"team": "payments"}},
+		{ID: flux.MustParseResourceID("other:deployment/frontend")},
+	}
+
+	for _, c := range []struct {
+		selector PolicySelector
+		expected []string
+	}{
+		{PolicySelector{Workloads: []string{"default:deployment/*"}},
+			[]string{"default:deployment/frontend", "default:deployment/payments"}},
+		{PolicySelector{Workloads: []string{"*:deployment/frontend", "default:statefulset/*"}},
+			[]string{"default:deployment/frontend", "default:statefulset/db", "other:deployment/frontend"}},
+		{PolicySelector{LabelSelector: "team=payments"},
+			[]string{"default:deployment/payments", "default:statefulset/db"}},
+		{PolicySelector{Workloads: []string{"*:deployment/*"}, LabelSelector: "team"},
+			[]string{"default:deployment/frontend", "default:deployment/payments"}},
+		// `*` doesn't match across the slash
+		{PolicySelector{Workloads: []string{"default:*"}}, nil},
+	} {
+		ids, err := c.selector.Select(workloads)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, id := range ids {
+			got = append(got, id.String())
+		}
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%+v: expected %v, got %v", c.selector, c.expected, got)
+		}
+	}
+
+	for _, s := range []PolicySelector{
+		{},
+		{Workloads: []string{"default:deployment/[a-"}},
+		{LabelSelector: "team in ("},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", s)
+		}
+	}
+}
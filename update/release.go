@@ -223,15 +223,23 @@ func (s ReleaseSpec) calculateImageUpdates(rc ReleaseContext, candidates []*Cont
 		var containerUpdates []ContainerUpdate
 
 		for _, container := range containers {
+			// Containers looked after by something else, e.g., a
+			// service mesh's sidecars, are never updated here
+			if policy.IgnoresContainer(u.Resource.Policy(), container.Name) {
+				continue
+			}
 			currentImageID := container.Image
 
-			tagPattern := policy.PatternAll
-			// Use the container's filter if the spec does not want to force release, or
-			// all images requested
-			if !s.Force || s.ImageSpec == ImageSpecLatest {
-				if pattern, ok := u.Resource.Policy().Get(policy.TagPrefix(container.Name)); ok {
-					tagPattern = policy.NewPattern(pattern)
-				}
+			tagPattern := policy.WithOrdering(u.Resource.Policy(), policy.PatternAll)
+			_, pinned := policy.PinnedTag(u.Resource.Policy(), container.Name)
+			switch {
+			case pinned && s.ImageSpec != ImageSpecLatest:
+				// A pinned container can still be released to a
+				// particular image; the pin moves with it
+			case !s.Force || s.ImageSpec == ImageSpecLatest:
+				// Use the container's filter if the spec does not want to force release, or
+				// all images requested
+				tagPattern = policy.GetTagPattern(u.Resource.Policy(), container.Name)
 			}
 
 			filteredImages := imageRepos.GetRepoImages(currentImageID.Name).FilterAndSort(tagPattern)
@@ -245,15 +253,14 @@ func (s ReleaseSpec) calculateImageUpdates(rc ReleaseContext, candidates []*Cont
 				continue
 			}
 
-			if currentImageID == latestImage.ID {
-				ignoredOrSkipped = ReleaseStatusSkipped
-				continue
-			}
-
 			// We want to update the image with respect to the form it
 			// appears in the manifest, whereas what we have is the
 			// canonical form.
-			newImageID := currentImageID.WithNewTag(latestImage.ID.Tag)
+			newImageID, changed := UpdatedImage(currentImageID, latestImage, u.Resource.Policy().Has(policy.PinDigest))
+			if !changed {
+				ignoredOrSkipped = ReleaseStatusSkipped
+				continue
+			}
 			containerUpdates = append(containerUpdates, ContainerUpdate{
 				Container: container.Name,
 				Current:   currentImageID,
@@ -88,4 +88,7 @@ type ContainerUpdate struct {
 	Container string
 	Current   image.Ref
 	Target    image.Ref
+	// For automated updates, what changed between the images, if
+	// they say
+	Changelog *Changelog `json:",omitempty"`
 }
@@ -10,9 +10,11 @@ import (
 const (
 	Images     = "image"
 	Policy     = "policy"
+	Policies   = "policies"
 	Auto       = "auto"
 	Sync       = "sync"
 	Containers = "containers"
+	HelmValues = "helmValues"
 )
 
 // How did this update get triggered?
@@ -48,6 +50,12 @@ func (spec *Spec) UnmarshalJSON(in []byte) error {
 			return err
 		}
 		spec.Spec = update
+	case Policies:
+		var update PolicySelector
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
 	case Images:
 		var update ReleaseSpec
 		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
@@ -71,6 +79,12 @@ func (spec *Spec) UnmarshalJSON(in []byte) error {
 			return err
 		}
 		spec.Spec = update
+	case HelmValues:
+		var update HelmValueUpdates
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
 	default:
 		return errors.New("unknown spec type: " + wire.Type)
 	}
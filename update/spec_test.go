@@ -1,6 +1,13 @@
 package update
 
-import "testing"
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+)
 
 func TestParseImageSpec(t *testing.T) {
 	parseSpec(t, "valid/image:tag", false)
@@ -22,3 +29,28 @@ func parseSpec(t *testing.T, image string, expectError bool) {
 		t.Fatalf("Expected string spec %q but got %q", image, string(spec))
 	}
 }
+
+func TestHelmValuesSpecRoundTrip(t *testing.T) {
+	spec := Spec{
+		Type:  HelmValues,
+		Cause: Cause{User: "alice"},
+		Spec: HelmValueUpdates{
+			Release: flux.MustParseResourceID("blog:fluxhelmrelease/ghost"),
+			Values: []cluster.HelmValue{
+				{Path: []string{"image", "tag"}, Value: "1.22.0"},
+				{Path: []string{"replicas"}, Value: "3", AsString: true},
+			},
+		},
+	}
+	bytes, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Spec
+	if err := json.Unmarshal(bytes, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, spec) {
+		t.Errorf("expected %#v, got %#v", spec, got)
+	}
+}
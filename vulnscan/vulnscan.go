@@ -0,0 +1,223 @@
+// Package vulnscan asks an image scanner -- e.g., Anchore Engine, or
+// Clair or Trivy behind a small adapter -- what vulnerabilities an
+// image has, so that automation can pass over images with serious
+// ones.
+package vulnscan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Severity is how serious a vulnerability is, as one of the levels
+// below.
+type Severity string
+
+const (
+	Unknown    Severity = "unknown"
+	Negligible Severity = "negligible"
+	Low        Severity = "low"
+	Medium     Severity = "medium"
+	High       Severity = "high"
+	Critical   Severity = "critical"
+)
+
+var severityRank = map[Severity]int{
+	Unknown:    0,
+	Negligible: 1,
+	Low:        2,
+	Medium:     3,
+	High:       4,
+	Critical:   5,
+}
+
+// ParseSeverity reads a severity, in any case, e.g., `HIGH` or
+// `High`.
+func ParseSeverity(s string) (Severity, error) {
+	sev := Severity(strings.ToLower(s))
+	if _, ok := severityRank[sev]; !ok {
+		return "", fmt.Errorf("unknown severity %q (expected one of negligible, low, medium, high, critical)", s)
+	}
+	return sev, nil
+}
+
+// normalise gives the severity in lower case, or Unknown if it's not
+// one of the levels; scanners differ in how they write them.
+func normalise(s Severity) Severity {
+	if sev, err := ParseSeverity(string(s)); err == nil {
+		return sev
+	}
+	return Unknown
+}
+
+// Exceeds reports whether the severity is worse than the one given.
+func (s Severity) Exceeds(threshold Severity) bool {
+	return severityRank[normalise(s)] > severityRank[normalise(threshold)]
+}
+
+// Vulnerability is a single vulnerability found in an image.
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Severity Severity `json:"severity"`
+}
+
+// Report is what a scanner found in an image.
+type Report struct {
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// Exceeding gives the vulnerabilities in the report that are worse
+// than the threshold, counting those of unknown severity as being of
+// the severity `unknown` instead. If that isn't one of the levels
+// either, they're counted as critical, so that nothing the scanner
+// can't rate slips through.
+func (r Report) Exceeding(threshold, unknown Severity) []Vulnerability {
+	if normalise(unknown) == Unknown {
+		unknown = Critical
+	}
+	var vulns []Vulnerability
+	for _, v := range r.Vulnerabilities {
+		severity := normalise(v.Severity)
+		if severity == Unknown {
+			severity = unknown
+		}
+		if severity.Exceeds(threshold) {
+			vulns = append(vulns, v)
+		}
+	}
+	return vulns
+}
+
+// Scanner looks up the vulnerabilities in an image, given as its
+// canonical name and digest (e.g.,
+// `docker.io/weaveworks/helloworld@sha256:...`).
+type Scanner interface {
+	Scan(ctx context.Context, image string) (Report, error)
+}
+
+// The kinds of scanner that can be used.
+const (
+	KindWebhook = "webhook"
+	KindAnchore = "anchore"
+)
+
+// New returns a Scanner of the kind given.
+func New(kind, url string, client *http.Client) (Scanner, error) {
+	switch kind {
+	case KindWebhook:
+		return NewWebhook(url, client), nil
+	case KindAnchore:
+		return NewAnchore(url, client), nil
+	}
+	return nil, fmt.Errorf("unknown kind of vulnerability scanner %q (expected %q or %q)", kind, KindWebhook, KindAnchore)
+}
+
+// maxResponse is the most of a response body that will be read;
+// reports for large images can list thousands of vulnerabilities.
+const maxResponse = 16 * 1024 * 1024
+
+type webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook returns a Scanner that POSTs `{"image": <image>}` to the
+// URL given, and expects a 2xx response with a Report in JSON.
+func NewWebhook(url string, client *http.Client) Scanner {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webhook{url: url, client: client}
+}
+
+func (w *webhook) Scan(ctx context.Context, image string) (Report, error) {
+	body, err := json.Marshal(map[string]string{"image": image})
+	if err != nil {
+		return Report{}, err
+	}
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return Report{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var report Report
+	if err := do(ctx, w.client, req, &report); err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+type anchore struct {
+	url    string
+	client *http.Client
+}
+
+// NewAnchore returns a Scanner that asks the Anchore Engine API at
+// the URL given -- with any credentials in the URL -- for the
+// vulnerabilities of images it has analysed. Images it hasn't
+// analysed are an error, until it has.
+func NewAnchore(url string, client *http.Client) Scanner {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &anchore{url: strings.TrimSuffix(url, "/"), client: client}
+}
+
+func (a *anchore) Scan(ctx context.Context, image string) (Report, error) {
+	i := strings.LastIndex(image, "@")
+	if i < 0 {
+		return Report{}, fmt.Errorf("image %s has no digest", image)
+	}
+	req, err := http.NewRequest("GET", a.url+"/v1/images/"+url.PathEscape(image[i+1:])+"/vuln/all", nil)
+	if err != nil {
+		return Report{}, err
+	}
+	if user := req.URL.User; user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+		req.URL.User = nil
+	}
+	var resp struct {
+		Vulnerabilities []struct {
+			Vuln     string   `json:"vuln"`
+			Severity Severity `json:"severity"`
+		} `json:"vulnerabilities"`
+	}
+	if err := do(ctx, a.client, req, &resp); err != nil {
+		return Report{}, err
+	}
+	var report Report
+	for _, v := range resp.Vulnerabilities {
+		report.Vulnerabilities = append(report.Vulnerabilities, Vulnerability{ID: v.Vuln, Severity: v.Severity})
+	}
+	return report, nil
+}
+
+// do makes the request given, and decodes a successful response, as
+// JSON, into `into`.
+func do(ctx context.Context, client *http.Client, req *http.Request, into interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("vulnerability scanner %s responded with %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(body))
+	}
+	if err := json.Unmarshal(body, into); err != nil {
+		return fmt.Errorf("decoding response from vulnerability scanner %s: %s", req.URL.Host, err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package vulnscan
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testImage = "docker.io/weaveworks/helloworld@sha256:abc123"
+
+func TestSeverity(t *testing.T) {
+	for _, s := range []string{"negligible", "LOW", "Medium", "high", "critical"} {
+		_, err := ParseSeverity(s)
+		assert.NoError(t, err, s)
+	}
+	_, err := ParseSeverity("dire")
+	assert.Error(t, err)
+
+	assert.True(t, Critical.Exceeds(High))
+	assert.True(t, Severity("HIGH").Exceeds(Medium))
+	assert.False(t, Medium.Exceeds(Medium))
+	assert.False(t, Severity("whatever").Exceeds(Negligible))
+
+	report := Report{Vulnerabilities: []Vulnerability{
+		{ID: "CVE-1", Severity: Low},
+		{ID: "CVE-2", Severity: High},
+		{ID: "CVE-3", Severity: Medium},
+	}}
+	assert.Equal(t, []Vulnerability{{ID: "CVE-2", Severity: High}}, report.Exceeding(Medium, Critical))
+	assert.Empty(t, report.Exceeding(Critical, Critical))
+
+	// Vulnerabilities of unknown severity count as the severity
+	// given for them, or as critical
+	report.Vulnerabilities = append(report.Vulnerabilities, Vulnerability{ID: "CVE-4", Severity: "whatever"})
+	assert.Equal(t, []Vulnerability{{ID: "CVE-2", Severity: High}}, report.Exceeding(Medium, Low))
+	assert.Equal(t, []Vulnerability{{ID: "CVE-2", Severity: High}, {ID: "CVE-4", Severity: "whatever"}}, report.Exceeding(Medium, High))
+	assert.Equal(t, []Vulnerability{{ID: "CVE-4", Severity: "whatever"}}, report.Exceeding(High, ""))
+}
+
+func TestWebhook(t *testing.T) {
+	var received map[string]string
+	response, status := "", http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	scanner := NewWebhook(server.URL, nil)
+	for _, c := range []struct {
+		status   int
+		response string
+		report   Report
+		err      bool
+	}{
+		{http.StatusOK, `{"vulnerabilities":[]}`, Report{Vulnerabilities: []Vulnerability{}}, false},
+		{http.StatusOK, `{"vulnerabilities":[{"id":"CVE-2019-1","severity":"high"}]}`, Report{Vulnerabilities: []Vulnerability{{ID: "CVE-2019-1", Severity: High}}}, false},
+		{http.StatusOK, `not json`, Report{}, true},
+		{http.StatusNotFound, `{"vulnerabilities":[]}`, Report{}, true},
+	} {
+		status, response = c.status, c.response
+		report, err := scanner.Scan(context.Background(), testImage)
+		assert.Equal(t, c.err, err != nil, c.response)
+		assert.Equal(t, c.report, report, c.response)
+	}
+	assert.Equal(t, map[string]string{"image": testImage}, received)
+}
+
+func TestAnchore(t *testing.T) {
+	var path, user, password string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		user, password, _ = r.BasicAuth()
+		w.Write([]byte(`{"imageDigest":"sha256:abc123","vulnerabilities":[{"vuln":"CVE-2019-2","severity":"Critical","package":"openssl"}]}`))
+	}))
+	defer server.Close()
+
+	scanner, err := New(KindAnchore, "http://admin:foobar@"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := scanner.Scan(context.Background(), testImage)
+	assert.NoError(t, err)
+	assert.Equal(t, "/v1/images/sha256:abc123/vuln/all", path)
+	assert.Equal(t, "admin", user)
+	assert.Equal(t, "foobar", password)
+	if assert.Len(t, report.Vulnerabilities, 1) {
+		assert.Equal(t, "CVE-2019-2", report.Vulnerabilities[0].ID)
+		assert.True(t, report.Vulnerabilities[0].Severity.Exceeds(High))
+	}
+
+	_, err = scanner.Scan(context.Background(), "docker.io/weaveworks/helloworld:1")
+	assert.Error(t, err)
+	_, err = New("clairvoyant", server.URL, nil)
+	assert.Error(t, err)
+}